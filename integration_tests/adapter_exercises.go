@@ -72,6 +72,9 @@ func (s *AdapterExercises) RunTests(t *testing.T) {
 	t.Run("TestAddApiKey", s.TestAddApiKey)
 	t.Run("TestGetApiKey", s.TestGetApiKey)
 	t.Run("TestDeleteApiKey", s.TestDeleteApiKey)
+	t.Run("TestUserLogins", s.TestUserLogins)
+	t.Run("TestRateLimits", s.TestRateLimits)
+	t.Run("TestRelationTuples", s.TestRelationTuples)
 	t.Run("TestAddOrganization", s.TestAddOrganization)
 	t.Run("TestGetOrganization", s.TestGetOrganization)
 
@@ -179,7 +182,7 @@ func (s *AdapterExercises) TestAddApiKey(t *testing.T) {
 	orgID := int64(1)
 
 	// Update the user
-	err := s.adapter.UserAddApiKey(ctx, sampleUser.UserID, orgID, apiKeyId, apiKeySecret, name, time.Now(), time.Now().Add(24*time.Hour))
+	err := s.adapter.UserAddApiKey(ctx, sampleUser.UserID, orgID, apiKeyId, apiKeySecret, name, time.Now(), time.Now().Add(24*time.Hour), nil, nil)
 	if err != nil {
 		t.Fatalf("UserAddApiKey failed: %v", err)
 	}
@@ -214,7 +217,7 @@ func (s *AdapterExercises) TestDeleteApiKey(t *testing.T) {
 	orgID := int64(1)
 
 	// First add an API key to delete
-	err := s.adapter.UserAddApiKey(ctx, userID, orgID, apiKeyId, apiKeySecret, "Key to Delete", time.Now(), time.Now().Add(24*time.Hour))
+	err := s.adapter.UserAddApiKey(ctx, userID, orgID, apiKeyId, apiKeySecret, "Key to Delete", time.Now(), time.Now().Add(24*time.Hour), nil, nil)
 	if err != nil {
 		t.Fatalf("Setup: UserAddApiKey failed: %v", err)
 	}
@@ -238,6 +241,172 @@ func (s *AdapterExercises) TestDeleteApiKey(t *testing.T) {
 	}
 }
 
+func (s *AdapterExercises) TestUserLogins(t *testing.T) {
+	ctx := t.Context()
+	userID := sampleUser.UserID
+	now := time.Now().Unix()
+
+	logins := []ubdata.UserLogin{
+		{UserID: userID, OccurredAt: now - 20, Outcome: ubdata.UserLoginOutcomeFailed, Reason: "Password does not match", IpAddress: "10.1.2.3", UserAgent: "agent-a", DeviceId: "device-a"},
+		{UserID: userID, OccurredAt: now - 10, Outcome: ubdata.UserLoginOutcomeSucceeded, IpAddress: "10.1.2.4", UserAgent: "agent-a", DeviceId: "device-a"},
+		{UserID: userID + 1000, OccurredAt: now, Outcome: ubdata.UserLoginOutcomeSucceeded, IpAddress: "192.168.0.1", UserAgent: "agent-b", DeviceId: "device-b"},
+	}
+	for _, l := range logins {
+		if err := s.adapter.AddUserLogin(ctx, l); err != nil {
+			t.Fatalf("AddUserLogin failed: %v", err)
+		}
+	}
+
+	history, err := s.adapter.ListUserLogins(ctx, userID, 10, 0)
+	if err != nil {
+		t.Fatalf("ListUserLogins failed: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 logins, got %d", len(history))
+	}
+	if history[0].IpAddress != "10.1.2.4" || history[0].Outcome != ubdata.UserLoginOutcomeSucceeded {
+		t.Errorf("Expected most recent login first, got %+v", history[0])
+	}
+	if history[1].Reason != "Password does not match" || history[1].DeviceId != "device-a" {
+		t.Errorf("Unexpected login details: %+v", history[1])
+	}
+
+	byPrefix, err := s.adapter.SearchUserLoginsByIp(ctx, "10.1.2.", 10, 0)
+	if err != nil {
+		t.Fatalf("SearchUserLoginsByIp failed: %v", err)
+	}
+	if len(byPrefix) != 2 {
+		t.Fatalf("Expected 2 logins by prefix, got %d", len(byPrefix))
+	}
+
+	exact, err := s.adapter.SearchUserLoginsByIp(ctx, "192.168.0.1", 10, 0)
+	if err != nil {
+		t.Fatalf("SearchUserLoginsByIp failed: %v", err)
+	}
+	if len(exact) != 1 || exact[0].UserID != userID+1000 {
+		t.Fatalf("Expected 1 login for other user, got %+v", exact)
+	}
+
+	if err := s.adapter.DeleteUserLogins(ctx, userID); err != nil {
+		t.Fatalf("DeleteUserLogins failed: %v", err)
+	}
+	history, err = s.adapter.ListUserLogins(ctx, userID, 10, 0)
+	if err != nil {
+		t.Fatalf("ListUserLogins failed: %v", err)
+	}
+	if len(history) != 0 {
+		t.Fatalf("Expected no logins after delete, got %d", len(history))
+	}
+}
+
+func (s *AdapterExercises) TestRateLimits(t *testing.T) {
+	ctx := t.Context()
+	now := time.Now().UnixMilli()
+
+	_, found, err := s.adapter.GetRateLimit(ctx, "test:bucket")
+	if err != nil {
+		t.Fatalf("GetRateLimit failed: %v", err)
+	}
+	if found {
+		t.Fatal("Expected no rate limit before insert")
+	}
+
+	limit := ubdata.RateLimit{Key: "test:bucket", Amount: 2.5, PreviousAmount: 1, UpdatedAt: now, ExpiresAt: now + 60_000}
+	inserted, err := s.adapter.InsertRateLimit(ctx, limit)
+	if err != nil {
+		t.Fatalf("InsertRateLimit failed: %v", err)
+	}
+	if !inserted {
+		t.Fatal("Expected rate limit to be inserted")
+	}
+	inserted, err = s.adapter.InsertRateLimit(ctx, limit)
+	if err != nil {
+		t.Fatalf("InsertRateLimit failed: %v", err)
+	}
+	if inserted {
+		t.Fatal("Expected duplicate insert to be ignored")
+	}
+
+	stored, found, err := s.adapter.GetRateLimit(ctx, "test:bucket")
+	if err != nil || !found {
+		t.Fatalf("GetRateLimit failed: %v (found %v)", err, found)
+	}
+	if stored.Amount != 2.5 || stored.PreviousAmount != 1 || stored.ExpiresAt != now+60_000 {
+		t.Errorf("Unexpected rate limit: %+v", stored)
+	}
+
+	stored.Amount = 1.5
+	updated, err := s.adapter.UpdateRateLimit(ctx, stored)
+	if err != nil {
+		t.Fatalf("UpdateRateLimit failed: %v", err)
+	}
+	if !updated {
+		t.Fatal("Expected rate limit to be updated")
+	}
+	// The version read above is now stale.
+	updated, err = s.adapter.UpdateRateLimit(ctx, stored)
+	if err != nil {
+		t.Fatalf("UpdateRateLimit failed: %v", err)
+	}
+	if updated {
+		t.Fatal("Expected stale update to be rejected")
+	}
+
+	if err := s.adapter.DeleteExpiredRateLimits(ctx, now+60_001); err != nil {
+		t.Fatalf("DeleteExpiredRateLimits failed: %v", err)
+	}
+	_, found, err = s.adapter.GetRateLimit(ctx, "test:bucket")
+	if err != nil {
+		t.Fatalf("GetRateLimit failed: %v", err)
+	}
+	if found {
+		t.Fatal("Expected expired rate limit to be deleted")
+	}
+}
+
+func (s *AdapterExercises) TestRelationTuples(t *testing.T) {
+	ctx := t.Context()
+
+	owner := ubdata.RelationTuple{ObjectType: "document", ObjectId: "77", Relation: "owner", SubjectType: "user", SubjectId: "5"}
+	team := ubdata.RelationTuple{ObjectType: "document", ObjectId: "77", Relation: "viewer", SubjectType: "team", SubjectId: "eng", SubjectRelation: "member"}
+	other := ubdata.RelationTuple{ObjectType: "document", ObjectId: "78", Relation: "viewer", SubjectType: "user", SubjectId: "5"}
+	for _, tuple := range []ubdata.RelationTuple{owner, team, other, owner} {
+		if err := s.adapter.AddRelationTuple(ctx, tuple); err != nil {
+			t.Fatalf("AddRelationTuple failed: %v", err)
+		}
+	}
+
+	tuples, err := s.adapter.ListRelationTuplesByObject(ctx, "document", "77")
+	if err != nil {
+		t.Fatalf("ListRelationTuplesByObject failed: %v", err)
+	}
+	if len(tuples) != 2 || tuples[0] != owner || tuples[1] != team {
+		t.Fatalf("Unexpected tuples for object: %+v", tuples)
+	}
+
+	tuples, err = s.adapter.ListRelationTuplesBySubject(ctx, "user", "5", "")
+	if err != nil {
+		t.Fatalf("ListRelationTuplesBySubject failed: %v", err)
+	}
+	if len(tuples) != 2 || tuples[0] != owner || tuples[1] != other {
+		t.Fatalf("Unexpected tuples for subject: %+v", tuples)
+	}
+	tuples, err = s.adapter.ListRelationTuplesBySubject(ctx, "team", "eng", "member")
+	if err != nil || len(tuples) != 1 || tuples[0] != team {
+		t.Fatalf("Unexpected tuples for userset: %+v %v", tuples, err)
+	}
+
+	for _, tuple := range []ubdata.RelationTuple{owner, team, other} {
+		if err := s.adapter.DeleteRelationTuple(ctx, tuple); err != nil {
+			t.Fatalf("DeleteRelationTuple failed: %v", err)
+		}
+	}
+	tuples, err = s.adapter.ListRelationTuplesByObject(ctx, "document", "77")
+	if err != nil || len(tuples) != 0 {
+		t.Fatalf("Expected no tuples after delete, got %+v %v", tuples, err)
+	}
+}
+
 func (s *AdapterExercises) TestAddOrganization(t *testing.T) {
 	ctx := t.Context()
 
@@ -356,10 +525,15 @@ func (s *AdapterExercises) TestAddUserToRole(t *testing.T) {
 	}
 
 	// Test adding user to role
-	err = s.adapter.AddUserToRole(ctx, userID, roleID)
+	grantedAt := time.Now().Unix()
+	err = s.adapter.AddUserToRole(ctx, userID, roleID, 0, 0, grantedAt, 7)
 	if err != nil {
 		t.Fatalf("AddUserToRole failed: %v", err)
 	}
+	membership, found, err := s.adapter.GetUserRole(ctx, userID, roleID)
+	if err != nil || !found || membership.GrantedAt != grantedAt || membership.AccessRequestID != 7 {
+		t.Fatalf("GetUserRole expected the membership granted at %d by access request 7, got %+v %v %v", grantedAt, membership, found, err)
+	}
 }
 
 func (s *AdapterExercises) TestRemoveUserFromRole(t *testing.T) {
@@ -368,7 +542,7 @@ func (s *AdapterExercises) TestRemoveUserFromRole(t *testing.T) {
 	roleID := int64(1)
 
 	// Setup - add user to role first
-	err := s.adapter.AddUserToRole(ctx, userID, roleID)
+	err := s.adapter.AddUserToRole(ctx, userID, roleID, 0, 0, time.Now().Unix(), 0)
 	if err != nil {
 		t.Fatalf("Setup: AddUserToRole failed: %v", err)
 	}
@@ -378,6 +552,10 @@ func (s *AdapterExercises) TestRemoveUserFromRole(t *testing.T) {
 	if err != nil {
 		t.Fatalf("RemoveUserFromRole failed: %v", err)
 	}
+	_, found, err := s.adapter.GetUserRole(ctx, userID, roleID)
+	if err != nil || found {
+		t.Fatalf("GetUserRole expected no membership after removal, got %v %v", found, err)
+	}
 }
 
 func (s *AdapterExercises) TestRemoveAllRolesFromUser(t *testing.T) {
@@ -387,11 +565,11 @@ func (s *AdapterExercises) TestRemoveAllRolesFromUser(t *testing.T) {
 	roleID2 := int64(2)
 
 	// Setup - add user to multiple roles
-	err := s.adapter.AddUserToRole(ctx, userID, roleID1)
+	err := s.adapter.AddUserToRole(ctx, userID, roleID1, 0, 0, time.Now().Unix(), 0)
 	if err != nil {
 		t.Fatalf("Setup: AddUserToRole 1 failed: %v", err)
 	}
-	err = s.adapter.AddUserToRole(ctx, userID, roleID2)
+	err = s.adapter.AddUserToRole(ctx, userID, roleID2, 0, 0, time.Now().Unix(), 0)
 	if err != nil {
 		t.Fatalf("Setup: AddUserToRole 2 failed: %v", err)
 	}
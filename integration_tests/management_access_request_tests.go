@@ -0,0 +1,258 @@
+package integration_tests
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func (s *ManagmentServiceTestSuite) AccessRequests(t *testing.T) {
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+
+	// An approver holds approve_access_requests through a role of the
+	// organization.
+	approverEmail := fmt.Sprintf("approver-%d@example.com", suffix)
+	approver, err := s.managementService.UserAdd(ctx, ubmanage.UserCreateCommand{
+		Email:       approverEmail,
+		Password:    "TestPassword123!",
+		FirstName:   "Access",
+		LastName:    "Approver",
+		DisplayName: "Access Approver",
+		Verified:    true,
+	}, "test-runner")
+	if err != nil || approver.Status != ubstatus.Success {
+		t.Fatalf("UserAdd failed: %v %v", err, approver.Status)
+	}
+	approverRole, err := s.managementService.RoleAdd(ctx, ubmanage.RoleCreateCommand{
+		OrganizationId: s.createdOrganizationId,
+		Name:           "Approvers",
+		SystemName:     fmt.Sprintf("approvers_%d", suffix),
+	}, "test-runner")
+	if err != nil || approverRole.Status != ubstatus.Success {
+		t.Fatalf("RoleAdd failed: %v %v", err, approverRole.Status)
+	}
+	permission, err := s.managementService.RolePermissionAdd(ctx, ubmanage.RolePermissionAddCommand{
+		Id:         approverRole.Data.Id,
+		Permission: ubmanage.PermApproveAccessRequests,
+	}, "test-runner")
+	if err != nil || permission.Status != ubstatus.Success {
+		t.Fatalf("RolePermissionAdd failed: %v %v", err, permission.Status)
+	}
+	addRole, err := s.managementService.UserAddToRole(ctx, ubmanage.UserAddToRoleCommand{
+		UserId: approver.Data.Id,
+		RoleId: approverRole.Data.Id,
+	}, "test-runner")
+	if err != nil || addRole.Status != ubstatus.Success {
+		t.Fatalf("UserAddToRole failed: %v %v", err, addRole.Status)
+	}
+
+	s.loginAlertMailer.Reset()
+	created, err := s.managementService.AccessRequestCreate(ctx, ubmanage.AccessRequestCreateCommand{
+		UserId:        s.createdUserId,
+		RoleId:        s.createdRoleId,
+		Justification: "Needed for the quarterly report",
+	}, "test-runner")
+	if err != nil || created.Status != ubstatus.Success {
+		t.Fatalf("AccessRequestCreate failed: %v %v %s", err, created.Status, created.Message)
+	}
+	jobs := s.loginAlertMailer.Jobs()
+	if len(jobs) != 1 || jobs[0].To != approverEmail {
+		t.Fatalf("expected the approver to be emailed, got %+v", jobs)
+	}
+
+	duplicate, err := s.managementService.AccessRequestCreate(ctx, ubmanage.AccessRequestCreateCommand{
+		UserId:        s.createdUserId,
+		RoleId:        s.createdRoleId,
+		Justification: "Again",
+	}, "test-runner")
+	if err != nil || duplicate.Status != ubstatus.AlreadyExists {
+		t.Fatalf("expected a second pending request to be rejected, got %v %v", err, duplicate.Status)
+	}
+
+	// Requesters cannot decide their own requests, nor can users without the
+	// permission.
+	own, err := s.managementService.AccessRequestApprove(ctx, ubmanage.AccessRequestApproveCommand{
+		Id:         created.Data.Id,
+		ApproverId: s.createdUserId,
+	}, "test-runner")
+	if err != nil || own.Status != ubstatus.NotAuthorized {
+		t.Fatalf("expected self approval to be rejected, got %v %v", err, own.Status)
+	}
+
+	s.loginAlertMailer.Reset()
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	approved, err := s.managementService.AccessRequestApprove(ctx, ubmanage.AccessRequestApproveCommand{
+		Id:         created.Data.Id,
+		ApproverId: approver.Data.Id,
+		ExpiresAt:  expiresAt,
+		Comment:    "For this quarter",
+	}, fmt.Sprintf("user:%d", approver.Data.Id))
+	if err != nil || approved.Status != ubstatus.Success {
+		t.Fatalf("AccessRequestApprove failed: %v %v %s", err, approved.Status, approved.Message)
+	}
+	roles, err := s.managementService.UserGetAllOrganizationRoles(ctx, s.createdUserId)
+	if err != nil || len(roles.Data) != 1 || roles.Data[0].RoleID != s.createdRoleId || roles.Data[0].ExpiresAt != expiresAt.Unix() ||
+		roles.Data[0].AccessRequestID != created.Data.Id {
+		t.Fatalf("expected the approval to add the role until %d under request %d, got %+v %v", expiresAt.Unix(), created.Data.Id, roles.Data, err)
+	}
+	request, err := s.managementService.AccessRequestGet(ctx, created.Data.Id)
+	if err != nil || request.Data.Status != ubmanage.AccessRequestApproved || request.Data.DecidedBy != approver.Data.Id || request.Data.DecidedByName != "Access Approver" {
+		t.Fatalf("unexpected approved request %+v %v", request.Data, err)
+	}
+	jobs = s.loginAlertMailer.Jobs()
+	if len(jobs) != 1 || jobs[0].To != request.Data.UserEmail {
+		t.Fatalf("expected the requester to be emailed the decision, got %+v", jobs)
+	}
+
+	again, err := s.managementService.AccessRequestDeny(ctx, ubmanage.AccessRequestDenyCommand{
+		Id:         created.Data.Id,
+		ApproverId: approver.Data.Id,
+	}, "test-runner")
+	if err != nil || again.Status != ubstatus.ValidationError {
+		t.Fatalf("expected a decided request to be rejected, got %v %v", err, again.Status)
+	}
+
+	// A denied request leaves the user's roles alone.
+	second, err := s.managementService.AccessRequestCreate(ctx, ubmanage.AccessRequestCreateCommand{
+		UserId:        s.createdUserId,
+		RoleId:        approverRole.Data.Id,
+		Justification: "I would like to approve requests",
+	}, "test-runner")
+	if err != nil || second.Status != ubstatus.Success {
+		t.Fatalf("AccessRequestCreate failed: %v %v", err, second.Status)
+	}
+	denied, err := s.managementService.AccessRequestDeny(ctx, ubmanage.AccessRequestDenyCommand{
+		Id:         second.Data.Id,
+		ApproverId: approver.Data.Id,
+		Comment:    "Not needed",
+	}, "test-runner")
+	if err != nil || denied.Status != ubstatus.Success {
+		t.Fatalf("AccessRequestDeny failed: %v %v", err, denied.Status)
+	}
+	roles, _ = s.managementService.UserGetAllOrganizationRoles(ctx, s.createdUserId)
+	if len(roles.Data) != 1 {
+		t.Fatalf("expected denial not to add a role, got %+v", roles.Data)
+	}
+
+	pending, err := s.managementService.AccessRequestListByOrganization(ctx, s.createdOrganizationId, ubmanage.AccessRequestPending)
+	if err != nil || len(pending.Data) != 0 {
+		t.Fatalf("expected no pending requests, got %+v %v", pending.Data, err)
+	}
+	mine, err := s.managementService.AccessRequestListByUser(ctx, s.createdUserId)
+	if err != nil || len(mine.Data) != 2 {
+		t.Fatalf("expected the user's two requests, got %+v %v", mine.Data, err)
+	}
+
+	// Restore the user's memberships for the following tests.
+	removed, err := s.managementService.UserRemoveFromRole(ctx, ubmanage.UserRemoveFromRoleCommand{
+		UserId: s.createdUserId,
+		RoleId: s.createdRoleId,
+	}, "test-runner")
+	if err != nil || removed.Status != ubstatus.Success {
+		t.Fatalf("UserRemoveFromRole failed: %v %v", err, removed.Status)
+	}
+}
+
+func (s *ManagmentServiceTestSuite) AccessRequestApproversHoldPermission(t *testing.T) {
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+
+	addApprover := func(name string) (int64, int64) {
+		user, err := s.managementService.UserAdd(ctx, ubmanage.UserCreateCommand{
+			Email:       fmt.Sprintf("%s-%d@example.com", name, suffix),
+			Password:    "TestPassword123!",
+			FirstName:   "Access",
+			LastName:    name,
+			DisplayName: "Access " + name,
+			Verified:    true,
+		}, "test-runner")
+		if err != nil || user.Status != ubstatus.Success {
+			t.Fatalf("UserAdd failed: %v %v", err, user.Status)
+		}
+		role, err := s.managementService.RoleAdd(ctx, ubmanage.RoleCreateCommand{
+			OrganizationId: s.createdOrganizationId,
+			Name:           "Approvers " + name,
+			SystemName:     fmt.Sprintf("approvers_%s_%d", name, suffix),
+		}, "test-runner")
+		if err != nil || role.Status != ubstatus.Success {
+			t.Fatalf("RoleAdd failed: %v %v", err, role.Status)
+		}
+		permission, err := s.managementService.RolePermissionAdd(ctx, ubmanage.RolePermissionAddCommand{
+			Id:         role.Data.Id,
+			Permission: ubmanage.PermApproveAccessRequests,
+		}, "test-runner")
+		if err != nil || permission.Status != ubstatus.Success {
+			t.Fatalf("RolePermissionAdd failed: %v %v", err, permission.Status)
+		}
+		added, err := s.managementService.UserAddToRole(ctx, ubmanage.UserAddToRoleCommand{
+			UserId: user.Data.Id,
+			RoleId: role.Data.Id,
+		}, "test-runner")
+		if err != nil || added.Status != ubstatus.Success {
+			t.Fatalf("UserAddToRole failed: %v %v", err, added.Status)
+		}
+		return user.Data.Id, role.Data.Id
+	}
+	setPolicy := func(roleId int64, policy string) {
+		res, err := s.managementService.RolePermissionPolicySet(ctx, ubmanage.RolePermissionPolicySetCommand{
+			Id:         roleId,
+			Permission: ubmanage.PermApproveAccessRequests,
+			Policy:     policy,
+		}, "test-runner")
+		if err != nil || res.Status != ubstatus.Success {
+			t.Fatalf("RolePermissionPolicySet failed: %v %v", err, res.Status)
+		}
+	}
+
+	// A disabled approver, and one whose grant is under a policy which
+	// denies every request.
+	disabledId, _ := addApprover("disabled")
+	disabled, err := s.managementService.UserDisable(ctx, ubmanage.UserDisableCommand{Id: disabledId}, "test-runner")
+	if err != nil || disabled.Status != ubstatus.Success {
+		t.Fatalf("UserDisable failed: %v %v", err, disabled.Status)
+	}
+	conditionalId, conditionalRoleId := addApprover("conditional")
+	setPolicy(conditionalRoleId, `time.hour < 0`)
+
+	s.loginAlertMailer.Reset()
+	created, err := s.managementService.AccessRequestCreate(ctx, ubmanage.AccessRequestCreateCommand{
+		UserId:        s.createdUserId,
+		RoleId:        s.createdRoleId,
+		Justification: "Needed for the audit",
+	}, "test-runner")
+	if err != nil || created.Status != ubstatus.Success {
+		t.Fatalf("AccessRequestCreate failed: %v %v %s", err, created.Status, created.Message)
+	}
+	for _, job := range s.loginAlertMailer.Jobs() {
+		if strings.HasPrefix(job.To, "disabled-") || strings.HasPrefix(job.To, "conditional-") {
+			t.Fatalf("expected %s not to be emailed", job.To)
+		}
+	}
+
+	for _, approverId := range []int64{disabledId, conditionalId} {
+		approved, err := s.managementService.AccessRequestApprove(ctx, ubmanage.AccessRequestApproveCommand{
+			Id:         created.Data.Id,
+			ApproverId: approverId,
+		}, "test-runner")
+		if err != nil || approved.Status != ubstatus.NotAuthorized {
+			t.Fatalf("expected approver %d to be rejected, got %v %v", approverId, err, approved.Status)
+		}
+	}
+
+	// Once the policy allows the request, the conditional approver may
+	// decide it.
+	setPolicy(conditionalRoleId, `time.hour >= 0`)
+	denied, err := s.managementService.AccessRequestDeny(ctx, ubmanage.AccessRequestDenyCommand{
+		Id:         created.Data.Id,
+		ApproverId: conditionalId,
+	}, "test-runner")
+	if err != nil || denied.Status != ubstatus.Success {
+		t.Fatalf("AccessRequestDeny failed: %v %v %s", err, denied.Status, denied.Message)
+	}
+}
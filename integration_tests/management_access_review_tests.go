@@ -0,0 +1,420 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	evercore "github.com/kernelplex/evercore/base"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func (s *ManagmentServiceTestSuite) AccessReviews(t *testing.T) {
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+
+	// A reviewer holds review_access through a role of the organization.
+	reviewerEmail := fmt.Sprintf("reviewer-%d@example.com", suffix)
+	reviewer, err := s.managementService.UserAdd(ctx, ubmanage.UserCreateCommand{
+		Email:       reviewerEmail,
+		Password:    "TestPassword123!",
+		FirstName:   "Access",
+		LastName:    "Reviewer",
+		DisplayName: "Access Reviewer",
+		Verified:    true,
+	}, "test-runner")
+	if err != nil || reviewer.Status != ubstatus.Success {
+		t.Fatalf("UserAdd failed: %v %v", err, reviewer.Status)
+	}
+	reviewerRole, err := s.managementService.RoleAdd(ctx, ubmanage.RoleCreateCommand{
+		OrganizationId: s.createdOrganizationId,
+		Name:           "Reviewers",
+		SystemName:     fmt.Sprintf("reviewers_%d", suffix),
+	}, "test-runner")
+	if err != nil || reviewerRole.Status != ubstatus.Success {
+		t.Fatalf("RoleAdd failed: %v %v", err, reviewerRole.Status)
+	}
+	permission, err := s.managementService.RolePermissionAdd(ctx, ubmanage.RolePermissionAddCommand{
+		Id:         reviewerRole.Data.Id,
+		Permission: ubmanage.PermReviewAccess,
+	}, "test-runner")
+	if err != nil || permission.Status != ubstatus.Success {
+		t.Fatalf("RolePermissionAdd failed: %v %v", err, permission.Status)
+	}
+	for _, membership := range []ubmanage.UserAddToRoleCommand{
+		{UserId: reviewer.Data.Id, RoleId: reviewerRole.Data.Id},
+		{UserId: s.createdUserId, RoleId: s.createdRoleId},
+	} {
+		added, err := s.managementService.UserAddToRole(ctx, membership, "test-runner")
+		if err != nil || added.Status != ubstatus.Success {
+			t.Fatalf("UserAddToRole failed: %v %v", err, added.Status)
+		}
+	}
+
+	started, err := s.managementService.AccessReviewStart(ctx, ubmanage.AccessReviewStartCommand{
+		OrganizationId: s.createdOrganizationId,
+		Name:           "Quarterly review",
+	}, "test-runner")
+	if err != nil || started.Status != ubstatus.Success {
+		t.Fatalf("AccessReviewStart failed: %v %v %s", err, started.Status, started.Message)
+	}
+	review, err := s.managementService.AccessReviewGet(ctx, started.Data.Id)
+	if err != nil || review.Status != ubstatus.Success {
+		t.Fatalf("AccessReviewGet failed: %v %v", err, review.Status)
+	}
+	state := review.Data.State
+	if state.Membership(s.createdUserId, s.createdRoleId) < 0 || state.Membership(reviewer.Data.Id, reviewerRole.Data.Id) < 0 {
+		t.Fatalf("expected the review to cover the organization's memberships, got %+v", state.Memberships)
+	}
+
+	// Reviewers cannot decide their own memberships, nor can users without
+	// the permission.
+	own, err := s.managementService.AccessReviewDecide(ctx, ubmanage.AccessReviewDecideCommand{
+		Id:         started.Data.Id,
+		UserId:     reviewer.Data.Id,
+		RoleId:     reviewerRole.Data.Id,
+		Decision:   ubmanage.AccessReviewKeep,
+		ReviewerId: reviewer.Data.Id,
+	}, "test-runner")
+	if err != nil || own.Status != ubstatus.NotAuthorized {
+		t.Fatalf("expected a self review to be rejected, got %v %v", err, own.Status)
+	}
+	unauthorized, err := s.managementService.AccessReviewDecide(ctx, ubmanage.AccessReviewDecideCommand{
+		Id:         started.Data.Id,
+		UserId:     reviewer.Data.Id,
+		RoleId:     reviewerRole.Data.Id,
+		Decision:   ubmanage.AccessReviewRevoke,
+		ReviewerId: s.createdUserId,
+	}, "test-runner")
+	if err != nil || unauthorized.Status != ubstatus.NotAuthorized {
+		t.Fatalf("expected a review without review_access to be rejected, got %v %v", err, unauthorized.Status)
+	}
+
+	revoke := ubmanage.AccessReviewDecideCommand{
+		Id:         started.Data.Id,
+		UserId:     s.createdUserId,
+		RoleId:     s.createdRoleId,
+		Decision:   ubmanage.AccessReviewRevoke,
+		ReviewerId: reviewer.Data.Id,
+		Comment:    "No longer needed",
+	}
+	decided, err := s.managementService.AccessReviewDecide(ctx, revoke, fmt.Sprintf("user:%d", reviewer.Data.Id))
+	if err != nil || decided.Status != ubstatus.Success {
+		t.Fatalf("AccessReviewDecide failed: %v %v %s", err, decided.Status, decided.Message)
+	}
+	again, err := s.managementService.AccessReviewDecide(ctx, revoke, "test-runner")
+	if err != nil || again.Status != ubstatus.ValidationError {
+		t.Fatalf("expected a decided membership to be rejected, got %v %v", err, again.Status)
+	}
+
+	// Revocations are applied when the review closes.
+	roles, _ := s.managementService.UserGetAllOrganizationRoles(ctx, s.createdUserId)
+	if len(roles.Data) != 1 {
+		t.Fatalf("expected the membership to remain until the review closes, got %+v", roles.Data)
+	}
+	closed, err := s.managementService.AccessReviewClose(ctx, ubmanage.AccessReviewCloseCommand{Id: started.Data.Id}, "test-runner")
+	if err != nil || closed.Status != ubstatus.Success || closed.Data != 1 {
+		t.Fatalf("AccessReviewClose failed: %v %v %d", err, closed.Status, closed.Data)
+	}
+	roles, _ = s.managementService.UserGetAllOrganizationRoles(ctx, s.createdUserId)
+	if len(roles.Data) != 0 {
+		t.Fatalf("expected the revoked membership to be removed, got %+v", roles.Data)
+	}
+	roles, _ = s.managementService.UserGetAllOrganizationRoles(ctx, reviewer.Data.Id)
+	if len(roles.Data) != 1 {
+		t.Fatalf("expected the undecided membership to be kept, got %+v", roles.Data)
+	}
+	reopened, err := s.managementService.AccessReviewClose(ctx, ubmanage.AccessReviewCloseCommand{Id: started.Data.Id}, "test-runner")
+	if err != nil || reopened.Status != ubstatus.ValidationError {
+		t.Fatalf("expected closing a closed review to be rejected, got %v %v", err, reopened.Status)
+	}
+
+	reviews, err := s.managementService.AccessReviewListByOrganization(ctx, s.createdOrganizationId)
+	if err != nil || len(reviews.Data) != 1 || reviews.Data[0].Status != ubmanage.AccessReviewClosed || reviews.Data[0].RevokedCount != 1 {
+		t.Fatalf("unexpected access review list %+v %v", reviews.Data, err)
+	}
+
+	for _, format := range []string{ubmanage.AccessReviewFormatCsv, ubmanage.AccessReviewFormatJson} {
+		export, err := s.managementService.AccessReviewExport(ctx, started.Data.Id, format)
+		if err != nil || export.Status != ubstatus.Success {
+			t.Fatalf("AccessReviewExport %s failed: %v %v", format, err, export.Status)
+		}
+		if !bytes.Contains(export.Data.Data, []byte(reviewerEmail)) || !bytes.Contains(export.Data.Data, []byte("No longer needed")) {
+			t.Fatalf("expected the %s report to record the decision, got %s", format, export.Data.Data)
+		}
+		verified, err := s.managementService.AccessReviewVerifyExport(ctx, export.Data.Data)
+		if err != nil || !verified.Data {
+			t.Fatalf("expected the %s report to verify: %v %v", format, err, verified.Status)
+		}
+		tampered := bytes.Replace(export.Data.Data, []byte("No longer needed"), []byte("Still needed"), 1)
+		verified, err = s.managementService.AccessReviewVerifyExport(ctx, tampered)
+		if err != nil || verified.Data {
+			t.Fatalf("expected the tampered %s report to fail verification: %v", format, err)
+		}
+	}
+}
+
+func (s *ManagmentServiceTestSuite) AccessReviewCloseRevokesDecidedGrants(t *testing.T) {
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+
+	addUser := func(name string) int64 {
+		user, err := s.managementService.UserAdd(ctx, ubmanage.UserCreateCommand{
+			Email:       fmt.Sprintf("%s-%d@example.com", name, suffix),
+			Password:    "TestPassword123!",
+			FirstName:   "Review",
+			LastName:    name,
+			DisplayName: "Review " + name,
+			Verified:    true,
+		}, "test-runner")
+		if err != nil || user.Status != ubstatus.Success {
+			t.Fatalf("UserAdd failed: %v %v", err, user.Status)
+		}
+		return user.Data.Id
+	}
+	addRole := func(name string, permission string) int64 {
+		role, err := s.managementService.RoleAdd(ctx, ubmanage.RoleCreateCommand{
+			OrganizationId: s.createdOrganizationId,
+			Name:           "Review " + name,
+			SystemName:     fmt.Sprintf("review_%s_%d", name, suffix),
+		}, "test-runner")
+		if err != nil || role.Status != ubstatus.Success {
+			t.Fatalf("RoleAdd failed: %v %v", err, role.Status)
+		}
+		if permission != "" {
+			added, err := s.managementService.RolePermissionAdd(ctx, ubmanage.RolePermissionAddCommand{
+				Id:         role.Data.Id,
+				Permission: permission,
+			}, "test-runner")
+			if err != nil || added.Status != ubstatus.Success {
+				t.Fatalf("RolePermissionAdd failed: %v %v", err, added.Status)
+			}
+		}
+		return role.Data.Id
+	}
+	addToRole := func(userId int64, roleId int64) {
+		added, err := s.managementService.UserAddToRole(ctx, ubmanage.UserAddToRoleCommand{UserId: userId, RoleId: roleId}, "test-runner")
+		if err != nil || added.Status != ubstatus.Success {
+			t.Fatalf("UserAddToRole failed: %v %v", err, added.Status)
+		}
+	}
+	removeFromRole := func(userId int64, roleId int64) {
+		removed, err := s.managementService.UserRemoveFromRole(ctx, ubmanage.UserRemoveFromRoleCommand{UserId: userId, RoleId: roleId}, "test-runner")
+		if err != nil || removed.Status != ubstatus.Success {
+			t.Fatalf("UserRemoveFromRole failed: %v %v", err, removed.Status)
+		}
+	}
+
+	reviewerRoleId := addRole("reviewers", ubmanage.PermReviewAccess)
+	reviewerId := addUser("reviewer")
+	disabledReviewerId := addUser("disabled-reviewer")
+	addToRole(reviewerId, reviewerRoleId)
+	addToRole(disabledReviewerId, reviewerRoleId)
+	disabled, err := s.managementService.UserDisable(ctx, ubmanage.UserDisableCommand{Id: disabledReviewerId}, "test-runner")
+	if err != nil || disabled.Status != ubstatus.Success {
+		t.Fatalf("UserDisable failed: %v %v", err, disabled.Status)
+	}
+
+	roleId := addRole("members", "")
+	kept, removed, regranted := addUser("kept"), addUser("removed"), addUser("regranted")
+	for _, userId := range []int64{kept, removed, regranted} {
+		addToRole(userId, roleId)
+	}
+
+	started, err := s.managementService.AccessReviewStart(ctx, ubmanage.AccessReviewStartCommand{
+		OrganizationId: s.createdOrganizationId,
+		Name:           "Review of later changes",
+	}, "test-runner")
+	if err != nil || started.Status != ubstatus.Success {
+		t.Fatalf("AccessReviewStart failed: %v %v %s", err, started.Status, started.Message)
+	}
+
+	// Disabled users hold no permissions, so cannot review.
+	refused, err := s.managementService.AccessReviewDecide(ctx, ubmanage.AccessReviewDecideCommand{
+		Id:         started.Data.Id,
+		UserId:     kept,
+		RoleId:     roleId,
+		Decision:   ubmanage.AccessReviewRevoke,
+		ReviewerId: disabledReviewerId,
+	}, "test-runner")
+	if err != nil || refused.Status != ubstatus.NotAuthorized {
+		t.Fatalf("expected a disabled reviewer to be rejected, got %v %v", err, refused.Status)
+	}
+	for _, userId := range []int64{kept, removed, regranted} {
+		decided, err := s.managementService.AccessReviewDecide(ctx, ubmanage.AccessReviewDecideCommand{
+			Id:         started.Data.Id,
+			UserId:     userId,
+			RoleId:     roleId,
+			Decision:   ubmanage.AccessReviewRevoke,
+			ReviewerId: reviewerId,
+		}, "test-runner")
+		if err != nil || decided.Status != ubstatus.Success {
+			t.Fatalf("AccessReviewDecide failed: %v %v %s", err, decided.Status, decided.Message)
+		}
+	}
+
+	// After the decisions, one membership is removed and another removed and
+	// granted again, within the second of the decisions.
+	removeFromRole(removed, roleId)
+	removeFromRole(regranted, roleId)
+	addToRole(regranted, roleId)
+
+	closed, err := s.managementService.AccessReviewClose(ctx, ubmanage.AccessReviewCloseCommand{Id: started.Data.Id}, "test-runner")
+	if err != nil || closed.Status != ubstatus.Success || closed.Data != 1 {
+		t.Fatalf("expected only the decided grant to be revoked, got %v %v %d", err, closed.Status, closed.Data)
+	}
+	for userId, expected := range map[int64]int{kept: 0, removed: 0, regranted: 1} {
+		roles, err := s.managementService.UserGetAllOrganizationRoles(ctx, userId)
+		if err != nil || len(roles.Data) != expected {
+			t.Fatalf("expected user %d to hold %d roles after the review, got %+v %v", userId, expected, roles.Data, err)
+		}
+	}
+}
+
+func (s *ManagmentServiceTestSuite) AccessReviewEraseReviewedUser(t *testing.T) {
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+
+	users := map[int64]ubmanage.UserCreateCommand{}
+	addUser := func(name string) int64 {
+		command := ubmanage.UserCreateCommand{
+			Email:       fmt.Sprintf("erased-%s-%d@example.com", name, suffix),
+			Password:    "TestPassword123!",
+			FirstName:   "Erased",
+			LastName:    name,
+			DisplayName: fmt.Sprintf("Erased %s %d", name, suffix),
+			Verified:    true,
+		}
+		user, err := s.managementService.UserAdd(ctx, command, "test-runner")
+		if err != nil || user.Status != ubstatus.Success {
+			t.Fatalf("UserAdd failed: %v %v", err, user.Status)
+		}
+		users[user.Data.Id] = command
+		return user.Data.Id
+	}
+	addRole := func(name string, permissions ...string) int64 {
+		role, err := s.managementService.RoleAdd(ctx, ubmanage.RoleCreateCommand{
+			OrganizationId: s.createdOrganizationId,
+			Name:           "Erased " + name,
+			SystemName:     fmt.Sprintf("erased_%s_%d", name, suffix),
+		}, "test-runner")
+		if err != nil || role.Status != ubstatus.Success {
+			t.Fatalf("RoleAdd failed: %v %v", err, role.Status)
+		}
+		for _, permission := range permissions {
+			added, err := s.managementService.RolePermissionAdd(ctx, ubmanage.RolePermissionAddCommand{
+				Id:         role.Data.Id,
+				Permission: permission,
+			}, "test-runner")
+			if err != nil || added.Status != ubstatus.Success {
+				t.Fatalf("RolePermissionAdd failed: %v %v", err, added.Status)
+			}
+		}
+		return role.Data.Id
+	}
+
+	reviewerRoleId := addRole("reviewers", ubmanage.PermReviewAccess)
+	roleId := addRole("members")
+	reviewerId, memberId := addUser("reviewer"), addUser("member")
+	for _, membership := range []ubmanage.UserAddToRoleCommand{
+		{UserId: reviewerId, RoleId: reviewerRoleId},
+		{UserId: memberId, RoleId: roleId},
+	} {
+		added, err := s.managementService.UserAddToRole(ctx, membership, "test-runner")
+		if err != nil || added.Status != ubstatus.Success {
+			t.Fatalf("UserAddToRole failed: %v %v", err, added.Status)
+		}
+	}
+
+	started, err := s.managementService.AccessReviewStart(ctx, ubmanage.AccessReviewStartCommand{
+		OrganizationId: s.createdOrganizationId,
+		Name:           "Review of erased users",
+	}, "test-runner")
+	if err != nil || started.Status != ubstatus.Success {
+		t.Fatalf("AccessReviewStart failed: %v %v %s", err, started.Status, started.Message)
+	}
+	decided, err := s.managementService.AccessReviewDecide(ctx, ubmanage.AccessReviewDecideCommand{
+		Id:         started.Data.Id,
+		UserId:     memberId,
+		RoleId:     roleId,
+		Decision:   ubmanage.AccessReviewKeep,
+		ReviewerId: reviewerId,
+	}, "test-runner")
+	if err != nil || decided.Status != ubstatus.Success {
+		t.Fatalf("AccessReviewDecide failed: %v %v %s", err, decided.Status, decided.Message)
+	}
+
+	// Names are resolved from the read model while the users exist.
+	review, err := s.managementService.AccessReviewGet(ctx, started.Data.Id)
+	if err != nil || review.Status != ubstatus.Success {
+		t.Fatalf("AccessReviewGet failed: %v %v", err, review.Status)
+	}
+	i := review.Data.State.Membership(memberId, roleId)
+	if i < 0 {
+		t.Fatalf("expected the membership to be under review, got %+v", review.Data.State.Memberships)
+	}
+	reviewed := review.Data.State.Memberships[i : i+1]
+	memberships, err := s.managementService.AccessReviewMemberships(ctx, s.createdOrganizationId, reviewed)
+	if err != nil || memberships.Status != ubstatus.Success || len(memberships.Data) != 1 {
+		t.Fatalf("AccessReviewMemberships failed: %v %v", err, memberships.Status)
+	}
+	if detail := memberships.Data[0]; detail.UserEmail != users[memberId].Email || detail.UserDisplayName != users[memberId].DisplayName ||
+		detail.RoleName != "Erased members" || detail.ReviewerEmail != users[reviewerId].Email {
+		t.Fatalf("unexpected membership details %+v", detail)
+	}
+
+	for userId := range users {
+		erased, err := s.managementService.UserErase(ctx, ubmanage.UserEraseCommand{Id: userId}, "test-runner")
+		if err != nil || erased.Status != ubstatus.Success {
+			t.Fatalf("UserErase failed: %v %v", err, erased.Status)
+		}
+	}
+
+	// The campaign's events hold no personal data of the erased users.
+	var stored *evercore.AggregateState
+	err = s.eventStore.WithReadonlyContext(ctx, func(etx evercore.EventStoreReadonlyContext) error {
+		stored, err = etx.LoadAggregateState((&ubmanage.AccessReviewAggregate{}).GetAggregateType(), started.Data.Id)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to load the access review events: %v", err)
+	}
+	if len(stored.Events) < 2 {
+		t.Fatalf("expected the started and decided events, got %d", len(stored.Events))
+	}
+	states := []string{}
+	for _, event := range stored.Events {
+		states = append(states, event.State)
+	}
+	if stored.Snapshot != nil {
+		states = append(states, stored.Snapshot.State)
+	}
+	for _, state := range states {
+		for _, user := range users {
+			if strings.Contains(state, user.Email) || strings.Contains(state, user.DisplayName) {
+				t.Fatalf("expected no personal data in the access review events, got %s", state)
+			}
+		}
+	}
+
+	memberships, err = s.managementService.AccessReviewMemberships(ctx, s.createdOrganizationId, reviewed)
+	if err != nil || memberships.Status != ubstatus.Success || len(memberships.Data) != 1 {
+		t.Fatalf("AccessReviewMemberships failed: %v %v", err, memberships.Status)
+	}
+	if detail := memberships.Data[0]; detail.UserDisplayName != ubmanage.AccessReviewErasedUser || detail.ReviewerEmail != ubmanage.AccessReviewErasedUser {
+		t.Fatalf("expected the erased users to be shown with a placeholder, got %+v", detail)
+	}
+	export, err := s.managementService.AccessReviewExport(ctx, started.Data.Id, ubmanage.AccessReviewFormatCsv)
+	if err != nil || export.Status != ubstatus.Success {
+		t.Fatalf("AccessReviewExport failed: %v %v", err, export.Status)
+	}
+	for _, user := range users {
+		if bytes.Contains(export.Data.Data, []byte(user.Email)) {
+			t.Fatalf("expected the report not to name erased users, got %s", export.Data.Data)
+		}
+	}
+}
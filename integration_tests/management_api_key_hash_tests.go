@@ -0,0 +1,139 @@
+package integration_tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubsecurity"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func (s *ManagmentServiceTestSuite) ApiKeyHashUpgrade(t *testing.T) {
+	ctx := context.Background()
+
+	hmacService := ubmanage.NewManagement(
+		s.eventStore,
+		s.dbadapter,
+		s.hashingService,
+		s.encryptionService,
+		s.twoFactorService,
+		ubmanage.WithApiKeyHasher(ubsecurity.HmacSha256HashGenerator{Pepper: []byte("integration-pepper")}),
+	)
+
+	// A key issued with the password hashing service.
+	legacy, err := s.managementService.UserGenerateApiKey(ctx, ubmanage.UserGenerateApiKeyCommand{
+		UserId:         s.createdUserId,
+		Name:           "Legacy Hash",
+		OrganizationId: s.createdOrganizationId,
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}, "test-runner")
+	if err != nil || legacy.Status != ubstatus.Success {
+		t.Fatalf("UserGenerateApiKey failed: %v %v", err, legacy.Status)
+	}
+	legacyId := legacy.Data[:ubmanage.ApiKeyIdLength]
+	stored, err := s.dbadapter.UserGetApiKey(ctx, legacyId)
+	if err != nil {
+		t.Fatalf("UserGetApiKey failed: %v", err)
+	}
+	if ubsecurity.IsHmacSha256Hash(stored.SecretHash) {
+		t.Fatalf("expected an argon2id hash, got %q", stored.SecretHash)
+	}
+
+	// The first lookup verifies the legacy hash and replaces it.
+	user, err := hmacService.UserGetByApiKey(ctx, legacy.Data)
+	if err != nil || user.Status != ubstatus.Success || user.Data.Id != s.createdUserId {
+		t.Fatalf("expected legacy key to be accepted, got %v %v", err, user.Status)
+	}
+	stored, err = s.dbadapter.UserGetApiKey(ctx, legacyId)
+	if err != nil {
+		t.Fatalf("UserGetApiKey failed: %v", err)
+	}
+	if !ubsecurity.IsHmacSha256Hash(stored.SecretHash) {
+		t.Fatalf("expected hash to be upgraded, got %q", stored.SecretHash)
+	}
+	upgradedHash := stored.SecretHash
+
+	// Later lookups use the upgraded hash.
+	user, err = hmacService.UserGetByApiKey(ctx, legacy.Data)
+	if err != nil || user.Status != ubstatus.Success {
+		t.Fatalf("expected upgraded key to be accepted, got %v %v", err, user.Status)
+	}
+	wrong := legacy.Data[:len(legacy.Data)-1] + "!"
+	if response, _ := hmacService.UserGetByApiKey(ctx, wrong); response.Status != ubstatus.NotAuthorized {
+		t.Fatalf("expected wrong secret to be refused, got %v", response.Status)
+	}
+
+	// New keys are hashed with HMAC straight away.
+	issued, err := hmacService.UserGenerateApiKey(ctx, ubmanage.UserGenerateApiKeyCommand{
+		UserId:         s.createdUserId,
+		Name:           "HMAC Hash",
+		OrganizationId: s.createdOrganizationId,
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}, "test-runner")
+	if err != nil || issued.Status != ubstatus.Success {
+		t.Fatalf("UserGenerateApiKey failed: %v %v", err, issued.Status)
+	}
+	stored, err = s.dbadapter.UserGetApiKey(ctx, issued.Data[:ubmanage.ApiKeyIdLength])
+	if err != nil {
+		t.Fatalf("UserGetApiKey failed: %v", err)
+	}
+	if !ubsecurity.IsHmacSha256Hash(stored.SecretHash) {
+		t.Fatalf("expected an hmac-sha256 hash, got %q", stored.SecretHash)
+	}
+	if response, err := hmacService.UserGetByApiKey(ctx, issued.Data); err != nil || response.Status != ubstatus.Success {
+		t.Fatalf("expected hmac key to be accepted, got %v %v", err, response.Status)
+	}
+
+	// The aggregate records the upgraded hash.
+	reloaded, err := hmacService.UserGetById(ctx, s.createdUserId)
+	if err != nil || reloaded.Status != ubstatus.Success {
+		t.Fatalf("UserGetById failed: %v %v", err, reloaded.Status)
+	}
+	for _, key := range reloaded.Data.State.ApiKeys {
+		if key.Id == legacyId && key.SecretHash != upgradedHash {
+			t.Fatalf("expected aggregate hash to be upgraded, got %q", key.SecretHash)
+		}
+	}
+
+	// Expired legacy keys are refused without being rehashed.
+	expiring, err := s.managementService.UserGenerateApiKey(ctx, ubmanage.UserGenerateApiKeyCommand{
+		UserId:         s.createdUserId,
+		Name:           "Expired Legacy Hash",
+		OrganizationId: s.createdOrganizationId,
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}, "test-runner")
+	if err != nil || expiring.Status != ubstatus.Success {
+		t.Fatalf("UserGenerateApiKey failed: %v %v", err, expiring.Status)
+	}
+	expiringId := expiring.Data[:ubmanage.ApiKeyIdLength]
+	replacement, err := s.managementService.UserRotateApiKey(ctx, ubmanage.UserRotateApiKeyCommand{
+		UserId:   s.createdUserId,
+		ApiKeyId: expiringId,
+	}, "test-runner")
+	if err != nil || replacement.Status != ubstatus.Success {
+		t.Fatalf("UserRotateApiKey failed: %v %v", err, replacement.Status)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if response, _ := hmacService.UserGetByApiKey(ctx, expiring.Data); response.Status != ubstatus.NotAuthorized {
+		t.Fatalf("expected expired key to be refused, got %v", response.Status)
+	}
+	stored, err = s.dbadapter.UserGetApiKey(ctx, expiringId)
+	if err != nil {
+		t.Fatalf("UserGetApiKey failed: %v", err)
+	}
+	if ubsecurity.IsHmacSha256Hash(stored.SecretHash) {
+		t.Fatalf("expected expired key not to be rehashed, got %q", stored.SecretHash)
+	}
+
+	for _, apiKey := range []string{legacy.Data, issued.Data, expiring.Data, replacement.Data} {
+		_, err := hmacService.UserDeleteApiKey(ctx, ubmanage.UserDeleteApiKeyCommand{
+			UserId: s.createdUserId,
+			ApiKey: apiKey,
+		}, "test-runner")
+		if err != nil {
+			t.Fatalf("UserDeleteApiKey failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package integration_tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubdata"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func (s *ManagmentServiceTestSuite) ApiKeyRotationAndAllowlist(t *testing.T) {
+	ctx := context.Background()
+
+	findKey := func(id string) ubdata.UserApiKeyNoHash {
+		keys, err := s.dbadapter.UserListApiKeys(ctx, s.createdUserId)
+		if err != nil {
+			t.Fatalf("UserListApiKeys failed: %v", err)
+		}
+		for _, key := range keys {
+			if key.Id == id {
+				return key
+			}
+		}
+		t.Fatalf("api key %s not found in %+v", id, keys)
+		return ubdata.UserApiKeyNoHash{}
+	}
+
+	invalid, err := s.managementService.UserGenerateApiKey(ctx, ubmanage.UserGenerateApiKeyCommand{
+		UserId:         s.createdUserId,
+		Name:           "Bad Allowlist",
+		OrganizationId: s.createdOrganizationId,
+		ExpiresAt:      time.Now().Add(time.Hour),
+		AllowedCidrs:   []string{"not-a-range"},
+	}, "test-runner")
+	if err != nil || invalid.Status != ubstatus.ValidationError {
+		t.Fatalf("expected invalid allowlist to be rejected, got %v %v", err, invalid.Status)
+	}
+
+	expiresAt := time.Now().Add(48 * time.Hour)
+	generated, err := s.managementService.UserGenerateApiKey(ctx, ubmanage.UserGenerateApiKeyCommand{
+		UserId:         s.createdUserId,
+		Name:           "Deploy",
+		OrganizationId: s.createdOrganizationId,
+		ExpiresAt:      expiresAt,
+		AllowedCidrs:   []string{"203.0.113.0/24", "198.51.100.7"},
+	}, "test-runner")
+	if err != nil || generated.Status != ubstatus.Success {
+		t.Fatalf("UserGenerateApiKey failed: %v %v", err, generated.Status)
+	}
+	oldKey := generated.Data
+	oldId := oldKey[:ubmanage.ApiKeyIdLength]
+
+	prefect := ubmanage.NewPrefectService(s.managementService, s.eventStore, 10, 10)
+	if err := prefect.Start(); err != nil {
+		t.Fatalf("prefect start failed: %v", err)
+	}
+	defer prefect.Stop()
+
+	// The allowlist is enforced and use is recorded from allowed addresses.
+	if _, err := prefect.ApiKeyToUser(ctx, oldKey, "192.0.2.1"); err == nil {
+		t.Fatalf("expected api key to be refused outside its allowlist")
+	}
+	if data, err := prefect.ApiKeyToUser(ctx, oldKey, "203.0.113.50"); err != nil || data.UserId != s.createdUserId {
+		t.Fatalf("expected api key to be accepted inside its allowlist, got %+v %v", data, err)
+	}
+	used := findKey(oldId)
+	if used.LastUsedAt.IsZero() || used.LastUsedIp != "203.0.113.50" {
+		t.Fatalf("expected last use to be recorded, got %+v", used)
+	}
+	if len(used.AllowedCidrs) != 2 || used.AllowedCidrs[0] != "198.51.100.7/32" {
+		t.Fatalf("expected normalized allowlist, got %v", used.AllowedCidrs)
+	}
+
+	// Use is only written once per interval.
+	if _, err := prefect.ApiKeyToUser(ctx, oldKey, "198.51.100.7"); err != nil {
+		t.Fatalf("ApiKeyToUser failed: %v", err)
+	}
+	if throttled := findKey(oldId); throttled.LastUsedIp != "203.0.113.50" {
+		t.Fatalf("expected last use to be throttled, got %+v", throttled)
+	}
+
+	// Rotation issues a replacement and keeps the old key for the grace period.
+	rotated, err := s.managementService.UserRotateApiKey(ctx, ubmanage.UserRotateApiKeyCommand{
+		UserId:      s.createdUserId,
+		ApiKeyId:    oldId,
+		GracePeriod: time.Hour,
+	}, "test-runner")
+	if err != nil || rotated.Status != ubstatus.Success {
+		t.Fatalf("UserRotateApiKey failed: %v %v %s", err, rotated.Status, rotated.Message)
+	}
+	newKey := rotated.Data
+	newId := newKey[:ubmanage.ApiKeyIdLength]
+
+	oldRow := findKey(oldId)
+	if oldRow.ReplacedBy != newId {
+		t.Fatalf("expected old key to be replaced by %s, got %+v", newId, oldRow)
+	}
+	if oldRow.ExpiresAt.After(time.Now().Add(time.Hour + time.Minute)) {
+		t.Fatalf("expected old key to expire after the grace period, got %v", oldRow.ExpiresAt)
+	}
+	newRow := findKey(newId)
+	if newRow.Name != "Deploy" || newRow.ExpiresAt.Unix() != expiresAt.Unix() || len(newRow.AllowedCidrs) != 2 {
+		t.Fatalf("expected replacement to keep the old key's settings, got %+v", newRow)
+	}
+
+	again, err := s.managementService.UserRotateApiKey(ctx, ubmanage.UserRotateApiKeyCommand{
+		UserId:   s.createdUserId,
+		ApiKeyId: oldId,
+	}, "test-runner")
+	if err != nil || again.Status != ubstatus.ValidationError {
+		t.Fatalf("expected rotating a rotated key to be rejected, got %v %v", err, again.Status)
+	}
+	missing, err := s.managementService.UserRotateApiKey(ctx, ubmanage.UserRotateApiKeyCommand{
+		UserId:   s.createdUserId,
+		ApiKeyId: "missing000",
+	}, "test-runner")
+	if err != nil || missing.Status != ubstatus.NotFound {
+		t.Fatalf("expected unknown key to be not found, got %v %v", err, missing.Status)
+	}
+
+	for _, key := range []string{oldKey, newKey} {
+		if _, err := prefect.ApiKeyToUser(ctx, key, "203.0.113.9"); err != nil {
+			t.Fatalf("expected key to work during the grace period: %v", err)
+		}
+	}
+
+	// Without a grace period the old key stops working right away.
+	immediate, err := s.managementService.UserRotateApiKey(ctx, ubmanage.UserRotateApiKeyCommand{
+		UserId:   s.createdUserId,
+		ApiKeyId: newId,
+	}, "test-runner")
+	if err != nil || immediate.Status != ubstatus.Success {
+		t.Fatalf("UserRotateApiKey failed: %v %v", err, immediate.Status)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	response, err := s.managementService.UserGetByApiKey(ctx, newKey)
+	if err != nil || response.Status != ubstatus.NotAuthorized {
+		t.Fatalf("expected rotated key without grace period to be refused, got %v %v", err, response.Status)
+	}
+}
@@ -0,0 +1,125 @@
+package integration_tests
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func (s *ManagmentServiceTestSuite) ApiKeyScopes(t *testing.T) {
+	ctx := context.Background()
+
+	role, err := s.managementService.RoleAdd(ctx, ubmanage.RoleCreateCommand{
+		OrganizationId: s.createdOrganizationId,
+		Name:           "Reporter",
+		SystemName:     fmt.Sprintf("scoped_reporter_%d", time.Now().UnixNano()),
+	}, "test-runner")
+	if err != nil || role.Status != ubstatus.Success {
+		t.Fatalf("RoleAdd failed: %v %v", err, role.Status)
+	}
+	for _, permission := range []string{"reports:read", "reports:export"} {
+		added, err := s.managementService.RolePermissionAdd(ctx, ubmanage.RolePermissionAddCommand{
+			Id:         role.Data.Id,
+			Permission: permission,
+		}, "test-runner")
+		if err != nil || added.Status != ubstatus.Success {
+			t.Fatalf("RolePermissionAdd failed: %v %v", err, added.Status)
+		}
+	}
+	addRole, err := s.managementService.UserAddToRole(ctx, ubmanage.UserAddToRoleCommand{
+		UserId: s.createdUserId,
+		RoleId: role.Data.Id,
+	}, "test-runner")
+	if err != nil || addRole.Status != ubstatus.Success {
+		t.Fatalf("UserAddToRole failed: %v %v", err, addRole.Status)
+	}
+
+	generate := func(name string, scopes ...string) (string, ubstatus.StatusCode) {
+		resp, err := s.managementService.UserGenerateApiKey(ctx, ubmanage.UserGenerateApiKeyCommand{
+			UserId:         s.createdUserId,
+			Name:           name,
+			OrganizationId: s.createdOrganizationId,
+			ExpiresAt:      time.Now().Add(time.Hour),
+			Scopes:         scopes,
+		}, "test-runner")
+		if err != nil {
+			t.Fatalf("UserGenerateApiKey failed: %v", err)
+		}
+		return resp.Data, resp.Status
+	}
+
+	// Scopes must be a subset of the user's permissions.
+	if _, status := generate("Billing", "billing:*"); status != ubstatus.ValidationError {
+		t.Fatalf("expected scope the user does not hold to be rejected, got %v", status)
+	}
+	if _, status := generate("Write", "reports:read", "reports:write"); status != ubstatus.ValidationError {
+		t.Fatalf("expected permission the user does not hold to be rejected, got %v", status)
+	}
+
+	readKey, status := generate("Read", "reports:read")
+	if status != ubstatus.Success {
+		t.Fatalf("expected scoped key to be generated, got %v", status)
+	}
+	wildcardKey, status := generate("Reports", "reports:*")
+	if status != ubstatus.Success {
+		t.Fatalf("expected wildcard key to be generated, got %v", status)
+	}
+
+	keys, err := s.dbadapter.UserListApiKeys(ctx, s.createdUserId)
+	if err != nil {
+		t.Fatalf("UserListApiKeys failed: %v", err)
+	}
+	found := false
+	for _, key := range keys {
+		if key.Name == "Read" {
+			found = slices.Equal(key.Scopes, []string{"reports:read"})
+		}
+	}
+	if !found {
+		t.Fatalf("expected stored scopes on the Read key, got %+v", keys)
+	}
+
+	prefect := ubmanage.NewPrefectService(s.managementService, s.eventStore, 10, 10)
+	if err := prefect.Start(); err != nil {
+		t.Fatalf("prefect start failed: %v", err)
+	}
+	defer prefect.Stop()
+
+	readData, err := prefect.ApiKeyToUser(ctx, readKey, "203.0.113.10")
+	if err != nil {
+		t.Fatalf("ApiKeyToUser failed: %v", err)
+	}
+	if !slices.Equal(readData.Scopes, []string{"reports:read"}) || !slices.Equal(readData.EffectiveScopes, []string{"reports:read"}) {
+		t.Fatalf("unexpected scopes for read key: %+v", readData)
+	}
+	wildcardData, err := prefect.ApiKeyToUser(ctx, wildcardKey, "203.0.113.10")
+	if err != nil {
+		t.Fatalf("ApiKeyToUser failed: %v", err)
+	}
+	if !slices.Equal(wildcardData.EffectiveScopes, []string{"reports:export", "reports:read"}) {
+		t.Fatalf("unexpected effective scopes for wildcard key: %+v", wildcardData)
+	}
+
+	checks := []struct {
+		key        string
+		orgId      int64
+		permission string
+		want       bool
+	}{
+		{readKey, s.createdOrganizationId, "reports:read", true},
+		{readKey, s.createdOrganizationId, "reports:export", false},
+		{wildcardKey, s.createdOrganizationId, "reports:export", true},
+		{readKey, s.createdOrganizationId + 1000, "reports:read", false},
+	}
+	for _, c := range checks {
+		allowed, err := prefect.ApiKeyHasPermission(ctx, c.key, "203.0.113.10", c.orgId, c.permission)
+		if err != nil || allowed != c.want {
+			t.Fatalf("ApiKeyHasPermission(%s, %d) = %v %v, want %v", c.permission, c.orgId, allowed, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package integration_tests
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func (s *ManagmentServiceTestSuite) ExclusiveRoles(t *testing.T) {
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+
+	roleIds := []int64{}
+	for _, name := range []string{"Payments initiator", "Payments approver"} {
+		role, err := s.managementService.RoleAdd(ctx, ubmanage.RoleCreateCommand{
+			OrganizationId: s.createdOrganizationId,
+			Name:           name,
+			SystemName:     fmt.Sprintf("%s_%d", strings.ReplaceAll(strings.ToLower(name), " ", "_"), suffix),
+		}, "test-runner")
+		if err != nil || role.Status != ubstatus.Success {
+			t.Fatalf("RoleAdd failed: %v %v", err, role.Status)
+		}
+		roleIds = append(roleIds, role.Data.Id)
+	}
+	initiator, approver := roleIds[0], roleIds[1]
+
+	invalid, err := s.managementService.OrganizationExclusiveRoleSetSave(ctx, ubmanage.OrganizationExclusiveRoleSetSaveCommand{
+		OrganizationId: s.createdOrganizationId,
+		Name:           "Payments",
+		RoleIds:        []int64{initiator, 999999},
+	}, "test-runner")
+	if err != nil || invalid.Status != ubstatus.ValidationError {
+		t.Fatalf("expected a role outside the organization to be rejected, got %v %v", err, invalid.Status)
+	}
+	saved, err := s.managementService.OrganizationExclusiveRoleSetSave(ctx, ubmanage.OrganizationExclusiveRoleSetSaveCommand{
+		OrganizationId: s.createdOrganizationId,
+		Name:           "Payments",
+		RoleIds:        roleIds,
+	}, "test-runner")
+	if err != nil || saved.Status != ubstatus.Success {
+		t.Fatalf("OrganizationExclusiveRoleSetSave failed: %v %v %v", err, saved.Status, saved.ValidationIssues)
+	}
+
+	added, err := s.managementService.UserAddToRole(ctx, ubmanage.UserAddToRoleCommand{UserId: s.createdUserId, RoleId: initiator}, "test-runner")
+	if err != nil || added.Status != ubstatus.Success {
+		t.Fatalf("UserAddToRole failed: %v %v", err, added.Status)
+	}
+	// Re-adding a held role is not a conflict.
+	added, err = s.managementService.UserAddToRole(ctx, ubmanage.UserAddToRoleCommand{UserId: s.createdUserId, RoleId: initiator}, "test-runner")
+	if err != nil || added.Status != ubstatus.Success {
+		t.Fatalf("expected re-adding a held role to succeed, got %v %v", err, added.Status)
+	}
+	blocked, err := s.managementService.UserAddToRole(ctx, ubmanage.UserAddToRoleCommand{UserId: s.createdUserId, RoleId: approver}, "test-runner")
+	if err != nil || blocked.Status != ubstatus.ValidationError || !strings.Contains(blocked.Message, "Payments initiator") || !strings.Contains(blocked.Message, "Payments approver") {
+		t.Fatalf("expected the exclusive role to be rejected, got %v %v %q", err, blocked.Status, blocked.Message)
+	}
+	roles, _ := s.managementService.UserGetOrganizationRoles(ctx, s.createdUserId, s.createdOrganizationId)
+	if len(roles.Data) != 1 {
+		t.Fatalf("expected the rejected role not to be added, got %+v", roles.Data)
+	}
+
+	violations, err := s.managementService.OrganizationExclusiveRoleViolations(ctx, s.createdOrganizationId)
+	if err != nil || violations.Status != ubstatus.Success || len(violations.Data) != 0 {
+		t.Fatalf("expected no violations, got %+v %v", violations.Data, err)
+	}
+
+	// Memberships predating a set are reported rather than removed.
+	removed, err := s.managementService.OrganizationExclusiveRoleSetRemove(ctx, ubmanage.OrganizationExclusiveRoleSetRemoveCommand{
+		OrganizationId: s.createdOrganizationId,
+		Name:           "Payments",
+	}, "test-runner")
+	if err != nil || removed.Status != ubstatus.Success {
+		t.Fatalf("OrganizationExclusiveRoleSetRemove failed: %v %v", err, removed.Status)
+	}
+	added, err = s.managementService.UserAddToRole(ctx, ubmanage.UserAddToRoleCommand{UserId: s.createdUserId, RoleId: approver}, "test-runner")
+	if err != nil || added.Status != ubstatus.Success {
+		t.Fatalf("expected the role to be added without the set, got %v %v", err, added.Status)
+	}
+	saved, err = s.managementService.OrganizationExclusiveRoleSetSave(ctx, ubmanage.OrganizationExclusiveRoleSetSaveCommand{
+		OrganizationId: s.createdOrganizationId,
+		Name:           "Payments",
+		RoleIds:        roleIds,
+	}, "test-runner")
+	if err != nil || saved.Status != ubstatus.Success {
+		t.Fatalf("OrganizationExclusiveRoleSetSave failed: %v %v", err, saved.Status)
+	}
+	violations, err = s.managementService.OrganizationExclusiveRoleViolations(ctx, s.createdOrganizationId)
+	if err != nil || len(violations.Data) != 1 || violations.Data[0].UserId != s.createdUserId || len(violations.Data[0].Roles) != 2 {
+		t.Fatalf("expected the user to be reported, got %+v %v", violations.Data, err)
+	}
+
+	// Restore the user's memberships and the organization for the following
+	// tests.
+	for _, roleId := range roleIds {
+		removedRole, err := s.managementService.UserRemoveFromRole(ctx, ubmanage.UserRemoveFromRoleCommand{UserId: s.createdUserId, RoleId: roleId}, "test-runner")
+		if err != nil || removedRole.Status != ubstatus.Success {
+			t.Fatalf("UserRemoveFromRole failed: %v %v", err, removedRole.Status)
+		}
+	}
+	removed, err = s.managementService.OrganizationExclusiveRoleSetRemove(ctx, ubmanage.OrganizationExclusiveRoleSetRemoveCommand{
+		OrganizationId: s.createdOrganizationId,
+		Name:           "Payments",
+	}, "test-runner")
+	if err != nil || removed.Status != ubstatus.Success {
+		t.Fatalf("OrganizationExclusiveRoleSetRemove failed: %v %v", err, removed.Status)
+	}
+}
@@ -0,0 +1,131 @@
+package integration_tests
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func (s *ManagmentServiceTestSuite) RelationTuples(t *testing.T) {
+	ctx := context.Background()
+	userId := strconv.FormatInt(s.createdUserId, 10)
+
+	owned := ubmanage.RelationTupleWriteCommand{ObjectType: "document", ObjectId: "101", Relation: "owner", SubjectType: ubmanage.RelationSubjectUser, SubjectId: userId}
+	shared := ubmanage.RelationTupleWriteCommand{ObjectType: "document", ObjectId: "102", Relation: "editor", SubjectType: "team", SubjectId: "eng", SubjectRelation: ubmanage.RelationMember}
+	membership := ubmanage.RelationTupleWriteCommand{ObjectType: "team", ObjectId: "eng", Relation: ubmanage.RelationMember, SubjectType: ubmanage.RelationSubjectUser, SubjectId: userId}
+	// Writing a tuple twice is a no-op.
+	for _, command := range []ubmanage.RelationTupleWriteCommand{owned, shared, membership, owned} {
+		response, err := s.managementService.RelationTupleWrite(ctx, command, "test-runner")
+		if err != nil || response.Status != ubstatus.Success {
+			t.Fatalf("RelationTupleWrite failed: %v %v", err, response.Status)
+		}
+	}
+	invalid := owned
+	invalid.Relation = "can-edit"
+	if response, err := s.managementService.RelationTupleWrite(ctx, invalid, "test-runner"); err != nil || response.Status != ubstatus.ValidationError {
+		t.Fatalf("expected invalid tuple to be rejected, got %v %v", err, response.Status)
+	}
+
+	tuples, err := s.managementService.RelationTuplesByObject(ctx, "document", "101")
+	if err != nil || len(tuples.Data) != 1 || ubmanage.FormatRelationTuple(tuples.Data[0]) != "document:101#owner@user:"+userId {
+		t.Fatalf("unexpected tuples for document 101: %+v %v", tuples.Data, err)
+	}
+
+	prefect := ubmanage.NewPrefectService(s.managementService, s.eventStore, 100, 100,
+		ubmanage.WithPrefectOptions(ubmanage.PrefectOptions{
+			RelationSchema: ubmanage.RelationSchema{
+				"document": {"editor": {"owner"}, "viewer": {"editor"}},
+			},
+		}))
+	if err := prefect.Start(); err != nil {
+		t.Fatalf("prefect start failed: %v", err)
+	}
+	defer prefect.Stop()
+	s.waitForRelationEvents(t, prefect)
+
+	checks := []struct {
+		objectId string
+		relation string
+		want     bool
+	}{
+		{"101", "owner", true},
+		{"101", "viewer", true},
+		{"102", "editor", true},
+		{"102", "viewer", true},
+		{"102", "owner", false},
+		{"103", "viewer", false},
+	}
+	for _, c := range checks {
+		if held, err := prefect.Check(ctx, s.createdUserId, "document", c.objectId, c.relation); err != nil || held != c.want {
+			t.Fatalf("Check document %s %s: expected %v, got %v %v", c.objectId, c.relation, c.want, held, err)
+		}
+	}
+	objects, err := prefect.ListObjects(ctx, s.createdUserId, "document", "viewer")
+	if err != nil || !slices.Equal(objects, []string{"101", "102"}) {
+		t.Fatalf("unexpected objects %v %v", objects, err)
+	}
+
+	// Deleting the membership is picked up from the event stream.
+	response, err := s.managementService.RelationTupleDelete(ctx, ubmanage.RelationTupleDeleteCommand(membership), "test-runner")
+	if err != nil || response.Status != ubstatus.Success {
+		t.Fatalf("RelationTupleDelete failed: %v %v", err, response.Status)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		held, err := prefect.Check(ctx, s.createdUserId, "document", "102", "viewer")
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		objects, err = prefect.ListObjects(ctx, s.createdUserId, "document", "viewer")
+		if err != nil {
+			t.Fatalf("ListObjects failed: %v", err)
+		}
+		if !held && slices.Equal(objects, []string{"101"}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the deleted membership to be invalidated, got %v %v", held, objects)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	response, err = s.managementService.RelationTupleDelete(ctx, ubmanage.RelationTupleDeleteCommand(membership), "test-runner")
+	if err != nil || response.Status != ubstatus.NotFound {
+		t.Fatalf("expected deleting a missing tuple to be not found, got %v %v", err, response.Status)
+	}
+	unknown := ubmanage.RelationTupleDeleteCommand(owned)
+	unknown.ObjectId = "999"
+	response, err = s.managementService.RelationTupleDelete(ctx, unknown, "test-runner")
+	if err != nil || response.Status != ubstatus.NotFound {
+		t.Fatalf("expected deleting from an unknown object to be not found, got %v %v", err, response.Status)
+	}
+}
+
+// waitForRelationEvents waits until prefect receives tuple events. Its
+// subscription starts from the end of the event store once it is running, so
+// tuples written straight after Start may otherwise be missed.
+func (s *ManagmentServiceTestSuite) waitForRelationEvents(t *testing.T, prefect ubmanage.PrefectService) {
+	ctx := context.Background()
+	userId := strconv.FormatInt(s.createdUserId, 10)
+	for attempt := range 5 {
+		probe := ubmanage.RelationTupleWriteCommand{ObjectType: "probe", ObjectId: strconv.Itoa(attempt), Relation: ubmanage.RelationMember, SubjectType: ubmanage.RelationSubjectUser, SubjectId: userId}
+		// Checking first caches the probe without its tuple.
+		if _, err := prefect.Check(ctx, s.createdUserId, probe.ObjectType, probe.ObjectId, probe.Relation); err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		if response, err := s.managementService.RelationTupleWrite(ctx, probe, "test-runner"); err != nil || response.Status != ubstatus.Success {
+			t.Fatalf("RelationTupleWrite failed: %v %v", err, response.Status)
+		}
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+			if held, err := prefect.Check(ctx, s.createdUserId, probe.ObjectType, probe.ObjectId, probe.Relation); err == nil && held {
+				return
+			}
+		}
+	}
+	t.Fatal("prefect did not receive relation tuple events")
+}
@@ -0,0 +1,146 @@
+package integration_tests
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func (s *ManagmentServiceTestSuite) RoleTemplates(t *testing.T) {
+	ctx := context.Background()
+	orgSystemName := fmt.Sprintf("templated_%d", time.Now().UnixNano())
+
+	// Without templates there is nothing to apply.
+	unconfigured, err := s.managementService.OrganizationAdd(ctx, ubmanage.OrganizationCreateCommand{
+		Name:               "Templated",
+		SystemName:         orgSystemName,
+		Status:             "active",
+		ApplyRoleTemplates: true,
+	}, "test-runner")
+	if err != nil || unconfigured.Status != ubstatus.ValidationError {
+		t.Fatalf("expected applying missing role templates to be rejected, got %v %v", err, unconfigured.Status)
+	}
+
+	v1 := ubmanage.NewManagement(s.eventStore, s.dbadapter, s.hashingService, s.encryptionService, s.twoFactorService,
+		ubmanage.WithRoleTemplates(
+			ubmanage.RoleTemplate{Name: "Admin", SystemName: "{org}_admin", Permissions: []string{"users.manage", "billing.manage"}},
+			ubmanage.RoleTemplate{Name: "Viewer", SystemName: "{org}_viewer", Permissions: []string{"reports.view"}},
+		))
+	org, err := v1.OrganizationAdd(ctx, ubmanage.OrganizationCreateCommand{
+		Name:               "Templated",
+		SystemName:         orgSystemName,
+		Status:             "active",
+		ApplyRoleTemplates: true,
+	}, "test-runner")
+	if err != nil || org.Status != ubstatus.Success {
+		t.Fatalf("OrganizationAdd failed: %v %v %v", err, org.Status, org.ValidationIssues)
+	}
+	orgId := org.Data.Id
+	roles, _ := v1.RoleList(ctx, orgId)
+	if len(roles.Data) != 2 {
+		t.Fatalf("expected the template roles to be created, got %+v", roles.Data)
+	}
+	admin, err := v1.RoleGetBySystemName(ctx, orgSystemName+"_admin")
+	if err != nil || admin.Status != ubstatus.Success || admin.Data.State.OrganizationId != orgId ||
+		!slices.Equal(admin.Data.State.Permissions, []string{"users.manage", "billing.manage"}) {
+		t.Fatalf("unexpected admin role %+v %v", admin.Data.State, err)
+	}
+
+	// A templated system name already taken by another organization's role is
+	// reported, and the organization is not created.
+	conflictSystemName := orgSystemName + "_conflict"
+	taken, err := s.managementService.RoleAdd(ctx, ubmanage.RoleCreateCommand{
+		OrganizationId: s.createdOrganizationId,
+		Name:           "Taken " + conflictSystemName,
+		SystemName:     conflictSystemName + "_viewer",
+	}, "test-runner")
+	if err != nil || taken.Status != ubstatus.Success {
+		t.Fatalf("RoleAdd failed: %v %v", err, taken.Status)
+	}
+	conflict, err := v1.OrganizationAdd(ctx, ubmanage.OrganizationCreateCommand{
+		Name:               "Templated Conflict",
+		SystemName:         conflictSystemName,
+		Status:             "active",
+		ApplyRoleTemplates: true,
+	}, "test-runner")
+	if err != nil || conflict.Status != ubstatus.ValidationError || len(conflict.ValidationIssues) != 1 ||
+		!strings.Contains(strings.Join(conflict.ValidationIssues[0].Error, " "), conflictSystemName+"_viewer") {
+		t.Fatalf("expected the conflicting role to be named, got %v %v %+v", err, conflict.Status, conflict.ValidationIssues)
+	}
+	if existing, _ := v1.OrganizationGetBySystemName(ctx, conflictSystemName); existing.Status == ubstatus.Success {
+		t.Fatalf("expected the organization not to be created, got %+v", existing.Data)
+	}
+
+	// Every organization gets the same template role names.
+	second, err := v1.OrganizationAdd(ctx, ubmanage.OrganizationCreateCommand{
+		Name:               "Templated Second",
+		SystemName:         orgSystemName + "_second",
+		Status:             "active",
+		ApplyRoleTemplates: true,
+	}, "test-runner")
+	if err != nil || second.Status != ubstatus.Success {
+		t.Fatalf("expected a second templated organization to be created, got %v %v %+v", err, second.Status, second.ValidationIssues)
+	}
+	if secondRoles, _ := v1.RoleList(ctx, second.Data.Id); len(secondRoles.Data) != 2 {
+		t.Fatalf("expected the template roles to be created, got %+v", secondRoles.Data)
+	}
+
+	sync := ubmanage.RoleTemplatesSyncCommand{OrganizationIds: []int64{orgId}, DryRun: true}
+	unchanged, err := v1.RoleTemplatesSync(ctx, sync, "test-runner")
+	if err != nil || unchanged.Status != ubstatus.Success || len(unchanged.Data) != 0 {
+		t.Fatalf("expected no changes for a new organization, got %v %v %+v", err, unchanged.Status, unchanged.Data)
+	}
+
+	v2 := ubmanage.NewManagement(s.eventStore, s.dbadapter, s.hashingService, s.encryptionService, s.twoFactorService,
+		ubmanage.WithRoleTemplates(
+			ubmanage.RoleTemplate{Name: "Administrator", SystemName: "{org}_admin", Permissions: []string{"users.manage", "roles.manage"}},
+			ubmanage.RoleTemplate{Name: "Viewer", SystemName: "{org}_viewer", Permissions: []string{"reports.view"}},
+			ubmanage.RoleTemplate{Name: "Auditor", SystemName: "{org}_auditor", Permissions: []string{"audit.view"}},
+		))
+	sync.Prune = true
+	preview, err := v2.RoleTemplatesSync(ctx, sync, "test-runner")
+	if err != nil || preview.Status != ubstatus.Success {
+		t.Fatalf("RoleTemplatesSync dry run failed: %v %v", err, preview.Status)
+	}
+	actions := []string{}
+	for _, change := range preview.Data {
+		actions = append(actions, change.Action+" "+change.Value)
+	}
+	want := []string{"rename Administrator", "grant roles.manage", "revoke billing.manage", "create Auditor", "grant audit.view"}
+	if !slices.Equal(actions, want) {
+		t.Fatalf("unexpected sync preview %q, want %q", actions, want)
+	}
+	if roles, _ := v2.RoleList(ctx, orgId); len(roles.Data) != 2 {
+		t.Fatalf("expected a dry run to change nothing, got %+v", roles.Data)
+	}
+
+	sync.DryRun = false
+	applied, err := v2.RoleTemplatesSync(ctx, sync, "test-runner")
+	if err != nil || applied.Status != ubstatus.Success || len(applied.Data) != len(want) {
+		t.Fatalf("RoleTemplatesSync failed: %v %v %+v", err, applied.Status, applied.Data)
+	}
+	admin, _ = v2.RoleGetBySystemName(ctx, orgSystemName+"_admin")
+	if admin.Data.State.Name != "Administrator" || !slices.Equal(admin.Data.State.Permissions, []string{"users.manage", "roles.manage"}) {
+		t.Fatalf("expected the admin role to match its template, got %+v", admin.Data.State)
+	}
+	auditor, err := v2.RoleGetBySystemName(ctx, orgSystemName+"_auditor")
+	if err != nil || auditor.Status != ubstatus.Success || auditor.Data.Id != applied.Data[3].RoleId {
+		t.Fatalf("expected the auditor role to be created, got %v %v", err, auditor.Status)
+	}
+
+	// Roles deleted from an organization are not recreated.
+	deleted, err := v2.RoleDelete(ctx, ubmanage.RoleDeleteCommand{Id: auditor.Data.Id}, "test-runner")
+	if err != nil || deleted.Status != ubstatus.Success {
+		t.Fatalf("RoleDelete failed: %v %v", err, deleted.Status)
+	}
+	unchanged, err = v2.RoleTemplatesSync(ctx, sync, "test-runner")
+	if err != nil || unchanged.Status != ubstatus.Success || len(unchanged.Data) != 0 {
+		t.Fatalf("expected no changes after syncing, got %v %v %+v", err, unchanged.Status, unchanged.Data)
+	}
+}
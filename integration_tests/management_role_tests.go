@@ -93,6 +93,49 @@ func (s *ManagmentServiceTestSuite) AddPermissionToRole(t *testing.T) {
 	}
 }
 
+func (s *ManagmentServiceTestSuite) SetRolePermissionPolicy(t *testing.T) {
+	ctx := context.Background()
+	policy := `time.hour >= 9 && time.hour < 17`
+
+	// Policies can only be set on permissions the role grants, and must compile.
+	invalid := []ubmanage.RolePermissionPolicySetCommand{
+		{Id: s.createdRoleId, Permission: "test.not_granted", Policy: policy},
+		{Id: s.createdRoleId, Permission: "test.permission", Policy: "time.hour >="},
+	}
+	for _, command := range invalid {
+		res, err := s.managementService.RolePermissionPolicySet(ctx, command, "test-runner")
+		if err != nil || res.Status != ubstatus.ValidationError {
+			t.Fatalf("SetRolePermissionPolicy expected validation error for %+v, got %v %v", command, err, res.Status)
+		}
+	}
+
+	res, err := s.managementService.RolePermissionPolicySet(ctx, ubmanage.RolePermissionPolicySetCommand{
+		Id:         s.createdRoleId,
+		Permission: "test.permission",
+		Policy:     policy,
+	}, "test-runner")
+	if err != nil || res.Status != ubstatus.Success {
+		t.Fatalf("SetRolePermissionPolicy failed to set policy: %v %v", err, res.Status)
+	}
+	response, err := s.managementService.RoleGetById(ctx, s.createdRoleId)
+	if err != nil || response.Data.State.Policies["test.permission"] != policy {
+		t.Fatalf("SetRolePermissionPolicy policy not stored: %v %v", response.Data.State.Policies, err)
+	}
+
+	// An empty policy makes the permission unconditional again.
+	res, err = s.managementService.RolePermissionPolicySet(ctx, ubmanage.RolePermissionPolicySetCommand{
+		Id:         s.createdRoleId,
+		Permission: "test.permission",
+	}, "test-runner")
+	if err != nil || res.Status != ubstatus.Success {
+		t.Fatalf("SetRolePermissionPolicy failed to clear policy: %v %v", err, res.Status)
+	}
+	response, err = s.managementService.RoleGetById(ctx, s.createdRoleId)
+	if err != nil || len(response.Data.State.Policies) != 0 {
+		t.Fatalf("SetRolePermissionPolicy policy not cleared: %v %v", response.Data.State.Policies, err)
+	}
+}
+
 func (s *ManagmentServiceTestSuite) RemovePermissionFromRole(t *testing.T) {
 	// First ensure test role exists with a permission
 	permission := "test.permission_to_remove"
@@ -139,6 +182,137 @@ func (s *ManagmentServiceTestSuite) RemovePermissionFromRole(t *testing.T) {
 	}
 }
 
+func (s *ManagmentServiceTestSuite) PermissionCatalog(t *testing.T) {
+	ctx := context.Background()
+	catalog := ubmanage.NewPermissionCatalog(
+		ubmanage.PermissionDefinition{Name: "test.declared", Group: "Test"},
+		ubmanage.PermissionDefinition{Name: "test.unused", Group: "Test"},
+	)
+	service := ubmanage.NewManagement(s.eventStore, s.dbadapter, s.hashingService, s.encryptionService, s.twoFactorService,
+		ubmanage.WithPermissionCatalog(catalog))
+
+	res, err := service.RolePermissionAdd(ctx, ubmanage.RolePermissionAddCommand{Id: s.createdRoleId, Permission: "test.undeclared"}, "test-runner")
+	if err != nil || res.Status != ubstatus.ValidationError {
+		t.Fatalf("PermissionCatalog expected undeclared permission to be rejected, got %v %v", err, res.Status)
+	}
+	res, err = service.RolePermissionAdd(ctx, ubmanage.RolePermissionAddCommand{Id: s.createdRoleId, Permission: "test.declared"}, "test-runner")
+	if err != nil || res.Status != ubstatus.Success {
+		t.Fatalf("PermissionCatalog failed to add declared permission: %v %v", err, res.Status)
+	}
+
+	report, err := service.PermissionReport(ctx)
+	if err != nil || report.Status != ubstatus.Success {
+		t.Fatalf("PermissionReport failed: %v %v", err, report.Status)
+	}
+	// The role's test.permission was granted before it was declared.
+	undeclared := slices.ContainsFunc(report.Data.Unknown, func(held ubmanage.HeldPermission) bool {
+		return held.RoleId == s.createdRoleId && held.Permission == "test.permission"
+	})
+	if !undeclared || slices.ContainsFunc(report.Data.Unknown, func(held ubmanage.HeldPermission) bool {
+		return held.Permission == "test.declared"
+	}) {
+		t.Fatalf("PermissionReport unexpected undeclared permissions: %+v", report.Data.Unknown)
+	}
+	if len(report.Data.Unused) != 1 || report.Data.Unused[0].Name != "test.unused" {
+		t.Fatalf("PermissionReport unexpected unused permissions: %+v", report.Data.Unused)
+	}
+
+	// Without declared permissions there is nothing to report against.
+	if report, err := s.managementService.PermissionReport(ctx); err != nil || report.Status != ubstatus.ValidationError {
+		t.Fatalf("PermissionReport expected validation error without a catalog, got %v %v", err, report.Status)
+	}
+
+	res, err = service.RolePermissionRemove(ctx, ubmanage.RolePermissionRemoveCommand{Id: s.createdRoleId, Permission: "test.declared"}, "test-runner")
+	if err != nil || res.Status != ubstatus.Success {
+		t.Fatalf("PermissionCatalog failed to remove permission: %v %v", err, res.Status)
+	}
+}
+
+func (s *ManagmentServiceTestSuite) ApplyRolePermissions(t *testing.T) {
+	ctx := context.Background()
+	org, err := s.managementService.OrganizationAdd(ctx, ubmanage.OrganizationCreateCommand{
+		Name:       "Matrix Organization",
+		SystemName: "matrix_org",
+		Status:     "active",
+	}, "test-runner")
+	if err != nil || org.Status != ubstatus.Success {
+		t.Fatalf("ApplyRolePermissions failed to add organization: %v %v", err, org.Status)
+	}
+	var roleIds []int64
+	for _, name := range []string{"matrix_a", "matrix_b"} {
+		role, err := s.managementService.RoleAdd(ctx, ubmanage.RoleCreateCommand{
+			OrganizationId: org.Data.Id,
+			Name:           name,
+			SystemName:     name,
+		}, "test-runner")
+		if err != nil || role.Status != ubstatus.Success {
+			t.Fatalf("ApplyRolePermissions failed to add role: %v %v", err, role.Status)
+		}
+		roleIds = append(roleIds, role.Data.Id)
+	}
+	a, b := roleIds[0], roleIds[1]
+
+	apply := func(changes ...ubmanage.RolePermissionChange) ubstatus.StatusCode {
+		t.Helper()
+		res, err := s.managementService.RolePermissionsApply(ctx, ubmanage.RolePermissionsApplyCommand{
+			OrganizationId: org.Data.Id,
+			Changes:        changes,
+		}, "test-runner")
+		if err != nil {
+			t.Fatalf("RolePermissionsApply failed: %v", err)
+		}
+		return res.Status
+	}
+	expect := func(roleId int64, want ...string) {
+		t.Helper()
+		role, err := s.managementService.RoleGetById(ctx, roleId)
+		if err != nil {
+			t.Fatalf("RoleGetById failed: %v", err)
+		}
+		permissions, err := s.dbadapter.GetRolePermissions(ctx, roleId)
+		if err != nil {
+			t.Fatalf("GetRolePermissions failed: %v", err)
+		}
+		slices.Sort(permissions)
+		if !slices.Equal(role.Data.State.Permissions, want) || !slices.Equal(permissions, want) {
+			t.Fatalf("role %d expected %v, got %v in aggregate and %v in database", roleId, want, role.Data.State.Permissions, permissions)
+		}
+	}
+
+	status := apply(
+		ubmanage.RolePermissionChange{RoleId: a, Permission: "matrix.read", Grant: true},
+		ubmanage.RolePermissionChange{RoleId: a, Permission: "matrix.write", Grant: true},
+		ubmanage.RolePermissionChange{RoleId: b, Permission: "matrix.read", Grant: true},
+		// Revoking a permission the role doesn't hold is skipped.
+		ubmanage.RolePermissionChange{RoleId: b, Permission: "matrix.write", Grant: false},
+	)
+	if status != ubstatus.Success {
+		t.Fatalf("ApplyRolePermissions expected success, got %v", status)
+	}
+	expect(a, "matrix.read", "matrix.write")
+	expect(b, "matrix.read")
+
+	status = apply(
+		ubmanage.RolePermissionChange{RoleId: a, Permission: "matrix.write", Grant: false},
+		ubmanage.RolePermissionChange{RoleId: b, Permission: "matrix.write", Grant: true},
+	)
+	if status != ubstatus.Success {
+		t.Fatalf("ApplyRolePermissions expected success, got %v", status)
+	}
+	expect(a, "matrix.read")
+	expect(b, "matrix.read", "matrix.write")
+
+	// Nothing is applied when a role belongs to another organization.
+	status = apply(
+		ubmanage.RolePermissionChange{RoleId: a, Permission: "matrix.admin", Grant: true},
+		ubmanage.RolePermissionChange{RoleId: s.createdRoleId, Permission: "matrix.admin", Grant: true},
+	)
+	if status != ubstatus.ValidationError {
+		t.Fatalf("ApplyRolePermissions expected validation error, got %v", status)
+	}
+	expect(a, "matrix.read")
+}
+
 func (s *ManagmentServiceTestSuite) UpdateRole(t *testing.T) {
 	res, err := s.managementService.RoleUpdate(context.Background(), ubmanage.RoleUpdateCommand{
 		Id:         s.createdRoleId,
@@ -0,0 +1,185 @@
+package integration_tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func (s *ManagmentServiceTestSuite) ServiceAccounts(t *testing.T) {
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+
+	usersBefore, err := s.managementService.UsersCount(ctx)
+	if err != nil {
+		t.Fatalf("UsersCount failed: %v", err)
+	}
+
+	addResponse, err := s.managementService.ServiceAccountAdd(ctx, ubmanage.ServiceAccountCreateCommand{
+		OrganizationId: s.createdOrganizationId,
+		Name:           "Nightly Export",
+		Description:    "Exports reports every night",
+	}, "test-runner")
+	if err != nil || addResponse.Status != ubstatus.Success {
+		t.Fatalf("ServiceAccountAdd failed: %v %v %s", err, addResponse.Status, addResponse.Message)
+	}
+	accountId := addResponse.Data.Id
+
+	duplicate, err := s.managementService.ServiceAccountAdd(ctx, ubmanage.ServiceAccountCreateCommand{
+		OrganizationId: s.createdOrganizationId,
+		Name:           "nightly export",
+	}, "test-runner")
+	if err != nil || duplicate.Status != ubstatus.AlreadyExists {
+		t.Fatalf("expected duplicate name to be rejected, got %v %v", err, duplicate.Status)
+	}
+
+	missingOrg, err := s.managementService.ServiceAccountAdd(ctx, ubmanage.ServiceAccountCreateCommand{
+		OrganizationId: 999999,
+		Name:           "Orphan",
+	}, "test-runner")
+	if err != nil || missingOrg.Status != ubstatus.NotFound {
+		t.Fatalf("expected unknown organization to be rejected, got %v %v", err, missingOrg.Status)
+	}
+
+	// Service accounts are listed on their own and kept out of users.
+	usersAfter, err := s.managementService.UsersCount(ctx)
+	if err != nil {
+		t.Fatalf("UsersCount failed: %v", err)
+	}
+	if usersAfter.Data != usersBefore.Data {
+		t.Fatalf("expected users count to stay %d, got %d", usersBefore.Data, usersAfter.Data)
+	}
+	users, err := s.dbadapter.SearchUsers(ctx, "Nightly", 10, 0)
+	if err != nil {
+		t.Fatalf("SearchUsers failed: %v", err)
+	}
+	if len(users) != 0 {
+		t.Fatalf("expected service account to be excluded from user search, got %+v", users)
+	}
+	list, err := s.managementService.ServiceAccountList(ctx, s.createdOrganizationId)
+	if err != nil || list.Status != ubstatus.Success {
+		t.Fatalf("ServiceAccountList failed: %v %v", err, list.Status)
+	}
+	if len(list.Data) != 1 || list.Data[0].UserID != accountId || list.Data[0].Name != "Nightly Export" {
+		t.Fatalf("unexpected service accounts: %+v", list.Data)
+	}
+
+	account, err := s.managementService.UserGetById(ctx, accountId)
+	if err != nil || account.Status != ubstatus.Success {
+		t.Fatalf("UserGetById failed: %v %v", err, account.Status)
+	}
+	if !account.Data.State.ServiceAccount || account.Data.State.OwnerOrganizationId != s.createdOrganizationId {
+		t.Fatalf("unexpected service account state: %+v", account.Data.State)
+	}
+
+	// There is no way to sign in as a service account.
+	key := fmt.Sprintf("service-account:%d:nightly export", s.createdOrganizationId)
+	login, err := s.managementService.UserAuthenticate(ctx, ubmanage.UserLoginCommand{
+		Email:    key,
+		Password: "",
+	}, "test-runner")
+	if err != nil || login.Status != ubstatus.NotAuthorized {
+		t.Fatalf("expected service account login to be refused, got %v %v", err, login.Status)
+	}
+	impersonate, err := s.managementService.UserStartImpersonation(ctx, ubmanage.UserStartImpersonationCommand{
+		ImpersonatorId: s.createdUserId,
+		OrganizationId: s.createdOrganizationId,
+		TargetId:       accountId,
+	}, "test-runner")
+	if err != nil || impersonate.Status != ubstatus.NotAuthorized {
+		t.Fatalf("expected service account impersonation to be refused, got %v %v", err, impersonate.Status)
+	}
+
+	// Roles and API keys are limited to the owning organization.
+	otherOrg, err := s.managementService.OrganizationAdd(ctx, ubmanage.OrganizationCreateCommand{
+		Name:       "Service Account Other",
+		SystemName: fmt.Sprintf("sa_other_%d", suffix),
+		Status:     "active",
+	}, "test-runner")
+	if err != nil || otherOrg.Status != ubstatus.Success {
+		t.Fatalf("OrganizationAdd failed: %v %v", err, otherOrg.Status)
+	}
+	otherRole, err := s.managementService.RoleAdd(ctx, ubmanage.RoleCreateCommand{
+		OrganizationId: otherOrg.Data.Id,
+		Name:           "Other",
+		SystemName:     fmt.Sprintf("sa_other_role_%d", suffix),
+	}, "test-runner")
+	if err != nil || otherRole.Status != ubstatus.Success {
+		t.Fatalf("RoleAdd failed: %v %v", err, otherRole.Status)
+	}
+	crossRole, err := s.managementService.UserAddToRole(ctx, ubmanage.UserAddToRoleCommand{
+		UserId: accountId,
+		RoleId: otherRole.Data.Id,
+	}, "test-runner")
+	if err != nil || crossRole.Status != ubstatus.ValidationError {
+		t.Fatalf("expected role in another organization to be rejected, got %v %v", err, crossRole.Status)
+	}
+
+	role, err := s.managementService.RoleAdd(ctx, ubmanage.RoleCreateCommand{
+		OrganizationId: s.createdOrganizationId,
+		Name:           "Exporter",
+		SystemName:     fmt.Sprintf("sa_exporter_%d", suffix),
+	}, "test-runner")
+	if err != nil || role.Status != ubstatus.Success {
+		t.Fatalf("RoleAdd failed: %v %v", err, role.Status)
+	}
+	permission, err := s.managementService.RolePermissionAdd(ctx, ubmanage.RolePermissionAddCommand{
+		Id:         role.Data.Id,
+		Permission: "reports.export",
+	}, "test-runner")
+	if err != nil || permission.Status != ubstatus.Success {
+		t.Fatalf("RolePermissionAdd failed: %v %v", err, permission.Status)
+	}
+	addRole, err := s.managementService.UserAddToRole(ctx, ubmanage.UserAddToRoleCommand{
+		UserId: accountId,
+		RoleId: role.Data.Id,
+	}, "test-runner")
+	if err != nil || addRole.Status != ubstatus.Success {
+		t.Fatalf("UserAddToRole failed: %v %v", err, addRole.Status)
+	}
+
+	crossKey, err := s.managementService.UserGenerateApiKey(ctx, ubmanage.UserGenerateApiKeyCommand{
+		UserId:         accountId,
+		Name:           "Cross",
+		OrganizationId: otherOrg.Data.Id,
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}, "test-runner")
+	if err != nil || crossKey.Status != ubstatus.ValidationError {
+		t.Fatalf("expected API key for another organization to be rejected, got %v %v", err, crossKey.Status)
+	}
+	apiKey, err := s.managementService.UserGenerateApiKey(ctx, ubmanage.UserGenerateApiKeyCommand{
+		UserId:         accountId,
+		Name:           "Export",
+		OrganizationId: s.createdOrganizationId,
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}, "test-runner")
+	if err != nil || apiKey.Status != ubstatus.Success {
+		t.Fatalf("UserGenerateApiKey failed: %v %v", err, apiKey.Status)
+	}
+
+	prefect := ubmanage.NewPrefectService(s.managementService, s.eventStore, 10, 10)
+	if err := prefect.Start(); err != nil {
+		t.Fatalf("prefect start failed: %v", err)
+	}
+	defer prefect.Stop()
+
+	keyData, err := prefect.ApiKeyToUser(ctx, apiKey.Data, "203.0.113.10")
+	if err != nil {
+		t.Fatalf("ApiKeyToUser failed: %v", err)
+	}
+	if keyData.UserId != accountId || !keyData.ServiceAccount || keyData.OrganizationId != s.createdOrganizationId {
+		t.Fatalf("unexpected api key data: %+v", keyData)
+	}
+	allowed, err := prefect.UserHasPermission(ctx, accountId, s.createdOrganizationId, "reports.export")
+	if err != nil || !allowed {
+		t.Fatalf("expected service account to have permission, got %v %v", allowed, err)
+	}
+	allowed, err = prefect.UserHasPermission(ctx, accountId, otherOrg.Data.Id, "reports.export")
+	if err != nil || allowed {
+		t.Fatalf("expected no permission outside the owning organization, got %v %v", allowed, err)
+	}
+}
@@ -3,7 +3,9 @@ package integration_tests
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/kernelplex/ubase/lib/ubdata"
 	"github.com/kernelplex/ubase/lib/ubmanage"
 	"github.com/kernelplex/ubase/lib/ubstatus"
 )
@@ -45,6 +47,119 @@ func (s *ManagmentServiceTestSuite) AddUserToRole(t *testing.T) {
 
 }
 
+func (s *ManagmentServiceTestSuite) ExplainUserPermissions(t *testing.T) {
+	ctx := context.Background()
+	prefect := ubmanage.NewPrefectService(s.managementService, s.eventStore, 100, 100)
+	if err := prefect.Start(); err != nil {
+		t.Fatalf("prefect start failed: %v", err)
+	}
+	defer prefect.Stop()
+
+	explanation, err := prefect.ExplainPermissions(ctx, s.createdUserId, s.createdOrganizationId, "")
+	if err != nil {
+		t.Fatalf("ExplainPermissions failed: %v", err)
+	}
+	want := ubmanage.PermissionGrant{
+		Permission: "test.permission",
+		RoleId:     s.createdRoleId,
+		RoleName:   updatedRole.Name,
+		Source:     ubmanage.PermissionSourceDirect,
+	}
+	if len(explanation.Grants) != 1 || explanation.Grants[0] != want {
+		t.Fatalf("ExplainPermissions expected %+v, got %+v", want, explanation.Grants)
+	}
+
+	explanation, err = prefect.ExplainPermissions(ctx, s.createdUserId, s.createdOrganizationId, "test.missing")
+	if err != nil || len(explanation.Grants) != 0 {
+		t.Fatalf("ExplainPermissions expected no grants, got %+v %v", explanation.Grants, err)
+	}
+}
+
+func (s *ManagmentServiceTestSuite) ExpireUserRoles(t *testing.T) {
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	// Adding the user to a role they hold replaces the membership's window.
+	response, err := s.managementService.UserAddToRole(ctx, ubmanage.UserAddToRoleCommand{
+		UserId:    s.createdUserId,
+		RoleId:    s.createdRoleId,
+		ExpiresAt: expiresAt,
+	}, "test-agent")
+	if err != nil || response.Status != ubstatus.Success {
+		t.Fatalf("UserAddToRole with expiry failed: %v %s", err, response.Status)
+	}
+	roles, err := s.managementService.UserGetAllOrganizationRoles(ctx, s.createdUserId)
+	if err != nil || len(roles.Data) != 1 || roles.Data[0].ExpiresAt != expiresAt.Unix() {
+		t.Fatalf("expected the membership to expire at %d, got %+v %v", expiresAt.Unix(), roles.Data, err)
+	}
+
+	expired, err := s.managementService.UserRolesExpire(ctx, time.Now(), "test-agent")
+	if err != nil || expired.Data != 0 {
+		t.Fatalf("expected nothing to expire yet, got %d %v", expired.Data, err)
+	}
+	expired, err = s.managementService.UserRolesExpire(ctx, expiresAt, "test-agent")
+	if err != nil || expired.Data != 1 {
+		t.Fatalf("expected one membership to expire, got %d %v", expired.Data, err)
+	}
+	roles, _ = s.managementService.UserGetAllOrganizationRoles(ctx, s.createdUserId)
+	if len(roles.Data) != 0 {
+		t.Fatalf("expected the expired membership to be removed, got %+v", roles.Data)
+	}
+
+	// Memberships listed as expired are left alone when they were renewed or
+	// removed before the expiry gets to them.
+	response, err = s.managementService.UserAddToRole(ctx, ubmanage.UserAddToRoleCommand{
+		UserId:    s.createdUserId,
+		RoleId:    s.createdRoleId,
+		ExpiresAt: expiresAt,
+	}, "test-agent")
+	if err != nil || response.Status != ubstatus.Success {
+		t.Fatalf("UserAddToRole with expiry failed: %v %s", err, response.Status)
+	}
+	listed, err := s.dbadapter.ListExpiredUserRoles(ctx, expiresAt.Unix())
+	if err != nil || len(listed) != 1 {
+		t.Fatalf("expected the membership to be listed as expired, got %+v %v", listed, err)
+	}
+	stale := ubmanage.NewManagement(s.eventStore, &staleExpiryAdapter{DataAdapter: s.dbadapter, expired: listed},
+		s.hashingService, s.encryptionService, s.twoFactorService)
+
+	renewedUntil := expiresAt.Add(time.Hour)
+	response, err = s.managementService.UserAddToRole(ctx, ubmanage.UserAddToRoleCommand{
+		UserId:    s.createdUserId,
+		RoleId:    s.createdRoleId,
+		ExpiresAt: renewedUntil,
+	}, "test-agent")
+	if err != nil || response.Status != ubstatus.Success {
+		t.Fatalf("UserAddToRole renewal failed: %v %s", err, response.Status)
+	}
+	expired, err = stale.UserRolesExpire(ctx, expiresAt, "test-agent")
+	if err != nil || expired.Data != 0 {
+		t.Fatalf("expected the renewed membership to be kept, got %d %v", expired.Data, err)
+	}
+	roles, _ = s.managementService.UserGetAllOrganizationRoles(ctx, s.createdUserId)
+	if len(roles.Data) != 1 || roles.Data[0].ExpiresAt != renewedUntil.Unix() {
+		t.Fatalf("expected the renewed membership to remain, got %+v", roles.Data)
+	}
+
+	expired, err = s.managementService.UserRolesExpire(ctx, renewedUntil, "test-agent")
+	if err != nil || expired.Data != 1 {
+		t.Fatalf("expected the renewed membership to expire, got %d %v", expired.Data, err)
+	}
+	expired, err = stale.UserRolesExpire(ctx, renewedUntil, "test-agent")
+	if err != nil || expired.Data != 0 {
+		t.Fatalf("expected an already removed membership not to be removed again, got %d %v", expired.Data, err)
+	}
+
+	// Restore the unbounded membership for the following tests.
+	response, err = s.managementService.UserAddToRole(ctx, ubmanage.UserAddToRoleCommand{
+		UserId: s.createdUserId,
+		RoleId: s.createdRoleId,
+	}, "test-agent")
+	if err != nil || response.Status != ubstatus.Success {
+		t.Fatalf("UserAddToRole failed: %v %s", err, response.Status)
+	}
+}
+
 func (s *ManagmentServiceTestSuite) RemoveUserFromRole(t *testing.T) {
 	res, err := s.managementService.UserRemoveFromRole(context.Background(), ubmanage.UserRemoveFromRoleCommand{
 		UserId: s.createdUserId,
@@ -67,3 +182,14 @@ func (s *ManagmentServiceTestSuite) RemoveUserFromRole(t *testing.T) {
 		t.Fatalf("RemoveUserFromRole failed to get user organization roles: %v", err)
 	}
 }
+
+// staleExpiryAdapter lists the expired memberships as they were when it was
+// created, like an instance which listed them before they changed.
+type staleExpiryAdapter struct {
+	ubdata.DataAdapter
+	expired []ubdata.UserRoleMembership
+}
+
+func (a *staleExpiryAdapter) ListExpiredUserRoles(ctx context.Context, now int64) ([]ubdata.UserRoleMembership, error) {
+	return a.expired, nil
+}
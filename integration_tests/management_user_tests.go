@@ -2,11 +2,19 @@ package integration_tests
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
+	evercore "github.com/kernelplex/evercore/base"
+	"github.com/kernelplex/ubase/lib/contracts"
+	"github.com/kernelplex/ubase/lib/ubdata"
 	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubratelimit"
+	"github.com/kernelplex/ubase/lib/ubsecurity"
 	"github.com/kernelplex/ubase/lib/ubstatus"
 )
 
@@ -507,6 +515,321 @@ func (s *ManagmentServiceTestSuite) EmailLoginVerificationFlow(t *testing.T) {
 	}
 }
 
+func (s *ManagmentServiceTestSuite) EmailLoginRequiresTwoFactor(t *testing.T) {
+	ctx := context.Background()
+	email := fmt.Sprintf("email-login-2fa-%d@example.com", time.Now().UnixNano())
+
+	addResponse, err := s.managementService.UserAdd(ctx, ubmanage.UserCreateCommand{
+		Email:       email,
+		Password:    "TestPassword123!",
+		FirstName:   "Two",
+		LastName:    "Factor",
+		DisplayName: "Two Factor",
+		Verified:    true,
+	}, "test-runner")
+	if err != nil || addResponse.Status != ubstatus.Success {
+		t.Fatalf("EmailLoginRequiresTwoFactor failed to add user: %v %v", err, addResponse.Status)
+	}
+	userId := addResponse.Data.Id
+
+	secretResponse, err := s.managementService.UserSetTwoFactorSharedSecret(ctx, ubmanage.UserSetTwoFactorSharedSecretCommand{
+		Id:     userId,
+		Secret: s.twoFactorSecret,
+	}, "test-runner")
+	if err != nil || secretResponse.Status != ubstatus.Success {
+		t.Fatalf("EmailLoginRequiresTwoFactor failed to set two factor secret: %v %v", err, secretResponse.Status)
+	}
+
+	requestResp, err := s.managementService.UserRequestEmailLogin(ctx, ubmanage.UserEmailLoginRequestCommand{
+		Email: email,
+	}, "test-runner")
+	if err != nil || requestResp.Status != ubstatus.Success {
+		t.Fatalf("EmailLoginRequiresTwoFactor failed to request login: %v %v", err, requestResp.Status)
+	}
+
+	// The code only proves the email address, so the second factor is still
+	// required.
+	verifyResp, err := s.managementService.UserVerifyEmailLoginCode(ctx, ubmanage.UserVerifyEmailLoginCodeCommand{
+		Email: email,
+		Code:  requestResp.Data.Code,
+	}, "test-runner")
+	if err != nil {
+		t.Fatalf("EmailLoginRequiresTwoFactor failed to verify code: %v", err)
+	}
+	if verifyResp.Status != ubstatus.PartialSuccess {
+		t.Fatalf("EmailLoginRequiresTwoFactor expected partial_success, got %v", verifyResp.Status)
+	}
+	if !verifyResp.Data.RequiresTwoFactor || verifyResp.Data.UserId != userId {
+		t.Fatalf("EmailLoginRequiresTwoFactor expected two factor to be required, got %+v", verifyResp.Data)
+	}
+
+	code, err := s.twoFactorService.GetTotpCode(s.twoFactorSecret)
+	if err != nil {
+		t.Fatalf("EmailLoginRequiresTwoFactor failed to generate code: %v", err)
+	}
+	twoFactorResp, err := s.managementService.UserVerifyTwoFactorCode(ctx, ubmanage.UserVerifyTwoFactorLoginCommand{
+		UserId: userId,
+		Code:   code,
+	}, "test-runner")
+	if err != nil || twoFactorResp.Status != ubstatus.Success {
+		t.Fatalf("EmailLoginRequiresTwoFactor failed to complete login with two factor code: %v %v", err, twoFactorResp.Status)
+	}
+}
+
+func (s *ManagmentServiceTestSuite) EmailLoginMagicLinkFlow(t *testing.T) {
+	ctx := context.Background()
+	email := fmt.Sprintf("email-login-link-%d@example.com", time.Now().UnixNano())
+
+	unknown, err := s.managementService.UserRequestEmailLogin(ctx, ubmanage.UserEmailLoginRequestCommand{
+		Email:        email,
+		ExistingOnly: true,
+	}, "test-runner")
+	if err != nil {
+		t.Fatalf("EmailLoginMagicLinkFlow failed to request login: %v", err)
+	}
+	if unknown.Status != ubstatus.NotFound {
+		t.Fatalf("EmailLoginMagicLinkFlow expected unknown email to be rejected, got %v", unknown.Status)
+	}
+
+	unbound, err := s.managementService.UserRequestEmailLogin(ctx, ubmanage.UserEmailLoginRequestCommand{
+		Email: "unbound-" + email,
+	}, "test-runner")
+	if err != nil || unbound.Status != ubstatus.Success {
+		t.Fatalf("EmailLoginMagicLinkFlow failed to request login: %v %v", err, unbound.Status)
+	}
+	if unbound.Data.LinkToken != "" {
+		t.Fatal("EmailLoginMagicLinkFlow expected no link for an unbound request")
+	}
+	if unbound.Data.Sent {
+		t.Fatal("EmailLoginMagicLinkFlow expected no email without a mailer")
+	}
+
+	requestResp, err := s.managementService.UserRequestEmailLogin(ctx, ubmanage.UserEmailLoginRequestCommand{
+		Email:   email,
+		Binding: "browser-secret",
+	}, "test-runner")
+	if err != nil || requestResp.Status != ubstatus.Success {
+		t.Fatalf("EmailLoginMagicLinkFlow failed to request login: %v %v", err, requestResp.Status)
+	}
+	if requestResp.Data.LinkToken == "" {
+		t.Fatal("EmailLoginMagicLinkFlow expected a link token")
+	}
+	if !strings.HasPrefix(requestResp.Data.LinkUrl, "https://ubase.test"+ubmanage.EmailLoginLinkPath+"?token=") {
+		t.Fatalf("EmailLoginMagicLinkFlow unexpected link %q", requestResp.Data.LinkUrl)
+	}
+
+	// Links only work in the browser that requested them.
+	wrongBrowser, err := s.managementService.UserVerifyEmailLoginLink(ctx, ubmanage.UserVerifyEmailLoginLinkCommand{
+		Token:   requestResp.Data.LinkToken,
+		Binding: "other-browser",
+	}, "test-runner")
+	if err != nil {
+		t.Fatalf("EmailLoginMagicLinkFlow failed to verify link: %v", err)
+	}
+	if wrongBrowser.Status != ubstatus.NotAuthorized {
+		t.Fatalf("EmailLoginMagicLinkFlow expected other browser to be rejected, got %v", wrongBrowser.Status)
+	}
+
+	verifyResp, err := s.managementService.UserVerifyEmailLoginLink(ctx, ubmanage.UserVerifyEmailLoginLinkCommand{
+		Token:   requestResp.Data.LinkToken,
+		Binding: "browser-secret",
+	}, "test-runner")
+	if err != nil {
+		t.Fatalf("EmailLoginMagicLinkFlow failed to verify link: %v", err)
+	}
+	if verifyResp.Status != ubstatus.Success {
+		t.Fatalf("EmailLoginMagicLinkFlow verify status not success: %v (%s)", verifyResp.Status, verifyResp.Message)
+	}
+	if verifyResp.Data.UserId != requestResp.Data.UserId {
+		t.Fatalf("EmailLoginMagicLinkFlow expected user id %d, got %d", requestResp.Data.UserId, verifyResp.Data.UserId)
+	}
+
+	// The link and its code are consumed together.
+	reused, err := s.managementService.UserVerifyEmailLoginLink(ctx, ubmanage.UserVerifyEmailLoginLinkCommand{
+		Token:   requestResp.Data.LinkToken,
+		Binding: "browser-secret",
+	}, "test-runner")
+	if err != nil {
+		t.Fatalf("EmailLoginMagicLinkFlow failed to verify link: %v", err)
+	}
+	if reused.Status != ubstatus.NotAuthorized {
+		t.Fatalf("EmailLoginMagicLinkFlow expected single-use link to be rejected, got %v", reused.Status)
+	}
+	codeResp, err := s.managementService.UserVerifyEmailLoginCode(ctx, ubmanage.UserVerifyEmailLoginCodeCommand{
+		Email: email,
+		Code:  requestResp.Data.Code,
+	}, "test-runner")
+	if err != nil {
+		t.Fatalf("EmailLoginMagicLinkFlow failed to verify code: %v", err)
+	}
+	if codeResp.Status != ubstatus.NotAuthorized {
+		t.Fatalf("EmailLoginMagicLinkFlow expected consumed code to be rejected, got %v", codeResp.Status)
+	}
+}
+
+func (s *ManagmentServiceTestSuite) EmailLoginCodeAttemptLimits(t *testing.T) {
+	ctx := context.Background()
+	email := fmt.Sprintf("email-login-limits-%d@example.com", time.Now().UnixNano())
+
+	requestResp, err := s.managementService.UserRequestEmailLogin(ctx, ubmanage.UserEmailLoginRequestCommand{
+		Email: email,
+	}, "test-runner")
+	if err != nil || requestResp.Status != ubstatus.Success {
+		t.Fatalf("EmailLoginCodeAttemptLimits failed to request login: %v %v", err, requestResp.Status)
+	}
+
+	again, err := s.managementService.UserRequestEmailLogin(ctx, ubmanage.UserEmailLoginRequestCommand{
+		Email: email,
+	}, "test-runner")
+	if err != nil {
+		t.Fatalf("EmailLoginCodeAttemptLimits failed to request login: %v", err)
+	}
+	if again.Status != ubstatus.RateLimited || again.RetryAfter <= 0 {
+		t.Fatalf("EmailLoginCodeAttemptLimits expected cooldown, got %v (retry after %d)", again.Status, again.RetryAfter)
+	}
+
+	// The suite uses the default limit of five attempts.
+	for i := range 5 {
+		resp, err := s.managementService.UserVerifyEmailLoginCode(ctx, ubmanage.UserVerifyEmailLoginCodeCommand{
+			Email: email,
+			Code:  "wrong-" + requestResp.Data.Code,
+		}, "test-runner")
+		if err != nil {
+			t.Fatalf("EmailLoginCodeAttemptLimits failed to verify code: %v", err)
+		}
+		if resp.Status != ubstatus.NotAuthorized {
+			t.Fatalf("EmailLoginCodeAttemptLimits expected attempt %d to fail, got %v", i+1, resp.Status)
+		}
+	}
+
+	userResp, err := s.managementService.UserGetByEmail(ctx, email)
+	if err != nil {
+		t.Fatalf("EmailLoginCodeAttemptLimits failed to load user: %v", err)
+	}
+	if userResp.Data.State.EmailLoginCode != nil || userResp.Data.State.EmailLoginCodeFailures != 0 {
+		t.Fatal("EmailLoginCodeAttemptLimits expected code to be invalidated")
+	}
+
+	resp, err := s.managementService.UserVerifyEmailLoginCode(ctx, ubmanage.UserVerifyEmailLoginCodeCommand{
+		Email: email,
+		Code:  requestResp.Data.Code,
+	}, "test-runner")
+	if err != nil {
+		t.Fatalf("EmailLoginCodeAttemptLimits failed to verify code: %v", err)
+	}
+	if resp.Status != ubstatus.NotAuthorized {
+		t.Fatalf("EmailLoginCodeAttemptLimits expected invalidated code to be rejected, got %v", resp.Status)
+	}
+}
+
+func (s *ManagmentServiceTestSuite) VerificationLinkFlow(t *testing.T) {
+	ctx := context.Background()
+	email := fmt.Sprintf("verification-%d@example.com", time.Now().UnixNano())
+	s.loginAlertMailer.Reset()
+
+	created, err := s.managementService.UserAdd(ctx, ubmanage.UserCreateCommand{
+		Email:                     email,
+		Password:                  "TestPassword123!",
+		GenerateVerificationToken: true,
+	}, "test-runner")
+	if err != nil || created.Status != ubstatus.Success {
+		t.Fatalf("VerificationLinkFlow failed to add user: %v %v", err, created.Status)
+	}
+
+	jobs := s.loginAlertMailer.Jobs()
+	if len(jobs) != 1 || jobs[0].To != email {
+		t.Fatalf("VerificationLinkFlow expected a verification email, got %+v", jobs)
+	}
+	emailedLink := verificationLinkToken(t, jobs[0].TextBody)
+
+	login, err := s.managementService.UserAuthenticate(ctx, ubmanage.UserLoginCommand{
+		Email:    email,
+		Password: "TestPassword123!",
+	}, "test-runner")
+	if err != nil || login.Status != ubstatus.PartialSuccess || !login.Data.RequiresVerification {
+		t.Fatalf("VerificationLinkFlow expected login to require verification, got %v %v", err, login.Status)
+	}
+
+	resend, err := s.managementService.UserResendVerification(ctx, ubmanage.UserResendVerificationCommand{
+		Email: email,
+	}, "test-runner")
+	if err != nil {
+		t.Fatalf("VerificationLinkFlow failed to resend: %v", err)
+	}
+	if resend.Status != ubstatus.RateLimited || resend.RetryAfter <= 0 {
+		t.Fatalf("VerificationLinkFlow expected resend cooldown, got %v", resend.Status)
+	}
+
+	wrong, err := s.managementService.UserVerify(ctx, ubmanage.UserVerifyCommand{
+		Id:           created.Data.Id,
+		Verification: "wrong-" + *created.Data.VerificationToken,
+	}, "test-runner")
+	if err != nil || wrong.Status != ubstatus.NotAuthorized {
+		t.Fatalf("VerificationLinkFlow expected wrong token to be rejected, got %v %v", err, wrong.Status)
+	}
+
+	// Regenerating replaces the emailed token.
+	regenerated, err := s.managementService.UserGenerateVerificationToken(ctx, ubmanage.UserGenerateVerificationTokenCommand{
+		Id:         created.Data.Id,
+		Regenerate: true,
+	}, "test-runner")
+	if err != nil || regenerated.Status != ubstatus.Success {
+		t.Fatalf("VerificationLinkFlow failed to regenerate token: %v %v", err, regenerated.Status)
+	}
+	if regenerated.Data.ExpiresAt <= time.Now().Unix() {
+		t.Fatal("VerificationLinkFlow expected token to expire in the future")
+	}
+
+	stale, err := s.managementService.UserVerifyLink(ctx, ubmanage.UserVerifyLinkCommand{Token: emailedLink}, "test-runner")
+	if err != nil || stale.Status != ubstatus.NotAuthorized {
+		t.Fatalf("VerificationLinkFlow expected replaced link to be rejected, got %v %v", err, stale.Status)
+	}
+
+	verified, err := s.managementService.UserVerifyLink(ctx, ubmanage.UserVerifyLinkCommand{Token: regenerated.Data.LinkToken}, "test-runner")
+	if err != nil || verified.Status != ubstatus.Success {
+		t.Fatalf("VerificationLinkFlow failed to verify link: %v %v (%s)", err, verified.Status, verified.Message)
+	}
+
+	user, err := s.dbadapter.GetUserByEmail(ctx, email)
+	if err != nil {
+		t.Fatalf("VerificationLinkFlow failed to get user: %v", err)
+	}
+	if !user.Verified {
+		t.Fatal("VerificationLinkFlow expected user to be verified")
+	}
+
+	done, err := s.managementService.UserResendVerification(ctx, ubmanage.UserResendVerificationCommand{
+		Id: created.Data.Id,
+	}, "test-runner")
+	if err != nil || done.Status != ubstatus.ValidationError {
+		t.Fatalf("VerificationLinkFlow expected verified user to be rejected, got %v %v", err, done.Status)
+	}
+
+	unknown, err := s.managementService.UserResendVerification(ctx, ubmanage.UserResendVerificationCommand{
+		Email: "unknown-" + email,
+	}, "test-runner")
+	if err != nil || unknown.Status != ubstatus.NotFound {
+		t.Fatalf("VerificationLinkFlow expected unknown email to be rejected, got %v %v", err, unknown.Status)
+	}
+}
+
+// verificationLinkToken extracts the link token from a verification email.
+func verificationLinkToken(t *testing.T, body string) string {
+	t.Helper()
+	for _, line := range strings.Split(body, "\n") {
+		if !strings.HasPrefix(line, "https://ubase.test"+ubmanage.VerificationLinkPath+"?") {
+			continue
+		}
+		link, err := url.Parse(line)
+		if err != nil {
+			t.Fatalf("failed to parse verification link: %v", err)
+		}
+		return link.Query().Get("token")
+	}
+	t.Fatalf("no verification link in email: %s", body)
+	return ""
+}
+
 func (s *ManagmentServiceTestSuite) UserAddApiKey(t *testing.T) {
 	ctx := context.Background()
 
@@ -684,3 +1007,512 @@ func (s *ManagmentServiceTestSuite) UserDeleteApiKey(t *testing.T) {
 		}
 	}
 }
+
+func (s *ManagmentServiceTestSuite) EraseUser(t *testing.T) {
+	ctx := context.Background()
+	email := fmt.Sprintf("erase-%d@example.com", time.Now().UnixNano())
+
+	addResponse, err := s.managementService.UserAdd(ctx, ubmanage.UserCreateCommand{
+		Email:       email,
+		Password:    "TestPassword123!",
+		FirstName:   "Erase",
+		LastName:    "Me",
+		DisplayName: "Erase Me",
+		Verified:    true,
+	}, "test-runner")
+	if err != nil {
+		t.Fatalf("EraseUser failed to add user: %v", err)
+	}
+	if addResponse.Status != ubstatus.Success {
+		t.Fatalf("EraseUser add status is not success: %v", addResponse.Status)
+	}
+	userId := addResponse.Data.Id
+
+	// The email is sealed in the event store and opens with the stored data key.
+	sealed := ubmanage.UserAggregate{}
+	err = s.eventStore.WithReadonlyContext(ctx, func(etx evercore.EventStoreReadonlyContext) error {
+		return etx.LoadStateInto(&sealed, userId)
+	})
+	if err != nil {
+		t.Fatalf("EraseUser failed to load user state: %v", err)
+	}
+	if sealed.State.Email == email || !strings.HasPrefix(sealed.State.Email, "pii:v1:") {
+		t.Fatalf("EraseUser expected the stored email to be sealed, got %q", sealed.State.Email)
+	}
+	if opened, err := s.openSealedPII(ctx, userId, sealed.State.Email); err != nil || opened != email {
+		t.Fatalf("EraseUser expected the sealed email to open before erase, got %q %v", opened, err)
+	}
+
+	eraseResponse, err := s.managementService.UserErase(ctx, ubmanage.UserEraseCommand{Id: userId}, "test-runner")
+	if err != nil {
+		t.Fatalf("EraseUser failed to erase user: %v", err)
+	}
+	if eraseResponse.Status != ubstatus.Success {
+		t.Fatalf("EraseUser status is not success: %v", eraseResponse.Status)
+	}
+
+	// The read model row is gone.
+	if _, err := s.dbadapter.GetUser(ctx, userId); err == nil {
+		t.Fatal("EraseUser expected user to be removed from the read model")
+	}
+
+	// The data key is destroyed, so the sealed email left in the event store
+	// can no longer be opened, even with the master key.
+	if _, found, err := s.dbadapter.GetUserDataKey(ctx, userId); err != nil || found {
+		t.Fatalf("EraseUser expected the data key to be deleted, got found %v %v", found, err)
+	}
+	if opened, err := s.openSealedPII(ctx, userId, sealed.State.Email); err == nil {
+		t.Fatalf("EraseUser expected the sealed email not to open after erase, got %q", opened)
+	}
+
+	// The aggregate is a tombstone without personal data.
+	getResponse, err := s.managementService.UserGetById(ctx, userId)
+	if err != nil {
+		t.Fatalf("EraseUser failed to get user by id: %v", err)
+	}
+	state := getResponse.Data.State
+	if !state.Erased || !state.Disabled {
+		t.Fatalf("EraseUser expected erased and disabled user, got %+v", state)
+	}
+	if state.Email != "" || state.DisplayName != "" || state.PasswordHash != "" {
+		t.Fatalf("EraseUser expected personal data to be cleared, got %+v", state)
+	}
+
+	// The email no longer resolves to the user.
+	byEmailResponse, err := s.managementService.UserGetByEmail(ctx, email)
+	if err != nil {
+		t.Fatalf("EraseUser failed to get user by email: %v", err)
+	}
+	if byEmailResponse.Status == ubstatus.Success && byEmailResponse.Data.Id == userId {
+		t.Fatal("EraseUser expected lookup by email not to find the erased user")
+	}
+
+	// The user can no longer log in.
+	loginResponse, err := s.managementService.UserAuthenticate(ctx, ubmanage.UserLoginCommand{
+		Email:    email,
+		Password: "TestPassword123!",
+	}, "test-runner")
+	if err != nil {
+		t.Fatalf("EraseUser failed to attempt login: %v", err)
+	}
+	if loginResponse.Status == ubstatus.Success {
+		t.Fatal("EraseUser expected login to fail")
+	}
+
+	// Erasing twice reports the user as not found.
+	secondResponse, err := s.managementService.UserErase(ctx, ubmanage.UserEraseCommand{Id: userId}, "test-runner")
+	if err != nil {
+		t.Fatalf("EraseUser second erase failed: %v", err)
+	}
+	if secondResponse.Status != ubstatus.NotFound {
+		t.Fatalf("EraseUser expected NotFound on second erase, got: %v", secondResponse.Status)
+	}
+}
+
+func (s *ManagmentServiceTestSuite) ImpersonateUser(t *testing.T) {
+	ctx := context.Background()
+	email := fmt.Sprintf("impersonated-%d@example.com", time.Now().UnixNano())
+
+	addResponse, err := s.managementService.UserAdd(ctx, ubmanage.UserCreateCommand{
+		Email:       email,
+		Password:    "TestPassword123!",
+		FirstName:   "Imper",
+		LastName:    "Sonated",
+		DisplayName: "Imper Sonated",
+		Verified:    true,
+	}, "test-runner")
+	if err != nil {
+		t.Fatalf("ImpersonateUser failed to add user: %v", err)
+	}
+	targetId := addResponse.Data.Id
+
+	startResponse, err := s.managementService.UserStartImpersonation(ctx, ubmanage.UserStartImpersonationCommand{
+		ImpersonatorId: s.createdUserId,
+		OrganizationId: s.createdOrganizationId,
+		TargetId:       targetId,
+	}, fmt.Sprintf("user:%d", s.createdUserId))
+	if err != nil {
+		t.Fatalf("ImpersonateUser failed to start impersonation: %v", err)
+	}
+	if startResponse.Status != ubstatus.Success {
+		t.Fatalf("ImpersonateUser start status is not success: %v", startResponse.Status)
+	}
+	if startResponse.Data.TargetId != targetId || startResponse.Data.TargetEmail != email {
+		t.Fatalf("ImpersonateUser returned wrong target: %+v", startResponse.Data)
+	}
+	if startResponse.Data.ImpersonatorId != s.createdUserId || startResponse.Data.ImpersonatorEmail == "" {
+		t.Fatalf("ImpersonateUser returned wrong impersonator: %+v", startResponse.Data)
+	}
+	if startResponse.Data.TargetOrganizationId != s.createdOrganizationId {
+		t.Fatalf("ImpersonateUser expected a target without roles to stay in the impersonator's organization, got %d", startResponse.Data.TargetOrganizationId)
+	}
+
+	stopResponse, err := s.managementService.UserStopImpersonation(ctx, ubmanage.UserStopImpersonationCommand{
+		ImpersonatorId: s.createdUserId,
+		TargetId:       targetId,
+	}, fmt.Sprintf("user:%d as user:%d", s.createdUserId, targetId))
+	if err != nil {
+		t.Fatalf("ImpersonateUser failed to stop impersonation: %v", err)
+	}
+	if stopResponse.Status != ubstatus.Success {
+		t.Fatalf("ImpersonateUser stop status is not success: %v", stopResponse.Status)
+	}
+
+	// A target who is a system administrator in their own organization is
+	// impersonated there, and only by system administrators.
+	suffix := time.Now().UnixNano()
+	otherOrg, err := s.managementService.OrganizationAdd(ctx, ubmanage.OrganizationCreateCommand{
+		Name:       "Impersonation Other",
+		SystemName: fmt.Sprintf("impersonation_other_%d", suffix),
+		Status:     "active",
+	}, "test-runner")
+	if err != nil || otherOrg.Status != ubstatus.Success {
+		t.Fatalf("ImpersonateUser failed to add organization: %v %v", err, otherOrg.Status)
+	}
+	addAdminRole := func(organizationId int64, userId int64) int64 {
+		role, err := s.managementService.RoleAdd(ctx, ubmanage.RoleCreateCommand{
+			OrganizationId: organizationId,
+			Name:           fmt.Sprintf("Impersonation Admins %d", organizationId),
+			SystemName:     fmt.Sprintf("impersonation_admins_%d_%d", organizationId, suffix),
+		}, "test-runner")
+		if err != nil || role.Status != ubstatus.Success {
+			t.Fatalf("ImpersonateUser failed to add role: %v %v", err, role.Status)
+		}
+		permission, err := s.managementService.RolePermissionAdd(ctx, ubmanage.RolePermissionAddCommand{
+			Id:         role.Data.Id,
+			Permission: contracts.PermSystemAdmin,
+		}, "test-runner")
+		if err != nil || permission.Status != ubstatus.Success {
+			t.Fatalf("ImpersonateUser failed to add permission: %v %v", err, permission.Status)
+		}
+		added, err := s.managementService.UserAddToRole(ctx, ubmanage.UserAddToRoleCommand{UserId: userId, RoleId: role.Data.Id}, "test-runner")
+		if err != nil || added.Status != ubstatus.Success {
+			t.Fatalf("ImpersonateUser failed to add user to role: %v %v", err, added.Status)
+		}
+		return role.Data.Id
+	}
+	addAdminRole(otherOrg.Data.Id, targetId)
+	adminResponse, err := s.managementService.UserStartImpersonation(ctx, ubmanage.UserStartImpersonationCommand{
+		ImpersonatorId: s.createdUserId,
+		OrganizationId: s.createdOrganizationId,
+		TargetId:       targetId,
+	}, fmt.Sprintf("user:%d", s.createdUserId))
+	if err != nil || adminResponse.Status != ubstatus.NotAuthorized {
+		t.Fatalf("ImpersonateUser expected NotAuthorized for a system administrator target, got: %v %v", err, adminResponse.Status)
+	}
+	impersonatorRoleId := addAdminRole(s.createdOrganizationId, s.createdUserId)
+	adminResponse, err = s.managementService.UserStartImpersonation(ctx, ubmanage.UserStartImpersonationCommand{
+		ImpersonatorId: s.createdUserId,
+		OrganizationId: s.createdOrganizationId,
+		TargetId:       targetId,
+	}, fmt.Sprintf("user:%d", s.createdUserId))
+	if err != nil || adminResponse.Status != ubstatus.Success {
+		t.Fatalf("ImpersonateUser expected a system administrator to impersonate one, got: %v %v", err, adminResponse.Status)
+	}
+	if adminResponse.Data.TargetOrganizationId != otherOrg.Data.Id {
+		t.Fatalf("ImpersonateUser expected the session in the target's organization %d, got %d", otherOrg.Data.Id, adminResponse.Data.TargetOrganizationId)
+	}
+	_, err = s.managementService.UserStopImpersonation(ctx, ubmanage.UserStopImpersonationCommand{
+		ImpersonatorId: s.createdUserId,
+		TargetId:       targetId,
+	}, fmt.Sprintf("user:%d as user:%d", s.createdUserId, targetId))
+	if err != nil {
+		t.Fatalf("ImpersonateUser failed to stop impersonation: %v", err)
+	}
+	removed, err := s.managementService.UserRemoveFromRole(ctx, ubmanage.UserRemoveFromRoleCommand{UserId: s.createdUserId, RoleId: impersonatorRoleId}, "test-runner")
+	if err != nil || removed.Status != ubstatus.Success {
+		t.Fatalf("ImpersonateUser failed to remove user from role: %v %v", err, removed.Status)
+	}
+
+	// Disabled users cannot be impersonated.
+	_, err = s.managementService.UserDisable(ctx, ubmanage.UserDisableCommand{Id: targetId}, "test-runner")
+	if err != nil {
+		t.Fatalf("ImpersonateUser failed to disable user: %v", err)
+	}
+	disabledResponse, err := s.managementService.UserStartImpersonation(ctx, ubmanage.UserStartImpersonationCommand{
+		ImpersonatorId: s.createdUserId,
+		OrganizationId: s.createdOrganizationId,
+		TargetId:       targetId,
+	}, fmt.Sprintf("user:%d", s.createdUserId))
+	if err != nil {
+		t.Fatalf("ImpersonateUser failed to attempt impersonating a disabled user: %v", err)
+	}
+	if disabledResponse.Status != ubstatus.NotAuthorized {
+		t.Fatalf("ImpersonateUser expected NotAuthorized for disabled user, got: %v", disabledResponse.Status)
+	}
+}
+
+func (s *ManagmentServiceTestSuite) LoginHistory(t *testing.T) {
+	ctx := context.Background()
+	client := ubmanage.LoginClient{
+		IpAddress: "203.0.113.7",
+		UserAgent: "integration-test-agent",
+		DeviceId:  "0123456789abcdef0123456789abcdef",
+	}
+
+	failed, err := s.managementService.UserAuthenticate(ctx, ubmanage.UserLoginCommand{
+		Email:    updatedUser.Email,
+		Password: "not-the-password",
+		Client:   client,
+	}, "test-runner")
+	if err != nil {
+		t.Fatalf("LoginHistory failed login errored: %v", err)
+	}
+	if failed.Status != ubstatus.NotAuthorized {
+		t.Fatalf("LoginHistory expected NotAuthorized, got: %v", failed.Status)
+	}
+
+	succeeded, err := s.managementService.UserAuthenticate(ctx, ubmanage.UserLoginCommand{
+		Email:    updatedUser.Email,
+		Password: updatedUser.Password,
+		Client:   client,
+	}, "test-runner")
+	if err != nil {
+		t.Fatalf("LoginHistory login errored: %v", err)
+	}
+	if succeeded.Status != ubstatus.Success {
+		t.Fatalf("LoginHistory expected Success, got: %v", succeeded.Status)
+	}
+
+	history, err := s.managementService.UserLoginHistory(ctx, s.createdUserId, 10, 0)
+	if err != nil {
+		t.Fatalf("LoginHistory failed to list history: %v", err)
+	}
+	if len(history.Data) < 2 {
+		t.Fatalf("LoginHistory expected at least 2 entries, got %d", len(history.Data))
+	}
+	latest := history.Data[0]
+	if latest.Outcome != ubdata.UserLoginOutcomeSucceeded {
+		t.Fatalf("LoginHistory expected latest login to succeed, got %+v", latest)
+	}
+	if latest.IpAddress != client.IpAddress || latest.UserAgent != client.UserAgent || latest.DeviceId != client.DeviceId {
+		t.Fatalf("LoginHistory recorded wrong client details: %+v", latest)
+	}
+	if history.Data[1].Outcome != ubdata.UserLoginOutcomeFailed || history.Data[1].Reason == "" {
+		t.Fatalf("LoginHistory expected failed login with reason, got %+v", history.Data[1])
+	}
+
+	byIp, err := s.managementService.UserLoginsByIp(ctx, "203.0.113.", 10, 0)
+	if err != nil {
+		t.Fatalf("LoginHistory failed to search by IP: %v", err)
+	}
+	if len(byIp.Data) < 2 {
+		t.Fatalf("LoginHistory expected at least 2 entries by IP, got %d", len(byIp.Data))
+	}
+	for _, l := range byIp.Data {
+		if l.UserID != s.createdUserId {
+			t.Fatalf("LoginHistory search returned unexpected user: %+v", l)
+		}
+	}
+}
+
+func (s *ManagmentServiceTestSuite) LoginAlerts(t *testing.T) {
+	ctx := context.Background()
+	s.loginAlertMailer.Reset()
+
+	login := func(password string, deviceId string) ubstatus.StatusCode {
+		resp, err := s.managementService.UserAuthenticate(ctx, ubmanage.UserLoginCommand{
+			Email:    updatedUser.Email,
+			Password: password,
+			Client: ubmanage.LoginClient{
+				IpAddress: "198.51.100.4",
+				UserAgent: "integration-test-agent",
+				DeviceId:  deviceId,
+			},
+		}, "test-runner")
+		if err != nil {
+			t.Fatalf("LoginAlerts login errored: %v", err)
+		}
+		return resp.Status
+	}
+
+	// LoginHistory logged in from the first device, so a different device
+	// cookie is new.
+	newDevice := "fedcba9876543210fedcba9876543210"
+	if status := login(updatedUser.Password, newDevice); status != ubstatus.Success {
+		t.Fatalf("LoginAlerts expected Success, got: %v", status)
+	}
+	if status := login(updatedUser.Password, newDevice); status != ubstatus.Success {
+		t.Fatalf("LoginAlerts expected Success, got: %v", status)
+	}
+	jobs := s.loginAlertMailer.Jobs()
+	if len(jobs) != 1 {
+		t.Fatalf("LoginAlerts expected 1 new device alert, got %d", len(jobs))
+	}
+	if jobs[0].To != updatedUser.Email || !strings.Contains(jobs[0].TextBody, "198.51.100.4") {
+		t.Fatalf("LoginAlerts unexpected alert: %+v", jobs[0])
+	}
+
+	// Reaching the suite's threshold of two failed attempts alerts on the
+	// next success, even from a known device.
+	for i := 0; i < 2; i++ {
+		if status := login("not-the-password", newDevice); status != ubstatus.NotAuthorized {
+			t.Fatalf("LoginAlerts expected NotAuthorized, got: %v", status)
+		}
+	}
+	if status := login(updatedUser.Password, newDevice); status != ubstatus.Success {
+		t.Fatalf("LoginAlerts expected Success, got: %v", status)
+	}
+	jobs = s.loginAlertMailer.Jobs()
+	if len(jobs) != 2 || !strings.Contains(jobs[1].TextBody, "2 failed attempts") {
+		t.Fatalf("LoginAlerts expected failed attempts alert, got %+v", jobs)
+	}
+
+	invalid, err := s.managementService.UserReportUnrecognizedLogin(ctx, ubmanage.UserReportUnrecognizedLoginCommand{Token: "bogus"}, "test-runner")
+	if err != nil {
+		t.Fatalf("LoginAlerts invalid report errored: %v", err)
+	}
+	if invalid.Status != ubstatus.NotAuthorized {
+		t.Fatalf("LoginAlerts expected NotAuthorized for invalid token, got: %v", invalid.Status)
+	}
+
+	reported, err := s.managementService.UserReportUnrecognizedLogin(ctx, ubmanage.UserReportUnrecognizedLoginCommand{
+		Token: loginReportToken(t, jobs[0].TextBody),
+	}, "test-runner")
+	if err != nil {
+		t.Fatalf("LoginAlerts report errored: %v", err)
+	}
+	if reported.Status != ubstatus.Success {
+		t.Fatalf("LoginAlerts expected report Success, got: %v", reported.Status)
+	}
+
+	user, err := s.managementService.UserGetById(ctx, s.createdUserId)
+	if err != nil {
+		t.Fatalf("LoginAlerts failed to get user: %v", err)
+	}
+	if !user.Data.State.Disabled || user.Data.State.SessionsRevokedAt == 0 {
+		t.Fatalf("LoginAlerts expected user disabled with sessions revoked, got %+v", user.Data.State)
+	}
+	if len(user.Data.State.KnownDevices) != 2 {
+		t.Fatalf("LoginAlerts expected 2 known devices, got %d", len(user.Data.State.KnownDevices))
+	}
+
+	// Restore the user for the remaining tests.
+	enabled, err := s.managementService.UserEnable(ctx, ubmanage.UserEnableCommand{Id: s.createdUserId}, "test-runner")
+	if err != nil || enabled.Status != ubstatus.Success {
+		t.Fatalf("LoginAlerts failed to re-enable user: %v", err)
+	}
+
+	// The link has been used, so it must not disable the user again.
+	again, err := s.managementService.UserReportUnrecognizedLogin(ctx, ubmanage.UserReportUnrecognizedLoginCommand{
+		Token: loginReportToken(t, jobs[0].TextBody),
+	}, "test-runner")
+	if err != nil || again.Status != ubstatus.Success {
+		t.Fatalf("LoginAlerts expected repeated report to succeed, got %v, %v", again.Status, err)
+	}
+	user, err = s.managementService.UserGetById(ctx, s.createdUserId)
+	if err != nil {
+		t.Fatalf("LoginAlerts failed to get user: %v", err)
+	}
+	if user.Data.State.Disabled {
+		t.Fatalf("LoginAlerts expected repeated report to leave the user enabled")
+	}
+}
+
+func loginReportToken(t *testing.T, body string) string {
+	start := strings.Index(body, ubmanage.LoginReportPath+"?")
+	if start < 0 {
+		t.Fatalf("no report link in alert: %q", body)
+	}
+	link := body[start:]
+	if end := strings.IndexByte(link, '\n'); end >= 0 {
+		link = link[:end]
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("invalid report link %q: %v", link, err)
+	}
+	return parsed.Query().Get("token")
+}
+
+func (s *ManagmentServiceTestSuite) LoginRateLimits(t *testing.T) {
+	ctx := context.Background()
+
+	// Two instances sharing the SQL store see the same limits.
+	store := ubratelimit.NewSQLStore(s.dbadapter)
+	newInstance := func() ubmanage.ManagementService {
+		return ubmanage.NewManagement(
+			s.eventStore,
+			s.dbadapter,
+			s.hashingService,
+			s.encryptionService,
+			s.twoFactorService,
+			ubmanage.WithRateLimitOptions(ubmanage.RateLimitOptions{
+				Login: ubratelimit.NewLimiter(store, ubratelimit.Policy{
+					Name:      "integration-login",
+					Algorithm: ubratelimit.SlidingWindow,
+					Limit:     2,
+					Window:    time.Hour,
+				}),
+				CodeVerification: ubratelimit.NewLimiter(store, ubratelimit.Policy{
+					Name:      "integration-code",
+					Algorithm: ubratelimit.TokenBucket,
+					Limit:     1,
+					Window:    time.Hour,
+				}),
+			}),
+		)
+	}
+	instances := []ubmanage.ManagementService{newInstance(), newInstance()}
+
+	command := ubmanage.UserLoginCommand{Email: "rate-limited@example.com", Password: "WrongPassword123!"}
+	for i := range 2 {
+		response, err := instances[i].UserAuthenticate(ctx, command, "test-runner")
+		if err != nil {
+			t.Fatalf("UserAuthenticate failed: %v", err)
+		}
+		if response.Status != ubstatus.NotAuthorized {
+			t.Fatalf("Expected attempt %d to be checked, got %v", i+1, response.Status)
+		}
+	}
+
+	// Email addresses are compared case-insensitively.
+	command.Email = "Rate-Limited@Example.com"
+	response, err := instances[0].UserAuthenticate(ctx, command, "test-runner")
+	if err != nil {
+		t.Fatalf("UserAuthenticate failed: %v", err)
+	}
+	if response.Status != ubstatus.RateLimited {
+		t.Fatalf("Expected rate limited status, got %v", response.Status)
+	}
+	if response.RetryAfter <= 0 {
+		t.Fatalf("Expected a retry delay, got %d", response.RetryAfter)
+	}
+
+	verify := ubmanage.UserVerifyTwoFactorLoginCommand{UserId: s.createdUserId, Code: "000000"}
+	if _, err := instances[0].UserVerifyTwoFactorCode(ctx, verify, "test-runner"); err != nil {
+		t.Fatalf("UserVerifyTwoFactorCode failed: %v", err)
+	}
+	verifyResponse, err := instances[1].UserVerifyTwoFactorCode(ctx, verify, "test-runner")
+	if err != nil {
+		t.Fatalf("UserVerifyTwoFactorCode failed: %v", err)
+	}
+	if verifyResponse.Status != ubstatus.RateLimited {
+		t.Fatalf("Expected two factor verification to be rate limited, got %v", verifyResponse.Status)
+	}
+}
+
+// openSealedPII opens a sealed personal value the way an attacker holding the
+// master key would: by unwrapping the user's stored data key.
+func (s *ManagmentServiceTestSuite) openSealedPII(ctx context.Context, userId int64, sealed string) (string, error) {
+	wrapped, found, err := s.dbadapter.GetUserDataKey(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("no data key for user %d", userId)
+	}
+	encoded, err := s.encryptionService.Decrypt64(wrapped)
+	if err != nil {
+		return "", err
+	}
+	key, err := base64.StdEncoding.DecodeString(string(encoded))
+	if err != nil {
+		return "", err
+	}
+	value, err := ubsecurity.Decrypt64(key, strings.TrimPrefix(sealed, "pii:v1:"))
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
@@ -1,12 +1,14 @@
 package integration_tests
 
 import (
+	"sync"
 	"testing"
 
 	evercore "github.com/kernelplex/evercore/base"
 	_ "github.com/kernelplex/ubase/internal/evercoregen"
 	"github.com/kernelplex/ubase/lib/ub2fa"
 	"github.com/kernelplex/ubase/lib/ubdata"
+	"github.com/kernelplex/ubase/lib/ubmailer"
 	"github.com/kernelplex/ubase/lib/ubmanage"
 	"github.com/kernelplex/ubase/lib/ubsecurity"
 )
@@ -17,6 +19,8 @@ type ManagmentServiceTestSuite struct {
 	managementService ubmanage.ManagementService
 	twoFactorService  ub2fa.TotpService
 	hashingService    ubsecurity.HashGenerator
+	encryptionService ubsecurity.EncryptionService
+	loginAlertMailer  *recordingMailer
 
 	createdOrganizationId int64
 	createdUserId         int64
@@ -34,6 +38,7 @@ func NewManagementServiceTestSuite(eventStore *evercore.EventStore, dbadapter ub
 		0x8d, 0x9e, 0xaf, 0xc4, 0xd8, 0xeb, 0xf1, 0x12,
 	})
 	totpService := ub2fa.NewTotpService("exaple.test")
+	loginAlertMailer := &recordingMailer{}
 
 	managemntService := ubmanage.NewManagement(
 		eventStore,
@@ -41,7 +46,29 @@ func NewManagementServiceTestSuite(eventStore *evercore.EventStore, dbadapter ub
 		hashingService,
 		encryptionService,
 		totpService,
-		ubmanage.WithEmailLoginOptions(ubmanage.EmailLoginOptions{Enabled: true}),
+		ubmanage.WithEmailLoginOptions(ubmanage.EmailLoginOptions{
+			Enabled:   true,
+			MagicLink: true,
+			BaseUrl:   "https://ubase.test",
+		}),
+		ubmanage.WithLoginAlertOptions(ubmanage.LoginAlertOptions{
+			Enabled:        true,
+			Mailer:         loginAlertMailer,
+			BaseUrl:        "https://ubase.test",
+			NewDevice:      true,
+			FailedAttempts: 2,
+		}),
+		ubmanage.WithVerificationOptions(ubmanage.VerificationOptions{
+			Mailer:  loginAlertMailer,
+			BaseUrl: "https://ubase.test",
+		}),
+		ubmanage.WithAccessRequestOptions(ubmanage.AccessRequestOptions{
+			Mailer:  loginAlertMailer,
+			BaseUrl: "https://ubase.test",
+		}),
+		ubmanage.WithAccessReviewOptions(ubmanage.AccessReviewOptions{
+			SigningKey: []byte("access-review-test-key"),
+		}),
 	)
 	return &ManagmentServiceTestSuite{
 		eventStore:        eventStore,
@@ -49,9 +76,36 @@ func NewManagementServiceTestSuite(eventStore *evercore.EventStore, dbadapter ub
 		managementService: managemntService,
 		twoFactorService:  totpService,
 		hashingService:    hashingService,
+		encryptionService: encryptionService,
+		loginAlertMailer:  loginAlertMailer,
 	}
 }
 
+// recordingMailer captures login alert and verification emails instead of
+// sending them.
+type recordingMailer struct {
+	mu   sync.Mutex
+	jobs []ubmailer.EmailJob
+}
+
+func (m *recordingMailer) Send(job ubmailer.EmailJob) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs = append(m.jobs, job)
+}
+
+func (m *recordingMailer) Jobs() []ubmailer.EmailJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]ubmailer.EmailJob(nil), m.jobs...)
+}
+
+func (m *recordingMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs = nil
+}
+
 func (s *ManagmentServiceTestSuite) RunTests(t *testing.T) {
 	t.Run("AddOrganization", s.AddOrganization)
 	t.Run("GetOrganizationBySystemName", s.GetOrganizationBySystemName)
@@ -65,7 +119,10 @@ func (s *ManagmentServiceTestSuite) RunTests(t *testing.T) {
 	t.Run("DeleteRole", s.DeleteRole)
 	t.Run("UndeleteRole", s.UndeleteRole)
 	t.Run("AddPermissionToRole", s.AddPermissionToRole)
+	t.Run("SetRolePermissionPolicy", s.SetRolePermissionPolicy)
 	t.Run("RemovePermissionFromRole", s.RemovePermissionFromRole)
+	t.Run("PermissionCatalog", s.PermissionCatalog)
+	t.Run("ApplyRolePermissions", s.ApplyRolePermissions)
 	t.Run("AddUser", s.AddUser)
 	t.Run("GetUserByEmail", s.GetUserByEmail)
 	t.Run("UpdateUser", s.UpdateUser)
@@ -78,17 +135,41 @@ func (s *ManagmentServiceTestSuite) RunTests(t *testing.T) {
 	t.Run("UpdateUserSamePassword", s.UpdateUserSamePassword)
 	t.Run("LoginWithCorrectPassword", s.TestLoginWithCorrectPassword)
 	t.Run("LoginWithIncorrectPassword", s.LoginWithIncorrectPassword)
+	t.Run("LoginHistory", s.LoginHistory)
+	t.Run("LoginAlerts", s.LoginAlerts)
+	t.Run("LoginRateLimits", s.LoginRateLimits)
 	t.Run("AddTwoFactorKey", s.AddTwoFactorKey)
 	t.Run("LoginWithCorrectPasswordEnsureTwoFactorRequiredIsSet", s.LoginWithCorrectPasswordEnsureTwoFactorRequiredIsSet)
 	t.Run("VerifyCorrectTwoFactorCode", s.VerifyCorrectTwoFactorCode)
 	t.Run("VerifyIncorrectTwoFactorCode", s.VerifyIncorrectTwoFactorCode)
 	t.Run("EmailLoginRequestCreatesUser", s.EmailLoginRequestCreatesUser)
 	t.Run("EmailLoginVerificationFlow", s.EmailLoginVerificationFlow)
+	t.Run("EmailLoginRequiresTwoFactor", s.EmailLoginRequiresTwoFactor)
+	t.Run("EmailLoginMagicLinkFlow", s.EmailLoginMagicLinkFlow)
+	t.Run("EmailLoginCodeAttemptLimits", s.EmailLoginCodeAttemptLimits)
+	t.Run("VerificationLinkFlow", s.VerificationLinkFlow)
 	t.Run("AddUserToRole", s.AddUserToRole)
+	t.Run("ExplainUserPermissions", s.ExplainUserPermissions)
+	t.Run("ExpireUserRoles", s.ExpireUserRoles)
 	t.Run("RemoveUserFromRole", s.RemoveUserFromRole)
+	t.Run("AccessRequests", s.AccessRequests)
+	t.Run("AccessRequestApproversHoldPermission", s.AccessRequestApproversHoldPermission)
+	t.Run("AccessReviews", s.AccessReviews)
+	t.Run("AccessReviewCloseRevokesDecidedGrants", s.AccessReviewCloseRevokesDecidedGrants)
+	t.Run("AccessReviewEraseReviewedUser", s.AccessReviewEraseReviewedUser)
+	t.Run("ExclusiveRoles", s.ExclusiveRoles)
+	t.Run("RoleTemplates", s.RoleTemplates)
 
 	t.Run("UserAddApiKey", s.UserAddApiKey)
 	t.Run("UserGetByApiKey", s.UserGetByApiKey)
 	t.Run("UserDeleteApiKey", s.UserDeleteApiKey)
+	t.Run("ServiceAccounts", s.ServiceAccounts)
+	t.Run("ApiKeyScopes", s.ApiKeyScopes)
+	t.Run("ApiKeyRotationAndAllowlist", s.ApiKeyRotationAndAllowlist)
+	t.Run("ApiKeyHashUpgrade", s.ApiKeyHashUpgrade)
+	t.Run("RelationTuples", s.RelationTuples)
+
+	t.Run("ImpersonateUser", s.ImpersonateUser)
+	t.Run("EraseUser", s.EraseUser)
 
 }
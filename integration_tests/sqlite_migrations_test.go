@@ -0,0 +1,88 @@
+package integration_tests
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/pressly/goose/v3"
+
+	"github.com/kernelplex/ubase/sql/sqlite"
+)
+
+// beforeRoleNamesPerOrganization is the last migration before roles are
+// rebuilt.
+const beforeRoleNamesPerOrganization = 20250928120000
+
+// TestSqliteMigrationsWithForeignKeys migrates a database holding role
+// memberships with foreign keys enforced, as applications may open it.
+func TestSqliteMigrationsWithForeignKeys(t *testing.T) {
+	db, err := openDatabase("sqlite:" + filepath.Join(t.TempDir(), "migrations.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	// The pragma applies to a connection, so keep to one.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("PRAGMA foreign_keys=ON;"); err != nil {
+		t.Fatalf("Failed to enable foreign keys: %v", err)
+	}
+
+	goose.SetDialect("sqlite3")
+	goose.SetBaseFS(ubase_sqlite.EmbeddedSqliteMigrations)
+	goose.SetTableName("ubase_migrations")
+	if err := goose.UpTo(db, "migrations", beforeRoleNamesPerOrganization); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	for _, statement := range []string{
+		"INSERT INTO organizations (id, name, system_name, status) VALUES (1, 'First', 'first', 'active'), (2, 'Second', 'second', 'active')",
+		"INSERT INTO roles (id, organization_id, name, system_name) VALUES (1, 1, 'Admin', 'first_admin')",
+		"INSERT INTO users (id, first_name, last_name, display_name, email) VALUES (1, 'Migrated', 'User', 'Migrated User', 'migrated@example.com')",
+		"INSERT INTO user_roles (user_id, role_id) VALUES (1, 1)",
+		"INSERT INTO role_permissions (role_id, permission) VALUES (1, 'users.manage')",
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Failed to insert %q: %v", statement, err)
+		}
+	}
+
+	if err := ubase_sqlite.MigrateUp(db); err != nil {
+		t.Fatalf("Failed to migrate database holding memberships: %v", err)
+	}
+	assertMigratedRoles(t, db)
+	// Role names are now only unique within an organization.
+	if _, err := db.Exec("INSERT INTO roles (id, organization_id, name, system_name) VALUES (2, 2, 'Admin', 'second_admin')"); err != nil {
+		t.Fatalf("expected another organization to use the role name, got %v", err)
+	}
+	if _, err := db.Exec("DELETE FROM roles WHERE id = 2"); err != nil {
+		t.Fatalf("Failed to delete role: %v", err)
+	}
+
+	if err := goose.DownTo(db, "migrations", beforeRoleNamesPerOrganization); err != nil {
+		t.Fatalf("Failed to migrate database down: %v", err)
+	}
+	assertMigratedRoles(t, db)
+}
+
+func assertMigratedRoles(t *testing.T, db *sql.DB) {
+	t.Helper()
+	var memberships, permissions int
+	if err := db.QueryRow("SELECT count(*) FROM user_roles WHERE user_id = 1 AND role_id = 1").Scan(&memberships); err != nil || memberships != 1 {
+		t.Fatalf("expected the membership to survive, got %d %v", memberships, err)
+	}
+	if err := db.QueryRow("SELECT count(*) FROM role_permissions WHERE role_id = 1").Scan(&permissions); err != nil || permissions != 1 {
+		t.Fatalf("expected the role permission to survive, got %d %v", permissions, err)
+	}
+	rows, err := db.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		t.Fatalf("Failed to check foreign keys: %v", err)
+	}
+	defer rows.Close()
+	if rows.Next() {
+		t.Fatal("expected no foreign key violations")
+	}
+	var enabled int
+	if err := db.QueryRow("PRAGMA foreign_keys").Scan(&enabled); err != nil || enabled != 1 {
+		t.Fatalf("expected the connection to keep enforcing foreign keys, got %d %v", enabled, err)
+	}
+}
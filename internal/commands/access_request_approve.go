@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func AccessRequestApproveCommand() ubcli.Command {
+	const commandName = "access-request-approve"
+
+	var (
+		id         int64
+		approverId int64
+		expiresIn  time.Duration
+		comment    string
+	)
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&id, "id", 0, "ID of the access request")
+	flagset.Int64Var(&approverId, "approver", 0, "ID of the approving user, who must hold approve_access_requests in the organization")
+	flagset.DurationVar(&expiresIn, "expires-in", 0, "Time until the granted membership expires, such as 72h; zero never expires")
+	flagset.StringVar(&comment, "comment", "", "Comment for the requester")
+
+	accessRequestApprove := func(args []string) error {
+		agent := GetAgent()
+
+		// Prompt for missing required fields
+		id = maybeReadInt64Input("Access request ID: ", id)
+		approverId = maybeReadInt64Input("Approver ID: ", approverId)
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		command := ubmanage.AccessRequestApproveCommand{
+			Id:         id,
+			ApproverId: approverId,
+			Comment:    comment,
+		}
+		if expiresIn > 0 {
+			command.ExpiresAt = time.Now().Add(expiresIn)
+		}
+
+		service := app.GetManagementService()
+		response, err := service.AccessRequestApprove(context.Background(), command, agent)
+		if err != nil {
+			return err
+		}
+
+		if response.Status != ubstatus.Success {
+			return fmt.Errorf("failed to approve access request: %s %s", response.Status, response.Message)
+		}
+
+		fmt.Printf("Approved access request %d\n", id)
+		if !command.ExpiresAt.IsZero() {
+			fmt.Printf("The membership expires at %s\n", command.ExpiresAt.Format(time.RFC3339))
+		}
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "Approve an access request and add the user to the role",
+		Run:     accessRequestApprove,
+		FlagSet: flagset,
+	}
+}
@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func AccessRequestCreateCommand() ubcli.Command {
+	const commandName = "access-request-create"
+
+	var (
+		userId        int64
+		roleId        int64
+		justification string
+	)
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&userId, "user-id", 0, "ID of the user requesting the role")
+	flagset.Int64Var(&roleId, "role-id", 0, "ID of the role requested")
+	flagset.StringVar(&justification, "justification", "", "Why the user needs the role")
+
+	accessRequestCreate := func(args []string) error {
+		agent := GetAgent()
+
+		// Prompt for missing required fields
+		userId = maybeReadInt64Input("User ID: ", userId)
+		roleId = maybeReadInt64Input("Role ID: ", roleId)
+		justification = maybeReadInput("Justification: ", justification)
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		service := app.GetManagementService()
+		response, err := service.AccessRequestCreate(context.Background(), ubmanage.AccessRequestCreateCommand{
+			UserId:        userId,
+			RoleId:        roleId,
+			Justification: justification,
+		}, agent)
+		if err != nil {
+			return err
+		}
+
+		if response.Status != ubstatus.Success {
+			return fmt.Errorf("failed to request access: %s %s", response.Status, response.Message)
+		}
+
+		fmt.Printf("Created access request %d for user %d and role %d\n", response.Data.Id, userId, roleId)
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "Request a role for a user",
+		Run:     accessRequestCreate,
+		FlagSet: flagset,
+	}
+}
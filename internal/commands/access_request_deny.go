@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func AccessRequestDenyCommand() ubcli.Command {
+	const commandName = "access-request-deny"
+
+	var (
+		id         int64
+		approverId int64
+		comment    string
+	)
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&id, "id", 0, "ID of the access request")
+	flagset.Int64Var(&approverId, "approver", 0, "ID of the denying user, who must hold approve_access_requests in the organization")
+	flagset.StringVar(&comment, "comment", "", "Comment for the requester")
+
+	accessRequestDeny := func(args []string) error {
+		agent := GetAgent()
+
+		// Prompt for missing required fields
+		id = maybeReadInt64Input("Access request ID: ", id)
+		approverId = maybeReadInt64Input("Approver ID: ", approverId)
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		service := app.GetManagementService()
+		response, err := service.AccessRequestDeny(context.Background(), ubmanage.AccessRequestDenyCommand{
+			Id:         id,
+			ApproverId: approverId,
+			Comment:    comment,
+		}, agent)
+		if err != nil {
+			return err
+		}
+
+		if response.Status != ubstatus.Success {
+			return fmt.Errorf("failed to deny access request: %s %s", response.Status, response.Message)
+		}
+
+		fmt.Printf("Denied access request %d\n", id)
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "Deny an access request",
+		Run:     accessRequestDeny,
+		FlagSet: flagset,
+	}
+}
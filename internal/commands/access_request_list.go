@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubdata"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubresponse"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+	"github.com/olekukonko/tablewriter"
+)
+
+func AccessRequestListCommand() ubcli.Command {
+	const commandName = "access-request-list"
+
+	var (
+		organizationId int64
+		userId         int64
+		status         string
+	)
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&organizationId, "organization-id", 0, "ID of the organization whose requests to list")
+	flagset.Int64Var(&userId, "user-id", 0, "ID of the user whose requests to list, instead of an organization")
+	flagset.StringVar(&status, "status", ubmanage.AccessRequestPending, "Status of the organization's requests to list: pending, approved or denied")
+
+	accessRequestList := func(args []string) error {
+		if userId == 0 {
+			organizationId = maybeReadInt64Input("Organization ID: ", organizationId)
+		}
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		service := app.GetManagementService()
+		var (
+			response ubresponse.Response[[]ubdata.AccessRequest]
+			err      error
+		)
+		if userId != 0 {
+			response, err = service.AccessRequestListByUser(context.Background(), userId)
+		} else {
+			response, err = service.AccessRequestListByOrganization(context.Background(), organizationId, status)
+		}
+		if err != nil {
+			return err
+		}
+		if response.Status != ubstatus.Success {
+			return fmt.Errorf("failed to list access requests: %s", response.Status)
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header([]string{"ID", "Organization", "User", "Role", "Status", "Requested", "Decided By", "Expires", "Justification"})
+		for _, request := range response.Data {
+			expires := ""
+			if request.ExpiresAt != 0 {
+				expires = time.Unix(request.ExpiresAt, 0).Format(time.RFC3339)
+			}
+			table.Append([]string{
+				strconv.FormatInt(request.ID, 10),
+				request.OrganizationName,
+				request.UserEmail,
+				request.RoleName,
+				request.Status,
+				time.Unix(request.RequestedAt, 0).Format(time.RFC3339),
+				request.DecidedByName,
+				expires,
+				request.Justification,
+			})
+		}
+		table.Render()
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "List the access requests of an organization or a user",
+		Run:     accessRequestList,
+		FlagSet: flagset,
+	}
+}
@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func AccessReviewCloseCommand() ubcli.Command {
+	const commandName = "access-review-close"
+
+	var id int64
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&id, "id", 0, "ID of the access review")
+
+	accessReviewClose := func(args []string) error {
+		agent := GetAgent()
+
+		// Prompt for missing required fields
+		id = maybeReadInt64Input("Access review ID: ", id)
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		service := app.GetManagementService()
+		response, err := service.AccessReviewClose(context.Background(), ubmanage.AccessReviewCloseCommand{Id: id}, agent)
+		if err != nil {
+			return err
+		}
+
+		if response.Status != ubstatus.Success {
+			return fmt.Errorf("failed to close access review: %s %s", response.Status, response.Message)
+		}
+
+		fmt.Printf("Closed access review %d and revoked %d memberships\n", id, response.Data)
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "Close an access review and remove the revoked memberships",
+		Run:     accessReviewClose,
+		FlagSet: flagset,
+	}
+}
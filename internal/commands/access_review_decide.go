@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func AccessReviewDecideCommand() ubcli.Command {
+	const commandName = "access-review-decide"
+
+	var (
+		id         int64
+		userId     int64
+		roleId     int64
+		decision   string
+		reviewerId int64
+		comment    string
+	)
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&id, "id", 0, "ID of the access review")
+	flagset.Int64Var(&userId, "user-id", 0, "ID of the member")
+	flagset.Int64Var(&roleId, "role-id", 0, "ID of the role")
+	flagset.StringVar(&decision, "decision", "", "keep or revoke")
+	flagset.Int64Var(&reviewerId, "reviewer", 0, "ID of the reviewing user, who must hold review_access in the organization")
+	flagset.StringVar(&comment, "comment", "", "Reason for the decision")
+
+	accessReviewDecide := func(args []string) error {
+		agent := GetAgent()
+
+		// Prompt for missing required fields
+		id = maybeReadInt64Input("Access review ID: ", id)
+		userId = maybeReadInt64Input("User ID: ", userId)
+		roleId = maybeReadInt64Input("Role ID: ", roleId)
+		decision = maybeReadInput("Decision (keep or revoke): ", decision)
+		reviewerId = maybeReadInt64Input("Reviewer ID: ", reviewerId)
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		service := app.GetManagementService()
+		response, err := service.AccessReviewDecide(context.Background(), ubmanage.AccessReviewDecideCommand{
+			Id:         id,
+			UserId:     userId,
+			RoleId:     roleId,
+			Decision:   decision,
+			ReviewerId: reviewerId,
+			Comment:    comment,
+		}, agent)
+		if err != nil {
+			return err
+		}
+
+		if response.Status != ubstatus.Success {
+			return fmt.Errorf("failed to record decision: %s %s", response.Status, response.Message)
+		}
+
+		fmt.Printf("Recorded %s for user %d in role %d\n", decision, userId, roleId)
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "Keep or revoke a membership in an access review",
+		Run:     accessReviewDecide,
+		FlagSet: flagset,
+	}
+}
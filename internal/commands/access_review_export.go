@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func AccessReviewExportCommand() ubcli.Command {
+	const commandName = "access-review-export"
+
+	var (
+		id     int64
+		format string
+		output string
+	)
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&id, "id", 0, "ID of the access review")
+	flagset.StringVar(&format, "format", ubmanage.AccessReviewFormatCsv, "Report format: csv or json")
+	flagset.StringVar(&output, "output", "", "File to write the signed report to; defaults to standard output")
+
+	accessReviewExport := func(args []string) error {
+		// Prompt for missing required fields
+		id = maybeReadInt64Input("Access review ID: ", id)
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		service := app.GetManagementService()
+		response, err := service.AccessReviewExport(context.Background(), id, format)
+		if err != nil {
+			return err
+		}
+		if response.Status != ubstatus.Success {
+			return fmt.Errorf("failed to export access review: %s %s", response.Status, response.Message)
+		}
+
+		if output == "" {
+			_, err = os.Stdout.Write(response.Data.Data)
+			return err
+		}
+		if err := os.WriteFile(output, response.Data.Data, 0o600); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		fmt.Printf("Wrote the signed report to %s\n", output)
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "Export the signed report of an access review",
+		Run:     accessReviewExport,
+		FlagSet: flagset,
+	}
+}
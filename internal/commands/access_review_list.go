@@ -0,0 +1,110 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+	"github.com/olekukonko/tablewriter"
+)
+
+func AccessReviewListCommand() ubcli.Command {
+	const commandName = "access-review-list"
+
+	var (
+		organizationId int64
+		id             int64
+	)
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&organizationId, "organization-id", 0, "ID of the organization whose reviews to list")
+	flagset.Int64Var(&id, "id", 0, "ID of a review whose memberships to list, instead of an organization")
+
+	accessReviewList := func(args []string) error {
+		if id == 0 {
+			organizationId = maybeReadInt64Input("Organization ID: ", organizationId)
+		}
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		service := app.GetManagementService()
+		table := tablewriter.NewWriter(os.Stdout)
+		if id != 0 {
+			response, err := service.AccessReviewGet(context.Background(), id)
+			if err != nil {
+				return err
+			}
+			if response.Status != ubstatus.Success {
+				return fmt.Errorf("failed to get access review: %s", response.Status)
+			}
+			state := response.Data.State
+			memberships, err := service.AccessReviewMemberships(context.Background(), state.OrganizationId, state.Memberships)
+			if err != nil {
+				return err
+			}
+			if memberships.Status != ubstatus.Success {
+				return fmt.Errorf("failed to get access review memberships: %s", memberships.Status)
+			}
+			fmt.Printf("%s (%s): %d of %d memberships decided\n", state.Name, state.Status, state.Decided(), len(state.Memberships))
+			table.Header([]string{"User ID", "User", "Role ID", "Role", "Decision", "Reviewer", "Decided", "Comment"})
+			for _, membership := range memberships.Data {
+				decided := ""
+				if membership.DecidedAt != 0 {
+					decided = time.Unix(membership.DecidedAt, 0).Format(time.RFC3339)
+				}
+				table.Append([]string{
+					strconv.FormatInt(membership.UserId, 10),
+					membership.UserEmail,
+					strconv.FormatInt(membership.RoleId, 10),
+					membership.RoleName,
+					membership.Decision,
+					membership.ReviewerEmail,
+					decided,
+					membership.Comment,
+				})
+			}
+			table.Render()
+			return nil
+		}
+
+		response, err := service.AccessReviewListByOrganization(context.Background(), organizationId)
+		if err != nil {
+			return err
+		}
+		if response.Status != ubstatus.Success {
+			return fmt.Errorf("failed to list access reviews: %s", response.Status)
+		}
+		table.Header([]string{"ID", "Name", "Status", "Memberships", "Revoked", "Started", "Closed"})
+		for _, review := range response.Data {
+			closed := ""
+			if review.ClosedAt != 0 {
+				closed = time.Unix(review.ClosedAt, 0).Format(time.RFC3339)
+			}
+			table.Append([]string{
+				strconv.FormatInt(review.ID, 10),
+				review.Name,
+				review.Status,
+				strconv.FormatInt(review.MembershipCount, 10),
+				strconv.FormatInt(review.RevokedCount, 10),
+				time.Unix(review.StartedAt, 0).Format(time.RFC3339),
+				closed,
+			})
+		}
+		table.Render()
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "List the access reviews of an organization, or the memberships of a review",
+		Run:     accessReviewList,
+		FlagSet: flagset,
+	}
+}
@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func AccessReviewStartCommand() ubcli.Command {
+	const commandName = "access-review-start"
+
+	var (
+		organizationId int64
+		name           string
+	)
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&organizationId, "organization-id", 0, "ID of the organization whose role memberships to review")
+	flagset.StringVar(&name, "name", "", "Name of the review, such as 2025 Q3")
+
+	accessReviewStart := func(args []string) error {
+		agent := GetAgent()
+
+		// Prompt for missing required fields
+		organizationId = maybeReadInt64Input("Organization ID: ", organizationId)
+		name = maybeReadInput("Name: ", name)
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		service := app.GetManagementService()
+		response, err := service.AccessReviewStart(context.Background(), ubmanage.AccessReviewStartCommand{
+			OrganizationId: organizationId,
+			Name:           name,
+		}, agent)
+		if err != nil {
+			return err
+		}
+
+		if response.Status != ubstatus.Success {
+			return fmt.Errorf("failed to start access review: %s %s", response.Status, response.Message)
+		}
+
+		fmt.Printf("Started access review %d for organization %d\n", response.Data.Id, organizationId)
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "Start a review of every role membership of an organization",
+		Run:     accessReviewStart,
+		FlagSet: flagset,
+	}
+}
@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func AccessReviewVerifyCommand() ubcli.Command {
+	const commandName = "access-review-verify"
+
+	var file string
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.StringVar(&file, "file", "", "Exported CSV or JSON report to verify")
+
+	accessReviewVerify := func(args []string) error {
+		// Prompt for missing required fields
+		file = maybeReadInput("Report file: ", file)
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read report: %w", err)
+		}
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		service := app.GetManagementService()
+		response, err := service.AccessReviewVerifyExport(context.Background(), data)
+		if err != nil {
+			return err
+		}
+		if response.Status != ubstatus.Success {
+			return fmt.Errorf("failed to verify report: %s %s", response.Status, response.Message)
+		}
+		if !response.Data {
+			return fmt.Errorf("the report signature is not valid")
+		}
+
+		fmt.Println("The report signature is valid")
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "Verify the signature of an exported access review report",
+		Run:     accessReviewVerify,
+		FlagSet: flagset,
+	}
+}
@@ -24,6 +24,11 @@ func GetCommands(name string) *ubcli.CommandLine {
 	commandLine.Add(RoleListCommand())
 	commandLine.Add(RoleViewCommand())
 	commandLine.Add(RoleAddPermissionsCommand())
+	commandLine.Add(PermissionReportCommand())
+	commandLine.Add(ExclusiveRoleSetSaveCommand())
+	commandLine.Add(ExclusiveRoleSetRemoveCommand())
+	commandLine.Add(ExclusiveRoleReportCommand())
+	commandLine.Add(RoleTemplateSyncCommand())
 
 	// User commands
 	commandLine.Add(UserAddCommand())
@@ -34,13 +39,36 @@ func GetCommands(name string) *ubcli.CommandLine {
 	commandLine.Add(UserApiKeyAddCommand())
 	commandLine.Add(UserApiKeyDeleteCommand())
 	commandLine.Add(UserApiKeyListCommand())
+	commandLine.Add(UserApiKeyRotateCommand())
 	commandLine.Add(UserRemoveRoleCommand())
+	commandLine.Add(UserPermissionsCommand())
 	commandLine.Add(UserDisableCommand())
 	commandLine.Add(UserEnableCommand())
+	commandLine.Add(UserEraseCommand())
+	commandLine.Add(UserLoginHistoryCommand())
 	commandLine.Add(UserSetTwoFactorSharedSecretCommand())
 	commandLine.Add(UserSettingsSetCommand())
 	commandLine.Add(UserSettingsClearCommand())
 
+	// Access request commands
+	commandLine.Add(AccessRequestCreateCommand())
+	commandLine.Add(AccessRequestListCommand())
+	commandLine.Add(AccessRequestApproveCommand())
+	commandLine.Add(AccessRequestDenyCommand())
+
+	// Access review commands
+	commandLine.Add(AccessReviewStartCommand())
+	commandLine.Add(AccessReviewListCommand())
+	commandLine.Add(AccessReviewDecideCommand())
+	commandLine.Add(AccessReviewCloseCommand())
+	commandLine.Add(AccessReviewExportCommand())
+	commandLine.Add(AccessReviewVerifyCommand())
+
+	// Service account commands. Roles and API keys are managed with the
+	// user commands.
+	commandLine.Add(ServiceAccountAddCommand())
+	commandLine.Add(ServiceAccountListCommand())
+
 	// Serve command
 	commandLine.Add(ServeCommand())
 
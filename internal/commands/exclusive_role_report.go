@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+	"github.com/olekukonko/tablewriter"
+)
+
+func ExclusiveRoleReportCommand() ubcli.Command {
+	const commandName = "exclusive-role-report"
+
+	var organizationId int64
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&organizationId, "organization-id", 0, "ID of the organization")
+
+	exclusiveRoleReport := func(args []string) error {
+		// Prompt for missing required fields
+		organizationId = maybeReadInt64Input("Organization ID: ", organizationId)
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		service := app.GetManagementService()
+		ctx := context.Background()
+		organization, err := service.OrganizationGet(ctx, organizationId)
+		if err != nil {
+			return err
+		}
+		if organization.Status != ubstatus.Success {
+			return fmt.Errorf("failed to get organization: %s", organization.Status)
+		}
+		roles, err := service.RoleList(ctx, organizationId)
+		if err != nil {
+			return err
+		}
+		if roles.Status != ubstatus.Success {
+			return fmt.Errorf("failed to list roles: %s", roles.Status)
+		}
+		violations, err := service.OrganizationExclusiveRoleViolations(ctx, organizationId)
+		if err != nil {
+			return err
+		}
+		if violations.Status != ubstatus.Success {
+			return fmt.Errorf("failed to list exclusive role violations: %s", violations.Status)
+		}
+
+		sets := organization.Data.State.ExclusiveRoleSets
+		if len(sets) == 0 {
+			fmt.Println("The organization has no exclusive role sets")
+			return nil
+		}
+		fmt.Println("Exclusive role sets:")
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header([]string{"Set", "Roles"})
+		for _, set := range sets {
+			names := []string{}
+			for _, role := range roles.Data {
+				if slices.Contains(set.RoleIds, role.ID) {
+					names = append(names, role.SystemName)
+				}
+			}
+			table.Append([]string{set.Name, strings.Join(names, ", ")})
+		}
+		table.Render()
+
+		if len(violations.Data) == 0 {
+			fmt.Println("\nNo user holds more than one role of a set")
+			return nil
+		}
+		fmt.Println("\nViolations:")
+		table = tablewriter.NewWriter(os.Stdout)
+		table.Header([]string{"Set", "User ID", "User", "Roles"})
+		for _, violation := range violations.Data {
+			names := []string{}
+			for _, role := range violation.Roles {
+				names = append(names, role.SystemName)
+			}
+			table.Append([]string{
+				violation.SetName,
+				strconv.FormatInt(violation.UserId, 10),
+				violation.UserEmail,
+				strings.Join(names, ", "),
+			})
+		}
+		table.Render()
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "List an organization's exclusive role sets and the users holding more than one role of a set",
+		Run:     exclusiveRoleReport,
+		FlagSet: flagset,
+	}
+}
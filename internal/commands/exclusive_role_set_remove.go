@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func ExclusiveRoleSetRemoveCommand() ubcli.Command {
+	const commandName = "exclusive-role-set-remove"
+
+	var (
+		organizationId int64
+		name           string
+	)
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&organizationId, "organization-id", 0, "ID of the organization")
+	flagset.StringVar(&name, "name", "", "Name of the set")
+
+	exclusiveRoleSetRemove := func(args []string) error {
+		agent := GetAgent()
+
+		// Prompt for missing required fields
+		organizationId = maybeReadInt64Input("Organization ID: ", organizationId)
+		name = maybeReadInput("Name: ", name)
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		service := app.GetManagementService()
+		response, err := service.OrganizationExclusiveRoleSetRemove(context.Background(), ubmanage.OrganizationExclusiveRoleSetRemoveCommand{
+			OrganizationId: organizationId,
+			Name:           name,
+		}, agent)
+		if err != nil {
+			return err
+		}
+
+		if response.Status != ubstatus.Success {
+			return fmt.Errorf("failed to remove exclusive role set: %s %s", response.Status, response.Message)
+		}
+
+		fmt.Printf("Removed exclusive role set %q from organization %d\n", name, organizationId)
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "Remove an exclusive role set",
+		Run:     exclusiveRoleSetRemove,
+		FlagSet: flagset,
+	}
+}
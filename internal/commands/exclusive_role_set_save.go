@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func ExclusiveRoleSetSaveCommand() ubcli.Command {
+	const commandName = "exclusive-role-set-save"
+
+	var (
+		organizationId int64
+		name           string
+		roles          string
+	)
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&organizationId, "organization-id", 0, "ID of the organization")
+	flagset.StringVar(&name, "name", "", "Name of the set; saving an existing set replaces its roles")
+	flagset.StringVar(&roles, "roles", "", "Comma-separated system names of the roles no user may hold more than one of")
+
+	exclusiveRoleSetSave := func(args []string) error {
+		agent := GetAgent()
+
+		// Prompt for missing required fields
+		organizationId = maybeReadInt64Input("Organization ID: ", organizationId)
+		name = maybeReadInput("Name: ", name)
+		roles = maybeReadInput("Role system names (comma-separated): ", roles)
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		service := app.GetManagementService()
+		ctx := context.Background()
+		roleList, err := service.RoleList(ctx, organizationId)
+		if err != nil {
+			return err
+		}
+		if roleList.Status != ubstatus.Success {
+			return fmt.Errorf("failed to list roles: %s", roleList.Status)
+		}
+		roleIds := make([]int64, 0)
+		for _, systemName := range parseCSVKeys(roles) {
+			found := false
+			for _, role := range roleList.Data {
+				if role.SystemName == systemName {
+					roleIds = append(roleIds, role.ID)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("organization %d has no role %q", organizationId, systemName)
+			}
+		}
+
+		response, err := service.OrganizationExclusiveRoleSetSave(ctx, ubmanage.OrganizationExclusiveRoleSetSaveCommand{
+			OrganizationId: organizationId,
+			Name:           name,
+			RoleIds:        roleIds,
+		}, agent)
+		if err != nil {
+			return err
+		}
+
+		if response.Status != ubstatus.Success {
+			return fmt.Errorf("failed to save exclusive role set: %s %s %v", response.Status, response.Message, response.ValidationIssues)
+		}
+
+		fmt.Printf("Saved exclusive role set %q for organization %d\n", name, organizationId)
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "Create or replace a set of roles no user may hold more than one of",
+		Run:     exclusiveRoleSetSave,
+		FlagSet: flagset,
+	}
+}
@@ -16,10 +16,12 @@ func OrganizationAddCommand() ubcli.Command {
 
 	var name string
 	var systemName string
+	var roleTemplates bool
 
 	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
 	flagset.StringVar(&systemName, "system-name", "", "System name of the organization")
 	flagset.StringVar(&name, "name", "", "Name of the organization")
+	flagset.BoolVar(&roleTemplates, "role-templates", false, "Create the role templates' roles in the organization")
 
 	organizationAdd := func(args []string) error {
 		agent := GetAgent()
@@ -30,9 +32,10 @@ func OrganizationAddCommand() ubcli.Command {
 		systemName = maybeReadInput("System name: ", systemName)
 
 		organizationAddCommand := ubmanage.OrganizationCreateCommand{
-			Name:       name,
-			SystemName: systemName,
-			Status:     "active",
+			Name:               name,
+			SystemName:         systemName,
+			Status:             "active",
+			ApplyRoleTemplates: roleTemplates,
 		}
 
 		service := app.GetManagementService()
@@ -43,7 +46,7 @@ func OrganizationAddCommand() ubcli.Command {
 		}
 
 		if response.Status != ubstatus.Success {
-			return fmt.Errorf("failed to add organization: %s", response.Status)
+			return fmt.Errorf("failed to add organization: %s %v", response.Status, response.ValidationIssues)
 		}
 		fmt.Printf("Organization Id: %d added.\n", response.Data.Id)
 		return nil
@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/kernelplex/ubase/lib/ubadminpanel"
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+	"github.com/olekukonko/tablewriter"
+)
+
+func PermissionReportCommand() ubcli.Command {
+	const commandName = "permission-report"
+
+	var catalogFile string
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.StringVar(&catalogFile, "catalog", "", "JSON file with an array of permission definitions (name, display_name, description, group, dangerous) declared by the application")
+
+	permissionReport := func(args []string) error {
+		definitions := slices.Clone(ubadminpanel.Permissions)
+		if catalogFile != "" {
+			data, err := os.ReadFile(catalogFile)
+			if err != nil {
+				return fmt.Errorf("failed to read catalog: %w", err)
+			}
+			var declared []ubmanage.PermissionDefinition
+			if err := json.Unmarshal(data, &declared); err != nil {
+				return fmt.Errorf("failed to parse catalog: %w", err)
+			}
+			for _, definition := range declared {
+				if definition.Name == "" {
+					return fmt.Errorf("catalog has a permission without a name")
+				}
+			}
+			definitions = append(definitions, declared...)
+		}
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+		app.WithPermissions(definitions...)
+
+		service := app.GetManagementService()
+		response, err := service.PermissionReport(context.Background())
+		if err != nil {
+			return err
+		}
+		if response.Status != ubstatus.Success {
+			return fmt.Errorf("failed to build permission report: %s", response.Status)
+		}
+
+		if len(response.Data.Unknown) > 0 {
+			fmt.Println("Undeclared permissions held by roles:")
+			table := tablewriter.NewWriter(os.Stdout)
+			table.Header([]string{"Organization ID", "Role ID", "Role", "Permission"})
+			for _, held := range response.Data.Unknown {
+				table.Append([]string{
+					strconv.FormatInt(held.OrganizationId, 10),
+					strconv.FormatInt(held.RoleId, 10),
+					held.RoleName,
+					held.Permission,
+				})
+			}
+			table.Render()
+		} else {
+			fmt.Println("No roles hold undeclared permissions")
+		}
+
+		if len(response.Data.Unused) > 0 {
+			fmt.Println("\nDeclared permissions no role holds:")
+			table := tablewriter.NewWriter(os.Stdout)
+			table.Header([]string{"Permission", "Name", "Group"})
+			for _, definition := range response.Data.Unused {
+				table.Append([]string{definition.Name, definition.Title(), definition.Group})
+			}
+			table.Render()
+		}
+
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "Report role permissions missing from the permission catalog",
+		Run:     permissionReport,
+		FlagSet: flagset,
+	}
+}
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func RoleTemplateSyncCommand() ubcli.Command {
+	const commandName = "role-template-sync"
+
+	var organizationId int64
+	var prune bool
+	var dryRun bool
+	var yes bool
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&organizationId, "organization-id", 0, "ID of the organization to sync (all organizations when omitted)")
+	flagset.BoolVar(&prune, "prune", false, "Revoke permissions the templates do not list")
+	flagset.BoolVar(&dryRun, "dry-run", false, "Only show the changes")
+	flagset.BoolVar(&yes, "yes", false, "Apply the changes without asking")
+
+	roleTemplateSync := func(args []string) error {
+		agent := GetAgent()
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		service := app.GetManagementService()
+		ctx := context.Background()
+
+		command := ubmanage.RoleTemplatesSyncCommand{Prune: prune, DryRun: true}
+		if organizationId != 0 {
+			command.OrganizationIds = []int64{organizationId}
+		}
+		preview, err := service.RoleTemplatesSync(ctx, command, agent)
+		if err != nil {
+			return err
+		}
+		if preview.Status != ubstatus.Success {
+			return fmt.Errorf("failed to diff role templates: %s %s %v", preview.Status, preview.Message, preview.ValidationIssues)
+		}
+
+		if len(preview.Data) == 0 {
+			fmt.Println("Roles already match the templates")
+			return nil
+		}
+		for _, change := range preview.Data {
+			fmt.Println(change.String())
+		}
+		if dryRun {
+			return nil
+		}
+		if !yes {
+			fmt.Printf("Apply %d changes? [y/N] ", len(preview.Data))
+			answer, err := readLine()
+			if err != nil {
+				return err
+			}
+			if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+				fmt.Println("No changes made")
+				return nil
+			}
+		}
+
+		// The sync diffs again, so changes made since the preview are included.
+		command.DryRun = false
+		response, err := service.RoleTemplatesSync(ctx, command, agent)
+		if err != nil {
+			return err
+		}
+		if response.Status != ubstatus.Success {
+			return fmt.Errorf("failed to sync role templates: %s %s %v", response.Status, response.Message, response.ValidationIssues)
+		}
+		fmt.Printf("Applied %d changes\n", len(response.Data))
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "Push role template changes to existing organizations, showing the diff first",
+		Run:     roleTemplateSync,
+		FlagSet: flagset,
+	}
+}
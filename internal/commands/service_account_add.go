@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func ServiceAccountAddCommand() ubcli.Command {
+	const commandName = "service-account-add"
+
+	var (
+		organizationID int64
+		name           string
+		description    string
+	)
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&organizationID, "organization-id", 0, "ID of the organization that owns the service account")
+	flagset.StringVar(&name, "name", "", "Name of the service account")
+	flagset.StringVar(&description, "description", "", "Description of the service account")
+
+	serviceAccountAdd := func(args []string) error {
+		agent := GetAgent()
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		organizationID = maybeReadInt64Input("Organization ID: ", organizationID)
+		name = maybeReadInput("Name: ", name)
+
+		command := ubmanage.ServiceAccountCreateCommand{
+			OrganizationId: organizationID,
+			Name:           name,
+			Description:    description,
+		}
+
+		service := app.GetManagementService()
+		response, err := service.ServiceAccountAdd(context.Background(), command, agent)
+		if err != nil {
+			return err
+		}
+
+		if response.Status != ubstatus.Success {
+			return fmt.Errorf("failed to add service account: %s %s", response.Status, response.Message)
+		}
+		fmt.Printf("Service account Id: %d added.\n", response.Data.Id)
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "Add a service account owned by an organization",
+		Run:     serviceAccountAdd,
+		FlagSet: flagset,
+	}
+}
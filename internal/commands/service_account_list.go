@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+	"github.com/olekukonko/tablewriter"
+)
+
+func ServiceAccountListCommand() ubcli.Command {
+	const commandName = "service-account-list"
+
+	var organizationID int64
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&organizationID, "organization-id", 0, "Only list service accounts owned by this organization")
+
+	serviceAccountList := func(args []string) error {
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		service := app.GetManagementService()
+		response, err := service.ServiceAccountList(context.Background(), organizationID)
+		if err != nil {
+			return err
+		}
+
+		if response.Status != ubstatus.Success {
+			return fmt.Errorf("failed to list service accounts: %s", response.Status)
+		}
+
+		columnNames := []string{"ID", "Name", "Organization ID", "Organization", "Created At"}
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header(columnNames)
+		for _, account := range response.Data {
+			table.Append([]string{
+				strconv.FormatInt(account.UserID, 10),
+				account.Name,
+				strconv.FormatInt(account.OrganizationID, 10),
+				account.Organization,
+				account.CreatedAt.Format("2006-01-02 15:04:05"),
+			})
+		}
+
+		table.Render()
+
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "List service accounts",
+		Run:     serviceAccountList,
+		FlagSet: flagset,
+	}
+}
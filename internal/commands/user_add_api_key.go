@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/kernelplex/ubase/lib/ubapp"
@@ -20,6 +21,8 @@ func UserApiKeyAddCommand() ubcli.Command {
 		organizationID int64
 		name           string
 		expiryDays     int64
+		scopes         string
+		allowedCidrs   string
 	)
 
 	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
@@ -27,6 +30,8 @@ func UserApiKeyAddCommand() ubcli.Command {
 	flagset.Int64Var(&organizationID, "organization-id", 0, "Organization ID")
 	flagset.StringVar(&name, "name", "", "API key name")
 	flagset.Int64Var(&expiryDays, "expiry-days", 365, "Number of days until the API key expires")
+	flagset.StringVar(&scopes, "scopes", "", "Comma separated permissions or wildcard scopes such as reports:* (default: all of the user's permissions)")
+	flagset.StringVar(&allowedCidrs, "allowed-cidrs", "", "Comma separated CIDR ranges or addresses the key may be used from (default: anywhere)")
 
 	userApiKeyAdd := func(args []string) error {
 		agent := GetAgent()
@@ -48,6 +53,12 @@ func UserApiKeyAddCommand() ubcli.Command {
 			OrganizationId: organizationID,
 			ExpiresAt:      expiresAt,
 		}
+		if scopes != "" {
+			command.Scopes = strings.Split(scopes, ",")
+		}
+		if allowedCidrs != "" {
+			command.AllowedCidrs = strings.Split(allowedCidrs, ",")
+		}
 
 		service := app.GetManagementService()
 		response, err := service.UserGenerateApiKey(context.Background(), command, agent)
@@ -56,6 +67,9 @@ func UserApiKeyAddCommand() ubcli.Command {
 		}
 
 		if response.Status != ubstatus.Success {
+			for _, issue := range response.ValidationIssues {
+				fmt.Printf("%s: %s\n", issue.Field, strings.Join(issue.Error, ", "))
+			}
 			return fmt.Errorf("failed to generate API key: %s", response.Status)
 		}
 
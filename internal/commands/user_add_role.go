@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"time"
 
 	"github.com/kernelplex/ubase/lib/ubapp"
 	"github.com/kernelplex/ubase/lib/ubcli"
@@ -15,13 +16,17 @@ func UserAddRoleCommand() ubcli.Command {
 	const commandName = "user-add-role"
 
 	var (
-		userId int64
-		roleId int64
+		userId    int64
+		roleId    int64
+		startsIn  time.Duration
+		expiresIn time.Duration
 	)
 
 	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
 	flagset.Int64Var(&userId, "user-id", 0, "ID of the user to add to role")
 	flagset.Int64Var(&roleId, "role-id", 0, "ID of the role to add user to")
+	flagset.DurationVar(&startsIn, "starts-in", 0, "Delay before the membership takes effect, such as 24h")
+	flagset.DurationVar(&expiresIn, "expires-in", 0, "Time until the membership expires, such as 72h; zero never expires")
 
 	userAddRole := func(args []string) error {
 		agent := GetAgent()
@@ -37,6 +42,13 @@ func UserAddRoleCommand() ubcli.Command {
 			UserId: userId,
 			RoleId: roleId,
 		}
+		now := time.Now()
+		if startsIn > 0 {
+			command.NotBefore = now.Add(startsIn)
+		}
+		if expiresIn > 0 {
+			command.ExpiresAt = now.Add(expiresIn)
+		}
 
 		service := app.GetManagementService()
 		response, err := service.UserAddToRole(context.Background(), command, agent)
@@ -45,10 +57,13 @@ func UserAddRoleCommand() ubcli.Command {
 		}
 
 		if response.Status != ubstatus.Success {
-			return fmt.Errorf("failed to add user to role: %s", response.Status)
+			return fmt.Errorf("failed to add user to role: %s %s", response.Status, response.Message)
 		}
 
 		fmt.Printf("Successfully added user %d to role %d\n", userId, roleId)
+		if !command.ExpiresAt.IsZero() {
+			fmt.Printf("The membership expires at %s\n", command.ExpiresAt.Format(time.RFC3339))
+		}
 		return nil
 	}
 
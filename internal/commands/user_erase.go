@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func UserEraseCommand() ubcli.Command {
+	const commandName = "user-erase"
+
+	var userId int64
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&userId, "user-id", 0, "ID of the user to erase")
+
+	userErase := func(args []string) error {
+		agent := GetAgent()
+
+		// Prompt for missing required field
+		userId = maybeReadInt64Input("User ID: ", userId)
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		command := ubmanage.UserEraseCommand{
+			Id: userId,
+		}
+
+		service := app.GetManagementService()
+		response, err := service.UserErase(context.Background(), command, agent)
+		if err != nil {
+			return err
+		}
+
+		if response.Status != ubstatus.Success {
+			return fmt.Errorf("failed to erase user: %s", response.Message)
+		}
+
+		fmt.Printf("Successfully erased user %d\n", userId)
+		if response.Message != "" {
+			fmt.Println(response.Message)
+		}
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "Erase a user and destroy their personal data",
+		Run:     userErase,
+		FlagSet: flagset,
+	}
+}
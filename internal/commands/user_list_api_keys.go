@@ -4,6 +4,7 @@ import (
     "context"
     "flag"
     "fmt"
+    "strings"
     "time"
 
     "github.com/kernelplex/ubase/lib/ubapp"
@@ -41,13 +42,25 @@ func UserApiKeyListCommand() ubcli.Command {
         }
 
         fmt.Printf("Found %d API key(s):\n", len(apiKeys))
-        fmt.Println("ID           | Name                  | OrgID | Created At          | Expires At")
-        fmt.Println("-------------+-----------------------+-------+---------------------+---------------------")
+        fmt.Println("ID           | Name                  | OrgID | Created At          | Expires At          | Last Used At        | Last IP         | Scopes | Allowed From | Replaced By")
+        fmt.Println("-------------+-----------------------+-------+---------------------+---------------------+---------------------+-----------------+--------+--------------+------------")
         for _, k := range apiKeys {
             created := k.CreatedAt.Format(time.RFC3339)
             expires := k.ExpiresAt.Format(time.RFC3339)
-            fmt.Printf("%-12s | %-21s | %-5d | %-19s | %-19s\n",
-                k.Id, k.Name, k.OrganizationID, created, expires)
+            lastUsed := "-"
+            if !k.LastUsedAt.IsZero() {
+                lastUsed = k.LastUsedAt.Format(time.RFC3339)
+            }
+            scopes := "all"
+            if len(k.Scopes) > 0 {
+                scopes = strings.Join(k.Scopes, ",")
+            }
+            allowed := "anywhere"
+            if len(k.AllowedCidrs) > 0 {
+                allowed = strings.Join(k.AllowedCidrs, ",")
+            }
+            fmt.Printf("%-12s | %-21s | %-5d | %-19s | %-19s | %-19s | %-15s | %s | %s | %s\n",
+                k.Id, k.Name, k.OrganizationID, created, expires, lastUsed, k.LastUsedIp, scopes, allowed, k.ReplacedBy)
         }
         return nil
     }
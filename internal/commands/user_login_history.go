@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubdata"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func UserLoginHistoryCommand() ubcli.Command {
+	const commandName = "user-login-history"
+
+	var (
+		userId    int64
+		ipAddress string
+		limit     int
+	)
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&userId, "user-id", 0, "Show logins for this user")
+	flagset.StringVar(&ipAddress, "ip", "", "Show logins from this IP address or prefix across all users")
+	flagset.IntVar(&limit, "limit", 50, "Maximum number of logins to show")
+
+	userLoginHistory := func(args []string) error {
+		if userId == 0 && ipAddress == "" {
+			return fmt.Errorf("either --user-id or --ip is required")
+		}
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		mgmt := app.GetManagementService()
+		ctx := context.Background()
+
+		var logins []ubdata.UserLogin
+		if ipAddress != "" {
+			resp, err := mgmt.UserLoginsByIp(ctx, ipAddress, limit, 0)
+			if err != nil {
+				return fmt.Errorf("failed to search logins: %w", err)
+			}
+			if resp.Status != ubstatus.Success {
+				return fmt.Errorf("failed to search logins: %s", resp.Message)
+			}
+			logins = resp.Data
+		} else {
+			resp, err := mgmt.UserLoginHistory(ctx, userId, limit, 0)
+			if err != nil {
+				return fmt.Errorf("failed to list logins: %w", err)
+			}
+			if resp.Status != ubstatus.Success {
+				return fmt.Errorf("failed to list logins: %s", resp.Message)
+			}
+			logins = resp.Data
+		}
+
+		if len(logins) == 0 {
+			fmt.Println("No logins found.")
+			return nil
+		}
+
+		fmt.Printf("Found %d login(s):\n", len(logins))
+		fmt.Println("When                 | User ID | Outcome   | IP Address      | Device   | Reason")
+		fmt.Println("---------------------+---------+-----------+-----------------+----------+------------------------")
+		for _, l := range logins {
+			device := l.DeviceId
+			if len(device) > 8 {
+				device = device[:8]
+			}
+			fmt.Printf("%-20s | %-7d | %-9s | %-15s | %-8s | %s\n",
+				time.Unix(l.OccurredAt, 0).UTC().Format(time.RFC3339),
+				l.UserID, l.Outcome, l.IpAddress, device, l.Reason)
+		}
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "List login history for a user, or search logins by IP address",
+		Run:     userLoginHistory,
+		FlagSet: flagset,
+	}
+}
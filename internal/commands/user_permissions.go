@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/olekukonko/tablewriter"
+)
+
+func UserPermissionsCommand() ubcli.Command {
+	const commandName = "user-permissions"
+
+	var userId int64
+	var organizationId int64
+	var permission string
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&userId, "user-id", 0, "ID of the user")
+	flagset.Int64Var(&organizationId, "organization-id", 0, "ID of the organization")
+	flagset.StringVar(&permission, "permission", "", "Only explain this permission")
+
+	userPermissions := func(args []string) error {
+		if userId == 0 {
+			return fmt.Errorf("user-id is required")
+		}
+		if organizationId == 0 {
+			return fmt.Errorf("organization-id is required")
+		}
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		prefect := app.GetPrefectService()
+		if err := prefect.Start(); err != nil {
+			return fmt.Errorf("failed to start prefect service: %w", err)
+		}
+		defer prefect.Stop()
+
+		explanation, err := prefect.ExplainPermissions(context.Background(), userId, organizationId, permission)
+		if err != nil {
+			return err
+		}
+		if explanation.Excluded != "" {
+			fmt.Println(explanation.Excluded)
+		}
+		if len(explanation.Grants) == 0 {
+			if permission != "" {
+				fmt.Printf("The user does not hold %s in organization %d\n", permission, organizationId)
+			} else {
+				fmt.Printf("The user holds no permissions in organization %d\n", organizationId)
+			}
+			return nil
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header([]string{"Permission", "Role ID", "Role", "Source", "Expires", "Policy"})
+		for _, grant := range explanation.Grants {
+			expires := ""
+			if grant.ExpiresAt != 0 {
+				expires = time.Unix(grant.ExpiresAt, 0).Format(time.RFC3339)
+			}
+			table.Append([]string{
+				grant.Permission,
+				strconv.FormatInt(grant.RoleId, 10),
+				grant.RoleName,
+				grant.SourceDescription(),
+				expires,
+				grant.Policy,
+			})
+		}
+		table.Render()
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "Explain which roles grant a user's permissions in an organization",
+		Run:     userPermissions,
+		FlagSet: flagset,
+	}
+}
@@ -0,0 +1,66 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubapp"
+	"github.com/kernelplex/ubase/lib/ubcli"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func UserApiKeyRotateCommand() ubcli.Command {
+	const commandName = "user-api-key-rotate"
+
+	var (
+		userID     int64
+		apiKeyID   string
+		graceHours int64
+	)
+
+	flagset := flag.NewFlagSet(commandName, flag.ExitOnError)
+	flagset.Int64Var(&userID, "user-id", 0, "User ID")
+	flagset.StringVar(&apiKeyID, "api-key-id", "", "ID of the API key to rotate (the first 10 characters of the key)")
+	flagset.Int64Var(&graceHours, "grace-hours", int64(ubmanage.DefaultApiKeyRotationGracePeriod/time.Hour), "Hours the old key keeps working")
+
+	userApiKeyRotate := func(args []string) error {
+		agent := GetAgent()
+
+		app := ubapp.NewUbaseAppEnvConfig()
+		defer app.Shutdown()
+
+		userID = maybeReadInt64Input("User ID: ", userID)
+		apiKeyID = maybeReadInput("API Key ID: ", apiKeyID)
+
+		command := ubmanage.UserRotateApiKeyCommand{
+			UserId:      userID,
+			ApiKeyId:    apiKeyID,
+			GracePeriod: time.Duration(graceHours) * time.Hour,
+		}
+
+		service := app.GetManagementService()
+		response, err := service.UserRotateApiKey(context.Background(), command, agent)
+		if err != nil {
+			return err
+		}
+
+		if response.Status != ubstatus.Success {
+			return fmt.Errorf("failed to rotate API key: %s %s", response.Status, response.Message)
+		}
+
+		fmt.Printf("Replacement API Key: %s\n", response.Data)
+		fmt.Printf("The old key keeps working for %d hour(s) or until it expires.\n", graceHours)
+		fmt.Println("Note: This is the only time the full API key will be shown. Make sure to save it securely.")
+		return nil
+	}
+
+	return ubcli.Command{
+		Name:    commandName,
+		Help:    "Issue a replacement API key; the old key keeps working for a grace period",
+		Run:     userApiKeyRotate,
+		FlagSet: flagset,
+	}
+}
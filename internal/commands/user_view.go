@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/kernelplex/ubase/lib/ubapp"
 	"github.com/kernelplex/ubase/lib/ubcli"
@@ -41,6 +42,10 @@ func UserViewCommand() ubcli.Command {
 
 		// Print user details
 		fmt.Printf("User ID: %d\n", response.Data.Id)
+		if response.Data.State.Erased {
+			fmt.Printf("Erased: %s\n", time.Unix(response.Data.State.ErasedAt, 0).UTC().Format(time.RFC3339))
+			return nil
+		}
 		fmt.Printf("Email: %s\n", response.Data.State.Email)
 		fmt.Printf("First Name: %s\n", response.Data.State.FirstName)
 		fmt.Printf("Last Name: %s\n", response.Data.State.LastName)
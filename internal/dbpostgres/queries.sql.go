@@ -11,6 +11,60 @@ import (
 	"time"
 )
 
+const addAccessRequest = `-- name: AddAccessRequest :exec
+INSERT INTO access_requests (id, organization_id, user_id, role_id, justification, status, requested_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+`
+
+type AddAccessRequestParams struct {
+	ID             int64
+	OrganizationID int64
+	UserID         int64
+	RoleID         int64
+	Justification  string
+	Status         string
+	RequestedAt    int64
+}
+
+func (q *Queries) AddAccessRequest(ctx context.Context, arg AddAccessRequestParams) error {
+	_, err := q.db.ExecContext(ctx, addAccessRequest,
+		arg.ID,
+		arg.OrganizationID,
+		arg.UserID,
+		arg.RoleID,
+		arg.Justification,
+		arg.Status,
+		arg.RequestedAt,
+	)
+	return err
+}
+
+const addAccessReview = `-- name: AddAccessReview :exec
+INSERT INTO access_reviews (id, organization_id, name, status, started_at, membership_count)
+VALUES ($1, $2, $3, $4, $5, $6)
+`
+
+type AddAccessReviewParams struct {
+	ID              int64
+	OrganizationID  int64
+	Name            string
+	Status          string
+	StartedAt       int64
+	MembershipCount int64
+}
+
+func (q *Queries) AddAccessReview(ctx context.Context, arg AddAccessReviewParams) error {
+	_, err := q.db.ExecContext(ctx, addAccessReview,
+		arg.ID,
+		arg.OrganizationID,
+		arg.Name,
+		arg.Status,
+		arg.StartedAt,
+		arg.MembershipCount,
+	)
+	return err
+}
+
 const addOrganization = `-- name: AddOrganization :exec
 INSERT INTO organizations (id, name, system_name, status) 
 VALUES ($1, $2, $3, $4)
@@ -53,6 +107,33 @@ func (q *Queries) AddPermissionToRole(ctx context.Context, arg AddPermissionToRo
 	return err
 }
 
+const addRelationTuple = `-- name: AddRelationTuple :exec
+INSERT INTO relation_tuples (object_type, object_id, relation, subject_type, subject_id, subject_relation)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT DO NOTHING
+`
+
+type AddRelationTupleParams struct {
+	ObjectType      string
+	ObjectID        string
+	Relation        string
+	SubjectType     string
+	SubjectID       string
+	SubjectRelation string
+}
+
+func (q *Queries) AddRelationTuple(ctx context.Context, arg AddRelationTupleParams) error {
+	_, err := q.db.ExecContext(ctx, addRelationTuple,
+		arg.ObjectType,
+		arg.ObjectID,
+		arg.Relation,
+		arg.SubjectType,
+		arg.SubjectID,
+		arg.SubjectRelation,
+	)
+	return err
+}
+
 const addRole = `-- name: AddRole :exec
 
 INSERT INTO roles (id, organization_id, name, system_name) 
@@ -96,6 +177,32 @@ func (q *Queries) AddRoleToUser(ctx context.Context, arg AddRoleToUserParams) er
 	return err
 }
 
+const addServiceAccount = `-- name: AddServiceAccount :exec
+INSERT INTO users (id, first_name, last_name, display_name, email, verified, created_at, updated_at, service_account, owner_organization_id)
+VALUES ($1, '', '', $2, $3, TRUE, $4, $5, TRUE, $6)
+`
+
+type AddServiceAccountParams struct {
+	ID                  int64
+	DisplayName         string
+	Email               string
+	CreatedAt           sql.NullTime
+	UpdatedAt           sql.NullTime
+	OwnerOrganizationID sql.NullInt64
+}
+
+func (q *Queries) AddServiceAccount(ctx context.Context, arg AddServiceAccountParams) error {
+	_, err := q.db.ExecContext(ctx, addServiceAccount,
+		arg.ID,
+		arg.DisplayName,
+		arg.Email,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.OwnerOrganizationID,
+	)
+	return err
+}
+
 const addUser = `-- name: AddUser :exec
 
 INSERT INTO users (id, first_name, last_name, display_name, email, verified, created_at, updated_at) 
@@ -132,18 +239,163 @@ func (q *Queries) AddUser(ctx context.Context, arg AddUserParams) error {
 	return err
 }
 
+const addUserLogin = `-- name: AddUserLogin :exec
+INSERT INTO user_logins (user_id, occurred_at, outcome, reason, ip_address, user_agent, device_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+`
+
+type AddUserLoginParams struct {
+	UserID     int64
+	OccurredAt int64
+	Outcome    string
+	Reason     string
+	IpAddress  string
+	UserAgent  string
+	DeviceID   string
+}
+
+func (q *Queries) AddUserLogin(ctx context.Context, arg AddUserLoginParams) error {
+	_, err := q.db.ExecContext(ctx, addUserLogin,
+		arg.UserID,
+		arg.OccurredAt,
+		arg.Outcome,
+		arg.Reason,
+		arg.IpAddress,
+		arg.UserAgent,
+		arg.DeviceID,
+	)
+	return err
+}
+
 const addUserToRole = `-- name: AddUserToRole :exec
-INSERT INTO user_roles (user_id, role_id) 
-VALUES ($1, $2)
+INSERT INTO user_roles (user_id, role_id, not_before, expires_at, granted_at, access_request_id)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (user_id, role_id) DO UPDATE SET not_before = excluded.not_before, expires_at = excluded.expires_at, granted_at = excluded.granted_at, access_request_id = excluded.access_request_id
 `
 
 type AddUserToRoleParams struct {
+	UserID          int64
+	RoleID          int64
+	NotBefore       int64
+	ExpiresAt       int64
+	GrantedAt       int64
+	AccessRequestID int64
+}
+
+func (q *Queries) AddUserToRole(ctx context.Context, arg AddUserToRoleParams) error {
+	_, err := q.db.ExecContext(ctx, addUserToRole,
+		arg.UserID,
+		arg.RoleID,
+		arg.NotBefore,
+		arg.ExpiresAt,
+		arg.GrantedAt,
+		arg.AccessRequestID,
+	)
+	return err
+}
+
+const closeAccessReview = `-- name: CloseAccessReview :exec
+UPDATE access_reviews
+SET status = $1, closed_at = $2, revoked_count = $3
+WHERE id = $4
+`
+
+type CloseAccessReviewParams struct {
+	Status       string
+	ClosedAt     int64
+	RevokedCount int64
+	ID           int64
+}
+
+func (q *Queries) CloseAccessReview(ctx context.Context, arg CloseAccessReviewParams) error {
+	_, err := q.db.ExecContext(ctx, closeAccessReview,
+		arg.Status,
+		arg.ClosedAt,
+		arg.RevokedCount,
+		arg.ID,
+	)
+	return err
+}
+
+const countUserRoleAccessRequests = `-- name: CountUserRoleAccessRequests :one
+SELECT COUNT(*) AS count FROM access_requests
+WHERE user_id = $1 AND role_id = $2 AND status = $3
+`
+
+type CountUserRoleAccessRequestsParams struct {
 	UserID int64
 	RoleID int64
+	Status string
 }
 
-func (q *Queries) AddUserToRole(ctx context.Context, arg AddUserToRoleParams) error {
-	_, err := q.db.ExecContext(ctx, addUserToRole, arg.UserID, arg.RoleID)
+func (q *Queries) CountUserRoleAccessRequests(ctx context.Context, arg CountUserRoleAccessRequestsParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUserRoleAccessRequests, arg.UserID, arg.RoleID, arg.Status)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const decideAccessRequest = `-- name: DecideAccessRequest :exec
+UPDATE access_requests
+SET status = $1, decided_by = $2, decided_at = $3, comment = $4, expires_at = $5
+WHERE id = $6
+`
+
+type DecideAccessRequestParams struct {
+	Status    string
+	DecidedBy int64
+	DecidedAt int64
+	Comment   string
+	ExpiresAt int64
+	ID        int64
+}
+
+func (q *Queries) DecideAccessRequest(ctx context.Context, arg DecideAccessRequestParams) error {
+	_, err := q.db.ExecContext(ctx, decideAccessRequest,
+		arg.Status,
+		arg.DecidedBy,
+		arg.DecidedAt,
+		arg.Comment,
+		arg.ExpiresAt,
+		arg.ID,
+	)
+	return err
+}
+
+const deleteExpiredRateLimits = `-- name: DeleteExpiredRateLimits :exec
+DELETE FROM rate_limits
+WHERE expires_at < $1
+`
+
+func (q *Queries) DeleteExpiredRateLimits(ctx context.Context, before int64) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredRateLimits, before)
+	return err
+}
+
+const deleteRelationTuple = `-- name: DeleteRelationTuple :exec
+DELETE FROM relation_tuples
+WHERE object_type = $1 AND object_id = $2 AND relation = $3
+  AND subject_type = $4 AND subject_id = $5 AND subject_relation = $6
+`
+
+type DeleteRelationTupleParams struct {
+	ObjectType      string
+	ObjectID        string
+	Relation        string
+	SubjectType     string
+	SubjectID       string
+	SubjectRelation string
+}
+
+func (q *Queries) DeleteRelationTuple(ctx context.Context, arg DeleteRelationTupleParams) error {
+	_, err := q.db.ExecContext(ctx, deleteRelationTuple,
+		arg.ObjectType,
+		arg.ObjectID,
+		arg.Relation,
+		arg.SubjectType,
+		arg.SubjectID,
+		arg.SubjectRelation,
+	)
 	return err
 }
 
@@ -156,8 +408,83 @@ func (q *Queries) DeleteRole(ctx context.Context, id int64) error {
 	return err
 }
 
+const deleteUser = `-- name: DeleteUser :exec
+DELETE FROM users WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deleteUser, id)
+	return err
+}
+
+const deleteUserLogins = `-- name: DeleteUserLogins :exec
+DELETE FROM user_logins
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserLogins(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteUserLogins, userID)
+	return err
+}
+
+const getAccessRequest = `-- name: GetAccessRequest :one
+SELECT ar.id, ar.organization_id, o.name AS organization_name, ar.user_id, u.display_name AS user_display_name, u.email AS user_email,
+    ar.role_id, r.name AS role_name, ar.justification, ar.status, ar.requested_at,
+    ar.decided_by, d.display_name AS decided_by_name, ar.decided_at, ar.comment, ar.expires_at
+FROM access_requests ar
+JOIN organizations o ON o.id = ar.organization_id
+JOIN users u ON u.id = ar.user_id
+JOIN roles r ON r.id = ar.role_id
+LEFT JOIN users d ON d.id = ar.decided_by
+WHERE ar.id = $1
+`
+
+type GetAccessRequestRow struct {
+	ID               int64
+	OrganizationID   int64
+	OrganizationName string
+	UserID           int64
+	UserDisplayName  string
+	UserEmail        string
+	RoleID           int64
+	RoleName         string
+	Justification    string
+	Status           string
+	RequestedAt      int64
+	DecidedBy        int64
+	DecidedByName    sql.NullString
+	DecidedAt        int64
+	Comment          string
+	ExpiresAt        int64
+}
+
+func (q *Queries) GetAccessRequest(ctx context.Context, id int64) (GetAccessRequestRow, error) {
+	row := q.db.QueryRowContext(ctx, getAccessRequest, id)
+	var i GetAccessRequestRow
+	err := row.Scan(
+		&i.ID,
+		&i.OrganizationID,
+		&i.OrganizationName,
+		&i.UserID,
+		&i.UserDisplayName,
+		&i.UserEmail,
+		&i.RoleID,
+		&i.RoleName,
+		&i.Justification,
+		&i.Status,
+		&i.RequestedAt,
+		&i.DecidedBy,
+		&i.DecidedByName,
+		&i.DecidedAt,
+		&i.Comment,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
 const getAllUserOrganizationRoles = `-- name: GetAllUserOrganizationRoles :many
-SELECT r.id, r.name, r.system_name, o.id as organization_id, o.name as organization_name, o.system_name as organization_system_name
+SELECT r.id, r.name, r.system_name, o.id as organization_id, o.name as organization_name, o.system_name as organization_system_name,
+	ur.not_before, ur.expires_at, ur.access_request_id
 FROM user_roles ur
 JOIN roles r ON r.id = ur.role_id
 JOIN organizations o ON o.id = r.organization_id
@@ -171,6 +498,9 @@ type GetAllUserOrganizationRolesRow struct {
 	OrganizationID         int64
 	OrganizationName       string
 	OrganizationSystemName string
+	NotBefore              int64
+	ExpiresAt              int64
+	AccessRequestID        int64
 }
 
 func (q *Queries) GetAllUserOrganizationRoles(ctx context.Context, userID int64) ([]GetAllUserOrganizationRolesRow, error) {
@@ -189,6 +519,9 @@ func (q *Queries) GetAllUserOrganizationRoles(ctx context.Context, userID int64)
 			&i.OrganizationID,
 			&i.OrganizationName,
 			&i.OrganizationSystemName,
+			&i.NotBefore,
+			&i.ExpiresAt,
+			&i.AccessRequestID,
 		); err != nil {
 			return nil, err
 		}
@@ -302,6 +635,26 @@ func (q *Queries) GetOrganizations(ctx context.Context) ([]GetOrganizationsRow,
 	return items, nil
 }
 
+const getRateLimit = `-- name: GetRateLimit :one
+SELECT bucket_key, amount, previous_amount, updated_at, expires_at, version
+FROM rate_limits
+WHERE bucket_key = $1
+`
+
+func (q *Queries) GetRateLimit(ctx context.Context, bucketKey string) (RateLimit, error) {
+	row := q.db.QueryRowContext(ctx, getRateLimit, bucketKey)
+	var i RateLimit
+	err := row.Scan(
+		&i.BucketKey,
+		&i.Amount,
+		&i.PreviousAmount,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.Version,
+	)
+	return i, err
+}
+
 const getRolePermissions = `-- name: GetRolePermissions :many
 SELECT rp.permission FROM role_permissions rp
 WHERE rp.role_id = $1
@@ -532,6 +885,30 @@ func (q *Queries) GetUserOrganizations(ctx context.Context, userID int64) ([]Get
 	return items, nil
 }
 
+const getUserRole = `-- name: GetUserRole :one
+SELECT user_id, role_id, not_before, expires_at, granted_at, access_request_id FROM user_roles
+WHERE user_id = $1 AND role_id = $2
+`
+
+type GetUserRoleParams struct {
+	UserID int64
+	RoleID int64
+}
+
+func (q *Queries) GetUserRole(ctx context.Context, arg GetUserRoleParams) (UserRole, error) {
+	row := q.db.QueryRowContext(ctx, getUserRole, arg.UserID, arg.RoleID)
+	var i UserRole
+	err := row.Scan(
+		&i.UserID,
+		&i.RoleID,
+		&i.NotBefore,
+		&i.ExpiresAt,
+		&i.GrantedAt,
+		&i.AccessRequestID,
+	)
+	return i, err
+}
+
 const getUsersInRole = `-- name: GetUsersInRole :many
 SELECT u.id, u.first_name, u.last_name, u.display_name, u.email, u.verified
 FROM user_roles ur
@@ -578,24 +955,56 @@ func (q *Queries) GetUsersInRole(ctx context.Context, roleID int64) ([]GetUsersI
 	return items, nil
 }
 
-const listOrganizations = `-- name: ListOrganizations :many
-SELECT id, name, system_name, status FROM organizations
+const insertRateLimit = `-- name: InsertRateLimit :execrows
+INSERT INTO rate_limits (bucket_key, amount, previous_amount, updated_at, expires_at, version)
+VALUES ($1, $2, $3, $4, $5, 0)
+ON CONFLICT (bucket_key) DO NOTHING
 `
 
-func (q *Queries) ListOrganizations(ctx context.Context) ([]Organization, error) {
-	rows, err := q.db.QueryContext(ctx, listOrganizations)
+type InsertRateLimitParams struct {
+	BucketKey      string
+	Amount         float64
+	PreviousAmount float64
+	UpdatedAt      int64
+	ExpiresAt      int64
+}
+
+func (q *Queries) InsertRateLimit(ctx context.Context, arg InsertRateLimitParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, insertRateLimit,
+		arg.BucketKey,
+		arg.Amount,
+		arg.PreviousAmount,
+		arg.UpdatedAt,
+		arg.ExpiresAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const listExpiredUserRoles = `-- name: ListExpiredUserRoles :many
+SELECT user_id, role_id, not_before, expires_at, granted_at, access_request_id FROM user_roles
+WHERE expires_at > 0 AND expires_at <= $1
+ORDER BY expires_at
+`
+
+func (q *Queries) ListExpiredUserRoles(ctx context.Context, now int64) ([]UserRole, error) {
+	rows, err := q.db.QueryContext(ctx, listExpiredUserRoles, now)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Organization
+	var items []UserRole
 	for rows.Next() {
-		var i Organization
+		var i UserRole
 		if err := rows.Scan(
-			&i.ID,
-			&i.Name,
-			&i.SystemName,
-			&i.Status,
+			&i.UserID,
+			&i.RoleID,
+			&i.NotBefore,
+			&i.ExpiresAt,
+			&i.GrantedAt,
+			&i.AccessRequestID,
 		); err != nil {
 			return nil, err
 		}
@@ -610,25 +1019,73 @@ func (q *Queries) ListOrganizations(ctx context.Context) ([]Organization, error)
 	return items, nil
 }
 
-const listRecentUserIds = `-- name: ListRecentUserIds :many
-SELECT id FROM users
-ORDER BY last_login DESC NULLS LAST
-LIMIT $1
+const listOrganizationAccessRequests = `-- name: ListOrganizationAccessRequests :many
+SELECT ar.id, ar.organization_id, o.name AS organization_name, ar.user_id, u.display_name AS user_display_name, u.email AS user_email,
+    ar.role_id, r.name AS role_name, ar.justification, ar.status, ar.requested_at,
+    ar.decided_by, d.display_name AS decided_by_name, ar.decided_at, ar.comment, ar.expires_at
+FROM access_requests ar
+JOIN organizations o ON o.id = ar.organization_id
+JOIN users u ON u.id = ar.user_id
+JOIN roles r ON r.id = ar.role_id
+LEFT JOIN users d ON d.id = ar.decided_by
+WHERE ar.organization_id = $1 AND ar.status = $2
+ORDER BY ar.requested_at DESC, ar.id DESC
 `
 
-func (q *Queries) ListRecentUserIds(ctx context.Context, limit int32) ([]int64, error) {
-	rows, err := q.db.QueryContext(ctx, listRecentUserIds, limit)
+type ListOrganizationAccessRequestsParams struct {
+	OrganizationID int64
+	Status         string
+}
+
+type ListOrganizationAccessRequestsRow struct {
+	ID               int64
+	OrganizationID   int64
+	OrganizationName string
+	UserID           int64
+	UserDisplayName  string
+	UserEmail        string
+	RoleID           int64
+	RoleName         string
+	Justification    string
+	Status           string
+	RequestedAt      int64
+	DecidedBy        int64
+	DecidedByName    sql.NullString
+	DecidedAt        int64
+	Comment          string
+	ExpiresAt        int64
+}
+
+func (q *Queries) ListOrganizationAccessRequests(ctx context.Context, arg ListOrganizationAccessRequestsParams) ([]ListOrganizationAccessRequestsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listOrganizationAccessRequests, arg.OrganizationID, arg.Status)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []int64
+	var items []ListOrganizationAccessRequestsRow
 	for rows.Next() {
-		var id int64
-		if err := rows.Scan(&id); err != nil {
+		var i ListOrganizationAccessRequestsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.OrganizationID,
+			&i.OrganizationName,
+			&i.UserID,
+			&i.UserDisplayName,
+			&i.UserEmail,
+			&i.RoleID,
+			&i.RoleName,
+			&i.Justification,
+			&i.Status,
+			&i.RequestedAt,
+			&i.DecidedBy,
+			&i.DecidedByName,
+			&i.DecidedAt,
+			&i.Comment,
+			&i.ExpiresAt,
+		); err != nil {
 			return nil, err
 		}
-		items = append(items, id)
+		items = append(items, i)
 	}
 	if err := rows.Close(); err != nil {
 		return nil, err
@@ -639,34 +1096,31 @@ func (q *Queries) ListRecentUserIds(ctx context.Context, limit int32) ([]int64,
 	return items, nil
 }
 
-const listRolesWithUserCounts = `-- name: ListRolesWithUserCounts :many
-SELECT r.id, r.name, r.system_name, count(ur.user_id) AS user_count
-FROM roles r
-LEFT JOIN user_roles ur ON ur.role_id=r.id
-WHERE organization_id=$1
+const listOrganizationAccessReviews = `-- name: ListOrganizationAccessReviews :many
+SELECT id, organization_id, name, status, started_at, closed_at, membership_count, revoked_count
+FROM access_reviews
+WHERE organization_id = $1
+ORDER BY started_at DESC, id DESC
 `
 
-type ListRolesWithUserCountsRow struct {
-	ID         int64
-	Name       string
-	SystemName string
-	UserCount  int64
-}
-
-func (q *Queries) ListRolesWithUserCounts(ctx context.Context, organizationID int64) ([]ListRolesWithUserCountsRow, error) {
-	rows, err := q.db.QueryContext(ctx, listRolesWithUserCounts, organizationID)
+func (q *Queries) ListOrganizationAccessReviews(ctx context.Context, organizationID int64) ([]AccessReview, error) {
+	rows, err := q.db.QueryContext(ctx, listOrganizationAccessReviews, organizationID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []ListRolesWithUserCountsRow
+	var items []AccessReview
 	for rows.Next() {
-		var i ListRolesWithUserCountsRow
+		var i AccessReview
 		if err := rows.Scan(
 			&i.ID,
+			&i.OrganizationID,
 			&i.Name,
-			&i.SystemName,
-			&i.UserCount,
+			&i.Status,
+			&i.StartedAt,
+			&i.ClosedAt,
+			&i.MembershipCount,
+			&i.RevokedCount,
 		); err != nil {
 			return nil, err
 		}
@@ -681,41 +1135,24 @@ func (q *Queries) ListRolesWithUserCounts(ctx context.Context, organizationID in
 	return items, nil
 }
 
-const listUserOrganizationRoles = `-- name: ListUserOrganizationRoles :many
-SELECT o.id as organization_id, o.name as organization, 
-	o.system_name as organization_system_name,
-	r.id as role_id, r.name as role_name, r.system_name as role_system_name 
-FROM user_roles ur
-JOIN roles r ON r.id = ur.role_id
-JOIN organizations o ON o.id = r.organization_id
-WHERE ur.user_id = $1
+const listOrganizations = `-- name: ListOrganizations :many
+SELECT id, name, system_name, status FROM organizations
 `
 
-type ListUserOrganizationRolesRow struct {
-	OrganizationID         int64
-	Organization           string
-	OrganizationSystemName string
-	RoleID                 int64
-	RoleName               string
-	RoleSystemName         string
-}
-
-func (q *Queries) ListUserOrganizationRoles(ctx context.Context, userID int64) ([]ListUserOrganizationRolesRow, error) {
-	rows, err := q.db.QueryContext(ctx, listUserOrganizationRoles, userID)
+func (q *Queries) ListOrganizations(ctx context.Context) ([]Organization, error) {
+	rows, err := q.db.QueryContext(ctx, listOrganizations)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []ListUserOrganizationRolesRow
+	var items []Organization
 	for rows.Next() {
-		var i ListUserOrganizationRolesRow
+		var i Organization
 		if err := rows.Scan(
-			&i.OrganizationID,
-			&i.Organization,
-			&i.OrganizationSystemName,
-			&i.RoleID,
-			&i.RoleName,
-			&i.RoleSystemName,
+			&i.ID,
+			&i.Name,
+			&i.SystemName,
+			&i.Status,
 		); err != nil {
 			return nil, err
 		}
@@ -730,11 +1167,481 @@ func (q *Queries) ListUserOrganizationRoles(ctx context.Context, userID int64) (
 	return items, nil
 }
 
-const organizationsCount = `-- name: OrganizationsCount :one
-SELECT COUNT(*) AS count FROM organizations
+const listOrganizationServiceAccounts = `-- name: ListOrganizationServiceAccounts :many
+SELECT u.id, u.display_name, u.owner_organization_id, o.name AS organization_name, u.created_at
+FROM users u
+JOIN organizations o ON o.id = u.owner_organization_id
+WHERE u.service_account = TRUE AND u.owner_organization_id = $1
+ORDER BY u.display_name
 `
 
-func (q *Queries) OrganizationsCount(ctx context.Context) (int64, error) {
+type ListOrganizationServiceAccountsRow struct {
+	ID                  int64
+	DisplayName         string
+	OwnerOrganizationID sql.NullInt64
+	OrganizationName    string
+	CreatedAt           sql.NullTime
+}
+
+func (q *Queries) ListOrganizationServiceAccounts(ctx context.Context, ownerOrganizationID sql.NullInt64) ([]ListOrganizationServiceAccountsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listOrganizationServiceAccounts, ownerOrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListOrganizationServiceAccountsRow
+	for rows.Next() {
+		var i ListOrganizationServiceAccountsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.DisplayName,
+			&i.OwnerOrganizationID,
+			&i.OrganizationName,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOrganizationUsersWithPermission = `-- name: ListOrganizationUsersWithPermission :many
+SELECT DISTINCT u.id, u.email
+FROM users u
+JOIN user_roles ur ON ur.user_id = u.id
+JOIN roles r ON r.id = ur.role_id
+JOIN role_permissions rp ON rp.role_id = r.id
+WHERE r.organization_id = $1 AND rp.permission = $2
+  AND u.service_account = FALSE
+  AND ur.not_before <= $3 AND (ur.expires_at = 0 OR ur.expires_at > $3)
+ORDER BY u.id
+`
+
+type ListOrganizationUsersWithPermissionParams struct {
+	OrganizationID int64
+	Permission     string
+	Now            int64
+}
+
+type ListOrganizationUsersWithPermissionRow struct {
+	ID    int64
+	Email string
+}
+
+func (q *Queries) ListOrganizationUsersWithPermission(ctx context.Context, arg ListOrganizationUsersWithPermissionParams) ([]ListOrganizationUsersWithPermissionRow, error) {
+	rows, err := q.db.QueryContext(ctx, listOrganizationUsersWithPermission, arg.OrganizationID, arg.Permission, arg.Now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListOrganizationUsersWithPermissionRow
+	for rows.Next() {
+		var i ListOrganizationUsersWithPermissionRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRecentUserIds = `-- name: ListRecentUserIds :many
+SELECT id FROM users
+WHERE service_account = FALSE
+ORDER BY last_login DESC NULLS LAST
+LIMIT $1
+`
+
+func (q *Queries) ListRecentUserIds(ctx context.Context, limit int32) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, listRecentUserIds, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRelationTuplesByObject = `-- name: ListRelationTuplesByObject :many
+SELECT object_type, object_id, relation, subject_type, subject_id, subject_relation
+FROM relation_tuples
+WHERE object_type = $1 AND object_id = $2
+ORDER BY relation, subject_type, subject_id, subject_relation
+`
+
+type ListRelationTuplesByObjectParams struct {
+	ObjectType string
+	ObjectID   string
+}
+
+func (q *Queries) ListRelationTuplesByObject(ctx context.Context, arg ListRelationTuplesByObjectParams) ([]RelationTuple, error) {
+	rows, err := q.db.QueryContext(ctx, listRelationTuplesByObject, arg.ObjectType, arg.ObjectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RelationTuple
+	for rows.Next() {
+		var i RelationTuple
+		if err := rows.Scan(
+			&i.ObjectType,
+			&i.ObjectID,
+			&i.Relation,
+			&i.SubjectType,
+			&i.SubjectID,
+			&i.SubjectRelation,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRelationTuplesBySubject = `-- name: ListRelationTuplesBySubject :many
+SELECT object_type, object_id, relation, subject_type, subject_id, subject_relation
+FROM relation_tuples
+WHERE subject_type = $1 AND subject_id = $2 AND subject_relation = $3
+ORDER BY object_type, object_id, relation
+`
+
+type ListRelationTuplesBySubjectParams struct {
+	SubjectType     string
+	SubjectID       string
+	SubjectRelation string
+}
+
+func (q *Queries) ListRelationTuplesBySubject(ctx context.Context, arg ListRelationTuplesBySubjectParams) ([]RelationTuple, error) {
+	rows, err := q.db.QueryContext(ctx, listRelationTuplesBySubject, arg.SubjectType, arg.SubjectID, arg.SubjectRelation)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RelationTuple
+	for rows.Next() {
+		var i RelationTuple
+		if err := rows.Scan(
+			&i.ObjectType,
+			&i.ObjectID,
+			&i.Relation,
+			&i.SubjectType,
+			&i.SubjectID,
+			&i.SubjectRelation,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRolesWithUserCounts = `-- name: ListRolesWithUserCounts :many
+SELECT r.id, r.name, r.system_name, count(ur.user_id) AS user_count
+FROM roles r
+LEFT JOIN user_roles ur ON ur.role_id=r.id
+WHERE organization_id=$1
+`
+
+type ListRolesWithUserCountsRow struct {
+	ID         int64
+	Name       string
+	SystemName string
+	UserCount  int64
+}
+
+func (q *Queries) ListRolesWithUserCounts(ctx context.Context, organizationID int64) ([]ListRolesWithUserCountsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listRolesWithUserCounts, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListRolesWithUserCountsRow
+	for rows.Next() {
+		var i ListRolesWithUserCountsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.SystemName,
+			&i.UserCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listServiceAccounts = `-- name: ListServiceAccounts :many
+SELECT u.id, u.display_name, u.owner_organization_id, o.name AS organization_name, u.created_at
+FROM users u
+JOIN organizations o ON o.id = u.owner_organization_id
+WHERE u.service_account = TRUE
+ORDER BY o.name, u.display_name
+`
+
+type ListServiceAccountsRow struct {
+	ID                  int64
+	DisplayName         string
+	OwnerOrganizationID sql.NullInt64
+	OrganizationName    string
+	CreatedAt           sql.NullTime
+}
+
+func (q *Queries) ListServiceAccounts(ctx context.Context) ([]ListServiceAccountsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listServiceAccounts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListServiceAccountsRow
+	for rows.Next() {
+		var i ListServiceAccountsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.DisplayName,
+			&i.OwnerOrganizationID,
+			&i.OrganizationName,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserAccessRequests = `-- name: ListUserAccessRequests :many
+SELECT ar.id, ar.organization_id, o.name AS organization_name, ar.user_id, u.display_name AS user_display_name, u.email AS user_email,
+    ar.role_id, r.name AS role_name, ar.justification, ar.status, ar.requested_at,
+    ar.decided_by, d.display_name AS decided_by_name, ar.decided_at, ar.comment, ar.expires_at
+FROM access_requests ar
+JOIN organizations o ON o.id = ar.organization_id
+JOIN users u ON u.id = ar.user_id
+JOIN roles r ON r.id = ar.role_id
+LEFT JOIN users d ON d.id = ar.decided_by
+WHERE ar.user_id = $1
+ORDER BY ar.requested_at DESC, ar.id DESC
+`
+
+type ListUserAccessRequestsRow struct {
+	ID               int64
+	OrganizationID   int64
+	OrganizationName string
+	UserID           int64
+	UserDisplayName  string
+	UserEmail        string
+	RoleID           int64
+	RoleName         string
+	Justification    string
+	Status           string
+	RequestedAt      int64
+	DecidedBy        int64
+	DecidedByName    sql.NullString
+	DecidedAt        int64
+	Comment          string
+	ExpiresAt        int64
+}
+
+func (q *Queries) ListUserAccessRequests(ctx context.Context, userID int64) ([]ListUserAccessRequestsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUserAccessRequests, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUserAccessRequestsRow
+	for rows.Next() {
+		var i ListUserAccessRequestsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.OrganizationID,
+			&i.OrganizationName,
+			&i.UserID,
+			&i.UserDisplayName,
+			&i.UserEmail,
+			&i.RoleID,
+			&i.RoleName,
+			&i.Justification,
+			&i.Status,
+			&i.RequestedAt,
+			&i.DecidedBy,
+			&i.DecidedByName,
+			&i.DecidedAt,
+			&i.Comment,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserLogins = `-- name: ListUserLogins :many
+SELECT id, user_id, occurred_at, outcome, reason, ip_address, user_agent, device_id
+FROM user_logins
+WHERE user_id = $1
+ORDER BY occurred_at DESC, id DESC
+LIMIT $3::int OFFSET $2::int
+`
+
+type ListUserLoginsParams struct {
+	UserID int64
+	Start  int32
+	Count  int32
+}
+
+func (q *Queries) ListUserLogins(ctx context.Context, arg ListUserLoginsParams) ([]UserLogin, error) {
+	rows, err := q.db.QueryContext(ctx, listUserLogins, arg.UserID, arg.Start, arg.Count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserLogin
+	for rows.Next() {
+		var i UserLogin
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.OccurredAt,
+			&i.Outcome,
+			&i.Reason,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.DeviceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserOrganizationRoles = `-- name: ListUserOrganizationRoles :many
+SELECT o.id as organization_id, o.name as organization, 
+	o.system_name as organization_system_name,
+	r.id as role_id, r.name as role_name, r.system_name as role_system_name,
+	ur.not_before, ur.expires_at, ur.access_request_id
+FROM user_roles ur
+JOIN roles r ON r.id = ur.role_id
+JOIN organizations o ON o.id = r.organization_id
+WHERE ur.user_id = $1
+`
+
+type ListUserOrganizationRolesRow struct {
+	OrganizationID         int64
+	Organization           string
+	OrganizationSystemName string
+	RoleID                 int64
+	RoleName               string
+	RoleSystemName         string
+	NotBefore              int64
+	ExpiresAt              int64
+	AccessRequestID        int64
+}
+
+func (q *Queries) ListUserOrganizationRoles(ctx context.Context, userID int64) ([]ListUserOrganizationRolesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUserOrganizationRoles, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUserOrganizationRolesRow
+	for rows.Next() {
+		var i ListUserOrganizationRolesRow
+		if err := rows.Scan(
+			&i.OrganizationID,
+			&i.Organization,
+			&i.OrganizationSystemName,
+			&i.RoleID,
+			&i.RoleName,
+			&i.RoleSystemName,
+			&i.NotBefore,
+			&i.ExpiresAt,
+			&i.AccessRequestID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const organizationsCount = `-- name: OrganizationsCount :one
+SELECT COUNT(*) AS count FROM organizations
+`
+
+func (q *Queries) OrganizationsCount(ctx context.Context) (int64, error) {
 	row := q.db.QueryRowContext(ctx, organizationsCount)
 	var count int64
 	err := row.Scan(&count)
@@ -779,6 +1686,52 @@ func (q *Queries) RemoveUserFromRole(ctx context.Context, arg RemoveUserFromRole
 	return err
 }
 
+const searchUserLoginsByIp = `-- name: SearchUserLoginsByIp :many
+SELECT id, user_id, occurred_at, outcome, reason, ip_address, user_agent, device_id
+FROM user_logins
+WHERE ip_address LIKE $1 ESCAPE '\'
+ORDER BY occurred_at DESC, id DESC
+LIMIT $3::int OFFSET $2::int
+`
+
+type SearchUserLoginsByIpParams struct {
+	Query string
+	Start int32
+	Count int32
+}
+
+func (q *Queries) SearchUserLoginsByIp(ctx context.Context, arg SearchUserLoginsByIpParams) ([]UserLogin, error) {
+	rows, err := q.db.QueryContext(ctx, searchUserLoginsByIp, arg.Query, arg.Start, arg.Count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserLogin
+	for rows.Next() {
+		var i UserLogin
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.OccurredAt,
+			&i.Outcome,
+			&i.Reason,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.DeviceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const updateOrganization = `-- name: UpdateOrganization :exec
 UPDATE organizations SET 
 name = $1, 
@@ -804,6 +1757,36 @@ func (q *Queries) UpdateOrganization(ctx context.Context, arg UpdateOrganization
 	return err
 }
 
+const updateRateLimit = `-- name: UpdateRateLimit :execrows
+UPDATE rate_limits
+SET amount = $1, previous_amount = $2, updated_at = $3, expires_at = $4, version = version + 1
+WHERE bucket_key = $5 AND version = $6
+`
+
+type UpdateRateLimitParams struct {
+	Amount         float64
+	PreviousAmount float64
+	UpdatedAt      int64
+	ExpiresAt      int64
+	BucketKey      string
+	Version        int64
+}
+
+func (q *Queries) UpdateRateLimit(ctx context.Context, arg UpdateRateLimitParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateRateLimit,
+		arg.Amount,
+		arg.PreviousAmount,
+		arg.UpdatedAt,
+		arg.ExpiresAt,
+		arg.BucketKey,
+		arg.Version,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const updateRole = `-- name: UpdateRole :exec
 UPDATE roles SET 
 name = $1, system_name = $2 WHERE id = $3
@@ -865,8 +1848,8 @@ func (q *Queries) UpdateUserLoginStats(ctx context.Context, arg UpdateUserLoginS
 }
 
 const userAddApiKey = `-- name: UserAddApiKey :exec
-INSERT INTO user_api_keys (id, secret_hash, user_id, organization_id, name, created_at, expires_at)
-VALUES ($1, $2, $3, $4, $5, $6, $7)
+INSERT INTO user_api_keys (id, secret_hash, user_id, organization_id, name, created_at, expires_at, scopes, allowed_cidrs)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 `
 
 type UserAddApiKeyParams struct {
@@ -877,6 +1860,8 @@ type UserAddApiKeyParams struct {
 	Name           string
 	CreatedAt      time.Time
 	ExpiresAt      time.Time
+	Scopes         string
+	AllowedCidrs   string
 }
 
 func (q *Queries) UserAddApiKey(ctx context.Context, arg UserAddApiKeyParams) error {
@@ -888,10 +1873,48 @@ func (q *Queries) UserAddApiKey(ctx context.Context, arg UserAddApiKeyParams) er
 		arg.Name,
 		arg.CreatedAt,
 		arg.ExpiresAt,
+		arg.Scopes,
+		arg.AllowedCidrs,
 	)
 	return err
 }
 
+const userDataKeyAdd = `-- name: UserDataKeyAdd :exec
+INSERT INTO user_data_keys (user_id, wrapped_key)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO NOTHING
+`
+
+type UserDataKeyAddParams struct {
+	UserID     int64
+	WrappedKey string
+}
+
+func (q *Queries) UserDataKeyAdd(ctx context.Context, arg UserDataKeyAddParams) error {
+	_, err := q.db.ExecContext(ctx, userDataKeyAdd, arg.UserID, arg.WrappedKey)
+	return err
+}
+
+const userDataKeyDelete = `-- name: UserDataKeyDelete :exec
+DELETE FROM user_data_keys WHERE user_id = $1
+`
+
+func (q *Queries) UserDataKeyDelete(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, userDataKeyDelete, userID)
+	return err
+}
+
+const userDataKeyGet = `-- name: UserDataKeyGet :one
+SELECT wrapped_key FROM user_data_keys WHERE user_id = $1
+`
+
+func (q *Queries) UserDataKeyGet(ctx context.Context, userID int64) (string, error) {
+	row := q.db.QueryRowContext(ctx, userDataKeyGet, userID)
+	var wrapped_key string
+	err := row.Scan(&wrapped_key)
+	return wrapped_key, err
+}
+
 const userDeleteApiKey = `-- name: UserDeleteApiKey :exec
 DELETE FROM user_api_keys
 WHERE id = $1 AND user_id = $2
@@ -907,8 +1930,18 @@ func (q *Queries) UserDeleteApiKey(ctx context.Context, arg UserDeleteApiKeyPara
 	return err
 }
 
+const userDeleteAllApiKeys = `-- name: UserDeleteAllApiKeys :exec
+DELETE FROM user_api_keys
+WHERE user_id = $1
+`
+
+func (q *Queries) UserDeleteAllApiKeys(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, userDeleteAllApiKeys, userID)
+	return err
+}
+
 const userGetApiKey = `-- name: UserGetApiKey :one
-SELECT id, secret_hash, user_id, organization_id, name, created_at, expires_at
+SELECT id, secret_hash, user_id, organization_id, name, created_at, expires_at, scopes, allowed_cidrs, replaced_by, last_used_at, last_used_ip
 FROM user_api_keys
 WHERE id = $1
 `
@@ -921,6 +1954,11 @@ type UserGetApiKeyRow struct {
 	Name           string
 	CreatedAt      time.Time
 	ExpiresAt      time.Time
+	Scopes         string
+	AllowedCidrs   string
+	ReplacedBy     string
+	LastUsedAt     sql.NullTime
+	LastUsedIp     string
 }
 
 func (q *Queries) UserGetApiKey(ctx context.Context, apiKeyHash string) (UserGetApiKeyRow, error) {
@@ -934,14 +1972,20 @@ func (q *Queries) UserGetApiKey(ctx context.Context, apiKeyHash string) (UserGet
 		&i.Name,
 		&i.CreatedAt,
 		&i.ExpiresAt,
+		&i.Scopes,
+		&i.AllowedCidrs,
+		&i.ReplacedBy,
+		&i.LastUsedAt,
+		&i.LastUsedIp,
 	)
 	return i, err
 }
 
 const userListApiKeys = `-- name: UserListApiKeys :many
-SELECT id, user_id, organization_id, name, created_at, expires_at
+SELECT id, user_id, organization_id, name, created_at, expires_at, scopes, allowed_cidrs, replaced_by, last_used_at, last_used_ip
 FROM user_api_keys
 WHERE user_id = $1
+ORDER BY created_at, id
 `
 
 type UserListApiKeysRow struct {
@@ -951,6 +1995,11 @@ type UserListApiKeysRow struct {
 	Name           string
 	CreatedAt      time.Time
 	ExpiresAt      time.Time
+	Scopes         string
+	AllowedCidrs   string
+	ReplacedBy     string
+	LastUsedAt     sql.NullTime
+	LastUsedIp     string
 }
 
 func (q *Queries) UserListApiKeys(ctx context.Context, userID int64) ([]UserListApiKeysRow, error) {
@@ -969,6 +2018,11 @@ func (q *Queries) UserListApiKeys(ctx context.Context, userID int64) ([]UserList
 			&i.Name,
 			&i.CreatedAt,
 			&i.ExpiresAt,
+			&i.Scopes,
+			&i.AllowedCidrs,
+			&i.ReplacedBy,
+			&i.LastUsedAt,
+			&i.LastUsedIp,
 		); err != nil {
 			return nil, err
 		}
@@ -983,10 +2037,50 @@ func (q *Queries) UserListApiKeys(ctx context.Context, userID int64) ([]UserList
 	return items, nil
 }
 
+const userRecordApiKeyUse = `-- name: UserRecordApiKeyUse :exec
+UPDATE user_api_keys
+SET last_used_at = $1, last_used_ip = $2
+WHERE id = $3
+`
+
+type UserRecordApiKeyUseParams struct {
+	LastUsedAt sql.NullTime
+	LastUsedIp string
+	ID         string
+}
+
+func (q *Queries) UserRecordApiKeyUse(ctx context.Context, arg UserRecordApiKeyUseParams) error {
+	_, err := q.db.ExecContext(ctx, userRecordApiKeyUse, arg.LastUsedAt, arg.LastUsedIp, arg.ID)
+	return err
+}
+
+const userReplaceApiKey = `-- name: UserReplaceApiKey :exec
+UPDATE user_api_keys
+SET expires_at = $1, replaced_by = $2
+WHERE id = $3 AND user_id = $4
+`
+
+type UserReplaceApiKeyParams struct {
+	ExpiresAt  time.Time
+	ReplacedBy string
+	ID         string
+	UserID     int64
+}
+
+func (q *Queries) UserReplaceApiKey(ctx context.Context, arg UserReplaceApiKeyParams) error {
+	_, err := q.db.ExecContext(ctx, userReplaceApiKey,
+		arg.ExpiresAt,
+		arg.ReplacedBy,
+		arg.ID,
+		arg.UserID,
+	)
+	return err
+}
+
 const userSearch = `-- name: UserSearch :many
 SELECT id, first_name, last_name, display_name, email, verified
 FROM users
-WHERE email ILIKE $1 OR disoplay_name ILIKE $1 LIMIT $3::int OFFSET $2::int
+WHERE service_account = FALSE AND (email ILIKE $1 OR display_name ILIKE $1) LIMIT $3::int OFFSET $2::int
 `
 
 type UserSearchParams struct {
@@ -1034,8 +2128,25 @@ func (q *Queries) UserSearch(ctx context.Context, arg UserSearchParams) ([]UserS
 	return items, nil
 }
 
+const userUpdateApiKeyHash = `-- name: UserUpdateApiKeyHash :exec
+UPDATE user_api_keys
+SET secret_hash = $1
+WHERE id = $2 AND user_id = $3
+`
+
+type UserUpdateApiKeyHashParams struct {
+	SecretHash string
+	ID         string
+	UserID     int64
+}
+
+func (q *Queries) UserUpdateApiKeyHash(ctx context.Context, arg UserUpdateApiKeyHashParams) error {
+	_, err := q.db.ExecContext(ctx, userUpdateApiKeyHash, arg.SecretHash, arg.ID, arg.UserID)
+	return err
+}
+
 const usersCount = `-- name: UsersCount :one
-SELECT COUNT(*) AS count FROM users
+SELECT COUNT(*) AS count FROM users WHERE service_account = FALSE
 `
 
 func (q *Queries) UsersCount(ctx context.Context) (int64, error) {
@@ -9,6 +9,31 @@ import (
 	"time"
 )
 
+type AccessRequest struct {
+	ID             int64
+	OrganizationID int64
+	UserID         int64
+	RoleID         int64
+	Justification  string
+	Status         string
+	RequestedAt    int64
+	DecidedBy      int64
+	DecidedAt      int64
+	Comment        string
+	ExpiresAt      int64
+}
+
+type AccessReview struct {
+	ID              int64
+	OrganizationID  int64
+	Name            string
+	Status          string
+	StartedAt       int64
+	ClosedAt        int64
+	MembershipCount int64
+	RevokedCount    int64
+}
+
 type Organization struct {
 	ID         int64
 	Name       string
@@ -16,6 +41,24 @@ type Organization struct {
 	Status     string
 }
 
+type RateLimit struct {
+	BucketKey      string
+	Amount         float64
+	PreviousAmount float64
+	UpdatedAt      int64
+	ExpiresAt      int64
+	Version        int64
+}
+
+type RelationTuple struct {
+	ObjectType      string
+	ObjectID        string
+	Relation        string
+	SubjectType     string
+	SubjectID       string
+	SubjectRelation string
+}
+
 type Role struct {
 	ID             int64
 	OrganizationID int64
@@ -29,16 +72,18 @@ type RolePermission struct {
 }
 
 type User struct {
-	ID          int64
-	FirstName   string
-	LastName    string
-	DisplayName string
-	Email       string
-	CreatedAt   sql.NullTime
-	UpdatedAt   sql.NullTime
-	LastLogin   sql.NullTime
-	LoginCount  int64
-	Verified    bool
+	ID                  int64
+	FirstName           string
+	LastName            string
+	DisplayName         string
+	Email               string
+	CreatedAt           sql.NullTime
+	UpdatedAt           sql.NullTime
+	LastLogin           sql.NullTime
+	LoginCount          int64
+	Verified            bool
+	ServiceAccount      bool
+	OwnerOrganizationID sql.NullInt64
 }
 
 type UserApiKey struct {
@@ -49,9 +94,34 @@ type UserApiKey struct {
 	UserID         int64
 	CreatedAt      time.Time
 	ExpiresAt      time.Time
+	Scopes         string
+	LastUsedAt     sql.NullTime
+	LastUsedIp     string
+	AllowedCidrs   string
+	ReplacedBy     string
+}
+
+type UserDataKey struct {
+	UserID     int64
+	WrappedKey string
+}
+
+type UserLogin struct {
+	ID         int64
+	UserID     int64
+	OccurredAt int64
+	Outcome    string
+	Reason     string
+	IpAddress  string
+	UserAgent  string
+	DeviceID   string
 }
 
 type UserRole struct {
-	UserID int64
-	RoleID int64
+	UserID          int64
+	RoleID          int64
+	NotBefore       int64
+	ExpiresAt       int64
+	GrantedAt       int64
+	AccessRequestID int64
 }
@@ -2,15 +2,21 @@
 package evercoregen_aggregates
 
 const (
+	AccessRequestAggregateType = "AccessRequestAggregate"
+	AccessReviewAggregateType = "AccessReviewAggregate"
 	OrganizationAggregateType = "OrganizationAggregate"
 	OrganizationStateType = "OrganizationState"
+	RelationsAggregateType = "RelationsAggregate"
 	UserAggregateType = "UserAggregate"
 	UserRolesAggregateType = "UserRolesAggregate"
 )
 
 var List = []string{
+	AccessRequestAggregateType,
+	AccessReviewAggregateType,
 	OrganizationAggregateType,
 	OrganizationStateType,
+	RelationsAggregateType,
 	UserAggregateType,
 	UserRolesAggregateType,
 }
@@ -8,23 +8,44 @@ const (
 	RoleUpdatedEventType = "RoleUpdatedEvent"
 	UserAddedEventType = "UserAddedEvent"
 	UserUpdatedEventType = "UserUpdatedEvent"
+	AccessRequestApprovedEventType = "AccessRequestApprovedEvent"
+	AccessRequestDeniedEventType = "AccessRequestDeniedEvent"
+	AccessRequestedEventType = "AccessRequestedEvent"
+	AccessReviewClosedEventType = "AccessReviewClosedEvent"
+	AccessReviewDecidedEventType = "AccessReviewDecidedEvent"
+	AccessReviewStartedEventType = "AccessReviewStartedEvent"
+	OrganizationExclusiveRoleSetRemovedEventType = "OrganizationExclusiveRoleSetRemovedEvent"
+	OrganizationExclusiveRoleSetSavedEventType = "OrganizationExclusiveRoleSetSavedEvent"
 	OrganizationSettingsAddedEventType = "OrganizationSettingsAddedEvent"
 	OrganizationSettingsRemovedEventType = "OrganizationSettingsRemovedEvent"
+	RelationTupleDeletedEventType = "RelationTupleDeletedEvent"
+	RelationTupleWrittenEventType = "RelationTupleWrittenEvent"
 	RoleDeletedEventType = "RoleDeletedEvent"
 	RolePermissionAddedEventType = "RolePermissionAddedEvent"
+	RolePermissionPolicySetEventType = "RolePermissionPolicySetEvent"
 	RolePermissionRemovedEventType = "RolePermissionRemovedEvent"
 	RoleUndeletedEventType = "RoleUndeletedEvent"
+	ServiceAccountAddedEventType = "ServiceAccountAddedEvent"
 	UserAddedToRoleEventType = "UserAddedToRoleEvent"
 	UserApiKeyAddedEventType = "UserApiKeyAddedEvent"
 	UserApiKeyDeletedEventType = "UserApiKeyDeletedEvent"
+	UserApiKeyRehashedEventType = "UserApiKeyRehashedEvent"
+	UserApiKeyRotatedEventType = "UserApiKeyRotatedEvent"
+	UserDeviceRememberedEventType = "UserDeviceRememberedEvent"
 	UserDisabledEventType = "UserDisabledEvent"
 	UserEmailLoginCodeConsumedEventType = "UserEmailLoginCodeConsumedEvent"
+	UserEmailLoginCodeFailedEventType = "UserEmailLoginCodeFailedEvent"
 	UserEmailLoginCodeGeneratedEventType = "UserEmailLoginCodeGeneratedEvent"
+	UserEmailLoginCodeInvalidatedEventType = "UserEmailLoginCodeInvalidatedEvent"
 	UserEnabledEventType = "UserEnabledEvent"
+	UserErasedEventType = "UserErasedEvent"
+	UserImpersonationStartedEventType = "UserImpersonationStartedEvent"
+	UserImpersonationStoppedEventType = "UserImpersonationStoppedEvent"
 	UserLoginFailedEventType = "UserLoginFailedEvent"
 	UserLoginPartiallySucceededEventType = "UserLoginPartiallySucceededEvent"
 	UserLoginSucceededEventType = "UserLoginSucceededEvent"
 	UserRemovedFromRoleEventType = "UserRemovedFromRoleEvent"
+	UserSessionsRevokedEventType = "UserSessionsRevokedEvent"
 	UserSettingsAddedEventType = "UserSettingsAddedEvent"
 	UserSettingsRemovedEventType = "UserSettingsRemovedEvent"
 	UserTwoFactorAuthenticatedEventType = "UserTwoFactorAuthenticatedEvent"
@@ -41,23 +62,44 @@ var List = []string{
 	RoleUpdatedEventType,
 	UserAddedEventType,
 	UserUpdatedEventType,
+	AccessRequestApprovedEventType,
+	AccessRequestDeniedEventType,
+	AccessRequestedEventType,
+	AccessReviewClosedEventType,
+	AccessReviewDecidedEventType,
+	AccessReviewStartedEventType,
+	OrganizationExclusiveRoleSetRemovedEventType,
+	OrganizationExclusiveRoleSetSavedEventType,
 	OrganizationSettingsAddedEventType,
 	OrganizationSettingsRemovedEventType,
+	RelationTupleDeletedEventType,
+	RelationTupleWrittenEventType,
 	RoleDeletedEventType,
 	RolePermissionAddedEventType,
+	RolePermissionPolicySetEventType,
 	RolePermissionRemovedEventType,
 	RoleUndeletedEventType,
+	ServiceAccountAddedEventType,
 	UserAddedToRoleEventType,
 	UserApiKeyAddedEventType,
 	UserApiKeyDeletedEventType,
+	UserApiKeyRehashedEventType,
+	UserApiKeyRotatedEventType,
+	UserDeviceRememberedEventType,
 	UserDisabledEventType,
 	UserEmailLoginCodeConsumedEventType,
+	UserEmailLoginCodeFailedEventType,
 	UserEmailLoginCodeGeneratedEventType,
+	UserEmailLoginCodeInvalidatedEventType,
 	UserEnabledEventType,
+	UserErasedEventType,
+	UserImpersonationStartedEventType,
+	UserImpersonationStoppedEventType,
 	UserLoginFailedEventType,
 	UserLoginPartiallySucceededEventType,
 	UserLoginSucceededEventType,
 	UserRemovedFromRoleEventType,
+	UserSessionsRevokedEventType,
 	UserSettingsAddedEventType,
 	UserSettingsRemovedEventType,
 	UserTwoFactorAuthenticatedEventType,
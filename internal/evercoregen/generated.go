@@ -68,6 +68,62 @@ func StateEventDecoder(ev evercore.SerializedEvent) (evercore.EventState, error)
 
 func EventDecoder(ev evercore.SerializedEvent) (evercore.EventState, error) {
 	switch ev.EventType {
+	case events.AccessRequestApprovedEventType:
+		eventState := ubmanage.AccessRequestApprovedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
+	case events.AccessRequestDeniedEventType:
+		eventState := ubmanage.AccessRequestDeniedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
+	case events.AccessRequestedEventType:
+		eventState := ubmanage.AccessRequestedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
+	case events.AccessReviewClosedEventType:
+		eventState := ubmanage.AccessReviewClosedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
+	case events.AccessReviewDecidedEventType:
+		eventState := ubmanage.AccessReviewDecidedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
+	case events.AccessReviewStartedEventType:
+		eventState := ubmanage.AccessReviewStartedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
+	case events.OrganizationExclusiveRoleSetRemovedEventType:
+		eventState := ubmanage.OrganizationExclusiveRoleSetRemovedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
+	case events.OrganizationExclusiveRoleSetSavedEventType:
+		eventState := ubmanage.OrganizationExclusiveRoleSetSavedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
 	case events.OrganizationSettingsAddedEventType:
 		eventState := ubmanage.OrganizationSettingsAddedEvent {}
 		err := evercore.DecodeEventStateTo(ev, &eventState)
@@ -82,6 +138,20 @@ func EventDecoder(ev evercore.SerializedEvent) (evercore.EventState, error) {
 			return nil, err
 		}
 		return eventState, nil
+	case events.RelationTupleDeletedEventType:
+		eventState := ubmanage.RelationTupleDeletedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
+	case events.RelationTupleWrittenEventType:
+		eventState := ubmanage.RelationTupleWrittenEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
 	case events.RoleDeletedEventType:
 		eventState := ubmanage.RoleDeletedEvent {}
 		err := evercore.DecodeEventStateTo(ev, &eventState)
@@ -96,6 +166,13 @@ func EventDecoder(ev evercore.SerializedEvent) (evercore.EventState, error) {
 			return nil, err
 		}
 		return eventState, nil
+	case events.RolePermissionPolicySetEventType:
+		eventState := ubmanage.RolePermissionPolicySetEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
 	case events.RolePermissionRemovedEventType:
 		eventState := ubmanage.RolePermissionRemovedEvent {}
 		err := evercore.DecodeEventStateTo(ev, &eventState)
@@ -110,6 +187,13 @@ func EventDecoder(ev evercore.SerializedEvent) (evercore.EventState, error) {
 			return nil, err
 		}
 		return eventState, nil
+	case events.ServiceAccountAddedEventType:
+		eventState := ubmanage.ServiceAccountAddedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
 	case events.UserAddedToRoleEventType:
 		eventState := ubmanage.UserAddedToRoleEvent {}
 		err := evercore.DecodeEventStateTo(ev, &eventState)
@@ -131,6 +215,27 @@ func EventDecoder(ev evercore.SerializedEvent) (evercore.EventState, error) {
 			return nil, err
 		}
 		return eventState, nil
+	case events.UserApiKeyRehashedEventType:
+		eventState := ubmanage.UserApiKeyRehashedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
+	case events.UserApiKeyRotatedEventType:
+		eventState := ubmanage.UserApiKeyRotatedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
+	case events.UserDeviceRememberedEventType:
+		eventState := ubmanage.UserDeviceRememberedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
 	case events.UserDisabledEventType:
 		eventState := ubmanage.UserDisabledEvent {}
 		err := evercore.DecodeEventStateTo(ev, &eventState)
@@ -145,6 +250,13 @@ func EventDecoder(ev evercore.SerializedEvent) (evercore.EventState, error) {
 			return nil, err
 		}
 		return eventState, nil
+	case events.UserEmailLoginCodeFailedEventType:
+		eventState := ubmanage.UserEmailLoginCodeFailedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
 	case events.UserEmailLoginCodeGeneratedEventType:
 		eventState := ubmanage.UserEmailLoginCodeGeneratedEvent {}
 		err := evercore.DecodeEventStateTo(ev, &eventState)
@@ -152,6 +264,13 @@ func EventDecoder(ev evercore.SerializedEvent) (evercore.EventState, error) {
 			return nil, err
 		}
 		return eventState, nil
+	case events.UserEmailLoginCodeInvalidatedEventType:
+		eventState := ubmanage.UserEmailLoginCodeInvalidatedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
 	case events.UserEnabledEventType:
 		eventState := ubmanage.UserEnabledEvent {}
 		err := evercore.DecodeEventStateTo(ev, &eventState)
@@ -159,6 +278,27 @@ func EventDecoder(ev evercore.SerializedEvent) (evercore.EventState, error) {
 			return nil, err
 		}
 		return eventState, nil
+	case events.UserErasedEventType:
+		eventState := ubmanage.UserErasedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
+	case events.UserImpersonationStartedEventType:
+		eventState := ubmanage.UserImpersonationStartedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
+	case events.UserImpersonationStoppedEventType:
+		eventState := ubmanage.UserImpersonationStoppedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
 	case events.UserLoginFailedEventType:
 		eventState := ubmanage.UserLoginFailedEvent {}
 		err := evercore.DecodeEventStateTo(ev, &eventState)
@@ -187,6 +327,13 @@ func EventDecoder(ev evercore.SerializedEvent) (evercore.EventState, error) {
 			return nil, err
 		}
 		return eventState, nil
+	case events.UserSessionsRevokedEventType:
+		eventState := ubmanage.UserSessionsRevokedEvent {}
+		err := evercore.DecodeEventStateTo(ev, &eventState)
+		if err != nil {
+			return nil, err
+		}
+		return eventState, nil
 	case events.UserSettingsAddedEventType:
 		eventState := ubmanage.UserSettingsAddedEvent {}
 		err := evercore.DecodeEventStateTo(ev, &eventState)
@@ -0,0 +1,70 @@
+package contracts
+
+import (
+	"context"
+	"slices"
+)
+
+// Permissions used by the admin panel.
+const (
+	PermSystemAdmin      = "system_admin"
+	PermImpersonateUsers = "impersonate_users"
+)
+
+type PermissionsContextKey string
+
+const PermissionsContextKeyStr = PermissionsContextKey("permissions")
+
+// Permissions are the permissions a user holds in an organization, sorted.
+// The permission middleware places the permissions the signed in user holds
+// for the request on the request context so templates can check them without
+// further lookups. Permissions granted under a policy which denies the
+// request are left out.
+type Permissions []string
+
+// NewPermissions returns the sorted, deduplicated permissions.
+func NewPermissions(permissions []string) Permissions {
+	sorted := slices.Clone(permissions)
+	slices.Sort(sorted)
+	return Permissions(slices.Compact(sorted))
+}
+
+func (p Permissions) Has(permission string) bool {
+	_, found := slices.BinarySearch(p, permission)
+	return found
+}
+
+func (p Permissions) HasAny(permissions ...string) bool {
+	return slices.ContainsFunc(permissions, p.Has)
+}
+
+func (p Permissions) HasAll(permissions ...string) bool {
+	for _, permission := range permissions {
+		if !p.Has(permission) {
+			return false
+		}
+	}
+	return true
+}
+
+func WithPermissions(ctx context.Context, permissions Permissions) context.Context {
+	return context.WithValue(ctx, PermissionsContextKeyStr, permissions)
+}
+
+func PermissionsFromContext(ctx context.Context) (Permissions, bool) {
+	permissions, ok := ctx.Value(PermissionsContextKeyStr).(Permissions)
+	return permissions, ok
+}
+
+// Can reports whether the signed in user holds the permission. It is false
+// when no permissions are on the context, so controls stay hidden by default.
+func Can(ctx context.Context, permission string) bool {
+	permissions, _ := PermissionsFromContext(ctx)
+	return permissions.Has(permission)
+}
+
+// CanAny reports whether the signed in user holds any of the permissions.
+func CanAny(ctx context.Context, permissions ...string) bool {
+	held, _ := PermissionsFromContext(ctx)
+	return held.HasAny(permissions...)
+}
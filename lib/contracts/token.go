@@ -21,12 +21,71 @@ type AuthToken struct {
 	RequiresVerification bool   `json:"requiresVerification"`
 	SoftExpiry           int64  `json:"softExpiry"`
 	HardExpiry           int64  `json:"hardExpiry"`
+	IssuedAt             int64  `json:"issuedAt,omitempty"`
+
+	// Set while an administrator is impersonating UserId.
+	ImpersonatorId             int64  `json:"impersonatorId,omitempty"`
+	ImpersonatorOrganizationId int64  `json:"impersonatorOrganizationId,omitempty"`
+	ImpersonatorEmail          string `json:"impersonatorEmail,omitempty"`
 }
 
 func (t *AuthToken) ToAgent() string {
+	if t.IsImpersonating() {
+		return impersonationAgent(t.ImpersonatorId, t.UserId)
+	}
 	return fmt.Sprintf("user:%d", t.UserId)
 }
 
+func (t *AuthToken) IsImpersonating() bool {
+	return t.ImpersonatorId != 0
+}
+
+// StartImpersonation returns a token for the target user in the target's
+// organization that remembers the current identity as the impersonator.
+func (t *AuthToken) StartImpersonation(targetId int64, targetOrganizationId int64, targetEmail string) AuthToken {
+	return AuthToken{
+		UserId:                     targetId,
+		OrganizationId:             targetOrganizationId,
+		Email:                      targetEmail,
+		SoftExpiry:                 t.SoftExpiry,
+		HardExpiry:                 t.HardExpiry,
+		IssuedAt:                   t.IssuedAt,
+		ImpersonatorId:             t.UserId,
+		ImpersonatorOrganizationId: t.OrganizationId,
+		ImpersonatorEmail:          t.Email,
+	}
+}
+
+// StopImpersonation returns the impersonator's own token.
+func (t *AuthToken) StopImpersonation() AuthToken {
+	return AuthToken{
+		UserId:         t.ImpersonatorId,
+		OrganizationId: t.ImpersonatorOrganizationId,
+		Email:          t.ImpersonatorEmail,
+		SoftExpiry:     t.SoftExpiry,
+		HardExpiry:     t.HardExpiry,
+		IssuedAt:       t.IssuedAt,
+	}
+}
+
+func (t *AuthToken) ToImpersonation() Impersonation {
+	return Impersonation{
+		ImpersonatorID:    t.ImpersonatorId,
+		ImpersonatorEmail: t.ImpersonatorEmail,
+		UserID:            t.UserId,
+		Email:             t.Email,
+	}
+}
+
+// SessionUserId is the user whose session this is. While impersonating that
+// is the impersonator, so revoking the target's sessions does not end it.
+func (t *AuthToken) SessionUserId() int64 {
+	if t.IsImpersonating() {
+		return t.ImpersonatorId
+	}
+	return t.UserId
+}
+
 func (t *AuthToken) IsExpired() bool {
 	now := time.Now().Unix()
 	return now > t.HardExpiry || now > t.SoftExpiry
@@ -41,6 +100,7 @@ func (t *AuthToken) ToUserIdentity() UserIdentity {
 		UserID:         t.UserId,
 		OrganizationID: t.OrganizationId,
 		Email:          t.Email,
+		ImpersonatorID: t.ImpersonatorId,
 	}
 }
 
@@ -51,18 +111,64 @@ type UserIdentity struct {
 	UserID         int64
 	Email          string
 	OrganizationID int64
+	ImpersonatorID int64
 }
 
 func (u *UserIdentity) ToAgent() string {
+	if u.ImpersonatorID != 0 {
+		return impersonationAgent(u.ImpersonatorID, u.UserID)
+	}
 	return fmt.Sprintf("user:%d", u.UserID)
 }
 
+type ImpersonationContextKey string
+
+const ImpersonationContextKeyStr = ImpersonationContextKey("impersonation")
+
+// Impersonation describes an active impersonation session. It is placed on
+// the request context so layouts and handlers can tell who is really acting.
+type Impersonation struct {
+	ImpersonatorID    int64
+	ImpersonatorEmail string
+	UserID            int64
+	Email             string
+}
+
+func (i Impersonation) ToAgent() string {
+	return impersonationAgent(i.ImpersonatorID, i.UserID)
+}
+
+func WithImpersonation(ctx context.Context, impersonation Impersonation) context.Context {
+	return context.WithValue(ctx, ImpersonationContextKeyStr, impersonation)
+}
+
+func ImpersonationFromContext(ctx context.Context) (Impersonation, bool) {
+	impersonation, ok := ctx.Value(ImpersonationContextKeyStr).(Impersonation)
+	return impersonation, ok
+}
+
+func impersonationAgent(impersonatorId int64, userId int64) string {
+	return fmt.Sprintf("user:%d as user:%d", impersonatorId, userId)
+}
+
 type AuthTokenCookie interface {
 	ToUserIdentity() UserIdentity
 	IsExpired() bool
 	Touch(unixSec int64)
 }
 
+// SessionValidator decides whether an unexpired session token may still be
+// used, for example after the user has been disabled.
+type SessionValidator interface {
+	SessionValid(ctx context.Context, token AuthToken) bool
+}
+
+type SessionValidatorFunc func(ctx context.Context, token AuthToken) bool
+
+func (f SessionValidatorFunc) SessionValid(ctx context.Context, token AuthToken) bool {
+	return f(ctx, token)
+}
+
 type AuthTokenCookieManager interface {
 	ClearAuthTokenCookie(w http.ResponseWriter)
 	ReadAuthTokenCookie(r *http.Request) (bool, AuthToken, error)
@@ -83,6 +189,39 @@ type BaseViewModel struct {
 type LoginViewModel struct {
 	BaseViewModel
 	Error string
+	// EmailLogin offers passwordless login by email.
+	EmailLogin bool
+	// ResendVerification offers to resend the verification email to Email.
+	ResendVerification bool
+	Email              string
+}
+
+// EmailLoginViewModel backs the passwordless login pages. Once Sent is set
+// the page asks for the emailed code.
+type EmailLoginViewModel struct {
+	BaseViewModel
+	Email string
+	Sent  bool
+	Error string
+}
+
+// LoginReportViewModel backs the page behind the "this wasn't me" link in
+// login alert emails.
+type LoginReportViewModel struct {
+	BaseViewModel
+	Token string
+	Done  bool
+	Error string
+}
+
+// VerifyEmailViewModel backs the page behind the link in verification
+// emails and the form for requesting a new link.
+type VerifyEmailViewModel struct {
+	BaseViewModel
+	Verified bool
+	Sent     bool
+	Email    string
+	Error    string
 }
 
 type TwoFactorViewModel struct {
@@ -126,6 +265,9 @@ type OrganizationFormViewModel struct {
 	Organization *ubdata.Organization
 	Error        string
 	FieldErrors  map[string][]string
+	// RoleTemplates names the roles a new organization can be created with.
+	RoleTemplates      []string
+	ApplyRoleTemplates bool
 }
 
 type UsersPageViewModel struct {
@@ -134,6 +276,40 @@ type UsersPageViewModel struct {
 	Query string
 }
 
+type ServiceAccountsPageViewModel struct {
+	BaseViewModel
+	ServiceAccounts []ubdata.ServiceAccount
+	Organizations   []ubdata.Organization
+	OrganizationID  int64
+}
+
+type ServiceAccountOverviewViewModel struct {
+	BaseViewModel
+	ID             int64
+	Name           string
+	Description    string
+	OrganizationID int64
+	Organization   string
+	Disabled       bool
+	CreatedAt      int64
+}
+
+type ServiceAccountFormViewModel struct {
+	BaseViewModel
+	Organizations  []ubdata.Organization
+	OrganizationID int64
+	Name           string
+	Description    string
+	Error          string
+	FieldErrors    map[string][]string
+}
+
+type LoginSearchViewModel struct {
+	BaseViewModel
+	IpAddress string
+	Logins    []ubdata.UserLogin
+}
+
 type UserOverviewViewModel struct {
 	BaseViewModel
 	ID                   int64
@@ -149,6 +325,66 @@ type UserOverviewViewModel struct {
 	FailedLoginAttempts  int64
 	Organizations        []ubdata.Organization
 	SelectedOrganization int64
+	Erased               bool
+	ErasedAt             int64
+	// PlaintextHistory is set for users added before personal data was
+	// sealed, whose earliest events still hold it.
+	PlaintextHistory bool
+	// Tab is the tab shown when the page loads: "overview", "permissions"
+	// or "api-keys".
+	Tab string
+}
+
+// EffectivePermissionsViewModel explains how a user comes to hold their
+// permissions in an organization.
+type EffectivePermissionsViewModel struct {
+	UserID         int64
+	OrganizationID int64
+	// Permission limits the explanation to one permission when set.
+	Permission  string
+	Permissions []EffectivePermission
+	// Excluded explains why none of the user's roles count.
+	Excluded string
+	Error    string
+}
+
+type EffectivePermission struct {
+	Permission RolePermissionItem
+	Grants     []EffectivePermissionGrant
+}
+
+// EffectivePermissionGrant is a role granting a permission, under Policy if
+// it is set.
+type EffectivePermissionGrant struct {
+	RoleID   int64
+	RoleName string
+	Source   string
+	Policy   string
+	// Remaining is the time left on a time-bound membership, such as "3h 10m".
+	Remaining string
+}
+
+// UserRoleMembership is a user's membership of a role, as shown on the user's
+// roles tab.
+type UserRoleMembership struct {
+	InRole bool
+	// Window describes a time-bound membership, such as "3h 10m left" or
+	// "starts in 2d 4h", and is empty otherwise.
+	Window string
+	// Inactive is set when the membership has not started or has expired.
+	Inactive bool
+	// Error explains why the user could not be added to the role.
+	Error string
+}
+
+// UserApiKeysViewModel lists a user's API keys. NewKey is only set right after
+// ReplacedKeyId was rotated, as it cannot be shown again.
+type UserApiKeysViewModel struct {
+	UserID        int64
+	ApiKeys       []ubdata.UserApiKeyNoHash
+	NewKey        string
+	ReplacedKeyId string
+	Error         string
 }
 
 type UserFormViewModel struct {
@@ -189,6 +425,132 @@ type RolePermissionsViewModel struct {
 	MemberSet   map[string]bool
 }
 
+// RolePolicyRow is a permission of a role and the policy it is granted
+// under.
+type RolePolicyRow struct {
+	Permission string
+	Policy     string
+	Error      string
+	Saved      bool
+}
+
+// PolicyDryRunViewModel holds a policy and the sample request it is
+// evaluated against. Settings and request attributes are name=value lines.
+type PolicyDryRunViewModel struct {
+	BaseViewModel
+	Policy               string
+	Time                 string
+	IpAddress            string
+	OrganizationSettings string
+	UserSettings         string
+	RequestAttributes    string
+	Result               PolicyDryRunResult
+}
+
+type PolicyDryRunResult struct {
+	Evaluated bool
+	Allowed   bool
+	Error     string
+	// Attributes are the attributes the policy refers to and their values.
+	Attributes []PolicyAttributeValue
+}
+
+type PolicyAttributeValue struct {
+	Name  string
+	Value string
+}
+
+// RolePermissionItem is a permission on a role's permissions table.
+type RolePermissionItem struct {
+	Name        string
+	Title       string
+	Description string
+	Dangerous   bool
+	// Undeclared permissions are held by the role but missing from the
+	// permission catalog.
+	Undeclared bool
+	InRole     bool
+}
+
+// RolePermissionGroup is a group of permissions from the permission catalog.
+type RolePermissionGroup struct {
+	Name        string
+	Permissions []RolePermissionItem
+}
+
+// PermissionMatrixViewModel is an organization's roles by permissions grid.
+// Cells hold the pending state, which is saved in one operation.
+type PermissionMatrixViewModel struct {
+	BaseViewModel
+	OrganizationID   int64
+	OrganizationName string
+	Roles            []PermissionMatrixRole
+	Groups           []PermissionMatrixGroup
+	Changes          []PermissionMatrixChange
+	Message          string
+	Error            string
+}
+
+type PermissionMatrixRole struct {
+	ID   int64
+	Name string
+}
+
+type PermissionMatrixGroup struct {
+	Name string
+	Rows []PermissionMatrixRow
+}
+
+// PermissionMatrixRow is a permission with a cell for each role, in role
+// order.
+type PermissionMatrixRow struct {
+	Permission RolePermissionItem
+	Cells      []PermissionMatrixCell
+}
+
+type PermissionMatrixCell struct {
+	RoleID  int64
+	Checked bool
+	// Changed cells differ from the role's saved permissions.
+	Changed bool
+}
+
+type PermissionMatrixChange struct {
+	RoleName   string
+	Permission string
+	Grant      bool
+}
+
+// ExclusiveRolesViewModel lists an organization's exclusive role sets and the
+// users who hold more than one role of a set.
+type ExclusiveRolesViewModel struct {
+	BaseViewModel
+	OrganizationID   int64
+	OrganizationName string
+	Roles            []ubdata.RoleRow
+	Sets             []ExclusiveRoleSetRow
+	Violations       []ExclusiveRoleViolationRow
+	// Name and RoleIDs hold the submitted set while it has errors.
+	Name        string
+	RoleIDs     []int64
+	Message     string
+	Error       string
+	FieldErrors map[string][]string
+}
+
+type ExclusiveRoleSetRow struct {
+	Name  string
+	Roles []string
+}
+
+type ExclusiveRoleViolationRow struct {
+	SetName         string
+	UserID          int64
+	UserEmail       string
+	UserDisplayName string
+	Roles           []string
+}
+
 type RoleFormViewModel struct {
 	BaseViewModel
 	IsEdit        bool
@@ -198,3 +560,72 @@ type RoleFormViewModel struct {
 	Error         string
 	FieldErrors   map[string][]string
 }
+
+// AccessRequestsPageViewModel is the inbox of an organization's access
+// requests with a status.
+type AccessRequestsPageViewModel struct {
+	BaseViewModel
+	Status string
+	Rows   []AccessRequestRow
+	Error  string
+}
+
+// AccessRequestRow is an access request and the outcome of deciding it.
+type AccessRequestRow struct {
+	Request ubdata.AccessRequest
+	Message string
+	Error   string
+}
+
+type AccessRequestFormViewModel struct {
+	BaseViewModel
+	Roles         []ubdata.RoleRow
+	RoleID        int64
+	Justification string
+	Message       string
+	Error         string
+	FieldErrors   map[string][]string
+	// Requests are the signed in user's own requests.
+	Requests []ubdata.AccessRequest
+}
+
+// AccessReviewsPageViewModel lists an organization's access reviews.
+type AccessReviewsPageViewModel struct {
+	BaseViewModel
+	Reviews     []ubdata.AccessReview
+	Name        string
+	Error       string
+	FieldErrors map[string][]string
+}
+
+// AccessReviewPageViewModel is an access review and its memberships. Times
+// are unix seconds.
+type AccessReviewPageViewModel struct {
+	BaseViewModel
+	ID        int64
+	Name      string
+	Status    string
+	StartedAt int64
+	ClosedAt  int64
+	Revoked   int
+	Decided   int
+	Rows      []AccessReviewMembershipRow
+	Error     string
+}
+
+// AccessReviewMembershipRow is a membership under review, the decision on it
+// and the outcome of deciding it.
+type AccessReviewMembershipRow struct {
+	ReviewID        int64
+	Open            bool
+	UserID          int64
+	UserEmail       string
+	UserDisplayName string
+	RoleID          int64
+	RoleName        string
+	Decision        string
+	ReviewerEmail   string
+	DecidedAt       int64
+	Comment         string
+	Error           string
+}
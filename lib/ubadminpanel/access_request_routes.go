@@ -0,0 +1,230 @@
+package ubadminpanel
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/contracts"
+	"github.com/kernelplex/ubase/lib/ubadminpanel/templ/views"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubresponse"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+// requireIdentity returns the signed in user, redirecting to the login page
+// when there is none.
+func requireIdentity(w http.ResponseWriter, r *http.Request, cookieManager contracts.AuthTokenCookieManager) (contracts.UserIdentity, bool) {
+	identity, found := cookieManager.IdentityFromContext(r.Context())
+	if !found || identity.UserID == 0 || identity.OrganizationID == 0 {
+		if isHTMX(r) {
+			w.Header().Set("HX-Redirect", "/admin/login")
+			w.WriteHeader(http.StatusOK)
+		} else {
+			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+		}
+		return identity, false
+	}
+	return identity, true
+}
+
+func accessRequestStatus(status string) string {
+	switch status {
+	case ubmanage.AccessRequestApproved, ubmanage.AccessRequestDenied:
+		return status
+	}
+	return ubmanage.AccessRequestPending
+}
+
+// AccessRequestsRoute renders the access request inbox of the signed in
+// user's organization.
+func AccessRequestsRoute(mgmt ubmanage.ManagementService,
+	cookieManager contracts.AuthTokenCookieManager,
+	adminLinkService contracts.AdminLinkService) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := requireIdentity(w, r, cookieManager)
+		if !ok {
+			return
+		}
+		status := accessRequestStatus(r.URL.Query().Get("status"))
+		resp, err := mgmt.AccessRequestListByOrganization(r.Context(), identity.OrganizationID, status)
+		if err != nil || resp.Status != ubstatus.Success {
+			slog.Error("access request list error", "error", err, "status", resp.Status)
+			http.Error(w, "Failed to list access requests", http.StatusInternalServerError)
+			return
+		}
+		rows := make([]contracts.AccessRequestRow, 0, len(resp.Data))
+		for _, request := range resp.Data {
+			rows = append(rows, contracts.AccessRequestRow{Request: request})
+		}
+		if isHTMX(r) {
+			_ = views.AccessRequestsTable(rows).Render(r.Context(), w)
+			return
+		}
+		_ = views.AccessRequestsPage(contracts.AccessRequestsPageViewModel{
+			BaseViewModel: contracts.BaseViewModel{
+				Fragment: false,
+				Links:    adminLinkService.GetLinks(r),
+			},
+			Status: status,
+			Rows:   rows,
+		}).Render(r.Context(), w)
+	}
+	return contracts.Route{
+		Path:               "GET " + ubmanage.AccessRequestsPath,
+		RequiresPermission: PermApproveAccessRequests,
+		Func:               handler,
+	}
+}
+
+// AccessRequestDecideRoute approves or denies a pending access request and
+// re-renders its row. The signed in user is the approver.
+func AccessRequestDecideRoute(mgmt ubmanage.ManagementService, cookieManager contracts.AuthTokenCookieManager) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := requireIdentity(w, r, cookieManager)
+		if !ok {
+			return
+		}
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		comment := strings.TrimSpace(r.FormValue("comment"))
+
+		var resp ubresponse.Response[any]
+		switch r.PathValue("decision") {
+		case "approve":
+			var expiresAt time.Time
+			if hours, err := strconv.Atoi(r.FormValue("expires_in")); err == nil && hours > 0 {
+				expiresAt = time.Now().Add(time.Duration(hours) * time.Hour)
+			}
+			resp, err = mgmt.AccessRequestApprove(r.Context(), ubmanage.AccessRequestApproveCommand{
+				Id:         id,
+				ApproverId: identity.UserID,
+				ExpiresAt:  expiresAt,
+				Comment:    comment,
+			}, identity.ToAgent())
+		case "deny":
+			resp, err = mgmt.AccessRequestDeny(r.Context(), ubmanage.AccessRequestDenyCommand{
+				Id:         id,
+				ApproverId: identity.UserID,
+				Comment:    comment,
+			}, identity.ToAgent())
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		row := contracts.AccessRequestRow{}
+		switch {
+		case err != nil:
+			row.Error = "Failed to decide the access request"
+		case resp.Status == ubstatus.ValidationError && len(resp.ValidationIssues) > 0:
+			for _, issue := range resp.ValidationIssues {
+				row.Error = strings.Join(issue.Error, ", ")
+			}
+		case resp.Status != ubstatus.Success:
+			row.Error = resp.Message
+		}
+
+		request, getErr := mgmt.AccessRequestGet(r.Context(), id)
+		if getErr != nil || request.Status != ubstatus.Success {
+			http.NotFound(w, r)
+			return
+		}
+		row.Request = request.Data
+		if row.Error == "" {
+			row.Message = "The request was " + row.Request.Status + "."
+		}
+		_ = views.AccessRequestRow(row).Render(r.Context(), w)
+	}
+	return contracts.Route{
+		Path:               "POST " + ubmanage.AccessRequestsPath + "/{id}/{decision}",
+		RequiresPermission: PermApproveAccessRequests,
+		Func:               handler,
+	}
+}
+
+// AccessRequestFormRoute renders the form to request a role in the signed
+// in user's organization, along with the user's own requests.
+func AccessRequestFormRoute(mgmt ubmanage.ManagementService,
+	cookieManager contracts.AuthTokenCookieManager,
+	adminLinkService contracts.AdminLinkService) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := requireIdentity(w, r, cookieManager)
+		if !ok {
+			return
+		}
+		vm := contracts.AccessRequestFormViewModel{
+			BaseViewModel: contracts.BaseViewModel{
+				Fragment: isHTMX(r),
+				Links:    adminLinkService.GetLinks(r),
+			},
+		}
+		if r.Method == http.MethodPost {
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+			vm.RoleID, _ = strconv.ParseInt(r.FormValue("role_id"), 10, 64)
+			vm.Justification = r.FormValue("justification")
+			resp, err := mgmt.AccessRequestCreate(r.Context(), ubmanage.AccessRequestCreateCommand{
+				UserId:        identity.UserID,
+				RoleId:        vm.RoleID,
+				Justification: vm.Justification,
+			}, identity.ToAgent())
+			switch {
+			case err != nil:
+				vm.Error = "Failed to request access"
+			case resp.Status == ubstatus.ValidationError && len(resp.ValidationIssues) > 0:
+				vm.FieldErrors = map[string][]string{}
+				for _, issue := range resp.ValidationIssues {
+					vm.FieldErrors[issue.Field] = append(vm.FieldErrors[issue.Field], issue.Error...)
+				}
+			case resp.Status != ubstatus.Success:
+				vm.Error = resp.Message
+			default:
+				vm.Message = "Your request was sent to the approvers."
+				vm.RoleID = 0
+				vm.Justification = ""
+			}
+		}
+		if !loadAccessRequestForm(r, mgmt, identity, &vm) {
+			http.Error(w, "Failed to load access requests", http.StatusInternalServerError)
+			return
+		}
+		_ = views.AccessRequestForm(vm).Render(r.Context(), w)
+	}
+	return contracts.Route{
+		Path: ubmanage.AccessRequestsPath + "/new",
+		Func: handler,
+	}
+}
+
+// loadAccessRequestForm fills in the roles of the organization and the
+// user's own requests.
+func loadAccessRequestForm(r *http.Request,
+	mgmt ubmanage.ManagementService,
+	identity contracts.UserIdentity,
+	vm *contracts.AccessRequestFormViewModel) bool {
+	roles, err := mgmt.RoleList(r.Context(), identity.OrganizationID)
+	if err != nil || roles.Status != ubstatus.Success {
+		slog.Error("role list error", "error", err, "status", roles.Status)
+		return false
+	}
+	requests, err := mgmt.AccessRequestListByUser(r.Context(), identity.UserID)
+	if err != nil || requests.Status != ubstatus.Success {
+		slog.Error("access request list error", "error", err, "status", requests.Status)
+		return false
+	}
+	vm.Roles = roles.Data
+	vm.Requests = requests.Data
+	return true
+}
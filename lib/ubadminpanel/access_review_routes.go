@@ -0,0 +1,313 @@
+package ubadminpanel
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/kernelplex/ubase/lib/contracts"
+	"github.com/kernelplex/ubase/lib/ubadminpanel/templ/views"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+const accessReviewsPath = "/admin/access-reviews"
+
+func accessReviewMembershipRow(id int64, state ubmanage.AccessReviewState, membership ubmanage.AccessReviewMembershipDetails) contracts.AccessReviewMembershipRow {
+	return contracts.AccessReviewMembershipRow{
+		ReviewID:        id,
+		Open:            state.Status == ubmanage.AccessReviewOpen,
+		UserID:          membership.UserId,
+		UserEmail:       membership.UserEmail,
+		UserDisplayName: membership.UserDisplayName,
+		RoleID:          membership.RoleId,
+		RoleName:        membership.RoleName,
+		Decision:        membership.Decision,
+		ReviewerEmail:   membership.ReviewerEmail,
+		DecidedAt:       membership.DecidedAt,
+		Comment:         membership.Comment,
+	}
+}
+
+// loadAccessReview loads the access review in the path, responding with not
+// found unless it belongs to the signed in user's organization.
+func loadAccessReview(w http.ResponseWriter, r *http.Request,
+	mgmt ubmanage.ManagementService,
+	identity contracts.UserIdentity) (ubmanage.AccessReviewAggregate, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.NotFound(w, r)
+		return ubmanage.AccessReviewAggregate{}, false
+	}
+	resp, err := mgmt.AccessReviewGet(r.Context(), id)
+	if err != nil || resp.Status != ubstatus.Success || resp.Data.State.OrganizationId != identity.OrganizationID {
+		http.NotFound(w, r)
+		return ubmanage.AccessReviewAggregate{}, false
+	}
+	return resp.Data, true
+}
+
+func renderAccessReviews(w http.ResponseWriter, r *http.Request,
+	mgmt ubmanage.ManagementService,
+	identity contracts.UserIdentity,
+	adminLinkService contracts.AdminLinkService,
+	vm contracts.AccessReviewsPageViewModel) {
+	resp, err := mgmt.AccessReviewListByOrganization(r.Context(), identity.OrganizationID)
+	if err != nil || resp.Status != ubstatus.Success {
+		slog.Error("access review list error", "error", err, "status", resp.Status)
+		http.Error(w, "Failed to list access reviews", http.StatusInternalServerError)
+		return
+	}
+	vm.BaseViewModel = contracts.BaseViewModel{
+		Fragment: isHTMX(r),
+		Links:    adminLinkService.GetLinks(r),
+	}
+	vm.Reviews = resp.Data
+	_ = views.AccessReviewsPage(vm).Render(r.Context(), w)
+}
+
+// AccessReviewsRoute lists the access reviews of the signed in user's
+// organization.
+func AccessReviewsRoute(mgmt ubmanage.ManagementService,
+	cookieManager contracts.AuthTokenCookieManager,
+	adminLinkService contracts.AdminLinkService) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := requireIdentity(w, r, cookieManager)
+		if !ok {
+			return
+		}
+		renderAccessReviews(w, r, mgmt, identity, adminLinkService, contracts.AccessReviewsPageViewModel{})
+	}
+	return contracts.Route{
+		Path:               "GET " + accessReviewsPath,
+		RequiresPermission: PermReviewAccess,
+		Func:               handler,
+	}
+}
+
+// AccessReviewStartRoute starts an access review of the signed in user's
+// organization.
+func AccessReviewStartRoute(mgmt ubmanage.ManagementService,
+	cookieManager contracts.AuthTokenCookieManager,
+	adminLinkService contracts.AdminLinkService) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := requireIdentity(w, r, cookieManager)
+		if !ok {
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		vm := contracts.AccessReviewsPageViewModel{Name: r.FormValue("name")}
+		resp, err := mgmt.AccessReviewStart(r.Context(), ubmanage.AccessReviewStartCommand{
+			OrganizationId: identity.OrganizationID,
+			Name:           vm.Name,
+		}, identity.ToAgent())
+		switch {
+		case err != nil:
+			vm.Error = "Failed to start the access review"
+		case resp.Status == ubstatus.ValidationError && len(resp.ValidationIssues) > 0:
+			vm.FieldErrors = map[string][]string{}
+			for _, issue := range resp.ValidationIssues {
+				vm.FieldErrors[issue.Field] = append(vm.FieldErrors[issue.Field], issue.Error...)
+			}
+		case resp.Status != ubstatus.Success:
+			vm.Error = resp.Message
+		default:
+			dest := accessReviewsPath + "/" + strconv.FormatInt(resp.Data.Id, 10)
+			if isHTMX(r) {
+				w.Header().Set("HX-Redirect", dest)
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			http.Redirect(w, r, dest, http.StatusSeeOther)
+			return
+		}
+		renderAccessReviews(w, r, mgmt, identity, adminLinkService, vm)
+	}
+	return contracts.Route{
+		Path:               "POST " + accessReviewsPath,
+		RequiresPermission: PermManageAccessReviews,
+		Func:               handler,
+	}
+}
+
+// AccessReviewRoute renders an access review with its memberships.
+func AccessReviewRoute(mgmt ubmanage.ManagementService,
+	cookieManager contracts.AuthTokenCookieManager,
+	adminLinkService contracts.AdminLinkService) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := requireIdentity(w, r, cookieManager)
+		if !ok {
+			return
+		}
+		review, ok := loadAccessReview(w, r, mgmt, identity)
+		if !ok {
+			return
+		}
+		state := review.State
+		vm := contracts.AccessReviewPageViewModel{
+			BaseViewModel: contracts.BaseViewModel{
+				Fragment: isHTMX(r),
+				Links:    adminLinkService.GetLinks(r),
+			},
+			ID:        review.Id,
+			Name:      state.Name,
+			Status:    state.Status,
+			StartedAt: state.StartedAt,
+			ClosedAt:  state.ClosedAt,
+			Revoked:   state.Revoked,
+			Decided:   state.Decided(),
+			Error:     r.URL.Query().Get("error"),
+		}
+		memberships, err := mgmt.AccessReviewMemberships(r.Context(), state.OrganizationId, state.Memberships)
+		if err != nil || memberships.Status != ubstatus.Success {
+			slog.Error("access review memberships error", "error", err, "status", memberships.Status)
+			http.Error(w, "Failed to load the access review", http.StatusInternalServerError)
+			return
+		}
+		for _, membership := range memberships.Data {
+			vm.Rows = append(vm.Rows, accessReviewMembershipRow(review.Id, state, membership))
+		}
+		_ = views.AccessReviewPage(vm).Render(r.Context(), w)
+	}
+	return contracts.Route{
+		Path:               "GET " + accessReviewsPath + "/{id}",
+		RequiresPermission: PermReviewAccess,
+		Func:               handler,
+	}
+}
+
+// AccessReviewDecideRoute records the signed in user's decision on a
+// membership and re-renders its row.
+func AccessReviewDecideRoute(mgmt ubmanage.ManagementService, cookieManager contracts.AuthTokenCookieManager) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := requireIdentity(w, r, cookieManager)
+		if !ok {
+			return
+		}
+		review, ok := loadAccessReview(w, r, mgmt, identity)
+		if !ok {
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		userId, _ := strconv.ParseInt(r.FormValue("user_id"), 10, 64)
+		roleId, _ := strconv.ParseInt(r.FormValue("role_id"), 10, 64)
+		i := review.State.Membership(userId, roleId)
+		if i < 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		resp, err := mgmt.AccessReviewDecide(r.Context(), ubmanage.AccessReviewDecideCommand{
+			Id:         review.Id,
+			UserId:     userId,
+			RoleId:     roleId,
+			Decision:   r.FormValue("decision"),
+			ReviewerId: identity.UserID,
+			Comment:    strings.TrimSpace(r.FormValue("comment")),
+		}, identity.ToAgent())
+		var rowError string
+		switch {
+		case err != nil:
+			rowError = "Failed to record the decision"
+		case resp.Status == ubstatus.ValidationError && len(resp.ValidationIssues) > 0:
+			for _, issue := range resp.ValidationIssues {
+				rowError = strings.Join(issue.Error, ", ")
+			}
+		case resp.Status != ubstatus.Success:
+			rowError = resp.Message
+		default:
+			if reloaded, err := mgmt.AccessReviewGet(r.Context(), review.Id); err == nil && reloaded.Status == ubstatus.Success {
+				review = reloaded.Data
+			}
+		}
+		memberships, err := mgmt.AccessReviewMemberships(r.Context(), review.State.OrganizationId, review.State.Memberships[i:i+1])
+		if err != nil || memberships.Status != ubstatus.Success {
+			slog.Error("access review memberships error", "error", err, "status", memberships.Status)
+			http.Error(w, "Failed to load the access review", http.StatusInternalServerError)
+			return
+		}
+		row := accessReviewMembershipRow(review.Id, review.State, memberships.Data[0])
+		row.Error = rowError
+		_ = views.AccessReviewMembershipRow(row).Render(r.Context(), w)
+	}
+	return contracts.Route{
+		Path:               "POST " + accessReviewsPath + "/{id}/decide",
+		RequiresPermission: PermReviewAccess,
+		Func:               handler,
+	}
+}
+
+// AccessReviewCloseRoute closes an access review, removing the revoked
+// memberships.
+func AccessReviewCloseRoute(mgmt ubmanage.ManagementService, cookieManager contracts.AuthTokenCookieManager) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := requireIdentity(w, r, cookieManager)
+		if !ok {
+			return
+		}
+		review, ok := loadAccessReview(w, r, mgmt, identity)
+		if !ok {
+			return
+		}
+		dest := accessReviewsPath + "/" + strconv.FormatInt(review.Id, 10)
+		resp, err := mgmt.AccessReviewClose(r.Context(), ubmanage.AccessReviewCloseCommand{Id: review.Id}, identity.ToAgent())
+		if err != nil || resp.Status != ubstatus.Success {
+			slog.Error("access review close error", "error", err, "status", resp.Status)
+			message := resp.Message
+			if err != nil || message == "" {
+				message = "Failed to close the access review"
+			}
+			dest += "?error=" + url.QueryEscape(message)
+		}
+		if isHTMX(r) {
+			w.Header().Set("HX-Redirect", dest)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.Redirect(w, r, dest, http.StatusSeeOther)
+	}
+	return contracts.Route{
+		Path:               "POST " + accessReviewsPath + "/{id}/close",
+		RequiresPermission: PermManageAccessReviews,
+		Func:               handler,
+	}
+}
+
+// AccessReviewExportRoute downloads the signed report of an access review.
+func AccessReviewExportRoute(mgmt ubmanage.ManagementService, cookieManager contracts.AuthTokenCookieManager) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := requireIdentity(w, r, cookieManager)
+		if !ok {
+			return
+		}
+		review, ok := loadAccessReview(w, r, mgmt, identity)
+		if !ok {
+			return
+		}
+		resp, err := mgmt.AccessReviewExport(r.Context(), review.Id, r.URL.Query().Get("format"))
+		switch {
+		case err != nil:
+			http.Error(w, "Failed to export the access review", http.StatusInternalServerError)
+			return
+		case resp.Status != ubstatus.Success:
+			http.Error(w, resp.Message, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", resp.Data.ContentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+resp.Data.FileName+`"`)
+		_, _ = w.Write(resp.Data.Data)
+	}
+	return contracts.Route{
+		Path:               "GET " + accessReviewsPath + "/{id}/export",
+		RequiresPermission: PermManageAccessReviews,
+		Func:               handler,
+	}
+}
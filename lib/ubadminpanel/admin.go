@@ -25,6 +25,15 @@ func isHTMX(r *http.Request) bool {
 // IsHTMX is an exported helper for consumers to detect HTMX requests.
 func IsHTMX(r *http.Request) bool { return isHTMX(r) }
 
+// requestAgent returns the agent to record for writes made by the request.
+// Writes made while impersonating are attributed to both users.
+func requestAgent(r *http.Request) string {
+	if impersonation, ok := contracts.ImpersonationFromContext(r.Context()); ok {
+		return impersonation.ToAgent()
+	}
+	return "web:ubadminpanel"
+}
+
 type AdminRendererImpl struct {
 	adminLinkService contracts.AdminLinkService
 	stylesheets      []string
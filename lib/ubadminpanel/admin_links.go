@@ -5,6 +5,7 @@ import (
 
 	"github.com/kernelplex/ubase/lib/contracts"
 	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubwww"
 )
 
 type AdminLinkServiceImpl struct {
@@ -24,25 +25,36 @@ func NewAdminLinkService(
 }
 
 func (als *AdminLinkServiceImpl) GetLinks(r *http.Request) *contracts.AdminSectionLinks {
-	identity, found := als.cookieManager.IdentityFromContext(r.Context())
+	permissions := als.permissions(r)
 
 	linksToShow := contracts.AdminSectionLinks{}
 	for _, link := range als.links {
-		if link.RequiredPermission == "" {
-			linksToShow.Add(link)
-			continue
-		}
-		if !found || identity.UserID == 0 || identity.OrganizationID == 0 {
-			continue
-		}
-		hasPermission, err := als.prefectService.UserHasPermission(r.Context(), identity.UserID, identity.OrganizationID, link.RequiredPermission)
-		if err == nil && hasPermission {
+		if link.RequiredPermission == "" || permissions.Has(link.RequiredPermission) {
 			linksToShow.Add(link)
 		}
 	}
 	return &linksToShow
 }
 
+// permissions returns the permissions the signed in user holds for the
+// request, from the request context when the permission middleware has loaded
+// them.
+func (als *AdminLinkServiceImpl) permissions(r *http.Request) contracts.Permissions {
+	if permissions, ok := contracts.PermissionsFromContext(r.Context()); ok {
+		return permissions
+	}
+	identity, found := als.cookieManager.IdentityFromContext(r.Context())
+	if !found || identity.UserID == 0 || identity.OrganizationID == 0 {
+		return nil
+	}
+	permissions, err := als.prefectService.UserPermissionsFor(r.Context(), identity.UserID, identity.OrganizationID,
+		ubmanage.PolicyInput{IpAddress: ubwww.RemoteIP(r)})
+	if err != nil {
+		return nil
+	}
+	return contracts.Permissions(permissions)
+}
+
 func (als *AdminLinkServiceImpl) AddLink(link contracts.AdminLink) {
 	als.links = append(als.links, link)
 }
@@ -53,5 +65,11 @@ func getAdminLinks() []contracts.AdminLink {
 		{Title: "Dashboard", Icon: "home", Path: "/admin/", HtmxAware: true, RequiredPermission: PermSystemAdmin, Section: "General"},
 		{Title: "Organizations", Icon: "building", Path: "/admin/organizations", HtmxAware: true, RequiredPermission: PermSystemAdmin, Section: "System"},
 		{Title: "Users", Icon: "users", Path: "/admin/users", HtmxAware: true, RequiredPermission: PermSystemAdmin, Section: "System"},
+		{Title: "Service Accounts", Icon: "key", Path: "/admin/service-accounts", HtmxAware: true, RequiredPermission: PermSystemAdmin, Section: "System"},
+		{Title: "Login Search", Icon: "search", Path: "/admin/logins", HtmxAware: true, RequiredPermission: PermSystemAdmin, Section: "System"},
+		{Title: "Policy Dry Run", Icon: "shield", Path: "/admin/policies/dry-run", HtmxAware: true, RequiredPermission: PermSystemAdmin, Section: "System"},
+		{Title: "Access Requests", Icon: "inbox", Path: ubmanage.AccessRequestsPath, HtmxAware: true, RequiredPermission: PermApproveAccessRequests, Section: "Access"},
+		{Title: "Access Reviews", Icon: "check", Path: accessReviewsPath, HtmxAware: true, RequiredPermission: PermReviewAccess, Section: "Access"},
+		{Title: "Request Access", Icon: "key", Path: ubmanage.AccessRequestsPath + "/new", HtmxAware: true, Section: "Access"},
 	}
 }
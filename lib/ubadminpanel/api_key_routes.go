@@ -0,0 +1,93 @@
+package ubadminpanel
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/contracts"
+	"github.com/kernelplex/ubase/lib/ubadminpanel/templ/views"
+	"github.com/kernelplex/ubase/lib/ubdata"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+func renderUserApiKeys(w http.ResponseWriter, r *http.Request, adapter ubdata.DataAdapter, vm contracts.UserApiKeysViewModel) {
+	keys, err := adapter.UserListApiKeys(r.Context(), vm.UserID)
+	if err != nil {
+		slog.Error("failed to list api keys", "error", err, "id", vm.UserID)
+		http.Error(w, "Failed to load API keys", http.StatusInternalServerError)
+		return
+	}
+	vm.ApiKeys = keys
+	_ = views.UserApiKeys(vm).Render(r.Context(), w)
+}
+
+// UserApiKeysRoute renders the API keys tab of the user overview
+func UserApiKeysRoute(adapter ubdata.DataAdapter) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+		renderUserApiKeys(w, r, adapter, contracts.UserApiKeysViewModel{UserID: id})
+	}
+
+	return contracts.Route{
+		Path:               "GET /admin/users/{id}/api-keys",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
+
+// UserApiKeyRotateRoute issues a replacement for an API key and shows it once
+func UserApiKeyRotateRoute(adapter ubdata.DataAdapter, mgmt ubmanage.ManagementService) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		grace := ubmanage.DefaultApiKeyRotationGracePeriod
+		if v := r.FormValue("grace_hours"); v != "" {
+			hours, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+			grace = time.Duration(hours) * time.Hour
+		}
+
+		vm := contracts.UserApiKeysViewModel{UserID: id}
+		resp, err := mgmt.UserRotateApiKey(r.Context(), ubmanage.UserRotateApiKeyCommand{
+			UserId:      id,
+			ApiKeyId:    r.PathValue("keyId"),
+			GracePeriod: grace,
+		}, requestAgent(r))
+		if err != nil || resp.Status != ubstatus.Success {
+			if err != nil {
+				slog.Error("api key rotate error", "error", err, "id", id)
+			}
+			vm.Error = resp.Message
+			if vm.Error == "" {
+				vm.Error = "Failed to rotate API key"
+			}
+		} else {
+			vm.NewKey = resp.Data
+			vm.ReplacedKeyId = r.PathValue("keyId")
+		}
+		renderUserApiKeys(w, r, adapter, vm)
+	}
+
+	return contracts.Route{
+		Path:               "POST /admin/users/{id}/api-keys/{keyId}/rotate",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
@@ -1,6 +1,7 @@
 package ubadminpanel
 
 import (
+	"encoding/hex"
 	"log/slog"
 	"net/http"
 	"strconv"
@@ -11,18 +12,141 @@ import (
 	"github.com/kernelplex/ubase/lib/ensure"
 	"github.com/kernelplex/ubase/lib/ubadminpanel/templ/views"
 	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubresponse"
+	"github.com/kernelplex/ubase/lib/ubsecurity"
 	"github.com/kernelplex/ubase/lib/ubstatus"
+	"github.com/kernelplex/ubase/lib/ubwww"
 )
 
+// DeviceCookieName is the cookie used to recognise a browser across logins.
+const DeviceCookieName = "ubase_device"
+
+const deviceCookieMaxAge = 400 * 24 * 60 * 60
+
+// loginClient describes the client making a login request, issuing a device
+// cookie if the browser does not have one yet.
+func loginClient(w http.ResponseWriter, r *http.Request) ubmanage.LoginClient {
+	deviceId := ""
+	if cookie, err := r.Cookie(DeviceCookieName); err == nil && isDeviceId(cookie.Value) {
+		deviceId = cookie.Value
+	} else {
+		deviceId = hex.EncodeToString(ubsecurity.GenerateSecureRandom(16))
+	}
+	// Refresh the cookie on every login so active devices keep it.
+	http.SetCookie(w, &http.Cookie{
+		Name:     DeviceCookieName,
+		Value:    deviceId,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   deviceCookieMaxAge,
+		Path:     "/",
+	})
+
+	return ubmanage.LoginClient{
+		IpAddress: ubwww.RemoteIP(r),
+		UserAgent: r.UserAgent(),
+		DeviceId:  deviceId,
+	}
+}
+
+func isDeviceId(value string) bool {
+	if len(value) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
+
+// writeRateLimited sets the Retry-After header and the 429 status for a
+// rate limited attempt; the caller renders the body.
+func writeRateLimited(w http.ResponseWriter, retryAfter int64) {
+	w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	w.WriteHeader(http.StatusTooManyRequests)
+}
+
+const rateLimitedMessage = "Too many attempts. Try again later."
+
+// RateLimitedLogin renders the login form for requests rejected by rate
+// limiting middleware, which has already set the Retry-After header.
+func RateLimitedLogin(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.WriteHeader(http.StatusTooManyRequests)
+	_ = views.Login(contracts.LoginViewModel{
+		BaseViewModel: contracts.BaseViewModel{Fragment: isHTMX(r)},
+		Error:         rateLimitedMessage,
+	}).Render(r.Context(), w)
+}
+
+// RateLimitedEmailLogin renders the email login form for requests rejected
+// by rate limiting middleware.
+func RateLimitedEmailLogin(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.WriteHeader(http.StatusTooManyRequests)
+	_ = views.EmailLogin(contracts.EmailLoginViewModel{
+		BaseViewModel: contracts.BaseViewModel{Fragment: isHTMX(r)},
+		Email:         strings.TrimSpace(r.FormValue("email")),
+		Error:         rateLimitedMessage,
+	}).Render(r.Context(), w)
+}
+
+// RateLimitedVerifyEmail renders the verification resend form for requests
+// rejected by rate limiting middleware.
+func RateLimitedVerifyEmail(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.WriteHeader(http.StatusTooManyRequests)
+	_ = views.VerifyEmail(contracts.VerifyEmailViewModel{
+		BaseViewModel: contracts.BaseViewModel{Fragment: isHTMX(r)},
+		Email:         strings.TrimSpace(r.FormValue("email")),
+		Error:         rateLimitedMessage,
+	}).Render(r.Context(), w)
+}
+
+// RateLimitedTwoFactor renders the two factor form for requests rejected by
+// rate limiting middleware.
+func RateLimitedTwoFactor(adminLinkService contracts.AdminLinkService) func(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	return func(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+		userId, _ := strconv.ParseInt(r.FormValue("user_id"), 10, 64)
+		w.WriteHeader(http.StatusTooManyRequests)
+		_ = views.TwoFactor(contracts.TwoFactorViewModel{
+			BaseViewModel: contracts.BaseViewModel{
+				Fragment: isHTMX(r),
+				Links:    adminLinkService.GetLinks(r),
+			},
+			UserID: userId,
+			Error:  rateLimitedMessage,
+		}).Render(r.Context(), w)
+	}
+}
+
+type loginRouteOptions struct {
+	emailLogin bool
+}
+
+type LoginRouteOption func(*loginRouteOptions)
+
+// WithEmailLoginLink links the login form to the passwordless email login
+// pages served by EmailLoginRoute.
+func WithEmailLoginLink() LoginRouteOption {
+	return func(o *loginRouteOptions) {
+		o.emailLogin = true
+	}
+}
+
 // LoginRoute handles GET (render form) and POST (authenticate).
 func LoginRoute(
 	primaryOrganization int64,
 	mgmt ubmanage.ManagementService,
 	cookieManager contracts.AuthTokenCookieManager,
 	adminLinkService contracts.AdminLinkService,
+	opts ...LoginRouteOption,
 ) contracts.Route {
 	ensure.That(primaryOrganization > 0, "primary organization must be set and greater than zero")
 
+	options := loginRouteOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&options)
+		}
+	}
+
 	return contracts.Route{
 		Path: "/admin/login",
 		Func: func(w http.ResponseWriter, r *http.Request) {
@@ -31,6 +155,7 @@ func LoginRoute(
 				component := views.Login(contracts.LoginViewModel{
 					BaseViewModel: contracts.BaseViewModel{Fragment: isHTMX(r)},
 					Error:         "",
+					EmailLogin:    options.emailLogin,
 				})
 				_ = component.Render(r.Context(), w)
 				return
@@ -46,7 +171,7 @@ func LoginRoute(
 				email := strings.TrimSpace(r.FormValue("email"))
 				password := r.FormValue("password")
 
-				resp, err := mgmt.UserAuthenticate(r.Context(), ubmanage.UserLoginCommand{Email: email, Password: password}, "web:ubadminpanel")
+				resp, err := mgmt.UserAuthenticate(r.Context(), ubmanage.UserLoginCommand{Email: email, Password: password, Client: loginClient(w, r)}, "web:ubadminpanel")
 				if err != nil {
 					slog.Error("auth error", "error", err)
 					_ = views.Login(contracts.LoginViewModel{
@@ -68,6 +193,7 @@ func LoginRoute(
 						RequiresVerification: resp.Data.RequiresVerification,
 						SoftExpiry:           now + 3600,
 						HardExpiry:           now + 86400,
+						IssuedAt:             now,
 					}
 					if err := cookieManager.WriteAuthTokenCookie(w, token); err != nil {
 						slog.Error("write cookie error", "error", err)
@@ -84,6 +210,13 @@ func LoginRoute(
 					}
 					http.Redirect(w, r, "/admin", http.StatusSeeOther)
 					return
+				case ubstatus.RateLimited:
+					writeRateLimited(w, resp.RetryAfter)
+					_ = views.Login(contracts.LoginViewModel{
+						BaseViewModel: contracts.BaseViewModel{Fragment: isHTMX(r)},
+						Error:         resp.Message,
+					}).Render(r.Context(), w)
+					return
 				case ubstatus.PartialSuccess:
 					if resp.Data.RequiresTwoFactor {
 						_ = views.TwoFactor(contracts.TwoFactorViewModel{
@@ -101,7 +234,9 @@ func LoginRoute(
 							Fragment: isHTMX(r),
 							Links:    adminLinkService.GetLinks(r),
 						},
-						Error: "Please verify your email before logging in.",
+						Error:              "Please verify your email before logging in.",
+						ResendVerification: true,
+						Email:              email,
 					}).Render(r.Context(), w)
 					return
 				default:
@@ -151,11 +286,14 @@ func VerifyTwoFactorRoute(
 			code := strings.TrimSpace(r.FormValue("code"))
 			userId, _ := strconv.ParseInt(idStr, 10, 64)
 
-			verifyResp, err := mgmt.UserVerifyTwoFactorCode(r.Context(), ubmanage.UserVerifyTwoFactorLoginCommand{UserId: userId, Code: code}, "web:ubadminpanel")
+			verifyResp, err := mgmt.UserVerifyTwoFactorCode(r.Context(), ubmanage.UserVerifyTwoFactorLoginCommand{UserId: userId, Code: code, Client: loginClient(w, r)}, "web:ubadminpanel")
 			if err != nil || verifyResp.Status != ubstatus.Success {
 				msg := "Two factor code does not match"
 				if err != nil {
 					slog.Error("2fa error", "error", err)
+				} else if verifyResp.Status == ubstatus.RateLimited {
+					msg = verifyResp.Message
+					writeRateLimited(w, verifyResp.RetryAfter)
 				}
 				_ = views.TwoFactor(contracts.TwoFactorViewModel{
 					BaseViewModel: contracts.BaseViewModel{
@@ -177,6 +315,7 @@ func VerifyTwoFactorRoute(
 				RequiresVerification: false,
 				SoftExpiry:           now + 3600,
 				HardExpiry:           now + 86400,
+				IssuedAt:             now,
 			}
 
 			if err := cookieManager.WriteAuthTokenCookie(w, token); err != nil {
@@ -220,3 +359,353 @@ func LogoutRoute(cookieManager contracts.AuthTokenCookieManager) contracts.Route
 		},
 	}
 }
+
+// StopImpersonationRoute ends the current impersonation session and restores
+// the impersonator's own session. It requires no permission since the target
+// user may not hold any.
+func StopImpersonationRoute(mgmt ubmanage.ManagementService, cookieManager contracts.AuthTokenCookieManager) contracts.Route {
+	return contracts.Route{
+		Path: "POST /admin/impersonation/stop",
+		Func: func(w http.ResponseWriter, r *http.Request) {
+			token, found := cookieManager.TokenFromContext(r.Context())
+			if !found || !token.IsImpersonating() {
+				http.Error(w, "Not impersonating", http.StatusBadRequest)
+				return
+			}
+
+			_, err := mgmt.UserStopImpersonation(r.Context(), ubmanage.UserStopImpersonationCommand{
+				ImpersonatorId: token.ImpersonatorId,
+				TargetId:       token.UserId,
+			}, token.ToAgent())
+			if err != nil {
+				// The session is still ended so the impersonator is never
+				// stuck as the target.
+				slog.Error("failed to record end of impersonation", "error", err)
+			}
+
+			if err := cookieManager.WriteAuthTokenCookie(w, token.StopImpersonation()); err != nil {
+				slog.Error("write cookie error", "error", err)
+				cookieManager.ClearAuthTokenCookie(w)
+			}
+
+			dest := "/admin/users/" + strconv.FormatInt(token.UserId, 10)
+			if isHTMX(r) {
+				w.Header().Set("HX-Redirect", dest)
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			http.Redirect(w, r, dest, http.StatusSeeOther)
+		},
+	}
+}
+
+// LoginReportRoute serves the "this wasn't me" link from login alert emails.
+// GET asks for confirmation so link scanners cannot disable the account; POST
+// disables the account and revokes its sessions.
+func LoginReportRoute(mgmt ubmanage.ManagementService, cookieManager contracts.AuthTokenCookieManager) contracts.Route {
+	return contracts.Route{
+		Path: ubmanage.LoginReportPath,
+		Func: func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				token := r.URL.Query().Get("token")
+				vm := contracts.LoginReportViewModel{
+					BaseViewModel: contracts.BaseViewModel{Fragment: isHTMX(r)},
+					Token:         token,
+				}
+				if token == "" {
+					vm.Error = "This link is invalid or has expired."
+				}
+				_ = views.LoginReport(vm).Render(r.Context(), w)
+			case http.MethodPost:
+				if err := r.ParseForm(); err != nil {
+					_ = views.LoginReport(contracts.LoginReportViewModel{
+						BaseViewModel: contracts.BaseViewModel{Fragment: isHTMX(r)},
+						Error:         "Invalid form submission",
+					}).Render(r.Context(), w)
+					return
+				}
+
+				resp, err := mgmt.UserReportUnrecognizedLogin(r.Context(), ubmanage.UserReportUnrecognizedLoginCommand{
+					Token: r.FormValue("token"),
+				}, "web:ubadminpanel")
+				vm := contracts.LoginReportViewModel{
+					BaseViewModel: contracts.BaseViewModel{Fragment: isHTMX(r)},
+				}
+				switch {
+				case err != nil:
+					slog.Error("login report error", "error", err)
+					vm.Error = "Could not process this request at this time."
+				case resp.Status != ubstatus.Success:
+					vm.Error = "This link is invalid or has expired."
+				default:
+					vm.Done = true
+					cookieManager.ClearAuthTokenCookie(w)
+				}
+				_ = views.LoginReport(vm).Render(r.Context(), w)
+			default:
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			}
+		},
+	}
+}
+
+// EmailLoginCookieName holds the browser secret that magic links are bound
+// to.
+const EmailLoginCookieName = "ubase_email_login"
+
+const emailLoginCookieMaxAge = 60 * 60
+
+// EmailLoginRoute handles GET (render form) and POST (email a code and magic
+// link to an existing user). The response does not reveal whether the email
+// belongs to an account.
+func EmailLoginRoute(mgmt ubmanage.ManagementService) contracts.Route {
+	return contracts.Route{
+		Path: "/admin/login/email",
+		Func: func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				_ = views.EmailLogin(contracts.EmailLoginViewModel{
+					BaseViewModel: contracts.BaseViewModel{Fragment: isHTMX(r)},
+				}).Render(r.Context(), w)
+			case http.MethodPost:
+				if err := r.ParseForm(); err != nil {
+					_ = views.EmailLogin(contracts.EmailLoginViewModel{
+						BaseViewModel: contracts.BaseViewModel{Fragment: isHTMX(r)},
+						Error:         "Invalid form submission",
+					}).Render(r.Context(), w)
+					return
+				}
+				email := strings.TrimSpace(r.FormValue("email"))
+				vm := contracts.EmailLoginViewModel{
+					BaseViewModel: contracts.BaseViewModel{Fragment: isHTMX(r)},
+					Email:         email,
+				}
+
+				binding := hex.EncodeToString(ubsecurity.GenerateSecureRandom(32))
+				http.SetCookie(w, &http.Cookie{
+					Name:     EmailLoginCookieName,
+					Value:    binding,
+					HttpOnly: true,
+					Secure:   r.TLS != nil,
+					// Lax so the cookie is sent when the link is opened from
+					// an email client.
+					SameSite: http.SameSiteLaxMode,
+					MaxAge:   emailLoginCookieMaxAge,
+					Path:     ubmanage.EmailLoginLinkPath,
+				})
+
+				resp, err := mgmt.UserRequestEmailLogin(r.Context(), ubmanage.UserEmailLoginRequestCommand{
+					Email:        email,
+					ExistingOnly: true,
+					Binding:      binding,
+				}, "web:ubadminpanel")
+				switch {
+				case err != nil:
+					slog.Error("email login request error", "error", err)
+					vm.Error = "Could not start email login at this time."
+				case resp.Status == ubstatus.ValidationError:
+					vm.Error = "Enter a valid email address."
+				case resp.Status == ubstatus.RateLimited:
+					writeRateLimited(w, resp.RetryAfter)
+					vm.Error = resp.Message
+				case resp.Status == ubstatus.Success && !resp.Data.Sent:
+					slog.Error("email login code was not sent, no mailer is configured")
+					vm.Error = "Could not start email login at this time."
+				default:
+					// Unknown and inactive accounts look the same as
+					// existing ones.
+					vm.Sent = true
+				}
+				_ = views.EmailLogin(vm).Render(r.Context(), w)
+			default:
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			}
+		},
+	}
+}
+
+// EmailLoginVerifyRoute signs the user in with a magic link (GET) or an
+// emailed code (POST). Users with two factor enabled are asked for their code
+// next, as after a password login.
+func EmailLoginVerifyRoute(
+	primaryOrganization int64,
+	mgmt ubmanage.ManagementService,
+	cookieManager contracts.AuthTokenCookieManager,
+	adminLinkService contracts.AdminLinkService,
+) contracts.Route {
+	ensure.That(primaryOrganization > 0, "primary organization must be set and greater than zero")
+
+	return contracts.Route{
+		Path: ubmanage.EmailLoginLinkPath,
+		Func: func(w http.ResponseWriter, r *http.Request) {
+			vm := contracts.EmailLoginViewModel{
+				BaseViewModel: contracts.BaseViewModel{Fragment: isHTMX(r)},
+			}
+
+			var resp ubresponse.Response[*ubmanage.UserAuthenticationResponse]
+			var err error
+			switch r.Method {
+			case http.MethodGet:
+				binding := ""
+				if cookie, cookieErr := r.Cookie(EmailLoginCookieName); cookieErr == nil {
+					binding = cookie.Value
+				}
+				resp, err = mgmt.UserVerifyEmailLoginLink(r.Context(), ubmanage.UserVerifyEmailLoginLinkCommand{
+					Token:   r.URL.Query().Get("token"),
+					Binding: binding,
+					Client:  loginClient(w, r),
+				}, "web:ubadminpanel")
+			case http.MethodPost:
+				if parseErr := r.ParseForm(); parseErr != nil {
+					vm.Error = "Invalid form submission"
+					_ = views.EmailLogin(vm).Render(r.Context(), w)
+					return
+				}
+				vm.Email = strings.TrimSpace(r.FormValue("email"))
+				vm.Sent = true
+				resp, err = mgmt.UserVerifyEmailLoginCode(r.Context(), ubmanage.UserVerifyEmailLoginCodeCommand{
+					Email:  vm.Email,
+					Code:   strings.TrimSpace(r.FormValue("code")),
+					Client: loginClient(w, r),
+				}, "web:ubadminpanel")
+			default:
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			switch {
+			case err != nil:
+				slog.Error("email login verification error", "error", err)
+				vm.Error = "Could not verify this account at this time."
+			case resp.Status == ubstatus.RateLimited:
+				writeRateLimited(w, resp.RetryAfter)
+				vm.Error = resp.Message
+			case resp.Status == ubstatus.ValidationError:
+				vm.Error = "This link is invalid or has expired."
+			case resp.Status == ubstatus.PartialSuccess && resp.Data.RequiresTwoFactor:
+				// Continues to the two factor form below.
+			case resp.Status != ubstatus.Success:
+				vm.Error = resp.Message
+			}
+			if vm.Error != "" {
+				_ = views.EmailLogin(vm).Render(r.Context(), w)
+				return
+			}
+
+			http.SetCookie(w, &http.Cookie{
+				Name:     EmailLoginCookieName,
+				Value:    "",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+				MaxAge:   -1,
+				Path:     ubmanage.EmailLoginLinkPath,
+			})
+
+			if resp.Status == ubstatus.PartialSuccess {
+				_ = views.TwoFactor(contracts.TwoFactorViewModel{
+					BaseViewModel: contracts.BaseViewModel{
+						Fragment: isHTMX(r),
+						Links:    adminLinkService.GetLinks(r),
+					},
+					UserID: resp.Data.UserId,
+					Error:  "",
+				}).Render(r.Context(), w)
+				return
+			}
+
+			now := time.Now().Unix()
+			token := contracts.AuthToken{
+				UserId:         resp.Data.UserId,
+				OrganizationId: primaryOrganization,
+				Email:          resp.Data.Email,
+				SoftExpiry:     now + 3600,
+				HardExpiry:     now + 86400,
+				IssuedAt:       now,
+			}
+			if err := cookieManager.WriteAuthTokenCookie(w, token); err != nil {
+				slog.Error("write cookie error", "error", err)
+				vm.Error = "Failed to create session. Try again."
+				_ = views.EmailLogin(vm).Render(r.Context(), w)
+				return
+			}
+			if isHTMX(r) {
+				w.Header().Set("HX-Redirect", "/admin")
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		},
+	}
+}
+
+// VerifyEmailRoute verifies the user from the link in a verification email.
+// Invalid links offer to send a new one.
+func VerifyEmailRoute(mgmt ubmanage.ManagementService) contracts.Route {
+	return contracts.Route{
+		Path: "GET " + ubmanage.VerificationLinkPath,
+		Func: func(w http.ResponseWriter, r *http.Request) {
+			vm := contracts.VerifyEmailViewModel{
+				BaseViewModel: contracts.BaseViewModel{Fragment: isHTMX(r)},
+			}
+			resp, err := mgmt.UserVerifyLink(r.Context(), ubmanage.UserVerifyLinkCommand{
+				Token: r.URL.Query().Get("token"),
+			}, "web:ubadminpanel")
+			switch {
+			case err != nil:
+				slog.Error("email verification error", "error", err)
+				vm.Error = "Could not verify this account at this time."
+			case resp.Status == ubstatus.Success:
+				vm.Verified = true
+			default:
+				vm.Error = "This verification link is invalid or has expired."
+			}
+			_ = views.VerifyEmail(vm).Render(r.Context(), w)
+		},
+	}
+}
+
+// VerifyEmailResendRoute emails a new verification link. The response does
+// not reveal whether the email belongs to an unverified account.
+func VerifyEmailResendRoute(mgmt ubmanage.ManagementService) contracts.Route {
+	return contracts.Route{
+		Path: "POST " + ubmanage.VerificationLinkPath + "/resend",
+		Func: func(w http.ResponseWriter, r *http.Request) {
+			if err := r.ParseForm(); err != nil {
+				_ = views.VerifyEmail(contracts.VerifyEmailViewModel{
+					BaseViewModel: contracts.BaseViewModel{Fragment: isHTMX(r)},
+					Error:         "Invalid form submission",
+				}).Render(r.Context(), w)
+				return
+			}
+			email := strings.TrimSpace(r.FormValue("email"))
+			vm := contracts.VerifyEmailViewModel{
+				BaseViewModel: contracts.BaseViewModel{Fragment: isHTMX(r)},
+				Email:         email,
+			}
+
+			resp, err := mgmt.UserResendVerification(r.Context(), ubmanage.UserResendVerificationCommand{
+				Email: email,
+			}, "web:ubadminpanel")
+			switch {
+			case err != nil:
+				slog.Error("verification resend error", "error", err)
+				vm.Error = "Could not send a verification email at this time."
+			case resp.Status == ubstatus.ValidationError && len(resp.ValidationIssues) > 0:
+				vm.Error = "Enter a valid email address."
+			case resp.Status == ubstatus.RateLimited:
+				writeRateLimited(w, resp.RetryAfter)
+				vm.Error = resp.Message
+			case resp.Status == ubstatus.Success && !resp.Data.Sent:
+				slog.Error("verification email was not sent, no mailer is configured")
+				vm.Error = "Could not send a verification email at this time."
+			default:
+				// Unknown and already verified accounts look the same as
+				// unverified ones.
+				vm.Sent = true
+			}
+			_ = views.VerifyEmail(vm).Render(r.Context(), w)
+		},
+	}
+}
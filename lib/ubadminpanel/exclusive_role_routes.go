@@ -0,0 +1,178 @@
+package ubadminpanel
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/kernelplex/ubase/lib/contracts"
+	"github.com/kernelplex/ubase/lib/ubadminpanel/templ/views"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+// loadExclusiveRoles fills in the organization's sets and their violations.
+func loadExclusiveRoles(ctx context.Context, mgmt ubmanage.ManagementService, orgId int64, vm *contracts.ExclusiveRolesViewModel) error {
+	org, err := mgmt.OrganizationGet(ctx, orgId)
+	if err != nil || org.Status != ubstatus.Success {
+		return fmt.Errorf("failed to get organization: %w %s", err, org.Status)
+	}
+	roles, err := mgmt.RoleList(ctx, orgId)
+	if err != nil || roles.Status != ubstatus.Success {
+		return fmt.Errorf("failed to list roles: %w %s", err, roles.Status)
+	}
+	violations, err := mgmt.OrganizationExclusiveRoleViolations(ctx, orgId)
+	if err != nil || violations.Status != ubstatus.Success {
+		return fmt.Errorf("failed to list exclusive role violations: %w %s", err, violations.Status)
+	}
+
+	vm.OrganizationID = orgId
+	vm.OrganizationName = org.Data.State.Name
+	vm.Roles = roles.Data
+	vm.Sets = nil
+	for _, set := range org.Data.State.ExclusiveRoleSets {
+		row := contracts.ExclusiveRoleSetRow{Name: set.Name}
+		for _, role := range roles.Data {
+			if slices.Contains(set.RoleIds, role.ID) {
+				row.Roles = append(row.Roles, role.Name)
+			}
+		}
+		vm.Sets = append(vm.Sets, row)
+	}
+	vm.Violations = nil
+	for _, violation := range violations.Data {
+		row := contracts.ExclusiveRoleViolationRow{
+			SetName:         violation.SetName,
+			UserID:          violation.UserId,
+			UserEmail:       violation.UserEmail,
+			UserDisplayName: violation.UserDisplayName,
+		}
+		for _, role := range violation.Roles {
+			row.Roles = append(row.Roles, role.Name)
+		}
+		vm.Violations = append(vm.Violations, row)
+	}
+	return nil
+}
+
+// ExclusiveRolesRoute renders an organization's exclusive role sets and the
+// users who break them.
+func ExclusiveRolesRoute(mgmt ubmanage.ManagementService, adminLinkService contracts.AdminLinkService) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+		vm := contracts.ExclusiveRolesViewModel{
+			BaseViewModel: contracts.BaseViewModel{
+				Fragment: isHTMX(r),
+				Links:    adminLinkService.GetLinks(r),
+			},
+		}
+		if err := loadExclusiveRoles(r.Context(), mgmt, id, &vm); err != nil {
+			slog.Error("exclusive roles error", "error", err, "org", id)
+			http.NotFound(w, r)
+			return
+		}
+		_ = views.ExclusiveRolesPage(vm).Render(r.Context(), w)
+	}
+	return contracts.Route{
+		Path:               "GET /admin/organizations/{id}/exclusive-roles",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
+
+// ExclusiveRolesSaveRoute creates or replaces an exclusive role set and
+// re-renders the sets.
+func ExclusiveRolesSaveRoute(mgmt ubmanage.ManagementService) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		vm := contracts.ExclusiveRolesViewModel{Name: r.FormValue("name")}
+		for _, value := range r.Form["role_id"] {
+			if roleId, err := strconv.ParseInt(value, 10, 64); err == nil {
+				vm.RoleIDs = append(vm.RoleIDs, roleId)
+			}
+		}
+
+		resp, err := mgmt.OrganizationExclusiveRoleSetSave(r.Context(), ubmanage.OrganizationExclusiveRoleSetSaveCommand{
+			OrganizationId: id,
+			Name:           vm.Name,
+			RoleIds:        vm.RoleIDs,
+		}, requestAgent(r))
+		switch {
+		case err != nil:
+			slog.Error("exclusive role set save error", "error", err, "org", id)
+			vm.Error = "Failed to save the exclusive role set"
+		case resp.Status == ubstatus.ValidationError && len(resp.ValidationIssues) > 0:
+			vm.FieldErrors = map[string][]string{}
+			for _, issue := range resp.ValidationIssues {
+				vm.FieldErrors[issue.Field] = append(vm.FieldErrors[issue.Field], issue.Error...)
+			}
+		case resp.Status != ubstatus.Success:
+			vm.Error = resp.Message
+		default:
+			vm = contracts.ExclusiveRolesViewModel{Message: "Exclusive role set saved"}
+		}
+		renderExclusiveRoles(w, r, mgmt, id, vm)
+	}
+	return contracts.Route{
+		Path:               "POST /admin/organizations/{id}/exclusive-roles",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
+
+// ExclusiveRolesRemoveRoute removes an exclusive role set and re-renders the
+// sets.
+func ExclusiveRolesRemoveRoute(mgmt ubmanage.ManagementService) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		vm := contracts.ExclusiveRolesViewModel{}
+		resp, err := mgmt.OrganizationExclusiveRoleSetRemove(r.Context(), ubmanage.OrganizationExclusiveRoleSetRemoveCommand{
+			OrganizationId: id,
+			Name:           r.FormValue("name"),
+		}, requestAgent(r))
+		if err != nil || resp.Status != ubstatus.Success {
+			slog.Error("exclusive role set remove error", "error", err, "org", id, "status", resp.Status)
+			vm.Error = "Failed to remove the exclusive role set"
+		} else {
+			vm.Message = "Exclusive role set removed"
+		}
+		renderExclusiveRoles(w, r, mgmt, id, vm)
+	}
+	return contracts.Route{
+		Path:               "POST /admin/organizations/{id}/exclusive-roles/remove",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
+
+func renderExclusiveRoles(w http.ResponseWriter, r *http.Request, mgmt ubmanage.ManagementService, orgId int64, vm contracts.ExclusiveRolesViewModel) {
+	if err := loadExclusiveRoles(r.Context(), mgmt, orgId, &vm); err != nil {
+		slog.Error("exclusive roles error", "error", err, "org", orgId)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	_ = views.ExclusiveRoles(vm).Render(r.Context(), w)
+}
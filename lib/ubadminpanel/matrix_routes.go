@@ -0,0 +1,230 @@
+package ubadminpanel
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kernelplex/ubase/lib/contracts"
+	"github.com/kernelplex/ubase/lib/ubadminpanel/templ/views"
+	"github.com/kernelplex/ubase/lib/ubdata"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+// permissionMatrix is an organization's roles and the permissions they hold.
+type permissionMatrix struct {
+	vm contracts.PermissionMatrixViewModel
+	// rows are the permissions of the catalog, followed by undeclared
+	// permissions held by any of the roles.
+	rows []contracts.RolePermissionGroup
+	// saved holds the matrixKey of each permission a role holds.
+	saved map[string]bool
+}
+
+func matrixKey(roleId int64, permission string) string {
+	return fmt.Sprintf("%d:%s", roleId, permission)
+}
+
+func loadPermissionMatrix(ctx context.Context,
+	mgmt ubmanage.ManagementService,
+	adapter ubdata.DataAdapter,
+	catalog *ubmanage.PermissionCatalog,
+	orgId int64,
+) (*permissionMatrix, error) {
+	org, err := mgmt.OrganizationGet(ctx, orgId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+	if org.Status != ubstatus.Success {
+		return nil, fmt.Errorf("failed to get organization: %s", org.Status)
+	}
+	roles, err := mgmt.RoleList(ctx, orgId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	if roles.Status != ubstatus.Success {
+		return nil, fmt.Errorf("failed to list roles: %s", roles.Status)
+	}
+
+	matrix := &permissionMatrix{
+		vm: contracts.PermissionMatrixViewModel{
+			OrganizationID:   orgId,
+			OrganizationName: org.Data.State.Name,
+		},
+		saved: map[string]bool{},
+	}
+	held := map[string]bool{}
+	for _, role := range roles.Data {
+		matrix.vm.Roles = append(matrix.vm.Roles, contracts.PermissionMatrixRole{ID: role.ID, Name: role.Name})
+		permissions, err := adapter.GetRolePermissions(ctx, role.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get role permissions: %w", err)
+		}
+		for _, permission := range permissions {
+			held[permission] = true
+			matrix.saved[matrixKey(role.ID, permission)] = true
+		}
+	}
+	matrix.rows = rolePermissionGroups(catalog, slices.Collect(maps.Keys(held)), "")
+	return matrix, nil
+}
+
+// apply fills in the grid with the desired permissions, and returns the
+// changes from the saved permissions.
+func (m *permissionMatrix) apply(desired map[string]bool) []ubmanage.RolePermissionChange {
+	var changes []ubmanage.RolePermissionChange
+	m.vm.Groups = nil
+	m.vm.Changes = nil
+	for _, group := range m.rows {
+		matrixGroup := contracts.PermissionMatrixGroup{Name: group.Name}
+		for _, permission := range group.Permissions {
+			row := contracts.PermissionMatrixRow{Permission: permission}
+			for _, role := range m.vm.Roles {
+				key := matrixKey(role.ID, permission.Name)
+				cell := contracts.PermissionMatrixCell{RoleID: role.ID, Checked: desired[key], Changed: desired[key] != m.saved[key]}
+				row.Cells = append(row.Cells, cell)
+				if cell.Changed {
+					changes = append(changes, ubmanage.RolePermissionChange{RoleId: role.ID, Permission: permission.Name, Grant: cell.Checked})
+					m.vm.Changes = append(m.vm.Changes, contracts.PermissionMatrixChange{RoleName: role.Name, Permission: permission.Name, Grant: cell.Checked})
+				}
+			}
+			matrixGroup.Rows = append(matrixGroup.Rows, row)
+		}
+		m.vm.Groups = append(m.vm.Groups, matrixGroup)
+	}
+	return changes
+}
+
+// bulk grants or revokes a row or column of the desired permissions.
+func (m *permissionMatrix) bulk(desired map[string]bool, action string) {
+	operation, target, _ := strings.Cut(action, ":")
+	grant := strings.HasPrefix(operation, "grant-")
+	for _, group := range m.rows {
+		for _, permission := range group.Permissions {
+			for _, role := range m.vm.Roles {
+				switch {
+				case strings.HasSuffix(operation, "-role") && target == strconv.FormatInt(role.ID, 10),
+					strings.HasSuffix(operation, "-permission") && target == permission.Name:
+					desired[matrixKey(role.ID, permission.Name)] = grant
+				}
+			}
+		}
+	}
+}
+
+// PermissionMatrixRoute renders an organization's roles by permissions grid.
+func PermissionMatrixRoute(
+	mgmt ubmanage.ManagementService,
+	adapter ubdata.DataAdapter,
+	catalog *ubmanage.PermissionCatalog,
+	adminLinkService contracts.AdminLinkService,
+) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+		matrix, err := loadPermissionMatrix(r.Context(), mgmt, adapter, catalog, id)
+		if err != nil {
+			slog.Error("permission matrix error", "error", err, "org", id)
+			http.NotFound(w, r)
+			return
+		}
+		matrix.apply(matrix.saved)
+		matrix.vm.BaseViewModel = contracts.BaseViewModel{
+			Fragment: isHTMX(r),
+			Links:    adminLinkService.GetLinks(r),
+		}
+		_ = views.PermissionMatrixPage(matrix.vm).Render(r.Context(), w)
+	}
+	return contracts.Route{
+		Path:               "GET /admin/organizations/{id}/matrix",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
+
+// PermissionMatrixPostRoute re-renders the grid with pending changes, applies
+// bulk row and column operations, and saves the pending changes in a single
+// operation.
+func PermissionMatrixPostRoute(
+	mgmt ubmanage.ManagementService,
+	adapter ubdata.DataAdapter,
+	catalog *ubmanage.PermissionCatalog,
+) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		matrix, err := loadPermissionMatrix(r.Context(), mgmt, adapter, catalog, id)
+		if err != nil {
+			slog.Error("permission matrix error", "error", err, "org", id)
+			http.NotFound(w, r)
+			return
+		}
+
+		// Pending changes are relative to the permissions the page was
+		// loaded with, so changes made elsewhere in the meantime are kept.
+		matrix.saved = map[string]bool{}
+		for _, key := range r.Form["saved"] {
+			matrix.saved[key] = true
+		}
+		desired := map[string]bool{}
+		for _, key := range r.Form["cell"] {
+			desired[key] = true
+		}
+
+		action := r.FormValue("action")
+		if action != "save" {
+			if action != "" {
+				matrix.bulk(desired, action)
+			}
+			matrix.apply(desired)
+			_ = views.PermissionMatrix(matrix.vm).Render(r.Context(), w)
+			return
+		}
+
+		changes := matrix.apply(desired)
+		resp, err := mgmt.RolePermissionsApply(r.Context(), ubmanage.RolePermissionsApplyCommand{
+			OrganizationId: id,
+			Changes:        changes,
+		}, requestAgent(r))
+		if err != nil || resp.Status != ubstatus.Success {
+			slog.Error("permission matrix save error", "error", err, "org", id, "status", resp.Status)
+			matrix.vm.Error = "Failed to save changes"
+			for _, issue := range resp.ValidationIssues {
+				matrix.vm.Error = strings.Join(issue.Error, ", ")
+			}
+			_ = views.PermissionMatrix(matrix.vm).Render(r.Context(), w)
+			return
+		}
+
+		saved, err := loadPermissionMatrix(r.Context(), mgmt, adapter, catalog, id)
+		if err != nil {
+			slog.Error("permission matrix error", "error", err, "org", id)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		saved.apply(saved.saved)
+		saved.vm.Message = "Changes saved"
+		_ = views.PermissionMatrix(saved.vm).Render(r.Context(), w)
+	}
+	return contracts.Route{
+		Path:               "POST /admin/organizations/{id}/matrix",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
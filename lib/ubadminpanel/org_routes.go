@@ -19,6 +19,17 @@ type orgCreateForm struct {
 	Name       string `json:"name"`
 	SystemName string `json:"system_name"`
 	Status     string `json:"status"`
+	// ApplyRoleTemplates is the "Create template roles" checkbox.
+	ApplyRoleTemplates bool `json:"apply_role_templates"`
+}
+
+// roleTemplateNames lists the role templates offered on the create form.
+func roleTemplateNames(mgmt ubmanage.ManagementService) []string {
+	var names []string
+	for _, template := range mgmt.RoleTemplates() {
+		names = append(names, template.Name)
+	}
+	return names
 }
 
 // orgEditForm is used to parse organization edit form fields.
@@ -133,10 +144,12 @@ func OrganizationCreateRoute(mgmt ubmanage.ManagementService,
 				Fragment: isHTMX(r),
 				Links:    adminLinkService.GetLinks(r),
 			},
-			IsEdit:       false,
-			Organization: nil,
-			Error:        "",
-			FieldErrors:  nil,
+			IsEdit:             false,
+			Organization:       nil,
+			Error:              "",
+			FieldErrors:        nil,
+			RoleTemplates:      roleTemplateNames(mgmt),
+			ApplyRoleTemplates: true,
 		}).Render(r.Context(), w)
 	}
 
@@ -163,17 +176,24 @@ func OrganizationCreatePostRoute(
 					Fragment: isHTMX(r),
 					Links:    adminLinkService.GetLinks(r),
 				},
-				IsEdit:       false,
-				Organization: nil,
-				Error:        "Invalid form submission",
-				FieldErrors:  nil,
+				IsEdit:             false,
+				Organization:       nil,
+				Error:              "Invalid form submission",
+				FieldErrors:        nil,
+				RoleTemplates:      roleTemplateNames(mgmt),
+				ApplyRoleTemplates: f.ApplyRoleTemplates,
 			}).Render(r.Context(), w)
 			return
 		}
 		name := strings.TrimSpace(f.Name)
 		sys := strings.TrimSpace(f.SystemName)
 		status := strings.TrimSpace(f.Status)
-		resp, err := mgmt.OrganizationAdd(r.Context(), ubmanage.OrganizationCreateCommand{Name: name, SystemName: sys, Status: status}, "web:ubadminpanel")
+		resp, err := mgmt.OrganizationAdd(r.Context(), ubmanage.OrganizationCreateCommand{
+			Name:               name,
+			SystemName:         sys,
+			Status:             status,
+			ApplyRoleTemplates: f.ApplyRoleTemplates,
+		}, requestAgent(r))
 		if err != nil || resp.Status != ubstatus.Success {
 			if err != nil {
 				slog.Error("org add error", "error", err)
@@ -186,10 +206,12 @@ func OrganizationCreatePostRoute(
 					Fragment: isHTMX(r),
 					Links:    adminLinkService.GetLinks(r),
 				},
-				IsEdit:       false,
-				Organization: &draft,
-				Error:        msg,
-				FieldErrors:  errMap,
+				IsEdit:             false,
+				Organization:       &draft,
+				Error:              msg,
+				FieldErrors:        errMap,
+				RoleTemplates:      roleTemplateNames(mgmt),
+				ApplyRoleTemplates: f.ApplyRoleTemplates,
 			}).Render(r.Context(), w)
 			return
 		}
@@ -264,7 +286,7 @@ func OrganizationSettingsAddRoute(mgmt ubmanage.ManagementService) contracts.Rou
 		_, err = mgmt.OrganizationSettingsAdd(r.Context(), ubmanage.OrganizationSettingsAddCommand{
 			Id:       id,
 			Settings: map[string]string{name: value},
-		}, "web:ubadminpanel")
+		}, requestAgent(r))
 
 		if err != nil {
 			slog.Error("failed to add organization setting", "error", err)
@@ -314,7 +336,7 @@ func OrganizationSettingsRemoveRoute(mgmt ubmanage.ManagementService) contracts.
 		_, err = mgmt.OrganizationSettingsRemove(r.Context(), ubmanage.OrganizationSettingsRemoveCommand{
 			Id:          id,
 			SettingKeys: []string{name},
-		}, "web:ubadminpanel")
+		}, requestAgent(r))
 
 		if err != nil {
 			slog.Error("failed to remove organization setting", "error", err)
@@ -384,7 +406,7 @@ func OrganizationEditRoute(mgmt ubmanage.ManagementService,
 			sys := strings.TrimSpace(f.SystemName)
 			status := strings.TrimSpace(f.Status)
 			cmd := ubmanage.OrganizationUpdateCommand{Id: id, Name: &name, SystemName: &sys, Status: &status}
-			uresp, err := mgmt.OrganizationUpdate(r.Context(), cmd, "web:ubadminpanel")
+			uresp, err := mgmt.OrganizationUpdate(r.Context(), cmd, requestAgent(r))
 			if err != nil || uresp.Status != ubstatus.Success {
 				errMap := uresp.GetValidationMap()
 				msg := uresp.Message
@@ -1,3 +1,52 @@
 package ubadminpanel
 
-const PermSystemAdmin = "system_admin"
+import (
+	"github.com/kernelplex/ubase/lib/contracts"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+)
+
+// The permissions are defined in contracts so templates can check them.
+const PermSystemAdmin = contracts.PermSystemAdmin
+const PermImpersonateUsers = contracts.PermImpersonateUsers
+const PermApproveAccessRequests = ubmanage.PermApproveAccessRequests
+const PermReviewAccess = ubmanage.PermReviewAccess
+const PermManageAccessReviews = ubmanage.PermManageAccessReviews
+
+// Permissions are the definitions of the admin panel's permissions.
+var Permissions = []ubmanage.PermissionDefinition{
+	{
+		Name:        PermSystemAdmin,
+		DisplayName: "System administrator",
+		Description: "Use the admin panel to manage organizations, roles, users and service accounts.",
+		Group:       "Administration",
+		Dangerous:   true,
+	},
+	{
+		Name:        PermImpersonateUsers,
+		DisplayName: "Impersonate users",
+		Description: "Sign in as another user from the admin panel.",
+		Group:       "Administration",
+		Dangerous:   true,
+	},
+	{
+		Name:        PermApproveAccessRequests,
+		DisplayName: "Approve access requests",
+		Description: "Approve or deny requests by users for the organization's roles.",
+		Group:       "Access",
+		Dangerous:   true,
+	},
+	{
+		Name:        PermReviewAccess,
+		DisplayName: "Review access",
+		Description: "Decide whether to keep or revoke role memberships in the organization's access reviews.",
+		Group:       "Access",
+		Dangerous:   true,
+	},
+	{
+		Name:        PermManageAccessReviews,
+		DisplayName: "Manage access reviews",
+		Description: "Start, close and export the organization's access reviews. Closing a review removes the revoked memberships.",
+		Group:       "Access",
+		Dangerous:   true,
+	},
+}
@@ -0,0 +1,223 @@
+package ubadminpanel
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/contracts"
+	"github.com/kernelplex/ubase/lib/ubadminpanel/templ/views"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubpolicy"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+// policyDryRunTimeLayout is the layout of datetime-local inputs.
+const policyDryRunTimeLayout = "2006-01-02T15:04"
+
+// rolePolicyRows lists the permissions of a role with their policies.
+func rolePolicyRows(state ubmanage.RoleState) []contracts.RolePolicyRow {
+	permissions := slices.Clone(state.Permissions)
+	slices.Sort(permissions)
+	rows := make([]contracts.RolePolicyRow, 0, len(permissions))
+	for _, permission := range slices.Compact(permissions) {
+		rows = append(rows, contracts.RolePolicyRow{Permission: permission, Policy: state.Policies[permission]})
+	}
+	return rows
+}
+
+// RolePoliciesListRoute renders the policies of the role's permissions.
+func RolePoliciesListRoute(mgmt ubmanage.ManagementService) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+		resp, err := mgmt.RoleGetById(r.Context(), id)
+		if err != nil || resp.Status != ubstatus.Success {
+			slog.Error("role get error", "error", err, "id", id, "status", resp.Status)
+			http.NotFound(w, r)
+			return
+		}
+		_ = views.RolePoliciesTable(id, rolePolicyRows(resp.Data.State)).Render(r.Context(), w)
+	}
+	return contracts.Route{
+		Path:               "GET /admin/roles/{id}/policies",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
+
+// RolePolicySetRoute sets or clears the policy of one of the role's
+// permissions.
+func RolePolicySetRoute(mgmt ubmanage.ManagementService) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		row := contracts.RolePolicyRow{
+			Permission: strings.TrimSpace(r.FormValue("permission")),
+			Policy:     strings.TrimSpace(r.FormValue("policy")),
+		}
+		if row.Permission == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		resp, err := mgmt.RolePermissionPolicySet(r.Context(), ubmanage.RolePermissionPolicySetCommand{
+			Id:         id,
+			Permission: row.Permission,
+			Policy:     row.Policy,
+		}, requestAgent(r))
+		switch {
+		case err != nil:
+			row.Error = "Failed to save policy"
+		case resp.Status == ubstatus.ValidationError:
+			for _, issue := range resp.ValidationIssues {
+				row.Error = strings.Join(issue.Error, ", ")
+			}
+		case resp.Status != ubstatus.Success:
+			row.Error = resp.Message
+		default:
+			row.Saved = true
+		}
+		_ = views.RolePolicyRow(id, row).Render(r.Context(), w)
+	}
+	return contracts.Route{
+		Path:               "POST /admin/roles/{id}/policies",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
+
+// PolicyDryRunRoute renders the policy dry run page, optionally filled in
+// with a policy from the query string.
+func PolicyDryRunRoute(adminLinkService contracts.AdminLinkService) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		_ = views.PolicyDryRunPage(contracts.PolicyDryRunViewModel{
+			BaseViewModel: contracts.BaseViewModel{
+				Fragment: isHTMX(r),
+				Links:    adminLinkService.GetLinks(r),
+			},
+			Policy: r.URL.Query().Get("policy"),
+		}).Render(r.Context(), w)
+	}
+	return contracts.Route{
+		Path:               "GET /admin/policies/dry-run",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
+
+// PolicyDryRunPostRoute evaluates a policy against a sample request, with
+// the same attributes the prefect service would use.
+func PolicyDryRunPostRoute() contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		vm := contracts.PolicyDryRunViewModel{
+			Policy:               r.FormValue("policy"),
+			Time:                 strings.TrimSpace(r.FormValue("time")),
+			IpAddress:            strings.TrimSpace(r.FormValue("ip")),
+			OrganizationSettings: r.FormValue("org_settings"),
+			UserSettings:         r.FormValue("user_settings"),
+			RequestAttributes:    r.FormValue("request_attributes"),
+		}
+		_ = views.PolicyDryRunResult(evaluatePolicyDryRun(vm)).Render(r.Context(), w)
+	}
+	return contracts.Route{
+		Path:               "POST /admin/policies/dry-run",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
+
+func evaluatePolicyDryRun(vm contracts.PolicyDryRunViewModel) contracts.PolicyDryRunResult {
+	result := contracts.PolicyDryRunResult{Evaluated: true}
+	policy, err := ubpolicy.Compile(strings.TrimSpace(vm.Policy))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	orgSettings := parseNameValueLines(vm.OrganizationSettings)
+	input := ubmanage.PolicyInput{IpAddress: vm.IpAddress, Attributes: map[string]any{}}
+	if vm.Time != "" {
+		// The time is entered in the organization's time zone, which is
+		// what policies see it in.
+		location := time.UTC
+		if name := orgSettings[ubmanage.PolicyTimezoneSetting]; name != "" {
+			location, err = time.LoadLocation(name)
+			if err != nil {
+				result.Error = "invalid organization time zone"
+				return result
+			}
+		}
+		input.Time, err = time.ParseInLocation(policyDryRunTimeLayout, vm.Time, location)
+		if err != nil {
+			result.Error = "invalid time"
+			return result
+		}
+	}
+	for name, value := range parseNameValueLines(vm.RequestAttributes) {
+		input.Attributes[name] = parseSampleValue(value)
+	}
+	attributes := ubmanage.PolicyAttributes(0, 0, input,
+		parseNameValueLines(vm.UserSettings),
+		orgSettings)
+
+	for _, name := range policy.Attributes() {
+		value, found := attributes[name]
+		formatted := "null"
+		if found {
+			formatted = fmt.Sprintf("%v", value)
+			if s, ok := value.(string); ok {
+				formatted = strconv.Quote(s)
+			}
+		}
+		result.Attributes = append(result.Attributes, contracts.PolicyAttributeValue{Name: name, Value: formatted})
+	}
+	result.Allowed, err = policy.Evaluate(attributes)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// parseNameValueLines reads name=value lines, skipping blank lines and lines
+// without a name.
+func parseNameValueLines(text string) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(text, "\n") {
+		name, value, _ := strings.Cut(line, "=")
+		if name = strings.TrimSpace(name); name != "" {
+			values[name] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
+
+// parseSampleValue reads a request attribute as a boolean or a number where
+// possible, as callers would pass them, and as a string otherwise.
+func parseSampleValue(value string) any {
+	if value == "true" || value == "false" {
+		return value == "true"
+	}
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		return number
+	}
+	return value
+}
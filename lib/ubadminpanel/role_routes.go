@@ -2,7 +2,9 @@ package ubadminpanel
 
 import (
 	"log/slog"
+	"maps"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -123,7 +125,7 @@ func RoleUsersAddRoute(adapter ubdata.DataAdapter, mgmt ubmanage.ManagementServi
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
-		_, _ = mgmt.UserAddToRole(r.Context(), ubmanage.UserAddToRoleCommand{UserId: uid, RoleId: id}, "web:ubadminpanel")
+		added, _ := mgmt.UserAddToRole(r.Context(), ubmanage.UserAddToRoleCommand{UserId: uid, RoleId: id}, requestAgent(r))
 		members, _ := adapter.GetUsersInRole(r.Context(), id)
 		memberSet := make(map[int64]bool, len(members))
 		for _, u := range members {
@@ -135,7 +137,11 @@ func RoleUsersAddRoute(adapter ubdata.DataAdapter, mgmt ubmanage.ManagementServi
 			http.Error(w, "Not Found", http.StatusNotFound)
 			return
 		}
-		_ = views.RoleUserRow(id, user, memberSet[uid]).Render(r.Context(), w)
+		var addError string
+		if added.Status != ubstatus.Success {
+			addError = added.Message
+		}
+		_ = views.RoleUserRow(id, user, memberSet[uid], addError).Render(r.Context(), w)
 	}
 	return contracts.Route{
 		Path:               "POST /admin/roles/{id}/users/add",
@@ -162,7 +168,7 @@ func RoleUsersRemoveRoute(adapter ubdata.DataAdapter, mgmt ubmanage.ManagementSe
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
-		_, _ = mgmt.UserRemoveFromRole(r.Context(), ubmanage.UserRemoveFromRoleCommand{UserId: uid, RoleId: id}, "web:ubadminpanel")
+		_, _ = mgmt.UserRemoveFromRole(r.Context(), ubmanage.UserRemoveFromRoleCommand{UserId: uid, RoleId: id}, requestAgent(r))
 		members, _ := adapter.GetUsersInRole(r.Context(), id)
 		memberSet := make(map[int64]bool, len(members))
 		for _, u := range members {
@@ -174,7 +180,7 @@ func RoleUsersRemoveRoute(adapter ubdata.DataAdapter, mgmt ubmanage.ManagementSe
 			http.Error(w, "Not Found", http.StatusNotFound)
 			return
 		}
-		_ = views.RoleUserRow(id, user, memberSet[uid]).Render(r.Context(), w)
+		_ = views.RoleUserRow(id, user, memberSet[uid], "").Render(r.Context(), w)
 	}
 	return contracts.Route{
 		Path:               "POST /admin/roles/{id}/users/remove",
@@ -183,7 +189,65 @@ func RoleUsersRemoveRoute(adapter ubdata.DataAdapter, mgmt ubmanage.ManagementSe
 	}
 }
 
-func RolePermissionsListRoute(adapter ubdata.DataAdapter, permissions []string) contracts.Route {
+// rolePermissionItem describes a permission for the role permissions table.
+func rolePermissionItem(catalog *ubmanage.PermissionCatalog, permission string, inRole bool) contracts.RolePermissionItem {
+	definition, found := catalog.Lookup(permission)
+	if !found {
+		definition = ubmanage.PermissionDefinition{Name: permission}
+	}
+	return contracts.RolePermissionItem{
+		Name:        permission,
+		Title:       definition.Title(),
+		Description: definition.Description,
+		Dangerous:   definition.Dangerous,
+		Undeclared:  !found,
+		InRole:      inRole,
+	}
+}
+
+// rolePermissionGroups groups the catalog's permissions matching q. Held
+// permissions the catalog does not declare are listed last, so they can be
+// removed.
+func rolePermissionGroups(catalog *ubmanage.PermissionCatalog, assigned []string, q string) []contracts.RolePermissionGroup {
+	memberSet := make(map[string]bool, len(assigned))
+	for _, p := range assigned {
+		memberSet[p] = true
+	}
+	matches := func(item contracts.RolePermissionItem) bool {
+		return q == "" ||
+			strings.Contains(strings.ToLower(item.Name), q) ||
+			strings.Contains(strings.ToLower(item.Title), q) ||
+			strings.Contains(strings.ToLower(item.Description), q)
+	}
+
+	groups := make([]contracts.RolePermissionGroup, 0)
+	for _, group := range catalog.Groups() {
+		items := make([]contracts.RolePermissionItem, 0, len(group.Permissions))
+		for _, definition := range group.Permissions {
+			if item := rolePermissionItem(catalog, definition.Name, memberSet[definition.Name]); matches(item) {
+				items = append(items, item)
+			}
+		}
+		if len(items) > 0 {
+			groups = append(groups, contracts.RolePermissionGroup{Name: group.Name, Permissions: items})
+		}
+	}
+
+	undeclared := make([]contracts.RolePermissionItem, 0)
+	for _, p := range slices.Sorted(maps.Keys(memberSet)) {
+		if _, found := catalog.Lookup(p); !found {
+			if item := rolePermissionItem(catalog, p, true); matches(item) {
+				undeclared = append(undeclared, item)
+			}
+		}
+	}
+	if len(undeclared) > 0 {
+		groups = append(groups, contracts.RolePermissionGroup{Name: "Undeclared", Permissions: undeclared})
+	}
+	return groups
+}
+
+func RolePermissionsListRoute(adapter ubdata.DataAdapter, catalog *ubmanage.PermissionCatalog) contracts.Route {
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		idStr := r.PathValue("id")
 		id, err := strconv.ParseInt(idStr, 10, 64)
@@ -196,22 +260,8 @@ func RolePermissionsListRoute(adapter ubdata.DataAdapter, permissions []string)
 			slog.Error("get role permissions error", "error", aerr, "role", id)
 			assigned = []string{}
 		}
-		memberSet := make(map[string]bool, len(assigned))
-		for _, p := range assigned {
-			memberSet[p] = true
-		}
 		q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
-		filtered := make([]string, 0, len(permissions))
-		if q == "" {
-			filtered = append(filtered, permissions...)
-		} else {
-			for _, p := range permissions {
-				if strings.Contains(strings.ToLower(p), q) {
-					filtered = append(filtered, p)
-				}
-			}
-		}
-		_ = views.RolePermissionsTable(filtered, memberSet, id).Render(r.Context(), w)
+		_ = views.RolePermissionsTable(rolePermissionGroups(catalog, assigned, q), id).Render(r.Context(), w)
 	}
 	return contracts.Route{
 		Path:               "GET /admin/roles/{id}/permissions",
@@ -220,7 +270,7 @@ func RolePermissionsListRoute(adapter ubdata.DataAdapter, permissions []string)
 	}
 }
 
-func RolePermissionsAddRoute(adapter ubdata.DataAdapter, mgmt ubmanage.ManagementService) contracts.Route {
+func RolePermissionsAddRoute(adapter ubdata.DataAdapter, mgmt ubmanage.ManagementService, catalog *ubmanage.PermissionCatalog) contracts.Route {
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		idStr := r.PathValue("id")
 		id, err := strconv.ParseInt(idStr, 10, 64)
@@ -237,13 +287,9 @@ func RolePermissionsAddRoute(adapter ubdata.DataAdapter, mgmt ubmanage.Managemen
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
-		_, _ = mgmt.RolePermissionAdd(r.Context(), ubmanage.RolePermissionAddCommand{Id: id, Permission: perm}, "web:ubadminpanel")
+		_, _ = mgmt.RolePermissionAdd(r.Context(), ubmanage.RolePermissionAddCommand{Id: id, Permission: perm}, requestAgent(r))
 		assigned, _ := adapter.GetRolePermissions(r.Context(), id)
-		memberSet := make(map[string]bool, len(assigned))
-		for _, p := range assigned {
-			memberSet[p] = true
-		}
-		_ = views.RolePermissionRow(id, perm, memberSet[perm]).Render(r.Context(), w)
+		_ = views.RolePermissionRow(id, rolePermissionItem(catalog, perm, slices.Contains(assigned, perm))).Render(r.Context(), w)
 	}
 	return contracts.Route{
 		Path:               "POST /admin/roles/{id}/permissions/add",
@@ -252,7 +298,7 @@ func RolePermissionsAddRoute(adapter ubdata.DataAdapter, mgmt ubmanage.Managemen
 	}
 }
 
-func RolePermissionsRemoveRoute(adapter ubdata.DataAdapter, mgmt ubmanage.ManagementService) contracts.Route {
+func RolePermissionsRemoveRoute(adapter ubdata.DataAdapter, mgmt ubmanage.ManagementService, catalog *ubmanage.PermissionCatalog) contracts.Route {
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		idStr := r.PathValue("id")
 		id, err := strconv.ParseInt(idStr, 10, 64)
@@ -269,13 +315,9 @@ func RolePermissionsRemoveRoute(adapter ubdata.DataAdapter, mgmt ubmanage.Manage
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
-		_, _ = mgmt.RolePermissionRemove(r.Context(), ubmanage.RolePermissionRemoveCommand{Id: id, Permission: perm}, "web:ubadminpanel")
+		_, _ = mgmt.RolePermissionRemove(r.Context(), ubmanage.RolePermissionRemoveCommand{Id: id, Permission: perm}, requestAgent(r))
 		assigned, _ := adapter.GetRolePermissions(r.Context(), id)
-		memberSet := make(map[string]bool, len(assigned))
-		for _, p := range assigned {
-			memberSet[p] = true
-		}
-		_ = views.RolePermissionRow(id, perm, memberSet[perm]).Render(r.Context(), w)
+		_ = views.RolePermissionRow(id, rolePermissionItem(catalog, perm, slices.Contains(assigned, perm))).Render(r.Context(), w)
 	}
 	return contracts.Route{
 		Path:               "POST /admin/roles/{id}/permissions/remove",
@@ -338,7 +380,7 @@ func RoleCreateRoute(mgmt ubmanage.ManagementService,
 			orgStr := r.FormValue("organization_id")
 			oid, _ := strconv.ParseInt(orgStr, 10, 64)
 			cmd := ubmanage.RoleCreateCommand{Name: name, SystemName: sys, OrganizationId: oid}
-			resp, err := mgmt.RoleAdd(r.Context(), cmd, "web:ubadminpanel")
+			resp, err := mgmt.RoleAdd(r.Context(), cmd, requestAgent(r))
 			if err != nil || resp.Status != ubstatus.Success {
 				if err != nil {
 					slog.Error("role add error", "error", err)
@@ -435,7 +477,7 @@ func RoleEditRoute(mgmt ubmanage.ManagementService,
 			name := strings.TrimSpace(r.FormValue("name"))
 			sys := strings.TrimSpace(r.FormValue("system_name"))
 			cmd := ubmanage.RoleUpdateCommand{Id: roleId, Name: &name, SystemName: &sys}
-			resp, err := mgmt.RoleUpdate(r.Context(), cmd, "web:ubadminpanel")
+			resp, err := mgmt.RoleUpdate(r.Context(), cmd, requestAgent(r))
 			if err != nil || resp.Status != ubstatus.Success {
 				errMap := resp.GetValidationMap()
 				msg := resp.Message
@@ -513,7 +555,7 @@ func RoleCreatePostRoute(mgmt ubmanage.ManagementService) contracts.Route {
 		sys := strings.TrimSpace(f.SystemName)
 		oid := f.OrganizationId
 		cmd := ubmanage.RoleCreateCommand{Name: name, SystemName: sys, OrganizationId: oid}
-		resp, err := mgmt.RoleAdd(r.Context(), cmd, "web:ubadminpanel")
+		resp, err := mgmt.RoleAdd(r.Context(), cmd, requestAgent(r))
 		if err != nil || resp.Status != ubstatus.Success {
 			if err != nil {
 				slog.Error("role add error", "error", err)
@@ -586,7 +628,7 @@ func RoleEditPostRoute(mgmt ubmanage.ManagementService) contracts.Route {
 		name := f.Name
 		sys := f.SystemName
 		cmd := ubmanage.RoleUpdateCommand{Id: roleId, Name: &name, SystemName: &sys}
-		resp, err := mgmt.RoleUpdate(r.Context(), cmd, "web:ubadminpanel")
+		resp, err := mgmt.RoleUpdate(r.Context(), cmd, requestAgent(r))
 		if err != nil || resp.Status != ubstatus.Success {
 			errMap := resp.GetValidationMap()
 			msg := resp.Message
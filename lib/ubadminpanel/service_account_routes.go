@@ -0,0 +1,192 @@
+package ubadminpanel
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kernelplex/ubase/lib/contracts"
+	"github.com/kernelplex/ubase/lib/forms"
+	"github.com/kernelplex/ubase/lib/ubadminpanel/templ/views"
+	"github.com/kernelplex/ubase/lib/ubdata"
+	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+// serviceAccountCreateForm is used to parse service account creation form fields.
+type serviceAccountCreateForm struct {
+	OrganizationId int64  `json:"organization_id"`
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+}
+
+func listOrganizations(r *http.Request, mgmt ubmanage.ManagementService) []ubdata.Organization {
+	resp, err := mgmt.OrganizationList(r.Context())
+	if err != nil || resp.Status != ubstatus.Success {
+		slog.Error("organization list error", "error", err)
+		return []ubdata.Organization{}
+	}
+	return resp.Data
+}
+
+// ServiceAccountsRoute lists service accounts, optionally filtered by their
+// owning organization. They are kept out of the users list.
+func ServiceAccountsRoute(mgmt ubmanage.ManagementService,
+	adminLinkService contracts.AdminLinkService,
+) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		orgId, _ := strconv.ParseInt(r.URL.Query().Get("org"), 10, 64)
+		resp, err := mgmt.ServiceAccountList(r.Context(), orgId)
+		if err != nil || resp.Status != ubstatus.Success {
+			slog.Error("service account list error", "error", err)
+			http.Error(w, "Failed to load service accounts", http.StatusInternalServerError)
+			return
+		}
+
+		if isHTMX(r) {
+			_ = views.ServiceAccountsTable(resp.Data).Render(r.Context(), w)
+			return
+		}
+		_ = views.ServiceAccountsPage(contracts.ServiceAccountsPageViewModel{
+			BaseViewModel: contracts.BaseViewModel{
+				Fragment: false,
+				Links:    adminLinkService.GetLinks(r),
+			},
+			ServiceAccounts: resp.Data,
+			Organizations:   listOrganizations(r, mgmt),
+			OrganizationID:  orgId,
+		}).Render(r.Context(), w)
+	}
+
+	return contracts.Route{
+		Path:               "GET /admin/service-accounts",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
+
+// ServiceAccountOverviewRoute shows a single service account by ID.
+func ServiceAccountOverviewRoute(mgmt ubmanage.ManagementService,
+	adminLinkService contracts.AdminLinkService,
+) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+		resp, err := mgmt.UserGetById(r.Context(), id)
+		if err != nil || resp.Status != ubstatus.Success || !resp.Data.State.ServiceAccount {
+			slog.Error("service account get error", "error", err, "id", id, "status", resp.Status)
+			http.NotFound(w, r)
+			return
+		}
+		st := resp.Data.State
+
+		organization := ""
+		orgResp, err := mgmt.OrganizationGet(r.Context(), st.OwnerOrganizationId)
+		if err == nil && orgResp.Status == ubstatus.Success {
+			organization = orgResp.Data.State.Name
+		}
+
+		_ = views.ServiceAccountOverview(contracts.ServiceAccountOverviewViewModel{
+			BaseViewModel: contracts.BaseViewModel{
+				Fragment: false,
+				Links:    adminLinkService.GetLinks(r),
+			},
+			ID:             id,
+			Name:           st.DisplayName,
+			Description:    st.Description,
+			OrganizationID: st.OwnerOrganizationId,
+			Organization:   organization,
+			Disabled:       st.Disabled,
+			CreatedAt:      st.CreatedAt,
+		}).Render(r.Context(), w)
+	}
+
+	return contracts.Route{
+		Path:               "GET /admin/service-accounts/{id}",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
+
+// ServiceAccountCreateRoute renders the add service account form.
+func ServiceAccountCreateRoute(mgmt ubmanage.ManagementService,
+	adminLinkService contracts.AdminLinkService,
+) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		orgId, _ := strconv.ParseInt(r.URL.Query().Get("org"), 10, 64)
+		_ = views.ServiceAccountForm(contracts.ServiceAccountFormViewModel{
+			BaseViewModel: contracts.BaseViewModel{
+				Fragment: isHTMX(r),
+				Links:    adminLinkService.GetLinks(r),
+			},
+			Organizations:  listOrganizations(r, mgmt),
+			OrganizationID: orgId,
+		}).Render(r.Context(), w)
+	}
+
+	return contracts.Route{
+		Path:               "GET /admin/service-accounts/new",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
+
+func ServiceAccountCreatePostRoute(mgmt ubmanage.ManagementService,
+	adminLinkService contracts.AdminLinkService,
+) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var f serviceAccountCreateForm
+		if err := forms.ParseFormToStruct(r, &f); err != nil {
+			_ = views.ServiceAccountForm(contracts.ServiceAccountFormViewModel{
+				BaseViewModel: contracts.BaseViewModel{
+					Fragment: isHTMX(r),
+					Links:    adminLinkService.GetLinks(r),
+				},
+				Organizations: listOrganizations(r, mgmt),
+				Error:         "Invalid form submission",
+			}).Render(r.Context(), w)
+			return
+		}
+		command := ubmanage.ServiceAccountCreateCommand{
+			OrganizationId: f.OrganizationId,
+			Name:           strings.TrimSpace(f.Name),
+			Description:    strings.TrimSpace(f.Description),
+		}
+		resp, err := mgmt.ServiceAccountAdd(r.Context(), command, requestAgent(r))
+		if err != nil || resp.Status != ubstatus.Success {
+			if err != nil {
+				slog.Error("service account add error", "error", err)
+			}
+			_ = views.ServiceAccountForm(contracts.ServiceAccountFormViewModel{
+				BaseViewModel: contracts.BaseViewModel{
+					Fragment: isHTMX(r),
+					Links:    adminLinkService.GetLinks(r),
+				},
+				Organizations:  listOrganizations(r, mgmt),
+				OrganizationID: command.OrganizationId,
+				Name:           command.Name,
+				Description:    command.Description,
+				Error:          resp.Message,
+				FieldErrors:    resp.GetValidationMap(),
+			}).Render(r.Context(), w)
+			return
+		}
+		dest := "/admin/service-accounts/" + strconv.FormatInt(resp.Data.Id, 10)
+		if isHTMX(r) {
+			w.Header().Set("HX-Redirect", dest)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.Redirect(w, r, dest, http.StatusSeeOther)
+	}
+
+	return contracts.Route{
+		Path:               "POST /admin/service-accounts/new",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
@@ -69,7 +69,36 @@ func Login(vm contracts.LoginViewModel) templ.Component {
 					return templ_7745c5c3_Err
 				}
 			}
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "<form class=\"auth-form\" hx-post=\"/admin/login\" hx-target=\"#main\" hx-swap=\"innerHTML\"><div class=\"form-field\"><label for=\"email\">Email</label> <input id=\"email\" type=\"email\" name=\"email\" autocomplete=\"username\" placeholder=\"you@example.com\" required></div><div class=\"form-field\"><label for=\"password\">Password</label> <input id=\"password\" type=\"password\" name=\"password\" autocomplete=\"current-password\" placeholder=\"••••••••\" required></div><div class=\"form-actions\"><button type=\"submit\">Sign In</button></div></form></div></section>")
+			if vm.ResendVerification {
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "<form class=\"auth-form\" hx-post=\"/admin/verify/resend\" hx-target=\"#main\" hx-swap=\"innerHTML\"><input type=\"hidden\" name=\"email\" value=\"")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				var templ_7745c5c3_Var4 string
+				templ_7745c5c3_Var4, templ_7745c5c3_Err = templ.JoinStringErrs(vm.Email)
+				if templ_7745c5c3_Err != nil {
+					return templ.Error{Err: templ_7745c5c3_Err, FileName: `lib/ubadminpanel/templ/views/login.templ`, Line: 18, Col: 56}
+				}
+				_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var4))
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "\"><div class=\"form-actions\"><button type=\"submit\">Resend Verification Email</button></div></form>")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "<form class=\"auth-form\" hx-post=\"/admin/login\" hx-target=\"#main\" hx-swap=\"innerHTML\"><div class=\"form-field\"><label for=\"email\">Email</label> <input id=\"email\" type=\"email\" name=\"email\" autocomplete=\"username\" placeholder=\"you@example.com\" required></div><div class=\"form-field\"><label for=\"password\">Password</label> <input id=\"password\" type=\"password\" name=\"password\" autocomplete=\"current-password\" placeholder=\"••••••••\" required></div><div class=\"form-actions\"><button type=\"submit\">Sign In</button></div></form>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			if vm.EmailLogin {
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "<p><a href=\"/admin/login/email\">Sign in with an email link instead</a></p>")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 8, "</div></section>")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
@@ -44,7 +44,7 @@ func RoleUsersTable(users []ubdata.User, memberSet map[int64]bool, roleId int64)
 			}
 		} else {
 			for _, u := range users {
-				templ_7745c5c3_Err = RoleUserRow(roleId, u, memberSet[u.UserID]).Render(ctx, templ_7745c5c3_Buffer)
+				templ_7745c5c3_Err = RoleUserRow(roleId, u, memberSet[u.UserID], "").Render(ctx, templ_7745c5c3_Buffer)
 				if templ_7745c5c3_Err != nil {
 					return templ_7745c5c3_Err
 				}
@@ -8,9 +8,12 @@ package views
 import "github.com/a-h/templ"
 import templruntime "github.com/a-h/templ/runtime"
 
-import "github.com/kernelplex/ubase/lib/ubdata"
+import (
+	"github.com/kernelplex/ubase/lib/contracts"
+	"github.com/kernelplex/ubase/lib/ubdata"
+)
 
-func UserRolesTable(userId int64, roles []ubdata.RoleRow, memberSet map[int64]bool, orgId int64) templ.Component {
+func UserRolesTable(userId int64, roles []ubdata.RoleRow, memberships map[int64]contracts.UserRoleMembership, orgId int64) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
@@ -31,18 +34,18 @@ func UserRolesTable(userId int64, roles []ubdata.RoleRow, memberSet map[int64]bo
 			templ_7745c5c3_Var1 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<div id=\"user-roles\"><table class=\"data-table\"><thead><tr><th style=\"width: 120px; text-align: left;\">ID</th><th style=\"text-align: left;\">Name</th><th style=\"text-align: left;\">System Name</th><th style=\"width: 100px; text-align: left;\">In Role</th></tr></thead> <tbody>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<div id=\"user-roles\"><table class=\"data-table\"><thead><tr><th style=\"width: 120px; text-align: left;\">ID</th><th style=\"text-align: left;\">Name</th><th style=\"text-align: left;\">System Name</th><th style=\"width: 160px; text-align: left;\">Membership</th><th style=\"width: 100px; text-align: left;\">In Role</th></tr></thead> <tbody>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
 		if len(roles) == 0 {
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "<tr><td colspan=\"4\" style=\"color: var(--text-muted); padding: 0.75rem 0;\">No roles in this organization.</td></tr>")
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "<tr><td colspan=\"5\" style=\"color: var(--text-muted); padding: 0.75rem 0;\">No roles in this organization.</td></tr>")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
 		} else {
 			for _, r := range roles {
-				templ_7745c5c3_Err = UserRoleRow(userId, r, memberSet[r.ID], orgId).Render(ctx, templ_7745c5c3_Buffer)
+				templ_7745c5c3_Err = UserRoleRow(userId, r, memberships[r.ID], orgId).Render(ctx, templ_7745c5c3_Buffer)
 				if templ_7745c5c3_Err != nil {
 					return templ_7745c5c3_Err
 				}
@@ -1,10 +1,13 @@
 package ubadminpanel
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/kernelplex/ubase/lib/contracts"
 	"github.com/kernelplex/ubase/lib/forms"
@@ -87,6 +90,10 @@ func UserOverviewRoute(mgmt ubmanage.ManagementService,
 			return
 		}
 		st := resp.Data.State
+		if st.ServiceAccount {
+			http.Redirect(w, r, "/admin/service-accounts/"+idStr, http.StatusSeeOther)
+			return
+		}
 		orgsResp, _ := mgmt.OrganizationList(r.Context())
 		orgs := []ubdata.Organization{}
 		if orgsResp.Status == ubstatus.Success {
@@ -119,6 +126,10 @@ func UserOverviewRoute(mgmt ubmanage.ManagementService,
 			FailedLoginAttempts:  st.FailedLoginAttempts,
 			Organizations:        orgs,
 			SelectedOrganization: selectedOrg,
+			Erased:               st.Erased,
+			ErasedAt:             st.ErasedAt,
+			PlaintextHistory:     st.PlaintextHistory,
+			Tab:                  r.URL.Query().Get("tab"),
 		}).Render(r.Context(), w)
 	}
 	return contracts.Route{
@@ -147,17 +158,111 @@ func UserRolesListRoute(mgmt ubmanage.ManagementService) contracts.Route {
 			http.Error(w, "Failed to load roles", http.StatusInternalServerError)
 			return
 		}
-		hasResp, _ := mgmt.UserGetOrganizationRoles(r.Context(), id, orgId)
-		memberSet := map[int64]bool{}
-		if hasResp.Status == ubstatus.Success {
-			for _, rr := range hasResp.Data {
-				memberSet[rr.ID] = true
+		memberships := userRoleMemberships(r.Context(), mgmt, id, orgId, time.Now())
+		_ = views.UserRolesTable(id, rolesResp.Data, memberships, orgId).Render(r.Context(), w)
+	}
+	return contracts.Route{
+		Path:               "GET /admin/users/{id}/roles",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
+
+// userRoleMemberships returns the user's memberships of the organization's
+// roles, keyed by role.
+func userRoleMemberships(ctx context.Context, mgmt ubmanage.ManagementService, userId int64, orgId int64, now time.Time) map[int64]contracts.UserRoleMembership {
+	memberships := map[int64]contracts.UserRoleMembership{}
+	resp, err := mgmt.UserGetAllOrganizationRoles(ctx, userId)
+	if err != nil || resp.Status != ubstatus.Success {
+		slog.Error("user roles error", "error", err, "user", userId)
+		return memberships
+	}
+	for _, role := range resp.Data {
+		if role.OrganizationID != orgId {
+			continue
+		}
+		membership := contracts.UserRoleMembership{InRole: true}
+		switch {
+		case role.NotBefore > now.Unix():
+			membership.Window = "starts in " + formatRemaining(time.Unix(role.NotBefore, 0).Sub(now))
+			membership.Inactive = true
+		case role.ExpiresAt != 0 && role.ExpiresAt <= now.Unix():
+			membership.Window = "expired"
+			membership.Inactive = true
+		case role.ExpiresAt != 0:
+			membership.Window = formatRemaining(time.Unix(role.ExpiresAt, 0).Sub(now)) + " left"
+		}
+		memberships[role.RoleID] = membership
+	}
+	return memberships
+}
+
+// formatRemaining formats a duration to the two largest units, such as
+// "2d 4h" or "3h 10m".
+func formatRemaining(d time.Duration) string {
+	d = d.Round(time.Minute)
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("%dm", minutes)
+	default:
+		return "<1m"
+	}
+}
+
+// UserEffectivePermissionsRoute explains how the user holds their permissions
+// in an organization.
+func UserEffectivePermissionsRoute(prefect ubmanage.PrefectService, catalog *ubmanage.PermissionCatalog) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+		orgId, _ := strconv.ParseInt(r.URL.Query().Get("org"), 10, 64)
+		if orgId <= 0 {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		vm := contracts.EffectivePermissionsViewModel{
+			UserID:         id,
+			OrganizationID: orgId,
+			Permission:     strings.TrimSpace(r.URL.Query().Get("permission")),
+		}
+		explanation, err := prefect.ExplainPermissions(r.Context(), id, orgId, vm.Permission)
+		if err != nil {
+			slog.Error("explain permissions error", "error", err, "user", id, "org", orgId)
+			vm.Error = "Failed to load permissions"
+		}
+		vm.Excluded = explanation.Excluded
+		for _, grant := range explanation.Grants {
+			if n := len(vm.Permissions); n == 0 || vm.Permissions[n-1].Permission.Name != grant.Permission {
+				vm.Permissions = append(vm.Permissions, contracts.EffectivePermission{
+					Permission: rolePermissionItem(catalog, grant.Permission, true),
+				})
+			}
+			last := &vm.Permissions[len(vm.Permissions)-1]
+			effective := contracts.EffectivePermissionGrant{
+				RoleID:   grant.RoleId,
+				RoleName: grant.RoleName,
+				Source:   grant.SourceDescription(),
+				Policy:   grant.Policy,
 			}
+			if grant.ExpiresAt != 0 {
+				effective.Remaining = formatRemaining(time.Until(time.Unix(grant.ExpiresAt, 0)))
+			}
+			last.Grants = append(last.Grants, effective)
 		}
-		_ = views.UserRolesTable(id, rolesResp.Data, memberSet, orgId).Render(r.Context(), w)
+		_ = views.UserEffectivePermissions(vm).Render(r.Context(), w)
 	}
 	return contracts.Route{
-		Path:               "GET /admin/users/{id}/roles",
+		Path:               "GET /admin/users/{id}/permissions",
 		RequiresPermission: PermSystemAdmin,
 		Func:               handler,
 	}
@@ -183,13 +288,11 @@ func UserRolesAddRoute(mgmt ubmanage.ManagementService) contracts.Route {
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
-		_, _ = mgmt.UserAddToRole(r.Context(), ubmanage.UserAddToRoleCommand{UserId: id, RoleId: roleId}, "web:ubadminpanel")
-		hasResp, _ := mgmt.UserGetOrganizationRoles(r.Context(), id, orgId)
-		memberSet := map[int64]bool{}
-		if hasResp.Status == ubstatus.Success {
-			for _, rr := range hasResp.Data {
-				memberSet[rr.ID] = true
-			}
+		added, _ := mgmt.UserAddToRole(r.Context(), ubmanage.UserAddToRoleCommand{UserId: id, RoleId: roleId}, requestAgent(r))
+		memberships := userRoleMemberships(r.Context(), mgmt, id, orgId, time.Now())
+		membership := memberships[roleId]
+		if added.Status != ubstatus.Success {
+			membership.Error = added.Message
 		}
 		rolesResp, _ := mgmt.RoleList(r.Context(), orgId)
 		var role ubdata.RoleRow
@@ -201,7 +304,7 @@ func UserRolesAddRoute(mgmt ubmanage.ManagementService) contracts.Route {
 				}
 			}
 		}
-		_ = views.UserRoleRow(id, role, memberSet[roleId], orgId).Render(r.Context(), w)
+		_ = views.UserRoleRow(id, role, membership, orgId).Render(r.Context(), w)
 	}
 	return contracts.Route{
 		Path:               "POST /admin/users/{id}/roles/add",
@@ -230,14 +333,8 @@ func UserRolesRemoveRoute(mgmt ubmanage.ManagementService) contracts.Route {
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
-		_, _ = mgmt.UserRemoveFromRole(r.Context(), ubmanage.UserRemoveFromRoleCommand{UserId: id, RoleId: roleId}, "web:ubadminpanel")
-		hasResp, _ := mgmt.UserGetOrganizationRoles(r.Context(), id, orgId)
-		memberSet := map[int64]bool{}
-		if hasResp.Status == ubstatus.Success {
-			for _, rr := range hasResp.Data {
-				memberSet[rr.ID] = true
-			}
-		}
+		_, _ = mgmt.UserRemoveFromRole(r.Context(), ubmanage.UserRemoveFromRoleCommand{UserId: id, RoleId: roleId}, requestAgent(r))
+		memberships := userRoleMemberships(r.Context(), mgmt, id, orgId, time.Now())
 		rolesResp, _ := mgmt.RoleList(r.Context(), orgId)
 		var role ubdata.RoleRow
 		if rolesResp.Status == ubstatus.Success {
@@ -248,7 +345,7 @@ func UserRolesRemoveRoute(mgmt ubmanage.ManagementService) contracts.Route {
 				}
 			}
 		}
-		_ = views.UserRoleRow(id, role, memberSet[roleId], orgId).Render(r.Context(), w)
+		_ = views.UserRoleRow(id, role, memberships[roleId], orgId).Render(r.Context(), w)
 	}
 	return contracts.Route{
 		Path:               "POST /admin/users/{id}/roles/remove",
@@ -312,7 +409,7 @@ func UserCreatePostRoute(mgmt ubmanage.ManagementService,
 		display := strings.TrimSpace(f.DisplayName)
 		verified := f.Verified
 		cmd := ubmanage.UserCreateCommand{Email: email, Password: password, FirstName: first, LastName: last, DisplayName: display, Verified: verified}
-		resp, err := mgmt.UserAdd(r.Context(), cmd, "web:ubadminpanel")
+		resp, err := mgmt.UserAdd(r.Context(), cmd, requestAgent(r))
 		if err != nil || resp.Status != ubstatus.Success {
 			if err != nil {
 				slog.Error("user add error", "error", err)
@@ -360,7 +457,7 @@ func UserEditRoute(mgmt ubmanage.ManagementService,
 		}
 		if r.Method == http.MethodGet {
 			uresp, err := mgmt.UserGetById(r.Context(), id)
-			if err != nil || uresp.Status != ubstatus.Success {
+			if err != nil || uresp.Status != ubstatus.Success || uresp.Data.State.Erased {
 				http.NotFound(w, r)
 				return
 			}
@@ -408,7 +505,7 @@ func UserEditRoute(mgmt ubmanage.ManagementService,
 			cmd.LastName = &last
 			cmd.DisplayName = &display
 			cmd.Verified = &verified
-			resp, err := mgmt.UserUpdate(r.Context(), cmd, "web:ubadminpanel")
+			resp, err := mgmt.UserUpdate(r.Context(), cmd, requestAgent(r))
 			if err != nil || resp.Status != ubstatus.Success {
 				errMap := resp.GetValidationMap()
 				msg := resp.Message
@@ -443,6 +540,213 @@ func UserEditRoute(mgmt ubmanage.ManagementService,
 	}
 }
 
+// UserEraseRoute erases a user and returns to their (now tombstoned) overview
+func UserEraseRoute(mgmt ubmanage.ManagementService) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		idStr := r.PathValue("id")
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil || id <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		resp, err := mgmt.UserErase(r.Context(), ubmanage.UserEraseCommand{Id: id}, requestAgent(r))
+		if err != nil {
+			slog.Error("failed to erase user", "error", err, "id", id)
+			http.Error(w, "Failed to erase user", http.StatusInternalServerError)
+			return
+		}
+		if resp.Status == ubstatus.NotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if resp.Status != ubstatus.Success {
+			http.Error(w, resp.Message, http.StatusBadRequest)
+			return
+		}
+
+		dest := "/admin/users/" + strconv.FormatInt(id, 10)
+		if isHTMX(r) {
+			w.Header().Set("HX-Redirect", dest)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.Redirect(w, r, dest, http.StatusSeeOther)
+	}
+
+	return contracts.Route{
+		Path:               "POST /admin/users/{id}/erase",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
+
+// UserResendVerificationRoute emails the user a new verification link and
+// reports the outcome next to the button on the user overview.
+func UserResendVerificationRoute(mgmt ubmanage.ManagementService) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		idStr := r.PathValue("id")
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil || id <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		resp, err := mgmt.UserResendVerification(r.Context(), ubmanage.UserResendVerificationCommand{Id: id}, requestAgent(r))
+		if err != nil {
+			slog.Error("failed to resend verification", "error", err, "id", id)
+			_ = views.VerificationResendStatus("Failed to send a verification email", true).Render(r.Context(), w)
+			return
+		}
+		switch {
+		case resp.Status == ubstatus.NotFound:
+			http.NotFound(w, r)
+		case resp.Status != ubstatus.Success:
+			_ = views.VerificationResendStatus(resp.Message, true).Render(r.Context(), w)
+		case !resp.Data.Sent:
+			_ = views.VerificationResendStatus("A new token was issued, but no mailer is configured to send it", true).Render(r.Context(), w)
+		default:
+			_ = views.VerificationResendStatus("Verification email sent", false).Render(r.Context(), w)
+		}
+	}
+
+	return contracts.Route{
+		Path:               "POST /admin/users/{id}/verification/resend",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
+
+// UserImpersonateRoute starts an impersonation session for the given user and
+// replaces the session cookie with one that carries both identities.
+func UserImpersonateRoute(mgmt ubmanage.ManagementService, cookieManager contracts.AuthTokenCookieManager) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		idStr := r.PathValue("id")
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil || id <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		token, found := cookieManager.TokenFromContext(r.Context())
+		if !found {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if token.IsImpersonating() {
+			http.Error(w, "Stop the current impersonation first", http.StatusConflict)
+			return
+		}
+
+		resp, err := mgmt.UserStartImpersonation(r.Context(), ubmanage.UserStartImpersonationCommand{
+			ImpersonatorId: token.UserId,
+			OrganizationId: token.OrganizationId,
+			TargetId:       id,
+		}, token.ToAgent())
+		if err != nil {
+			slog.Error("failed to start impersonation", "error", err, "id", id)
+			http.Error(w, "Failed to start impersonation", http.StatusInternalServerError)
+			return
+		}
+		switch resp.Status {
+		case ubstatus.Success:
+		case ubstatus.NotFound:
+			http.NotFound(w, r)
+			return
+		case ubstatus.NotAuthorized:
+			http.Error(w, resp.Message, http.StatusForbidden)
+			return
+		default:
+			http.Error(w, resp.Message, http.StatusBadRequest)
+			return
+		}
+
+		if err := cookieManager.WriteAuthTokenCookie(w, token.StartImpersonation(resp.Data.TargetId, resp.Data.TargetOrganizationId, resp.Data.TargetEmail)); err != nil {
+			slog.Error("write cookie error", "error", err)
+			http.Error(w, "Failed to start impersonation", http.StatusInternalServerError)
+			return
+		}
+
+		if isHTMX(r) {
+			w.Header().Set("HX-Redirect", "/admin")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+	}
+
+	return contracts.Route{
+		Path:               "POST /admin/users/{id}/impersonate",
+		RequiresPermission: PermImpersonateUsers,
+		Func:               handler,
+	}
+}
+
+const loginHistoryLimit = 50
+
+// UserLoginsRoute renders the login history table for a user
+func UserLoginsRoute(mgmt ubmanage.ManagementService) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		idStr := r.PathValue("id")
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil || id <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		resp, err := mgmt.UserLoginHistory(r.Context(), id, loginHistoryLimit, 0)
+		if err != nil || resp.Status != ubstatus.Success {
+			slog.Error("failed to load login history", "error", err, "id", id)
+			http.Error(w, "Failed to load login history", http.StatusInternalServerError)
+			return
+		}
+		_ = views.LoginsTable("user-logins", resp.Data, false).Render(r.Context(), w)
+	}
+
+	return contracts.Route{
+		Path:               "GET /admin/users/{id}/logins",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
+
+// LoginSearchRoute finds logins across all users by IP address
+func LoginSearchRoute(
+	mgmt ubmanage.ManagementService,
+	adminLinkService contracts.AdminLinkService,
+) contracts.Route {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		ip := strings.TrimSpace(r.URL.Query().Get("ip"))
+		var logins []ubdata.UserLogin
+		if ip != "" {
+			resp, err := mgmt.UserLoginsByIp(r.Context(), ip, loginHistoryLimit, 0)
+			if err != nil || resp.Status != ubstatus.Success {
+				slog.Error("login search error", "error", err)
+				http.Error(w, "Failed to search logins", http.StatusInternalServerError)
+				return
+			}
+			logins = resp.Data
+		}
+		if isHTMX(r) {
+			_ = views.LoginsTable("login-table", logins, true).Render(r.Context(), w)
+			return
+		}
+		_ = views.LoginSearchPage(contracts.LoginSearchViewModel{
+			BaseViewModel: contracts.BaseViewModel{
+				Fragment: false,
+				Links:    adminLinkService.GetLinks(r),
+			},
+			IpAddress: ip,
+			Logins:    logins,
+		}).Render(r.Context(), w)
+	}
+	return contracts.Route{
+		Path:               "GET /admin/logins",
+		RequiresPermission: PermSystemAdmin,
+		Func:               handler,
+	}
+}
+
 // UserSettingsRoute displays the settings for a user
 func UserSettingsRoute(mgmt ubmanage.ManagementService) contracts.Route {
 	handler := func(w http.ResponseWriter, r *http.Request) {
@@ -498,7 +802,7 @@ func UserSettingsAddRoute(mgmt ubmanage.ManagementService) contracts.Route {
 		_, err = mgmt.UserSettingsAdd(r.Context(), ubmanage.UserSettingsAddCommand{
 			Id:       id,
 			Settings: map[string]string{name: value},
-		}, "web:ubadminpanel")
+		}, requestAgent(r))
 
 		if err != nil {
 			slog.Error("failed to add user setting", "error", err)
@@ -548,7 +852,7 @@ func UserSettingsRemoveRoute(mgmt ubmanage.ManagementService) contracts.Route {
 		_, err = mgmt.UserSettingsRemove(r.Context(), ubmanage.UserSettingsRemoveCommand{
 			Id:          id,
 			SettingKeys: []string{name},
-		}, "web:ubadminpanel")
+		}, requestAgent(r))
 
 		if err != nil {
 			slog.Error("failed to remove user setting", "error", err)
@@ -69,6 +69,34 @@ func (this *LRUCache[K, V]) Remove(key K) bool {
 	return false
 }
 
+// Clear removes all items from the cache.
+func (this *LRUCache[K, V]) Clear() {
+	this.cache = make(map[K]*lruCacheNode[K, V])
+	this.head.next = this.tail
+	this.tail.prev = this.head
+}
+
+// RemoveFunc removes every item for which remove returns true and returns the
+// number of items removed.
+func (this *LRUCache[K, V]) RemoveFunc(remove func(K, V) bool) int {
+	removed := 0
+	for node := this.head.next; node != this.tail; {
+		next := node.next
+		if remove(node.key, node.value) {
+			this.removeNode(node)
+			delete(this.cache, node.key)
+			removed++
+		}
+		node = next
+	}
+	return removed
+}
+
+// Len returns the number of items in the cache.
+func (this *LRUCache[K, V]) Len() int {
+	return len(this.cache)
+}
+
 // addNode adds a new node right after the head.
 func (this *LRUCache[K, V]) addNode(node *lruCacheNode[K, V]) {
 	node.prev = this.head
@@ -116,3 +116,43 @@ func TestPriorityCache_RollsOffOldestValue(t *testing.T) {
 		}
 	}
 }
+
+func TestPriorityCache_ClearRemovesAllValues(t *testing.T) {
+	lru := algorithms.NewLRUCache[int, string](10)
+
+	for x := range 5 {
+		lru.Put(x, fmt.Sprintf("Item %d", x))
+	}
+
+	lru.Clear()
+
+	for x := range 5 {
+		if val, found := lru.Get(x); found {
+			t.Errorf("Cache should not have returned a value. Got: %s", val)
+		}
+	}
+
+	// The cache should still be usable after clearing.
+	lru.Put(1, "Item 1")
+	val, found := lru.Get(1)
+	if !found || val != "Item 1" {
+		t.Errorf("Incorrect value retrieved from cache wanted '%s' got '%s'", "Item 1", val)
+	}
+}
+
+func TestLRUCache_RemoveFunc(t *testing.T) {
+	lru := algorithms.NewLRUCache[int, string](10)
+	for x := range 6 {
+		lru.Put(x, fmt.Sprintf("Item %d", x))
+	}
+
+	removed := lru.RemoveFunc(func(key int, _ string) bool { return key%2 == 0 })
+	if removed != 3 || lru.Len() != 3 {
+		t.Errorf("Expected 3 removed and 3 left, got %d and %d", removed, lru.Len())
+	}
+	for x := range 6 {
+		if _, found := lru.Get(x); found != (x%2 == 1) {
+			t.Errorf("Unexpected presence of key %d: %v", x, found)
+		}
+	}
+}
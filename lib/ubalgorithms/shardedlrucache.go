@@ -0,0 +1,181 @@
+package ubalgorithms
+
+import (
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultShardCount is the number of shards used when none is specified.
+const DefaultShardCount = 16
+
+// ShardedLRUCacheOptions configures a ShardedLRUCache.
+type ShardedLRUCacheOptions struct {
+	// Number of independently locked shards. Defaults to DefaultShardCount
+	// and is never more than the capacity.
+	Shards int
+
+	// How long an item stays in the cache after it is put. Zero keeps items
+	// until they are evicted or removed.
+	TTL time.Duration
+}
+
+// CacheStats are counters describing how a cache has been used.
+type CacheStats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+}
+
+type shardedLRUEntry[V any] struct {
+	value     V
+	expiresAt int64
+}
+
+type lruShard[K comparable, V any] struct {
+	lock     sync.Mutex
+	capacity int
+	cache    *LRUCache[K, shardedLRUEntry[V]]
+}
+
+// ShardedLRUCache is an LRUCache which is safe for concurrent use. Keys are
+// spread over shards, each an LRUCache with its own lock and an equal share of
+// the capacity, so eviction is least recently used within a shard.
+type ShardedLRUCache[K comparable, V any] struct {
+	seed   maphash.Seed
+	ttl    time.Duration
+	shards []*lruShard[K, V]
+
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+// NewShardedLRUCache initializes a new ShardedLRUCache holding about capacity
+// items.
+func NewShardedLRUCache[K comparable, V any](capacity int, options ShardedLRUCacheOptions) *ShardedLRUCache[K, V] {
+	capacity = max(capacity, 1)
+	shardCount := options.Shards
+	if shardCount <= 0 {
+		shardCount = DefaultShardCount
+	}
+	shardCount = min(shardCount, capacity)
+	shardCapacity := (capacity + shardCount - 1) / shardCount
+
+	shards := make([]*lruShard[K, V], shardCount)
+	for i := range shards {
+		shards[i] = &lruShard[K, V]{
+			capacity: shardCapacity,
+			cache:    NewLRUCache[K, shardedLRUEntry[V]](shardCapacity),
+		}
+	}
+	return &ShardedLRUCache[K, V]{
+		seed:   maphash.MakeSeed(),
+		ttl:    max(options.TTL, 0),
+		shards: shards,
+	}
+}
+
+func (this *ShardedLRUCache[K, V]) shard(key K) *lruShard[K, V] {
+	return this.shards[maphash.Comparable(this.seed, key)%uint64(len(this.shards))]
+}
+
+// Get retrieves the value of the key if it exists in the cache and has not
+// expired, otherwise returns zero value and false.
+func (this *ShardedLRUCache[K, V]) Get(key K) (V, bool) {
+	shard := this.shard(key)
+	shard.lock.Lock()
+	entry, found := shard.cache.Get(key)
+	if found && entry.expiresAt != 0 && time.Now().UnixNano() >= entry.expiresAt {
+		shard.cache.Remove(key)
+		found = false
+		this.expirations.Add(1)
+	}
+	shard.lock.Unlock()
+
+	if !found {
+		this.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+	this.hits.Add(1)
+	return entry.value, true
+}
+
+// Put inserts or updates the value of the key.
+// If the key's shard exceeds its capacity, it removes the shard's least
+// recently used item.
+func (this *ShardedLRUCache[K, V]) Put(key K, value V) {
+	entry := shardedLRUEntry[V]{value: value}
+	if this.ttl > 0 {
+		entry.expiresAt = time.Now().Add(this.ttl).UnixNano()
+	}
+
+	shard := this.shard(key)
+	shard.lock.Lock()
+	_, exists := shard.cache.Get(key)
+	evicts := !exists && shard.cache.Len() >= shard.capacity
+	shard.cache.Put(key, entry)
+	shard.lock.Unlock()
+
+	if evicts {
+		this.evictions.Add(1)
+	}
+}
+
+// Remove removes an item from the cache by key if it exists.
+func (this *ShardedLRUCache[K, V]) Remove(key K) bool {
+	shard := this.shard(key)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	return shard.cache.Remove(key)
+}
+
+// RemoveFunc removes every item for which remove returns true and returns the
+// number of items removed. Shards are locked one at a time, so items put
+// concurrently may be missed.
+func (this *ShardedLRUCache[K, V]) RemoveFunc(remove func(K, V) bool) int {
+	removed := 0
+	for _, shard := range this.shards {
+		shard.lock.Lock()
+		removed += shard.cache.RemoveFunc(func(key K, entry shardedLRUEntry[V]) bool {
+			return remove(key, entry.value)
+		})
+		shard.lock.Unlock()
+	}
+	return removed
+}
+
+// Clear removes all items from the cache. The counters are kept.
+func (this *ShardedLRUCache[K, V]) Clear() {
+	for _, shard := range this.shards {
+		shard.lock.Lock()
+		shard.cache.Clear()
+		shard.lock.Unlock()
+	}
+}
+
+// Len returns the number of items in the cache, including expired items that
+// have not been removed yet.
+func (this *ShardedLRUCache[K, V]) Len() int {
+	count := 0
+	for _, shard := range this.shards {
+		shard.lock.Lock()
+		count += shard.cache.Len()
+		shard.lock.Unlock()
+	}
+	return count
+}
+
+// Stats returns the cache's counters.
+func (this *ShardedLRUCache[K, V]) Stats() CacheStats {
+	return CacheStats{
+		Hits:        this.hits.Load(),
+		Misses:      this.misses.Load(),
+		Evictions:   this.evictions.Load(),
+		Expirations: this.expirations.Load(),
+	}
+}
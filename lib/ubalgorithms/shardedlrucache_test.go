@@ -0,0 +1,170 @@
+package ubalgorithms_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	algorithms "github.com/kernelplex/ubase/lib/ubalgorithms"
+)
+
+func TestShardedLRUCache_GetPutRemove(t *testing.T) {
+	cache := algorithms.NewShardedLRUCache[string, int](100, algorithms.ShardedLRUCacheOptions{})
+	cache.Put("one", 1)
+	cache.Put("two", 2)
+	cache.Put("one", 11)
+
+	if val, found := cache.Get("one"); !found || val != 11 {
+		t.Errorf("Expected updated value 11, got %d %v", val, found)
+	}
+	if !cache.Remove("two") {
+		t.Error("Expected Remove to return true for existing key")
+	}
+	if cache.Remove("two") {
+		t.Error("Expected Remove to return false for removed key")
+	}
+	if _, found := cache.Get("two"); found {
+		t.Error("Key should have been removed from cache")
+	}
+	if cache.Len() != 1 {
+		t.Errorf("Expected 1 item, got %d", cache.Len())
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Expected 1 hit and 1 miss, got %+v", stats)
+	}
+}
+
+func TestShardedLRUCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	// A single shard behaves exactly like an LRUCache.
+	cache := algorithms.NewShardedLRUCache[int, string](2, algorithms.ShardedLRUCacheOptions{Shards: 1})
+	cache.Put(1, "one")
+	cache.Put(2, "two")
+	cache.Get(1)
+	cache.Put(3, "three")
+
+	if _, found := cache.Get(2); found {
+		t.Error("Least recently used key should have been evicted")
+	}
+	if _, found := cache.Get(1); !found {
+		t.Error("Recently used key should still exist in cache")
+	}
+	if evictions := cache.Stats().Evictions; evictions != 1 {
+		t.Errorf("Expected 1 eviction, got %d", evictions)
+	}
+}
+
+func TestShardedLRUCache_BoundedCapacity(t *testing.T) {
+	cache := algorithms.NewShardedLRUCache[int, int](64, algorithms.ShardedLRUCacheOptions{Shards: 8})
+	for i := range 1000 {
+		cache.Put(i, i)
+	}
+	if cache.Len() > 64 {
+		t.Errorf("Expected at most 64 items, got %d", cache.Len())
+	}
+	stats := cache.Stats()
+	if stats.Evictions != uint64(1000-cache.Len()) {
+		t.Errorf("Expected %d evictions, got %d", 1000-cache.Len(), stats.Evictions)
+	}
+}
+
+func TestShardedLRUCache_TTL(t *testing.T) {
+	cache := algorithms.NewShardedLRUCache[string, string](10, algorithms.ShardedLRUCacheOptions{TTL: 20 * time.Millisecond})
+	cache.Put("key", "value")
+	if _, found := cache.Get("key"); !found {
+		t.Fatal("Expected key to be found before it expires")
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if _, found := cache.Get("key"); found {
+		t.Error("Expected key to have expired")
+	}
+	if cache.Len() != 0 {
+		t.Errorf("Expected expired key to be removed, got %d items", cache.Len())
+	}
+	stats := cache.Stats()
+	if stats.Expirations != 1 || stats.Misses != 1 || stats.Hits != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// Putting again restarts the TTL.
+	cache.Put("key", "again")
+	if val, found := cache.Get("key"); !found || val != "again" {
+		t.Errorf("Expected new value, got %q %v", val, found)
+	}
+}
+
+func TestShardedLRUCache_RemoveFuncAndClear(t *testing.T) {
+	cache := algorithms.NewShardedLRUCache[string, int](100, algorithms.ShardedLRUCacheOptions{})
+	for i := range 10 {
+		cache.Put(fmt.Sprintf("a%d", i), i)
+		cache.Put(fmt.Sprintf("b%d", i), i)
+	}
+
+	removed := cache.RemoveFunc(func(key string, _ int) bool {
+		return strings.HasPrefix(key, "a")
+	})
+	if removed != 10 || cache.Len() != 10 {
+		t.Errorf("Expected 10 removed and 10 left, got %d and %d", removed, cache.Len())
+	}
+	if _, found := cache.Get("b3"); !found {
+		t.Error("Expected unmatched keys to remain")
+	}
+
+	cache.Clear()
+	if cache.Len() != 0 {
+		t.Errorf("Expected empty cache after Clear, got %d items", cache.Len())
+	}
+}
+
+// Run with -race to check the cache is safe for concurrent use.
+func TestShardedLRUCache_Concurrent(t *testing.T) {
+	cache := algorithms.NewShardedLRUCache[int, int](128, algorithms.ShardedLRUCacheOptions{TTL: time.Millisecond})
+
+	var wg sync.WaitGroup
+	for worker := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 2000 {
+				key := (worker*31 + i) % 512
+				cache.Put(key, i)
+				if val, found := cache.Get(key); found && val < 0 {
+					t.Errorf("Unexpected value %d", val)
+				}
+				switch i % 100 {
+				case 0:
+					cache.Remove(key)
+				case 50:
+					cache.RemoveFunc(func(k int, _ int) bool { return k%7 == 0 })
+				case 99:
+					cache.Clear()
+				}
+				_ = cache.Len()
+				_ = cache.Stats()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if cache.Len() > 128 {
+		t.Errorf("Expected at most 128 items, got %d", cache.Len())
+	}
+}
+
+func BenchmarkShardedLRUCacheParallel(b *testing.B) {
+	cache := algorithms.NewShardedLRUCache[int, int](1024, algorithms.ShardedLRUCacheOptions{})
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := i % 2048
+			if _, found := cache.Get(key); !found {
+				cache.Put(key, i)
+			}
+			i++
+		}
+	})
+}
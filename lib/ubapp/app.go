@@ -1,10 +1,13 @@
 package ubapp
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
+	"time"
 
 	evercore "github.com/kernelplex/evercore/base"
 	"github.com/kernelplex/evercore/evercoreuri"
@@ -18,6 +21,7 @@ import (
 	"github.com/kernelplex/ubase/lib/ubenv"
 	"github.com/kernelplex/ubase/lib/ubmailer"
 	"github.com/kernelplex/ubase/lib/ubmanage"
+	"github.com/kernelplex/ubase/lib/ubratelimit"
 	"github.com/kernelplex/ubase/lib/ubsecurity"
 	"github.com/kernelplex/ubase/lib/ubwww"
 	ubase_postgres "github.com/kernelplex/ubase/sql/postgres"
@@ -39,6 +43,11 @@ type UbaseConfig struct {
 	PrimaryOrganization       int64  `env:"PRIMARY_ORGANIZATION" required:"true"`
 	TOTPIssuer                string `env:"TOTP_ISSUER" required:"true"`
 
+	// Hash for new API key secrets: "hmac-sha256" (keyed with the pepper) or
+	// "argon2id". Existing argon2id hashes are upgraded when the key is next
+	// used with "hmac-sha256", and hmac-sha256 hashes are verified either way.
+	ApiKeyHash string `env:"API_KEY_HASH" default:"hmac-sha256"`
+
 	// Mailer
 	MailerType      string `env:"MAILER_TYPE" default:"none"`
 	MailerFrom      string `env:"MAILER_FROM"`
@@ -46,6 +55,57 @@ type UbaseConfig struct {
 	MailerPassword  string `env:"MAILER_PASSWORD"`
 	MailerHost      string `env:"MAILER_HOST"`
 	MailerOutputDir string `env:"MAILER_OUTPUT_DIR"`
+
+	// Login alerts (sent only when a mailer is configured). Organizations
+	// can override the alert settings.
+	BaseUrl                  string `env:"BASE_URL" default:"http://localhost:8080"`
+	LoginAlertNewDevice      bool   `env:"LOGIN_ALERT_NEW_DEVICE" default:"true"`
+	LoginAlertFailedAttempts int64  `env:"LOGIN_ALERT_FAILED_ATTEMPTS" default:"5"`
+
+	// Passwordless login by emailed code, optionally with a magic link.
+	// Requires a mailer.
+	EmailLogin                bool `env:"EMAIL_LOGIN" default:"false"`
+	EmailLoginMagicLink       bool `env:"EMAIL_LOGIN_MAGIC_LINK" default:"true"`
+	EmailLoginMaxAttempts     int  `env:"EMAIL_LOGIN_MAX_ATTEMPTS" default:"5"`
+	EmailLoginCooldownSeconds int  `env:"EMAIL_LOGIN_COOLDOWN_SECONDS" default:"60"`
+
+	// Email verification links (emailed only when a mailer is configured).
+	VerificationTokenTTLSeconds       int `env:"VERIFICATION_TOKEN_TTL_SECONDS" default:"172800"`
+	VerificationResendCooldownSeconds int `env:"VERIFICATION_RESEND_COOLDOWN_SECONDS" default:"60"`
+
+	// Rate limiting of authentication attempts. Use the "sql" store when
+	// running several instances so they share limits. A limit of 0 disables
+	// the corresponding check.
+	RateLimitStore              string `env:"RATE_LIMIT_STORE" default:"memory"`
+	RateLimitIpAttempts         int    `env:"RATE_LIMIT_IP_ATTEMPTS" default:"20"`
+	RateLimitIpWindowSeconds    int    `env:"RATE_LIMIT_IP_WINDOW_SECONDS" default:"60"`
+	RateLimitLoginAttempts      int    `env:"RATE_LIMIT_LOGIN_ATTEMPTS" default:"10"`
+	RateLimitLoginWindowSeconds int    `env:"RATE_LIMIT_LOGIN_WINDOW_SECONDS" default:"900"`
+	RateLimitCodeAttempts       int    `env:"RATE_LIMIT_CODE_ATTEMPTS" default:"5"`
+	RateLimitCodeWindowSeconds  int    `env:"RATE_LIMIT_CODE_WINDOW_SECONDS" default:"900"`
+
+	// Permission caches of the prefect service. The TTL limits how long a
+	// cached entry is trusted if an invalidating event is missed; 0 disables
+	// it.
+	PrefectUserCacheSize       int `env:"PREFECT_USER_CACHE_SIZE" default:"1000"`
+	PrefectGroupCacheSize      int `env:"PREFECT_GROUP_CACHE_SIZE" default:"1000"`
+	PrefectApiKeyCacheSize     int `env:"PREFECT_API_KEY_CACHE_SIZE" default:"1000"`
+	PrefectPermissionCacheSize int `env:"PREFECT_PERMISSION_CACHE_SIZE" default:"1000"`
+	PrefectRelationCacheSize   int `env:"PREFECT_RELATION_CACHE_SIZE" default:"1000"`
+	PrefectCacheTTLSeconds     int `env:"PREFECT_CACHE_TTL_SECONDS" default:"300"`
+
+	// Backoff before the prefect service restarts a failed event
+	// subscription, doubling up to the maximum.
+	PrefectRestartBackoffSeconds    int `env:"PREFECT_RESTART_BACKOFF_SECONDS" default:"1"`
+	PrefectMaxRestartBackoffSeconds int `env:"PREFECT_MAX_RESTART_BACKOFF_SECONDS" default:"60"`
+
+	// How often expired role memberships are removed. Permission checks
+	// ignore expired memberships straight away.
+	RoleExpiryIntervalSeconds int `env:"ROLE_EXPIRY_INTERVAL_SECONDS" default:"60"`
+
+	// JSON file of role templates, added to those the application declares
+	// with WithRoleTemplates.
+	RoleTemplatesFile string `env:"ROLE_TEMPLATES_FILE"`
 }
 
 func UbaseConfigFromEnv() UbaseConfig {
@@ -76,10 +136,14 @@ type UbaseApp struct {
 	mailer                ubmailer.Mailer
 	backgroundMailer      *ubmailer.BackgroundMailer
 	prefectService        ubmanage.PrefectService
+	relationSchema        ubmanage.RelationSchema
+	permissionCatalog     *ubmanage.PermissionCatalog
+	roleTemplates         []ubmanage.RoleTemplate
 	backgroundServices    []BackgroundService
 	permissionsMiddleware *ubwww.PermissionMiddleware
 	adminLinkService      contracts.AdminLinkService
 	adminRenderer         contracts.AdminRenderer
+	rateLimitStore        ubratelimit.Store
 
 	cookieManager         contracts.AuthTokenCookieManager
 	webService            ubwww.WebService
@@ -201,12 +265,123 @@ func (app *UbaseApp) GetManagementService() ubmanage.ManagementService {
 		encryptionService := app.GetEncryptionService()
 		totpService := app.GetTOTPService()
 
-		app.managementService = ubmanage.NewManagement(store, dbadapter, hashService, encryptionService, totpService)
+		config := app.GetConfig()
+
+		var opts []ubmanage.ManagementOption
+		if ubmailer.MailerType(config.MailerType) != ubmailer.None {
+			opts = append(opts, ubmanage.WithLoginAlertOptions(ubmanage.LoginAlertOptions{
+				Enabled:        true,
+				Mailer:         app.GetBackgroundMailer(),
+				BaseUrl:        config.BaseUrl,
+				NewDevice:      config.LoginAlertNewDevice,
+				FailedAttempts: config.LoginAlertFailedAttempts,
+			}))
+			opts = append(opts, ubmanage.WithAccessRequestOptions(ubmanage.AccessRequestOptions{
+				Mailer:  app.GetBackgroundMailer(),
+				BaseUrl: config.BaseUrl,
+			}))
+		}
+
+		verification := ubmanage.VerificationOptions{
+			TokenTTL:       time.Duration(config.VerificationTokenTTLSeconds) * time.Second,
+			ResendCooldown: time.Duration(config.VerificationResendCooldownSeconds) * time.Second,
+			BaseUrl:        config.BaseUrl,
+		}
+		if ubmailer.MailerType(config.MailerType) != ubmailer.None {
+			verification.Mailer = app.GetBackgroundMailer()
+		}
+		opts = append(opts, ubmanage.WithVerificationOptions(verification))
+
+		if config.EmailLogin {
+			ensure.That(ubmailer.MailerType(config.MailerType) != ubmailer.None, "email login requires a mailer, check MAILER_TYPE configuration")
+			opts = append(opts, ubmanage.WithEmailLoginOptions(ubmanage.EmailLoginOptions{
+				Enabled:         true,
+				MaxAttempts:     config.EmailLoginMaxAttempts,
+				RequestCooldown: time.Duration(config.EmailLoginCooldownSeconds) * time.Second,
+				MagicLink:       config.EmailLoginMagicLink,
+				BaseUrl:         config.BaseUrl,
+				Mailer:          app.GetBackgroundMailer(),
+			}))
+		}
+
+		rateLimits := ubmanage.RateLimitOptions{}
+		if limiter := app.newRateLimiter("login", ubratelimit.SlidingWindow, config.RateLimitLoginAttempts, config.RateLimitLoginWindowSeconds); limiter != nil {
+			rateLimits.Login = limiter
+		}
+		if limiter := app.newRateLimiter("code", ubratelimit.SlidingWindow, config.RateLimitCodeAttempts, config.RateLimitCodeWindowSeconds); limiter != nil {
+			rateLimits.CodeVerification = limiter
+		}
+		opts = append(opts, ubmanage.WithRateLimitOptions(rateLimits))
+		opts = append(opts, ubmanage.WithPermissionCatalog(app.GetPermissionCatalog()))
+		roleTemplates := app.roleTemplates
+		if config.RoleTemplatesFile != "" {
+			fileTemplates, err := ubmanage.LoadRoleTemplates(config.RoleTemplatesFile)
+			if err != nil {
+				panic(err)
+			}
+			roleTemplates = append(slices.Clone(roleTemplates), fileTemplates...)
+			if err := ubmanage.ValidateRoleTemplates(roleTemplates); err != nil {
+				panic(err)
+			}
+		}
+		opts = append(opts, ubmanage.WithRoleTemplates(roleTemplates...))
+		// Access review reports are signed with a key derived from the secret
+		// key, so the key itself is never used for two purposes.
+		opts = append(opts, ubmanage.WithAccessReviewOptions(ubmanage.AccessReviewOptions{
+			SigningKey: ubsecurity.HmacSha256HashGenerator{Pepper: config.SecretKey}.GenerateHashBytes("access-review-reports"),
+		}))
+
+		// Keys issued while API_KEY_HASH was hmac-sha256 keep working after
+		// switching back to argon2id.
+		opts = append(opts, ubmanage.WithApiKeyHmacPepper(config.Pepper))
+		switch config.ApiKeyHash {
+		case "hmac-sha256":
+			ensure.That(len(config.Pepper) > 0, "pepper must be set and greater than zero")
+			opts = append(opts, ubmanage.WithApiKeyHasher(ubsecurity.HmacSha256HashGenerator{Pepper: config.Pepper}))
+		case "argon2id":
+		default:
+			panic(fmt.Sprintf("unsupported api key hash: %s", config.ApiKeyHash))
+		}
+
+		app.managementService = ubmanage.NewManagement(store, dbadapter, hashService, encryptionService, totpService, opts...)
+		app.RegisterService(ubmanage.NewRoleExpiryScheduler(
+			app.managementService,
+			time.Duration(config.RoleExpiryIntervalSeconds)*time.Second,
+		))
 	}
 
 	return app.managementService
 }
 
+// GetRateLimitStore returns the store shared by all rate limiters.
+func (app *UbaseApp) GetRateLimitStore() ubratelimit.Store {
+	if app.rateLimitStore == nil {
+		config := app.GetConfig()
+		switch config.RateLimitStore {
+		case "sql":
+			app.rateLimitStore = ubratelimit.NewSQLStore(app.GetDBAdapter())
+		case "memory", "":
+			app.rateLimitStore = ubratelimit.NewMemoryStore()
+		default:
+			panic(fmt.Sprintf("unsupported rate limit store: %s", config.RateLimitStore))
+		}
+	}
+	return app.rateLimitStore
+}
+
+// newRateLimiter returns nil when the limit is disabled.
+func (app *UbaseApp) newRateLimiter(name string, algorithm ubratelimit.Algorithm, limit int, windowSeconds int) *ubratelimit.Limiter {
+	if limit <= 0 || windowSeconds <= 0 {
+		return nil
+	}
+	return ubratelimit.NewLimiter(app.GetRateLimitStore(), ubratelimit.Policy{
+		Name:      name,
+		Algorithm: algorithm,
+		Limit:     limit,
+		Window:    time.Duration(windowSeconds) * time.Second,
+	})
+}
+
 func (app *UbaseApp) GetHashService() ubsecurity.HashGenerator {
 	if app.hashService == nil {
 		config := app.GetConfig()
@@ -304,13 +479,59 @@ func (app *UbaseApp) GetPrefectService() ubmanage.PrefectService {
 	if app.prefectService == nil {
 		managementService := app.GetManagementService()
 		eventStore := app.GetEventStore()
-		app.prefectService = ubmanage.NewPrefectService(managementService, eventStore, 100, 100)
+		config := app.GetConfig()
+		app.prefectService = ubmanage.NewPrefectService(
+			managementService,
+			eventStore,
+			config.PrefectUserCacheSize,
+			config.PrefectGroupCacheSize,
+			ubmanage.WithPrefectOptions(ubmanage.PrefectOptions{
+				ApiKeyCacheSize:     config.PrefectApiKeyCacheSize,
+				PermissionCacheSize: config.PrefectPermissionCacheSize,
+				RelationCacheSize:   config.PrefectRelationCacheSize,
+				RelationSchema:      app.relationSchema,
+				CacheTTL:            time.Duration(config.PrefectCacheTTLSeconds) * time.Second,
+				RestartBackoff:      time.Duration(config.PrefectRestartBackoffSeconds) * time.Second,
+				MaxRestartBackoff:   time.Duration(config.PrefectMaxRestartBackoffSeconds) * time.Second,
+			}),
+		)
 		app.RegisterService(app.prefectService)
 	}
 
 	return app.prefectService
 }
 
+// WithRelationSchema sets the userset rewrites used by the prefect service's
+// relation checks. It must be called before the prefect service is created.
+func (app *UbaseApp) WithRelationSchema(schema ubmanage.RelationSchema) {
+	ensure.That(app.prefectService == nil, "relation schema must be set before the prefect service is created")
+	app.relationSchema = schema
+}
+
+// GetPermissionCatalog returns the permissions the application declares.
+func (app *UbaseApp) GetPermissionCatalog() *ubmanage.PermissionCatalog {
+	if app.permissionCatalog == nil {
+		app.permissionCatalog = ubmanage.NewPermissionCatalog()
+	}
+	return app.permissionCatalog
+}
+
+// WithPermissions declares permissions the application checks. Once any are
+// declared, roles can only be granted declared permissions.
+func (app *UbaseApp) WithPermissions(definitions ...ubmanage.PermissionDefinition) {
+	app.GetPermissionCatalog().Register(definitions...)
+}
+
+// WithRoleTemplates declares the roles created in new organizations. It must
+// be called before the management service is created.
+func (app *UbaseApp) WithRoleTemplates(templates ...ubmanage.RoleTemplate) {
+	ensure.That(app.managementService == nil, "role templates must be set before the management service is created")
+	app.roleTemplates = append(app.roleTemplates, templates...)
+	if err := ubmanage.ValidateRoleTemplates(app.roleTemplates); err != nil {
+		panic(err)
+	}
+}
+
 func (app *UbaseApp) RegisterService(service BackgroundService) {
 	// Check to see if the service is already registered
 	for _, s := range app.backgroundServices {
@@ -338,8 +559,18 @@ func (app *UbaseApp) GetCookieManager() contracts.AuthTokenCookieManager {
 	if app.cookieManager == nil {
 		config := app.GetConfig()
 		encryptionService := app.GetEncryptionService()
+		prefectService := app.GetPrefectService()
 		secure := config.Environment == "production"
 
+		sessionValidator := contracts.SessionValidatorFunc(func(ctx context.Context, token contracts.AuthToken) bool {
+			valid, err := prefectService.UserSessionValid(ctx, token.SessionUserId(), token.IssuedAt)
+			if err != nil {
+				slog.Error("Error validating session", "error", err)
+				return false
+			}
+			return valid
+		})
+
 		cookieManager := ubwww.NewCookieMonster(
 			encryptionService,
 			"auth_token",
@@ -347,6 +578,7 @@ func (app *UbaseApp) GetCookieManager() contracts.AuthTokenCookieManager {
 			int64(config.TokenMaxSoftExpirySeconds),
 			contracts.CookieContextKey("auth_token"),
 			contracts.IdentityContextKey("user_identity"),
+			ubwww.WithSessionValidator(sessionValidator),
 		)
 		app.cookieManager = cookieManager
 	}
@@ -374,13 +606,25 @@ func (app *UbaseApp) GetAdminRenderer() contracts.AdminRenderer {
 
 }
 
+// WithAdminPanel adds the admin panel routes. The admin panel's permissions
+// are declared, along with any of the given permissions not already declared
+// with WithPermissions.
 func (app *UbaseApp) WithAdminPanel(permissions []string) {
 	if !app.adminPanelInitialized {
+		catalog := app.GetPermissionCatalog()
+		catalog.Register(ubadminpanel.Permissions...)
+		for _, permission := range permissions {
+			if _, found := catalog.Lookup(permission); !found {
+				catalog.Register(ubmanage.PermissionDefinition{Name: permission})
+			}
+		}
+
 		adapter := app.GetDBAdapter()
 		prefectService := app.GetPrefectService()
 		managementService := app.GetManagementService()
 		cookieManager := app.GetCookieManager()
-		primaryOrganization := app.GetConfig().PrimaryOrganization
+		config := app.GetConfig()
+		primaryOrganization := config.PrimaryOrganization
 		adminLinkService := app.GetAdminLinkService()
 
 		ws := app.GetWebService()
@@ -395,15 +639,33 @@ func (app *UbaseApp) WithAdminPanel(permissions []string) {
 		ws.AddRoute(ubadminpanel.OrganizationSettingsRoute(managementService))
 		ws.AddRoute(ubadminpanel.OrganizationSettingsAddRoute(managementService))
 		ws.AddRoute(ubadminpanel.OrganizationSettingsRemoveRoute(managementService))
+		ws.AddRoute(ubadminpanel.PermissionMatrixRoute(managementService, adapter, catalog, adminLinkService))
+		ws.AddRoute(ubadminpanel.PermissionMatrixPostRoute(managementService, adapter, catalog))
+		ws.AddRoute(ubadminpanel.ExclusiveRolesRoute(managementService, adminLinkService))
+		ws.AddRoute(ubadminpanel.ExclusiveRolesSaveRoute(managementService))
+		ws.AddRoute(ubadminpanel.ExclusiveRolesRemoveRoute(managementService))
 
 		ws.AddRoute(ubadminpanel.OrganizationEditRoute(managementService, adminLinkService))
 		ws.AddRoute(ubadminpanel.RoleOverviewRoute(adapter, managementService, permissions, adminLinkService))
 		ws.AddRoute(ubadminpanel.RoleUsersListRoute(adapter))
 		ws.AddRoute(ubadminpanel.RoleUsersAddRoute(adapter, managementService))
 		ws.AddRoute(ubadminpanel.RoleUsersRemoveRoute(adapter, managementService))
-		ws.AddRoute(ubadminpanel.RolePermissionsListRoute(adapter, permissions))
-		ws.AddRoute(ubadminpanel.RolePermissionsAddRoute(adapter, managementService))
-		ws.AddRoute(ubadminpanel.RolePermissionsRemoveRoute(adapter, managementService))
+		ws.AddRoute(ubadminpanel.RolePermissionsListRoute(adapter, catalog))
+		ws.AddRoute(ubadminpanel.RolePermissionsAddRoute(adapter, managementService, catalog))
+		ws.AddRoute(ubadminpanel.RolePermissionsRemoveRoute(adapter, managementService, catalog))
+		ws.AddRoute(ubadminpanel.RolePoliciesListRoute(managementService))
+		ws.AddRoute(ubadminpanel.RolePolicySetRoute(managementService))
+		ws.AddRoute(ubadminpanel.PolicyDryRunRoute(adminLinkService))
+		ws.AddRoute(ubadminpanel.PolicyDryRunPostRoute())
+		ws.AddRoute(ubadminpanel.AccessRequestsRoute(managementService, cookieManager, adminLinkService))
+		ws.AddRoute(ubadminpanel.AccessRequestDecideRoute(managementService, cookieManager))
+		ws.AddRoute(ubadminpanel.AccessRequestFormRoute(managementService, cookieManager, adminLinkService))
+		ws.AddRoute(ubadminpanel.AccessReviewsRoute(managementService, cookieManager, adminLinkService))
+		ws.AddRoute(ubadminpanel.AccessReviewStartRoute(managementService, cookieManager, adminLinkService))
+		ws.AddRoute(ubadminpanel.AccessReviewRoute(managementService, cookieManager, adminLinkService))
+		ws.AddRoute(ubadminpanel.AccessReviewDecideRoute(managementService, cookieManager))
+		ws.AddRoute(ubadminpanel.AccessReviewCloseRoute(managementService, cookieManager))
+		ws.AddRoute(ubadminpanel.AccessReviewExportRoute(managementService, cookieManager))
 		ws.AddRoute(ubadminpanel.RoleCreateRoute(managementService, adminLinkService))
 		ws.AddRoute(ubadminpanel.RoleCreatePostRoute(managementService))
 		ws.AddRoute(ubadminpanel.RoleEditRoute(managementService, adminLinkService))
@@ -412,17 +674,58 @@ func (app *UbaseApp) WithAdminPanel(permissions []string) {
 		ws.AddRoute(ubadminpanel.UsersListRoute(adapter, adminLinkService))
 		ws.AddRoute(ubadminpanel.UserOverviewRoute(managementService, adminLinkService))
 		ws.AddRoute(ubadminpanel.UserRolesListRoute(managementService))
+		ws.AddRoute(ubadminpanel.UserEffectivePermissionsRoute(prefectService, catalog))
 		ws.AddRoute(ubadminpanel.UserRolesAddRoute(managementService))
 		ws.AddRoute(ubadminpanel.UserRolesRemoveRoute(managementService))
 		ws.AddRoute(ubadminpanel.UserCreateRoute(managementService, adminLinkService))
 		ws.AddRoute(ubadminpanel.UserCreatePostRoute(managementService, adminLinkService))
 		ws.AddRoute(ubadminpanel.UserEditRoute(managementService, adminLinkService))
+		ws.AddRoute(ubadminpanel.UserEraseRoute(managementService))
+		ws.AddRoute(ubadminpanel.UserImpersonateRoute(managementService, cookieManager))
+		ws.AddRoute(ubadminpanel.UserResendVerificationRoute(managementService))
+		ws.AddRoute(ubadminpanel.UserLoginsRoute(managementService))
+		ws.AddRoute(ubadminpanel.UserApiKeysRoute(adapter))
+		ws.AddRoute(ubadminpanel.UserApiKeyRotateRoute(adapter, managementService))
+		ws.AddRoute(ubadminpanel.LoginSearchRoute(managementService, adminLinkService))
 		ws.AddRoute(ubadminpanel.UserSettingsRoute(managementService))
 		ws.AddRoute(ubadminpanel.UserSettingsAddRoute(managementService))
 		ws.AddRoute(ubadminpanel.UserSettingsRemoveRoute(managementService))
-		ws.AddRoute(ubadminpanel.LoginRoute(primaryOrganization, managementService, cookieManager, adminLinkService))
-		ws.AddRoute(ubadminpanel.VerifyTwoFactorRoute(managementService, cookieManager, adminLinkService))
+		ws.AddRoute(ubadminpanel.ServiceAccountsRoute(managementService, adminLinkService))
+		ws.AddRoute(ubadminpanel.ServiceAccountOverviewRoute(managementService, adminLinkService))
+		ws.AddRoute(ubadminpanel.ServiceAccountCreateRoute(managementService, adminLinkService))
+		ws.AddRoute(ubadminpanel.ServiceAccountCreatePostRoute(managementService, adminLinkService))
+		var loginOpts []ubadminpanel.LoginRouteOption
+		if config.EmailLogin {
+			loginOpts = append(loginOpts, ubadminpanel.WithEmailLoginLink())
+		}
+		loginRoute := ubadminpanel.LoginRoute(primaryOrganization, managementService, cookieManager, adminLinkService, loginOpts...)
+		verifyTwoFactorRoute := ubadminpanel.VerifyTwoFactorRoute(managementService, cookieManager, adminLinkService)
+		emailLoginRoute := ubadminpanel.EmailLoginRoute(managementService)
+		emailLoginVerifyRoute := ubadminpanel.EmailLoginVerifyRoute(primaryOrganization, managementService, cookieManager, adminLinkService)
+		verifyEmailResendRoute := ubadminpanel.VerifyEmailResendRoute(managementService)
+		if limiter := app.newRateLimiter("ip", ubratelimit.TokenBucket, config.RateLimitIpAttempts, config.RateLimitIpWindowSeconds); limiter != nil {
+			loginRoute = ubwww.NewRateLimitMiddleware(limiter,
+				ubwww.WithRateLimitedHandler(ubadminpanel.RateLimitedLogin)).Route(loginRoute)
+			verifyTwoFactorRoute = ubwww.NewRateLimitMiddleware(limiter,
+				ubwww.WithRateLimitedHandler(ubadminpanel.RateLimitedTwoFactor(adminLinkService))).Route(verifyTwoFactorRoute)
+			emailLimiter := ubwww.NewRateLimitMiddleware(limiter,
+				ubwww.WithRateLimitedHandler(ubadminpanel.RateLimitedEmailLogin))
+			emailLoginRoute = emailLimiter.Route(emailLoginRoute)
+			emailLoginVerifyRoute = emailLimiter.Route(emailLoginVerifyRoute)
+			verifyEmailResendRoute = ubwww.NewRateLimitMiddleware(limiter,
+				ubwww.WithRateLimitedHandler(ubadminpanel.RateLimitedVerifyEmail)).Route(verifyEmailResendRoute)
+		}
+		ws.AddRoute(loginRoute)
+		ws.AddRoute(verifyTwoFactorRoute)
+		if config.EmailLogin {
+			ws.AddRoute(emailLoginRoute)
+			ws.AddRoute(emailLoginVerifyRoute)
+		}
 		ws.AddRoute(ubadminpanel.LogoutRoute(cookieManager))
+		ws.AddRoute(ubadminpanel.StopImpersonationRoute(managementService, cookieManager))
+		ws.AddRoute(ubadminpanel.LoginReportRoute(managementService, cookieManager))
+		ws.AddRoute(ubadminpanel.VerifyEmailRoute(managementService))
+		ws.AddRoute(verifyEmailResendRoute)
 
 		app.adminPanelInitialized = true
 	}
@@ -19,6 +19,28 @@ type ListUserOrganizationRolesRow struct {
 	RoleID                 int64
 	RoleName               string
 	RoleSystemName         string
+	// NotBefore and ExpiresAt bound the membership in unix seconds. Zero
+	// means unbounded.
+	NotBefore int64
+	ExpiresAt int64
+	// AccessRequestID is the access request whose approval granted the
+	// membership, or zero when it was granted directly.
+	AccessRequestID int64
+}
+
+// UserRoleMembership is a user's membership of a role.
+type UserRoleMembership struct {
+	UserID    int64
+	RoleID    int64
+	NotBefore int64
+	ExpiresAt int64
+	// GrantedAt is the unix time in nanoseconds the membership was last
+	// granted, or zero when it was granted before grants were recorded. It
+	// tells grants apart, even in the same second.
+	GrantedAt int64
+	// AccessRequestID is the access request whose approval granted the
+	// membership, or zero when it was granted directly.
+	AccessRequestID int64
 }
 
 type ListRolesWithUserCountsRow struct {
@@ -37,6 +59,13 @@ type DataAdapter interface {
 	GetUserByEmail(ctx context.Context, email string) (User, error)
 	SearchUsers(ctx context.Context, searchTerm string, limit, offset int) ([]User, error)
 	UpdateUser(ctx context.Context, userID int64, firstName, lastName, displayName, email string, verified bool, updatedAt int64) error
+	DeleteUser(ctx context.Context, userID int64) error
+
+	// Service accounts are stored as users owned by an organization. They
+	// are excluded from user counts, searches and recent users.
+	AddServiceAccount(ctx context.Context, userID int64, organizationID int64, name, key string, createdAt int64) error
+	ListServiceAccounts(ctx context.Context, organizationID int64) ([]ServiceAccount, error)
+
 	AddOrganization(ctx context.Context, id int64, name string, systemName string, status string) error
 	GetOrganization(ctx context.Context, organizationID int64) (Organization, error)
 	ListOrganizations(ctx context.Context) ([]Organization, error)
@@ -54,12 +83,22 @@ type DataAdapter interface {
 	GetRolePermissions(ctx context.Context, roleID int64) ([]string, error)
 
 	// User-Role operations
-	AddUserToRole(ctx context.Context, userID int64, roleID int64) error
+	// AddUserToRole adds the membership, or replaces its window when the user
+	// already holds the role. notBefore and expiresAt are unix seconds, zero
+	// for unbounded, grantedAt is the unix time of the grant in nanoseconds and
+	// accessRequestID the approved access request that granted it, or zero.
+	AddUserToRole(ctx context.Context, userID int64, roleID int64, notBefore int64, expiresAt int64, grantedAt int64, accessRequestID int64) error
+	// GetUserRole returns the user's membership of the role, and false when
+	// the user does not hold it.
+	GetUserRole(ctx context.Context, userID int64, roleID int64) (UserRoleMembership, bool, error)
 	RemoveUserFromRole(ctx context.Context, userID int64, roleID int64) error
 	RemoveAllRolesFromUser(ctx context.Context, userID int64) error
 	GetUserOrganizationRoles(ctx context.Context, userID int64, organizationId int64) ([]RoleRow, error)
 	GetAllUserOrganizationRoles(ctx context.Context, userID int64) ([]ListUserOrganizationRolesRow, error)
 	ListUserOrganizationRoles(ctx context.Context, userID int64) ([]ListUserOrganizationRolesRow, error)
+	// ListExpiredUserRoles returns the memberships which expired at or before
+	// now, in unix seconds.
+	ListExpiredUserRoles(ctx context.Context, now int64) ([]UserRoleMembership, error)
 
 	OrganizationsCount(ctx context.Context) (int64, error)
     UsersCount(ctx context.Context) (int64, error)
@@ -70,10 +109,59 @@ type DataAdapter interface {
 	GetUsersInRole(ctx context.Context, roleID int64) ([]User, error)
 	GetRolesForUser(ctx context.Context, userID int64) ([]RoleRow, error)
 
-	UserAddApiKey(ctx context.Context, userID int64, organizationId int64, apiKeyId string, apiKeyHash, name string, createdAt time.Time, expiresAt time.Time) error
+	UserAddApiKey(ctx context.Context, userID int64, organizationId int64, apiKeyId string, apiKeyHash, name string, createdAt time.Time, expiresAt time.Time, scopes []string, allowedCidrs []string) error
 	UserDeleteApiKey(ctx context.Context, userID int64, apiKeyId string) error
+	UserDeleteAllApiKeys(ctx context.Context, userID int64) error
+
+	// Per-user data keys, wrapped by the master encryption key.
+	// UserDataKeyAdd keeps an existing key.
+	GetUserDataKey(ctx context.Context, userID int64) (string, bool, error)
+	UserDataKeyAdd(ctx context.Context, userID int64, wrappedKey string) error
+	UserDataKeyDelete(ctx context.Context, userID int64) error
 	UserListApiKeys(ctx context.Context, userID int64) ([]UserApiKeyNoHash, error)
 	UserGetApiKey(ctx context.Context, apiKeyId string) (UserApiKeyWithHash, error)
+	UserRecordApiKeyUse(ctx context.Context, apiKeyId string, ipAddress string, usedAt time.Time) error
+	UserReplaceApiKey(ctx context.Context, userID int64, apiKeyId string, replacedBy string, expiresAt time.Time) error
+	UserUpdateApiKeyHash(ctx context.Context, userID int64, apiKeyId string, secretHash string) error
+
+	// Login history
+	AddUserLogin(ctx context.Context, login UserLogin) error
+	ListUserLogins(ctx context.Context, userID int64, limit, offset int) ([]UserLogin, error)
+	SearchUserLoginsByIp(ctx context.Context, ipAddress string, limit, offset int) ([]UserLogin, error)
+	DeleteUserLogins(ctx context.Context, userID int64) error
+
+	// Rate limiting. Buckets are updated with optimistic concurrency: an
+	// insert or update reports false when another writer got there first.
+	GetRateLimit(ctx context.Context, key string) (RateLimit, bool, error)
+	InsertRateLimit(ctx context.Context, limit RateLimit) (bool, error)
+	UpdateRateLimit(ctx context.Context, limit RateLimit) (bool, error)
+	DeleteExpiredRateLimits(ctx context.Context, before int64) error
+
+	// Relationship tuples. Adding a tuple that exists and deleting one that
+	// does not are no-ops.
+	AddRelationTuple(ctx context.Context, tuple RelationTuple) error
+	DeleteRelationTuple(ctx context.Context, tuple RelationTuple) error
+	ListRelationTuplesByObject(ctx context.Context, objectType string, objectId string) ([]RelationTuple, error)
+	ListRelationTuplesBySubject(ctx context.Context, subjectType string, subjectId string, subjectRelation string) ([]RelationTuple, error)
+
+	// Access requests. DecideAccessRequest records the status, decider,
+	// decision time, comment and expiry of the request.
+	AddAccessRequest(ctx context.Context, request AccessRequest) error
+	DecideAccessRequest(ctx context.Context, request AccessRequest) error
+	GetAccessRequest(ctx context.Context, id int64) (AccessRequest, bool, error)
+	CountUserRoleAccessRequests(ctx context.Context, userID int64, roleID int64, status string) (int64, error)
+	ListOrganizationAccessRequests(ctx context.Context, organizationID int64, status string) ([]AccessRequest, error)
+	ListUserAccessRequests(ctx context.Context, userID int64) ([]AccessRequest, error)
+	// ListOrganizationUsersWithPermission returns the users, other than
+	// service accounts, holding the permission through a role of the
+	// organization whose membership is valid at now, in unix seconds.
+	ListOrganizationUsersWithPermission(ctx context.Context, organizationID int64, permission string, now int64) ([]UserEmail, error)
+
+	// Access review campaigns. CloseAccessReview records the status, close
+	// time and revocation count of the campaign.
+	AddAccessReview(ctx context.Context, review AccessReview) error
+	CloseAccessReview(ctx context.Context, review AccessReview) error
+	ListOrganizationAccessReviews(ctx context.Context, organizationID int64) ([]AccessReview, error)
 }
 
 // User represents a user in the system
@@ -86,6 +174,15 @@ type User struct {
 	Verified    bool
 }
 
+// ServiceAccount is a non-human principal owned by an organization
+type ServiceAccount struct {
+	UserID         int64
+	Name           string
+	OrganizationID int64
+	Organization   string
+	CreatedAt      time.Time
+}
+
 type UserApiKeyNoHash struct {
 	Id             string
 	Name           string
@@ -93,6 +190,12 @@ type UserApiKeyNoHash struct {
 	OrganizationID int64
 	CreatedAt      time.Time
 	ExpiresAt      time.Time
+	Scopes         []string
+	AllowedCidrs   []string
+	ReplacedBy     string
+	// LastUsedAt is zero when the key has not been used.
+	LastUsedAt time.Time
+	LastUsedIp string
 }
 
 type UserApiKeyWithHash struct {
@@ -103,6 +206,95 @@ type UserApiKeyWithHash struct {
 	OrganizationID int64
 	CreatedAt      time.Time
 	ExpiresAt      time.Time
+	Scopes         []string
+	AllowedCidrs   []string
+	ReplacedBy     string
+}
+
+const (
+	UserLoginOutcomeSucceeded = "succeeded"
+	UserLoginOutcomePartial   = "partial"
+	UserLoginOutcomeFailed    = "failed"
+)
+
+// UserLogin is a single entry in a user's login history
+type UserLogin struct {
+	ID         int64
+	UserID     int64
+	OccurredAt int64
+	Outcome    string
+	Reason     string
+	IpAddress  string
+	UserAgent  string
+	DeviceId   string
+}
+
+// RateLimit is the stored state of a rate limit bucket. Version is the
+// version the state was read at and is checked when updating.
+type RateLimit struct {
+	Key            string
+	Amount         float64
+	PreviousAmount float64
+	UpdatedAt      int64
+	ExpiresAt      int64
+	Version        int64
+}
+
+// RelationTuple grants Relation on an object to a subject. When
+// SubjectRelation is set the subject is everyone holding that relation on
+// the subject object rather than the subject itself.
+type RelationTuple struct {
+	ObjectType      string
+	ObjectId        string
+	Relation        string
+	SubjectType     string
+	SubjectId       string
+	SubjectRelation string
+}
+
+// AccessRequest is a user's request for a role. The names are those of the
+// organization, user, role and decider at the time of reading. Times are unix
+// seconds.
+type AccessRequest struct {
+	ID               int64
+	OrganizationID   int64
+	OrganizationName string
+	UserID           int64
+	UserDisplayName  string
+	UserEmail        string
+	RoleID           int64
+	RoleName         string
+	Justification    string
+	Status           string
+	RequestedAt      int64
+	// DecidedBy, DecidedAt and ExpiresAt are zero while the request is
+	// pending. ExpiresAt is the expiry of the granted membership, zero when
+	// it does not expire.
+	DecidedBy     int64
+	DecidedByName string
+	DecidedAt     int64
+	Comment       string
+	ExpiresAt     int64
+}
+
+// AccessReview is an access review campaign of an organization's role
+// memberships. Times are unix seconds, and ClosedAt is zero while the
+// campaign is open.
+type AccessReview struct {
+	ID              int64
+	OrganizationID  int64
+	Name            string
+	Status          string
+	StartedAt       int64
+	ClosedAt        int64
+	MembershipCount int64
+	RevokedCount    int64
+}
+
+// UserEmail is a user's ID and email address
+type UserEmail struct {
+	UserID int64
+	Email  string
 }
 
 type Organization struct {
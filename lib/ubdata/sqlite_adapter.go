@@ -3,7 +3,9 @@ package ubdata
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/kernelplex/ubase/internal/dbsqlite"
@@ -98,6 +100,14 @@ func (a *SQLiteAdapter) UpdateUser(ctx context.Context, userID int64, firstName,
 	})
 }
 
+func (a *SQLiteAdapter) DeleteUser(ctx context.Context, userID int64) error {
+	err := a.queries.DeleteUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	return nil
+}
+
 func (a *SQLiteAdapter) AddRole(ctx context.Context, roleID int64, organizationID int64, name string, systemName string) error {
 	return a.queries.AddRole(ctx, dbsqlite.AddRoleParams{
 		ID:             roleID,
@@ -206,10 +216,14 @@ func (a *SQLiteAdapter) GetRolePermissions(ctx context.Context, roleID int64) ([
 	return perms, nil
 }
 
-func (a *SQLiteAdapter) AddUserToRole(ctx context.Context, userID int64, roleID int64) error {
+func (a *SQLiteAdapter) AddUserToRole(ctx context.Context, userID int64, roleID int64, notBefore int64, expiresAt int64, grantedAt int64, accessRequestID int64) error {
 	err := a.queries.AddUserToRole(ctx, dbsqlite.AddUserToRoleParams{
-		UserID: userID,
-		RoleID: roleID,
+		UserID:          userID,
+		RoleID:          roleID,
+		NotBefore:       notBefore,
+		ExpiresAt:       expiresAt,
+		GrantedAt:       grantedAt,
+		AccessRequestID: accessRequestID,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to add user to role: %w", err)
@@ -217,6 +231,20 @@ func (a *SQLiteAdapter) AddUserToRole(ctx context.Context, userID int64, roleID
 	return nil
 }
 
+func (a *SQLiteAdapter) GetUserRole(ctx context.Context, userID int64, roleID int64) (UserRoleMembership, bool, error) {
+	membership, err := a.queries.GetUserRole(ctx, dbsqlite.GetUserRoleParams{
+		UserID: userID,
+		RoleID: roleID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserRoleMembership{}, false, nil
+	}
+	if err != nil {
+		return UserRoleMembership{}, false, fmt.Errorf("failed to get user role: %w", err)
+	}
+	return UserRoleMembership(membership), true, nil
+}
+
 func (a *SQLiteAdapter) RemoveUserFromRole(ctx context.Context, userID int64, roleID int64) error {
 	err := a.queries.RemoveUserFromRole(ctx, dbsqlite.RemoveUserFromRoleParams{
 		UserID: userID,
@@ -292,12 +320,27 @@ func (a *SQLiteAdapter) GetAllUserOrganizationRoles(ctx context.Context, userID
 			RoleID:                 r.ID,
 			RoleName:               r.Name,
 			RoleSystemName:         r.SystemName,
+			NotBefore:              r.NotBefore,
+			ExpiresAt:              r.ExpiresAt,
+			AccessRequestID:        r.AccessRequestID,
 		}
 		result[i] = res
 	}
 	return result, nil
 }
 
+func (a *SQLiteAdapter) ListExpiredUserRoles(ctx context.Context, now int64) ([]UserRoleMembership, error) {
+	memberships, err := a.queries.ListExpiredUserRoles(ctx, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired user roles: %w", err)
+	}
+	result := make([]UserRoleMembership, len(memberships))
+	for i, m := range memberships {
+		result[i] = UserRoleMembership(m)
+	}
+	return result, nil
+}
+
 func (a *SQLiteAdapter) OrganizationsCount(ctx context.Context) (int64, error) {
 	count, err := a.queries.OrganizationsCount(ctx)
 	if err != nil {
@@ -306,6 +349,63 @@ func (a *SQLiteAdapter) OrganizationsCount(ctx context.Context) (int64, error) {
 	return count, nil
 }
 
+func (a *SQLiteAdapter) AddServiceAccount(ctx context.Context, userID int64, organizationID int64, name, key string, createdAt int64) error {
+	created := sql.NullTime{
+		Time:  time.Unix(createdAt, 0),
+		Valid: true,
+	}
+	err := a.queries.AddServiceAccount(ctx, dbsqlite.AddServiceAccountParams{
+		ID:                  userID,
+		DisplayName:         name,
+		Email:               key,
+		CreatedAt:           created,
+		UpdatedAt:           created,
+		OwnerOrganizationID: sql.NullInt64{Int64: organizationID, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add service account: %w", err)
+	}
+	return nil
+}
+
+// ListServiceAccounts lists the service accounts owned by an organization,
+// or all service accounts when organizationID is 0.
+func (a *SQLiteAdapter) ListServiceAccounts(ctx context.Context, organizationID int64) ([]ServiceAccount, error) {
+	if organizationID != 0 {
+		rows, err := a.queries.ListOrganizationServiceAccounts(ctx, sql.NullInt64{Int64: organizationID, Valid: true})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list service accounts: %w", err)
+		}
+		result := make([]ServiceAccount, len(rows))
+		for i, row := range rows {
+			result[i] = ServiceAccount{
+				UserID:         row.ID,
+				Name:           row.DisplayName,
+				OrganizationID: row.OwnerOrganizationID.Int64,
+				Organization:   row.OrganizationName,
+				CreatedAt:      row.CreatedAt.Time,
+			}
+		}
+		return result, nil
+	}
+
+	rows, err := a.queries.ListServiceAccounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service accounts: %w", err)
+	}
+	result := make([]ServiceAccount, len(rows))
+	for i, row := range rows {
+		result[i] = ServiceAccount{
+			UserID:         row.ID,
+			Name:           row.DisplayName,
+			OrganizationID: row.OwnerOrganizationID.Int64,
+			Organization:   row.OrganizationName,
+			CreatedAt:      row.CreatedAt.Time,
+		}
+	}
+	return result, nil
+}
+
 func (a *SQLiteAdapter) UsersCount(ctx context.Context) (int64, error) {
     count, err := a.queries.UsersCount(ctx)
     if err != nil {
@@ -422,7 +522,7 @@ func (a *SQLiteAdapter) GetRolesForUser(ctx context.Context, userID int64) ([]Ro
 	return result, nil
 }
 
-func (a *SQLiteAdapter) UserAddApiKey(ctx context.Context, userID int64, organizationId int64, apiKeyId string, secretHash string, name string, createdAt time.Time, expiresAt time.Time) error {
+func (a *SQLiteAdapter) UserAddApiKey(ctx context.Context, userID int64, organizationId int64, apiKeyId string, secretHash string, name string, createdAt time.Time, expiresAt time.Time, scopes []string, allowedCidrs []string) error {
 	err := a.queries.UserAddApiKey(ctx, dbsqlite.UserAddApiKeyParams{
 		ID:             apiKeyId,
 		SecretHash:     secretHash,
@@ -431,6 +531,8 @@ func (a *SQLiteAdapter) UserAddApiKey(ctx context.Context, userID int64, organiz
 		OrganizationID: organizationId,
 		CreatedAt:      createdAt,
 		ExpiresAt:      expiresAt,
+		Scopes:         strings.Join(scopes, " "),
+		AllowedCidrs:   strings.Join(allowedCidrs, " "),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to add API key: %w", err)
@@ -449,6 +551,44 @@ func (a *SQLiteAdapter) UserDeleteApiKey(ctx context.Context, userID int64, apiK
 	return nil
 }
 
+func (a *SQLiteAdapter) UserDeleteAllApiKeys(ctx context.Context, userID int64) error {
+	err := a.queries.UserDeleteAllApiKeys(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete all API keys: %w", err)
+	}
+	return nil
+}
+
+func (a *SQLiteAdapter) GetUserDataKey(ctx context.Context, userID int64) (string, bool, error) {
+	wrappedKey, err := a.queries.UserDataKeyGet(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get user data key: %w", err)
+	}
+	return wrappedKey, true, nil
+}
+
+func (a *SQLiteAdapter) UserDataKeyAdd(ctx context.Context, userID int64, wrappedKey string) error {
+	err := a.queries.UserDataKeyAdd(ctx, dbsqlite.UserDataKeyAddParams{
+		UserID:     userID,
+		WrappedKey: wrappedKey,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add user data key: %w", err)
+	}
+	return nil
+}
+
+func (a *SQLiteAdapter) UserDataKeyDelete(ctx context.Context, userID int64) error {
+	err := a.queries.UserDataKeyDelete(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user data key: %w", err)
+	}
+	return nil
+}
+
 func (a *SQLiteAdapter) UserListApiKeys(ctx context.Context, userID int64) ([]UserApiKeyNoHash, error) {
 	apiKeys, err := a.queries.UserListApiKeys(ctx, userID)
 	if err != nil {
@@ -464,6 +604,13 @@ func (a *SQLiteAdapter) UserListApiKeys(ctx context.Context, userID int64) ([]Us
 			OrganizationID: key.OrganizationID,
 			CreatedAt:      key.CreatedAt,
 			ExpiresAt:      key.ExpiresAt,
+			Scopes:         strings.Fields(key.Scopes),
+			AllowedCidrs:   strings.Fields(key.AllowedCidrs),
+			ReplacedBy:     key.ReplacedBy,
+			LastUsedIp:     key.LastUsedIp,
+		}
+		if key.LastUsedAt.Valid {
+			result[i].LastUsedAt = key.LastUsedAt.Time
 		}
 	}
 	return result, nil
@@ -483,5 +630,391 @@ func (a *SQLiteAdapter) UserGetApiKey(ctx context.Context, apiKeyHash string) (U
 		OrganizationID: apiKey.OrganizationID,
 		CreatedAt:      apiKey.CreatedAt,
 		ExpiresAt:      apiKey.ExpiresAt,
+		Scopes:         strings.Fields(apiKey.Scopes),
+		AllowedCidrs:   strings.Fields(apiKey.AllowedCidrs),
+		ReplacedBy:     apiKey.ReplacedBy,
 	}, nil
 }
+
+func (a *SQLiteAdapter) UserRecordApiKeyUse(ctx context.Context, apiKeyId string, ipAddress string, usedAt time.Time) error {
+	err := a.queries.UserRecordApiKeyUse(ctx, dbsqlite.UserRecordApiKeyUseParams{
+		ID:         apiKeyId,
+		LastUsedAt: sql.NullTime{Time: usedAt, Valid: true},
+		LastUsedIp: ipAddress,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record API key use: %w", err)
+	}
+	return nil
+}
+
+func (a *SQLiteAdapter) UserReplaceApiKey(ctx context.Context, userID int64, apiKeyId string, replacedBy string, expiresAt time.Time) error {
+	err := a.queries.UserReplaceApiKey(ctx, dbsqlite.UserReplaceApiKeyParams{
+		ID:         apiKeyId,
+		UserID:     userID,
+		ReplacedBy: replacedBy,
+		ExpiresAt:  expiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to replace API key: %w", err)
+	}
+	return nil
+}
+
+func (a *SQLiteAdapter) UserUpdateApiKeyHash(ctx context.Context, userID int64, apiKeyId string, secretHash string) error {
+	err := a.queries.UserUpdateApiKeyHash(ctx, dbsqlite.UserUpdateApiKeyHashParams{
+		ID:         apiKeyId,
+		UserID:     userID,
+		SecretHash: secretHash,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update API key hash: %w", err)
+	}
+	return nil
+}
+
+func (a *SQLiteAdapter) AddUserLogin(ctx context.Context, login UserLogin) error {
+	err := a.queries.AddUserLogin(ctx, dbsqlite.AddUserLoginParams{
+		UserID:     login.UserID,
+		OccurredAt: login.OccurredAt,
+		Outcome:    login.Outcome,
+		Reason:     login.Reason,
+		IpAddress:  login.IpAddress,
+		UserAgent:  login.UserAgent,
+		DeviceID:   login.DeviceId,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add user login: %w", err)
+	}
+	return nil
+}
+
+func (a *SQLiteAdapter) ListUserLogins(ctx context.Context, userID int64, limit, offset int) ([]UserLogin, error) {
+	logins, err := a.queries.ListUserLogins(ctx, dbsqlite.ListUserLoginsParams{
+		UserID: userID,
+		Count:  int64(limit),
+		Start:  int64(offset),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user logins: %w", err)
+	}
+	return sqliteUserLogins(logins), nil
+}
+
+func (a *SQLiteAdapter) SearchUserLoginsByIp(ctx context.Context, ipAddress string, limit, offset int) ([]UserLogin, error) {
+	logins, err := a.queries.SearchUserLoginsByIp(ctx, dbsqlite.SearchUserLoginsByIpParams{
+		Query: sqlEscapeLike(ipAddress) + "%",
+		Count: int64(limit),
+		Start: int64(offset),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search user logins: %w", err)
+	}
+	return sqliteUserLogins(logins), nil
+}
+
+func (a *SQLiteAdapter) DeleteUserLogins(ctx context.Context, userID int64) error {
+	err := a.queries.DeleteUserLogins(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user logins: %w", err)
+	}
+	return nil
+}
+
+func sqliteUserLogins(logins []dbsqlite.UserLogin) []UserLogin {
+	result := make([]UserLogin, len(logins))
+	for i, l := range logins {
+		result[i] = UserLogin{
+			ID:         l.ID,
+			UserID:     l.UserID,
+			OccurredAt: l.OccurredAt,
+			Outcome:    l.Outcome,
+			Reason:     l.Reason,
+			IpAddress:  l.IpAddress,
+			UserAgent:  l.UserAgent,
+			DeviceId:   l.DeviceID,
+		}
+	}
+	return result
+}
+
+func (a *SQLiteAdapter) GetRateLimit(ctx context.Context, key string) (RateLimit, bool, error) {
+	limit, err := a.queries.GetRateLimit(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RateLimit{}, false, nil
+	}
+	if err != nil {
+		return RateLimit{}, false, fmt.Errorf("failed to get rate limit: %w", err)
+	}
+	return RateLimit{
+		Key:            limit.BucketKey,
+		Amount:         limit.Amount,
+		PreviousAmount: limit.PreviousAmount,
+		UpdatedAt:      limit.UpdatedAt,
+		ExpiresAt:      limit.ExpiresAt,
+		Version:        limit.Version,
+	}, true, nil
+}
+
+func (a *SQLiteAdapter) InsertRateLimit(ctx context.Context, limit RateLimit) (bool, error) {
+	rows, err := a.queries.InsertRateLimit(ctx, dbsqlite.InsertRateLimitParams{
+		BucketKey:      limit.Key,
+		Amount:         limit.Amount,
+		PreviousAmount: limit.PreviousAmount,
+		UpdatedAt:      limit.UpdatedAt,
+		ExpiresAt:      limit.ExpiresAt,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to insert rate limit: %w", err)
+	}
+	return rows > 0, nil
+}
+
+func (a *SQLiteAdapter) UpdateRateLimit(ctx context.Context, limit RateLimit) (bool, error) {
+	rows, err := a.queries.UpdateRateLimit(ctx, dbsqlite.UpdateRateLimitParams{
+		Amount:         limit.Amount,
+		PreviousAmount: limit.PreviousAmount,
+		UpdatedAt:      limit.UpdatedAt,
+		ExpiresAt:      limit.ExpiresAt,
+		BucketKey:      limit.Key,
+		Version:        limit.Version,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to update rate limit: %w", err)
+	}
+	return rows > 0, nil
+}
+
+func (a *SQLiteAdapter) DeleteExpiredRateLimits(ctx context.Context, before int64) error {
+	err := a.queries.DeleteExpiredRateLimits(ctx, before)
+	if err != nil {
+		return fmt.Errorf("failed to delete expired rate limits: %w", err)
+	}
+	return nil
+}
+
+func (a *SQLiteAdapter) AddRelationTuple(ctx context.Context, tuple RelationTuple) error {
+	err := a.queries.AddRelationTuple(ctx, dbsqlite.AddRelationTupleParams{
+		ObjectType:      tuple.ObjectType,
+		ObjectID:        tuple.ObjectId,
+		Relation:        tuple.Relation,
+		SubjectType:     tuple.SubjectType,
+		SubjectID:       tuple.SubjectId,
+		SubjectRelation: tuple.SubjectRelation,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add relation tuple: %w", err)
+	}
+	return nil
+}
+
+func (a *SQLiteAdapter) DeleteRelationTuple(ctx context.Context, tuple RelationTuple) error {
+	err := a.queries.DeleteRelationTuple(ctx, dbsqlite.DeleteRelationTupleParams{
+		ObjectType:      tuple.ObjectType,
+		ObjectID:        tuple.ObjectId,
+		Relation:        tuple.Relation,
+		SubjectType:     tuple.SubjectType,
+		SubjectID:       tuple.SubjectId,
+		SubjectRelation: tuple.SubjectRelation,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete relation tuple: %w", err)
+	}
+	return nil
+}
+
+func (a *SQLiteAdapter) ListRelationTuplesByObject(ctx context.Context, objectType string, objectId string) ([]RelationTuple, error) {
+	tuples, err := a.queries.ListRelationTuplesByObject(ctx, dbsqlite.ListRelationTuplesByObjectParams{
+		ObjectType: objectType,
+		ObjectID:   objectId,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list relation tuples by object: %w", err)
+	}
+	return sqliteRelationTuples(tuples), nil
+}
+
+func (a *SQLiteAdapter) ListRelationTuplesBySubject(ctx context.Context, subjectType string, subjectId string, subjectRelation string) ([]RelationTuple, error) {
+	tuples, err := a.queries.ListRelationTuplesBySubject(ctx, dbsqlite.ListRelationTuplesBySubjectParams{
+		SubjectType:     subjectType,
+		SubjectID:       subjectId,
+		SubjectRelation: subjectRelation,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list relation tuples by subject: %w", err)
+	}
+	return sqliteRelationTuples(tuples), nil
+}
+
+func sqliteRelationTuples(tuples []dbsqlite.RelationTuple) []RelationTuple {
+	result := make([]RelationTuple, len(tuples))
+	for i, t := range tuples {
+		result[i] = RelationTuple{
+			ObjectType:      t.ObjectType,
+			ObjectId:        t.ObjectID,
+			Relation:        t.Relation,
+			SubjectType:     t.SubjectType,
+			SubjectId:       t.SubjectID,
+			SubjectRelation: t.SubjectRelation,
+		}
+	}
+	return result
+}
+
+func (a *SQLiteAdapter) AddAccessRequest(ctx context.Context, request AccessRequest) error {
+	err := a.queries.AddAccessRequest(ctx, dbsqlite.AddAccessRequestParams{
+		ID:             request.ID,
+		OrganizationID: request.OrganizationID,
+		UserID:         request.UserID,
+		RoleID:         request.RoleID,
+		Justification:  request.Justification,
+		Status:         request.Status,
+		RequestedAt:    request.RequestedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add access request: %w", err)
+	}
+	return nil
+}
+
+func (a *SQLiteAdapter) DecideAccessRequest(ctx context.Context, request AccessRequest) error {
+	err := a.queries.DecideAccessRequest(ctx, dbsqlite.DecideAccessRequestParams{
+		ID:        request.ID,
+		Status:    request.Status,
+		DecidedBy: request.DecidedBy,
+		DecidedAt: request.DecidedAt,
+		Comment:   request.Comment,
+		ExpiresAt: request.ExpiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to decide access request: %w", err)
+	}
+	return nil
+}
+
+func (a *SQLiteAdapter) GetAccessRequest(ctx context.Context, id int64) (AccessRequest, bool, error) {
+	row, err := a.queries.GetAccessRequest(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AccessRequest{}, false, nil
+	}
+	if err != nil {
+		return AccessRequest{}, false, fmt.Errorf("failed to get access request: %w", err)
+	}
+	return sqliteAccessRequest(row), true, nil
+}
+
+func (a *SQLiteAdapter) CountUserRoleAccessRequests(ctx context.Context, userID int64, roleID int64, status string) (int64, error) {
+	count, err := a.queries.CountUserRoleAccessRequests(ctx, dbsqlite.CountUserRoleAccessRequestsParams{
+		UserID: userID,
+		RoleID: roleID,
+		Status: status,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count access requests: %w", err)
+	}
+	return count, nil
+}
+
+func (a *SQLiteAdapter) ListOrganizationAccessRequests(ctx context.Context, organizationID int64, status string) ([]AccessRequest, error) {
+	rows, err := a.queries.ListOrganizationAccessRequests(ctx, dbsqlite.ListOrganizationAccessRequestsParams{
+		OrganizationID: organizationID,
+		Status:         status,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization access requests: %w", err)
+	}
+	result := make([]AccessRequest, len(rows))
+	for i, row := range rows {
+		result[i] = sqliteAccessRequest(dbsqlite.GetAccessRequestRow(row))
+	}
+	return result, nil
+}
+
+func (a *SQLiteAdapter) ListUserAccessRequests(ctx context.Context, userID int64) ([]AccessRequest, error) {
+	rows, err := a.queries.ListUserAccessRequests(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user access requests: %w", err)
+	}
+	result := make([]AccessRequest, len(rows))
+	for i, row := range rows {
+		result[i] = sqliteAccessRequest(dbsqlite.GetAccessRequestRow(row))
+	}
+	return result, nil
+}
+
+func sqliteAccessRequest(row dbsqlite.GetAccessRequestRow) AccessRequest {
+	return AccessRequest{
+		ID:               row.ID,
+		OrganizationID:   row.OrganizationID,
+		OrganizationName: row.OrganizationName,
+		UserID:           row.UserID,
+		UserDisplayName:  row.UserDisplayName,
+		UserEmail:        row.UserEmail,
+		RoleID:           row.RoleID,
+		RoleName:         row.RoleName,
+		Justification:    row.Justification,
+		Status:           row.Status,
+		RequestedAt:      row.RequestedAt,
+		DecidedBy:        row.DecidedBy,
+		DecidedByName:    row.DecidedByName.String,
+		DecidedAt:        row.DecidedAt,
+		Comment:          row.Comment,
+		ExpiresAt:        row.ExpiresAt,
+	}
+}
+
+func (a *SQLiteAdapter) ListOrganizationUsersWithPermission(ctx context.Context, organizationID int64, permission string, now int64) ([]UserEmail, error) {
+	rows, err := a.queries.ListOrganizationUsersWithPermission(ctx, dbsqlite.ListOrganizationUsersWithPermissionParams{
+		OrganizationID: organizationID,
+		Permission:     permission,
+		Now:            now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization users with permission: %w", err)
+	}
+	result := make([]UserEmail, len(rows))
+	for i, row := range rows {
+		result[i] = UserEmail{UserID: row.ID, Email: row.Email}
+	}
+	return result, nil
+}
+
+func (a *SQLiteAdapter) AddAccessReview(ctx context.Context, review AccessReview) error {
+	err := a.queries.AddAccessReview(ctx, dbsqlite.AddAccessReviewParams{
+		ID:              review.ID,
+		OrganizationID:  review.OrganizationID,
+		Name:            review.Name,
+		Status:          review.Status,
+		StartedAt:       review.StartedAt,
+		MembershipCount: review.MembershipCount,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add access review: %w", err)
+	}
+	return nil
+}
+
+func (a *SQLiteAdapter) CloseAccessReview(ctx context.Context, review AccessReview) error {
+	err := a.queries.CloseAccessReview(ctx, dbsqlite.CloseAccessReviewParams{
+		ID:           review.ID,
+		Status:       review.Status,
+		ClosedAt:     review.ClosedAt,
+		RevokedCount: review.RevokedCount,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to close access review: %w", err)
+	}
+	return nil
+}
+
+func (a *SQLiteAdapter) ListOrganizationAccessReviews(ctx context.Context, organizationID int64) ([]AccessReview, error) {
+	rows, err := a.queries.ListOrganizationAccessReviews(ctx, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization access reviews: %w", err)
+	}
+	result := make([]AccessReview, len(rows))
+	for i, row := range rows {
+		result[i] = AccessReview(row)
+	}
+	return result, nil
+}
@@ -0,0 +1,190 @@
+package ubmanage
+
+import (
+	"strings"
+	"time"
+
+	evercore "github.com/kernelplex/evercore/base"
+	events "github.com/kernelplex/ubase/internal/evercoregen/events"
+	"github.com/kernelplex/ubase/lib/ubvalidation"
+)
+
+// Access requests let users ask for a role rather than an administrator
+// having to know what to grant. Users holding PermApproveAccessRequests in
+// the role's organization approve or deny them, and approving a request adds
+// the user to the role, optionally until an expiry.
+
+const (
+	AccessRequestPending  = "pending"
+	AccessRequestApproved = "approved"
+	AccessRequestDenied   = "denied"
+
+	// PermApproveAccessRequests allows deciding the access requests for the
+	// roles of an organization.
+	PermApproveAccessRequests = "approve_access_requests"
+
+	maxAccessRequestTextLength = 1000
+)
+
+type AccessRequestState struct {
+	OrganizationId int64  `json:"organizationId"`
+	UserId         int64  `json:"userId"`
+	RoleId         int64  `json:"roleId"`
+	Justification  string `json:"justification"`
+	Status         string `json:"status"`
+	RequestedAt    int64  `json:"requestedAt"`
+	// DecidedBy is the ID of the approver who decided the request.
+	DecidedBy int64  `json:"decidedBy,omitempty"`
+	DecidedAt int64  `json:"decidedAt,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+	// ExpiresAt is when the granted membership expires, in unix seconds,
+	// or zero when it does not.
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+}
+
+// AccessRequestAggregate is a user's request for a role.
+//
+// evercore:aggregate
+type AccessRequestAggregate struct {
+	evercore.StateAggregate[AccessRequestState]
+}
+
+func (t *AccessRequestAggregate) ApplyEventState(eventState evercore.EventState, eventTime time.Time, reference string) error {
+	switch ev := eventState.(type) {
+	case AccessRequestedEvent:
+		t.State.OrganizationId = ev.OrganizationId
+		t.State.UserId = ev.UserId
+		t.State.RoleId = ev.RoleId
+		t.State.Justification = ev.Justification
+		t.State.Status = AccessRequestPending
+		t.State.RequestedAt = eventTime.Unix()
+		return nil
+	case AccessRequestApprovedEvent:
+		t.State.Status = AccessRequestApproved
+		t.State.DecidedBy = ev.ApproverId
+		t.State.DecidedAt = eventTime.Unix()
+		t.State.Comment = ev.Comment
+		t.State.ExpiresAt = ev.ExpiresAt
+		return nil
+	case AccessRequestDeniedEvent:
+		t.State.Status = AccessRequestDenied
+		t.State.DecidedBy = ev.ApproverId
+		t.State.DecidedAt = eventTime.Unix()
+		t.State.Comment = ev.Comment
+		return nil
+	}
+
+	return t.StateAggregate.ApplyEventState(eventState, eventTime, reference)
+}
+
+// ============================================================================
+// Commands
+// ============================================================================
+
+// AccessRequestCreateCommand requests a role for a user.
+type AccessRequestCreateCommand struct {
+	UserId        int64  `json:"userId"`
+	RoleId        int64  `json:"roleId"`
+	Justification string `json:"justification"`
+}
+
+func (c AccessRequestCreateCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	validationTracker := ubvalidation.NewValidationTracker()
+
+	validationTracker.ValidateIntMinValue("userId", c.UserId, 1)
+	validationTracker.ValidateIntMinValue("roleId", c.RoleId, 1)
+	validationTracker.ValidateField("justification", strings.TrimSpace(c.Justification), true, 0)
+	validationTracker.ValidateMaxLength("justification", c.Justification, maxAccessRequestTextLength)
+
+	return validationTracker.Valid()
+}
+
+// AccessRequestApproveCommand approves a pending request and adds the user
+// to the role.
+type AccessRequestApproveCommand struct {
+	Id         int64 `json:"id"`
+	ApproverId int64 `json:"approverId"`
+	// ExpiresAt optionally bounds the granted membership.
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	Comment   string    `json:"comment"`
+}
+
+func (c AccessRequestApproveCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	validationTracker := ubvalidation.NewValidationTracker()
+
+	validationTracker.ValidateIntMinValue("id", c.Id, 1)
+	validationTracker.ValidateIntMinValue("approverId", c.ApproverId, 1)
+	if !c.ExpiresAt.IsZero() {
+		validationTracker.ValidateTimeInFuture("expiresAt", c.ExpiresAt)
+	}
+	validationTracker.ValidateMaxLength("comment", c.Comment, maxAccessRequestTextLength)
+
+	return validationTracker.Valid()
+}
+
+// AccessRequestDenyCommand denies a pending request.
+type AccessRequestDenyCommand struct {
+	Id         int64  `json:"id"`
+	ApproverId int64  `json:"approverId"`
+	Comment    string `json:"comment"`
+}
+
+func (c AccessRequestDenyCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	validationTracker := ubvalidation.NewValidationTracker()
+
+	validationTracker.ValidateIntMinValue("id", c.Id, 1)
+	validationTracker.ValidateIntMinValue("approverId", c.ApproverId, 1)
+	validationTracker.ValidateMaxLength("comment", c.Comment, maxAccessRequestTextLength)
+
+	return validationTracker.Valid()
+}
+
+// ============================================================================
+// Events
+// ============================================================================
+
+// evercore:event
+type AccessRequestedEvent struct {
+	OrganizationId int64  `json:"organizationId"`
+	UserId         int64  `json:"userId"`
+	RoleId         int64  `json:"roleId"`
+	Justification  string `json:"justification"`
+}
+
+func (a AccessRequestedEvent) GetEventType() string {
+	return events.AccessRequestedEventType
+}
+
+func (a AccessRequestedEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
+
+// evercore:event
+type AccessRequestApprovedEvent struct {
+	ApproverId int64  `json:"approverId"`
+	Comment    string `json:"comment,omitempty"`
+	// ExpiresAt is unix seconds, zero when the membership does not expire.
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+}
+
+func (a AccessRequestApprovedEvent) GetEventType() string {
+	return events.AccessRequestApprovedEventType
+}
+
+func (a AccessRequestApprovedEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
+
+// evercore:event
+type AccessRequestDeniedEvent struct {
+	ApproverId int64  `json:"approverId"`
+	Comment    string `json:"comment,omitempty"`
+}
+
+func (a AccessRequestDeniedEvent) GetEventType() string {
+	return events.AccessRequestDeniedEventType
+}
+
+func (a AccessRequestDeniedEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
@@ -0,0 +1,58 @@
+package ubmanage
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessRequestAggregateDecisions(t *testing.T) {
+	requestedAt := time.Unix(1_000_000, 0)
+	aggregate := &AccessRequestAggregate{}
+	if err := aggregate.ApplyEventState(AccessRequestedEvent{OrganizationId: 1, UserId: 2, RoleId: 3, Justification: "Reports"}, requestedAt, "test"); err != nil {
+		t.Fatalf("ApplyEventState failed: %v", err)
+	}
+	if aggregate.State.Status != AccessRequestPending || aggregate.State.RequestedAt != requestedAt.Unix() {
+		t.Fatalf("unexpected requested state %+v", aggregate.State)
+	}
+
+	decidedAt := requestedAt.Add(time.Hour)
+	if err := aggregate.ApplyEventState(AccessRequestApprovedEvent{ApproverId: 4, Comment: "Ok", ExpiresAt: 2_000_000}, decidedAt, "test"); err != nil {
+		t.Fatalf("ApplyEventState failed: %v", err)
+	}
+	state := aggregate.State
+	if state.Status != AccessRequestApproved || state.DecidedBy != 4 || state.DecidedAt != decidedAt.Unix() || state.ExpiresAt != 2_000_000 || state.Comment != "Ok" {
+		t.Fatalf("unexpected approved state %+v", state)
+	}
+
+	denied := &AccessRequestAggregate{}
+	_ = denied.ApplyEventState(AccessRequestedEvent{UserId: 2, RoleId: 3}, requestedAt, "test")
+	_ = denied.ApplyEventState(AccessRequestDeniedEvent{ApproverId: 4, Comment: "No"}, decidedAt, "test")
+	if denied.State.Status != AccessRequestDenied || denied.State.ExpiresAt != 0 || denied.State.Comment != "No" {
+		t.Fatalf("unexpected denied state %+v", denied.State)
+	}
+}
+
+func TestAccessRequestCommandValidation(t *testing.T) {
+	if ok, _ := (AccessRequestCreateCommand{UserId: 1, RoleId: 2, Justification: "  "}).Validate(); ok {
+		t.Fatal("expected a blank justification to be invalid")
+	}
+	if ok, _ := (AccessRequestCreateCommand{UserId: 1, RoleId: 2, Justification: strings.Repeat("a", maxAccessRequestTextLength+1)}).Validate(); ok {
+		t.Fatal("expected an overlong justification to be invalid")
+	}
+	if ok, issues := (AccessRequestCreateCommand{UserId: 1, RoleId: 2, Justification: "Reports"}).Validate(); !ok {
+		t.Fatalf("expected a valid request, got %v", issues)
+	}
+
+	approve := AccessRequestApproveCommand{Id: 1, ApproverId: 2, ExpiresAt: time.Now().Add(time.Hour)}
+	if ok, issues := approve.Validate(); !ok {
+		t.Fatalf("expected a valid approval, got %v", issues)
+	}
+	approve.ExpiresAt = time.Now().Add(-time.Minute)
+	if ok, _ := approve.Validate(); ok {
+		t.Fatal("expected an expiry in the past to be invalid")
+	}
+	if ok, _ := (AccessRequestDenyCommand{Id: 1}).Validate(); ok {
+		t.Fatal("expected a denial without an approver to be invalid")
+	}
+}
@@ -0,0 +1,227 @@
+package ubmanage
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	evercore "github.com/kernelplex/evercore/base"
+	events "github.com/kernelplex/ubase/internal/evercoregen/events"
+	"github.com/kernelplex/ubase/lib/ubvalidation"
+)
+
+// Access reviews are campaigns in which reviewers certify that each role
+// membership of an organization is still needed. The memberships are captured
+// when the campaign starts, users holding PermReviewAccess mark each one to
+// keep or revoke, and closing the campaign removes the revoked memberships.
+// Undecided memberships are kept.
+
+const (
+	AccessReviewOpen   = "open"
+	AccessReviewClosed = "closed"
+
+	AccessReviewKeep   = "keep"
+	AccessReviewRevoke = "revoke"
+
+	// PermReviewAccess allows deciding the memberships in the access reviews
+	// of an organization.
+	PermReviewAccess = "review_access"
+	// PermManageAccessReviews allows starting, closing and exporting the
+	// access reviews of an organization.
+	PermManageAccessReviews = "manage_access_reviews"
+
+	maxAccessReviewNameLength = 255
+)
+
+type AccessReviewState struct {
+	OrganizationId int64                    `json:"organizationId"`
+	Name           string                   `json:"name"`
+	Status         string                   `json:"status"`
+	StartedAt      int64                    `json:"startedAt"`
+	ClosedAt       int64                    `json:"closedAt,omitempty"`
+	Memberships    []AccessReviewMembership `json:"memberships"`
+	// Revoked is the number of memberships removed when the campaign closed.
+	Revoked int `json:"revoked,omitempty"`
+}
+
+// AccessReviewMembership is a membership under review and the decision on
+// it. Users and roles are recorded by id only: the event store is never
+// rewritten, so names and email addresses kept here would outlive UserErase.
+// AccessReviewMemberships resolves them from the read model.
+type AccessReviewMembership struct {
+	UserId int64 `json:"userId"`
+	RoleId int64 `json:"roleId"`
+	// Decision is empty until a reviewer decides the membership.
+	Decision   string `json:"decision,omitempty"`
+	ReviewerId int64  `json:"reviewerId,omitempty"`
+	DecidedAt  int64  `json:"decidedAt,omitempty"`
+	Comment    string `json:"comment,omitempty"`
+	// GrantedAt identifies the grant the reviewer decided on, or is zero when
+	// the user did not hold the role at the time.
+	GrantedAt int64 `json:"grantedAt,omitempty"`
+}
+
+// Membership returns the index of the user's membership of the role, or -1
+// when it is not under review.
+func (s AccessReviewState) Membership(userId int64, roleId int64) int {
+	return slices.IndexFunc(s.Memberships, func(membership AccessReviewMembership) bool {
+		return membership.UserId == userId && membership.RoleId == roleId
+	})
+}
+
+// Decided returns how many memberships have been decided.
+func (s AccessReviewState) Decided() int {
+	decided := 0
+	for _, membership := range s.Memberships {
+		if membership.Decision != "" {
+			decided++
+		}
+	}
+	return decided
+}
+
+// AccessReviewAggregate is an access review campaign.
+//
+// evercore:aggregate
+type AccessReviewAggregate struct {
+	evercore.StateAggregate[AccessReviewState]
+}
+
+func (t *AccessReviewAggregate) ApplyEventState(eventState evercore.EventState, eventTime time.Time, reference string) error {
+	switch ev := eventState.(type) {
+	case AccessReviewStartedEvent:
+		t.State.OrganizationId = ev.OrganizationId
+		t.State.Name = ev.Name
+		t.State.Status = AccessReviewOpen
+		t.State.StartedAt = eventTime.Unix()
+		t.State.Memberships = slices.Clone(ev.Memberships)
+		return nil
+	case AccessReviewDecidedEvent:
+		if i := t.State.Membership(ev.UserId, ev.RoleId); i >= 0 {
+			membership := &t.State.Memberships[i]
+			membership.Decision = ev.Decision
+			membership.ReviewerId = ev.ReviewerId
+			membership.DecidedAt = eventTime.Unix()
+			membership.Comment = ev.Comment
+			membership.GrantedAt = ev.GrantedAt
+		}
+		return nil
+	case AccessReviewClosedEvent:
+		t.State.Status = AccessReviewClosed
+		t.State.ClosedAt = eventTime.Unix()
+		t.State.Revoked = ev.Revoked
+		return nil
+	}
+
+	return t.StateAggregate.ApplyEventState(eventState, eventTime, reference)
+}
+
+// ============================================================================
+// Commands
+// ============================================================================
+
+// AccessReviewStartCommand starts a campaign reviewing the current role
+// memberships of an organization.
+type AccessReviewStartCommand struct {
+	OrganizationId int64  `json:"organizationId"`
+	Name           string `json:"name"`
+}
+
+func (c AccessReviewStartCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	validationTracker := ubvalidation.NewValidationTracker()
+
+	validationTracker.ValidateIntMinValue("organizationId", c.OrganizationId, 1)
+	validationTracker.ValidateField("name", strings.TrimSpace(c.Name), true, 0)
+	validationTracker.ValidateMaxLength("name", c.Name, maxAccessReviewNameLength)
+
+	return validationTracker.Valid()
+}
+
+// AccessReviewDecideCommand records a reviewer's decision on a membership.
+type AccessReviewDecideCommand struct {
+	Id         int64  `json:"id"`
+	UserId     int64  `json:"userId"`
+	RoleId     int64  `json:"roleId"`
+	Decision   string `json:"decision"`
+	ReviewerId int64  `json:"reviewerId"`
+	Comment    string `json:"comment"`
+}
+
+func (c AccessReviewDecideCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	validationTracker := ubvalidation.NewValidationTracker()
+
+	validationTracker.ValidateIntMinValue("id", c.Id, 1)
+	validationTracker.ValidateIntMinValue("userId", c.UserId, 1)
+	validationTracker.ValidateIntMinValue("roleId", c.RoleId, 1)
+	validationTracker.ValidateIntMinValue("reviewerId", c.ReviewerId, 1)
+	validationTracker.ValidateOneOf("decision", c.Decision, []string{AccessReviewKeep, AccessReviewRevoke})
+	validationTracker.ValidateMaxLength("comment", c.Comment, maxAccessRequestTextLength)
+
+	return validationTracker.Valid()
+}
+
+// AccessReviewCloseCommand closes a campaign and removes the revoked
+// memberships.
+type AccessReviewCloseCommand struct {
+	Id int64 `json:"id"`
+}
+
+func (c AccessReviewCloseCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	validationTracker := ubvalidation.NewValidationTracker()
+
+	validationTracker.ValidateIntMinValue("id", c.Id, 1)
+
+	return validationTracker.Valid()
+}
+
+// ============================================================================
+// Events
+// ============================================================================
+
+// evercore:event
+type AccessReviewStartedEvent struct {
+	OrganizationId int64                    `json:"organizationId"`
+	Name           string                   `json:"name"`
+	Memberships    []AccessReviewMembership `json:"memberships"`
+}
+
+func (a AccessReviewStartedEvent) GetEventType() string {
+	return events.AccessReviewStartedEventType
+}
+
+func (a AccessReviewStartedEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
+
+// evercore:event
+type AccessReviewDecidedEvent struct {
+	UserId     int64  `json:"userId"`
+	RoleId     int64  `json:"roleId"`
+	Decision   string `json:"decision"`
+	ReviewerId int64  `json:"reviewerId"`
+	Comment    string `json:"comment,omitempty"`
+	// GrantedAt is the grant time of the membership decided on, in unix
+	// nanoseconds, or zero when the user did not hold the role.
+	GrantedAt int64 `json:"grantedAt,omitempty"`
+}
+
+func (a AccessReviewDecidedEvent) GetEventType() string {
+	return events.AccessReviewDecidedEventType
+}
+
+func (a AccessReviewDecidedEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
+
+// evercore:event
+type AccessReviewClosedEvent struct {
+	Revoked int `json:"revoked"`
+}
+
+func (a AccessReviewClosedEvent) GetEventType() string {
+	return events.AccessReviewClosedEventType
+}
+
+func (a AccessReviewClosedEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
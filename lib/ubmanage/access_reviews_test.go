@@ -0,0 +1,110 @@
+package ubmanage
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessReviewAggregateDecisions(t *testing.T) {
+	startedAt := time.Unix(1_000_000, 0)
+	aggregate := &AccessReviewAggregate{}
+	memberships := []AccessReviewMembership{
+		{UserId: 2, RoleId: 3},
+		{UserId: 4, RoleId: 3},
+	}
+	if err := aggregate.ApplyEventState(AccessReviewStartedEvent{OrganizationId: 1, Name: "Q3", Memberships: memberships}, startedAt, "test"); err != nil {
+		t.Fatalf("ApplyEventState failed: %v", err)
+	}
+	if aggregate.State.Status != AccessReviewOpen || aggregate.State.StartedAt != startedAt.Unix() || len(aggregate.State.Memberships) != 2 {
+		t.Fatalf("unexpected started state %+v", aggregate.State)
+	}
+	if aggregate.State.Membership(4, 3) != 1 || aggregate.State.Membership(4, 9) != -1 {
+		t.Fatal("unexpected membership lookup")
+	}
+
+	decidedAt := startedAt.Add(time.Hour)
+	event := AccessReviewDecidedEvent{UserId: 4, RoleId: 3, Decision: AccessReviewRevoke, ReviewerId: 5, Comment: "Left"}
+	if err := aggregate.ApplyEventState(event, decidedAt, "test"); err != nil {
+		t.Fatalf("ApplyEventState failed: %v", err)
+	}
+	decided := aggregate.State.Memberships[1]
+	if decided.Decision != AccessReviewRevoke || decided.ReviewerId != 5 || decided.DecidedAt != decidedAt.Unix() || decided.Comment != "Left" {
+		t.Fatalf("unexpected decided membership %+v", decided)
+	}
+	if aggregate.State.Decided() != 1 || memberships[1].Decision != "" {
+		t.Fatal("expected the decision to apply to the review's own copy of the memberships")
+	}
+
+	_ = aggregate.ApplyEventState(AccessReviewClosedEvent{Revoked: 1}, decidedAt, "test")
+	if aggregate.State.Status != AccessReviewClosed || aggregate.State.ClosedAt != decidedAt.Unix() || aggregate.State.Revoked != 1 {
+		t.Fatalf("unexpected closed state %+v", aggregate.State)
+	}
+}
+
+func TestAccessReviewCommandValidation(t *testing.T) {
+	if ok, _ := (AccessReviewStartCommand{OrganizationId: 1, Name: "  "}).Validate(); ok {
+		t.Fatal("expected a blank name to be invalid")
+	}
+	if ok, issues := (AccessReviewStartCommand{OrganizationId: 1, Name: "Q3"}).Validate(); !ok {
+		t.Fatalf("expected a valid start, got %v", issues)
+	}
+
+	decide := AccessReviewDecideCommand{Id: 1, UserId: 2, RoleId: 3, Decision: AccessReviewKeep, ReviewerId: 4}
+	if ok, issues := decide.Validate(); !ok {
+		t.Fatalf("expected a valid decision, got %v", issues)
+	}
+	decide.Decision = "maybe"
+	if ok, _ := decide.Validate(); ok {
+		t.Fatal("expected an unknown decision to be invalid")
+	}
+}
+
+func TestAccessReviewReportSignatures(t *testing.T) {
+	m := &ManagementImpl{accessReviewOptions: AccessReviewOptions{SigningKey: []byte("key")}}
+	report := AccessReviewReport{
+		ReviewId:         7,
+		OrganizationId:   1,
+		OrganizationName: "Acme, Inc",
+		Name:             "Q3",
+		Status:           AccessReviewClosed,
+		StartedAt:        1_000_000,
+		ClosedAt:         1_000_100,
+		Memberships: []AccessReviewMembershipDetails{{
+			AccessReviewMembership: AccessReviewMembership{UserId: 2, RoleId: 3, Decision: AccessReviewKeep, ReviewerId: 5, DecidedAt: 1_000_050, Comment: "Still \"needed\""},
+			UserEmail:              "a@example.com",
+			RoleName:               "Admins",
+			ReviewerEmail:          "r@example.com",
+		}},
+	}
+
+	for _, format := range []string{AccessReviewFormatCsv, AccessReviewFormatJson} {
+		export, err := m.signAccessReviewReport(report, format)
+		if err != nil {
+			t.Fatalf("%s: sign failed: %v", format, err)
+		}
+		if !bytes.Contains(export.Data, []byte("r@example.com")) {
+			t.Fatalf("%s: expected the reviewer in the report, got %s", format, export.Data)
+		}
+		if resp, _ := m.AccessReviewVerifyExport(context.Background(), export.Data); !resp.Data {
+			t.Fatalf("%s: expected the signature to verify", format)
+		}
+
+		tampered := bytes.Replace(export.Data, []byte(AccessReviewKeep), []byte(AccessReviewRevoke), 1)
+		if resp, _ := m.AccessReviewVerifyExport(context.Background(), tampered); resp.Data {
+			t.Fatalf("%s: expected a tampered report to fail verification", format)
+		}
+		other := &ManagementImpl{accessReviewOptions: AccessReviewOptions{SigningKey: []byte("other")}}
+		if resp, _ := other.AccessReviewVerifyExport(context.Background(), export.Data); resp.Data {
+			t.Fatalf("%s: expected a report signed with another key to fail verification", format)
+		}
+	}
+
+	export, _ := m.signAccessReviewReport(report, AccessReviewFormatCsv)
+	lines := strings.Split(strings.TrimSuffix(string(export.Data), "\n"), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[2], accessReviewSignaturePrefix) {
+		t.Fatalf("expected a header, a membership and a signature line, got %q", lines)
+	}
+}
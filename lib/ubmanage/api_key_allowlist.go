@@ -0,0 +1,85 @@
+package ubmanage
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/kernelplex/ubase/lib/ubvalidation"
+)
+
+// An API key may be limited to the addresses it is used from. The allowlist
+// holds CIDR ranges; single addresses are stored as a /32 or /128 range.
+// Keys without an allowlist may be used from anywhere.
+
+const maxApiKeyAllowedCidrs = 50
+
+// parseAllowedCidr parses a CIDR range or a single address.
+func parseAllowedCidr(value string) (netip.Prefix, bool) {
+	value = strings.TrimSpace(value)
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		return prefix.Masked(), true
+	}
+	if addr, err := netip.ParseAddr(value); err == nil {
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), true
+	}
+	return netip.Prefix{}, false
+}
+
+// normalizeAllowedCidrs returns the canonical, deduped and sorted form of the
+// allowlist. Entries that do not parse are dropped, so validate first.
+func normalizeAllowedCidrs(cidrs []string) []string {
+	if len(cidrs) == 0 {
+		return nil
+	}
+	result := make([]string, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if prefix, ok := parseAllowedCidr(cidr); ok {
+			result = append(result, prefix.String())
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	slices.Sort(result)
+	return slices.Compact(result)
+}
+
+func validateAllowedCidrs(validationTracker *ubvalidation.ValidationTracker, fieldName string, cidrs []string) {
+	if len(cidrs) > maxApiKeyAllowedCidrs {
+		validationTracker.AddIssue(fieldName, "Too many allowed addresses")
+		return
+	}
+	for _, cidr := range cidrs {
+		if _, ok := parseAllowedCidr(cidr); !ok {
+			validationTracker.AddIssue(fieldName, "Allowed address "+strings.TrimSpace(cidr)+" is not a valid IP address or CIDR range")
+			return
+		}
+	}
+}
+
+// allowlistPermits reports whether a key with the allowlist may be used from
+// ipAddress. The address may include a port. An empty allowlist permits any
+// address; otherwise an address that cannot be parsed is refused.
+func allowlistPermits(cidrs []string, ipAddress string) bool {
+	if len(cidrs) == 0 {
+		return true
+	}
+	ipAddress = strings.TrimSpace(ipAddress)
+	if host, _, err := net.SplitHostPort(ipAddress); err == nil {
+		ipAddress = host
+	}
+	addr, err := netip.ParseAddr(ipAddress)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, cidr := range cidrs {
+		if prefix, ok := parseAllowedCidr(cidr); ok && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
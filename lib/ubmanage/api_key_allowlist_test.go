@@ -0,0 +1,89 @@
+package ubmanage
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNormalizeAllowedCidrs(t *testing.T) {
+	got := normalizeAllowedCidrs([]string{" 10.1.2.3/8", "203.0.113.7", "2001:db8::1", "10.0.0.0/8"})
+	want := []string{"10.0.0.0/8", "2001:db8::1/128", "203.0.113.7/32"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestAllowlistPermits(t *testing.T) {
+	cidrs := []string{"10.0.0.0/8", "2001:db8::/32"}
+	cases := []struct {
+		cidrs []string
+		ip    string
+		want  bool
+	}{
+		{nil, "", true},
+		{nil, "198.51.100.1", true},
+		{cidrs, "10.20.30.40", true},
+		{cidrs, "10.20.30.40:5678", true},
+		{cidrs, "[2001:db8::5]:443", true},
+		{cidrs, "::ffff:10.0.0.1", true},
+		{cidrs, "192.168.0.1", false},
+		{cidrs, "", false},
+		{cidrs, "not-an-ip", false},
+	}
+	for _, c := range cases {
+		if got := allowlistPermits(c.cidrs, c.ip); got != c.want {
+			t.Errorf("allowlistPermits(%v, %q) = %v, want %v", c.cidrs, c.ip, got, c.want)
+		}
+	}
+}
+
+func TestUserGenerateApiKeyCommandValidateAllowedCidrs(t *testing.T) {
+	command := UserGenerateApiKeyCommand{
+		UserId:         1,
+		Name:           "Deploy",
+		OrganizationId: 1,
+		ExpiresAt:      time.Now().Add(time.Hour),
+		AllowedCidrs:   []string{"10.0.0.0/8", "203.0.113.7"},
+	}
+	if ok, issues := command.Validate(); !ok {
+		t.Fatalf("expected allowlist to be valid, got %+v", issues)
+	}
+	command.AllowedCidrs = []string{"10.0.0.0/33"}
+	if ok, _ := command.Validate(); ok {
+		t.Fatalf("expected invalid CIDR range to be rejected")
+	}
+}
+
+func TestUserRotateApiKeyCommandValidate(t *testing.T) {
+	command := UserRotateApiKeyCommand{UserId: 1, ApiKeyId: "abcdefghij", GracePeriod: time.Hour}
+	if ok, issues := command.Validate(); !ok {
+		t.Fatalf("expected command to be valid, got %+v", issues)
+	}
+	for _, invalid := range []UserRotateApiKeyCommand{
+		{UserId: 1, ApiKeyId: "short", GracePeriod: time.Hour},
+		{UserId: 1, ApiKeyId: "abcdefghij", GracePeriod: -time.Hour},
+		{UserId: 1, ApiKeyId: "abcdefghij", GracePeriod: MaxApiKeyRotationGracePeriod + time.Hour},
+	} {
+		if ok, _ := invalid.Validate(); ok {
+			t.Errorf("expected %+v to be rejected", invalid)
+		}
+	}
+}
+
+func TestUserApiKeyRotatedEvent(t *testing.T) {
+	now := time.Now()
+	agg := &UserAggregate{}
+	added := UserApiKeyAddedEvent{Id: "old0000000", OrganizationId: 1, Name: "n", ExpiresAt: now.Add(24 * time.Hour).Unix(), AllowedCidrs: []string{"10.0.0.0/8"}}
+	if err := agg.ApplyEventState(added, now, "tester"); err != nil {
+		t.Fatalf("apply api key added: %v", err)
+	}
+	rotated := UserApiKeyRotatedEvent{Id: "old0000000", ReplacedBy: "new0000000", ExpiresAt: now.Add(time.Hour).Unix()}
+	if err := agg.ApplyEventState(rotated, now, "tester"); err != nil {
+		t.Fatalf("apply api key rotated: %v", err)
+	}
+	key := agg.State.ApiKeys[0]
+	if key.ReplacedBy != "new0000000" || key.ExpiresAt != rotated.ExpiresAt || !slices.Equal(key.AllowedCidrs, []string{"10.0.0.0/8"}) {
+		t.Fatalf("unexpected rotated key %+v", key)
+	}
+}
@@ -0,0 +1,78 @@
+package ubmanage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubsecurity"
+)
+
+func TestVerifyApiKeySecret(t *testing.T) {
+	legacyHasher := ubsecurity.DefaultArgon2Id
+	legacyHasher.Iterations = 1
+	legacyHasher.Memory = 1024
+	hmacHasher := ubsecurity.HmacSha256HashGenerator{Pepper: []byte("pepper")}
+	secret := ubsecurity.GenerateSecureRandomString(ApiKeyLength - ApiKeyIdLength)
+	legacyHash, _ := legacyHasher.GenerateHashBase64(secret)
+	hmacHash, _ := hmacHasher.GenerateHashBase64(secret)
+
+	withoutHasher := &ManagementImpl{hashingService: legacyHasher}
+	withHasher := &ManagementImpl{hashingService: legacyHasher}
+	WithApiKeyHasher(hmacHasher)(withHasher)
+	// Keys issued with the HMAC hasher keep working after switching back.
+	switchedBack := &ManagementImpl{hashingService: legacyHasher}
+	WithApiKeyHmacPepper(hmacHasher.Pepper)(switchedBack)
+
+	cases := []struct {
+		name       string
+		m          *ManagementImpl
+		secret     string
+		hash       string
+		wantMatch  bool
+		wantRehash bool
+	}{
+		{"legacy hash without api key hasher", withoutHasher, secret, legacyHash, true, false},
+		{"legacy hash with api key hasher", withHasher, secret, legacyHash, true, true},
+		{"legacy hash wrong secret", withHasher, secret + "x", legacyHash, false, false},
+		{"hmac hash", withHasher, secret, hmacHash, true, false},
+		{"hmac hash wrong secret", withHasher, secret + "x", hmacHash, false, false},
+		{"hmac hash without api key hasher", switchedBack, secret, hmacHash, true, false},
+		{"hmac hash without api key hasher wrong secret", switchedBack, secret + "x", hmacHash, false, false},
+	}
+	for _, c := range cases {
+		match, rehash, err := c.m.verifyApiKeySecret(c.secret, c.hash)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+		if match != c.wantMatch || rehash != c.wantRehash {
+			t.Fatalf("%s: expected match=%v rehash=%v, got %v %v", c.name, c.wantMatch, c.wantRehash, match, rehash)
+		}
+	}
+
+	if _, _, err := withoutHasher.verifyApiKeySecret(secret, hmacHash); err == nil {
+		t.Fatal("expected an hmac hash to be refused without a pepper")
+	}
+
+	if hash, _ := withHasher.apiKeyHashingService().GenerateHashBase64(secret); !ubsecurity.IsHmacSha256Hash(hash) {
+		t.Fatalf("expected new keys to use the api key hasher, got %q", hash)
+	}
+	if hash, _ := withoutHasher.apiKeyHashingService().GenerateHashBase64(secret); ubsecurity.IsHmacSha256Hash(hash) {
+		t.Fatalf("expected new keys to use the hashing service, got %q", hash)
+	}
+}
+
+func TestUserApiKeyRehashedEvent(t *testing.T) {
+	now := time.Now()
+	agg := &UserAggregate{}
+	added := UserApiKeyAddedEvent{Id: "key0000000", OrganizationId: 1, SecretHash: "legacy", Name: "n", ExpiresAt: now.Add(time.Hour).Unix()}
+	if err := agg.ApplyEventState(added, now, "tester"); err != nil {
+		t.Fatalf("apply api key added: %v", err)
+	}
+	rehashed := UserApiKeyRehashedEvent{Id: "key0000000", SecretHash: "hmac-sha256$abc"}
+	if err := agg.ApplyEventState(rehashed, now, "tester"); err != nil {
+		t.Fatalf("apply api key rehashed: %v", err)
+	}
+	if key := agg.State.ApiKeys[0]; key.SecretHash != rehashed.SecretHash || key.Name != "n" {
+		t.Fatalf("unexpected rehashed key %+v", key)
+	}
+}
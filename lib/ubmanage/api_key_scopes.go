@@ -0,0 +1,135 @@
+package ubmanage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/kernelplex/ubase/lib/ubvalidation"
+)
+
+// API key scopes narrow the permissions an API key carries. A scope is either
+// a permission name or a prefix ending in "*" that matches every permission
+// starting with it, so "reports:*" covers "reports:read" and "reports:export"
+// and "*" covers everything. A key without scopes carries all of its owner's
+// permissions in its organization. Scopes never grant anything on their own:
+// the owner must still hold a permission for the key to use it.
+
+const (
+	apiKeyScopeWildcard  = "*"
+	maxApiKeyScopes      = 100
+	maxApiKeyScopeLength = 200
+)
+
+// normalizeScopes trims, dedupes and sorts scopes. Empty entries are dropped.
+func normalizeScopes(scopes []string) []string {
+	if len(scopes) == 0 {
+		return nil
+	}
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if scope != "" {
+			result = append(result, scope)
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	slices.Sort(result)
+	return slices.Compact(result)
+}
+
+func validateScopes(validationTracker *ubvalidation.ValidationTracker, fieldName string, scopes []string) {
+	if len(scopes) > maxApiKeyScopes {
+		validationTracker.AddIssue(fieldName, "Too many scopes")
+		return
+	}
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		switch {
+		case scope == "":
+			validationTracker.AddIssue(fieldName, "Scopes cannot be empty")
+			return
+		case len(scope) > maxApiKeyScopeLength:
+			validationTracker.AddIssue(fieldName, "Scope "+scope[:20]+"... is too long")
+			return
+		case strings.IndexFunc(scope, unicode.IsSpace) >= 0:
+			validationTracker.AddIssue(fieldName, "Scope "+scope+" cannot contain whitespace")
+			return
+		case strings.Contains(strings.TrimSuffix(scope, apiKeyScopeWildcard), apiKeyScopeWildcard):
+			validationTracker.AddIssue(fieldName, "Scope "+scope+" can only use * at the end")
+			return
+		}
+	}
+}
+
+// scopeMatches reports whether a single scope covers the permission.
+func scopeMatches(scope string, permission string) bool {
+	if prefix, ok := strings.CutSuffix(scope, apiKeyScopeWildcard); ok {
+		return strings.HasPrefix(permission, prefix)
+	}
+	return scope == permission
+}
+
+// scopeAllows reports whether a key with the given scopes may use the
+// permission. Keys without scopes are not restricted.
+func scopeAllows(scopes []string, permission string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, scope := range scopes {
+		if scopeMatches(scope, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// effectiveScopes returns the sorted permissions a key with the given scopes
+// carries when its owner holds the given permissions.
+func effectiveScopes(scopes []string, permissions []string) []string {
+	result := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		if scopeAllows(scopes, permission) {
+			result = append(result, permission)
+		}
+	}
+	slices.Sort(result)
+	return slices.Compact(result)
+}
+
+// scopesNotHeld returns the scopes that are not a subset of the owner's
+// permissions: permissions the owner does not hold, and wildcards that match
+// none of them.
+func scopesNotHeld(scopes []string, permissions []string) []string {
+	var missing []string
+	for _, scope := range scopes {
+		if !slices.ContainsFunc(permissions, func(permission string) bool {
+			return scopeMatches(scope, permission)
+		}) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// userOrganizationPermissions returns the permissions the user holds through
+// their roles in the organization.
+func (m *ManagementImpl) userOrganizationPermissions(ctx context.Context, userId int64, organizationId int64) ([]string, error) {
+	roles, err := m.dbadapter.GetUserOrganizationRoles(ctx, userId, organizationId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user organization roles: %w", err)
+	}
+	var permissions []string
+	for _, role := range roles {
+		rolePermissions, err := m.dbadapter.GetRolePermissions(ctx, role.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get role permissions: %w", err)
+		}
+		permissions = append(permissions, rolePermissions...)
+	}
+	return permissions, nil
+}
@@ -0,0 +1,76 @@
+package ubmanage
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	got := normalizeScopes([]string{" reports:read", "", "admin:*", "reports:read"})
+	want := []string{"admin:*", "reports:read"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if normalizeScopes([]string{" ", ""}) != nil {
+		t.Fatalf("expected blank scopes to normalize to nil")
+	}
+}
+
+func TestScopeAllows(t *testing.T) {
+	cases := []struct {
+		scopes     []string
+		permission string
+		want       bool
+	}{
+		{nil, "reports:read", true},
+		{[]string{"*"}, "reports:read", true},
+		{[]string{"reports:read"}, "reports:read", true},
+		{[]string{"reports:read"}, "reports:export", false},
+		{[]string{"reports:*"}, "reports:export", true},
+		{[]string{"reports:*"}, "users:read", false},
+		{[]string{"users:read", "reports:*"}, "users:read", true},
+	}
+	for _, c := range cases {
+		if got := scopeAllows(c.scopes, c.permission); got != c.want {
+			t.Errorf("scopeAllows(%v, %q) = %v, want %v", c.scopes, c.permission, got, c.want)
+		}
+	}
+}
+
+func TestEffectiveScopesAndScopesNotHeld(t *testing.T) {
+	held := []string{"users:read", "reports:read", "reports:export", "reports:read"}
+
+	got := effectiveScopes([]string{"reports:*"}, held)
+	if !slices.Equal(got, []string{"reports:export", "reports:read"}) {
+		t.Fatalf("unexpected effective scopes %v", got)
+	}
+	if got := effectiveScopes(nil, held); len(got) != 3 {
+		t.Fatalf("expected unscoped key to carry all permissions, got %v", got)
+	}
+
+	missing := scopesNotHeld([]string{"reports:*", "users:write", "billing:*"}, held)
+	if !slices.Equal(missing, []string{"users:write", "billing:*"}) {
+		t.Fatalf("unexpected scopes not held %v", missing)
+	}
+}
+
+func TestUserGenerateApiKeyCommandValidateScopes(t *testing.T) {
+	command := UserGenerateApiKeyCommand{
+		UserId:         1,
+		Name:           "Reports",
+		OrganizationId: 1,
+		ExpiresAt:      time.Now().Add(time.Hour),
+		Scopes:         []string{"reports:*", "users:read"},
+	}
+	if ok, issues := command.Validate(); !ok {
+		t.Fatalf("expected scopes to be valid, got %+v", issues)
+	}
+
+	for _, scope := range []string{"", "reports:*:read", "*reports", "reports read"} {
+		command.Scopes = []string{scope}
+		if ok, _ := command.Validate(); ok {
+			t.Errorf("expected scope %q to be rejected", scope)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package ubmanage
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestOrganizationExclusiveRoleSets(t *testing.T) {
+	aggregate := &OrganizationAggregate{}
+	now := time.Now()
+	_ = aggregate.ApplyEventState(OrganizationExclusiveRoleSetSavedEvent{Name: "payments", RoleIds: []int64{1, 2}}, now, "test")
+	_ = aggregate.ApplyEventState(OrganizationExclusiveRoleSetSavedEvent{Name: "audit", RoleIds: []int64{3, 4}}, now, "test")
+	if len(aggregate.State.ExclusiveRoleSets) != 2 {
+		t.Fatalf("expected two sets, got %+v", aggregate.State.ExclusiveRoleSets)
+	}
+
+	// Saving an existing set replaces its roles in place.
+	_ = aggregate.ApplyEventState(OrganizationExclusiveRoleSetSavedEvent{Name: "payments", RoleIds: []int64{1, 2, 5}}, now, "test")
+	i := aggregate.State.ExclusiveRoleSet("payments")
+	if i != 0 || !slices.Equal(aggregate.State.ExclusiveRoleSets[i].RoleIds, []int64{1, 2, 5}) {
+		t.Fatalf("expected the payments set to be replaced, got %+v", aggregate.State.ExclusiveRoleSets)
+	}
+
+	_ = aggregate.ApplyEventState(OrganizationExclusiveRoleSetRemovedEvent{Name: "payments"}, now, "test")
+	if aggregate.State.ExclusiveRoleSet("payments") != -1 || aggregate.State.ExclusiveRoleSet("audit") != 0 {
+		t.Fatalf("expected only the audit set to remain, got %+v", aggregate.State.ExclusiveRoleSets)
+	}
+}
+
+func TestExclusiveRoleConflict(t *testing.T) {
+	state := OrganizationState{ExclusiveRoleSets: []ExclusiveRoleSet{
+		{Name: "payments", RoleIds: []int64{1, 2}},
+		{Name: "audit", RoleIds: []int64{2, 3}},
+	}}
+
+	tests := []struct {
+		name    string
+		roleId  int64
+		held    []int64
+		set     string
+		heldId  int64
+		blocked bool
+	}{
+		{name: "no roles held", roleId: 1},
+		{name: "role outside any set", roleId: 9, held: []int64{1, 2}},
+		{name: "same role held again", roleId: 1, held: []int64{1}},
+		{name: "other set's role", roleId: 1, held: []int64{3}},
+		{name: "conflict", roleId: 1, held: []int64{7, 2}, set: "payments", heldId: 2, blocked: true},
+		{name: "conflict in second set", roleId: 3, held: []int64{2}, set: "audit", heldId: 2, blocked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, heldId, blocked := state.exclusiveRoleConflict(tt.roleId, tt.held)
+			if blocked != tt.blocked || set.Name != tt.set || heldId != tt.heldId {
+				t.Fatalf("got %q %d %v, want %q %d %v", set.Name, heldId, blocked, tt.set, tt.heldId, tt.blocked)
+			}
+		})
+	}
+}
+
+func TestExclusiveRoleSetSaveValidation(t *testing.T) {
+	if ok, _ := (OrganizationExclusiveRoleSetSaveCommand{OrganizationId: 1, Name: "payments", RoleIds: []int64{1, 1}}).Validate(); ok {
+		t.Fatal("expected a set with one distinct role to be invalid")
+	}
+	if ok, _ := (OrganizationExclusiveRoleSetSaveCommand{OrganizationId: 1, Name: " ", RoleIds: []int64{1, 2}}).Validate(); ok {
+		t.Fatal("expected a blank name to be invalid")
+	}
+	if ok, issues := (OrganizationExclusiveRoleSetSaveCommand{OrganizationId: 1, Name: "payments", RoleIds: []int64{1, 2}}).Validate(); !ok {
+		t.Fatalf("expected a valid set, got %v", issues)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/kernelplex/ubase/lib/ensure"
 	"github.com/kernelplex/ubase/lib/ub2fa"
 	"github.com/kernelplex/ubase/lib/ubdata"
+	"github.com/kernelplex/ubase/lib/ubmailer"
 	r "github.com/kernelplex/ubase/lib/ubresponse"
 	"github.com/kernelplex/ubase/lib/ubsecurity"
 )
@@ -58,6 +59,35 @@ type ManagementService interface {
 		command OrganizationSettingsRemoveCommand,
 		agent string) (r.Response[any], error)
 
+	// Exclusive role set operations
+
+	// OrganizationExclusiveRoleSetSave creates or replaces a set of roles no
+	// user may hold more than one of
+	OrganizationExclusiveRoleSetSave(ctx context.Context,
+		command OrganizationExclusiveRoleSetSaveCommand,
+		agent string) (r.Response[any], error)
+
+	// OrganizationExclusiveRoleSetRemove removes an exclusive role set
+	OrganizationExclusiveRoleSetRemove(ctx context.Context,
+		command OrganizationExclusiveRoleSetRemoveCommand,
+		agent string) (r.Response[any], error)
+
+	// OrganizationExclusiveRoleViolations lists users holding more than one
+	// role of an exclusive role set
+	OrganizationExclusiveRoleViolations(ctx context.Context, organizationId int64) (r.Response[[]ExclusiveRoleViolation], error)
+
+	// Role template operations
+
+	// RoleTemplates returns the roles created in new organizations
+	RoleTemplates() []RoleTemplate
+
+	// RoleTemplatesSync brings the roles of existing organizations in line
+	// with the role templates, returning the changes made or, for a dry run,
+	// the changes it would make
+	RoleTemplatesSync(ctx context.Context,
+		command RoleTemplatesSyncCommand,
+		agent string) (r.Response[[]RoleTemplateChange], error)
+
 	// Role operations
 
 	// RoleAdd creates a new role with the given details
@@ -109,6 +139,25 @@ type ManagementService interface {
 		command RolePermissionRemoveCommand,
 		agent string) (r.Response[any], error)
 
+	// RolePermissionPolicySet makes a permission granted by a role
+	// conditional on a policy, or unconditional again with an empty policy
+	// Returns a validation error if the role does not grant the permission
+	RolePermissionPolicySet(ctx context.Context,
+		command RolePermissionPolicySetCommand,
+		agent string) (r.Response[any], error)
+
+	// RolePermissionsApply grants and revokes permissions of several roles
+	// of an organization in a single operation
+	// Returns a validation error if a role belongs to another organization
+	RolePermissionsApply(ctx context.Context,
+		command RolePermissionsApplyCommand,
+		agent string) (r.Response[any], error)
+
+	// PermissionReport compares the permissions held by roles with the
+	// permission catalog
+	// Returns a validation error if no permissions are declared
+	PermissionReport(ctx context.Context) (r.Response[PermissionReport], error)
+
 	// User operations
 
 	// UserAdd creates a new user with the given details
@@ -149,6 +198,13 @@ type ManagementService interface {
 		command UserVerifyEmailLoginCodeCommand,
 		agent string) (r.Response[*UserAuthenticationResponse], error)
 
+	// UserVerifyEmailLoginLink validates a magic link issued with an email
+	// login code and authenticates the user. The link is consumed along with
+	// the code.
+	UserVerifyEmailLoginLink(ctx context.Context,
+		command UserVerifyEmailLoginLinkCommand,
+		agent string) (r.Response[*UserAuthenticationResponse], error)
+
 	// UserVerifyTwoFactorCode verifies a 2FA code for an authenticated user
 	// Returns success/failure status or an error
 	UserVerifyTwoFactorCode(ctx context.Context,
@@ -167,6 +223,18 @@ type ManagementService interface {
 		command UserVerifyCommand,
 		agent string) (r.Response[any], error)
 
+	// UserVerifyLink verifies a user's account from an emailed verification
+	// link. Expired and replaced links are rejected with NotAuthorized.
+	UserVerifyLink(ctx context.Context,
+		command UserVerifyLinkCommand,
+		agent string) (r.Response[any], error)
+
+	// UserResendVerification replaces an unverified user's token and emails
+	// a new link, at most once per resend cooldown.
+	UserResendVerification(ctx context.Context,
+		command UserResendVerificationCommand,
+		agent string) (r.Response[UserResendVerificationResponse], error)
+
 	// UserGenerateTwoFactorSharedSecret generates a new 2FA shared secret for the user
 	// Returns the secret and setup details or an error
 	GenerateTwoFactorSharedSecret(
@@ -188,6 +256,43 @@ type ManagementService interface {
 		command UserEnableCommand,
 		agent string) (r.Response[any], error)
 
+	// UserErase permanently removes a user's personal data by destroying their
+	// data key, tombstoning the aggregate and removing read model rows and
+	// role memberships.
+	// Returns success/failure status or an error
+	UserErase(ctx context.Context,
+		command UserEraseCommand,
+		agent string) (r.Response[any], error)
+
+	// UserStartImpersonation records the start of an impersonation session on
+	// both the impersonator and the target and returns the identities and
+	// organization needed to issue the session token. Targets granted
+	// contracts.PermSystemAdmin can only be impersonated by users holding it
+	// too. Callers are responsible for checking that the impersonator holds
+	// the impersonation permission.
+	UserStartImpersonation(ctx context.Context,
+		command UserStartImpersonationCommand,
+		agent string) (r.Response[UserImpersonationResponse], error)
+
+	// UserStopImpersonation records the end of an impersonation session on
+	// both the impersonator and the target.
+	UserStopImpersonation(ctx context.Context,
+		command UserStopImpersonationCommand,
+		agent string) (r.Response[any], error)
+
+	// UserLoginHistory lists a user's login attempts, most recent first.
+	UserLoginHistory(ctx context.Context, userId int64, limit, offset int) (r.Response[[]ubdata.UserLogin], error)
+
+	// UserLoginsByIp lists login attempts across all users from IP addresses
+	// starting with the given value, most recent first.
+	UserLoginsByIp(ctx context.Context, ipAddress string, limit, offset int) (r.Response[[]ubdata.UserLogin], error)
+
+	// UserReportUnrecognizedLogin handles the "this wasn't me" link from a
+	// login alert email by disabling the user and revoking their sessions.
+	UserReportUnrecognizedLogin(ctx context.Context,
+		command UserReportUnrecognizedLoginCommand,
+		agent string) (r.Response[any], error)
+
 	// User settings operations
 	UserSettingsAdd(ctx context.Context,
 		command UserSettingsAddCommand,
@@ -215,9 +320,108 @@ type ManagementService interface {
 		command UserRemoveFromRoleCommand,
 		agent string) (r.Response[any], error)
 
-	// UsersCount returns the total number of users in the system
+	// UserRolesExpire removes role memberships which expired at or before
+	// now, recording a UserRemovedFromRoleEvent for each. Memberships renewed
+	// or removed since they were listed are left alone, so instances running
+	// it at the same time remove each membership once.
+	// Returns the number of memberships removed
+	UserRolesExpire(ctx context.Context, now time.Time, agent string) (r.Response[int], error)
+
+	// Access request operations
+
+	// AccessRequestCreate requests a role for a user and emails the
+	// organization's approvers
+	// Returns the ID of the request, or AlreadyExists if one is pending
+	AccessRequestCreate(ctx context.Context,
+		command AccessRequestCreateCommand,
+		agent string) (r.Response[IdValue], error)
+
+	// AccessRequestApprove approves a pending request and adds the user to
+	// the role, recorded with the given agent, then emails the requester
+	// Returns NotAuthorized unless the approver holds
+	// PermApproveAccessRequests in the role's organization
+	AccessRequestApprove(ctx context.Context,
+		command AccessRequestApproveCommand,
+		agent string) (r.Response[any], error)
+
+	// AccessRequestDeny denies a pending request and emails the requester
+	// Returns NotAuthorized unless the approver holds
+	// PermApproveAccessRequests in the role's organization
+	AccessRequestDeny(ctx context.Context,
+		command AccessRequestDenyCommand,
+		agent string) (r.Response[any], error)
+
+	// AccessRequestGet retrieves an access request by its ID
+	AccessRequestGet(ctx context.Context, id int64) (r.Response[ubdata.AccessRequest], error)
+
+	// AccessRequestListByOrganization lists an organization's requests with
+	// the given status, most recent first
+	AccessRequestListByOrganization(ctx context.Context, organizationId int64, status string) (r.Response[[]ubdata.AccessRequest], error)
+
+	// AccessRequestListByUser lists a user's requests, most recent first
+	AccessRequestListByUser(ctx context.Context, userId int64) (r.Response[[]ubdata.AccessRequest], error)
+
+	// Access review operations
+
+	// AccessReviewStart starts a campaign reviewing the current role
+	// memberships of an organization
+	// Returns the ID of the campaign
+	AccessReviewStart(ctx context.Context,
+		command AccessReviewStartCommand,
+		agent string) (r.Response[IdValue], error)
+
+	// AccessReviewDecide records a reviewer's keep or revoke decision on a
+	// membership of an open campaign. Each membership is decided once
+	// Returns NotAuthorized unless the reviewer holds PermReviewAccess in
+	// the organization and is not the member
+	AccessReviewDecide(ctx context.Context,
+		command AccessReviewDecideCommand,
+		agent string) (r.Response[any], error)
+
+	// AccessReviewClose closes a campaign and removes the revoked
+	// memberships, recorded with the given agent
+	// Returns the number of memberships removed
+	AccessReviewClose(ctx context.Context,
+		command AccessReviewCloseCommand,
+		agent string) (r.Response[int], error)
+
+	// AccessReviewGet retrieves a campaign with its memberships and decisions
+	AccessReviewGet(ctx context.Context, id int64) (r.Response[AccessReviewAggregate], error)
+
+	// AccessReviewMemberships resolves the current names of the users, roles
+	// and reviewers of memberships under review in the organization
+	// Erased users and deleted roles are named with placeholders
+	AccessReviewMemberships(ctx context.Context,
+		organizationId int64,
+		memberships []AccessReviewMembership) (r.Response[[]AccessReviewMembershipDetails], error)
+
+	// AccessReviewListByOrganization lists an organization's campaigns, most
+	// recent first
+	AccessReviewListByOrganization(ctx context.Context, organizationId int64) (r.Response[[]ubdata.AccessReview], error)
+
+	// AccessReviewExport exports a campaign's report as csv or json, signed
+	// with the configured signing key
+	AccessReviewExport(ctx context.Context, id int64, format string) (r.Response[AccessReviewExport], error)
+
+	// AccessReviewVerifyExport reports whether an exported report is
+	// unaltered and signed with the configured signing key
+	AccessReviewVerifyExport(ctx context.Context, data []byte) (r.Response[bool], error)
+
+	// UsersCount returns the total number of users in the system, not
+	// counting service accounts
 	UsersCount(ctx context.Context) (r.Response[int64], error)
 
+	// ServiceAccountAdd creates a service account owned by an organization.
+	// Service accounts cannot log in; they only hold API keys and roles.
+	// Returns the ID of the new account or an error
+	ServiceAccountAdd(ctx context.Context,
+		command ServiceAccountCreateCommand,
+		agent string) (r.Response[IdValue], error)
+
+	// ServiceAccountList lists the service accounts owned by an organization,
+	// or all service accounts when organizationId is 0
+	ServiceAccountList(ctx context.Context, organizationId int64) (r.Response[[]ubdata.ServiceAccount], error)
+
 	UserGenerateApiKey(ctx context.Context,
 		command UserGenerateApiKeyCommand,
 		agent string) (r.Response[string], error)
@@ -229,20 +433,65 @@ type ManagementService interface {
 		command UserDeleteApiKeyCommand,
 		agent string) (r.Response[any], error)
 
+	// UserRotateApiKey issues a replacement for an API key and returns it.
+	// The old key keeps working for the command's grace period.
+	UserRotateApiKey(ctx context.Context,
+		command UserRotateApiKeyCommand,
+		agent string) (r.Response[string], error)
+
+	// UserRecordApiKeyUse stores when and from which address an API key was
+	// last used
+	UserRecordApiKeyUse(ctx context.Context,
+		apiKeyId string,
+		ipAddress string) (r.Response[any], error)
+
 	// OrganizationsCount returns the total number of organizations in the system
 	OrganizationsCount(ctx context.Context) (r.Response[int64], error)
 
 	// ListOrganizationsWithUserCounts lists all organizations along with the count of users in each
 	OrganizationRolesWithUserCount(ctx context.Context, organizationId int64) (r.Response[[]ubdata.ListRolesWithUserCountsRow], error)
+
+	// Relationship tuple operations
+
+	// RelationTupleWrite grants a relation on an object to a subject.
+	// Writing a tuple that exists is a no-op.
+	RelationTupleWrite(ctx context.Context,
+		command RelationTupleWriteCommand,
+		agent string) (r.Response[any], error)
+
+	// RelationTupleDelete revokes a relation on an object from a subject.
+	// Returns NotFound if the tuple does not exist.
+	RelationTupleDelete(ctx context.Context,
+		command RelationTupleDeleteCommand,
+		agent string) (r.Response[any], error)
+
+	// RelationTuplesByObject lists the tuples of an object
+	RelationTuplesByObject(ctx context.Context, objectType string, objectId string) (r.Response[[]ubdata.RelationTuple], error)
+
+	// RelationTuplesBySubject lists the tuples granting relations to a
+	// subject. subjectRelation is empty for single principals.
+	RelationTuplesBySubject(ctx context.Context, subjectType string, subjectId string, subjectRelation string) (r.Response[[]ubdata.RelationTuple], error)
 }
 
 type ManagementImpl struct {
-	store             *evercore.EventStore
-	dbadapter         ubdata.DataAdapter
-	hashingService    ubsecurity.HashGenerator
+	store          *evercore.EventStore
+	dbadapter      ubdata.DataAdapter
+	hashingService ubsecurity.HashGenerator
+	apiKeyHasher   ubsecurity.HashGenerator
+	// apiKeyPepper keys the HMAC that verifies hmac-sha256 API key hashes,
+	// whichever hasher issues new keys.
+	apiKeyPepper      []byte
 	encryptionService ubsecurity.EncryptionService
 	twoFactorService  ub2fa.TotpService
 	emailLoginOptions EmailLoginOptions
+	loginAlertOptions LoginAlertOptions
+	rateLimitOptions  RateLimitOptions
+	permissionCatalog *PermissionCatalog
+
+	verificationOptions  VerificationOptions
+	accessRequestOptions AccessRequestOptions
+	accessReviewOptions  AccessReviewOptions
+	roleTemplates        []RoleTemplate
 }
 
 func Must(condition bool, message string) {
@@ -261,11 +510,38 @@ func (f EmailLoginValidatorFunc) ValidateEmailLogin(ctx context.Context, email s
 	return f(ctx, email)
 }
 
+// EmailSender queues emails sent by the management service.
+// ubmailer.BackgroundMailer satisfies it, which keeps mail delivery off the
+// request path.
+type EmailSender interface {
+	Send(job ubmailer.EmailJob)
+}
+
 type EmailLoginOptions struct {
 	Enabled    bool
 	CodeLength int
 	CodeTTL    time.Duration
 	Validator  EmailLoginValidator
+
+	// MaxAttempts is the number of incorrect guesses after which a code is
+	// invalidated.
+	MaxAttempts int
+
+	// RequestCooldown is the minimum time between codes for the same user,
+	// so a mailbox cannot be flooded with codes.
+	RequestCooldown time.Duration
+
+	// MagicLink issues a single-use login link alongside the code when the
+	// request is bound to a browser.
+	MagicLink bool
+
+	// BaseUrl is the externally visible address of the admin panel and is
+	// used to build magic links.
+	BaseUrl string
+
+	// Mailer sends the code and link to the user. Without it the caller is
+	// responsible for delivering them.
+	Mailer EmailSender
 }
 
 type ManagementOption func(*ManagementImpl)
@@ -279,6 +555,8 @@ func WithEmailLoginOptions(options EmailLoginOptions) ManagementOption {
 const (
 	defaultEmailLoginCodeLength = 6
 	defaultEmailLoginCodeTTL    = 15 * time.Minute
+	defaultEmailLoginAttempts   = 5
+	defaultEmailLoginCooldown   = time.Minute
 )
 
 func NewManagement(
@@ -318,6 +596,23 @@ func NewManagement(
 		if management.emailLoginOptions.CodeTTL <= 0 {
 			management.emailLoginOptions.CodeTTL = defaultEmailLoginCodeTTL
 		}
+		if management.emailLoginOptions.MaxAttempts <= 0 {
+			management.emailLoginOptions.MaxAttempts = defaultEmailLoginAttempts
+		}
+		if management.emailLoginOptions.RequestCooldown <= 0 {
+			management.emailLoginOptions.RequestCooldown = defaultEmailLoginCooldown
+		}
+	}
+
+	if management.verificationOptions.TokenTTL <= 0 {
+		management.verificationOptions.TokenTTL = defaultVerificationTokenTTL
+	}
+	if management.verificationOptions.ResendCooldown <= 0 {
+		management.verificationOptions.ResendCooldown = defaultVerificationResendCooldown
+	}
+
+	if management.loginAlertOptions.Enabled && management.loginAlertOptions.ReportTTL <= 0 {
+		management.loginAlertOptions.ReportTTL = defaultLoginAlertReportTTL
 	}
 
 	return &management
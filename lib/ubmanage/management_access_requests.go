@@ -0,0 +1,425 @@
+package ubmanage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	evercore "github.com/kernelplex/evercore/base"
+	"github.com/kernelplex/ubase/lib/ubdata"
+	"github.com/kernelplex/ubase/lib/ubmailer"
+	r "github.com/kernelplex/ubase/lib/ubresponse"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+// AccessRequestsPath is where the links in access request emails point.
+const AccessRequestsPath = "/admin/access-requests"
+
+var (
+	errAccessRequestNotFound = errors.New("access request not found")
+	errAccessRequestNoRole   = errors.New("role does not exist")
+	errAccessRequestHeld     = errors.New("user already holds the role")
+	errAccessRequestPending  = errors.New("a request for the role is already pending")
+	errAccessRequestDecided  = errors.New("access request has already been decided")
+	errAccessRequestOwn      = errors.New("users cannot decide their own access requests")
+	errAccessRequestApprover = errors.New("user cannot approve access requests in the organization")
+)
+
+// AccessRequestOptions configure the emails sent about access requests.
+type AccessRequestOptions struct {
+	// Mailer notifies approvers of new requests and requesters of the
+	// decision. Without it no emails are sent.
+	Mailer EmailSender
+
+	// BaseUrl is the externally visible address of the admin panel and is
+	// used to link to the access request inbox.
+	BaseUrl string
+}
+
+func WithAccessRequestOptions(options AccessRequestOptions) ManagementOption {
+	return func(m *ManagementImpl) {
+		m.accessRequestOptions = options
+	}
+}
+
+func (m *ManagementImpl) AccessRequestCreate(ctx context.Context,
+	command AccessRequestCreateCommand,
+	agent string) (r.Response[IdValue], error) {
+
+	if ok, issues := command.Validate(); !ok {
+		return r.ValidationError[IdValue](issues), nil
+	}
+	justification := strings.TrimSpace(command.Justification)
+
+	id, err := evercore.InContext(
+		ctx,
+		m.store,
+		func(etx evercore.EventStoreContext) (int64, error) {
+			role := RoleAggregate{}
+			err := etx.LoadStateInto(&role, command.RoleId)
+			if err != nil {
+				if MapEvercoreErrorToStatus(err) == ubstatus.NotFound {
+					return 0, errAccessRequestNoRole
+				}
+				return 0, fmt.Errorf("failed to load role: %w", err)
+			}
+			if role.State.Deleted {
+				return 0, errAccessRequestNoRole
+			}
+			if err := checkServiceAccountRole(etx, command.UserId, command.RoleId); err != nil {
+				return 0, err
+			}
+
+			// A user holding the role may still ask to keep it past its
+			// expiry.
+			held, err := m.dbadapter.GetAllUserOrganizationRoles(ctx, command.UserId)
+			if err != nil {
+				return 0, fmt.Errorf("failed to get user roles: %w", err)
+			}
+			if slices.ContainsFunc(held, func(membership ubdata.ListUserOrganizationRolesRow) bool {
+				return membership.RoleID == command.RoleId && membership.ExpiresAt == 0
+			}) {
+				return 0, errAccessRequestHeld
+			}
+			pending, err := m.dbadapter.CountUserRoleAccessRequests(ctx, command.UserId, command.RoleId, AccessRequestPending)
+			if err != nil {
+				return 0, fmt.Errorf("failed to count pending access requests: %w", err)
+			}
+			if pending > 0 {
+				return 0, errAccessRequestPending
+			}
+
+			aggregate := AccessRequestAggregate{}
+			err = etx.CreateAggregateInto(&aggregate)
+			if err != nil {
+				return 0, fmt.Errorf("failed to create aggregate: %w", err)
+			}
+			event := AccessRequestedEvent{
+				OrganizationId: role.State.OrganizationId,
+				UserId:         command.UserId,
+				RoleId:         command.RoleId,
+				Justification:  justification,
+			}
+			err = etx.ApplyEventTo(&aggregate, event, time.Now(), agent)
+			if err != nil {
+				return 0, fmt.Errorf("failed to apply access requested event: %w", err)
+			}
+
+			err = m.dbadapter.AddAccessRequest(ctx, ubdata.AccessRequest{
+				ID:             aggregate.Id,
+				OrganizationID: aggregate.State.OrganizationId,
+				UserID:         aggregate.State.UserId,
+				RoleID:         aggregate.State.RoleId,
+				Justification:  aggregate.State.Justification,
+				Status:         aggregate.State.Status,
+				RequestedAt:    aggregate.State.RequestedAt,
+			})
+			if err != nil {
+				return 0, fmt.Errorf("failed to add access request in database: %w", err)
+			}
+			return aggregate.Id, nil
+		})
+
+	switch {
+	case errors.Is(err, errAccessRequestNoRole):
+		return r.StatusError[IdValue](ubstatus.NotFound, "Role not found"), nil
+	case errors.Is(err, errServiceAccountOrganization):
+		return r.StatusError[IdValue](ubstatus.ValidationError, "Service accounts can only be given roles in the organization that owns them"), nil
+	case errors.Is(err, errAccessRequestHeld):
+		return r.StatusError[IdValue](ubstatus.ValidationError, "The user already holds this role"), nil
+	case errors.Is(err, errAccessRequestPending):
+		return r.StatusError[IdValue](ubstatus.AlreadyExists, "A request for this role is already pending"), nil
+	case err != nil:
+		status := MapEvercoreErrorToStatus(err)
+		if status == ubstatus.NotFound {
+			return r.StatusError[IdValue](status, "User not found"), nil
+		}
+		slog.Error("Error creating access request", "error", err)
+		return r.StatusError[IdValue](status, "Error creating access request"), err
+	}
+
+	m.sendAccessRequestToApprovers(ctx, id)
+	return r.Success(IdValue{Id: id}), nil
+}
+
+func (m *ManagementImpl) AccessRequestApprove(ctx context.Context,
+	command AccessRequestApproveCommand,
+	agent string) (r.Response[any], error) {
+
+	if ok, issues := command.Validate(); !ok {
+		return r.ValidationError[any](issues), nil
+	}
+
+	err := m.store.WithContext(
+		ctx,
+		func(etx evercore.EventStoreContext) error {
+			aggregate, err := m.loadAccessRequestForDecision(ctx, etx, command.Id, command.ApproverId)
+			if err != nil {
+				return err
+			}
+
+			event := AccessRequestApprovedEvent{
+				ApproverId: command.ApproverId,
+				Comment:    strings.TrimSpace(command.Comment),
+				ExpiresAt:  unixOrZero(command.ExpiresAt),
+			}
+			err = etx.ApplyEventTo(aggregate, event, time.Now(), agent)
+			if err != nil {
+				return fmt.Errorf("failed to apply access request approved event: %w", err)
+			}
+
+			err = m.addUserToRole(ctx, etx, UserAddToRoleCommand{
+				UserId:    aggregate.State.UserId,
+				RoleId:    aggregate.State.RoleId,
+				ExpiresAt: command.ExpiresAt,
+			}, command.Id, agent)
+			if err != nil {
+				return err
+			}
+
+			return m.decideAccessRequest(ctx, aggregate)
+		})
+
+	if response, handled := accessRequestDecisionError(err); handled {
+		return response, nil
+	}
+	if errors.Is(err, errServiceAccountOrganization) {
+		return r.StatusError[any](ubstatus.ValidationError, "Service accounts can only be given roles in the organization that owns them"), nil
+	}
+	var exclusive *exclusiveRoleError
+	if errors.As(err, &exclusive) {
+		return r.StatusError[any](ubstatus.ValidationError, exclusive.message()), nil
+	}
+	if err != nil {
+		slog.Error("Error approving access request", "error", err)
+		return r.Error[any]("Error approving access request"), err
+	}
+
+	m.sendAccessRequestDecision(ctx, command.Id)
+	return r.SuccessAny(), nil
+}
+
+func (m *ManagementImpl) AccessRequestDeny(ctx context.Context,
+	command AccessRequestDenyCommand,
+	agent string) (r.Response[any], error) {
+
+	if ok, issues := command.Validate(); !ok {
+		return r.ValidationError[any](issues), nil
+	}
+
+	err := m.store.WithContext(
+		ctx,
+		func(etx evercore.EventStoreContext) error {
+			aggregate, err := m.loadAccessRequestForDecision(ctx, etx, command.Id, command.ApproverId)
+			if err != nil {
+				return err
+			}
+
+			event := AccessRequestDeniedEvent{
+				ApproverId: command.ApproverId,
+				Comment:    strings.TrimSpace(command.Comment),
+			}
+			err = etx.ApplyEventTo(aggregate, event, time.Now(), agent)
+			if err != nil {
+				return fmt.Errorf("failed to apply access request denied event: %w", err)
+			}
+
+			return m.decideAccessRequest(ctx, aggregate)
+		})
+
+	if response, handled := accessRequestDecisionError(err); handled {
+		return response, nil
+	}
+	if err != nil {
+		slog.Error("Error denying access request", "error", err)
+		return r.Error[any]("Error denying access request"), err
+	}
+
+	m.sendAccessRequestDecision(ctx, command.Id)
+	return r.SuccessAny(), nil
+}
+
+// loadAccessRequestForDecision loads a pending request and checks that the
+// approver may decide it.
+func (m *ManagementImpl) loadAccessRequestForDecision(ctx context.Context,
+	etx evercore.EventStoreContext,
+	id int64,
+	approverId int64) (*AccessRequestAggregate, error) {
+
+	aggregate := AccessRequestAggregate{}
+	err := etx.LoadStateInto(&aggregate, id)
+	if err != nil {
+		if MapEvercoreErrorToStatus(err) == ubstatus.NotFound {
+			return nil, errAccessRequestNotFound
+		}
+		return nil, fmt.Errorf("failed to load access request: %w", err)
+	}
+	if aggregate.State.Status != AccessRequestPending {
+		return nil, errAccessRequestDecided
+	}
+	if aggregate.State.UserId == approverId {
+		return nil, errAccessRequestOwn
+	}
+
+	approver, err := m.userHoldsPermission(ctx, etx, approverId,
+		aggregate.State.OrganizationId, PermApproveAccessRequests, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to check approver: %w", err)
+	}
+	if !approver {
+		return nil, errAccessRequestApprover
+	}
+	return &aggregate, nil
+}
+
+// decideAccessRequest records the aggregate's decision in the read model.
+func (m *ManagementImpl) decideAccessRequest(ctx context.Context, aggregate *AccessRequestAggregate) error {
+	err := m.dbadapter.DecideAccessRequest(ctx, ubdata.AccessRequest{
+		ID:        aggregate.Id,
+		Status:    aggregate.State.Status,
+		DecidedBy: aggregate.State.DecidedBy,
+		DecidedAt: aggregate.State.DecidedAt,
+		Comment:   aggregate.State.Comment,
+		ExpiresAt: aggregate.State.ExpiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to decide access request in database: %w", err)
+	}
+	return nil
+}
+
+func accessRequestDecisionError(err error) (r.Response[any], bool) {
+	switch {
+	case errors.Is(err, errAccessRequestNotFound):
+		return r.StatusError[any](ubstatus.NotFound, "Access request not found"), true
+	case errors.Is(err, errAccessRequestDecided):
+		return r.StatusError[any](ubstatus.ValidationError, "The access request has already been decided"), true
+	case errors.Is(err, errAccessRequestOwn):
+		return r.StatusError[any](ubstatus.NotAuthorized, "You cannot decide your own access request"), true
+	case errors.Is(err, errAccessRequestApprover):
+		return r.StatusError[any](ubstatus.NotAuthorized, "You cannot approve access requests in this organization"), true
+	}
+	return r.Response[any]{}, false
+}
+
+func (m *ManagementImpl) AccessRequestGet(ctx context.Context, id int64) (r.Response[ubdata.AccessRequest], error) {
+	request, found, err := m.dbadapter.GetAccessRequest(ctx, id)
+	if err != nil {
+		slog.Error("Error getting access request", "error", err)
+		return r.Error[ubdata.AccessRequest]("Error getting access request"), err
+	}
+	if !found {
+		return r.StatusError[ubdata.AccessRequest](ubstatus.NotFound, "Access request not found"), nil
+	}
+	return r.Success(request), nil
+}
+
+func (m *ManagementImpl) AccessRequestListByOrganization(ctx context.Context, organizationId int64, status string) (r.Response[[]ubdata.AccessRequest], error) {
+	requests, err := m.dbadapter.ListOrganizationAccessRequests(ctx, organizationId, status)
+	if err != nil {
+		slog.Error("Error listing access requests", "error", err)
+		return r.Error[[]ubdata.AccessRequest]("Error listing access requests"), err
+	}
+	return r.Success(requests), nil
+}
+
+func (m *ManagementImpl) AccessRequestListByUser(ctx context.Context, userId int64) (r.Response[[]ubdata.AccessRequest], error) {
+	requests, err := m.dbadapter.ListUserAccessRequests(ctx, userId)
+	if err != nil {
+		slog.Error("Error listing access requests", "error", err)
+		return r.Error[[]ubdata.AccessRequest]("Error listing access requests"), err
+	}
+	return r.Success(requests), nil
+}
+
+// sendAccessRequestToApprovers emails the organization's approvers about a
+// new request. Emails are best effort and never fail the request.
+func (m *ManagementImpl) sendAccessRequestToApprovers(ctx context.Context, id int64) {
+	if m.accessRequestOptions.Mailer == nil {
+		return
+	}
+	request, found, err := m.dbadapter.GetAccessRequest(ctx, id)
+	if err != nil || !found {
+		slog.Error("Error loading access request for notification", "error", err, "id", id)
+		return
+	}
+	var approvers []ubdata.UserEmail
+	err = m.store.WithReadonlyContext(ctx, func(etx evercore.EventStoreReadonlyContext) error {
+		approvers, err = m.organizationUsersHoldingPermission(ctx, etx, request.OrganizationID, PermApproveAccessRequests, time.Now())
+		return err
+	})
+	if err != nil {
+		slog.Error("Error listing access request approvers", "error", err, "id", id)
+		return
+	}
+	for _, approver := range approvers {
+		if approver.UserID == request.UserID || approver.Email == "" {
+			continue
+		}
+		m.accessRequestOptions.Mailer.Send(accessRequestEmail(request, approver.Email, m.accessRequestsUrl()))
+	}
+}
+
+// sendAccessRequestDecision emails the requester the decision on their
+// request.
+func (m *ManagementImpl) sendAccessRequestDecision(ctx context.Context, id int64) {
+	if m.accessRequestOptions.Mailer == nil {
+		return
+	}
+	request, found, err := m.dbadapter.GetAccessRequest(ctx, id)
+	if err != nil || !found {
+		slog.Error("Error loading access request for notification", "error", err, "id", id)
+		return
+	}
+	if request.UserEmail == "" {
+		return
+	}
+	m.accessRequestOptions.Mailer.Send(accessRequestDecisionEmail(request))
+}
+
+func (m *ManagementImpl) accessRequestsUrl() string {
+	return strings.TrimRight(m.accessRequestOptions.BaseUrl, "/") + AccessRequestsPath
+}
+
+func accessRequestEmail(request ubdata.AccessRequest, to string, inboxUrl string) ubmailer.EmailJob {
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s has requested the %s role in %s.\n\n", request.UserDisplayName, request.RoleName, request.OrganizationName)
+	body.WriteString("Justification:\n")
+	body.WriteString(request.Justification)
+	body.WriteString("\n\nReview the request in the access request inbox:\n")
+	body.WriteString(inboxUrl)
+	body.WriteString("\n")
+
+	return ubmailer.EmailJob{
+		To:       to,
+		Subject:  fmt.Sprintf("Access request for %s", request.RoleName),
+		TextBody: body.String(),
+	}
+}
+
+func accessRequestDecisionEmail(request ubdata.AccessRequest) ubmailer.EmailJob {
+	var body strings.Builder
+	fmt.Fprintf(&body, "Your request for the %s role in %s was %s", request.RoleName, request.OrganizationName, request.Status)
+	if request.DecidedByName != "" {
+		fmt.Fprintf(&body, " by %s", request.DecidedByName)
+	}
+	body.WriteString(".\n")
+	if request.Status == AccessRequestApproved && request.ExpiresAt > 0 {
+		fmt.Fprintf(&body, "The role expires %s.\n", time.Unix(request.ExpiresAt, 0).UTC().Format(time.RFC1123))
+	}
+	if request.Comment != "" {
+		body.WriteString("\nComment:\n")
+		body.WriteString(request.Comment)
+		body.WriteString("\n")
+	}
+
+	return ubmailer.EmailJob{
+		To:       request.UserEmail,
+		Subject:  fmt.Sprintf("Access request %s: %s", request.Status, request.RoleName),
+		TextBody: body.String(),
+	}
+}
@@ -0,0 +1,289 @@
+package ubmanage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	evercore "github.com/kernelplex/evercore/base"
+	r "github.com/kernelplex/ubase/lib/ubresponse"
+	"github.com/kernelplex/ubase/lib/ubsecurity"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+const (
+	// DefaultApiKeyRotationGracePeriod is how long a rotated key keeps
+	// working when the caller has no preference.
+	DefaultApiKeyRotationGracePeriod = 24 * time.Hour
+	// MaxApiKeyRotationGracePeriod bounds how long a rotated key keeps
+	// working.
+	MaxApiKeyRotationGracePeriod = 30 * 24 * time.Hour
+
+	// apiKeyRehashAgent is recorded as the agent when a legacy API key hash
+	// is upgraded.
+	apiKeyRehashAgent = "system:api-key-rehash"
+)
+
+// WithApiKeyHasher hashes new API key secrets with hasher instead of the
+// password hashing service. API key secrets are long random strings, so a fast
+// keyed hash such as ubsecurity.HmacSha256HashGenerator is enough and avoids
+// running argon2id on every uncached lookup. Existing keys hashed with the
+// password hashing service keep working and are rehashed on their next use.
+func WithApiKeyHasher(hasher ubsecurity.HashGenerator) ManagementOption {
+	return func(m *ManagementImpl) {
+		m.apiKeyHasher = hasher
+		if hmacHasher, ok := hasher.(ubsecurity.HmacSha256HashGenerator); ok && m.apiKeyPepper == nil {
+			m.apiKeyPepper = hmacHasher.Pepper
+		}
+	}
+}
+
+// WithApiKeyHmacPepper sets the pepper that verifies API keys hashed with
+// ubsecurity.HmacSha256HashGenerator. Those keys keep working when new keys
+// are hashed with something else, as long as the pepper is still set.
+func WithApiKeyHmacPepper(pepper []byte) ManagementOption {
+	return func(m *ManagementImpl) {
+		m.apiKeyPepper = pepper
+	}
+}
+
+var (
+	errApiKeyNotFound = errors.New("api key not found")
+	errApiKeyRotated  = errors.New("api key has already been rotated")
+	errApiKeyExpired  = errors.New("api key is expired")
+)
+
+// issueApiKey generates a new API key with the given settings for the user
+// and returns it. Only a hash of the secret part is stored.
+func (m *ManagementImpl) issueApiKey(ctx context.Context,
+	etx evercore.EventStoreContext,
+	aggregate *UserAggregate,
+	key ApiKey,
+	expiresAt time.Time,
+	agent string) (string, error) {
+
+	// Generate the API key and hash it
+	apiKey := ubsecurity.GenerateSecureRandomString(ApiKeyLength)
+	if len(apiKey) < 40 {
+		// This should not happen.
+		panic("Generated API key is too short")
+	}
+
+	// Id is the first 10 characters of the API key. Secret is the rest.
+	apiKeyId := apiKey[:ApiKeyIdLength]
+	secret := apiKey[ApiKeyIdLength:]
+
+	secretHash, err := m.apiKeyHashingService().GenerateHashBase64(secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash api key: %w", err)
+	}
+
+	now := time.Now()
+	event := UserApiKeyAddedEvent{
+		Id:             apiKeyId,
+		OrganizationId: key.OrganizationId,
+		SecretHash:     secretHash,
+		Name:           key.Name,
+		CreatedAt:      now.Unix(),
+		ExpiresAt:      expiresAt.Unix(),
+		Scopes:         key.Scopes,
+		AllowedCidrs:   key.AllowedCidrs,
+	}
+
+	err = etx.ApplyEventTo(aggregate, event, now, agent)
+	if err != nil {
+		return "", fmt.Errorf("failed to apply user api key added event: %w", err)
+	}
+
+	err = m.dbadapter.UserAddApiKey(
+		ctx,
+		aggregate.Id,
+		key.OrganizationId,
+		apiKeyId,
+		secretHash,
+		key.Name,
+		now,
+		expiresAt,
+		key.Scopes,
+		key.AllowedCidrs)
+	if err != nil {
+		return "", fmt.Errorf("failed to add api key in database: %w", err)
+	}
+
+	return apiKey, nil
+}
+
+// apiKeyHashingService returns the hasher for new API key secrets.
+func (m *ManagementImpl) apiKeyHashingService() ubsecurity.HashGenerator {
+	if m.apiKeyHasher != nil {
+		return m.apiKeyHasher
+	}
+	return m.hashingService
+}
+
+// verifyApiKeySecret checks the secret against its stored hash. Hashes made by
+// the HMAC hasher are recognised by their prefix and verified with the API key
+// pepper, even if new keys are no longer hashed that way; anything else was
+// made by the password hashing service. The second result reports whether the
+// hash should be replaced with one from the API key hasher.
+func (m *ManagementImpl) verifyApiKeySecret(secret string, secretHash string) (bool, bool, error) {
+	if ubsecurity.IsHmacSha256Hash(secretHash) {
+		if len(m.apiKeyPepper) == 0 {
+			return false, false, fmt.Errorf("no pepper is configured to verify hmac-sha256 api key hashes")
+		}
+		match, err := ubsecurity.HmacSha256HashGenerator{Pepper: m.apiKeyPepper}.VerifyBase64(secret, secretHash)
+		return match, false, err
+	}
+	match, err := m.hashingService.VerifyBase64(secret, secretHash)
+	if err != nil {
+		return false, false, err
+	}
+	return match, match && m.apiKeyHasher != nil, nil
+}
+
+// rehashApiKey replaces a legacy hash of an API key secret with one from the
+// API key hasher, so later lookups skip the password hashing service. Keys
+// that have been deleted or already rehashed, for example by a concurrent
+// lookup, are left alone.
+func (m *ManagementImpl) rehashApiKey(ctx context.Context, userId int64, apiKeyId string, secret string) error {
+	secretHash, err := m.apiKeyHasher.GenerateHashBase64(secret)
+	if err != nil {
+		return fmt.Errorf("failed to hash api key: %w", err)
+	}
+	return m.store.WithContext(
+		ctx,
+		func(etx evercore.EventStoreContext) error {
+			aggregate := UserAggregate{}
+			err := loadActiveUserInto(etx, &aggregate, userId)
+			if err != nil {
+				return fmt.Errorf("failed to load user: %w", err)
+			}
+			index := slices.IndexFunc(aggregate.State.ApiKeys, func(key ApiKey) bool {
+				return key.Id == apiKeyId
+			})
+			if index < 0 || ubsecurity.IsHmacSha256Hash(aggregate.State.ApiKeys[index].SecretHash) {
+				return nil
+			}
+
+			event := UserApiKeyRehashedEvent{
+				Id:         apiKeyId,
+				SecretHash: secretHash,
+			}
+			err = etx.ApplyEventTo(&aggregate, event, time.Now(), apiKeyRehashAgent)
+			if err != nil {
+				return fmt.Errorf("failed to apply user api key rehashed event: %w", err)
+			}
+
+			err = m.dbadapter.UserUpdateApiKeyHash(ctx, userId, apiKeyId, secretHash)
+			if err != nil {
+				return fmt.Errorf("failed to update api key hash in database: %w", err)
+			}
+			return nil
+		})
+}
+
+// UserRotateApiKey issues a replacement for an API key with the same name,
+// organization, scopes, allowlist and expiry, and returns it. The old key
+// keeps working until the grace period ends.
+func (m *ManagementImpl) UserRotateApiKey(ctx context.Context,
+	command UserRotateApiKeyCommand,
+	agent string) (r.Response[string], error) {
+
+	if ok, issues := command.Validate(); !ok {
+		return r.ValidationError[string](issues), nil
+	}
+
+	apiKey, err := evercore.InContext(
+		ctx,
+		m.store,
+		func(etx evercore.EventStoreContext) (string, error) {
+			aggregate := UserAggregate{}
+			err := loadActiveUserInto(etx, &aggregate, command.UserId)
+			if err != nil {
+				return "", fmt.Errorf("failed to load user: %w", err)
+			}
+
+			var old *ApiKey
+			for i := range aggregate.State.ApiKeys {
+				if aggregate.State.ApiKeys[i].Id == command.ApiKeyId {
+					old = &aggregate.State.ApiKeys[i]
+				}
+			}
+			if old == nil {
+				return "", errApiKeyNotFound
+			}
+			if old.ReplacedBy != "" {
+				return "", errApiKeyRotated
+			}
+			now := time.Now()
+			if old.ExpiresAt <= now.Unix() {
+				return "", errApiKeyExpired
+			}
+			// Copy before issuing, which appends to the key list.
+			replacement := ApiKey{
+				OrganizationId: old.OrganizationId,
+				Name:           old.Name,
+				Scopes:         old.Scopes,
+				AllowedCidrs:   old.AllowedCidrs,
+			}
+			expiresAt := time.Unix(old.ExpiresAt, 0)
+			graceEndsAt := min(now.Add(command.GracePeriod).Unix(), old.ExpiresAt)
+
+			apiKey, err := m.issueApiKey(ctx, etx, &aggregate, replacement, expiresAt, agent)
+			if err != nil {
+				return "", err
+			}
+			replacedBy := apiKey[:ApiKeyIdLength]
+
+			event := UserApiKeyRotatedEvent{
+				Id:         command.ApiKeyId,
+				ReplacedBy: replacedBy,
+				ExpiresAt:  graceEndsAt,
+			}
+			err = etx.ApplyEventTo(&aggregate, event, now, agent)
+			if err != nil {
+				return "", fmt.Errorf("failed to apply user api key rotated event: %w", err)
+			}
+
+			err = m.dbadapter.UserReplaceApiKey(ctx, aggregate.Id, command.ApiKeyId, replacedBy, time.Unix(graceEndsAt, 0))
+			if err != nil {
+				return "", fmt.Errorf("failed to replace api key in database: %w", err)
+			}
+			return apiKey, nil
+		})
+
+	switch {
+	case errors.Is(err, errApiKeyNotFound):
+		return r.StatusError[string](ubstatus.NotFound, "API key not found"), nil
+	case errors.Is(err, errApiKeyRotated):
+		return r.StatusError[string](ubstatus.ValidationError, "API key has already been rotated"), nil
+	case errors.Is(err, errApiKeyExpired):
+		return r.StatusError[string](ubstatus.ValidationError, "API key is expired"), nil
+	case err != nil:
+		status := MapEvercoreErrorToStatus(err)
+		slog.Error("Error rotating api key", "error", err)
+		return r.StatusError[string](status, "Error rotating api key"), err
+	}
+	return r.Success(apiKey), nil
+}
+
+// UserRecordApiKeyUse stores when and from where an API key was last used.
+// It is only kept in the database; callers should throttle it.
+func (m *ManagementImpl) UserRecordApiKeyUse(ctx context.Context,
+	apiKeyId string,
+	ipAddress string) (r.Response[any], error) {
+
+	if len(apiKeyId) != ApiKeyIdLength {
+		return r.StatusError[any](ubstatus.ValidationError, "API key id is invalid"), nil
+	}
+	err := m.dbadapter.UserRecordApiKeyUse(ctx, apiKeyId, strings.TrimSpace(ipAddress), time.Now())
+	if err != nil {
+		slog.Error("Error recording api key use", "error", err)
+		return r.Error[any]("Error recording api key use"), err
+	}
+	return r.SuccessAny(), nil
+}
@@ -0,0 +1,233 @@
+package ubmanage
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	evercore "github.com/kernelplex/evercore/base"
+	"github.com/kernelplex/ubase/lib/ubmailer"
+	r "github.com/kernelplex/ubase/lib/ubresponse"
+	"github.com/kernelplex/ubase/lib/ubsecurity"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+// EmailLoginLinkPath is where magic links in email login emails point.
+const EmailLoginLinkPath = "/admin/login/email/verify"
+
+const emailLoginLinkPurpose = "email-login-link"
+
+var errInvalidEmailLoginLink = errors.New("invalid email login link")
+
+type emailLoginCooldownError struct {
+	wait time.Duration
+}
+
+func (e *emailLoginCooldownError) Error() string {
+	return fmt.Sprintf("email login code requested too soon, retry in %s", e.wait)
+}
+
+// emailLoginCooldown returns how long the user must wait before another code
+// can be sent.
+func (m *ManagementImpl) emailLoginCooldown(state *UserState, now time.Time) time.Duration {
+	if state.EmailLoginCodeGeneratedAt == 0 {
+		return 0
+	}
+	next := time.Unix(state.EmailLoginCodeGeneratedAt, 0).Add(m.emailLoginOptions.RequestCooldown)
+	return max(next.Sub(now), 0)
+}
+
+// recordEmailLoginCodeFailure counts an incorrect guess and invalidates the
+// code once the attempt limit is reached, reporting whether it did so.
+func (m *ManagementImpl) recordEmailLoginCodeFailure(etx evercore.EventStoreContext,
+	aggregate *UserAggregate,
+	now time.Time,
+	agent string) (bool, error) {
+
+	if err := etx.ApplyEventTo(aggregate, UserEmailLoginCodeFailedEvent{}, now, agent); err != nil {
+		return false, fmt.Errorf("failed to apply email login code failed event: %w", err)
+	}
+	if aggregate.State.EmailLoginCodeFailures < int64(m.emailLoginOptions.MaxAttempts) {
+		return false, nil
+	}
+	event := UserEmailLoginCodeInvalidatedEvent{Reason: "Too many incorrect attempts"}
+	if err := etx.ApplyEventTo(aggregate, event, now, agent); err != nil {
+		return false, fmt.Errorf("failed to apply email login code invalidated event: %w", err)
+	}
+	return true, nil
+}
+
+// emailLoginLinkClaims are encrypted into magic link tokens. Nonce is
+// recorded (hashed) on the user so the link can only be used while its code
+// is pending, and Binding is the hash of the requesting browser's secret.
+type emailLoginLinkClaims struct {
+	Purpose   string `json:"purpose"`
+	UserId    int64  `json:"userId"`
+	Nonce     string `json:"nonce"`
+	Binding   string `json:"binding"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+func hashEmailLoginSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func secretHashesMatch(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// emailLoginLinkToken returns a magic link token and the hash identifying it
+// on the user.
+func (m *ManagementImpl) emailLoginLinkToken(userId int64, binding string, expiresAt int64) (string, string, error) {
+	nonce := hex.EncodeToString(ubsecurity.GenerateSecureRandom(16))
+	claims := emailLoginLinkClaims{
+		Purpose:   emailLoginLinkPurpose,
+		UserId:    userId,
+		Nonce:     nonce,
+		Binding:   hashEmailLoginSecret(binding),
+		ExpiresAt: expiresAt,
+	}
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal email login link token: %w", err)
+	}
+	token, err := m.encryptionService.Encrypt64(string(data))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encrypt email login link token: %w", err)
+	}
+	return token, hashEmailLoginSecret(nonce), nil
+}
+
+func (m *ManagementImpl) parseEmailLoginLinkToken(token string) (emailLoginLinkClaims, error) {
+	data, err := m.encryptionService.Decrypt64(token)
+	if err != nil {
+		return emailLoginLinkClaims{}, errInvalidEmailLoginLink
+	}
+	var claims emailLoginLinkClaims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return emailLoginLinkClaims{}, errInvalidEmailLoginLink
+	}
+	if claims.Purpose != emailLoginLinkPurpose || claims.UserId <= 0 || claims.Nonce == "" {
+		return emailLoginLinkClaims{}, errInvalidEmailLoginLink
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		return emailLoginLinkClaims{}, errInvalidEmailLoginLink
+	}
+	return claims, nil
+}
+
+func (m *ManagementImpl) emailLoginLinkUrl(token string) string {
+	return strings.TrimRight(m.emailLoginOptions.BaseUrl, "/") + EmailLoginLinkPath + "?token=" + url.QueryEscape(token)
+}
+
+var emailLoginHtmlTemplate = template.Must(template.New("email-login").Parse(`<p>Use this code to sign in:</p>
+<p style="font-size:24px;font-weight:bold;letter-spacing:4px">{{.Code}}</p>
+{{if .LinkUrl}}<p>Or sign in directly from the browser you requested it in:</p>
+<p><a href="{{.LinkUrl}}">Sign in</a></p>
+{{end}}<p>This code expires at {{.Expires}}. If you did not request it, you can ignore this email.</p>
+`))
+
+func emailLoginEmail(login UserEmailLoginRequestResponse) ubmailer.EmailJob {
+	expires := time.Unix(login.ExpiresAt, 0).UTC().Format(time.RFC1123)
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "Use this code to sign in: %s\n", login.Code)
+	if login.LinkUrl != "" {
+		text.WriteString("\nOr sign in directly from the browser you requested it in:\n")
+		text.WriteString(login.LinkUrl)
+		text.WriteString("\n")
+	}
+	fmt.Fprintf(&text, "\nThis code expires at %s. If you did not request it, you can ignore this email.\n", expires)
+
+	var html strings.Builder
+	err := emailLoginHtmlTemplate.Execute(&html, struct {
+		Code    string
+		LinkUrl string
+		Expires string
+	}{login.Code, login.LinkUrl, expires})
+	if err != nil {
+		slog.Error("Error rendering email login email", "error", err)
+		html.Reset()
+	}
+
+	return ubmailer.EmailJob{
+		To:       login.Email,
+		Subject:  "Your sign-in code",
+		TextBody: text.String(),
+		HtmlBody: html.String(),
+	}
+}
+
+func (m *ManagementImpl) UserVerifyEmailLoginLink(ctx context.Context,
+	command UserVerifyEmailLoginLinkCommand,
+	agent string) (r.Response[*UserAuthenticationResponse], error) {
+
+	if !m.emailLoginOptions.Enabled || !m.emailLoginOptions.MagicLink {
+		return r.StatusError[*UserAuthenticationResponse](ubstatus.NotAuthorized, "Email login links are not enabled"), nil
+	}
+
+	if ok, issues := command.Validate(); !ok {
+		return r.ValidationError[*UserAuthenticationResponse](issues), nil
+	}
+
+	claims, err := m.parseEmailLoginLinkToken(command.Token)
+	if err != nil {
+		return r.StatusError[*UserAuthenticationResponse](ubstatus.NotAuthorized, "This link is invalid or has expired"), nil
+	}
+	// A mismatch leaves the link usable, so a mail scanner following it
+	// cannot burn the user's login.
+	if !secretHashesMatch(hashEmailLoginSecret(command.Binding), claims.Binding) {
+		return r.StatusError[*UserAuthenticationResponse](ubstatus.NotAuthorized, "Open this link in the browser you requested it from"), nil
+	}
+
+	var alert *loginAlert
+	response, err := evercore.InContext(
+		ctx,
+		m.store,
+		func(etx evercore.EventStoreContext) (r.Response[*UserAuthenticationResponse], error) {
+			aggregate := UserAggregate{}
+			err := loadActiveUserInto(etx, &aggregate, claims.UserId)
+			if err != nil {
+				status := MapEvercoreErrorToStatus(err)
+				if status == ubstatus.NotFound || errors.Is(err, errUserErased) {
+					return r.StatusError[*UserAuthenticationResponse](ubstatus.NotAuthorized, "This link is invalid or has expired"), nil
+				}
+				slog.Error("Error getting user for email login link", "error", err)
+				return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), err
+			}
+
+			if aggregate.State.Disabled {
+				return r.StatusError[*UserAuthenticationResponse](ubstatus.NotAuthorized, "This account is not currently active. Please contact support."), nil
+			}
+
+			// The hash is cleared when the code is consumed or replaced.
+			if aggregate.State.EmailLoginLinkHash == "" ||
+				!secretHashesMatch(aggregate.State.EmailLoginLinkHash, hashEmailLoginSecret(claims.Nonce)) {
+				return r.StatusError[*UserAuthenticationResponse](ubstatus.NotAuthorized, "This link is invalid or has expired"), nil
+			}
+
+			client, err := m.sealLoginClientFor(ctx, &aggregate, command.Client)
+			if err != nil {
+				return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), err
+			}
+
+			var response r.Response[*UserAuthenticationResponse]
+			response, alert, err = m.completeEmailLogin(ctx, etx, &aggregate, client, command.Client, agent)
+			return response, err
+		})
+
+	if err == nil {
+		m.sendLoginAlert(ctx, alert)
+	}
+	return response, err
+}
@@ -0,0 +1,92 @@
+package ubmanage
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmailLoginLinkToken(t *testing.T) {
+	m := newPIITestManagement()
+	expiresAt := time.Now().Add(time.Minute).Unix()
+
+	token, linkHash, err := m.emailLoginLinkToken(42, "browser-secret", expiresAt)
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	if strings.Contains(token, "browser-secret") {
+		t.Fatal("expected binding to be hidden in the token")
+	}
+
+	claims, err := m.parseEmailLoginLinkToken(token)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if claims.UserId != 42 || claims.ExpiresAt != expiresAt {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+	if hashEmailLoginSecret(claims.Nonce) != linkHash {
+		t.Fatal("expected link hash to identify the token's nonce")
+	}
+	if !secretHashesMatch(claims.Binding, hashEmailLoginSecret("browser-secret")) {
+		t.Fatal("expected token to be bound to the browser secret")
+	}
+	if secretHashesMatch(claims.Binding, hashEmailLoginSecret("other-browser")) {
+		t.Fatal("expected other browsers not to match")
+	}
+
+	otherToken, otherHash, err := m.emailLoginLinkToken(42, "browser-secret", expiresAt)
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	if otherToken == token || otherHash == linkHash {
+		t.Fatal("expected every link to be unique")
+	}
+
+	expired, _, err := m.emailLoginLinkToken(42, "browser-secret", time.Now().Add(-time.Minute).Unix())
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	if _, err := m.parseEmailLoginLinkToken(expired); err == nil {
+		t.Fatal("expected expired token to be rejected")
+	}
+
+	report, err := m.loginReportToken(42, time.Now())
+	if err != nil {
+		t.Fatalf("report token: %v", err)
+	}
+	if _, err := m.parseEmailLoginLinkToken(report); err == nil {
+		t.Fatal("expected token for another purpose to be rejected")
+	}
+	if _, err := m.parseEmailLoginLinkToken("not-a-token"); err == nil {
+		t.Fatal("expected garbage to be rejected")
+	}
+}
+
+func TestEmailLoginEmail(t *testing.T) {
+	job := emailLoginEmail(UserEmailLoginRequestResponse{
+		Email:     "user@example.com",
+		Code:      "ABC123",
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		LinkUrl:   "https://ubase.test/admin/login/email/verify?token=a&b",
+	})
+	if job.To != "user@example.com" {
+		t.Fatalf("unexpected recipient %q", job.To)
+	}
+	for _, body := range []string{job.TextBody, job.HtmlBody} {
+		if !strings.Contains(body, "ABC123") {
+			t.Fatalf("expected code in body: %s", body)
+		}
+	}
+	if !strings.Contains(job.TextBody, "token=a&b") {
+		t.Fatalf("expected link in text body: %s", job.TextBody)
+	}
+	if !strings.Contains(job.HtmlBody, "token=a&amp;b") {
+		t.Fatalf("expected escaped link in html body: %s", job.HtmlBody)
+	}
+
+	codeOnly := emailLoginEmail(UserEmailLoginRequestResponse{Email: "user@example.com", Code: "ABC123"})
+	if strings.Contains(codeOnly.TextBody, "directly") || strings.Contains(codeOnly.HtmlBody, "href") {
+		t.Fatal("expected no link without a magic link")
+	}
+}
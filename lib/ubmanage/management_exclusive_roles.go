@@ -0,0 +1,242 @@
+package ubmanage
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	evercore "github.com/kernelplex/evercore/base"
+	"github.com/kernelplex/ubase/lib/ubdata"
+	r "github.com/kernelplex/ubase/lib/ubresponse"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+	"github.com/kernelplex/ubase/lib/ubvalidation"
+)
+
+var (
+	errExclusiveRoleSetNoOrg    = errors.New("organization not found")
+	errExclusiveRoleSetRole     = errors.New("role does not belong to the organization")
+	errExclusiveRoleSetNotFound = errors.New("exclusive role set not found")
+)
+
+// exclusiveRoleError reports that a membership would give a user two roles
+// of an exclusive role set.
+type exclusiveRoleError struct {
+	set      string
+	role     string
+	heldRole string
+}
+
+func (e *exclusiveRoleError) Error() string {
+	return fmt.Sprintf("users cannot hold both %q and %q (exclusive role set %q)", e.heldRole, e.role, e.set)
+}
+
+// message is the validation message shown to whoever added the membership.
+func (e *exclusiveRoleError) message() string {
+	return fmt.Sprintf("The user holds %q, which cannot be combined with %q under the exclusive role set %q", e.heldRole, e.role, e.set)
+}
+
+// ExclusiveRoleViolation is a user holding more than one role of an exclusive
+// role set.
+type ExclusiveRoleViolation struct {
+	SetName         string
+	UserId          int64
+	UserEmail       string
+	UserDisplayName string
+	// Roles are the roles of the set the user holds.
+	Roles []ubdata.RoleRow
+}
+
+// checkExclusiveRoles returns an *exclusiveRoleError when adding the user to
+// the role would break one of the organization's exclusive role sets.
+// Scheduled memberships count as held.
+func (m *ManagementImpl) checkExclusiveRoles(ctx context.Context, etx evercore.EventStoreContext, userId int64, roleId int64) error {
+	role := RoleAggregate{}
+	if err := etx.LoadStateInto(&role, roleId); err != nil {
+		return fmt.Errorf("failed to load role: %w", err)
+	}
+	organization := OrganizationAggregate{}
+	if err := etx.LoadStateInto(&organization, role.State.OrganizationId); err != nil {
+		return fmt.Errorf("failed to load organization: %w", err)
+	}
+	if len(organization.State.ExclusiveRoleSets) == 0 {
+		return nil
+	}
+
+	held, err := m.dbadapter.GetUserOrganizationRoles(ctx, userId, role.State.OrganizationId)
+	if err != nil {
+		return fmt.Errorf("failed to get user organization roles: %w", err)
+	}
+	heldIds := make([]int64, 0, len(held))
+	for _, heldRole := range held {
+		heldIds = append(heldIds, heldRole.ID)
+	}
+	set, heldId, conflict := organization.State.exclusiveRoleConflict(roleId, heldIds)
+	if !conflict {
+		return nil
+	}
+	i := slices.IndexFunc(held, func(heldRole ubdata.RoleRow) bool { return heldRole.ID == heldId })
+	return &exclusiveRoleError{set: set.Name, role: role.State.Name, heldRole: held[i].Name}
+}
+
+func (m *ManagementImpl) OrganizationExclusiveRoleSetSave(ctx context.Context,
+	command OrganizationExclusiveRoleSetSaveCommand,
+	agent string) (r.Response[any], error) {
+
+	if ok, issues := command.Validate(); !ok {
+		return r.ValidationError[any](issues), nil
+	}
+
+	err := m.store.WithContext(
+		ctx,
+		func(etx evercore.EventStoreContext) error {
+			organization := OrganizationAggregate{}
+			if err := etx.LoadStateInto(&organization, command.OrganizationId); err != nil {
+				if MapEvercoreErrorToStatus(err) == ubstatus.NotFound {
+					return errExclusiveRoleSetNoOrg
+				}
+				return fmt.Errorf("failed to load organization: %w", err)
+			}
+
+			roleIds := make([]int64, 0, len(command.RoleIds))
+			for _, roleId := range command.RoleIds {
+				if slices.Contains(roleIds, roleId) {
+					continue
+				}
+				role := RoleAggregate{}
+				if err := etx.LoadStateInto(&role, roleId); err != nil {
+					if MapEvercoreErrorToStatus(err) == ubstatus.NotFound {
+						return errExclusiveRoleSetRole
+					}
+					return fmt.Errorf("failed to load role: %w", err)
+				}
+				if role.State.OrganizationId != command.OrganizationId || role.State.Deleted {
+					return errExclusiveRoleSetRole
+				}
+				roleIds = append(roleIds, roleId)
+			}
+
+			event := OrganizationExclusiveRoleSetSavedEvent{
+				Name:    strings.TrimSpace(command.Name),
+				RoleIds: roleIds,
+			}
+			if err := etx.ApplyEventTo(&organization, event, time.Now(), agent); err != nil {
+				return fmt.Errorf("failed to apply exclusive role set saved event: %w", err)
+			}
+			return nil
+		})
+
+	switch {
+	case errors.Is(err, errExclusiveRoleSetNoOrg):
+		return r.StatusError[any](ubstatus.NotFound, "Organization not found"), nil
+	case errors.Is(err, errExclusiveRoleSetRole):
+		tracker := ubvalidation.NewValidationTracker()
+		tracker.AddIssue("roleIds", "Roles must belong to the organization")
+		_, issues := tracker.Valid()
+		return r.ValidationError[any](issues), nil
+	case err != nil:
+		slog.Error("Error saving exclusive role set", "error", err)
+		return r.Error[any]("Error saving exclusive role set"), err
+	}
+	return r.SuccessAny(), nil
+}
+
+func (m *ManagementImpl) OrganizationExclusiveRoleSetRemove(ctx context.Context,
+	command OrganizationExclusiveRoleSetRemoveCommand,
+	agent string) (r.Response[any], error) {
+
+	if ok, issues := command.Validate(); !ok {
+		return r.ValidationError[any](issues), nil
+	}
+
+	err := m.store.WithContext(
+		ctx,
+		func(etx evercore.EventStoreContext) error {
+			organization := OrganizationAggregate{}
+			if err := etx.LoadStateInto(&organization, command.OrganizationId); err != nil {
+				if MapEvercoreErrorToStatus(err) == ubstatus.NotFound {
+					return errExclusiveRoleSetNoOrg
+				}
+				return fmt.Errorf("failed to load organization: %w", err)
+			}
+			if organization.State.ExclusiveRoleSet(command.Name) < 0 {
+				return errExclusiveRoleSetNotFound
+			}
+
+			event := OrganizationExclusiveRoleSetRemovedEvent{Name: command.Name}
+			if err := etx.ApplyEventTo(&organization, event, time.Now(), agent); err != nil {
+				return fmt.Errorf("failed to apply exclusive role set removed event: %w", err)
+			}
+			return nil
+		})
+
+	switch {
+	case errors.Is(err, errExclusiveRoleSetNoOrg):
+		return r.StatusError[any](ubstatus.NotFound, "Organization not found"), nil
+	case errors.Is(err, errExclusiveRoleSetNotFound):
+		return r.StatusError[any](ubstatus.NotFound, "Exclusive role set not found"), nil
+	case err != nil:
+		slog.Error("Error removing exclusive role set", "error", err)
+		return r.Error[any]("Error removing exclusive role set"), err
+	}
+	return r.SuccessAny(), nil
+}
+
+// OrganizationExclusiveRoleViolations lists the users holding more than one
+// role of each of the organization's exclusive role sets, by set and then
+// user.
+func (m *ManagementImpl) OrganizationExclusiveRoleViolations(ctx context.Context, organizationId int64) (r.Response[[]ExclusiveRoleViolation], error) {
+	organization, err := m.OrganizationGet(ctx, organizationId)
+	if err != nil || organization.Status != ubstatus.Success {
+		return r.StatusError[[]ExclusiveRoleViolation](organization.Status, organization.Message), err
+	}
+	roles, err := m.dbadapter.GetOrganizationRoles(ctx, organizationId)
+	if err != nil {
+		slog.Error("Error listing organization roles", "error", err)
+		return r.Error[[]ExclusiveRoleViolation]("Error listing exclusive role violations"), err
+	}
+
+	violations := []ExclusiveRoleViolation{}
+	for _, set := range organization.Data.State.ExclusiveRoleSets {
+		byUser := map[int64]*ExclusiveRoleViolation{}
+		for _, role := range roles {
+			if !slices.Contains(set.RoleIds, role.ID) {
+				continue
+			}
+			users, err := m.dbadapter.GetUsersInRole(ctx, role.ID)
+			if err != nil {
+				slog.Error("Error listing users in role", "error", err)
+				return r.Error[[]ExclusiveRoleViolation]("Error listing exclusive role violations"), err
+			}
+			for _, user := range users {
+				violation, ok := byUser[user.UserID]
+				if !ok {
+					violation = &ExclusiveRoleViolation{
+						SetName:         set.Name,
+						UserId:          user.UserID,
+						UserEmail:       user.Email,
+						UserDisplayName: user.DisplayName,
+					}
+					byUser[user.UserID] = violation
+				}
+				violation.Roles = append(violation.Roles, role)
+			}
+		}
+
+		setViolations := []ExclusiveRoleViolation{}
+		for _, violation := range byUser {
+			if len(violation.Roles) > 1 {
+				setViolations = append(setViolations, *violation)
+			}
+		}
+		slices.SortFunc(setViolations, func(a, b ExclusiveRoleViolation) int {
+			return cmp.Compare(a.UserId, b.UserId)
+		})
+		violations = append(violations, setViolations...)
+	}
+	return r.Success(violations), nil
+}
@@ -0,0 +1,358 @@
+package ubmanage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	evercore "github.com/kernelplex/evercore/base"
+	"github.com/kernelplex/ubase/lib/ubmailer"
+	r "github.com/kernelplex/ubase/lib/ubresponse"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+// Organization settings controlling login alerts. When a user belongs to
+// several organizations the strictest configuration applies.
+const (
+	// OrganizationSettingLoginAlertNewDevice is "true" or "false".
+	OrganizationSettingLoginAlertNewDevice = "login_alert_new_device"
+
+	// OrganizationSettingLoginAlertFailedAttempts is the number of failed
+	// attempts before a successful login that triggers an alert. Zero
+	// disables the alert.
+	OrganizationSettingLoginAlertFailedAttempts = "login_alert_failed_attempts"
+)
+
+// LoginReportPath is where the "this wasn't me" link in login alerts points.
+const LoginReportPath = "/admin/login/not-me"
+
+const (
+	defaultLoginAlertReportTTL = 7 * 24 * time.Hour
+	loginReportPurpose         = "login-report"
+)
+
+var errInvalidLoginReport = errors.New("invalid login report token")
+
+type LoginAlertOptions struct {
+	Enabled bool
+	Mailer  EmailSender
+
+	// BaseUrl is the externally visible address of the admin panel and is
+	// used to build the link in alert emails.
+	BaseUrl string
+
+	// NewDevice and FailedAttempts apply to organizations that do not
+	// configure the corresponding setting, and to users without any
+	// organization.
+	NewDevice      bool
+	FailedAttempts int64
+
+	// ReportTTL is how long the "this wasn't me" link stays valid.
+	ReportTTL time.Duration
+}
+
+func WithLoginAlertOptions(options LoginAlertOptions) ManagementOption {
+	return func(m *ManagementImpl) {
+		m.loginAlertOptions = options
+	}
+}
+
+// loginAlert carries what is needed to notify a user about a login once the
+// login transaction has been committed.
+type loginAlert struct {
+	UserId         int64
+	Email          string
+	OccurredAt     time.Time
+	Client         LoginClient
+	NewDevice      bool
+	FailedAttempts int64
+}
+
+type loginReportClaims struct {
+	Purpose   string `json:"purpose"`
+	UserId    int64  `json:"userId"`
+	LoginAt   int64  `json:"loginAt"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// deviceFingerprint identifies a device by its device cookie and user agent.
+// Clients without a device cookie cannot be recognised and have no
+// fingerprint.
+func deviceFingerprint(key []byte, client LoginClient) string {
+	if client.DeviceId == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(client.DeviceId))
+	mac.Write([]byte{0})
+	mac.Write([]byte(client.UserAgent))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// prepareLoginAlert inspects a login that has passed the password or code
+// check. When remember is set the client's device is added to the user's
+// known devices, and logins from a new device are flagged. The user's very
+// first device is remembered silently.
+func (m *ManagementImpl) prepareLoginAlert(ctx context.Context,
+	etx evercore.EventStoreContext,
+	aggregate *UserAggregate,
+	client LoginClient,
+	failedAttempts int64,
+	remember bool,
+	now time.Time,
+	agent string) (*loginAlert, error) {
+
+	client = normalizeLoginClient(client)
+	newDevice := false
+	if remember {
+		key, err := m.ensureUserDataKey(ctx, aggregate)
+		if err != nil {
+			return nil, err
+		}
+		fingerprint := deviceFingerprint(key, client)
+		if fingerprint != "" && !aggregate.State.knowsDevice(fingerprint) {
+			newDevice = len(aggregate.State.KnownDevices) > 0
+			err = etx.ApplyEventTo(aggregate, UserDeviceRememberedEvent{Fingerprint: fingerprint}, now, agent)
+			if err != nil {
+				return nil, fmt.Errorf("failed to apply device remembered event: %w", err)
+			}
+		}
+	}
+
+	if !newDevice && failedAttempts == 0 {
+		return nil, nil
+	}
+
+	pii, err := m.userPII(ctx, aggregate)
+	if err != nil {
+		return nil, err
+	}
+	return &loginAlert{
+		UserId:         aggregate.Id,
+		Email:          pii.Email,
+		OccurredAt:     now,
+		Client:         client,
+		NewDevice:      newDevice,
+		FailedAttempts: failedAttempts,
+	}, nil
+}
+
+func (s *UserState) knowsDevice(fingerprint string) bool {
+	for _, device := range s.KnownDevices {
+		if hmac.Equal([]byte(device.Fingerprint), []byte(fingerprint)) {
+			return true
+		}
+	}
+	return false
+}
+
+// loginAlertPolicyFor combines the login alert settings of the user's
+// organizations, falling back to the defaults for unset or invalid values.
+func loginAlertPolicyFor(settings []map[string]string, defaultNewDevice bool, defaultFailedAttempts int64) (bool, int64) {
+	if len(settings) == 0 {
+		return defaultNewDevice, defaultFailedAttempts
+	}
+
+	newDevice := false
+	var failedAttempts int64
+	for _, orgSettings := range settings {
+		orgNewDevice := defaultNewDevice
+		if value, ok := orgSettings[OrganizationSettingLoginAlertNewDevice]; ok {
+			if parsed, err := strconv.ParseBool(value); err == nil {
+				orgNewDevice = parsed
+			}
+		}
+		orgFailedAttempts := defaultFailedAttempts
+		if value, ok := orgSettings[OrganizationSettingLoginAlertFailedAttempts]; ok {
+			if parsed, err := strconv.ParseInt(value, 10, 64); err == nil && parsed >= 0 {
+				orgFailedAttempts = parsed
+			}
+		}
+
+		newDevice = newDevice || orgNewDevice
+		if orgFailedAttempts > 0 && (failedAttempts == 0 || orgFailedAttempts < failedAttempts) {
+			failedAttempts = orgFailedAttempts
+		}
+	}
+	return newDevice, failedAttempts
+}
+
+func (m *ManagementImpl) loginAlertPolicy(ctx context.Context, userId int64) (bool, int64) {
+	defaultNewDevice := m.loginAlertOptions.NewDevice
+	defaultFailedAttempts := m.loginAlertOptions.FailedAttempts
+
+	roles, err := m.dbadapter.GetAllUserOrganizationRoles(ctx, userId)
+	if err != nil {
+		slog.Error("Error getting user organizations for login alert", "error", err, "userId", userId)
+		return defaultNewDevice, defaultFailedAttempts
+	}
+
+	seen := make(map[int64]bool)
+	settings := make([]map[string]string, 0, len(roles))
+	for _, role := range roles {
+		if seen[role.OrganizationID] {
+			continue
+		}
+		seen[role.OrganizationID] = true
+
+		orgResp, err := m.OrganizationGet(ctx, role.OrganizationID)
+		if err != nil || orgResp.Status != ubstatus.Success {
+			slog.Error("Error getting organization for login alert", "error", err, "organizationId", role.OrganizationID)
+			continue
+		}
+		settings = append(settings, orgResp.Data.State.Settings)
+	}
+	return loginAlertPolicyFor(settings, defaultNewDevice, defaultFailedAttempts)
+}
+
+// sendLoginAlert emails the user about a login if their organizations' alert
+// settings call for it. Alerts are best effort and never fail the login.
+func (m *ManagementImpl) sendLoginAlert(ctx context.Context, alert *loginAlert) {
+	if alert == nil || !m.loginAlertOptions.Enabled || m.loginAlertOptions.Mailer == nil {
+		return
+	}
+	if alert.Email == "" {
+		return
+	}
+
+	newDevice, failedAttempts := m.loginAlertPolicy(ctx, alert.UserId)
+	notifyNewDevice := alert.NewDevice && newDevice
+	notifyFailedAttempts := failedAttempts > 0 && alert.FailedAttempts >= failedAttempts
+	if !notifyNewDevice && !notifyFailedAttempts {
+		return
+	}
+
+	token, err := m.loginReportToken(alert.UserId, alert.OccurredAt)
+	if err != nil {
+		slog.Error("Error creating login report token", "error", err, "userId", alert.UserId)
+		return
+	}
+	reportUrl := strings.TrimRight(m.loginAlertOptions.BaseUrl, "/") + LoginReportPath + "?token=" + url.QueryEscape(token)
+
+	m.loginAlertOptions.Mailer.Send(loginAlertEmail(alert, notifyNewDevice, notifyFailedAttempts, reportUrl))
+}
+
+func loginAlertEmail(alert *loginAlert, newDevice bool, failedAttempts bool, reportUrl string) ubmailer.EmailJob {
+	subject := "New sign-in to your account"
+	var body strings.Builder
+	if newDevice {
+		body.WriteString("Your account was just signed in to from a device we have not seen before.\n")
+	}
+	if failedAttempts {
+		if !newDevice {
+			subject = "Sign-in to your account after failed attempts"
+		}
+		fmt.Fprintf(&body, "The sign-in followed %d failed attempts.\n", alert.FailedAttempts)
+	}
+	body.WriteString("\n")
+	fmt.Fprintf(&body, "Time: %s\n", alert.OccurredAt.UTC().Format(time.RFC1123))
+	if alert.Client.IpAddress != "" {
+		fmt.Fprintf(&body, "IP address: %s\n", alert.Client.IpAddress)
+	}
+	if alert.Client.UserAgent != "" {
+		fmt.Fprintf(&body, "Browser: %s\n", alert.Client.UserAgent)
+	}
+	body.WriteString("\nIf this was you, you can ignore this email.\n")
+	body.WriteString("If this wasn't you, use the link below to disable your account and sign out everywhere:\n")
+	body.WriteString(reportUrl)
+	body.WriteString("\n")
+
+	return ubmailer.EmailJob{
+		To:       alert.Email,
+		Subject:  subject,
+		TextBody: body.String(),
+	}
+}
+
+func (m *ManagementImpl) loginReportToken(userId int64, loginAt time.Time) (string, error) {
+	claims := loginReportClaims{
+		Purpose:   loginReportPurpose,
+		UserId:    userId,
+		LoginAt:   loginAt.Unix(),
+		ExpiresAt: loginAt.Add(m.loginAlertOptions.ReportTTL).Unix(),
+	}
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal login report token: %w", err)
+	}
+	return m.encryptionService.Encrypt64(string(data))
+}
+
+func (m *ManagementImpl) parseLoginReportToken(token string) (loginReportClaims, error) {
+	data, err := m.encryptionService.Decrypt64(token)
+	if err != nil {
+		return loginReportClaims{}, errInvalidLoginReport
+	}
+	var claims loginReportClaims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return loginReportClaims{}, errInvalidLoginReport
+	}
+	if claims.Purpose != loginReportPurpose || claims.UserId <= 0 {
+		return loginReportClaims{}, errInvalidLoginReport
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		return loginReportClaims{}, errInvalidLoginReport
+	}
+	return claims, nil
+}
+
+func (m *ManagementImpl) UserReportUnrecognizedLogin(ctx context.Context,
+	command UserReportUnrecognizedLoginCommand,
+	agent string) (r.Response[any], error) {
+
+	if ok, issues := command.Validate(); !ok {
+		return r.ValidationError[any](issues), nil
+	}
+
+	claims, err := m.parseLoginReportToken(command.Token)
+	if err != nil {
+		return r.StatusError[any](ubstatus.NotAuthorized, "This link is invalid or has expired"), nil
+	}
+
+	err = m.store.WithContext(
+		ctx,
+		func(etx evercore.EventStoreContext) error {
+			aggregate := UserAggregate{}
+			err := loadActiveUserInto(etx, &aggregate, claims.UserId)
+			if err != nil {
+				return fmt.Errorf("failed to load user: %w", err)
+			}
+
+			// Sessions already revoked after the reported login mean the
+			// link has been used; repeating it would undo a later re-enable.
+			if aggregate.State.SessionsRevokedAt >= claims.LoginAt {
+				return nil
+			}
+
+			now := time.Now()
+			if !aggregate.State.Disabled {
+				err = etx.ApplyEventTo(&aggregate, UserDisabledEvent{}, now, agent)
+				if err != nil {
+					return fmt.Errorf("failed to apply user disabled event: %w", err)
+				}
+			}
+
+			err = etx.ApplyEventTo(&aggregate, UserSessionsRevokedEvent{Reason: "Login reported as unrecognized"}, now, agent)
+			if err != nil {
+				return fmt.Errorf("failed to apply sessions revoked event: %w", err)
+			}
+			return nil
+		})
+	if err != nil {
+		if errors.Is(err, errUserErased) {
+			return r.StatusError[any](ubstatus.NotAuthorized, "This link is invalid or has expired"), nil
+		}
+		slog.Error("Error reporting unrecognized login", "error", err)
+		return r.Error[any]("Error reporting unrecognized login"), err
+	}
+	return r.SuccessAny(), nil
+}
@@ -0,0 +1,115 @@
+package ubmanage
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubsecurity"
+)
+
+func TestDeviceFingerprint(t *testing.T) {
+	key := ubsecurity.GenerateSecureRandom(userDataKeyLength)
+	client := LoginClient{DeviceId: "0123456789abcdef0123456789abcdef", UserAgent: "agent"}
+
+	fingerprint := deviceFingerprint(key, client)
+	if fingerprint == "" || strings.Contains(fingerprint, client.DeviceId) {
+		t.Fatalf("expected keyed fingerprint, got %q", fingerprint)
+	}
+	if deviceFingerprint(key, client) != fingerprint {
+		t.Fatal("expected fingerprint to be stable")
+	}
+	if deviceFingerprint(key, LoginClient{DeviceId: client.DeviceId, UserAgent: "other"}) == fingerprint {
+		t.Fatal("expected user agent to change the fingerprint")
+	}
+	otherKey := ubsecurity.GenerateSecureRandom(userDataKeyLength)
+	if deviceFingerprint(otherKey, client) == fingerprint {
+		t.Fatal("expected fingerprint to depend on the user's key")
+	}
+	if deviceFingerprint(key, LoginClient{UserAgent: "agent"}) != "" {
+		t.Fatal("expected no fingerprint without a device id")
+	}
+}
+
+func TestLoginAlertPolicyFor(t *testing.T) {
+	newDevice, failed := loginAlertPolicyFor(nil, true, 5)
+	if !newDevice || failed != 5 {
+		t.Fatalf("expected defaults without organizations, got %v %d", newDevice, failed)
+	}
+
+	newDevice, failed = loginAlertPolicyFor([]map[string]string{
+		{OrganizationSettingLoginAlertNewDevice: "false", OrganizationSettingLoginAlertFailedAttempts: "0"},
+	}, true, 5)
+	if newDevice || failed != 0 {
+		t.Fatalf("expected organization to disable alerts, got %v %d", newDevice, failed)
+	}
+
+	// The strictest organization wins.
+	newDevice, failed = loginAlertPolicyFor([]map[string]string{
+		{OrganizationSettingLoginAlertNewDevice: "false", OrganizationSettingLoginAlertFailedAttempts: "0"},
+		{OrganizationSettingLoginAlertNewDevice: "true", OrganizationSettingLoginAlertFailedAttempts: "3"},
+		{OrganizationSettingLoginAlertFailedAttempts: "not-a-number"},
+	}, false, 5)
+	if !newDevice || failed != 3 {
+		t.Fatalf("expected strictest settings, got %v %d", newDevice, failed)
+	}
+}
+
+func TestLoginReportToken(t *testing.T) {
+	m := newPIITestManagement()
+	m.loginAlertOptions.ReportTTL = time.Hour
+
+	loginAt := time.Now()
+	token, err := m.loginReportToken(42, loginAt)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	claims, err := m.parseLoginReportToken(token)
+	if err != nil {
+		t.Fatalf("parse token: %v", err)
+	}
+	if claims.UserId != 42 || claims.LoginAt != loginAt.Unix() {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+
+	expired, err := m.loginReportToken(42, loginAt.Add(-2*time.Hour))
+	if err != nil {
+		t.Fatalf("create expired token: %v", err)
+	}
+	if _, err := m.parseLoginReportToken(expired); err == nil {
+		t.Fatal("expected expired token to be rejected")
+	}
+
+	// Other values encrypted with the same key are not report tokens.
+	other, _ := json.Marshal(map[string]any{"userId": 42, "expiresAt": loginAt.Add(time.Hour).Unix()})
+	encrypted, err := m.encryptionService.Encrypt64(string(other))
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if _, err := m.parseLoginReportToken(encrypted); err == nil {
+		t.Fatal("expected token without purpose to be rejected")
+	}
+	if _, err := m.parseLoginReportToken("bogus"); err == nil {
+		t.Fatal("expected garbage token to be rejected")
+	}
+}
+
+func TestLoginAlertEmail(t *testing.T) {
+	alert := &loginAlert{
+		Email:          "user@example.com",
+		OccurredAt:     time.Now(),
+		Client:         LoginClient{IpAddress: "203.0.113.9", UserAgent: "agent"},
+		NewDevice:      true,
+		FailedAttempts: 4,
+	}
+	job := loginAlertEmail(alert, true, true, "https://example.com/admin/login/not-me?token=abc")
+	if job.To != alert.Email {
+		t.Fatalf("unexpected recipient %q", job.To)
+	}
+	for _, want := range []string{"not seen before", "4 failed attempts", "203.0.113.9", "token=abc"} {
+		if !strings.Contains(job.TextBody, want) {
+			t.Fatalf("expected body to contain %q, got %q", want, job.TextBody)
+		}
+	}
+}
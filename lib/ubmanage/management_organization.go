@@ -2,6 +2,7 @@ package ubmanage
 
 import (
     "context"
+    "errors"
     "fmt"
     "log/slog"
     "time"
@@ -10,6 +11,7 @@ import (
     "github.com/kernelplex/ubase/lib/ubdata"
     r "github.com/kernelplex/ubase/lib/ubresponse"
     "github.com/kernelplex/ubase/lib/ubstatus"
+    "github.com/kernelplex/ubase/lib/ubvalidation"
 )
 
 func (m *ManagementImpl) OrganizationList(ctx context.Context) (r.Response[[]ubdata.Organization], error) {
@@ -30,6 +32,12 @@ func (m *ManagementImpl) OrganizationAdd(ctx context.Context,
 
 	// Validation
 	ok, issues := command.Validate()
+	if ok && command.ApplyRoleTemplates {
+		if templateIssues := m.roleTemplateIssues("applyRoleTemplates"); len(templateIssues) > 0 {
+			ok = false
+			issues = append(issues, templateIssues...)
+		}
+	}
 	if !ok {
 		return r.ValidationError[IdValue](issues), nil
 	}
@@ -38,6 +46,21 @@ func (m *ManagementImpl) OrganizationAdd(ctx context.Context,
 		ctx,
 		m.store,
 		func(etx evercore.EventStoreContext) (int64, error) {
+			if command.ApplyRoleTemplates {
+				// The new organization has no roles, so any role already
+				// holding a templated system name belongs to another.
+				for _, template := range m.roleTemplates {
+					systemName := template.SystemNameFor(command.SystemName)
+					err := etx.LoadStateByKeyInto(&RoleAggregate{}, systemName)
+					switch {
+					case err == nil:
+						return 0, fmt.Errorf("%w: %s", errRoleTemplateSystemName, systemName)
+					case MapEvercoreErrorToStatus(err) != ubstatus.NotFound:
+						return 0, fmt.Errorf("failed to load role: %w", err)
+					}
+				}
+			}
+
 			aggregate := OrganizationAggregate{}
 			err := etx.CreateAggregateWithKeyInto(&aggregate, command.SystemName)
 			if err != nil {
@@ -59,9 +82,23 @@ func (m *ManagementImpl) OrganizationAdd(ctx context.Context,
 				return 0, fmt.Errorf("failed to add organization in database: %w", err)
 			}
 
+			if command.ApplyRoleTemplates {
+				changes := roleTemplateDiff(m.roleTemplates, aggregate.Id, aggregate.State.SystemName, map[string]*RoleAggregate{}, false)
+				err = m.applyRoleTemplateChanges(ctx, etx, changes, map[string]*RoleAggregate{}, agent)
+				if err != nil {
+					return 0, fmt.Errorf("failed to apply role templates: %w", err)
+				}
+			}
+
 			return aggregate.Id, nil
 		})
 
+	if errors.Is(err, errRoleTemplateSystemName) {
+		tracker := ubvalidation.NewValidationTracker()
+		tracker.AddIssue("applyRoleTemplates", err.Error())
+		_, issues := tracker.Valid()
+		return r.ValidationError[IdValue](issues), nil
+	}
 	if err != nil {
 		status := MapEvercoreErrorToStatus(err)
 		slog.Error("Error creating organization", "error", err)
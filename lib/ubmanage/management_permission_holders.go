@@ -0,0 +1,119 @@
+package ubmanage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	evercore "github.com/kernelplex/evercore/base"
+	"github.com/kernelplex/ubase/lib/ubdata"
+	"github.com/kernelplex/ubase/lib/ubpolicy"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+// userHoldsPermission reports whether the user holds the permission in the
+// organization at now, by the rules PrefectService applies: only active
+// memberships of the organization's roles count, and a permission a role
+// grants under a policy is only held when the policy allows a request made at
+// now. It reads the event store directly, so it also works where the prefect
+// service is not running, and disabled or erased users hold nothing.
+func (m *ManagementImpl) userHoldsPermission(ctx context.Context,
+	etx evercore.EventStoreReadonlyContext,
+	userId int64,
+	orgId int64,
+	permission string,
+	now time.Time) (bool, error) {
+
+	user := UserAggregate{}
+	if err := etx.LoadStateInto(&user, userId); err != nil {
+		if MapEvercoreErrorToStatus(err) == ubstatus.NotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to load user: %w", err)
+	}
+	state := user.State
+	if state.Disabled || state.Erased || (state.ServiceAccount && state.OwnerOrganizationId != orgId) {
+		return false, nil
+	}
+
+	unconditional, policies, err := m.permissionGrants(ctx, etx, userId, orgId, permission, now)
+	if err != nil {
+		return false, err
+	}
+	if unconditional {
+		return true, nil
+	}
+	if len(policies) == 0 {
+		return false, nil
+	}
+
+	organization := OrganizationAggregate{}
+	if err := etx.LoadStateInto(&organization, orgId); err != nil {
+		return false, fmt.Errorf("failed to load organization: %w", err)
+	}
+	attributes := PolicyAttributes(userId, orgId, PolicyInput{Time: now}, state.Settings, organization.State.Settings)
+	return anyPolicyAllows(policies, attributes, userId, orgId, permission), nil
+}
+
+// permissionGrants reports how the roles the user is an active member of in
+// the organization at now grant the permission: unconditionally, or under
+// each of the returned policies.
+func (m *ManagementImpl) permissionGrants(ctx context.Context,
+	etx evercore.EventStoreReadonlyContext,
+	userId int64,
+	orgId int64,
+	permission string,
+	now time.Time) (bool, []*ubpolicy.Policy, error) {
+
+	memberships, err := m.dbadapter.GetAllUserOrganizationRoles(ctx, userId)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+	var policies []*ubpolicy.Policy
+	for _, membership := range memberships {
+		window := RoleWindow{NotBefore: membership.NotBefore, ExpiresAt: membership.ExpiresAt}
+		if membership.OrganizationID != orgId || !window.activeAt(now.Unix()) {
+			continue
+		}
+		role := RoleAggregate{}
+		if err := etx.LoadStateInto(&role, membership.RoleID); err != nil {
+			return false, nil, fmt.Errorf("failed to load role: %w", err)
+		}
+		if role.State.Deleted || !slices.Contains(role.State.Permissions, permission) {
+			continue
+		}
+		source, conditional := role.State.Policies[permission]
+		if !conditional {
+			return true, nil, nil
+		}
+		policies = append(policies, compileRolePolicies(role.Id, map[string]string{permission: source})[permission])
+	}
+	return false, policies, nil
+}
+
+// organizationUsersHoldingPermission lists the users of the organization who
+// hold the permission at now according to userHoldsPermission.
+func (m *ManagementImpl) organizationUsersHoldingPermission(ctx context.Context,
+	etx evercore.EventStoreReadonlyContext,
+	orgId int64,
+	permission string,
+	now time.Time) ([]ubdata.UserEmail, error) {
+
+	// Users granted the permission by a role, whatever its policy says.
+	candidates, err := m.dbadapter.ListOrganizationUsersWithPermission(ctx, orgId, permission, now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users with permission: %w", err)
+	}
+	holders := []ubdata.UserEmail{}
+	for _, candidate := range candidates {
+		held, err := m.userHoldsPermission(ctx, etx, candidate.UserID, orgId, permission, now)
+		if err != nil {
+			return nil, err
+		}
+		if held {
+			holders = append(holders, candidate)
+		}
+	}
+	return holders, nil
+}
@@ -0,0 +1,73 @@
+package ubmanage
+
+import (
+	"context"
+	"slices"
+
+	r "github.com/kernelplex/ubase/lib/ubresponse"
+	"github.com/kernelplex/ubase/lib/ubvalidation"
+)
+
+// HeldPermission is a permission held by a role.
+type HeldPermission struct {
+	OrganizationId int64  `json:"organization_id"`
+	RoleId         int64  `json:"role_id"`
+	RoleName       string `json:"role_name"`
+	Permission     string `json:"permission"`
+}
+
+// PermissionReport compares the permissions held by roles with the
+// permission catalog.
+type PermissionReport struct {
+	// Unknown are permissions held by roles which the catalog does not
+	// declare, typically because no code checks them any more.
+	Unknown []HeldPermission `json:"unknown"`
+	// Unused are declared permissions which no role holds.
+	Unused []PermissionDefinition `json:"unused"`
+}
+
+func (m *ManagementImpl) PermissionReport(ctx context.Context) (r.Response[PermissionReport], error) {
+	if m.permissionCatalog == nil || len(m.permissionCatalog.Definitions()) == 0 {
+		return r.ValidationError[PermissionReport]([]ubvalidation.ValidationIssue{
+			{Field: "catalog", Error: []string{"No permissions are declared"}},
+		}), nil
+	}
+
+	organizations, err := m.dbadapter.ListOrganizations(ctx)
+	if err != nil {
+		return r.Error[PermissionReport]("Error listing organizations"), err
+	}
+
+	report := PermissionReport{Unknown: []HeldPermission{}, Unused: []PermissionDefinition{}}
+	held := map[string]bool{}
+	for _, organization := range organizations {
+		roles, err := m.dbadapter.GetOrganizationRoles(ctx, organization.ID)
+		if err != nil {
+			return r.Error[PermissionReport]("Error listing roles"), err
+		}
+		for _, role := range roles {
+			permissions, err := m.dbadapter.GetRolePermissions(ctx, role.ID)
+			if err != nil {
+				return r.Error[PermissionReport]("Error listing role permissions"), err
+			}
+			slices.Sort(permissions)
+			for _, permission := range permissions {
+				held[permission] = true
+				if _, found := m.permissionCatalog.Lookup(permission); !found {
+					report.Unknown = append(report.Unknown, HeldPermission{
+						OrganizationId: organization.ID,
+						RoleId:         role.ID,
+						RoleName:       role.Name,
+						Permission:     permission,
+					})
+				}
+			}
+		}
+	}
+	for _, definition := range m.permissionCatalog.Definitions() {
+		if !held[definition.Name] {
+			report.Unused = append(report.Unused, definition)
+		}
+	}
+	return r.Success(report), nil
+}
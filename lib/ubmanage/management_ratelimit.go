@@ -0,0 +1,61 @@
+package ubmanage
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/kernelplex/ubase/lib/ubratelimit"
+)
+
+// RateLimiter decides whether another attempt is allowed for a key.
+// *ubratelimit.Limiter satisfies it.
+type RateLimiter interface {
+	Allow(ctx context.Context, key string) (ubratelimit.Decision, error)
+}
+
+// RateLimitOptions throttles authentication attempts per account, in addition
+// to any per-IP limits applied by the web layer. Nil limiters are disabled.
+type RateLimitOptions struct {
+	// Login limits password attempts per email address.
+	Login RateLimiter
+
+	// CodeVerification limits email login and two factor code attempts per
+	// account, so short codes cannot be guessed online.
+	CodeVerification RateLimiter
+}
+
+func WithRateLimitOptions(options RateLimitOptions) ManagementOption {
+	return func(m *ManagementImpl) {
+		m.rateLimitOptions = options
+	}
+}
+
+const rateLimitedMessage = "Too many attempts. Try again later."
+
+func emailRateLimitKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func userRateLimitKey(userId int64) string {
+	return "user:" + strconv.FormatInt(userId, 10)
+}
+
+// rateLimited records an attempt for key and returns the number of seconds
+// to wait when the attempt is over the limit, or zero when it is allowed.
+// Errors from the limiter are treated as over the limit.
+func rateLimited(ctx context.Context, limiter RateLimiter, key string) int64 {
+	if limiter == nil {
+		return 0
+	}
+	decision, err := limiter.Allow(ctx, key)
+	if err != nil {
+		slog.Error("Error checking rate limit", "error", err)
+		return 1
+	}
+	if decision.Allowed {
+		return 0
+	}
+	return ubratelimit.RetryAfterSeconds(decision.RetryAfter)
+}
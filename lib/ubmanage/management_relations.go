@@ -0,0 +1,130 @@
+package ubmanage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	evercore "github.com/kernelplex/evercore/base"
+	"github.com/kernelplex/ubase/lib/ubdata"
+	r "github.com/kernelplex/ubase/lib/ubresponse"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+var errRelationTupleNotFound = errors.New("relation tuple not found")
+
+func (m *ManagementImpl) RelationTupleWrite(ctx context.Context,
+	command RelationTupleWriteCommand,
+	agent string) (r.Response[any], error) {
+
+	ok, issues := command.Validate()
+	if !ok {
+		return r.ValidationError[any](issues), nil
+	}
+
+	err := m.store.WithContext(
+		ctx,
+		func(etx evercore.EventStoreContext) error {
+			aggregate := RelationsAggregate{}
+			_, err := etx.LoadOrCreateAggregate(&aggregate, relationsAggregateKey(command.ObjectType, command.ObjectId))
+			if err != nil {
+				return fmt.Errorf("failed to load relations: %w", err)
+			}
+
+			event := RelationTupleWrittenEvent(command)
+			if aggregate.Holds(event.grant()) {
+				return nil
+			}
+			err = etx.ApplyEventTo(&aggregate, event, time.Now(), agent)
+			if err != nil {
+				return fmt.Errorf("failed to apply relation tuple written event: %w", err)
+			}
+
+			err = m.dbadapter.AddRelationTuple(ctx, command.tuple())
+			if err != nil {
+				return fmt.Errorf("failed to add relation tuple in database: %w", err)
+			}
+			return nil
+		})
+
+	if err != nil {
+		status := MapEvercoreErrorToStatus(err)
+		slog.Error("Error writing relation tuple", "tuple", FormatRelationTuple(command.tuple()), "error", err)
+		return r.StatusError[any](status, "Error writing relation tuple"), err
+	}
+
+	return r.SuccessAny(), nil
+}
+
+func (m *ManagementImpl) RelationTupleDelete(ctx context.Context,
+	command RelationTupleDeleteCommand,
+	agent string) (r.Response[any], error) {
+
+	ok, issues := command.Validate()
+	if !ok {
+		return r.ValidationError[any](issues), nil
+	}
+
+	err := m.store.WithContext(
+		ctx,
+		func(etx evercore.EventStoreContext) error {
+			aggregate := RelationsAggregate{}
+			err := etx.LoadStateByKeyInto(&aggregate, relationsAggregateKey(command.ObjectType, command.ObjectId))
+			if err != nil {
+				return fmt.Errorf("failed to load relations: %w", err)
+			}
+
+			event := RelationTupleDeletedEvent(command)
+			if !aggregate.Holds(event.grant()) {
+				return errRelationTupleNotFound
+			}
+			err = etx.ApplyEventTo(&aggregate, event, time.Now(), agent)
+			if err != nil {
+				return fmt.Errorf("failed to apply relation tuple deleted event: %w", err)
+			}
+
+			err = m.dbadapter.DeleteRelationTuple(ctx, command.tuple())
+			if err != nil {
+				return fmt.Errorf("failed to delete relation tuple in database: %w", err)
+			}
+			return nil
+		})
+
+	switch {
+	case err == nil:
+		return r.SuccessAny(), nil
+	case errors.Is(err, errRelationTupleNotFound):
+		return r.StatusError[any](ubstatus.NotFound, "Relation tuple not found"), nil
+	}
+	status := MapEvercoreErrorToStatus(err)
+	if status == ubstatus.NotFound {
+		return r.StatusError[any](status, "Relation tuple not found"), nil
+	}
+	slog.Error("Error deleting relation tuple", "tuple", FormatRelationTuple(command.tuple()), "error", err)
+	return r.StatusError[any](status, "Error deleting relation tuple"), err
+}
+
+func (m *ManagementImpl) RelationTuplesByObject(ctx context.Context,
+	objectType string,
+	objectId string) (r.Response[[]ubdata.RelationTuple], error) {
+
+	tuples, err := m.dbadapter.ListRelationTuplesByObject(ctx, objectType, objectId)
+	if err != nil {
+		return r.Error[[]ubdata.RelationTuple]("Error listing relation tuples"), err
+	}
+	return r.Success(tuples), nil
+}
+
+func (m *ManagementImpl) RelationTuplesBySubject(ctx context.Context,
+	subjectType string,
+	subjectId string,
+	subjectRelation string) (r.Response[[]ubdata.RelationTuple], error) {
+
+	tuples, err := m.dbadapter.ListRelationTuplesBySubject(ctx, subjectType, subjectId, subjectRelation)
+	if err != nil {
+		return r.Error[[]ubdata.RelationTuple]("Error listing relation tuples"), err
+	}
+	return r.Success(tuples), nil
+}
@@ -0,0 +1,219 @@
+package ubmanage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	evercore "github.com/kernelplex/evercore/base"
+	r "github.com/kernelplex/ubase/lib/ubresponse"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+	"github.com/kernelplex/ubase/lib/ubvalidation"
+)
+
+var (
+	errRoleTemplateNoOrg      = errors.New("organization not found")
+	errRoleTemplateSystemName = errors.New("role system name belongs to another organization")
+)
+
+// WithRoleTemplates sets the roles created in new organizations and pushed to
+// existing ones by RoleTemplatesSync.
+func WithRoleTemplates(templates ...RoleTemplate) ManagementOption {
+	return func(m *ManagementImpl) {
+		m.roleTemplates = append(m.roleTemplates, templates...)
+	}
+}
+
+// RoleTemplates returns the configured role templates.
+func (m *ManagementImpl) RoleTemplates() []RoleTemplate {
+	return m.roleTemplates
+}
+
+// roleTemplateIssues reports missing templates and template permissions the
+// catalog does not allow.
+func (m *ManagementImpl) roleTemplateIssues(field string) []ubvalidation.ValidationIssue {
+	tracker := ubvalidation.NewValidationTracker()
+	if len(m.roleTemplates) == 0 {
+		tracker.AddIssue(field, "No role templates are configured")
+	}
+	if m.permissionCatalog != nil {
+		for _, template := range m.roleTemplates {
+			for _, permission := range template.Permissions {
+				if !m.permissionCatalog.Allows(permission) {
+					tracker.AddIssue(field, fmt.Sprintf("Unknown permission %s in role template %q", permission, template.Name))
+				}
+			}
+		}
+	}
+	_, issues := tracker.Valid()
+	return issues
+}
+
+// organizationRoleTemplateChanges lists the changes a sync makes to the
+// organization, along with its roles by system name.
+func (m *ManagementImpl) organizationRoleTemplateChanges(ctx context.Context,
+	etx evercore.EventStoreContext,
+	organizationId int64,
+	organizationSystemName string,
+	prune bool) ([]RoleTemplateChange, map[string]*RoleAggregate, error) {
+
+	rows, err := m.dbadapter.GetOrganizationRoles(ctx, organizationId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get organization roles: %w", err)
+	}
+	roles := make(map[string]*RoleAggregate, len(rows))
+	for _, row := range rows {
+		role := &RoleAggregate{}
+		if err := etx.LoadStateInto(role, row.ID); err != nil {
+			return nil, nil, fmt.Errorf("failed to load role: %w", err)
+		}
+		roles[row.SystemName] = role
+	}
+
+	// Deleted roles are gone from the read model but keep their system name.
+	for _, template := range m.roleTemplates {
+		systemName := template.SystemNameFor(organizationSystemName)
+		if _, found := roles[systemName]; found {
+			continue
+		}
+		role := &RoleAggregate{}
+		err := etx.LoadStateByKeyInto(role, systemName)
+		switch {
+		case MapEvercoreErrorToStatus(err) == ubstatus.NotFound:
+			continue
+		case err != nil:
+			return nil, nil, fmt.Errorf("failed to load role: %w", err)
+		case role.State.OrganizationId != organizationId:
+			return nil, nil, fmt.Errorf("%w: %s", errRoleTemplateSystemName, systemName)
+		}
+		roles[systemName] = role
+	}
+
+	return roleTemplateDiff(m.roleTemplates, organizationId, organizationSystemName, roles, prune), roles, nil
+}
+
+// applyRoleTemplateChanges makes the changes as part of the caller's
+// transaction, filling in the ids of the roles it creates.
+func (m *ManagementImpl) applyRoleTemplateChanges(ctx context.Context,
+	etx evercore.EventStoreContext,
+	changes []RoleTemplateChange,
+	roles map[string]*RoleAggregate,
+	agent string) error {
+
+	now := time.Now()
+	for i, change := range changes {
+		switch change.Action {
+		case RoleTemplateCreate:
+			role, err := m.addRole(ctx, etx, RoleCreateCommand{
+				Name:           change.Value,
+				SystemName:     change.RoleSystemName,
+				OrganizationId: change.OrganizationId,
+			}, agent)
+			if err != nil {
+				return err
+			}
+			roles[change.RoleSystemName] = role
+			changes[i].RoleId = role.Id
+		case RoleTemplateRename:
+			role := roles[change.RoleSystemName]
+			event := evercore.NewStateEvent(RoleUpdatedEvent{Id: role.Id, Name: &change.Value})
+			if err := etx.ApplyEventTo(role, event, now, agent); err != nil {
+				return fmt.Errorf("failed to apply role updated event: %w", err)
+			}
+			if err := m.dbadapter.UpdateRole(ctx, role.Id, role.State.Name, role.State.SystemName); err != nil {
+				return fmt.Errorf("failed to update role in database: %w", err)
+			}
+		case RoleTemplateGrant, RoleTemplateRevoke:
+			role := roles[change.RoleSystemName]
+			changes[i].RoleId = role.Id
+			err := m.applyRolePermissionChange(ctx, etx, role, RolePermissionChange{
+				RoleId:     role.Id,
+				Permission: change.Value,
+				Grant:      change.Action == RoleTemplateGrant,
+			}, now, agent)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RoleTemplatesSync brings the roles of existing organizations in line with
+// the role templates, returning the changes. With DryRun set the changes are
+// only listed.
+func (m *ManagementImpl) RoleTemplatesSync(ctx context.Context,
+	command RoleTemplatesSyncCommand,
+	agent string) (r.Response[[]RoleTemplateChange], error) {
+
+	ok, issues := command.Validate()
+	if ok {
+		if templateIssues := m.roleTemplateIssues("templates"); len(templateIssues) > 0 {
+			ok = false
+			issues = append(issues, templateIssues...)
+		}
+	}
+	if !ok {
+		return r.ValidationError[[]RoleTemplateChange](issues), nil
+	}
+
+	changes := []RoleTemplateChange{}
+	err := m.store.WithContext(
+		ctx,
+		func(etx evercore.EventStoreContext) error {
+			organizations := map[int64]string{}
+			ids := command.OrganizationIds
+			if len(ids) == 0 {
+				rows, err := m.dbadapter.ListOrganizations(ctx)
+				if err != nil {
+					return fmt.Errorf("failed to list organizations: %w", err)
+				}
+				for _, row := range rows {
+					ids = append(ids, row.ID)
+					organizations[row.ID] = row.SystemName
+				}
+			}
+
+			for _, id := range ids {
+				systemName, found := organizations[id]
+				if !found {
+					organization := OrganizationAggregate{}
+					if err := etx.LoadStateInto(&organization, id); err != nil {
+						if MapEvercoreErrorToStatus(err) == ubstatus.NotFound {
+							return errRoleTemplateNoOrg
+						}
+						return fmt.Errorf("failed to load organization: %w", err)
+					}
+					systemName = organization.State.SystemName
+				}
+
+				orgChanges, roles, err := m.organizationRoleTemplateChanges(ctx, etx, id, systemName, command.Prune)
+				if err != nil {
+					return err
+				}
+				if !command.DryRun {
+					if err := m.applyRoleTemplateChanges(ctx, etx, orgChanges, roles, agent); err != nil {
+						return err
+					}
+				}
+				changes = append(changes, orgChanges...)
+			}
+			return nil
+		})
+
+	switch {
+	case errors.Is(err, errRoleTemplateNoOrg):
+		return r.StatusError[[]RoleTemplateChange](ubstatus.NotFound, "Organization not found"), nil
+	case errors.Is(err, errRoleTemplateSystemName):
+		tracker := ubvalidation.NewValidationTracker()
+		tracker.AddIssue("templates", err.Error())
+		_, issues := tracker.Valid()
+		return r.ValidationError[[]RoleTemplateChange](issues), nil
+	case err != nil:
+		slog.Error("Error syncing role templates", "error", err)
+		return r.Error[[]RoleTemplateChange]("Error syncing role templates"), err
+	}
+	return r.Success(changes), nil
+}
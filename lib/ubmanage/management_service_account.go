@@ -0,0 +1,144 @@
+package ubmanage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	evercore "github.com/kernelplex/evercore/base"
+	"github.com/kernelplex/ubase/lib/ubdata"
+	r "github.com/kernelplex/ubase/lib/ubresponse"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+	"github.com/kernelplex/ubase/lib/ubvalidation"
+)
+
+// Service accounts are user aggregates without an email, password or login.
+// They are owned by an organization and only hold API keys and roles in it,
+// so role membership, API keys, disabling and erasure all go through the
+// regular user operations.
+
+const serviceAccountKeyPrefix = "service-account:"
+
+var (
+	errServiceAccount             = errors.New("operation is not supported for service accounts")
+	errServiceAccountOrganization = errors.New("service account does not belong to this organization")
+	errServiceAccountNoOrg        = errors.New("organization does not exist")
+)
+
+type ServiceAccountCreateCommand struct {
+	OrganizationId int64  `json:"organizationId"`
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+}
+
+func (c ServiceAccountCreateCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	validationTracker := ubvalidation.NewValidationTracker()
+
+	validationTracker.ValidateIntMinValue("organizationId", c.OrganizationId, 1)
+	validationTracker.ValidateField("name", strings.TrimSpace(c.Name), true, 0)
+	validationTracker.ValidateMaxLength("name", c.Name, 100)
+	validationTracker.ValidateMaxLength("description", c.Description, 500)
+
+	return validationTracker.Valid()
+}
+
+// serviceAccountKey is the aggregate key of a service account. It is also
+// stored in place of the email, which keeps names unique per organization
+// and can never match an email address.
+func serviceAccountKey(organizationId int64, name string) string {
+	return fmt.Sprintf("%s%d:%s", serviceAccountKeyPrefix, organizationId, strings.ToLower(strings.TrimSpace(name)))
+}
+
+// checkServiceAccountRole rejects roles outside the organization that owns a
+// service account. Other users may hold roles in any organization.
+func checkServiceAccountRole(etx evercore.EventStoreContext, userId int64, roleId int64) error {
+	user := UserAggregate{}
+	if err := etx.LoadStateInto(&user, userId); err != nil {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+	if !user.State.ServiceAccount {
+		return nil
+	}
+
+	role := RoleAggregate{}
+	if err := etx.LoadStateInto(&role, roleId); err != nil {
+		return fmt.Errorf("failed to load role: %w", err)
+	}
+	if role.State.OrganizationId != user.State.OwnerOrganizationId {
+		return errServiceAccountOrganization
+	}
+	return nil
+}
+
+func (m *ManagementImpl) ServiceAccountAdd(ctx context.Context,
+	command ServiceAccountCreateCommand,
+	agent string) (r.Response[IdValue], error) {
+
+	if ok, issues := command.Validate(); !ok {
+		return r.ValidationError[IdValue](issues), nil
+	}
+	name := strings.TrimSpace(command.Name)
+
+	id, err := evercore.InContext(
+		ctx,
+		m.store,
+		func(etx evercore.EventStoreContext) (int64, error) {
+			organization := OrganizationAggregate{}
+			err := etx.LoadStateInto(&organization, command.OrganizationId)
+			if err != nil {
+				if MapEvercoreErrorToStatus(err) == ubstatus.NotFound {
+					return 0, errServiceAccountNoOrg
+				}
+				return 0, fmt.Errorf("failed to load organization: %w", err)
+			}
+
+			key := serviceAccountKey(command.OrganizationId, name)
+			aggregate := UserAggregate{}
+			err = etx.CreateAggregateWithKeyInto(&aggregate, key)
+			if err != nil {
+				return 0, fmt.Errorf("failed to create aggregate: %w", err)
+			}
+
+			event := ServiceAccountAddedEvent{
+				OrganizationId: command.OrganizationId,
+				Name:           name,
+				Description:    command.Description,
+			}
+			err = etx.ApplyEventTo(&aggregate, event, time.Now(), agent)
+			if err != nil {
+				return 0, fmt.Errorf("failed to apply service account added event: %w", err)
+			}
+
+			err = m.dbadapter.AddServiceAccount(ctx, aggregate.Id, command.OrganizationId, name, key, aggregate.State.CreatedAt)
+			if err != nil {
+				return 0, fmt.Errorf("failed to add service account in database: %w", err)
+			}
+			return aggregate.Id, nil
+		})
+
+	if err != nil {
+		if errors.Is(err, errServiceAccountNoOrg) {
+			return r.StatusError[IdValue](ubstatus.NotFound, "Organization not found"), nil
+		}
+		status := MapEvercoreErrorToStatus(err)
+		if status == ubstatus.AlreadyExists {
+			return r.StatusError[IdValue](status, "A service account with this name already exists in the organization"), nil
+		}
+		slog.Error("Error creating service account", "error", err)
+		return r.StatusError[IdValue](status, "Error creating service account"), err
+	}
+
+	return r.Success(IdValue{Id: id}), nil
+}
+
+func (m *ManagementImpl) ServiceAccountList(ctx context.Context, organizationId int64) (r.Response[[]ubdata.ServiceAccount], error) {
+	accounts, err := m.dbadapter.ListServiceAccounts(ctx, organizationId)
+	if err != nil {
+		slog.Error("Error listing service accounts", "error", err)
+		return r.Error[[]ubdata.ServiceAccount]("Error listing service accounts"), err
+	}
+	return r.Success(accounts), nil
+}
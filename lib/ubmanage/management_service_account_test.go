@@ -0,0 +1,50 @@
+package ubmanage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestServiceAccountAddedEvent(t *testing.T) {
+	now := time.Now()
+	agg := &UserAggregate{}
+	event := ServiceAccountAddedEvent{OrganizationId: 7, Name: "Nightly Export", Description: "Exports reports"}
+	if err := agg.ApplyEventState(event, now, "tester"); err != nil {
+		t.Fatalf("apply service account added: %v", err)
+	}
+
+	state := agg.State
+	if !state.ServiceAccount || state.OwnerOrganizationId != 7 {
+		t.Fatalf("expected a service account owned by org 7, got %+v", state)
+	}
+	if state.DisplayName != "Nightly Export" || state.Description != "Exports reports" {
+		t.Fatalf("unexpected name or description: %+v", state)
+	}
+	if state.Email != "" || state.PasswordHash != "" {
+		t.Fatal("expected no email or password")
+	}
+	if state.CreatedAt != now.Unix() {
+		t.Fatalf("expected created at %d, got %d", now.Unix(), state.CreatedAt)
+	}
+}
+
+func TestServiceAccountKey(t *testing.T) {
+	if key := serviceAccountKey(7, "  Nightly Export "); key != "service-account:7:nightly export" {
+		t.Fatalf("unexpected key %q", key)
+	}
+	if serviceAccountKey(7, "export") == serviceAccountKey(8, "export") {
+		t.Fatal("expected keys to differ between organizations")
+	}
+}
+
+func TestServiceAccountCreateCommandValidate(t *testing.T) {
+	if ok, _ := (ServiceAccountCreateCommand{OrganizationId: 1, Name: "Export"}).Validate(); !ok {
+		t.Fatal("expected command to be valid")
+	}
+	if ok, _ := (ServiceAccountCreateCommand{Name: "Export"}).Validate(); ok {
+		t.Fatal("expected missing organization to be invalid")
+	}
+	if ok, _ := (ServiceAccountCreateCommand{OrganizationId: 1, Name: "   "}).Validate(); ok {
+		t.Fatal("expected blank name to be invalid")
+	}
+}
@@ -25,6 +25,13 @@ func (f *fakeDB) SearchUsers(ctx context.Context, searchTerm string, limit, offs
 func (f *fakeDB) UpdateUser(ctx context.Context, userID int64, firstName, lastName, displayName, email string, verified bool, updatedAt int64) error {
     return nil
 }
+func (f *fakeDB) DeleteUser(ctx context.Context, userID int64) error { return nil }
+func (f *fakeDB) AddServiceAccount(ctx context.Context, userID int64, organizationID int64, name, key string, createdAt int64) error {
+    return nil
+}
+func (f *fakeDB) ListServiceAccounts(ctx context.Context, organizationID int64) ([]ubdata.ServiceAccount, error) {
+    return nil, nil
+}
 func (f *fakeDB) AddOrganization(ctx context.Context, id int64, name string, systemName string, status string) error { return nil }
 func (f *fakeDB) GetOrganization(ctx context.Context, organizationID int64) (ubdata.Organization, error) {
     return ubdata.Organization{}, nil
@@ -41,7 +48,12 @@ func (f *fakeDB) GetOrganizationRoles(ctx context.Context, organizationID int64)
 func (f *fakeDB) AddPermissionToRole(ctx context.Context, roleID int64, permission string) error { return nil }
 func (f *fakeDB) RemovePermissionFromRole(ctx context.Context, roleID int64, permission string) error { return nil }
 func (f *fakeDB) GetRolePermissions(ctx context.Context, roleID int64) ([]string, error) { return nil, nil }
-func (f *fakeDB) AddUserToRole(ctx context.Context, userID int64, roleID int64) error { return nil }
+func (f *fakeDB) AddUserToRole(ctx context.Context, userID int64, roleID int64, notBefore int64, expiresAt int64, grantedAt int64, accessRequestID int64) error {
+	return nil
+}
+func (f *fakeDB) GetUserRole(ctx context.Context, userID int64, roleID int64) (ubdata.UserRoleMembership, bool, error) {
+	return ubdata.UserRoleMembership{}, false, nil
+}
 func (f *fakeDB) RemoveUserFromRole(ctx context.Context, userID int64, roleID int64) error { return nil }
 func (f *fakeDB) RemoveAllRolesFromUser(ctx context.Context, userID int64) error { return nil }
 func (f *fakeDB) GetUserOrganizationRoles(ctx context.Context, userID int64, organizationId int64) ([]ubdata.RoleRow, error) {
@@ -49,6 +61,7 @@ func (f *fakeDB) GetUserOrganizationRoles(ctx context.Context, userID int64, org
 }
 func (f *fakeDB) GetAllUserOrganizationRoles(ctx context.Context, userID int64) ([]ubdata.ListUserOrganizationRolesRow, error) { return nil, nil }
 func (f *fakeDB) ListUserOrganizationRoles(ctx context.Context, userID int64) ([]ubdata.ListUserOrganizationRolesRow, error) { return nil, nil }
+func (f *fakeDB) ListExpiredUserRoles(ctx context.Context, now int64) ([]ubdata.UserRoleMembership, error) { return nil, nil }
 func (f *fakeDB) OrganizationsCount(ctx context.Context) (int64, error) { return 0, nil }
 func (f *fakeDB) UsersCount(ctx context.Context) (int64, error) { return 0, nil }
 func (f *fakeDB) UpdateUserLoginStats(ctx context.Context, userID int64, lastLogin int64, loginCount int64) error { return nil }
@@ -57,14 +70,63 @@ func (f *fakeDB) ListOrganizationsRolesWithUserCounts(ctx context.Context, organ
 }
 func (f *fakeDB) GetUsersInRole(ctx context.Context, roleID int64) ([]ubdata.User, error) { return nil, nil }
 func (f *fakeDB) GetRolesForUser(ctx context.Context, userID int64) ([]ubdata.RoleRow, error) { return nil, nil }
-func (f *fakeDB) UserAddApiKey(ctx context.Context, userID int64, organizationId int64, apiKeyId string, apiKeyHash, name string, createdAt time.Time, expiresAt time.Time) error {
+func (f *fakeDB) UserAddApiKey(ctx context.Context, userID int64, organizationId int64, apiKeyId string, apiKeyHash, name string, createdAt time.Time, expiresAt time.Time, scopes []string, allowedCidrs []string) error {
     return nil
 }
 func (f *fakeDB) UserDeleteApiKey(ctx context.Context, userID int64, apiKeyId string) error { return nil }
+func (f *fakeDB) UserDeleteAllApiKeys(ctx context.Context, userID int64) error { return nil }
+func (f *fakeDB) GetUserDataKey(ctx context.Context, userID int64) (string, bool, error) { return "", false, nil }
+func (f *fakeDB) UserDataKeyAdd(ctx context.Context, userID int64, wrappedKey string) error { return nil }
+func (f *fakeDB) UserDataKeyDelete(ctx context.Context, userID int64) error { return nil }
 func (f *fakeDB) UserListApiKeys(ctx context.Context, userID int64) ([]ubdata.UserApiKeyNoHash, error) { return nil, nil }
 func (f *fakeDB) UserGetApiKey(ctx context.Context, apiKeyId string) (ubdata.UserApiKeyWithHash, error) {
     return ubdata.UserApiKeyWithHash{}, nil
 }
+func (f *fakeDB) UserRecordApiKeyUse(ctx context.Context, apiKeyId string, ipAddress string, usedAt time.Time) error { return nil }
+func (f *fakeDB) UserReplaceApiKey(ctx context.Context, userID int64, apiKeyId string, replacedBy string, expiresAt time.Time) error {
+    return nil
+}
+func (f *fakeDB) UserUpdateApiKeyHash(ctx context.Context, userID int64, apiKeyId string, secretHash string) error { return nil }
+func (f *fakeDB) AddUserLogin(ctx context.Context, login ubdata.UserLogin) error { return nil }
+func (f *fakeDB) ListUserLogins(ctx context.Context, userID int64, limit, offset int) ([]ubdata.UserLogin, error) { return nil, nil }
+func (f *fakeDB) SearchUserLoginsByIp(ctx context.Context, ipAddress string, limit, offset int) ([]ubdata.UserLogin, error) { return nil, nil }
+func (f *fakeDB) DeleteUserLogins(ctx context.Context, userID int64) error { return nil }
+func (f *fakeDB) GetRateLimit(ctx context.Context, key string) (ubdata.RateLimit, bool, error) {
+    return ubdata.RateLimit{}, false, nil
+}
+func (f *fakeDB) InsertRateLimit(ctx context.Context, limit ubdata.RateLimit) (bool, error) { return true, nil }
+func (f *fakeDB) UpdateRateLimit(ctx context.Context, limit ubdata.RateLimit) (bool, error) { return true, nil }
+func (f *fakeDB) DeleteExpiredRateLimits(ctx context.Context, before int64) error { return nil }
+func (f *fakeDB) AddRelationTuple(ctx context.Context, tuple ubdata.RelationTuple) error { return nil }
+func (f *fakeDB) DeleteRelationTuple(ctx context.Context, tuple ubdata.RelationTuple) error { return nil }
+func (f *fakeDB) ListRelationTuplesByObject(ctx context.Context, objectType string, objectId string) ([]ubdata.RelationTuple, error) {
+    return nil, nil
+}
+func (f *fakeDB) ListRelationTuplesBySubject(ctx context.Context, subjectType string, subjectId string, subjectRelation string) ([]ubdata.RelationTuple, error) {
+    return nil, nil
+}
+func (f *fakeDB) AddAccessRequest(ctx context.Context, request ubdata.AccessRequest) error { return nil }
+func (f *fakeDB) DecideAccessRequest(ctx context.Context, request ubdata.AccessRequest) error { return nil }
+func (f *fakeDB) GetAccessRequest(ctx context.Context, id int64) (ubdata.AccessRequest, bool, error) {
+    return ubdata.AccessRequest{}, false, nil
+}
+func (f *fakeDB) CountUserRoleAccessRequests(ctx context.Context, userID int64, roleID int64, status string) (int64, error) {
+    return 0, nil
+}
+func (f *fakeDB) ListOrganizationAccessRequests(ctx context.Context, organizationID int64, status string) ([]ubdata.AccessRequest, error) {
+    return nil, nil
+}
+func (f *fakeDB) ListUserAccessRequests(ctx context.Context, userID int64) ([]ubdata.AccessRequest, error) {
+    return nil, nil
+}
+func (f *fakeDB) ListOrganizationUsersWithPermission(ctx context.Context, organizationID int64, permission string, now int64) ([]ubdata.UserEmail, error) {
+    return nil, nil
+}
+func (f *fakeDB) AddAccessReview(ctx context.Context, review ubdata.AccessReview) error { return nil }
+func (f *fakeDB) CloseAccessReview(ctx context.Context, review ubdata.AccessReview) error { return nil }
+func (f *fakeDB) ListOrganizationAccessReviews(ctx context.Context, organizationID int64) ([]ubdata.AccessReview, error) {
+    return nil, nil
+}
 
 // New method added to DataAdapter; tests don't use it, return empty.
 func (f *fakeDB) ListRecentUserIds(ctx context.Context, limit int32) ([]int64, error) { return []int64{}, nil }
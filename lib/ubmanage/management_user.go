@@ -2,6 +2,7 @@ package ubmanage
 
 import (
 	"context"
+	"crypto/subtle"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -10,9 +11,13 @@ import (
 	"time"
 
 	evercore "github.com/kernelplex/evercore/base"
+	"github.com/kernelplex/ubase/lib/contracts"
+	"github.com/kernelplex/ubase/lib/ubdata"
+	"github.com/kernelplex/ubase/lib/ubratelimit"
 	r "github.com/kernelplex/ubase/lib/ubresponse"
 	"github.com/kernelplex/ubase/lib/ubsecurity"
 	"github.com/kernelplex/ubase/lib/ubstatus"
+	"github.com/kernelplex/ubase/lib/ubvalidation"
 )
 
 const ApiKeyLength = 40
@@ -21,7 +26,10 @@ const VerificationTokenLength = 10
 const emailLoginPasswordLength = 32
 
 var (
-	errEmailLoginDisabledUser = errors.New("user account is disabled")
+	errEmailLoginDisabledUser  = errors.New("user account is disabled")
+	errEmailLoginUnknownUser   = errors.New("no user exists for this email")
+	errImpersonationNotAllowed = errors.New("disabled users cannot take part in impersonation")
+	errImpersonationAdmin      = errors.New("only system administrators can impersonate system administrators")
 )
 
 func MapEvercoreErrorToStatus(err error) ubstatus.StatusCode {
@@ -54,8 +62,8 @@ func (m *ManagementImpl) UserAdd(ctx context.Context,
 	}
 
 	type IdCode struct {
-		Id   int64
-		Code *string
+		Id    int64
+		Token verificationToken
 	}
 
 	result, err := evercore.InContext(
@@ -77,51 +85,48 @@ func (m *ManagementImpl) UserAdd(ctx context.Context,
 				command.Verified = false
 			}
 
-			stateEvent := evercore.NewStateEvent(
-				UserAddedEvent{
-					Email:        command.Email,
-					PasswordHash: passwordHash,
-					FirstName:    command.FirstName,
-					LastName:     command.LastName,
-					DisplayName:  command.DisplayName,
-					Verified:     command.Verified,
-				})
+			dataKey, err := m.ensureUserDataKey(ctx, &aggregate)
+			if err != nil {
+				return IdCode{}, err
+			}
+
+			added, err := sealUserAddedEvent(dataKey, UserAddedEvent{
+				Email:        command.Email,
+				PasswordHash: passwordHash,
+				FirstName:    command.FirstName,
+				LastName:     command.LastName,
+				DisplayName:  command.DisplayName,
+				Verified:     command.Verified,
+			})
+			if err != nil {
+				return IdCode{}, err
+			}
+			stateEvent := evercore.NewStateEvent(added)
 
 			currentTime := time.Now()
 			etx.ApplyEventTo(&aggregate, stateEvent, currentTime, agent)
 
-			var token string
+			var token verificationToken
 			if command.GenerateVerificationToken {
-				token = ubsecurity.GenerateSecureRandomString(VerificationTokenLength)
-				encryptedToken, err := m.encryptionService.Encrypt64(token)
-				if err != nil {
-					return IdCode{}, fmt.Errorf("failed to encrypt verification token: %w", err)
-				}
-
-				event := UserVerificationTokenGeneratedEvent{
-					Token:       encryptedToken,
-					Regenerated: false,
-				}
-
-				err = etx.ApplyEventTo(&aggregate, event, time.Now(), agent)
+				token, err = m.issueVerificationToken(etx, &aggregate, false, time.Now(), agent)
 				if err != nil {
-					return IdCode{}, fmt.Errorf("failed to apply user verification token generated event: %w", err)
+					return IdCode{}, err
 				}
 			}
 
 			err = m.dbadapter.AddUser(
 				ctx, aggregate.Id,
-				aggregate.State.FirstName,
-				aggregate.State.LastName,
-				aggregate.State.DisplayName,
-				aggregate.State.Email,
+				command.FirstName,
+				command.LastName,
+				command.DisplayName,
+				command.Email,
 				aggregate.State.Verified,
 				aggregate.State.CreatedAt,
 				aggregate.State.UpdatedAt)
 			if err != nil {
 				return IdCode{}, fmt.Errorf("failed to add user in database: %w", err)
 			}
-			return IdCode{Id: aggregate.Id, Code: &token}, nil
+			return IdCode{Id: aggregate.Id, Token: token}, nil
 		})
 
 	if err != nil {
@@ -133,11 +138,15 @@ func (m *ManagementImpl) UserAdd(ctx context.Context,
 		}, err
 	}
 
+	if command.GenerateVerificationToken {
+		m.sendVerificationEmail(command.Email, m.verificationLinkUrl(result.Token.LinkToken), result.Token.ExpiresAt)
+	}
+
 	return r.Response[UserCreatedResponse]{
 		Status: ubstatus.Success,
 		Data: UserCreatedResponse{
 			Id:                result.Id,
-			VerificationToken: result.Code,
+			VerificationToken: &result.Token.Token,
 		},
 	}, nil
 }
@@ -154,6 +163,9 @@ func (m *ManagementImpl) UserGetById(ctx context.Context,
 			if err != nil {
 				return nil, fmt.Errorf("failed to load user: %w", err)
 			}
+			if err := m.openUserState(ctx, &aggregate); err != nil {
+				return nil, err
+			}
 			return &aggregate, nil
 		})
 	if err != nil {
@@ -178,6 +190,9 @@ func (m *ManagementImpl) UserGetByEmail(ctx context.Context,
 		func(etx evercore.EventStoreReadonlyContext) (*UserAggregate, error) {
 			aggregate := UserAggregate{}
 			etx.LoadStateByKeyInto(&aggregate, email)
+			if err := m.openUserState(ctx, &aggregate); err != nil {
+				return nil, err
+			}
 			return &aggregate, nil
 		})
 	if err != nil {
@@ -211,13 +226,24 @@ func (m *ManagementImpl) UserUpdate(ctx context.Context,
 		ctx,
 		func(etx evercore.EventStoreContext) error {
 			aggregate := UserAggregate{}
-			err := etx.LoadStateInto(&aggregate, command.Id)
+			err := loadActiveUserInto(etx, &aggregate, command.Id)
 			if err != nil {
 				return fmt.Errorf("failed to load user: %w", err)
 			}
+			if aggregate.State.ServiceAccount {
+				return errServiceAccount
+			}
+
+			dataKey, err := m.ensureUserDataKey(ctx, &aggregate)
+			if err != nil {
+				return err
+			}
 
 			// Save the previous email so we can check if it has changed
-			previousEmail := aggregate.State.Email
+			previous, err := m.userPII(ctx, &aggregate)
+			if err != nil {
+				return err
+			}
 
 			// Update password if provided
 			var passwordHash *string = nil
@@ -229,7 +255,7 @@ func (m *ManagementImpl) UserUpdate(ctx context.Context,
 				passwordHash = &hash
 			}
 
-			event := evercore.NewStateEvent(UserUpdatedEvent{
+			updated, err := sealUserUpdatedEvent(dataKey, UserUpdatedEvent{
 				Id:           command.Id,
 				Email:        command.Email,
 				FirstName:    command.FirstName,
@@ -238,15 +264,24 @@ func (m *ManagementImpl) UserUpdate(ctx context.Context,
 				PasswordHash: passwordHash,
 				Verified:     command.Verified,
 			})
+			if err != nil {
+				return err
+			}
+			event := evercore.NewStateEvent(updated)
 
 			err = etx.ApplyEventTo(&aggregate, event, time.Now(), agent)
 			if err != nil {
 				return fmt.Errorf("failed to apply user updated event: %w", err)
 			}
 
+			current, err := m.userPII(ctx, &aggregate)
+			if err != nil {
+				return err
+			}
+
 			// Update natural key if email changed
-			if command.Email != nil && aggregate.State.Email != previousEmail {
-				err = etx.ChangeAggregateNaturalKey(aggregate.Id, *command.Email)
+			if current.Email != previous.Email {
+				err = etx.ChangeAggregateNaturalKey(aggregate.Id, current.Email)
 				if err != nil {
 					return fmt.Errorf("failed to change user natural key: %w", err)
 				}
@@ -255,10 +290,10 @@ func (m *ManagementImpl) UserUpdate(ctx context.Context,
 			err = m.dbadapter.UpdateUser(
 				ctx,
 				aggregate.Id,
-				aggregate.State.FirstName,
-				aggregate.State.LastName,
-				aggregate.State.DisplayName,
-				aggregate.State.Email,
+				current.FirstName,
+				current.LastName,
+				current.DisplayName,
+				current.Email,
 				aggregate.State.Verified,
 				aggregate.State.UpdatedAt)
 			if err != nil {
@@ -269,6 +304,12 @@ func (m *ManagementImpl) UserUpdate(ctx context.Context,
 		})
 
 	if err != nil {
+		if errors.Is(err, errUserErased) {
+			return r.StatusError[any](ubstatus.NotFound, "User has been erased"), nil
+		}
+		if errors.Is(err, errServiceAccount) {
+			return r.StatusError[any](ubstatus.ValidationError, "Service accounts cannot be updated as users"), nil
+		}
 		slog.Error("Error updating user", "error", err)
 		return r.Response[any]{
 			Status:  ubstatus.UnexpectedError,
@@ -292,7 +333,13 @@ func (m *ManagementImpl) UserAuthenticate(ctx context.Context,
 	command UserLoginCommand,
 	agent string) (r.Response[*UserAuthenticationResponse], error) {
 
-	return evercore.InContext(
+	if retryAfter := rateLimited(ctx, m.rateLimitOptions.Login, emailRateLimitKey(command.Email)); retryAfter > 0 {
+		slog.Warn("Login attempts rate limited", "retryAfter", retryAfter)
+		return r.RateLimited[*UserAuthenticationResponse](rateLimitedMessage, retryAfter), nil
+	}
+
+	var alert *loginAlert
+	response, err := evercore.InContext(
 		ctx,
 		m.store,
 		func(etx evercore.EventStoreContext) (r.Response[*UserAuthenticationResponse], error) {
@@ -309,66 +356,108 @@ func (m *ManagementImpl) UserAuthenticate(ctx context.Context,
 				}
 				return r.StatusError[*UserAuthenticationResponse](status, "Could not verify this account at this time."), err
 			}
+			if aggregate.State.ServiceAccount {
+				return r.StatusError[*UserAuthenticationResponse](ubstatus.NotAuthorized, "Email or password is incorrect"), nil
+			}
+
+			pii, err := m.userPII(ctx, &aggregate)
+			if err != nil {
+				slog.Error("Error opening user data", "error", err)
+				return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), err
+			}
+
+			client, err := m.sealLoginClientFor(ctx, &aggregate, command.Client)
+			if err != nil {
+				slog.Error("Error sealing login client", "error", err)
+				return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), err
+			}
 
 			var eventState evercore.EventState
 			var response r.Response[*UserAuthenticationResponse]
+			var outcome, reason string
 
 			match, err := m.hashingService.VerifyBase64(command.Password, aggregate.State.PasswordHash)
 			if err != nil {
+				outcome, reason = ubdata.UserLoginOutcomeFailed, "Error verifying password"
 				eventState = UserLoginFailedEvent{
-					Reason: "Error verifying password",
+					Reason: reason,
+					Client: client,
 				}
 				slog.Error("Error verifying password", "error", err)
 				response = r.Error[*UserAuthenticationResponse]("Could not verify this account at this time.")
 			} else if !match {
 				slog.Error("Password does not match", "email", command.Email)
+				outcome, reason = ubdata.UserLoginOutcomeFailed, "Password does not match"
 				eventState = UserLoginFailedEvent{
-					Reason: "Password does not match",
+					Reason: reason,
+					Client: client,
 				}
 				response = r.StatusError[*UserAuthenticationResponse](ubstatus.NotAuthorized, "Email or password is incorrect")
 			} else if aggregate.State.Disabled {
 				slog.Error("User is disabled", "email", command.Email)
+				outcome, reason = ubdata.UserLoginOutcomeFailed, "User account is disabled"
 				eventState = UserLoginFailedEvent{
-					Reason: "User account is disabled",
+					Reason: reason,
+					Client: client,
 				}
 				response = r.StatusError[*UserAuthenticationResponse](ubstatus.NotAuthorized, "This account is not currently active. Please contact support.")
 			} else if aggregate.State.TwoFactorSharedSecret != nil && len(*aggregate.State.TwoFactorSharedSecret) > 0 {
+				outcome, reason = ubdata.UserLoginOutcomePartial, "Two factor required"
 				eventState = UserLoginPartiallySucceededEvent{
 					RequiresTwoFactor: true,
+					Client:            client,
 				}
 
 				response = r.PartialSuccess(&UserAuthenticationResponse{
 					UserId:               aggregate.Id,
-					Email:                aggregate.State.Email,
+					Email:                pii.Email,
 					RequiresTwoFactor:    true,
 					RequiresVerification: aggregate.State.Verified == false,
 				})
 			} else if !aggregate.State.Verified {
+				outcome, reason = ubdata.UserLoginOutcomePartial, "Verification required"
 				eventState = UserLoginPartiallySucceededEvent{
 					RequiresVerification: true,
+					Client:               client,
 				}
 				response = r.PartialSuccess(&UserAuthenticationResponse{
 					UserId:               aggregate.Id,
-					Email:                aggregate.State.Email,
+					Email:                pii.Email,
 					RequiresTwoFactor:    aggregate.State.TwoFactorSharedSecret != nil && len(*aggregate.State.TwoFactorSharedSecret) > 0,
 					RequiresVerification: true,
 				})
 			} else {
-				eventState = UserLoginSucceededEvent{}
+				outcome = ubdata.UserLoginOutcomeSucceeded
+				eventState = UserLoginSucceededEvent{Client: client}
 				response = r.Success(&UserAuthenticationResponse{
 					UserId: aggregate.Id,
-					Email:  aggregate.State.Email,
+					Email:  pii.Email,
 					RequiresTwoFactor: aggregate.State.TwoFactorSharedSecret != nil &&
 						len(*aggregate.State.TwoFactorSharedSecret) > 0,
 					RequiresVerification: aggregate.State.Verified == false,
 				})
 			}
 
-			applyError := etx.ApplyEventTo(&aggregate, eventState, time.Now(), agent)
+			now := time.Now()
+			failedAttempts := aggregate.State.FailedLoginAttempts
+			applyError := etx.ApplyEventTo(&aggregate, eventState, now, agent)
 			if applyError != nil {
 				slog.Error("Error applying login event", "error", applyError)
 				return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), applyError
 			}
+			m.recordUserLogin(ctx, aggregate.Id, now, outcome, reason, command.Client)
+
+			// A partial success still proves the password, so failed attempts
+			// are reported now; the device is only remembered once the login
+			// completes.
+			if outcome != ubdata.UserLoginOutcomeFailed {
+				alert, err = m.prepareLoginAlert(ctx, etx, &aggregate, command.Client, failedAttempts,
+					outcome == ubdata.UserLoginOutcomeSucceeded, now, agent)
+				if err != nil {
+					slog.Error("Error preparing login alert", "error", err)
+					return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), err
+				}
+			}
 
 			// Update the login info.
 			err = m.dbadapter.UpdateUserLoginStats(
@@ -384,6 +473,11 @@ func (m *ManagementImpl) UserAuthenticate(ctx context.Context,
 			return response, err
 
 		})
+
+	if err == nil {
+		m.sendLoginAlert(ctx, alert)
+	}
+	return response, err
 }
 
 func (m *ManagementImpl) UserRequestEmailLogin(ctx context.Context,
@@ -420,11 +514,18 @@ func (m *ManagementImpl) UserRequestEmailLogin(ctx context.Context,
 				if status != ubstatus.NotFound {
 					return UserEmailLoginRequestResponse{}, fmt.Errorf("failed to load user: %w", err)
 				}
+				if command.ExistingOnly {
+					return UserEmailLoginRequestResponse{}, errEmailLoginUnknownUser
+				}
 				if err := m.createEmailLoginUser(ctx, etx, &aggregate, command, agent); err != nil {
 					return UserEmailLoginRequestResponse{}, err
 				}
+			} else if aggregate.State.ServiceAccount {
+				return UserEmailLoginRequestResponse{}, errEmailLoginUnknownUser
 			} else if aggregate.State.Disabled {
 				return UserEmailLoginRequestResponse{}, errEmailLoginDisabledUser
+			} else if wait := m.emailLoginCooldown(&aggregate.State, time.Now()); wait > 0 {
+				return UserEmailLoginRequestResponse{}, &emailLoginCooldownError{wait: wait}
 			}
 
 			code := ubsecurity.GenerateSecureRandomString(uint32(m.emailLoginOptions.CodeLength))
@@ -438,27 +539,55 @@ func (m *ManagementImpl) UserRequestEmailLogin(ctx context.Context,
 				Code:      encryptedCode,
 				ExpiresAt: expiresAt,
 			}
+			linkToken := ""
+			if m.emailLoginOptions.MagicLink && command.Binding != "" {
+				linkToken, event.LinkHash, err = m.emailLoginLinkToken(aggregate.Id, command.Binding, expiresAt)
+				if err != nil {
+					return UserEmailLoginRequestResponse{}, err
+				}
+			}
 			now := time.Now()
 			if err := etx.ApplyEventTo(&aggregate, event, now, agent); err != nil {
 				return UserEmailLoginRequestResponse{}, fmt.Errorf("failed to apply email login code generated event: %w", err)
 			}
 
-			return UserEmailLoginRequestResponse{
+			pii, err := m.userPII(ctx, &aggregate)
+			if err != nil {
+				return UserEmailLoginRequestResponse{}, err
+			}
+
+			response := UserEmailLoginRequestResponse{
 				UserId:    aggregate.Id,
-				Email:     aggregate.State.Email,
+				Email:     pii.Email,
 				Code:      code,
 				ExpiresAt: expiresAt,
-			}, nil
+			}
+			if linkToken != "" {
+				response.LinkToken = linkToken
+				response.LinkUrl = m.emailLoginLinkUrl(linkToken)
+			}
+			return response, nil
 		})
 
 	if err != nil {
 		if errors.Is(err, errEmailLoginDisabledUser) {
 			return r.StatusError[UserEmailLoginRequestResponse](ubstatus.NotAuthorized, "This account is not currently active. Please contact support."), nil
 		}
+		if errors.Is(err, errEmailLoginUnknownUser) {
+			return r.StatusError[UserEmailLoginRequestResponse](ubstatus.NotFound, "No account exists for this email"), nil
+		}
+		if cooldown := (&emailLoginCooldownError{}); errors.As(err, &cooldown) {
+			return r.RateLimited[UserEmailLoginRequestResponse]("A code was sent recently. Wait before requesting another.", ubratelimit.RetryAfterSeconds(cooldown.wait)), nil
+		}
 		slog.Error("Error requesting email login", "error", err)
 		return r.Error[UserEmailLoginRequestResponse]("Could not start email login at this time."), err
 	}
 
+	if m.emailLoginOptions.Mailer != nil {
+		m.emailLoginOptions.Mailer.Send(emailLoginEmail(result))
+		result.Sent = true
+	}
+
 	return r.Success(result), nil
 }
 
@@ -485,7 +614,13 @@ func (m *ManagementImpl) UserVerifyEmailLoginCode(ctx context.Context,
 		}
 	}
 
-	return evercore.InContext(
+	if retryAfter := rateLimited(ctx, m.rateLimitOptions.CodeVerification, emailRateLimitKey(command.Email)); retryAfter > 0 {
+		slog.Warn("Email login code attempts rate limited", "retryAfter", retryAfter)
+		return r.RateLimited[*UserAuthenticationResponse](rateLimitedMessage, retryAfter), nil
+	}
+
+	var alert *loginAlert
+	response, err := evercore.InContext(
 		ctx,
 		m.store,
 		func(etx evercore.EventStoreContext) (r.Response[*UserAuthenticationResponse], error) {
@@ -502,6 +637,9 @@ func (m *ManagementImpl) UserVerifyEmailLoginCode(ctx context.Context,
 				}
 				return r.StatusError[*UserAuthenticationResponse](status, "Could not verify this account at this time."), err
 			}
+			if aggregate.State.ServiceAccount {
+				return r.StatusError[*UserAuthenticationResponse](ubstatus.NotAuthorized, "Email or code is incorrect"), nil
+			}
 
 			if aggregate.State.Disabled {
 				return r.StatusError[*UserAuthenticationResponse](ubstatus.NotAuthorized, "This account is not currently active. Please contact support."), nil
@@ -517,68 +655,146 @@ func (m *ManagementImpl) UserVerifyEmailLoginCode(ctx context.Context,
 				return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), fmt.Errorf("failed to decrypt email login code: %w", err)
 			}
 
-			if string(decryptedCode) != command.Code {
-				return r.StatusError[*UserAuthenticationResponse](ubstatus.NotAuthorized, "Email or code is incorrect"), nil
+			client, err := m.sealLoginClientFor(ctx, &aggregate, command.Client)
+			if err != nil {
+				return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), err
 			}
 
-			if aggregate.State.EmailLoginCodeExpiresAt > 0 &&
+			matches := subtle.ConstantTimeCompare(decryptedCode, []byte(command.Code)) == 1
+			failure := ""
+			if !matches {
+				failure = "Email login code does not match"
+			} else if aggregate.State.EmailLoginCodeExpiresAt > 0 &&
 				time.Now().Unix() > aggregate.State.EmailLoginCodeExpiresAt {
-				return r.StatusError[*UserAuthenticationResponse](ubstatus.NotAuthorized, "Email login code has expired. Request a new code."), nil
+				failure = "Email login code has expired"
 			}
+			if failure != "" {
+				now := time.Now()
+				if err := etx.ApplyEventTo(&aggregate, UserLoginFailedEvent{Reason: failure, Client: client}, now, agent); err != nil {
+					return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), fmt.Errorf("failed to apply login failed event: %w", err)
+				}
+				m.recordUserLogin(ctx, aggregate.Id, now, ubdata.UserLoginOutcomeFailed, failure, command.Client)
+				if matches {
+					return r.StatusError[*UserAuthenticationResponse](ubstatus.NotAuthorized, "Email login code has expired. Request a new code."), nil
+				}
 
-			now := time.Now()
-			if err := etx.ApplyEventTo(&aggregate, UserEmailLoginCodeConsumedEvent{}, now, agent); err != nil {
-				return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), fmt.Errorf("failed to apply email login code consumed event: %w", err)
+				invalidated, err := m.recordEmailLoginCodeFailure(etx, &aggregate, now, agent)
+				if err != nil {
+					return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), err
+				}
+				if invalidated {
+					return r.StatusError[*UserAuthenticationResponse](ubstatus.NotAuthorized, "Too many incorrect codes. Request a new code."), nil
+				}
+				return r.StatusError[*UserAuthenticationResponse](ubstatus.NotAuthorized, "Email or code is incorrect"), nil
 			}
 
-			if err := etx.ApplyEventTo(&aggregate, UserLoginSucceededEvent{}, now, agent); err != nil {
-				return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), fmt.Errorf("failed to apply login succeeded event: %w", err)
-			}
+			var response r.Response[*UserAuthenticationResponse]
+			response, alert, err = m.completeEmailLogin(ctx, etx, &aggregate, client, command.Client, agent)
+			return response, err
+		})
 
-			err = m.dbadapter.UpdateUser(
-				ctx,
-				aggregate.Id,
-				aggregate.State.FirstName,
-				aggregate.State.LastName,
-				aggregate.State.DisplayName,
-				aggregate.State.Email,
-				aggregate.State.Verified,
-				now.Unix())
-			if err != nil {
-				return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), fmt.Errorf("failed to persist user verification state: %w", err)
-			}
+	if err == nil {
+		m.sendLoginAlert(ctx, alert)
+	}
+	return response, err
+}
 
-			err = m.dbadapter.UpdateUserLoginStats(
-				ctx,
-				aggregate.Id,
-				aggregate.State.LastLogin,
-				aggregate.State.LoginCount)
-			if err != nil {
-				slog.Error("Error updating user login stats", "error", err)
-			}
+// completeEmailLogin consumes the pending email login code (and its magic
+// link) and records a successful login. client is the sealed form of
+// rawClient. As with UserAuthenticate, users with two factor enabled only get
+// a partial success and must still pass UserVerifyTwoFactorCode.
+func (m *ManagementImpl) completeEmailLogin(ctx context.Context,
+	etx evercore.EventStoreContext,
+	aggregate *UserAggregate,
+	client LoginClient,
+	rawClient LoginClient,
+	agent string) (r.Response[*UserAuthenticationResponse], *loginAlert, error) {
+	now := time.Now()
+	if err := etx.ApplyEventTo(aggregate, UserEmailLoginCodeConsumedEvent{}, now, agent); err != nil {
+		return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), nil, fmt.Errorf("failed to apply email login code consumed event: %w", err)
+	}
 
-			return r.Success(&UserAuthenticationResponse{
-				UserId:               aggregate.Id,
-				Email:                aggregate.State.Email,
-				RequiresTwoFactor:    false,
-				RequiresVerification: false,
-			}), nil
-		})
+	requiresTwoFactor := aggregate.State.TwoFactorSharedSecret != nil && len(*aggregate.State.TwoFactorSharedSecret) > 0
+	failedAttempts := aggregate.State.FailedLoginAttempts
+	if requiresTwoFactor {
+		event := UserLoginPartiallySucceededEvent{RequiresTwoFactor: true, Client: client}
+		if err := etx.ApplyEventTo(aggregate, event, now, agent); err != nil {
+			return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), nil, fmt.Errorf("failed to apply login partially succeeded event: %w", err)
+		}
+		m.recordUserLogin(ctx, aggregate.Id, now, ubdata.UserLoginOutcomePartial, "Two factor required", rawClient)
+	} else {
+		if err := etx.ApplyEventTo(aggregate, UserLoginSucceededEvent{Client: client}, now, agent); err != nil {
+			return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), nil, fmt.Errorf("failed to apply login succeeded event: %w", err)
+		}
+		m.recordUserLogin(ctx, aggregate.Id, now, ubdata.UserLoginOutcomeSucceeded, "", rawClient)
+	}
+
+	alert, err := m.prepareLoginAlert(ctx, etx, aggregate, rawClient, failedAttempts, !requiresTwoFactor, now, agent)
+	if err != nil {
+		return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), nil, err
+	}
+
+	pii, err := m.userPII(ctx, aggregate)
+	if err != nil {
+		return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), nil, err
+	}
+
+	err = m.dbadapter.UpdateUser(
+		ctx,
+		aggregate.Id,
+		pii.FirstName,
+		pii.LastName,
+		pii.DisplayName,
+		pii.Email,
+		aggregate.State.Verified,
+		now.Unix())
+	if err != nil {
+		return r.Error[*UserAuthenticationResponse]("Could not verify this account at this time."), nil, fmt.Errorf("failed to persist user verification state: %w", err)
+	}
+
+	err = m.dbadapter.UpdateUserLoginStats(
+		ctx,
+		aggregate.Id,
+		aggregate.State.LastLogin,
+		aggregate.State.LoginCount)
+	if err != nil {
+		slog.Error("Error updating user login stats", "error", err)
+	}
+
+	response := &UserAuthenticationResponse{
+		UserId:               aggregate.Id,
+		Email:                pii.Email,
+		RequiresTwoFactor:    requiresTwoFactor,
+		RequiresVerification: false,
+	}
+	if requiresTwoFactor {
+		return r.PartialSuccess(response), alert, nil
+	}
+	return r.Success(response), alert, nil
 }
 
 func (m *ManagementImpl) UserVerifyTwoFactorCode(ctx context.Context,
 	command UserVerifyTwoFactorLoginCommand,
 	agent string) (r.Response[any], error) {
 
+	if retryAfter := rateLimited(ctx, m.rateLimitOptions.CodeVerification, userRateLimitKey(command.UserId)); retryAfter > 0 {
+		slog.Warn("Two factor code attempts rate limited", "userId", command.UserId, "retryAfter", retryAfter)
+		return r.RateLimited[any](rateLimitedMessage, retryAfter), nil
+	}
+
+	var alert *loginAlert
 	match, err := evercore.InContext(
 		ctx,
 		m.store,
 		func(etx evercore.EventStoreContext) (bool, error) {
 			aggregate := UserAggregate{}
-			err := etx.LoadStateInto(&aggregate, command.UserId)
+			err := loadActiveUserInto(etx, &aggregate, command.UserId)
 			if err != nil {
 				return false, fmt.Errorf("failed to load user: %w", err)
 			}
+			if aggregate.State.ServiceAccount {
+				return false, errServiceAccount
+			}
 
 			if aggregate.State.TwoFactorSharedSecret == nil {
 				return false, fmt.Errorf("user does not have two factor enabled")
@@ -590,9 +806,53 @@ func (m *ManagementImpl) UserVerifyTwoFactorCode(ctx context.Context,
 			}
 			decryptedUrl := string(decryptedUrlBytes)
 
-			return m.twoFactorService.ValidateTotp(decryptedUrl, command.Code)
+			match, err := m.twoFactorService.ValidateTotp(decryptedUrl, command.Code)
+			if err != nil {
+				return false, err
+			}
+
+			client, err := m.sealLoginClientFor(ctx, &aggregate, command.Client)
+			if err != nil {
+				return false, err
+			}
+
+			now := time.Now()
+			if match {
+				failedAttempts := aggregate.State.FailedLoginAttempts
+				err = etx.ApplyEventTo(&aggregate, UserLoginSucceededEvent{Client: client}, now, agent)
+				if err != nil {
+					return false, fmt.Errorf("failed to apply login succeeded event: %w", err)
+				}
+				m.recordUserLogin(ctx, aggregate.Id, now, ubdata.UserLoginOutcomeSucceeded, "", command.Client)
+
+				alert, err = m.prepareLoginAlert(ctx, etx, &aggregate, command.Client, failedAttempts, true, now, agent)
+				if err != nil {
+					return false, err
+				}
+			} else {
+				reason := "Two factor code does not match"
+				err = etx.ApplyEventTo(&aggregate, UserLoginFailedEvent{Reason: reason, Client: client}, now, agent)
+				if err != nil {
+					return false, fmt.Errorf("failed to apply login failed event: %w", err)
+				}
+				m.recordUserLogin(ctx, aggregate.Id, now, ubdata.UserLoginOutcomeFailed, reason, command.Client)
+			}
+
+			err = m.dbadapter.UpdateUserLoginStats(
+				ctx,
+				aggregate.Id,
+				aggregate.State.LastLogin,
+				aggregate.State.LoginCount)
+			if err != nil {
+				slog.Error("Error updating user login stats", "error", err)
+			}
+
+			return match, nil
 		})
 
+	if errors.Is(err, errServiceAccount) {
+		return r.StatusError[any](ubstatus.NotAuthorized, "Service accounts cannot sign in"), nil
+	}
 	if err != nil {
 		status := MapEvercoreErrorToStatus(err)
 		slog.Error("Error verifying two factor code", "error", err)
@@ -603,6 +863,7 @@ func (m *ManagementImpl) UserVerifyTwoFactorCode(ctx context.Context,
 		slog.Error("Two factor code does not match", "code", command.Code)
 		return r.StatusError[any](ubstatus.NotAuthorized, "Two factor code does not match"), nil
 	}
+	m.sendLoginAlert(ctx, alert)
 	return r.SuccessAny(), nil
 }
 
@@ -634,15 +895,23 @@ func (m *ManagementImpl) createEmailLoginUser(ctx context.Context,
 		}
 	}
 
-	stateEvent := evercore.NewStateEvent(
-		UserAddedEvent{
-			Email:        command.Email,
-			PasswordHash: passwordHash,
-			FirstName:    firstName,
-			LastName:     lastName,
-			DisplayName:  displayName,
-			Verified:     false,
-		})
+	dataKey, err := m.ensureUserDataKey(ctx, aggregate)
+	if err != nil {
+		return err
+	}
+
+	added, err := sealUserAddedEvent(dataKey, UserAddedEvent{
+		Email:        command.Email,
+		PasswordHash: passwordHash,
+		FirstName:    firstName,
+		LastName:     lastName,
+		DisplayName:  displayName,
+		Verified:     false,
+	})
+	if err != nil {
+		return err
+	}
+	stateEvent := evercore.NewStateEvent(added)
 
 	now := time.Now()
 	err = etx.ApplyEventTo(aggregate, stateEvent, now, agent)
@@ -653,10 +922,10 @@ func (m *ManagementImpl) createEmailLoginUser(ctx context.Context,
 	err = m.dbadapter.AddUser(
 		ctx,
 		aggregate.Id,
-		aggregate.State.FirstName,
-		aggregate.State.LastName,
-		aggregate.State.DisplayName,
-		aggregate.State.Email,
+		firstName,
+		lastName,
+		displayName,
+		command.Email,
 		aggregate.State.Verified,
 		aggregate.State.CreatedAt,
 		aggregate.State.UpdatedAt)
@@ -680,29 +949,14 @@ func (m *ManagementImpl) UserGenerateVerificationToken(ctx context.Context,
 	token, err := evercore.InContext(
 		ctx,
 		m.store,
-		func(etx evercore.EventStoreContext) (string, error) {
+		func(etx evercore.EventStoreContext) (verificationToken, error) {
 			aggregate := UserAggregate{}
-			err := etx.LoadStateInto(&aggregate, command.Id)
-			if err != nil {
-				return "", fmt.Errorf("failed to load user: %w", err)
-			}
-
-			token := ubsecurity.GenerateSecureRandomString(VerificationTokenLength)
-			encryptedToken, err := m.encryptionService.Encrypt64(token)
+			err := loadActiveUserInto(etx, &aggregate, command.Id)
 			if err != nil {
-				return "", fmt.Errorf("failed to encrypt verification token: %w", err)
-			}
-			event := UserVerificationTokenGeneratedEvent{
-				Token:       encryptedToken,
-				Regenerated: command.Regenerate,
+				return verificationToken{}, fmt.Errorf("failed to load user: %w", err)
 			}
 
-			err = etx.ApplyEventTo(&aggregate, event, time.Now(), agent)
-			if err != nil {
-				return "", fmt.Errorf("failed to apply user verification token generated event: %w", err)
-			}
-
-			return token, nil
+			return m.issueVerificationToken(etx, &aggregate, command.Regenerate, time.Now(), agent)
 		})
 	if err != nil {
 		status := MapEvercoreErrorToStatus(err)
@@ -713,7 +967,9 @@ func (m *ManagementImpl) UserGenerateVerificationToken(ctx context.Context,
 		}, err
 	}
 	return r.Success(UserGenerateVerificationTokenResponse{
-		Token: token,
+		Token:     token.Token,
+		ExpiresAt: token.ExpiresAt,
+		LinkToken: token.LinkToken,
 	}), nil
 }
 
@@ -721,50 +977,10 @@ func (m *ManagementImpl) UserVerify(ctx context.Context,
 	command UserVerifyCommand,
 	agent string) (r.Response[any], error) {
 
-	err := m.store.WithContext(
-		ctx,
-		func(etx evercore.EventStoreContext) error {
-			aggregate := UserAggregate{}
-			err := etx.LoadStateInto(&aggregate, command.Id)
-			if err != nil {
-				return fmt.Errorf("failed to load user: %w", err)
-			}
-
-			if aggregate.State.VerificationToken == nil {
-				return fmt.Errorf("user does not have verification token enabled")
-			}
-
-			bytesOfDecryptedToken, err := m.encryptionService.Decrypt64(*aggregate.State.VerificationToken)
-			if err != nil {
-				slog.Error("Error decrypting verification token", "error", err, "token", *aggregate.State.VerificationToken)
-				return fmt.Errorf("failed to decrypt verification token: %w", err)
-			}
-			decryptedToken := string(bytesOfDecryptedToken)
-			if decryptedToken != command.Verification {
-				return fmt.Errorf("verification token does not match")
-			}
-
-			event := UserVerificationTokenVerifiedEvent{}
-			err = etx.ApplyEventTo(&aggregate, event, time.Now(), agent)
-			if err != nil {
-				return fmt.Errorf("failed to apply user verification token verified event: %w", err)
-			}
-
-			err = m.dbadapter.UpdateUser(
-				ctx,
-				aggregate.Id,
-				aggregate.State.FirstName,
-				aggregate.State.LastName,
-				aggregate.State.DisplayName,
-				aggregate.State.Email,
-				aggregate.State.Verified,
-				aggregate.State.UpdatedAt)
-			if err != nil {
-				return fmt.Errorf("failed to set user verified in database: %w", err)
-			}
-
-			return nil
-		})
+	err := m.verifyUser(ctx, command.Id, command.Verification, agent)
+	if errors.Is(err, errVerificationTokenInvalid) {
+		return r.StatusError[any](ubstatus.NotAuthorized, "Verification token is invalid or has expired"), nil
+	}
 	if err != nil {
 		slog.Error("Error verifying user", "error", err)
 		return r.Error[any]("Error verifying user"), err
@@ -780,12 +996,17 @@ func (m *ManagementImpl) GenerateTwoFactorSharedSecret(ctx context.Context,
 		m.store,
 		func(etx evercore.EventStoreReadonlyContext) (string, error) {
 			aggregate := UserAggregate{}
-			err := etx.LoadStateInto(&aggregate, command.Id)
+			err := loadActiveUserInto(etx, &aggregate, command.Id)
 			if err != nil {
 				return "", fmt.Errorf("failed to load user: %w", err)
 			}
 
-			twoFactorUrl, err := m.twoFactorService.GenerateTotp(aggregate.State.Email)
+			pii, err := m.userPII(ctx, &aggregate)
+			if err != nil {
+				return "", err
+			}
+
+			twoFactorUrl, err := m.twoFactorService.GenerateTotp(pii.Email)
 			if err != nil {
 				return "", fmt.Errorf("failed to generate totp: %w", err)
 			}
@@ -811,10 +1032,13 @@ func (m *ManagementImpl) UserSetTwoFactorSharedSecret(ctx context.Context, comma
 		ctx,
 		func(etx evercore.EventStoreContext) error {
 			aggregate := UserAggregate{}
-			err := etx.LoadStateInto(&aggregate, command.Id)
+			err := loadActiveUserInto(etx, &aggregate, command.Id)
 			if err != nil {
 				return fmt.Errorf("failed to load user: %w", err)
 			}
+			if aggregate.State.ServiceAccount {
+				return errServiceAccount
+			}
 
 			encryptedSecret, err := m.encryptionService.Encrypt64(command.Secret)
 
@@ -829,6 +1053,9 @@ func (m *ManagementImpl) UserSetTwoFactorSharedSecret(ctx context.Context, comma
 
 			return nil
 		})
+	if errors.Is(err, errServiceAccount) {
+		return r.StatusError[any](ubstatus.ValidationError, "Service accounts cannot use two factor authentication"), nil
+	}
 	if err != nil {
 		slog.Error("Error setting two factor shared secret", "error", err)
 		return r.Error[any]("Error setting two factor shared secret"), err
@@ -843,7 +1070,7 @@ func (m *ManagementImpl) UserDisable(ctx context.Context,
 		ctx,
 		func(etx evercore.EventStoreContext) error {
 			aggregate := UserAggregate{}
-			err := etx.LoadStateInto(&aggregate, command.Id)
+			err := loadActiveUserInto(etx, &aggregate, command.Id)
 			if err != nil {
 				return fmt.Errorf("failed to load user: %w", err)
 			}
@@ -871,7 +1098,7 @@ func (m *ManagementImpl) UserEnable(ctx context.Context,
 		ctx,
 		func(etx evercore.EventStoreContext) error {
 			aggregate := UserAggregate{}
-			err := etx.LoadStateInto(&aggregate, command.Id)
+			err := loadActiveUserInto(etx, &aggregate, command.Id)
 			if err != nil {
 				return fmt.Errorf("failed to load user: %w", err)
 			}
@@ -892,6 +1119,279 @@ func (m *ManagementImpl) UserEnable(ctx context.Context,
 	return r.SuccessAny(), nil
 }
 
+func (m *ManagementImpl) UserErase(ctx context.Context,
+	command UserEraseCommand,
+	agent string) (r.Response[any], error) {
+
+	if ok, issues := command.Validate(); !ok {
+		return r.ValidationError[any](issues), nil
+	}
+
+	plaintextHistory := false
+	err := m.store.WithContext(
+		ctx,
+		func(etx evercore.EventStoreContext) error {
+			aggregate := UserAggregate{}
+			err := loadActiveUserInto(etx, &aggregate, command.Id)
+			if err != nil {
+				return fmt.Errorf("failed to load user: %w", err)
+			}
+
+			// Record the role removals so subscribers (such as the prefect
+			// service) see the memberships go away.
+			roles, err := m.dbadapter.GetRolesForUser(ctx, aggregate.Id)
+			if err != nil {
+				return fmt.Errorf("failed to get user roles: %w", err)
+			}
+			if len(roles) > 0 {
+				userRoles := UserRolesAggregate{}
+				_, err = etx.LoadOrCreateAggregate(&userRoles, "UserRolesAggregate")
+				if err != nil {
+					return fmt.Errorf("failed to load user roles aggregate: %w", err)
+				}
+				for _, role := range roles {
+					event := UserRemovedFromRoleEvent{
+						UserId: aggregate.Id,
+						RoleId: role.ID,
+					}
+					err = etx.ApplyEventTo(&userRoles, event, time.Now(), agent)
+					if err != nil {
+						return fmt.Errorf("failed to apply user removed from role event: %w", err)
+					}
+				}
+			}
+
+			err = etx.ApplyEventTo(&aggregate, UserErasedEvent{}, time.Now(), agent)
+			if err != nil {
+				return fmt.Errorf("failed to apply user erased event: %w", err)
+			}
+
+			// The natural key is the email address; replace it so the
+			// aggregate no longer references the user and the address can be
+			// registered again.
+			err = etx.ChangeAggregateNaturalKey(aggregate.Id, fmt.Sprintf("erased:%d", aggregate.Id))
+			if err != nil {
+				return fmt.Errorf("failed to change user natural key: %w", err)
+			}
+
+			err = m.dbadapter.RemoveAllRolesFromUser(ctx, aggregate.Id)
+			if err != nil {
+				return fmt.Errorf("failed to remove user roles in database: %w", err)
+			}
+
+			err = m.dbadapter.UserDeleteAllApiKeys(ctx, aggregate.Id)
+			if err != nil {
+				return fmt.Errorf("failed to delete user api keys in database: %w", err)
+			}
+
+			err = m.dbadapter.DeleteUserLogins(ctx, aggregate.Id)
+			if err != nil {
+				return fmt.Errorf("failed to delete user login history in database: %w", err)
+			}
+
+			err = m.dbadapter.DeleteUser(ctx, aggregate.Id)
+			if err != nil {
+				return fmt.Errorf("failed to delete user in database: %w", err)
+			}
+
+			// Without the data key the sealed personal data left in the
+			// event history can no longer be opened.
+			err = m.dbadapter.UserDataKeyDelete(ctx, aggregate.Id)
+			if err != nil {
+				return fmt.Errorf("failed to delete user data key in database: %w", err)
+			}
+
+			plaintextHistory = aggregate.State.PlaintextHistory
+			return nil
+		})
+	if err != nil {
+		if errors.Is(err, errUserErased) {
+			return r.StatusError[any](ubstatus.NotFound, "User has already been erased"), nil
+		}
+		slog.Error("Error erasing user", "error", err)
+		status := MapEvercoreErrorToStatus(err)
+		return r.StatusError[any](status, "Error erasing user"), err
+	}
+	if plaintextHistory {
+		slog.Warn("Erased user was added before personal data was sealed; their earliest events still hold plaintext", "userId", command.Id)
+		return r.Response[any]{
+			Status:  ubstatus.Success,
+			Message: "User erased. The user was added before personal data was sealed, so their earliest events still hold it in plaintext.",
+		}, nil
+	}
+	return r.SuccessAny(), nil
+}
+
+func (m *ManagementImpl) UserStartImpersonation(ctx context.Context,
+	command UserStartImpersonationCommand,
+	agent string) (r.Response[UserImpersonationResponse], error) {
+
+	if ok, issues := command.Validate(); !ok {
+		return r.ValidationError[UserImpersonationResponse](issues), nil
+	}
+
+	var response UserImpersonationResponse
+	err := m.store.WithContext(
+		ctx,
+		func(etx evercore.EventStoreContext) error {
+			impersonator := UserAggregate{}
+			err := loadActiveUserInto(etx, &impersonator, command.ImpersonatorId)
+			if err != nil {
+				return fmt.Errorf("failed to load impersonator: %w", err)
+			}
+			if impersonator.State.Disabled {
+				return errImpersonationNotAllowed
+			}
+
+			target := UserAggregate{}
+			err = loadActiveUserInto(etx, &target, command.TargetId)
+			if err != nil {
+				return fmt.Errorf("failed to load target user: %w", err)
+			}
+			if target.State.Disabled || target.State.ServiceAccount {
+				return errImpersonationNotAllowed
+			}
+
+			now := time.Now()
+			organizationId, err := m.impersonationOrganization(ctx, target.Id, command.OrganizationId, now)
+			if err != nil {
+				return err
+			}
+			// Impersonating a system administrator would hand the
+			// impersonator their permissions. Grants under a policy count,
+			// whatever the policy says now.
+			targetAdmin, adminPolicies, err := m.permissionGrants(ctx, etx, target.Id, organizationId, contracts.PermSystemAdmin, now)
+			if err != nil {
+				return err
+			}
+			if targetAdmin || len(adminPolicies) > 0 {
+				impersonatorAdmin, err := m.userHoldsPermission(ctx, etx, impersonator.Id, command.OrganizationId, contracts.PermSystemAdmin, now)
+				if err != nil {
+					return err
+				}
+				if !impersonatorAdmin {
+					return errImpersonationAdmin
+				}
+			}
+
+			event := UserImpersonationStartedEvent{
+				ImpersonatorId: impersonator.Id,
+				TargetId:       target.Id,
+			}
+			err = etx.ApplyEventTo(&impersonator, event, time.Now(), agent)
+			if err != nil {
+				return fmt.Errorf("failed to apply impersonation started event to impersonator: %w", err)
+			}
+			err = etx.ApplyEventTo(&target, event, time.Now(), agent)
+			if err != nil {
+				return fmt.Errorf("failed to apply impersonation started event to target: %w", err)
+			}
+
+			impersonatorPII, err := m.userPII(ctx, &impersonator)
+			if err != nil {
+				return err
+			}
+			targetPII, err := m.userPII(ctx, &target)
+			if err != nil {
+				return err
+			}
+			response = UserImpersonationResponse{
+				ImpersonatorId:       impersonator.Id,
+				ImpersonatorEmail:    impersonatorPII.Email,
+				TargetId:             target.Id,
+				TargetEmail:          targetPII.Email,
+				TargetOrganizationId: organizationId,
+			}
+			return nil
+		})
+	if err != nil {
+		if errors.Is(err, errUserErased) {
+			return r.StatusError[UserImpersonationResponse](ubstatus.NotFound, "User not found"), nil
+		}
+		if errors.Is(err, errImpersonationNotAllowed) {
+			return r.StatusError[UserImpersonationResponse](ubstatus.NotAuthorized, "Disabled users and service accounts cannot be impersonated"), nil
+		}
+		if errors.Is(err, errImpersonationAdmin) {
+			return r.StatusError[UserImpersonationResponse](ubstatus.NotAuthorized, "Only system administrators can impersonate system administrators"), nil
+		}
+		slog.Error("Error starting impersonation", "error", err)
+		status := MapEvercoreErrorToStatus(err)
+		return r.StatusError[UserImpersonationResponse](status, "Error starting impersonation"), err
+	}
+	return r.Success(response), nil
+}
+
+// impersonationOrganization returns the organization an impersonation session
+// of the target is in: the impersonator's organization when the target is an
+// active member of it, otherwise the first organization the target is an
+// active member of. Targets without memberships stay in the impersonator's
+// organization, where they hold nothing.
+func (m *ManagementImpl) impersonationOrganization(ctx context.Context, targetId int64, organizationId int64, now time.Time) (int64, error) {
+	memberships, err := m.dbadapter.GetAllUserOrganizationRoles(ctx, targetId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get target roles: %w", err)
+	}
+	var first int64
+	for _, membership := range memberships {
+		window := RoleWindow{NotBefore: membership.NotBefore, ExpiresAt: membership.ExpiresAt}
+		if !window.activeAt(now.Unix()) {
+			continue
+		}
+		if membership.OrganizationID == organizationId {
+			return organizationId, nil
+		}
+		if first == 0 || membership.OrganizationID < first {
+			first = membership.OrganizationID
+		}
+	}
+	if first == 0 {
+		return organizationId, nil
+	}
+	return first, nil
+}
+
+func (m *ManagementImpl) UserStopImpersonation(ctx context.Context,
+	command UserStopImpersonationCommand,
+	agent string) (r.Response[any], error) {
+
+	if ok, issues := command.Validate(); !ok {
+		return r.ValidationError[any](issues), nil
+	}
+
+	err := m.store.WithContext(
+		ctx,
+		func(etx evercore.EventStoreContext) error {
+			event := UserImpersonationStoppedEvent{
+				ImpersonatorId: command.ImpersonatorId,
+				TargetId:       command.TargetId,
+			}
+
+			// The session is always allowed to end, even if either user was
+			// disabled while it was active, so only erased users are skipped.
+			for _, id := range []int64{command.ImpersonatorId, command.TargetId} {
+				aggregate := UserAggregate{}
+				err := loadActiveUserInto(etx, &aggregate, id)
+				if errors.Is(err, errUserErased) {
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("failed to load user: %w", err)
+				}
+				err = etx.ApplyEventTo(&aggregate, event, time.Now(), agent)
+				if err != nil {
+					return fmt.Errorf("failed to apply impersonation stopped event: %w", err)
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		slog.Error("Error stopping impersonation", "error", err)
+		status := MapEvercoreErrorToStatus(err)
+		return r.StatusError[any](status, "Error stopping impersonation"), err
+	}
+	return r.SuccessAny(), nil
+}
+
 func (m *ManagementImpl) UsersCount(ctx context.Context) (r.Response[int64], error) {
 	count, err := m.dbadapter.UsersCount(ctx)
 	if err != nil {
@@ -913,7 +1413,7 @@ func (m *ManagementImpl) UserSettingsAdd(ctx context.Context,
 		ctx,
 		func(etx evercore.EventStoreContext) error {
 			aggregate := UserAggregate{}
-			if err := etx.LoadStateInto(&aggregate, command.Id); err != nil {
+			if err := loadActiveUserInto(etx, &aggregate, command.Id); err != nil {
 				return fmt.Errorf("failed to load user: %w", err)
 			}
 			event := UserSettingsAddedEvent{Settings: command.Settings}
@@ -943,7 +1443,7 @@ func (m *ManagementImpl) UserSettingsRemove(ctx context.Context,
 		ctx,
 		func(etx evercore.EventStoreContext) error {
 			aggregate := UserAggregate{}
-			if err := etx.LoadStateInto(&aggregate, command.Id); err != nil {
+			if err := loadActiveUserInto(etx, &aggregate, command.Id); err != nil {
 				return fmt.Errorf("failed to load user: %w", err)
 			}
 			event := UserSettingsRemovedEvent{SettingKeys: command.SettingKeys}
@@ -973,64 +1473,44 @@ func (m *ManagementImpl) UserGenerateApiKey(ctx context.Context,
 		}, nil
 	}
 
+	scopes := normalizeScopes(command.Scopes)
+	if len(scopes) > 0 {
+		held, err := m.userOrganizationPermissions(ctx, command.UserId, command.OrganizationId)
+		if err != nil {
+			slog.Error("Error loading user permissions", "error", err)
+			return r.Error[string]("Error generating api key"), err
+		}
+		if missing := scopesNotHeld(scopes, held); len(missing) > 0 {
+			tracker := ubvalidation.NewValidationTracker()
+			tracker.AddIssue("scopes", "Scopes must be a subset of the user's permissions: "+strings.Join(missing, ", "))
+			_, issues := tracker.Valid()
+			return r.ValidationError[string](issues), nil
+		}
+	}
+
 	apiKey, err := evercore.InContext(
 		ctx,
 		m.store,
 		func(etx evercore.EventStoreContext) (string, error) {
 			aggregate := UserAggregate{}
-			err := etx.LoadStateInto(&aggregate, command.UserId)
+			err := loadActiveUserInto(etx, &aggregate, command.UserId)
 			if err != nil {
 				return "", fmt.Errorf("failed to load user: %w", err)
 			}
-
-			// Generate the API key and hash it
-			apiKey := ubsecurity.GenerateSecureRandomString(ApiKeyLength)
-			if len(apiKey) < 40 {
-				// This should not happen.
-				panic("Generated API key is too short")
-			}
-
-			// Id is the first 10 characters of the API key. Secret is the rest.
-			apiKeyId := apiKey[:ApiKeyIdLength]
-			secret := apiKey[ApiKeyIdLength:]
-
-			secretHash, err := m.hashingService.GenerateHashBase64(secret)
-			if err != nil {
-				return "", fmt.Errorf("failed to hash api key: %w", err)
+			if aggregate.State.ServiceAccount && aggregate.State.OwnerOrganizationId != command.OrganizationId {
+				return "", errServiceAccountOrganization
 			}
 
-			unixTimeExpiresAt := command.ExpiresAt.Unix()
-			unixTimeCreatedAt := time.Now().Unix()
-
-			event := UserApiKeyAddedEvent{
-				Id:             apiKeyId,
+			return m.issueApiKey(ctx, etx, &aggregate, ApiKey{
 				OrganizationId: command.OrganizationId,
-				SecretHash:     secretHash,
 				Name:           command.Name,
-				CreatedAt:      unixTimeCreatedAt,
-				ExpiresAt:      unixTimeExpiresAt,
-			}
-
-			err = etx.ApplyEventTo(&aggregate, event, time.Now(), agent)
-			if err != nil {
-				return "", fmt.Errorf("failed to apply user api key added event: %w", err)
-			}
-
-			err = m.dbadapter.UserAddApiKey(
-				ctx,
-				aggregate.Id,
-				command.OrganizationId,
-				apiKeyId,
-				secretHash,
-				command.Name,
-				time.Now(),
-				command.ExpiresAt)
-			if err != nil {
-				return "", fmt.Errorf("failed to add api key in database: %w", err)
-			}
-
-			return apiKey, nil
+				Scopes:         scopes,
+				AllowedCidrs:   normalizeAllowedCidrs(command.AllowedCidrs),
+			}, command.ExpiresAt, agent)
 		})
+	if errors.Is(err, errServiceAccountOrganization) {
+		return r.StatusError[string](ubstatus.ValidationError, "Service account API keys must belong to the organization that owns the account"), nil
+	}
 	if err != nil {
 		status := MapEvercoreErrorToStatus(err)
 		slog.Error("Error generating api key", "error", err)
@@ -1059,7 +1539,7 @@ func (m *ManagementImpl) UserGetByApiKey(ctx context.Context,
 
 	// Verify the api key
 	secret := apiKey[ApiKeyIdLength:]
-	match, err := m.hashingService.VerifyBase64(secret, userApiKey.SecretHash)
+	match, rehash, err := m.verifyApiKeySecret(secret, userApiKey.SecretHash)
 	if err != nil {
 		slog.Error("Error verifying api key", "error", err)
 		return r.StatusError[UserAggregate](ubstatus.NotAuthorized, "API key is invalid"), nil
@@ -1078,7 +1558,20 @@ func (m *ManagementImpl) UserGetByApiKey(ctx context.Context,
 		return r.StatusError[UserAggregate](ubstatus.NotAuthorized, "API key is expired"), nil
 	}
 
-	return m.UserGetById(ctx, userApiKey.UserID)
+	response, err := m.UserGetById(ctx, userApiKey.UserID)
+	if err != nil || response.Status != ubstatus.Success {
+		return response, err
+	}
+
+	// Only keys that passed every check are upgraded. The key is valid
+	// either way, so a failed upgrade is retried on the next lookup.
+	state := response.Data.State
+	if rehash && !state.Disabled && !state.Erased {
+		if err := m.rehashApiKey(ctx, userApiKey.UserID, apiKeyId, secret); err != nil {
+			slog.Warn("Error rehashing api key", "apiKeyId", apiKeyId, "error", err)
+		}
+	}
+	return response, nil
 }
 
 func (m *ManagementImpl) UserDeleteApiKey(ctx context.Context,
@@ -1089,7 +1582,7 @@ func (m *ManagementImpl) UserDeleteApiKey(ctx context.Context,
 		ctx,
 		func(etx evercore.EventStoreContext) error {
 			aggregate := UserAggregate{}
-			err := etx.LoadStateInto(&aggregate, command.UserId)
+			err := loadActiveUserInto(etx, &aggregate, command.UserId)
 			if err != nil {
 				return fmt.Errorf("failed to load user: %w", err)
 			}
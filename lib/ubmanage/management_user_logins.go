@@ -0,0 +1,82 @@
+package ubmanage
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubdata"
+	r "github.com/kernelplex/ubase/lib/ubresponse"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+const maxLoginUserAgentLength = 512
+
+// sealLoginClientFor seals the client details for a login event on the given
+// user, generating the user's data key if needed.
+func (m *ManagementImpl) sealLoginClientFor(ctx context.Context,
+	aggregate *UserAggregate,
+	client LoginClient) (LoginClient, error) {
+
+	key, err := m.ensureUserDataKey(ctx, aggregate)
+	if err != nil {
+		return LoginClient{}, err
+	}
+	return sealLoginClient(key, normalizeLoginClient(client))
+}
+
+func normalizeLoginClient(client LoginClient) LoginClient {
+	client.IpAddress = strings.TrimSpace(client.IpAddress)
+	client.DeviceId = strings.TrimSpace(client.DeviceId)
+	if len(client.UserAgent) > maxLoginUserAgentLength {
+		client.UserAgent = client.UserAgent[:maxLoginUserAgentLength]
+	}
+	return client
+}
+
+// recordUserLogin projects a login event into the login history. The history
+// is informational, so failures are logged rather than failing the login.
+func (m *ManagementImpl) recordUserLogin(ctx context.Context,
+	userId int64,
+	occurredAt time.Time,
+	outcome string,
+	reason string,
+	client LoginClient) {
+
+	client = normalizeLoginClient(client)
+	err := m.dbadapter.AddUserLogin(ctx, ubdata.UserLogin{
+		UserID:     userId,
+		OccurredAt: occurredAt.Unix(),
+		Outcome:    outcome,
+		Reason:     reason,
+		IpAddress:  client.IpAddress,
+		UserAgent:  client.UserAgent,
+		DeviceId:   client.DeviceId,
+	})
+	if err != nil {
+		slog.Error("Error recording user login", "error", err, "userId", userId)
+	}
+}
+
+func (m *ManagementImpl) UserLoginHistory(ctx context.Context, userId int64, limit, offset int) (r.Response[[]ubdata.UserLogin], error) {
+	logins, err := m.dbadapter.ListUserLogins(ctx, userId, limit, offset)
+	if err != nil {
+		slog.Error("Error listing user logins", "error", err)
+		return r.Error[[]ubdata.UserLogin]("Error listing user logins"), err
+	}
+	return r.Success(logins), nil
+}
+
+func (m *ManagementImpl) UserLoginsByIp(ctx context.Context, ipAddress string, limit, offset int) (r.Response[[]ubdata.UserLogin], error) {
+	ipAddress = strings.TrimSpace(ipAddress)
+	if ipAddress == "" {
+		return r.StatusError[[]ubdata.UserLogin](ubstatus.ValidationError, "IP address is required"), nil
+	}
+	logins, err := m.dbadapter.SearchUserLoginsByIp(ctx, ipAddress, limit, offset)
+	if err != nil {
+		slog.Error("Error searching user logins", "error", err)
+		return r.Error[[]ubdata.UserLogin]("Error searching user logins"), err
+	}
+	return r.Success(logins), nil
+}
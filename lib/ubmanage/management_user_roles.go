@@ -2,6 +2,7 @@ package ubmanage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
@@ -59,30 +60,16 @@ func (m *ManagementImpl) UserAddToRole(ctx context.Context,
 	err := m.store.WithContext(
 		ctx,
 		func(etx evercore.EventStoreContext) error {
-			aggregate := UserRolesAggregate{}
-			// Identity aggregate
-			_, err := etx.LoadOrCreateAggregate(&aggregate, "UserRolesAggregate")
-			if err != nil {
-				return fmt.Errorf("failed to load user by ID: %w", err)
-			}
-
-			event := UserAddedToRoleEvent{
-				UserId: command.UserId,
-				RoleId: command.RoleId,
-			}
-			err = etx.ApplyEventTo(&aggregate, event, time.Now(), agent)
-			if err != nil {
-				return fmt.Errorf("failed to apply user added to role event: %w", err)
-			}
-
-			err = m.dbadapter.AddUserToRole(ctx, command.UserId, command.RoleId)
-			if err != nil {
-				return fmt.Errorf("failed to add user to role in database: %w", err)
-			}
-
-			return nil
+			return m.addUserToRole(ctx, etx, command, 0, agent)
 		})
 
+	if errors.Is(err, errServiceAccountOrganization) {
+		return r.StatusError[any](ubstatus.ValidationError, "Service accounts can only be given roles in the organization that owns them"), nil
+	}
+	var exclusive *exclusiveRoleError
+	if errors.As(err, &exclusive) {
+		return r.StatusError[any](ubstatus.ValidationError, exclusive.message()), nil
+	}
 	if err != nil {
 		slog.Error("Error adding user to role", "error", err)
 		return r.Response[any]{
@@ -96,6 +83,50 @@ func (m *ManagementImpl) UserAddToRole(ctx context.Context,
 	}, nil
 }
 
+// addUserToRole adds the membership in the event store and read model as part
+// of the caller's transaction. accessRequestId is the approved access request
+// that grants it, or zero for a direct grant.
+func (m *ManagementImpl) addUserToRole(ctx context.Context,
+	etx evercore.EventStoreContext,
+	command UserAddToRoleCommand,
+	accessRequestId int64,
+	agent string) error {
+
+	if err := checkServiceAccountRole(etx, command.UserId, command.RoleId); err != nil {
+		return err
+	}
+	if err := m.checkExclusiveRoles(ctx, etx, command.UserId, command.RoleId); err != nil {
+		return err
+	}
+
+	aggregate := UserRolesAggregate{}
+	// Identity aggregate
+	_, err := etx.LoadOrCreateAggregate(&aggregate, "UserRolesAggregate")
+	if err != nil {
+		return fmt.Errorf("failed to load user by ID: %w", err)
+	}
+
+	event := UserAddedToRoleEvent{
+		UserId:          command.UserId,
+		RoleId:          command.RoleId,
+		NotBefore:       unixOrZero(command.NotBefore),
+		ExpiresAt:       unixOrZero(command.ExpiresAt),
+		AccessRequestId: accessRequestId,
+	}
+	now := time.Now()
+	err = etx.ApplyEventTo(&aggregate, event, now, agent)
+	if err != nil {
+		return fmt.Errorf("failed to apply user added to role event: %w", err)
+	}
+
+	err = m.dbadapter.AddUserToRole(ctx, command.UserId, command.RoleId, event.NotBefore, event.ExpiresAt, now.UnixNano(), accessRequestId)
+	if err != nil {
+		return fmt.Errorf("failed to add user to role in database: %w", err)
+	}
+
+	return nil
+}
+
 func (m *ManagementImpl) UserRemoveFromRole(ctx context.Context,
 	command UserRemoveFromRoleCommand,
 	agent string) (r.Response[any], error) {
@@ -113,27 +144,7 @@ func (m *ManagementImpl) UserRemoveFromRole(ctx context.Context,
 	err := m.store.WithContext(
 		ctx,
 		func(etx evercore.EventStoreContext) error {
-			aggregate := UserRolesAggregate{}
-			_, err := etx.LoadOrCreateAggregate(&aggregate, "UserRolesAggregate")
-			if err != nil {
-				return fmt.Errorf("failed to load user by ID: %w", err)
-			}
-
-			event := UserRemovedFromRoleEvent{
-				UserId: command.UserId,
-				RoleId: command.RoleId,
-			}
-			err = etx.ApplyEventTo(&aggregate, event, time.Now(), agent)
-			if err != nil {
-				return fmt.Errorf("failed to apply user removed from role event: %w", err)
-			}
-
-			err = m.dbadapter.RemoveUserFromRole(ctx, command.UserId, command.RoleId)
-			if err != nil {
-				return fmt.Errorf("failed to remove user from role in database: %w", err)
-			}
-
-			return nil
+			return m.removeUserFromRole(ctx, etx, command, agent)
 		})
 
 	if err != nil {
@@ -148,3 +159,93 @@ func (m *ManagementImpl) UserRemoveFromRole(ctx context.Context,
 		Status: ubstatus.Success,
 	}, nil
 }
+
+// removeUserFromRole removes the membership in the event store and read model
+// as part of the caller's transaction.
+func (m *ManagementImpl) removeUserFromRole(ctx context.Context,
+	etx evercore.EventStoreContext,
+	command UserRemoveFromRoleCommand,
+	agent string) error {
+
+	aggregate := UserRolesAggregate{}
+	_, err := etx.LoadOrCreateAggregate(&aggregate, "UserRolesAggregate")
+	if err != nil {
+		return fmt.Errorf("failed to load user by ID: %w", err)
+	}
+
+	event := UserRemovedFromRoleEvent{
+		UserId: command.UserId,
+		RoleId: command.RoleId,
+	}
+	err = etx.ApplyEventTo(&aggregate, event, time.Now(), agent)
+	if err != nil {
+		return fmt.Errorf("failed to apply user removed from role event: %w", err)
+	}
+
+	err = m.dbadapter.RemoveUserFromRole(ctx, command.UserId, command.RoleId)
+	if err != nil {
+		return fmt.Errorf("failed to remove user from role in database: %w", err)
+	}
+
+	return nil
+}
+
+// UserRolesExpire removes the role memberships which expired at or before
+// now, and returns how many were removed.
+func (m *ManagementImpl) UserRolesExpire(ctx context.Context, now time.Time, agent string) (r.Response[int], error) {
+	expired, err := m.dbadapter.ListExpiredUserRoles(ctx, now.Unix())
+	if err != nil {
+		slog.Error("Error listing expired role memberships", "error", err)
+		return r.Error[int]("Error listing expired role memberships"), err
+	}
+
+	removed := 0
+	for _, membership := range expired {
+		expiredNow := false
+		err := m.store.WithContext(
+			ctx,
+			func(etx evercore.EventStoreContext) error {
+				aggregate := UserRolesAggregate{}
+				_, err := etx.LoadOrCreateAggregate(&aggregate, "UserRolesAggregate")
+				if err != nil {
+					return fmt.Errorf("failed to load user roles aggregate: %w", err)
+				}
+
+				// The membership may have been renewed or removed, here or by
+				// another instance, since it was listed.
+				current, held, err := m.dbadapter.GetUserRole(ctx, membership.UserID, membership.RoleID)
+				if err != nil {
+					return fmt.Errorf("failed to get user role: %w", err)
+				}
+				if !held || current.ExpiresAt == 0 || current.ExpiresAt > now.Unix() {
+					return nil
+				}
+
+				event := UserRemovedFromRoleEvent{
+					UserId:  membership.UserID,
+					RoleId:  membership.RoleID,
+					Expired: true,
+				}
+				err = etx.ApplyEventTo(&aggregate, event, now, agent)
+				if err != nil {
+					return fmt.Errorf("failed to apply user removed from role event: %w", err)
+				}
+
+				err = m.dbadapter.RemoveUserFromRole(ctx, membership.UserID, membership.RoleID)
+				if err != nil {
+					return fmt.Errorf("failed to remove user from role in database: %w", err)
+				}
+				expiredNow = true
+				return nil
+			})
+		if err != nil {
+			slog.Error("Error expiring role membership", "error", err, "userId", membership.UserID, "roleId", membership.RoleID)
+			return r.Error[int]("Error expiring role memberships"), err
+		}
+		if expiredNow {
+			removed++
+		}
+	}
+
+	return r.Success(removed), nil
+}
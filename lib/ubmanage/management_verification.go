@@ -0,0 +1,375 @@
+package ubmanage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	evercore "github.com/kernelplex/evercore/base"
+	"github.com/kernelplex/ubase/lib/ubmailer"
+	"github.com/kernelplex/ubase/lib/ubratelimit"
+	r "github.com/kernelplex/ubase/lib/ubresponse"
+	"github.com/kernelplex/ubase/lib/ubsecurity"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+// VerificationLinkPath is where links in verification emails point.
+const VerificationLinkPath = "/admin/verify"
+
+const (
+	defaultVerificationTokenTTL       = 48 * time.Hour
+	defaultVerificationResendCooldown = time.Minute
+	verificationLinkPurpose           = "email-verification"
+)
+
+const invalidVerificationMessage = "This verification link is invalid or has expired."
+
+var (
+	errInvalidVerificationLink  = errors.New("invalid verification link")
+	errVerificationUnknownUser  = errors.New("no user to verify")
+	errVerificationAlreadyDone  = errors.New("user is already verified")
+	errVerificationTokenInvalid = errors.New("verification token is invalid or has expired")
+)
+
+type verificationCooldownError struct {
+	wait time.Duration
+}
+
+func (e *verificationCooldownError) Error() string {
+	return fmt.Sprintf("verification email requested too soon, retry in %s", e.wait)
+}
+
+type VerificationOptions struct {
+	// TokenTTL is how long a verification token stays valid.
+	TokenTTL time.Duration
+
+	// ResendCooldown is the minimum time between verification emails for
+	// the same user.
+	ResendCooldown time.Duration
+
+	// BaseUrl is the externally visible address of the admin panel and is
+	// used to build verification links.
+	BaseUrl string
+
+	// Mailer sends verification links to new and resending users. Without
+	// it the caller is responsible for delivering the token.
+	Mailer EmailSender
+}
+
+func WithVerificationOptions(options VerificationOptions) ManagementOption {
+	return func(m *ManagementImpl) {
+		m.verificationOptions = options
+	}
+}
+
+// verificationLinkClaims are encrypted into verification link tokens so the
+// link identifies the user as well as carrying their token.
+type verificationLinkClaims struct {
+	Purpose   string `json:"purpose"`
+	UserId    int64  `json:"userId"`
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+type verificationToken struct {
+	Token     string
+	ExpiresAt int64
+	LinkToken string
+}
+
+// issueVerificationToken replaces the user's verification token.
+func (m *ManagementImpl) issueVerificationToken(etx evercore.EventStoreContext,
+	aggregate *UserAggregate,
+	regenerate bool,
+	now time.Time,
+	agent string) (verificationToken, error) {
+
+	token := ubsecurity.GenerateSecureRandomString(VerificationTokenLength)
+	encryptedToken, err := m.encryptionService.Encrypt64(token)
+	if err != nil {
+		return verificationToken{}, fmt.Errorf("failed to encrypt verification token: %w", err)
+	}
+	expiresAt := now.Add(m.verificationOptions.TokenTTL).Unix()
+
+	event := UserVerificationTokenGeneratedEvent{
+		Token:       encryptedToken,
+		Regenerated: regenerate,
+		ExpiresAt:   expiresAt,
+	}
+	if err := etx.ApplyEventTo(aggregate, event, now, agent); err != nil {
+		return verificationToken{}, fmt.Errorf("failed to apply user verification token generated event: %w", err)
+	}
+
+	linkToken, err := m.verificationLinkToken(aggregate.Id, token, expiresAt)
+	if err != nil {
+		return verificationToken{}, err
+	}
+	return verificationToken{Token: token, ExpiresAt: expiresAt, LinkToken: linkToken}, nil
+}
+
+// verificationTokenExpiresAt returns when the user's pending token expires.
+// Tokens issued before expiry was recorded expire one TTL after they were
+// generated.
+func (m *ManagementImpl) verificationTokenExpiresAt(state *UserState) int64 {
+	if state.VerificationTokenExpiresAt != 0 {
+		return state.VerificationTokenExpiresAt
+	}
+	return time.Unix(state.VerificationTokenGeneratedAt, 0).Add(m.verificationOptions.TokenTTL).Unix()
+}
+
+// verificationCooldown returns how long the user must wait before another
+// verification email can be sent.
+func (m *ManagementImpl) verificationCooldown(state *UserState, now time.Time) time.Duration {
+	if state.VerificationToken == nil || state.VerificationTokenGeneratedAt == 0 {
+		return 0
+	}
+	next := time.Unix(state.VerificationTokenGeneratedAt, 0).Add(m.verificationOptions.ResendCooldown)
+	return max(next.Sub(now), 0)
+}
+
+// checkVerificationToken reports whether token is the user's pending,
+// unexpired verification token.
+func (m *ManagementImpl) checkVerificationToken(state *UserState, token string, now time.Time) (bool, error) {
+	if state.VerificationToken == nil {
+		return false, nil
+	}
+	if now.Unix() > m.verificationTokenExpiresAt(state) {
+		return false, nil
+	}
+	decrypted, err := m.encryptionService.Decrypt64(*state.VerificationToken)
+	if err != nil {
+		return false, fmt.Errorf("failed to decrypt verification token: %w", err)
+	}
+	return secretHashesMatch(string(decrypted), token), nil
+}
+
+func (m *ManagementImpl) verificationLinkToken(userId int64, token string, expiresAt int64) (string, error) {
+	data, err := json.Marshal(verificationLinkClaims{
+		Purpose:   verificationLinkPurpose,
+		UserId:    userId,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal verification link token: %w", err)
+	}
+	linkToken, err := m.encryptionService.Encrypt64(string(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt verification link token: %w", err)
+	}
+	return linkToken, nil
+}
+
+func (m *ManagementImpl) parseVerificationLinkToken(linkToken string) (verificationLinkClaims, error) {
+	data, err := m.encryptionService.Decrypt64(linkToken)
+	if err != nil {
+		return verificationLinkClaims{}, errInvalidVerificationLink
+	}
+	var claims verificationLinkClaims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return verificationLinkClaims{}, errInvalidVerificationLink
+	}
+	if claims.Purpose != verificationLinkPurpose || claims.UserId <= 0 || claims.Token == "" {
+		return verificationLinkClaims{}, errInvalidVerificationLink
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		return verificationLinkClaims{}, errInvalidVerificationLink
+	}
+	return claims, nil
+}
+
+func (m *ManagementImpl) verificationLinkUrl(linkToken string) string {
+	return strings.TrimRight(m.verificationOptions.BaseUrl, "/") + VerificationLinkPath + "?token=" + url.QueryEscape(linkToken)
+}
+
+var verificationHtmlTemplate = template.Must(template.New("verification").Parse(`<p>Confirm your email address by opening this link:</p>
+<p><a href="{{.LinkUrl}}">Verify email address</a></p>
+<p>This link expires at {{.Expires}}. If you did not create an account, you can ignore this email.</p>
+`))
+
+func verificationEmail(email, linkUrl string, expiresAt int64) ubmailer.EmailJob {
+	expires := time.Unix(expiresAt, 0).UTC().Format(time.RFC1123)
+
+	text := fmt.Sprintf("Confirm your email address by opening this link:\n%s\n\nThis link expires at %s. If you did not create an account, you can ignore this email.\n",
+		linkUrl, expires)
+
+	var html strings.Builder
+	err := verificationHtmlTemplate.Execute(&html, struct {
+		LinkUrl string
+		Expires string
+	}{linkUrl, expires})
+	if err != nil {
+		slog.Error("Error rendering verification email", "error", err)
+		html.Reset()
+	}
+
+	return ubmailer.EmailJob{
+		To:       email,
+		Subject:  "Verify your email address",
+		TextBody: text,
+		HtmlBody: html.String(),
+	}
+}
+
+// sendVerificationEmail emails a verification link when a mailer is
+// configured, reporting whether it did.
+func (m *ManagementImpl) sendVerificationEmail(email, linkUrl string, expiresAt int64) bool {
+	if m.verificationOptions.Mailer == nil {
+		return false
+	}
+	m.verificationOptions.Mailer.Send(verificationEmail(email, linkUrl, expiresAt))
+	return true
+}
+
+// verifyUser marks the user verified when token is their pending token.
+func (m *ManagementImpl) verifyUser(ctx context.Context, userId int64, token string, agent string) error {
+	return m.store.WithContext(
+		ctx,
+		func(etx evercore.EventStoreContext) error {
+			aggregate := UserAggregate{}
+			err := loadActiveUserInto(etx, &aggregate, userId)
+			if err != nil {
+				return fmt.Errorf("failed to load user: %w", err)
+			}
+
+			now := time.Now()
+			match, err := m.checkVerificationToken(&aggregate.State, token, now)
+			if err != nil {
+				return err
+			}
+			if !match {
+				return errVerificationTokenInvalid
+			}
+
+			event := UserVerificationTokenVerifiedEvent{}
+			err = etx.ApplyEventTo(&aggregate, event, now, agent)
+			if err != nil {
+				return fmt.Errorf("failed to apply user verification token verified event: %w", err)
+			}
+
+			pii, err := m.userPII(ctx, &aggregate)
+			if err != nil {
+				return err
+			}
+
+			err = m.dbadapter.UpdateUser(
+				ctx,
+				aggregate.Id,
+				pii.FirstName,
+				pii.LastName,
+				pii.DisplayName,
+				pii.Email,
+				aggregate.State.Verified,
+				aggregate.State.UpdatedAt)
+			if err != nil {
+				return fmt.Errorf("failed to set user verified in database: %w", err)
+			}
+
+			return nil
+		})
+}
+
+func (m *ManagementImpl) UserVerifyLink(ctx context.Context,
+	command UserVerifyLinkCommand,
+	agent string) (r.Response[any], error) {
+
+	if ok, issues := command.Validate(); !ok {
+		return r.ValidationError[any](issues), nil
+	}
+
+	claims, err := m.parseVerificationLinkToken(command.Token)
+	if err != nil {
+		return r.StatusError[any](ubstatus.NotAuthorized, invalidVerificationMessage), nil
+	}
+
+	err = m.verifyUser(ctx, claims.UserId, claims.Token, agent)
+	if err != nil {
+		if errors.Is(err, errVerificationTokenInvalid) || errors.Is(err, errUserErased) ||
+			MapEvercoreErrorToStatus(err) == ubstatus.NotFound {
+			return r.StatusError[any](ubstatus.NotAuthorized, invalidVerificationMessage), nil
+		}
+		slog.Error("Error verifying user from link", "error", err)
+		return r.Error[any]("Error verifying user"), err
+	}
+	return r.SuccessAny(), nil
+}
+
+func (m *ManagementImpl) UserResendVerification(ctx context.Context,
+	command UserResendVerificationCommand,
+	agent string) (r.Response[UserResendVerificationResponse], error) {
+
+	if ok, issues := command.Validate(); !ok {
+		return r.ValidationError[UserResendVerificationResponse](issues), nil
+	}
+
+	result, err := evercore.InContext(
+		ctx,
+		m.store,
+		func(etx evercore.EventStoreContext) (UserResendVerificationResponse, error) {
+			aggregate := UserAggregate{}
+			var err error
+			if command.Id != 0 {
+				err = loadActiveUserInto(etx, &aggregate, command.Id)
+			} else {
+				err = etx.LoadStateByKeyInto(&aggregate, command.Email)
+				if err == nil && aggregate.State.Erased {
+					err = errUserErased
+				}
+			}
+			if err != nil {
+				if errors.Is(err, errUserErased) || MapEvercoreErrorToStatus(err) == ubstatus.NotFound {
+					return UserResendVerificationResponse{}, errVerificationUnknownUser
+				}
+				return UserResendVerificationResponse{}, fmt.Errorf("failed to load user: %w", err)
+			}
+
+			if aggregate.State.Verified {
+				return UserResendVerificationResponse{}, errVerificationAlreadyDone
+			}
+			now := time.Now()
+			if wait := m.verificationCooldown(&aggregate.State, now); wait > 0 {
+				return UserResendVerificationResponse{}, &verificationCooldownError{wait: wait}
+			}
+
+			token, err := m.issueVerificationToken(etx, &aggregate, true, now, agent)
+			if err != nil {
+				return UserResendVerificationResponse{}, err
+			}
+
+			pii, err := m.userPII(ctx, &aggregate)
+			if err != nil {
+				return UserResendVerificationResponse{}, err
+			}
+
+			return UserResendVerificationResponse{
+				UserId:    aggregate.Id,
+				Email:     pii.Email,
+				Token:     token.Token,
+				ExpiresAt: token.ExpiresAt,
+				LinkUrl:   m.verificationLinkUrl(token.LinkToken),
+			}, nil
+		})
+
+	if err != nil {
+		if errors.Is(err, errVerificationUnknownUser) {
+			return r.StatusError[UserResendVerificationResponse](ubstatus.NotFound, "User not found"), nil
+		}
+		if errors.Is(err, errVerificationAlreadyDone) {
+			return r.StatusError[UserResendVerificationResponse](ubstatus.ValidationError, "This account is already verified"), nil
+		}
+		if cooldown := (&verificationCooldownError{}); errors.As(err, &cooldown) {
+			return r.RateLimited[UserResendVerificationResponse]("A verification email was sent recently. Wait before requesting another.", ubratelimit.RetryAfterSeconds(cooldown.wait)), nil
+		}
+		slog.Error("Error resending verification", "error", err)
+		return r.Error[UserResendVerificationResponse]("Could not send a verification email at this time."), err
+	}
+
+	result.Sent = m.sendVerificationEmail(result.Email, result.LinkUrl, result.ExpiresAt)
+	return r.Success(result), nil
+}
@@ -0,0 +1,126 @@
+package ubmanage
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newVerificationTestManagement() *ManagementImpl {
+	m := newPIITestManagement()
+	m.verificationOptions = VerificationOptions{
+		TokenTTL:       time.Hour,
+		ResendCooldown: time.Minute,
+		BaseUrl:        "https://ubase.test/",
+	}
+	return m
+}
+
+func TestVerificationLinkToken(t *testing.T) {
+	m := newVerificationTestManagement()
+	expiresAt := time.Now().Add(time.Minute).Unix()
+
+	token, err := m.verificationLinkToken(42, "ABCDEFGHIJ", expiresAt)
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	if strings.Contains(token, "ABCDEFGHIJ") {
+		t.Fatal("expected verification token to be hidden in the link token")
+	}
+	claims, err := m.parseVerificationLinkToken(token)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if claims.UserId != 42 || claims.Token != "ABCDEFGHIJ" || claims.ExpiresAt != expiresAt {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+
+	url := m.verificationLinkUrl(token)
+	if !strings.HasPrefix(url, "https://ubase.test/admin/verify?token=") {
+		t.Fatalf("unexpected link %q", url)
+	}
+
+	expired, err := m.verificationLinkToken(42, "ABCDEFGHIJ", time.Now().Add(-time.Minute).Unix())
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	if _, err := m.parseVerificationLinkToken(expired); err == nil {
+		t.Fatal("expected expired token to be rejected")
+	}
+
+	login, _, err := m.emailLoginLinkToken(42, "browser-secret", expiresAt)
+	if err != nil {
+		t.Fatalf("login token: %v", err)
+	}
+	if _, err := m.parseVerificationLinkToken(login); err == nil {
+		t.Fatal("expected token for another purpose to be rejected")
+	}
+}
+
+func TestCheckVerificationToken(t *testing.T) {
+	m := newVerificationTestManagement()
+	now := time.Now()
+
+	sealed, err := m.encryptionService.Encrypt64("ABCDEFGHIJ")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	agg := &UserAggregate{}
+	event := UserVerificationTokenGeneratedEvent{Token: sealed, ExpiresAt: now.Add(time.Hour).Unix()}
+	if err := agg.ApplyEventState(event, now, "tester"); err != nil {
+		t.Fatalf("apply token generated: %v", err)
+	}
+
+	if ok, err := m.checkVerificationToken(&agg.State, "ABCDEFGHIJ", now); err != nil || !ok {
+		t.Fatalf("expected token to match, got %v %v", ok, err)
+	}
+	if ok, _ := m.checkVerificationToken(&agg.State, "JIHGFEDCBA", now); ok {
+		t.Fatal("expected other token not to match")
+	}
+	if ok, _ := m.checkVerificationToken(&agg.State, "ABCDEFGHIJ", now.Add(2*time.Hour)); ok {
+		t.Fatal("expected expired token not to match")
+	}
+
+	// Tokens issued before expiry was recorded expire one TTL after they
+	// were generated.
+	legacy := &UserAggregate{}
+	if err := legacy.ApplyEventState(UserVerificationTokenGeneratedEvent{Token: sealed}, now, "tester"); err != nil {
+		t.Fatalf("apply legacy token generated: %v", err)
+	}
+	if ok, _ := m.checkVerificationToken(&legacy.State, "ABCDEFGHIJ", now.Add(30*time.Minute)); !ok {
+		t.Fatal("expected legacy token to match within the TTL")
+	}
+	if ok, _ := m.checkVerificationToken(&legacy.State, "ABCDEFGHIJ", now.Add(2*time.Hour)); ok {
+		t.Fatal("expected legacy token to expire after the TTL")
+	}
+
+	if wait := m.verificationCooldown(&agg.State, now.Add(10*time.Second)); wait <= 0 || wait > 50*time.Second {
+		t.Fatalf("expected cooldown of up to 50s, got %s", wait)
+	}
+	if wait := m.verificationCooldown(&agg.State, now.Add(2*time.Minute)); wait != 0 {
+		t.Fatalf("expected cooldown to have passed, got %s", wait)
+	}
+
+	if err := agg.ApplyEventState(UserVerificationTokenVerifiedEvent{}, now, "tester"); err != nil {
+		t.Fatalf("apply token verified: %v", err)
+	}
+	if ok, _ := m.checkVerificationToken(&agg.State, "ABCDEFGHIJ", now); ok {
+		t.Fatal("expected used token not to match")
+	}
+	if wait := m.verificationCooldown(&agg.State, now); wait != 0 {
+		t.Fatalf("expected no cooldown once verified, got %s", wait)
+	}
+}
+
+func TestVerificationEmail(t *testing.T) {
+	job := verificationEmail("user@example.com", "https://ubase.test/admin/verify?token=a&b", time.Now().Add(time.Hour).Unix())
+	if job.To != "user@example.com" {
+		t.Fatalf("unexpected recipient %q", job.To)
+	}
+	if !strings.Contains(job.TextBody, "https://ubase.test/admin/verify?token=a&b") {
+		t.Fatalf("expected link in text body: %s", job.TextBody)
+	}
+	if !strings.Contains(job.HtmlBody, "token=a&amp;b") {
+		t.Fatalf("expected escaped link in html body: %s", job.HtmlBody)
+	}
+}
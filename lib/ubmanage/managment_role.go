@@ -2,16 +2,22 @@ package ubmanage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
 	evercore "github.com/kernelplex/evercore/base"
 	"github.com/kernelplex/ubase/lib/ubdata"
 	r "github.com/kernelplex/ubase/lib/ubresponse"
 	"github.com/kernelplex/ubase/lib/ubstatus"
+	"github.com/kernelplex/ubase/lib/ubvalidation"
 )
 
+var errRolePermissionNotGranted = errors.New("role does not grant the permission")
+var errRoleNotInOrganization = errors.New("role does not belong to the organization")
+
 func (m *ManagementImpl) RoleList(ctx context.Context, OrganizationId int64) (r.Response[[]ubdata.RoleRow], error) {
 	roles, err := m.dbadapter.GetOrganizationRoles(ctx, OrganizationId)
 	if err != nil {
@@ -50,26 +56,10 @@ func (m *ManagementImpl) RoleAdd(ctx context.Context,
 		ctx,
 		m.store,
 		func(etx evercore.EventStoreContext) (int64, error) {
-			aggregate := RoleAggregate{}
-			err := etx.CreateAggregateWithKeyInto(&aggregate, command.SystemName)
-			if err != nil {
-				return 0, fmt.Errorf("failed to create aggregate: %w", err)
-			}
-			event := evercore.NewStateEvent(RoleCreatedEvent{
-				OrganizationId: command.OrganizationId,
-				Name:           command.Name,
-				SystemName:     command.SystemName,
-			})
-			err = etx.ApplyEventTo(&aggregate, event, time.Now(), agent)
+			aggregate, err := m.addRole(ctx, etx, command, agent)
 			if err != nil {
-				return 0, fmt.Errorf("failed to apply role added event: %w", err)
+				return 0, err
 			}
-
-			err = m.dbadapter.AddRole(ctx, aggregate.Id, aggregate.State.OrganizationId, aggregate.State.Name, aggregate.State.SystemName)
-			if err != nil {
-				return 0, fmt.Errorf("failed to add role in database: %w", err)
-			}
-
 			return aggregate.Id, nil
 		})
 
@@ -90,6 +80,36 @@ func (m *ManagementImpl) RoleAdd(ctx context.Context,
 	}, nil
 }
 
+// addRole creates the role in the event store and read model as part of the
+// caller's transaction.
+func (m *ManagementImpl) addRole(ctx context.Context,
+	etx evercore.EventStoreContext,
+	command RoleCreateCommand,
+	agent string) (*RoleAggregate, error) {
+
+	aggregate := &RoleAggregate{}
+	err := etx.CreateAggregateWithKeyInto(aggregate, command.SystemName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create aggregate: %w", err)
+	}
+	event := evercore.NewStateEvent(RoleCreatedEvent{
+		OrganizationId: command.OrganizationId,
+		Name:           command.Name,
+		SystemName:     command.SystemName,
+	})
+	err = etx.ApplyEventTo(aggregate, event, time.Now(), agent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply role added event: %w", err)
+	}
+
+	err = m.dbadapter.AddRole(ctx, aggregate.Id, aggregate.State.OrganizationId, aggregate.State.Name, aggregate.State.SystemName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add role in database: %w", err)
+	}
+
+	return aggregate, nil
+}
+
 func (m *ManagementImpl) RoleUpdate(ctx context.Context,
 	command RoleUpdateCommand,
 	agent string) (r.Response[any], error) {
@@ -244,6 +264,13 @@ func (m *ManagementImpl) RolePermissionAdd(ctx context.Context,
 
 	// Validation
 	ok, issues := command.Validate()
+	if ok && m.permissionCatalog != nil && !m.permissionCatalog.Allows(command.Permission) {
+		ok = false
+		issues = append(issues, ubvalidation.ValidationIssue{
+			Field: "permission",
+			Error: []string{"Unknown permission"},
+		})
+	}
 	if !ok {
 		return r.Response[any]{
 			Status:           ubstatus.ValidationError,
@@ -344,6 +371,153 @@ func (m *ManagementImpl) RolePermissionRemove(ctx context.Context,
 	}, nil
 }
 
+func (m *ManagementImpl) RolePermissionPolicySet(ctx context.Context,
+	command RolePermissionPolicySetCommand,
+	agent string) (r.Response[any], error) {
+
+	ok, issues := command.Validate()
+	if !ok {
+		return r.ValidationError[any](issues), nil
+	}
+
+	err := m.store.WithContext(
+		ctx,
+		func(etx evercore.EventStoreContext) error {
+			aggregate := RoleAggregate{}
+			err := etx.LoadStateInto(&aggregate, command.Id)
+			if err != nil {
+				return fmt.Errorf("failed to load role: %w", err)
+			}
+			if !slices.Contains(aggregate.State.Permissions, command.Permission) {
+				return errRolePermissionNotGranted
+			}
+			if aggregate.State.Policies[command.Permission] == command.Policy {
+				return nil
+			}
+
+			event := RolePermissionPolicySetEvent{
+				Permission: command.Permission,
+				Policy:     command.Policy,
+			}
+			err = etx.ApplyEventTo(&aggregate, event, time.Now(), agent)
+			if err != nil {
+				return fmt.Errorf("failed to apply role permission policy set event: %w", err)
+			}
+			return nil
+		})
+
+	if err != nil {
+		if errors.Is(err, errRolePermissionNotGranted) {
+			return r.ValidationError[any]([]ubvalidation.ValidationIssue{
+				{Field: "permission", Error: []string{"The role does not grant this permission"}},
+			}), nil
+		}
+		status := MapEvercoreErrorToStatus(err)
+		slog.Error("Error setting role permission policy", "error", err)
+		return r.StatusError[any](status, "Error setting role permission policy"), err
+	}
+
+	return r.SuccessAny(), nil
+}
+
+func (m *ManagementImpl) RolePermissionsApply(ctx context.Context,
+	command RolePermissionsApplyCommand,
+	agent string) (r.Response[any], error) {
+
+	ok, issues := command.Validate()
+	if ok && m.permissionCatalog != nil {
+		for _, change := range command.Changes {
+			if change.Grant && !m.permissionCatalog.Allows(change.Permission) {
+				ok = false
+				issues = append(issues, ubvalidation.ValidationIssue{
+					Field: "permission",
+					Error: []string{"Unknown permission " + change.Permission},
+				})
+			}
+		}
+	}
+	if !ok {
+		return r.ValidationError[any](issues), nil
+	}
+
+	err := m.store.WithContext(
+		ctx,
+		func(etx evercore.EventStoreContext) error {
+			// All roles are checked before any change is made.
+			roles := map[int64]*RoleAggregate{}
+			for _, change := range command.Changes {
+				if _, found := roles[change.RoleId]; found {
+					continue
+				}
+				aggregate := &RoleAggregate{}
+				err := etx.LoadStateInto(aggregate, change.RoleId)
+				if err != nil {
+					return fmt.Errorf("failed to load role: %w", err)
+				}
+				if aggregate.State.OrganizationId != command.OrganizationId {
+					return errRoleNotInOrganization
+				}
+				roles[change.RoleId] = aggregate
+			}
+
+			now := time.Now()
+			for _, change := range command.Changes {
+				err := m.applyRolePermissionChange(ctx, etx, roles[change.RoleId], change, now, agent)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+	if err != nil {
+		if errors.Is(err, errRoleNotInOrganization) {
+			return r.ValidationError[any]([]ubvalidation.ValidationIssue{
+				{Field: "role_id", Error: []string{"The role does not belong to the organization"}},
+			}), nil
+		}
+		status := MapEvercoreErrorToStatus(err)
+		slog.Error("Error applying role permission changes", "error", err)
+		return r.StatusError[any](status, "Error applying role permission changes"), err
+	}
+
+	return r.SuccessAny(), nil
+}
+
+// applyRolePermissionChange grants or revokes the permission as part of the
+// caller's transaction. Changes the role already reflects are skipped.
+func (m *ManagementImpl) applyRolePermissionChange(ctx context.Context,
+	etx evercore.EventStoreContext,
+	aggregate *RoleAggregate,
+	change RolePermissionChange,
+	now time.Time,
+	agent string) error {
+
+	if slices.Contains(aggregate.State.Permissions, change.Permission) == change.Grant {
+		return nil
+	}
+	if change.Grant {
+		err := etx.ApplyEventTo(aggregate, RolePermissionAddedEvent{Permission: change.Permission}, now, agent)
+		if err != nil {
+			return fmt.Errorf("failed to apply role permission added event: %w", err)
+		}
+		err = m.dbadapter.AddPermissionToRole(ctx, aggregate.Id, change.Permission)
+		if err != nil {
+			return fmt.Errorf("failed to add permission to role in database: %w", err)
+		}
+		return nil
+	}
+	err := etx.ApplyEventTo(aggregate, RolePermissionRemovedEvent{Permission: change.Permission}, now, agent)
+	if err != nil {
+		return fmt.Errorf("failed to apply role permission removed event: %w", err)
+	}
+	err = m.dbadapter.RemovePermissionFromRole(ctx, aggregate.Id, change.Permission)
+	if err != nil {
+		return fmt.Errorf("failed to remove permission from role in database: %w", err)
+	}
+	return nil
+}
+
 func (m *ManagementImpl) RoleGetBySystemName(ctx context.Context,
 	systemName string) (r.Response[RoleAggregate], error) {
 
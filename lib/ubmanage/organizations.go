@@ -2,6 +2,7 @@ package ubmanage
 
 import (
 	"maps"
+	"slices"
 	"time"
 
 	evercore "github.com/kernelplex/evercore/base"
@@ -15,6 +16,9 @@ type OrganizationState struct {
 	SystemName string            `json:"systemName"`
 	Status     string            `json:"status"`
 	Settings   map[string]string `json:"settings"`
+	// ExclusiveRoleSets are the sets of the organization's roles no user may
+	// hold more than one of.
+	ExclusiveRoleSets []ExclusiveRoleSet `json:"exclusiveRoleSets,omitempty"`
 }
 
 // evercore:aggregate
@@ -39,6 +43,19 @@ func (t *OrganizationAggregate) ApplyEventState(eventState evercore.EventState,
 			delete(t.State.Settings, key)
 		}
 		return nil
+	case OrganizationExclusiveRoleSetSavedEvent:
+		set := ExclusiveRoleSet{Name: ev.Name, RoleIds: slices.Clone(ev.RoleIds)}
+		if i := t.State.ExclusiveRoleSet(ev.Name); i >= 0 {
+			t.State.ExclusiveRoleSets[i] = set
+		} else {
+			t.State.ExclusiveRoleSets = append(t.State.ExclusiveRoleSets, set)
+		}
+		return nil
+	case OrganizationExclusiveRoleSetRemovedEvent:
+		if i := t.State.ExclusiveRoleSet(ev.Name); i >= 0 {
+			t.State.ExclusiveRoleSets = slices.Delete(t.State.ExclusiveRoleSets, i, i+1)
+		}
+		return nil
 	}
 
 	return t.StateAggregate.ApplyEventState(eventState, eventTime, reference)
@@ -53,6 +70,9 @@ type OrganizationCreateCommand struct {
 	Name       string `json:"name"`
 	SystemName string `json:"systemName"`
 	Status     string `json:"status"`
+	// ApplyRoleTemplates creates the role templates' roles in the new
+	// organization.
+	ApplyRoleTemplates bool `json:"applyRoleTemplates"`
 }
 
 func (c OrganizationCreateCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
@@ -0,0 +1,117 @@
+package ubmanage
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+
+	"github.com/kernelplex/ubase/lib/ensure"
+)
+
+// PermissionDefinition describes a permission an application checks.
+type PermissionDefinition struct {
+	// Name is the system name checked in code, such as "refunds:create".
+	Name string `json:"name"`
+	// DisplayName is shown in the admin panel instead of the name.
+	DisplayName string `json:"display_name,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Group collects related permissions in the admin panel.
+	Group string `json:"group,omitempty"`
+	// Dangerous marks permissions that should be granted with care.
+	Dangerous bool `json:"dangerous,omitempty"`
+}
+
+// Title returns the display name, or the name when there is none.
+func (d PermissionDefinition) Title() string {
+	if d.DisplayName != "" {
+		return d.DisplayName
+	}
+	return d.Name
+}
+
+// PermissionGroup is a group of permission definitions.
+type PermissionGroup struct {
+	Name        string
+	Permissions []PermissionDefinition
+}
+
+// PermissionCatalog is the registry of permissions an application declares.
+// Roles can only be granted declared permissions, unless the catalog is
+// empty, so applications which do not declare their permissions keep
+// working. It is safe for concurrent use.
+type PermissionCatalog struct {
+	mu          sync.RWMutex
+	definitions map[string]PermissionDefinition
+}
+
+func NewPermissionCatalog(definitions ...PermissionDefinition) *PermissionCatalog {
+	catalog := &PermissionCatalog{definitions: make(map[string]PermissionDefinition)}
+	catalog.Register(definitions...)
+	return catalog
+}
+
+// Register declares permissions, replacing earlier definitions with the same
+// name.
+func (c *PermissionCatalog) Register(definitions ...PermissionDefinition) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, definition := range definitions {
+		ensure.That(definition.Name != "", "permission name cannot be empty")
+		c.definitions[definition.Name] = definition
+	}
+}
+
+func (c *PermissionCatalog) Lookup(name string) (PermissionDefinition, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	definition, found := c.definitions[name]
+	return definition, found
+}
+
+// Allows reports whether roles may be granted the permission.
+func (c *PermissionCatalog) Allows(name string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.definitions) == 0 {
+		return true
+	}
+	_, found := c.definitions[name]
+	return found
+}
+
+// Definitions returns the declared permissions sorted by group, then name.
+func (c *PermissionCatalog) Definitions() []PermissionDefinition {
+	c.mu.RLock()
+	definitions := make([]PermissionDefinition, 0, len(c.definitions))
+	for _, definition := range c.definitions {
+		definitions = append(definitions, definition)
+	}
+	c.mu.RUnlock()
+
+	slices.SortFunc(definitions, func(a, b PermissionDefinition) int {
+		return cmp.Or(cmp.Compare(a.Group, b.Group), cmp.Compare(a.Name, b.Name))
+	})
+	return definitions
+}
+
+// Groups returns the declared permissions grouped, in group order.
+// Permissions without a group come first.
+func (c *PermissionCatalog) Groups() []PermissionGroup {
+	var groups []PermissionGroup
+	for _, definition := range c.Definitions() {
+		if len(groups) == 0 || groups[len(groups)-1].Name != definition.Group {
+			groups = append(groups, PermissionGroup{Name: definition.Group})
+		}
+		last := &groups[len(groups)-1]
+		last.Permissions = append(last.Permissions, definition)
+	}
+	return groups
+}
+
+// WithPermissionCatalog validates the permissions granted to roles against
+// the catalog.
+func WithPermissionCatalog(catalog *PermissionCatalog) ManagementOption {
+	return func(m *ManagementImpl) {
+		m.permissionCatalog = catalog
+	}
+}
@@ -0,0 +1,44 @@
+package ubmanage
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPermissionCatalog(t *testing.T) {
+	catalog := NewPermissionCatalog()
+	if !catalog.Allows("anything") {
+		t.Fatal("expected an empty catalog to allow any permission")
+	}
+
+	catalog.Register(
+		PermissionDefinition{Name: "refunds:create", DisplayName: "Create refunds", Group: "Billing", Dangerous: true},
+		PermissionDefinition{Name: "reports:read", Group: "Reporting"},
+		PermissionDefinition{Name: "invoices:read", Group: "Billing"},
+		PermissionDefinition{Name: "profile:edit"},
+	)
+	if catalog.Allows("anything") || !catalog.Allows("reports:read") {
+		t.Fatal("expected only declared permissions to be allowed")
+	}
+
+	var names []string
+	for _, group := range catalog.Groups() {
+		for _, definition := range group.Permissions {
+			names = append(names, group.Name+"/"+definition.Name)
+		}
+	}
+	want := []string{"/profile:edit", "Billing/invoices:read", "Billing/refunds:create", "Reporting/reports:read"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("expected %v, got %v", want, names)
+	}
+
+	// Registering a permission again replaces its definition.
+	catalog.Register(PermissionDefinition{Name: "reports:read", DisplayName: "Read reports"})
+	definition, found := catalog.Lookup("reports:read")
+	if !found || definition.Title() != "Read reports" || definition.Group != "" {
+		t.Fatalf("unexpected definition %+v", definition)
+	}
+	if definition, _ := catalog.Lookup("invoices:read"); definition.Title() != "invoices:read" {
+		t.Fatalf("expected the name as the title, got %q", definition.Title())
+	}
+}
@@ -2,29 +2,88 @@ package ubmanage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	evercore "github.com/kernelplex/evercore/base"
 	ev "github.com/kernelplex/ubase/internal/evercoregen/events"
 	"github.com/kernelplex/ubase/lib/ensure"
 	"github.com/kernelplex/ubase/lib/ubalgorithms"
+	"github.com/kernelplex/ubase/lib/ubdata"
+	"github.com/kernelplex/ubase/lib/ubpolicy"
 	"github.com/kernelplex/ubase/lib/ubstatus"
 )
 
 type PrefectService interface {
+	RelationService
+
 	UserBelongsToRole(ctx context.Context, userId int64, roleId int64) (bool, error)
 
+	// UserHasPermission reports whether the user holds the permission in the
+	// organization. Permissions granted under a policy are checked against
+	// an empty PolicyInput at the current time.
 	UserHasPermission(ctx context.Context, userId int64, orgId int64, permission string) (bool, error)
 
+	// UserHasPermissionFor reports whether the user holds the permission in
+	// the organization for the request described by input. Permissions
+	// granted under a policy are only held when the policy of one of the
+	// roles granting them allows the request.
+	UserHasPermissionFor(ctx context.Context, userId int64, orgId int64, permission string, input PolicyInput) (bool, error)
+
+	// UserPermissions returns the sorted permissions the user's roles grant
+	// in the organization, including those granted under a policy.
+	UserPermissions(ctx context.Context, userId int64, orgId int64) ([]string, error)
+
+	// UserPermissionsFor returns the sorted permissions the user holds in the
+	// organization for the request described by input. Permissions granted
+	// under a policy are only included when a policy allows the request.
+	UserPermissionsFor(ctx context.Context, userId int64, orgId int64, input PolicyInput) ([]string, error)
+
+	// ExplainPermissions returns how the user comes to hold each of their
+	// permissions in the organization, or only the given permission when it
+	// is not empty.
+	ExplainPermissions(ctx context.Context, userId int64, orgId int64, permission string) (PermissionExplanation, error)
+
+	// UserHasAnyPermission reports whether the user holds at least one of
+	// the permissions in the organization, as UserHasPermission.
+	UserHasAnyPermission(ctx context.Context, userId int64, orgId int64, permissions ...string) (bool, error)
+
+	// UserHasAllPermissions reports whether the user holds every one of the
+	// permissions in the organization, as UserHasPermission.
+	UserHasAllPermissions(ctx context.Context, userId int64, orgId int64, permissions ...string) (bool, error)
+
 	GroupInvalidation(ctx context.Context, roleId int64) error
 
 	UserInvalidation(ctx context.Context, userId int64) error
 
-	ApiKeyToUser(ctx context.Context, apiKey string) (ApiKeyData, error)
+	// ApiKeyToUser resolves an API key used from ipAddress. Keys with an
+	// allowlist are refused from other addresses. Use is recorded at most
+	// once per ApiKeyUsageInterval for each key.
+	ApiKeyToUser(ctx context.Context, apiKey string, ipAddress string) (ApiKeyData, error)
+
+	// ApiKeyHasPermission reports whether the API key may use the permission
+	// in the organization. The key must belong to the organization, its
+	// scopes must allow the permission and its owner must hold it.
+	ApiKeyHasPermission(ctx context.Context, apiKey string, ipAddress string, orgId int64, permission string) (bool, error)
+
+	// UserSessionValid reports whether a session issued to the user at
+	// issuedAt (unix seconds) may still be used. Sessions of disabled users
+	// and sessions issued before or in the same second as the user's
+	// sessions were revoked are not valid.
+	UserSessionValid(ctx context.Context, userId int64, issuedAt int64) (bool, error)
+
+	// CacheStats returns the hit, miss and eviction counters of the caches.
+	CacheStats() PrefectCacheStats
+
+	// Health reports whether the service is processing events, and how often
+	// and for how long its event subscription has failed.
+	Health() PrefectHealth
 
 	Start() error
 	Stop() error
@@ -35,29 +94,179 @@ type ApiKeyData struct {
 	Email          string `json:"email,omitempty"`
 	OrganizationId int64  `json:"organizationId,omitempty"`
 	ExpiresAt      int64  `json:"expiresAt,omitempty"`
+	ServiceAccount bool   `json:"serviceAccount,omitempty"`
+	// Scopes limit the key to a subset of its owner's permissions. Empty
+	// means the key is not restricted.
+	Scopes []string `json:"scopes,omitempty"`
+	// EffectiveScopes are the owner's current permissions in the key's
+	// organization that the key may use.
+	EffectiveScopes []string `json:"effectiveScopes,omitempty"`
+	// AllowedCidrs are the address ranges the key may be used from. Empty
+	// means any address.
+	AllowedCidrs []string `json:"allowedCidrs,omitempty"`
 }
 
+// ApiKeyUsageInterval is how often the last use of an API key is written.
+const ApiKeyUsageInterval = 5 * time.Minute
+
+var errApiKeyAddressNotAllowed = errors.New("api key is not allowed from this address")
+
 type UserData struct {
-	Id    int64   `json:"id"`
-	Email string  `json:"email"`
-	Roles []int64 `json:"groups"`
+	Id                int64   `json:"id"`
+	Email             string  `json:"email"`
+	Roles             []int64 `json:"groups"`
+	Disabled          bool    `json:"disabled,omitempty"`
+	SessionsRevokedAt int64   `json:"sessionsRevokedAt,omitempty"`
+	// ServiceAccount principals only hold permissions in the organization
+	// that owns them.
+	ServiceAccount      bool              `json:"serviceAccount,omitempty"`
+	OwnerOrganizationId int64             `json:"ownerOrganizationId,omitempty"`
+	Settings            map[string]string `json:"settings,omitempty"`
+	// RoleWindows holds the validity windows of time-bound memberships.
+	// Memberships without an entry are always valid.
+	RoleWindows map[int64]RoleWindow `json:"roleWindows,omitempty"`
+	// RoleAccessRequests maps roles granted by approving an access request to
+	// the request. Direct grants have no entry.
+	RoleAccessRequests map[int64]int64 `json:"roleAccessRequests,omitempty"`
+}
+
+// RoleWindow bounds a role membership in unix seconds. Zero is unbounded.
+type RoleWindow struct {
+	NotBefore int64 `json:"notBefore,omitempty"`
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+}
+
+func (w RoleWindow) activeAt(now int64) bool {
+	return (w.NotBefore == 0 || now >= w.NotBefore) && (w.ExpiresAt == 0 || now < w.ExpiresAt)
+}
+
+// activeRoles returns the roles whose memberships are valid at now.
+func (u *UserData) activeRoles(now time.Time) []int64 {
+	if len(u.RoleWindows) == 0 {
+		return u.Roles
+	}
+	roles := make([]int64, 0, len(u.Roles))
+	for _, roleId := range u.Roles {
+		if window, found := u.RoleWindows[roleId]; !found || window.activeAt(now.Unix()) {
+			roles = append(roles, roleId)
+		}
+	}
+	return roles
+}
+
+// nextRoleChange returns the unix time at which a membership next starts or
+// ends, or zero if none will.
+func (u *UserData) nextRoleChange(now time.Time) int64 {
+	var next int64
+	for _, window := range u.RoleWindows {
+		for _, bound := range []int64{window.NotBefore, window.ExpiresAt} {
+			if bound > now.Unix() && (next == 0 || bound < next) {
+				next = bound
+			}
+		}
+	}
+	return next
 }
 
 type GroupPermissions struct {
 	GroupId        int64    `json:"groupId"`
+	Name           string   `json:"name"`
 	OrganizationId int64    `json:"organizationId"`
 	Permissions    []string `json:"permissions"`
+	// Policies holds the compiled policies of conditional permissions.
+	Policies map[string]*ubpolicy.Policy `json:"-"`
+}
+
+type PrefectCacheStats struct {
+	Users       ubalgorithms.CacheStats `json:"users"`
+	Groups      ubalgorithms.CacheStats `json:"groups"`
+	ApiKeys     ubalgorithms.CacheStats `json:"apiKeys"`
+	Permissions ubalgorithms.CacheStats `json:"permissions"`
+	Relations   ubalgorithms.CacheStats `json:"relations"`
+	// OrganizationSettings are loaded for policies.
+	OrganizationSettings ubalgorithms.CacheStats `json:"organizationSettings"`
+}
+
+// userOrganization keys the permission set cache.
+type userOrganization struct {
+	userId         int64
+	organizationId int64
 }
 
 type PrefectServiceImpl struct {
 	managementService ManagementService
-	userCache         *ubalgorithms.LRUCache[int64, *UserData]
-	groupCache        *ubalgorithms.LRUCache[int64, *GroupPermissions]
-	apiKeyCache       *ubalgorithms.LRUCache[string, *ApiKeyData]
-	store             *evercore.EventStore
-	ctx               context.Context
-	cancel            context.CancelFunc
-	started           bool
+	userCache         *ubalgorithms.ShardedLRUCache[int64, *UserData]
+	groupCache        *ubalgorithms.ShardedLRUCache[int64, *GroupPermissions]
+	apiKeyCache       *ubalgorithms.ShardedLRUCache[string, *ApiKeyData]
+	// permissionCache holds the permissions each user holds in an
+	// organization.
+	permissionCache  *ubalgorithms.ShardedLRUCache[userOrganization, *permissionSet]
+	orgSettingsCache *ubalgorithms.ShardedLRUCache[int64, map[string]string]
+	// relationCache holds relationship tuples by object and by subject.
+	relationCache  *ubalgorithms.ShardedLRUCache[relationTuplesKey, []ubdata.RelationTuple]
+	relationSchema RelationSchema
+	// apiKeyUsage holds when each key's use was last recorded, by key id.
+	apiKeyUsage *ubalgorithms.ShardedLRUCache[string, int64]
+	usageLock   sync.Mutex
+	store       *evercore.EventStore
+	// lifecycleLock guards ctx, cancel and done.
+	lifecycleLock sync.Mutex
+	ctx           context.Context
+	cancel        context.CancelFunc
+	done          chan struct{}
+	started       atomic.Bool
+	// subscribed is set while events are being processed. Checks fail while
+	// it is not, since cached data may be stale.
+	subscribed atomic.Bool
+	// lastEventId is the id of the last event processed, after which a
+	// restarted subscription resumes. It is zero until an event is processed.
+	lastEventId atomic.Int64
+	// subscribe runs the event subscription from start. Tests replace it to
+	// inject failures.
+	subscribe         func(context.Context, evercore.StartFrom, func(context.Context, []evercore.SerializedEvent) error) error
+	restartBackoff    time.Duration
+	maxRestartBackoff time.Duration
+	healthLock        sync.Mutex
+	health            PrefectHealth
+}
+
+// PrefectOptions tunes the caches of the prefect service.
+type PrefectOptions struct {
+	// ApiKeyCacheSize is the number of API keys to cache. Defaults to the
+	// group cache size.
+	ApiKeyCacheSize int
+
+	// PermissionCacheSize is the number of permission sets, one for each
+	// user and organization, to cache. Defaults to the user cache size.
+	PermissionCacheSize int
+
+	// RelationCacheSize is the number of tuple lists, one for each object
+	// and each subject, to cache. Defaults to the user cache size.
+	RelationCacheSize int
+
+	// RelationSchema holds the userset rewrites used by Check and
+	// ListObjects.
+	RelationSchema RelationSchema
+
+	// CacheTTL bounds how long cached users, groups and API keys are used
+	// before they are loaded again, in case an invalidating event is missed.
+	// Zero keeps them until they are evicted or invalidated.
+	CacheTTL time.Duration
+
+	// RestartBackoff is the wait before the event subscription is restarted
+	// after it fails. It doubles after each consecutive failure up to
+	// MaxRestartBackoff. Defaults to DefaultPrefectRestartBackoff and
+	// DefaultPrefectMaxRestartBackoff.
+	RestartBackoff    time.Duration
+	MaxRestartBackoff time.Duration
+}
+
+type PrefectOption func(*PrefectOptions)
+
+func WithPrefectOptions(options PrefectOptions) PrefectOption {
+	return func(o *PrefectOptions) {
+		*o = options
+	}
 }
 
 func NewPrefectService(
@@ -65,22 +274,60 @@ func NewPrefectService(
 	store *evercore.EventStore,
 	userCacheSize int,
 	groupCacheSize int,
+	opts ...PrefectOption,
 ) PrefectService {
 	ensure.That(managementService != nil, "managementService cannot be nil")
 	ensure.That(store != nil, "store cannot be nil")
 	ensure.That(userCacheSize > 0, "userCacheSize must be greater than 0")
 	ensure.That(groupCacheSize > 0, "groupCacheSize must be greater than 0")
 
-	userCache := ubalgorithms.NewLRUCache[int64, *UserData](userCacheSize)
-	groupCache := ubalgorithms.NewLRUCache[int64, *GroupPermissions](groupCacheSize)
-	apiKeyCache := ubalgorithms.NewLRUCache[string, *ApiKeyData](groupCacheSize)
-	return &PrefectServiceImpl{
+	options := PrefectOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&options)
+		}
+	}
+	if options.ApiKeyCacheSize <= 0 {
+		options.ApiKeyCacheSize = groupCacheSize
+	}
+	if options.PermissionCacheSize <= 0 {
+		options.PermissionCacheSize = userCacheSize
+	}
+	if options.RelationCacheSize <= 0 {
+		options.RelationCacheSize = userCacheSize
+	}
+	if options.RestartBackoff <= 0 {
+		options.RestartBackoff = DefaultPrefectRestartBackoff
+	}
+	if options.MaxRestartBackoff < options.RestartBackoff {
+		options.MaxRestartBackoff = max(DefaultPrefectMaxRestartBackoff, options.RestartBackoff)
+	}
+	cacheOptions := ubalgorithms.ShardedLRUCacheOptions{TTL: options.CacheTTL}
+
+	userCache := ubalgorithms.NewShardedLRUCache[int64, *UserData](userCacheSize, cacheOptions)
+	groupCache := ubalgorithms.NewShardedLRUCache[int64, *GroupPermissions](groupCacheSize, cacheOptions)
+	apiKeyCache := ubalgorithms.NewShardedLRUCache[string, *ApiKeyData](options.ApiKeyCacheSize, cacheOptions)
+	permissionCache := ubalgorithms.NewShardedLRUCache[userOrganization, *permissionSet](options.PermissionCacheSize, cacheOptions)
+	orgSettingsCache := ubalgorithms.NewShardedLRUCache[int64, map[string]string](groupCacheSize, cacheOptions)
+	relationCache := ubalgorithms.NewShardedLRUCache[relationTuplesKey, []ubdata.RelationTuple](options.RelationCacheSize, cacheOptions)
+	// Usage is throttled by ApiKeyUsageInterval rather than a TTL.
+	apiKeyUsage := ubalgorithms.NewShardedLRUCache[string, int64](options.ApiKeyCacheSize, ubalgorithms.ShardedLRUCacheOptions{})
+	prefect := &PrefectServiceImpl{
 		managementService: managementService,
 		userCache:         userCache,
 		groupCache:        groupCache,
 		apiKeyCache:       apiKeyCache,
+		permissionCache:   permissionCache,
+		orgSettingsCache:  orgSettingsCache,
+		relationCache:     relationCache,
+		relationSchema:    options.RelationSchema,
+		apiKeyUsage:       apiKeyUsage,
 		store:             store,
+		restartBackoff:    options.RestartBackoff,
+		maxRestartBackoff: options.MaxRestartBackoff,
 	}
+	prefect.subscribe = prefect.runSubscription
+	return prefect
 }
 
 func (p *PrefectServiceImpl) getUserData(ctx context.Context, userId int64) (*UserData, error) {
@@ -108,14 +355,30 @@ func (p *PrefectServiceImpl) getUserData(ctx context.Context, userId int64) (*Us
 		}
 
 		roles := make([]int64, len(roleList.Data))
+		roleWindows := map[int64]RoleWindow{}
+		roleAccessRequests := map[int64]int64{}
 		for i, role := range roleList.Data {
 			roles[i] = role.RoleID
+			if role.NotBefore != 0 || role.ExpiresAt != 0 {
+				roleWindows[role.RoleID] = RoleWindow{NotBefore: role.NotBefore, ExpiresAt: role.ExpiresAt}
+			}
+			if role.AccessRequestID != 0 {
+				roleAccessRequests[role.RoleID] = role.AccessRequestID
+			}
 		}
 
 		userData = &UserData{
-			Id:    userResp.Data.Id,
-			Email: userResp.Data.State.Email,
-			Roles: roles,
+			Id:                 userResp.Data.Id,
+			Email:              userResp.Data.State.Email,
+			Roles:              roles,
+			RoleWindows:        roleWindows,
+			RoleAccessRequests: roleAccessRequests,
+			Disabled:           userResp.Data.State.Disabled,
+			SessionsRevokedAt:  userResp.Data.State.SessionsRevokedAt,
+
+			ServiceAccount:      userResp.Data.State.ServiceAccount,
+			OwnerOrganizationId: userResp.Data.State.OwnerOrganizationId,
+			Settings:            userResp.Data.State.Settings,
 		}
 		p.userCache.Put(userId, userData)
 	}
@@ -124,9 +387,8 @@ func (p *PrefectServiceImpl) getUserData(ctx context.Context, userId int64) (*Us
 
 func (p *PrefectServiceImpl) UserBelongsToRole(ctx context.Context, userId int64, groupId int64) (bool, error) {
 
-	if started := p.started; !started {
-		slog.Error("prefect service not started")
-		return false, fmt.Errorf("prefect service not started")
+	if err := p.available(); err != nil {
+		return false, err
 	}
 
 	userData, err := p.getUserData(ctx, userId)
@@ -134,17 +396,37 @@ func (p *PrefectServiceImpl) UserBelongsToRole(ctx context.Context, userId int64
 		return false, err
 	}
 
-	if slices.Contains(userData.Roles, groupId) {
+	if slices.Contains(userData.activeRoles(time.Now()), groupId) {
 		return true, nil
 	}
 
 	return false, nil
 }
 
+func (p *PrefectServiceImpl) UserSessionValid(ctx context.Context, userId int64, issuedAt int64) (bool, error) {
+	if err := p.available(); err != nil {
+		return false, err
+	}
+
+	userData, err := p.getUserData(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+
+	if userData.Disabled {
+		return false, nil
+	}
+	// Both times are whole seconds, so a session issued in the same second
+	// as the revocation may predate it and is refused too.
+	if userData.SessionsRevokedAt > 0 && issuedAt <= userData.SessionsRevokedAt {
+		return false, nil
+	}
+	return true, nil
+}
+
 func (p *PrefectServiceImpl) getGroupPermissions(ctx context.Context, groupId int64) (*GroupPermissions, error) {
-	if started := p.started; !started {
-		slog.Error("prefect service not started")
-		return nil, fmt.Errorf("prefect service not started")
+	if err := p.available(); err != nil {
+		return nil, err
 	}
 
 	groupData, found := p.groupCache.Get(groupId)
@@ -159,8 +441,10 @@ func (p *PrefectServiceImpl) getGroupPermissions(ctx context.Context, groupId in
 		}
 		groupData = &GroupPermissions{
 			GroupId:        groupResp.Data.Id,
+			Name:           groupResp.Data.State.Name,
 			OrganizationId: groupResp.Data.State.OrganizationId,
 			Permissions:    groupResp.Data.State.Permissions,
+			Policies:       compileRolePolicies(groupResp.Data.Id, groupResp.Data.State.Policies),
 		}
 		p.groupCache.Put(groupId, groupData)
 	}
@@ -168,53 +452,261 @@ func (p *PrefectServiceImpl) getGroupPermissions(ctx context.Context, groupId in
 }
 
 func (p *PrefectServiceImpl) UserHasPermission(ctx context.Context, userId int64, orgId int64, permission string) (bool, error) {
-	if started := p.started; !started {
-		slog.Error("prefect service not started")
-		return false, fmt.Errorf("prefect service not started")
+	return p.UserHasPermissionFor(ctx, userId, orgId, permission, PolicyInput{})
+}
+
+func (p *PrefectServiceImpl) UserHasPermissionFor(ctx context.Context, userId int64, orgId int64, permission string, input PolicyInput) (bool, error) {
+	if err := p.available(); err != nil {
+		return false, err
 	}
 
-	userData, err := p.getUserData(ctx, userId)
+	set, err := p.userPermissions(ctx, userId, orgId)
 	if err != nil {
-		slog.Error("Error getting user data", "error", err)
+		slog.Error("Error getting user permissions", "error", err)
 		return false, err
 	}
+	return p.permitted(ctx, set, permission, &policyRequest{userId: userId, orgId: orgId, input: input})
+}
 
-	for _, roleId := range userData.Roles {
-		groupData, err := p.getGroupPermissions(ctx, roleId)
+func (p *PrefectServiceImpl) UserPermissions(ctx context.Context, userId int64, orgId int64) ([]string, error) {
+	if err := p.available(); err != nil {
+		return nil, err
+	}
+
+	set, err := p.userPermissions(ctx, userId, orgId)
+	if err != nil {
+		slog.Error("Error getting user permissions", "error", err)
+		return nil, err
+	}
+	return slices.Clone(set.permissions), nil
+}
+
+func (p *PrefectServiceImpl) UserPermissionsFor(ctx context.Context, userId int64, orgId int64, input PolicyInput) ([]string, error) {
+	if err := p.available(); err != nil {
+		return nil, err
+	}
+
+	set, err := p.userPermissions(ctx, userId, orgId)
+	if err != nil {
+		slog.Error("Error getting user permissions", "error", err)
+		return nil, err
+	}
+	request := &policyRequest{userId: userId, orgId: orgId, input: input}
+	permissions := make([]string, 0, len(set.permissions))
+	for _, permission := range set.permissions {
+		allowed, err := p.permitted(ctx, set, permission, request)
 		if err != nil {
-			slog.Error("Error getting group data", "error", err)
-			return false, err
+			return nil, err
 		}
+		if allowed {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions, nil
+}
+
+func (p *PrefectServiceImpl) UserHasAnyPermission(ctx context.Context, userId int64, orgId int64, permissions ...string) (bool, error) {
+	if err := p.available(); err != nil {
+		return false, err
+	}
 
-		if groupData.OrganizationId != orgId {
-			slog.Debug("Skipping group as orgId does not match", "groupId", groupData.GroupId, "groupOrgId", groupData.OrganizationId, "userOrgId", orgId)
-			continue
+	set, err := p.userPermissions(ctx, userId, orgId)
+	if err != nil {
+		slog.Error("Error getting user permissions", "error", err)
+		return false, err
+	}
+	request := &policyRequest{userId: userId, orgId: orgId}
+	for _, permission := range permissions {
+		held, err := p.permitted(ctx, set, permission, request)
+		if err != nil || held {
+			return held, err
 		}
+	}
+	return false, nil
+}
 
-		if slices.Contains(groupData.Permissions, permission) {
-			return true, nil
+func (p *PrefectServiceImpl) UserHasAllPermissions(ctx context.Context, userId int64, orgId int64, permissions ...string) (bool, error) {
+	if err := p.available(); err != nil {
+		return false, err
+	}
+
+	set, err := p.userPermissions(ctx, userId, orgId)
+	if err != nil {
+		slog.Error("Error getting user permissions", "error", err)
+		return false, err
+	}
+	request := &policyRequest{userId: userId, orgId: orgId}
+	for _, permission := range permissions {
+		held, err := p.permitted(ctx, set, permission, request)
+		if err != nil || !held {
+			return false, err
 		}
 	}
+	return true, nil
+}
+
+// userPermissions returns the permissions the user holds in the
+// organization. The result is shared with the cache and must not be
+// modified.
+func (p *PrefectServiceImpl) userPermissions(ctx context.Context, userId int64, orgId int64) (*permissionSet, error) {
+	now := time.Now()
+	key := userOrganization{userId: userId, organizationId: orgId}
+	if set, found := p.permissionCache.Get(key); found && (set.validUntil == 0 || now.Unix() < set.validUntil) {
+		return set, nil
+	}
 
-	return false, nil
+	userData, err := p.getUserData(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := p.userGroups(ctx, userData, orgId, now)
+	if err != nil {
+		return nil, err
+	}
+	permissions := []string{}
+	unconditional := map[string]bool{}
+	policies := map[string][]*ubpolicy.Policy{}
+	for _, groupData := range groups {
+		permissions = append(permissions, groupData.Permissions...)
+		for _, permission := range groupData.Permissions {
+			if policy, found := groupData.Policies[permission]; found {
+				policies[permission] = append(policies[permission], policy)
+			} else {
+				unconditional[permission] = true
+			}
+		}
+	}
+	// A role granting the permission without a policy outweighs any policy.
+	for permission := range unconditional {
+		delete(policies, permission)
+	}
+	slices.Sort(permissions)
+	set := &permissionSet{
+		permissions: slices.Compact(permissions),
+		policies:    policies,
+		validUntil:  userData.nextRoleChange(now),
+	}
+	p.permissionCache.Put(key, set)
+	return set, nil
+}
+
+// userGroups returns the roles the user holds permissions through in the
+// organization at now. Service accounts only hold them in their own
+// organization, while enabled.
+func (p *PrefectServiceImpl) userGroups(ctx context.Context, userData *UserData, orgId int64, now time.Time) ([]*GroupPermissions, error) {
+	if userData.ServiceAccount && (userData.Disabled || userData.OwnerOrganizationId != orgId) {
+		return nil, nil
+	}
+	var groups []*GroupPermissions
+	for _, roleId := range userData.activeRoles(now) {
+		groupData, err := p.getGroupPermissions(ctx, roleId)
+		if err != nil {
+			return nil, err
+		}
+		if groupData.OrganizationId == orgId {
+			groups = append(groups, groupData)
+		}
+	}
+	return groups, nil
 }
 
 func (p *PrefectServiceImpl) GroupInvalidation(ctx context.Context, groupId int64) error {
 	p.groupCache.Remove(groupId)
+	// Finding the users holding the role would take a reverse index, and
+	// role changes are rare.
+	p.permissionCache.Clear()
 	return nil
 }
 
 func (p *PrefectServiceImpl) UserInvalidation(ctx context.Context, userId int64) error {
 	p.userCache.Remove(userId)
+	p.permissionCache.RemoveFunc(func(key userOrganization, _ *permissionSet) bool {
+		return key.userId == userId
+	})
 	return nil
 }
 
-func (p *PrefectServiceImpl) ApiKeyToUser(ctx context.Context, apiKey string) (ApiKeyData, error) {
-	if started := p.started; !started {
-		slog.Error("prefect service not started")
-		return ApiKeyData{}, fmt.Errorf("prefect service not started")
+// apiKeyInvalidation removes a key from the cache by its id. The cache is
+// keyed by the full key, which events do not carry.
+func (p *PrefectServiceImpl) apiKeyInvalidation(apiKeyId string) {
+	p.apiKeyCache.RemoveFunc(func(apiKey string, _ *ApiKeyData) bool {
+		return strings.HasPrefix(apiKey, apiKeyId)
+	})
+}
+
+func (p *PrefectServiceImpl) ApiKeyToUser(ctx context.Context, apiKey string, ipAddress string) (ApiKeyData, error) {
+	if err := p.available(); err != nil {
+		return ApiKeyData{}, err
+	}
+
+	apiKeyData, err := p.getApiKeyData(ctx, apiKey, ipAddress)
+	if err != nil {
+		return ApiKeyData{}, err
 	}
 
+	// Effective scopes follow the owner's current permissions, so they are
+	// worked out from the user and group caches rather than cached here.
+	set, err := p.userPermissions(ctx, apiKeyData.UserId, apiKeyData.OrganizationId)
+	if err != nil {
+		slog.Error("Error getting api key permissions", "error", err)
+		return ApiKeyData{}, err
+	}
+	data := *apiKeyData
+	data.EffectiveScopes = effectiveScopes(apiKeyData.Scopes, set.permissions)
+	return data, nil
+}
+
+func (p *PrefectServiceImpl) ApiKeyHasPermission(ctx context.Context, apiKey string, ipAddress string, orgId int64, permission string) (bool, error) {
+	if err := p.available(); err != nil {
+		return false, err
+	}
+
+	apiKeyData, err := p.getApiKeyData(ctx, apiKey, ipAddress)
+	if err != nil {
+		return false, err
+	}
+	if apiKeyData.OrganizationId != orgId || !scopeAllows(apiKeyData.Scopes, permission) {
+		return false, nil
+	}
+	return p.UserHasPermissionFor(ctx, apiKeyData.UserId, orgId, permission, PolicyInput{IpAddress: ipAddress})
+}
+
+// getApiKeyData resolves an API key, refuses it outside its allowlist and
+// records its use.
+func (p *PrefectServiceImpl) getApiKeyData(ctx context.Context, apiKey string, ipAddress string) (*ApiKeyData, error) {
+	apiKeyData, err := p.lookupApiKey(ctx, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	if !allowlistPermits(apiKeyData.AllowedCidrs, ipAddress) {
+		slog.Warn("API key used from an address outside its allowlist", "apiKeyId", apiKey[:ApiKeyIdLength], "ipAddress", ipAddress)
+		return nil, errApiKeyAddressNotAllowed
+	}
+	p.recordApiKeyUse(ctx, apiKey[:ApiKeyIdLength], ipAddress)
+	return apiKeyData, nil
+}
+
+// recordApiKeyUse writes the key's last use unless it was written within
+// ApiKeyUsageInterval. Failures are logged and do not refuse the key.
+func (p *PrefectServiceImpl) recordApiKeyUse(ctx context.Context, apiKeyId string, ipAddress string) {
+	now := time.Now()
+	p.usageLock.Lock()
+	last, found := p.apiKeyUsage.Get(apiKeyId)
+	if found && now.Unix()-last < int64(ApiKeyUsageInterval/time.Second) {
+		p.usageLock.Unlock()
+		return
+	}
+	p.apiKeyUsage.Put(apiKeyId, now.Unix())
+	p.usageLock.Unlock()
+
+	resp, err := p.managementService.UserRecordApiKeyUse(ctx, apiKeyId, ipAddress)
+	if err != nil || resp.Status != ubstatus.Success {
+		slog.Error("Error recording api key use", "apiKeyId", apiKeyId, "error", err, "status", resp.Status)
+	}
+}
+
+func (p *PrefectServiceImpl) lookupApiKey(ctx context.Context, apiKey string) (*ApiKeyData, error) {
 	apiKeyData, found := p.apiKeyCache.Get(apiKey)
 	if found {
 		// Check if the API key is expired
@@ -223,18 +715,18 @@ func (p *PrefectServiceImpl) ApiKeyToUser(ctx context.Context, apiKey string) (A
 			// API key is expired, remove it from cache
 			p.apiKeyCache.Remove(apiKey)
 			slog.Info("Api key", "key", apiKey, "expiredAt", apiKeyData.ExpiresAt, "currentTime", currentTime)
-			return ApiKeyData{}, fmt.Errorf("api key expired")
+			return nil, fmt.Errorf("api key expired")
 		}
 
-		return *apiKeyData, nil
+		return apiKeyData, nil
 	}
 
 	apiKeyResp, err := p.managementService.UserGetByApiKey(ctx, apiKey)
 	if err != nil {
-		return ApiKeyData{}, err
+		return nil, err
 	}
 	if apiKeyResp.Status != ubstatus.Success {
-		return ApiKeyData{}, fmt.Errorf("failed to get api key data: %s", apiKeyResp.Message)
+		return nil, fmt.Errorf("failed to get api key data: %s", apiKeyResp.Message)
 	}
 
 	for _, key := range apiKeyResp.Data.State.ApiKeys {
@@ -245,115 +737,156 @@ func (p *PrefectServiceImpl) ApiKeyToUser(ctx context.Context, apiKey string) (A
 				Email:          apiKeyResp.Data.State.Email,
 				OrganizationId: key.OrganizationId,
 				ExpiresAt:      key.ExpiresAt,
+				ServiceAccount: apiKeyResp.Data.State.ServiceAccount,
+				Scopes:         key.Scopes,
+				AllowedCidrs:   key.AllowedCidrs,
 			}
 			p.apiKeyCache.Put(apiKey, apiKeyData)
-			return *apiKeyData, nil
+			return apiKeyData, nil
 		}
 	}
-	return ApiKeyData{}, fmt.Errorf("api key not found")
+	return nil, fmt.Errorf("api key not found")
 }
 
-func (p *PrefectServiceImpl) main() {
-	slog.Info("Starting Prefect Service")
+// runSubscription streams events to handler from start until ctx is
+// cancelled or the subscription fails.
+func (p *PrefectServiceImpl) runSubscription(ctx context.Context,
+	start evercore.StartFrom,
+	handler func(context.Context, []evercore.SerializedEvent) error) error {
 	filter := evercore.SubscriptionFilter{
 		EventTypes: []string{},
 	}
 
-	start := evercore.StartFrom{
-		Kind: evercore.StartEnd,
-	}
 	options := evercore.Options{
 		BatchSize:    100,
 		PollInterval: 1 * time.Second,
 		Lease:        30 * time.Second,
 	}
 
-	err := p.store.RunEphemeralSubscription(p.ctx, filter, start, options,
-		func(ctx context.Context, evs []evercore.SerializedEvent) error {
-			for _, e := range evs {
-				slog.Info("PrefectService processing event", "eventType", e.EventType, "aggregateId", e.AggregateId, "sequence", e.Sequence)
-				switch e.EventType {
-				case ev.RoleDeletedEventType,
-					ev.RoleUndeletedEventType,
-					ev.RolePermissionAddedEventType,
-					ev.RolePermissionRemovedEventType:
-					p.GroupInvalidation(ctx, e.AggregateId)
-				case ev.UserAddedToRoleEventType:
-					_, state, err := evercore.DecodeEvent(e)
-					if err != nil {
-						return fmt.Errorf("failed to decode event: %w", err)
-					}
-
-					addedToRoleEvent, ok := state.(UserAddedToRoleEvent)
-					if !ok {
-						return fmt.Errorf("failed to cast event")
-					}
-					p.UserInvalidation(ctx, addedToRoleEvent.UserId)
-
-				case ev.UserRemovedFromRoleEventType:
-					_, state, err := evercore.DecodeEvent(e)
-					if err != nil {
-						return fmt.Errorf("failed to decode event: %w", err)
-					}
-
-					addedToRoleEvent, ok := state.(UserRemovedFromRoleEvent)
-					if !ok {
-						return fmt.Errorf("failed to cast event")
-					}
-					p.UserInvalidation(ctx, addedToRoleEvent.UserId)
-				case ev.UserApiKeyDeletedEventType:
-					// Invalidate all API keys for the user
-					_, es, err := evercore.DecodeEvent(e)
-					if err != nil {
-						return fmt.Errorf("failed to decode event: %w", err)
-					}
-
-					apiKeyEvent, ok := es.(UserApiKeyDeletedEvent)
-					if !ok {
-						return fmt.Errorf("failed to cast event")
-					}
-					p.apiKeyCache.Remove(apiKeyEvent.Id)
-				}
-			}
-			return nil
-		})
+	return p.store.RunEphemeralSubscription(ctx, filter, start, options, handler)
+}
 
-	// If we get here, either the context was cancelled or there was an error.If there
-	// was an error, something about our understanding of the system is wrong.
-	if err != nil {
-		slog.Error("error running ephemeral subscription", "error", err)
+// handleEvents invalidates cached data affected by the events. An event that
+// cannot be decoded would fail again on every restart, so it is skipped
+// rather than returned, and the caches are flushed in place of whatever it
+// invalidated. Errors from the event store itself still restart the
+// subscription.
+func (p *PrefectServiceImpl) handleEvents(ctx context.Context, evs []evercore.SerializedEvent) error {
+	for _, e := range evs {
+		slog.Info("PrefectService processing event", "eventType", e.EventType, "aggregateId", e.AggregateId, "sequence", e.Sequence)
+		if err := p.handleEvent(ctx, e); err != nil {
+			slog.Error("PrefectService skipping event it cannot decode, flushing caches",
+				"error", err, "eventId", e.EventID, "eventType", e.EventType, "aggregateId", e.AggregateId)
+			p.flushCaches()
+		}
+		p.lastEventId.Store(e.EventID)
 	}
-
-	// We stop processing here to avoid giving incorrect permissions.
-	p.started = false
+	return nil
 }
 
-func (p *PrefectServiceImpl) Start() error {
-	ctx, cancel := context.WithCancel(context.Background())
-	p.ctx = ctx
-	p.cancel = cancel
-	go p.main()
-	p.started = true
-	return nil
+// handleEvent invalidates cached data affected by the event.
+func (p *PrefectServiceImpl) handleEvent(ctx context.Context, e evercore.SerializedEvent) error {
+	switch e.EventType {
+	case ev.RoleDeletedEventType,
+		ev.RoleUndeletedEventType,
+		ev.RolePermissionAddedEventType,
+		ev.RolePermissionRemovedEventType,
+		ev.RolePermissionPolicySetEventType:
+		p.GroupInvalidation(ctx, e.AggregateId)
+	case ev.UserAddedToRoleEventType:
+		_, state, err := evercore.DecodeEvent(e)
+		if err != nil {
+			return fmt.Errorf("failed to decode event: %w", err)
+		}
+
+		addedToRoleEvent, ok := state.(UserAddedToRoleEvent)
+		if !ok {
+			return fmt.Errorf("failed to cast event")
+		}
+		p.UserInvalidation(ctx, addedToRoleEvent.UserId)
 
-	/*
-	   // No-op
+	case ev.UserRemovedFromRoleEventType:
+		_, state, err := evercore.DecodeEvent(e)
+		if err != nil {
+			return fmt.Errorf("failed to decode event: %w", err)
+		}
 
+		addedToRoleEvent, ok := state.(UserRemovedFromRoleEvent)
+		if !ok {
+			return fmt.Errorf("failed to cast event")
+		}
+		p.UserInvalidation(ctx, addedToRoleEvent.UserId)
+	case ev.UserDisabledEventType,
+		ev.UserEnabledEventType,
+		ev.UserSessionsRevokedEventType,
+		ev.UserSettingsAddedEventType,
+		ev.UserSettingsRemovedEventType:
+		p.UserInvalidation(ctx, e.AggregateId)
+	case ev.OrganizationSettingsAddedEventType,
+		ev.OrganizationSettingsRemovedEventType:
+		p.orgSettingsCache.Remove(e.AggregateId)
+	case ev.UserErasedEventType:
+		p.UserInvalidation(ctx, e.AggregateId)
+		p.apiKeyCache.RemoveFunc(func(_ string, data *ApiKeyData) bool {
+			return data.UserId == e.AggregateId
+		})
+	case ev.UserApiKeyRotatedEventType:
+		// Rotation shortens the old key's expiry.
+		_, es, err := evercore.DecodeEvent(e)
+		if err != nil {
+			return fmt.Errorf("failed to decode event: %w", err)
+		}
 
-	   err := p.store.RunEphemeralSubscription("ubmanage.PrefectService", filter, func(event evercore.Event) {
-	   });
+		rotatedEvent, ok := es.(UserApiKeyRotatedEvent)
+		if !ok {
+			return fmt.Errorf("failed to cast event")
+		}
+		p.apiKeyInvalidation(rotatedEvent.Id)
+	case ev.UserApiKeyDeletedEventType:
+		_, es, err := evercore.DecodeEvent(e)
+		if err != nil {
+			return fmt.Errorf("failed to decode event: %w", err)
+		}
 
-	   	if (err != nil) {
-	   		return fmt.Errorf("failed to start event subscription: %w", err)
-	   	}
-	*/
-}
+		apiKeyEvent, ok := es.(UserApiKeyDeletedEvent)
+		if !ok {
+			return fmt.Errorf("failed to cast event")
+		}
+		p.apiKeyInvalidation(apiKeyEvent.Id)
+	case ev.RelationTupleWrittenEventType:
+		_, es, err := evercore.DecodeEvent(e)
+		if err != nil {
+			return fmt.Errorf("failed to decode event: %w", err)
+		}
+
+		writtenEvent, ok := es.(RelationTupleWrittenEvent)
+		if !ok {
+			return fmt.Errorf("failed to cast event")
+		}
+		p.relationInvalidation(ubdata.RelationTuple(writtenEvent))
+	case ev.RelationTupleDeletedEventType:
+		_, es, err := evercore.DecodeEvent(e)
+		if err != nil {
+			return fmt.Errorf("failed to decode event: %w", err)
+		}
 
-func (p *PrefectServiceImpl) Stop() error {
-	if p.cancel != nil {
-		p.cancel()
-		p.cancel = nil
+		deletedEvent, ok := es.(RelationTupleDeletedEvent)
+		if !ok {
+			return fmt.Errorf("failed to cast event")
+		}
+		p.relationInvalidation(ubdata.RelationTuple(deletedEvent))
 	}
-	p.started = false
 	return nil
 }
+
+func (p *PrefectServiceImpl) CacheStats() PrefectCacheStats {
+	return PrefectCacheStats{
+		Users:       p.userCache.Stats(),
+		Groups:      p.groupCache.Stats(),
+		ApiKeys:     p.apiKeyCache.Stats(),
+		Permissions: p.permissionCache.Stats(),
+		Relations:   p.relationCache.Stats(),
+
+		OrganizationSettings: p.orgSettingsCache.Stats(),
+	}
+}
@@ -0,0 +1,121 @@
+package ubmanage
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	// PermissionSourceDirect is the source of roles the user was added to
+	// directly.
+	PermissionSourceDirect = "direct"
+	// PermissionSourceAccessRequest is the source of roles granted by
+	// approving the user's access request.
+	PermissionSourceAccessRequest = "access_request"
+)
+
+// PermissionGrant is one way a user holds a permission: through a role, which
+// grants the permission, possibly under a policy.
+type PermissionGrant struct {
+	Permission string `json:"permission"`
+	RoleId     int64  `json:"roleId"`
+	RoleName   string `json:"roleName"`
+	// Source is how the user holds the role.
+	Source string `json:"source"`
+	// AccessRequestId is the approved access request that granted the role,
+	// when Source is PermissionSourceAccessRequest.
+	AccessRequestId int64 `json:"accessRequestId,omitempty"`
+	// ExpiresAt is when the user's membership of the role expires, in unix
+	// seconds, or zero when it does not.
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+	// Policy is the policy the role grants the permission under, or empty
+	// when it is granted unconditionally.
+	Policy string `json:"policy,omitempty"`
+}
+
+// SourceDescription describes how the user holds the role, such as "access
+// request #7".
+func (g PermissionGrant) SourceDescription() string {
+	if g.Source == PermissionSourceAccessRequest {
+		return fmt.Sprintf("access request #%d", g.AccessRequestId)
+	}
+	return g.Source
+}
+
+// PermissionExplanation is the derivation of a user's permissions in an
+// organization.
+type PermissionExplanation struct {
+	UserId         int64 `json:"userId"`
+	OrganizationId int64 `json:"organizationId"`
+	// Permission is the permission explained, or empty for all of them.
+	Permission string `json:"permission,omitempty"`
+	// Grants are sorted by permission, then role.
+	Grants []PermissionGrant `json:"grants"`
+	// Excluded explains why none of the user's roles count, if that is the
+	// case.
+	Excluded string `json:"excluded,omitempty"`
+}
+
+// Permissions returns the sorted permissions the grants give.
+func (e PermissionExplanation) Permissions() []string {
+	permissions := make([]string, 0, len(e.Grants))
+	for _, grant := range e.Grants {
+		permissions = append(permissions, grant.Permission)
+	}
+	return slices.Compact(permissions)
+}
+
+func (p *PrefectServiceImpl) ExplainPermissions(ctx context.Context, userId int64, orgId int64, permission string) (PermissionExplanation, error) {
+	explanation := PermissionExplanation{UserId: userId, OrganizationId: orgId, Permission: permission, Grants: []PermissionGrant{}}
+	if err := p.available(); err != nil {
+		return explanation, err
+	}
+
+	userData, err := p.getUserData(ctx, userId)
+	if err != nil {
+		return explanation, err
+	}
+	switch {
+	case userData.ServiceAccount && userData.Disabled:
+		explanation.Excluded = "The service account is disabled."
+	case userData.ServiceAccount && userData.OwnerOrganizationId != orgId:
+		explanation.Excluded = fmt.Sprintf("The service account belongs to organization %d.", userData.OwnerOrganizationId)
+	}
+
+	groups, err := p.userGroups(ctx, userData, orgId, time.Now())
+	if err != nil {
+		return explanation, err
+	}
+	for _, groupData := range groups {
+		for _, granted := range groupData.Permissions {
+			if permission != "" && granted != permission {
+				continue
+			}
+			grant := PermissionGrant{
+				Permission: granted,
+				RoleId:     groupData.GroupId,
+				RoleName:   groupData.Name,
+				Source:     PermissionSourceDirect,
+				ExpiresAt:  userData.RoleWindows[groupData.GroupId].ExpiresAt,
+			}
+			if requestId, found := userData.RoleAccessRequests[groupData.GroupId]; found {
+				grant.Source = PermissionSourceAccessRequest
+				grant.AccessRequestId = requestId
+			}
+			if policy, found := groupData.Policies[granted]; found {
+				grant.Policy = "(invalid policy)"
+				if policy != nil {
+					grant.Policy = policy.Source()
+				}
+			}
+			explanation.Grants = append(explanation.Grants, grant)
+		}
+	}
+	slices.SortFunc(explanation.Grants, func(a, b PermissionGrant) int {
+		return cmp.Or(cmp.Compare(a.Permission, b.Permission), cmp.Compare(a.RoleId, b.RoleId))
+	})
+	return explanation, nil
+}
@@ -0,0 +1,53 @@
+package ubmanage
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestPrefectExplainPermissions(t *testing.T) {
+	p := newTestPrefect()
+	p.started.Store(true)
+	p.subscribed.Store(true)
+	ctx := context.Background()
+
+	p.userCache.Put(1, &UserData{Id: 1, Roles: []int64{10, 11, 20}, RoleAccessRequests: map[int64]int64{11: 7}})
+	p.userCache.Put(2, &UserData{Id: 2, Roles: []int64{10}, ServiceAccount: true, OwnerOrganizationId: 2})
+	p.groupCache.Put(10, &GroupPermissions{GroupId: 10, Name: "Support", OrganizationId: 1, Permissions: []string{"refunds:create", "tickets:read"}})
+	p.groupCache.Put(11, &GroupPermissions{
+		GroupId:        11,
+		Name:           "Finance",
+		OrganizationId: 1,
+		Permissions:    []string{"refunds:create"},
+		Policies:       compileRolePolicies(11, map[string]string{"refunds:create": `time.hour < 17`}),
+	})
+	// Roles in other organizations are not part of the derivation.
+	p.groupCache.Put(20, &GroupPermissions{GroupId: 20, Name: "Other", OrganizationId: 2, Permissions: []string{"everything"}})
+
+	explanation, err := p.ExplainPermissions(ctx, 1, 1, "")
+	if err != nil {
+		t.Fatalf("ExplainPermissions failed: %v", err)
+	}
+	want := []PermissionGrant{
+		{Permission: "refunds:create", RoleId: 10, RoleName: "Support", Source: PermissionSourceDirect},
+		{Permission: "refunds:create", RoleId: 11, RoleName: "Finance", Source: PermissionSourceAccessRequest, AccessRequestId: 7, Policy: `time.hour < 17`},
+		{Permission: "tickets:read", RoleId: 10, RoleName: "Support", Source: PermissionSourceDirect},
+	}
+	if !slices.Equal(explanation.Grants, want) {
+		t.Fatalf("expected %+v, got %+v", want, explanation.Grants)
+	}
+	if permissions := explanation.Permissions(); !slices.Equal(permissions, []string{"refunds:create", "tickets:read"}) {
+		t.Fatalf("unexpected permissions %v", permissions)
+	}
+
+	explanation, _ = p.ExplainPermissions(ctx, 1, 1, "tickets:read")
+	if len(explanation.Grants) != 1 || explanation.Grants[0].RoleId != 10 {
+		t.Fatalf("expected one grant, got %+v", explanation.Grants)
+	}
+
+	explanation, _ = p.ExplainPermissions(ctx, 2, 1, "")
+	if len(explanation.Grants) != 0 || explanation.Excluded == "" {
+		t.Fatalf("expected the service account's roles to be excluded, got %+v", explanation)
+	}
+}
@@ -0,0 +1,185 @@
+package ubmanage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubpolicy"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+// PolicyTimezoneSetting is the organization setting holding the IANA time
+// zone, such as Europe/London, that policies see the time in. Defaults to
+// UTC.
+const PolicyTimezoneSetting = "timezone"
+
+// PolicyInput describes the request a permission is checked for. Policies on
+// role permissions are evaluated against it.
+type PolicyInput struct {
+	// Time is when the request is made. Defaults to now.
+	Time time.Time
+	// IpAddress is the address the request is made from, if known.
+	IpAddress string
+	// Attributes are made available to policies as request.<name>.
+	Attributes map[string]any
+}
+
+// PolicyAttributes returns the attributes policies are evaluated against:
+//
+//   - time.unix, time.hour, time.minute, time.weekday (such as "monday") and
+//     time.date (such as "2025-09-23"), in the organization's time zone
+//   - request.ip and request.<name> for each of the input's attributes
+//   - user.id and org.id
+//   - user.settings.<key> and org.settings.<key> for each setting
+func PolicyAttributes(userId int64, orgId int64, input PolicyInput, userSettings map[string]string, orgSettings map[string]string) ubpolicy.Attributes {
+	now := input.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if name := orgSettings[PolicyTimezoneSetting]; name != "" {
+		if location, err := time.LoadLocation(name); err == nil {
+			now = now.In(location)
+		} else {
+			slog.Warn("Invalid organization time zone", "organizationId", orgId, "timezone", name)
+			now = now.UTC()
+		}
+	} else {
+		now = now.UTC()
+	}
+
+	attributes := ubpolicy.Attributes{
+		"time.unix":    now.Unix(),
+		"time.hour":    now.Hour(),
+		"time.minute":  now.Minute(),
+		"time.weekday": strings.ToLower(now.Weekday().String()),
+		"time.date":    now.Format(time.DateOnly),
+		"user.id":      userId,
+		"org.id":       orgId,
+	}
+	if input.IpAddress != "" {
+		attributes["request.ip"] = input.IpAddress
+	}
+	for name, value := range input.Attributes {
+		attributes["request."+name] = value
+	}
+	for key, value := range userSettings {
+		attributes["user.settings."+key] = value
+	}
+	for key, value := range orgSettings {
+		attributes["org.settings."+key] = value
+	}
+	return attributes
+}
+
+// compileRolePolicies compiles the policies of a role. Policies are checked
+// when they are set, so one that fails to compile here is logged and kept as
+// nil, which allows nothing.
+func compileRolePolicies(roleId int64, policies map[string]string) map[string]*ubpolicy.Policy {
+	compiled := make(map[string]*ubpolicy.Policy, len(policies))
+	for permission, source := range policies {
+		policy, err := ubpolicy.Compile(source)
+		if err != nil {
+			slog.Error("Invalid role permission policy", "roleId", roleId, "permission", permission, "error", err)
+		}
+		compiled[permission] = policy
+	}
+	return compiled
+}
+
+// permissionSet holds what a user is granted in an organization.
+type permissionSet struct {
+	// permissions are sorted, and include conditional permissions.
+	permissions []string
+	// policies holds the policies of permissions which are only granted
+	// conditionally, one for each role granting the permission. The
+	// permission is held when any of them allows the request.
+	policies map[string][]*ubpolicy.Policy
+	// validUntil is the unix time a role membership of the user next starts
+	// or ends, after which the set is stale. Zero means never.
+	validUntil int64
+}
+
+// policyRequest is a request permissions are checked for. Its attributes are
+// only loaded once a policy needs them.
+type policyRequest struct {
+	userId     int64
+	orgId      int64
+	input      PolicyInput
+	attributes ubpolicy.Attributes
+}
+
+// permitted reports whether the set grants the permission for the request.
+func (p *PrefectServiceImpl) permitted(ctx context.Context, set *permissionSet, permission string, request *policyRequest) (bool, error) {
+	if _, found := slices.BinarySearch(set.permissions, permission); !found {
+		return false, nil
+	}
+	policies, conditional := set.policies[permission]
+	if !conditional {
+		return true, nil
+	}
+
+	if request.attributes == nil {
+		attributes, err := p.policyAttributes(ctx, request.userId, request.orgId, request.input)
+		if err != nil {
+			return false, err
+		}
+		request.attributes = attributes
+	}
+	return anyPolicyAllows(policies, request.attributes, request.userId, request.orgId, permission), nil
+}
+
+// anyPolicyAllows reports whether one of the policies of a conditional
+// permission allows the request described by attributes.
+func anyPolicyAllows(policies []*ubpolicy.Policy, attributes ubpolicy.Attributes, userId int64, orgId int64, permission string) bool {
+	for _, policy := range policies {
+		if policy == nil {
+			continue
+		}
+		allowed, err := policy.Evaluate(attributes)
+		if err != nil {
+			// Failing policies deny, like policies evaluating to false.
+			slog.Warn("Policy evaluation failed", "userId", userId, "organizationId", orgId, "permission", permission, "error", err)
+			continue
+		}
+		if allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *PrefectServiceImpl) policyAttributes(ctx context.Context, userId int64, orgId int64, input PolicyInput) (ubpolicy.Attributes, error) {
+	userData, err := p.getUserData(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	orgSettings, err := p.getOrganizationSettings(ctx, orgId)
+	if err != nil {
+		return nil, err
+	}
+	return PolicyAttributes(userId, orgId, input, userData.Settings, orgSettings), nil
+}
+
+// getOrganizationSettings returns the settings of an organization. The result
+// is shared with the cache and must not be modified.
+func (p *PrefectServiceImpl) getOrganizationSettings(ctx context.Context, orgId int64) (map[string]string, error) {
+	if settings, found := p.orgSettingsCache.Get(orgId); found {
+		return settings, nil
+	}
+
+	resp, err := p.managementService.OrganizationGet(ctx, orgId)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != ubstatus.Success {
+		return nil, fmt.Errorf("failed to get organization settings: %s", resp.Message)
+	}
+	settings := maps.Clone(resp.Data.State.Settings)
+	p.orgSettingsCache.Put(orgId, settings)
+	return settings, nil
+}
@@ -0,0 +1,129 @@
+package ubmanage
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubpolicy"
+)
+
+func TestPolicyAttributes(t *testing.T) {
+	// A Saturday, 08:30 UTC.
+	at := time.Date(2025, 9, 20, 8, 30, 0, 0, time.UTC)
+	input := PolicyInput{Time: at, IpAddress: "10.0.0.1", Attributes: map[string]any{"amount": 20}}
+	attributes := PolicyAttributes(5, 7, input,
+		map[string]string{"team": "finance"},
+		map[string]string{PolicyTimezoneSetting: "Asia/Tokyo", "region": "eu"})
+
+	want := map[string]any{
+		"time.hour":             17,
+		"time.minute":           30,
+		"time.weekday":          "saturday",
+		"time.date":             "2025-09-20",
+		"time.unix":             at.Unix(),
+		"request.ip":            "10.0.0.1",
+		"request.amount":        20,
+		"user.id":               int64(5),
+		"org.id":                int64(7),
+		"user.settings.team":    "finance",
+		"org.settings.region":   "eu",
+		"org.settings.timezone": "Asia/Tokyo",
+	}
+	for name, value := range want {
+		if attributes[name] != value {
+			t.Fatalf("expected %s to be %v, got %v", name, value, attributes[name])
+		}
+	}
+
+	// Invalid time zones fall back to UTC.
+	attributes = PolicyAttributes(5, 7, input, nil, map[string]string{PolicyTimezoneSetting: "Nowhere/Special"})
+	if attributes["time.hour"] != 8 {
+		t.Fatalf("expected UTC hour, got %v", attributes["time.hour"])
+	}
+}
+
+func TestPrefectPermissionPolicies(t *testing.T) {
+	p := newTestPrefect()
+	p.started.Store(true)
+	p.subscribed.Store(true)
+	ctx := context.Background()
+
+	p.userCache.Put(1, &UserData{Id: 1, Roles: []int64{10, 11}, Settings: map[string]string{"limit": "100"}})
+	p.userCache.Put(2, &UserData{Id: 2, Roles: []int64{10, 12}})
+	p.orgSettingsCache.Put(1, map[string]string{"offices": "10.0.0.0/8"})
+	p.groupCache.Put(10, &GroupPermissions{
+		GroupId:        10,
+		OrganizationId: 1,
+		Permissions:    []string{"refunds:create", "reports:read", "broken"},
+		Policies: compileRolePolicies(10, map[string]string{
+			"refunds:create": `cidr(request.ip, org.settings.offices)`,
+			"reports:read":   `request.amount <= number(user.settings.limit)`,
+			// Policies that fail to compile deny.
+			"broken": `(`,
+		}),
+	})
+	p.groupCache.Put(11, &GroupPermissions{
+		GroupId:        11,
+		OrganizationId: 1,
+		Permissions:    []string{"refunds:create"},
+		Policies:       map[string]*ubpolicy.Policy{"refunds:create": mustCompilePolicy(t, `request.ip == "192.0.2.1"`)},
+	})
+	// Role 12 grants reports:read without a policy.
+	p.groupCache.Put(12, &GroupPermissions{GroupId: 12, OrganizationId: 1, Permissions: []string{"reports:read"}})
+
+	checks := []struct {
+		name       string
+		userId     int64
+		permission string
+		input      PolicyInput
+		want       bool
+	}{
+		{"office address", 1, "refunds:create", PolicyInput{IpAddress: "10.1.1.1"}, true},
+		{"another role's policy", 1, "refunds:create", PolicyInput{IpAddress: "192.0.2.1"}, true},
+		{"outside address", 1, "refunds:create", PolicyInput{IpAddress: "198.51.100.1"}, false},
+		{"unknown address", 1, "refunds:create", PolicyInput{}, false},
+		{"user setting", 1, "reports:read", PolicyInput{Attributes: map[string]any{"amount": 50}}, true},
+		{"user setting exceeded", 1, "reports:read", PolicyInput{Attributes: map[string]any{"amount": 500}}, false},
+		{"evaluation error denies", 1, "reports:read", PolicyInput{}, false},
+		{"unconditional role wins", 2, "reports:read", PolicyInput{}, true},
+		{"invalid policy", 1, "broken", PolicyInput{}, false},
+		{"not granted", 1, "users:write", PolicyInput{IpAddress: "10.1.1.1"}, false},
+	}
+	for _, c := range checks {
+		if got, err := p.UserHasPermissionFor(ctx, c.userId, 1, c.permission, c.input); err != nil || got != c.want {
+			t.Fatalf("%s: expected %v, got %v %v", c.name, c.want, got, err)
+		}
+	}
+
+	if ok, _ := p.UserHasPermission(ctx, 1, 1, "refunds:create"); ok {
+		t.Fatal("expected UserHasPermission to evaluate policies without request details")
+	}
+	if ok, _ := p.UserHasAnyPermission(ctx, 1, 1, "refunds:create", "broken"); ok {
+		t.Fatal("expected conditional permissions to be denied")
+	}
+	if ok, _ := p.UserHasAllPermissions(ctx, 2, 1, "reports:read"); !ok {
+		t.Fatal("expected unconditional permissions to be held")
+	}
+	if permissions, _ := p.UserPermissions(ctx, 1, 1); len(permissions) != 3 {
+		t.Fatalf("expected conditional permissions to be listed, got %v", permissions)
+	}
+	permissions, err := p.UserPermissionsFor(ctx, 1, 1, PolicyInput{IpAddress: "10.1.1.1"})
+	if err != nil || !slices.Equal(permissions, []string{"refunds:create"}) {
+		t.Fatalf("expected only the permissions the request is allowed, got %v %v", permissions, err)
+	}
+	permissions, err = p.UserPermissionsFor(ctx, 2, 1, PolicyInput{IpAddress: "198.51.100.1"})
+	if err != nil || !slices.Equal(permissions, []string{"reports:read"}) {
+		t.Fatalf("expected unconditional permissions to be listed, got %v %v", permissions, err)
+	}
+}
+
+func mustCompilePolicy(t *testing.T, source string) *ubpolicy.Policy {
+	t.Helper()
+	policy, err := ubpolicy.Compile(source)
+	if err != nil {
+		t.Fatalf("compile %q failed: %v", source, err)
+	}
+	return policy
+}
@@ -0,0 +1,202 @@
+package ubmanage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubdata"
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+// RelationService answers questions about single resources from the
+// relationship tuples written with the management service.
+type RelationService interface {
+	// Check reports whether the user holds the relation on the object,
+	// either directly, through a role or userset, or through a relation
+	// which implies it.
+	Check(ctx context.Context, userId int64, objectType string, objectId string, relation string) (bool, error)
+
+	// ListObjects returns the sorted ids of the objects of the type on
+	// which the user holds the relation.
+	ListObjects(ctx context.Context, userId int64, objectType string, relation string) ([]string, error)
+}
+
+// relationTuplesKey keys the relation cache, which holds the tuples of
+// objects and the tuples granting relations to subjects.
+type relationTuplesKey struct {
+	bySubject bool
+	kind      string
+	id        string
+	relation  string
+}
+
+func objectTuplesKey(objectType string, objectId string) relationTuplesKey {
+	return relationTuplesKey{kind: objectType, id: objectId}
+}
+
+func subjectTuplesKey(subjectType string, subjectId string, subjectRelation string) relationTuplesKey {
+	return relationTuplesKey{bySubject: true, kind: subjectType, id: subjectId, relation: subjectRelation}
+}
+
+func (p *PrefectServiceImpl) Check(ctx context.Context, userId int64, objectType string, objectId string, relation string) (bool, error) {
+	if err := p.available(); err != nil {
+		return false, err
+	}
+
+	userData, err := p.getUserData(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+	visited := map[relationTuplesKey]int{}
+	held, err := p.checkRelation(ctx, userData, objectType, objectId, relation, 0, visited)
+	if err != nil {
+		slog.Error("Error checking relation", "userId", userId, "objectType", objectType, "objectId", objectId, "relation", relation, "error", err)
+		return false, err
+	}
+	return held, nil
+}
+
+func (p *PrefectServiceImpl) checkRelation(
+	ctx context.Context,
+	userData *UserData,
+	objectType string,
+	objectId string,
+	relation string,
+	depth int,
+	visited map[relationTuplesKey]int,
+) (bool, error) {
+	if depth > MaxRelationDepth {
+		slog.Warn("Relation check exceeded the maximum depth", "objectType", objectType, "objectId", objectId, "relation", relation)
+		return false, nil
+	}
+	// visited holds the depth each userset was expanded at. One first reached
+	// by a longer path is expanded again from a shorter one, which can still
+	// reach usersets the depth limit cut off.
+	key := relationTuplesKey{kind: objectType, id: objectId, relation: relation}
+	if visitedAt, found := visited[key]; found && visitedAt <= depth {
+		return false, nil
+	}
+	visited[key] = depth
+
+	tuples, err := p.objectTuples(ctx, objectType, objectId)
+	if err != nil {
+		return false, err
+	}
+	relations := p.relationSchema.implying(objectType, relation)
+	for _, t := range tuples {
+		if !slices.Contains(relations, t.Relation) {
+			continue
+		}
+		switch {
+		case t.SubjectRelation == "":
+			if t.SubjectType == RelationSubjectUser && t.SubjectId == strconv.FormatInt(userData.Id, 10) {
+				return true, nil
+			}
+		case t.SubjectType == RelationSubjectRole && t.SubjectRelation == RelationMember:
+			roleId, err := strconv.ParseInt(t.SubjectId, 10, 64)
+			if err == nil && slices.Contains(userData.activeRoles(time.Now()), roleId) {
+				return true, nil
+			}
+		default:
+			held, err := p.checkRelation(ctx, userData, t.SubjectType, t.SubjectId, t.SubjectRelation, depth+1, visited)
+			if err != nil || held {
+				return held, err
+			}
+		}
+	}
+	return false, nil
+}
+
+func (p *PrefectServiceImpl) ListObjects(ctx context.Context, userId int64, objectType string, relation string) ([]string, error) {
+	if err := p.available(); err != nil {
+		return nil, err
+	}
+
+	userData, err := p.getUserData(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk outwards from the user and their roles. Every relation found on
+	// an object also makes the object a userset for the next level.
+	subjects := []relationTuplesKey{subjectTuplesKey(RelationSubjectUser, strconv.FormatInt(userId, 10), "")}
+	for _, roleId := range userData.activeRoles(time.Now()) {
+		subjects = append(subjects, subjectTuplesKey(RelationSubjectRole, strconv.FormatInt(roleId, 10), RelationMember))
+	}
+	held := map[relationTuplesKey]bool{}
+	objectIds := []string{}
+	for depth := 0; len(subjects) > 0 && depth <= MaxRelationDepth; depth++ {
+		next := []relationTuplesKey{}
+		for _, subject := range subjects {
+			tuples, err := p.subjectTuples(ctx, subject)
+			if err != nil {
+				slog.Error("Error listing objects", "userId", userId, "objectType", objectType, "relation", relation, "error", err)
+				return nil, err
+			}
+			for _, t := range tuples {
+				for _, r := range p.relationSchema.implied(t.ObjectType, t.Relation) {
+					key := subjectTuplesKey(t.ObjectType, t.ObjectId, r)
+					if held[key] {
+						continue
+					}
+					held[key] = true
+					next = append(next, key)
+					if t.ObjectType == objectType && r == relation {
+						objectIds = append(objectIds, t.ObjectId)
+					}
+				}
+			}
+		}
+		subjects = next
+	}
+	slices.Sort(objectIds)
+	return slices.Compact(objectIds), nil
+}
+
+// objectTuples returns the tuples of an object. The result is shared with
+// the cache and must not be modified.
+func (p *PrefectServiceImpl) objectTuples(ctx context.Context, objectType string, objectId string) ([]ubdata.RelationTuple, error) {
+	key := objectTuplesKey(objectType, objectId)
+	if tuples, found := p.relationCache.Get(key); found {
+		return tuples, nil
+	}
+
+	resp, err := p.managementService.RelationTuplesByObject(ctx, objectType, objectId)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != ubstatus.Success {
+		return nil, fmt.Errorf("failed to get relation tuples: %s", resp.Message)
+	}
+	p.relationCache.Put(key, resp.Data)
+	return resp.Data, nil
+}
+
+// subjectTuples returns the tuples granting relations to a subject. The
+// result is shared with the cache and must not be modified.
+func (p *PrefectServiceImpl) subjectTuples(ctx context.Context, key relationTuplesKey) ([]ubdata.RelationTuple, error) {
+	if tuples, found := p.relationCache.Get(key); found {
+		return tuples, nil
+	}
+
+	resp, err := p.managementService.RelationTuplesBySubject(ctx, key.kind, key.id, key.relation)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != ubstatus.Success {
+		return nil, fmt.Errorf("failed to get relation tuples: %s", resp.Message)
+	}
+	p.relationCache.Put(key, resp.Data)
+	return resp.Data, nil
+}
+
+// relationInvalidation removes the cached tuples a written or deleted tuple
+// belongs to.
+func (p *PrefectServiceImpl) relationInvalidation(t ubdata.RelationTuple) {
+	p.relationCache.Remove(objectTuplesKey(t.ObjectType, t.ObjectId))
+	p.relationCache.Remove(subjectTuplesKey(t.SubjectType, t.SubjectId, t.SubjectRelation))
+}
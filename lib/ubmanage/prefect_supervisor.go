@@ -0,0 +1,210 @@
+package ubmanage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	evercore "github.com/kernelplex/evercore/base"
+)
+
+// The prefect service caches users, roles, API keys and relationship tuples
+// and relies on its event subscription to invalidate them. If the
+// subscription fails, the service refuses every check until it is running
+// again and restarts it with exponential backoff. The new run resumes after
+// the last event processed, so invalidations published during the outage are
+// still applied, and the caches are flushed once that position is known.
+// Events that cannot be decoded are skipped rather than treated as failures,
+// since a restart would only read them again.
+
+const (
+	DefaultPrefectRestartBackoff    = time.Second
+	DefaultPrefectMaxRestartBackoff = time.Minute
+)
+
+var (
+	errPrefectNotStarted        = errors.New("prefect service not started")
+	errPrefectUnavailable       = errors.New("prefect service is not receiving events")
+	errPrefectSubscriptionEnded = errors.New("event subscription ended")
+)
+
+// PrefectHealth describes the state of the prefect service's event
+// subscription.
+type PrefectHealth struct {
+	// Started is true between Start and Stop.
+	Started bool `json:"started"`
+	// Subscribed is true while events are being processed. Checks fail while
+	// the service is started but not subscribed.
+	Subscribed bool `json:"subscribed"`
+	// Outages counts how often the subscription has failed.
+	Outages uint64 `json:"outages"`
+	// Downtime is the total time spent waiting to restart the subscription,
+	// not counting a current outage.
+	Downtime time.Duration `json:"downtime"`
+	// DownSince is when the current outage began, or zero.
+	DownSince    time.Time `json:"downSince,omitzero"`
+	LastError    string    `json:"lastError,omitempty"`
+	LastOutageAt time.Time `json:"lastOutageAt,omitzero"`
+}
+
+// Healthy reports whether the service can answer checks.
+func (h PrefectHealth) Healthy() bool {
+	return h.Started && h.Subscribed
+}
+
+func (p *PrefectServiceImpl) Start() error {
+	p.lifecycleLock.Lock()
+	defer p.lifecycleLock.Unlock()
+
+	if p.cancel != nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.ctx = ctx
+	p.cancel = cancel
+	p.done = make(chan struct{})
+	// Mark the service usable straight away, as callers expect it to be once
+	// Start returns.
+	start := p.resumeFrom()
+	p.resubscribe()
+	p.started.Store(true)
+	go p.main(ctx, p.done, start)
+	return nil
+}
+
+func (p *PrefectServiceImpl) Stop() error {
+	p.lifecycleLock.Lock()
+	defer p.lifecycleLock.Unlock()
+
+	if p.cancel != nil {
+		p.cancel()
+		<-p.done
+		p.cancel = nil
+		p.done = nil
+	}
+	p.started.Store(false)
+	p.subscribed.Store(false)
+	return nil
+}
+
+func (p *PrefectServiceImpl) Health() PrefectHealth {
+	p.healthLock.Lock()
+	health := p.health
+	p.healthLock.Unlock()
+
+	health.Started = p.started.Load()
+	health.Subscribed = p.subscribed.Load()
+	return health
+}
+
+// available returns an error unless the service is started and processing
+// events.
+func (p *PrefectServiceImpl) available() error {
+	if !p.started.Load() {
+		slog.Error("prefect service not started")
+		return errPrefectNotStarted
+	}
+	if !p.subscribed.Load() {
+		slog.Error("prefect service is not receiving events")
+		return errPrefectUnavailable
+	}
+	return nil
+}
+
+// main runs the event subscription from start until ctx is cancelled,
+// restarting it whenever it fails.
+func (p *PrefectServiceImpl) main(ctx context.Context, done chan struct{}, start evercore.StartFrom) {
+	defer close(done)
+	slog.Info("Starting Prefect Service")
+
+	backoff := p.restartBackoff
+	for {
+		runStartedAt := time.Now()
+		err := p.subscribe(ctx, start, p.handleEvents)
+		// Fail closed until the subscription is running again.
+		p.subscribed.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = errPrefectSubscriptionEnded
+		}
+
+		if time.Since(runStartedAt) >= p.maxRestartBackoff {
+			// The subscription had been running for a while, so start over
+			// rather than continue backing off.
+			backoff = p.restartBackoff
+		}
+		outages := p.recordOutage(err)
+		slog.Error("Prefect event subscription failed, restarting",
+			"error", err,
+			"outages", outages,
+			"retryIn", backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, p.maxRestartBackoff)
+		start = p.resumeFrom()
+		p.resubscribe()
+	}
+}
+
+// resumeFrom returns where the next run of the subscription starts: after the
+// last event processed. Until an event has been processed there is no
+// position to resume from, and the run starts at the end of the event store.
+func (p *PrefectServiceImpl) resumeFrom() evercore.StartFrom {
+	if last := p.lastEventId.Load(); last > 0 {
+		return evercore.StartFrom{Kind: evercore.StartEventID, EventID: last}
+	}
+	return evercore.StartFrom{Kind: evercore.StartEnd}
+}
+
+// resubscribe readies the service for a new run of the subscription, once
+// resumeFrom has fixed where it starts. Anything cached before now may have
+// missed an invalidation.
+func (p *PrefectServiceImpl) resubscribe() {
+	p.flushCaches()
+	p.recordRestart()
+	p.subscribed.Store(true)
+}
+
+func (p *PrefectServiceImpl) flushCaches() {
+	p.userCache.Clear()
+	p.groupCache.Clear()
+	p.apiKeyCache.Clear()
+	p.permissionCache.Clear()
+	p.orgSettingsCache.Clear()
+	p.relationCache.Clear()
+}
+
+// recordOutage notes a subscription failure and returns the number of
+// outages so far.
+func (p *PrefectServiceImpl) recordOutage(err error) uint64 {
+	p.healthLock.Lock()
+	defer p.healthLock.Unlock()
+
+	now := time.Now()
+	p.health.Outages++
+	p.health.LastError = err.Error()
+	p.health.LastOutageAt = now
+	p.health.DownSince = now
+	return p.health.Outages
+}
+
+// recordRestart ends the current outage, if any.
+func (p *PrefectServiceImpl) recordRestart() {
+	p.healthLock.Lock()
+	defer p.healthLock.Unlock()
+
+	if p.health.DownSince.IsZero() {
+		return
+	}
+	downtime := time.Since(p.health.DownSince)
+	p.health.Downtime += downtime
+	p.health.DownSince = time.Time{}
+	slog.Info("Restarting prefect event subscription", "downtime", downtime, "outages", p.health.Outages)
+}
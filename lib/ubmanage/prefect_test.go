@@ -0,0 +1,324 @@
+package ubmanage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	evercore "github.com/kernelplex/evercore/base"
+	ev "github.com/kernelplex/ubase/internal/evercoregen/events"
+	"github.com/kernelplex/ubase/lib/ubalgorithms"
+	"github.com/kernelplex/ubase/lib/ubdata"
+)
+
+func newTestPrefect() *PrefectServiceImpl {
+	options := ubalgorithms.ShardedLRUCacheOptions{}
+	return &PrefectServiceImpl{
+		userCache:        ubalgorithms.NewShardedLRUCache[int64, *UserData](1000, options),
+		groupCache:       ubalgorithms.NewShardedLRUCache[int64, *GroupPermissions](1000, options),
+		apiKeyCache:      ubalgorithms.NewShardedLRUCache[string, *ApiKeyData](1000, options),
+		permissionCache:  ubalgorithms.NewShardedLRUCache[userOrganization, *permissionSet](1000, options),
+		orgSettingsCache: ubalgorithms.NewShardedLRUCache[int64, map[string]string](1000, options),
+		relationCache:    ubalgorithms.NewShardedLRUCache[relationTuplesKey, []ubdata.RelationTuple](1000, options),
+		apiKeyUsage:      ubalgorithms.NewShardedLRUCache[string, int64](1000, options),
+	}
+}
+
+func TestPrefectApiKeyInvalidation(t *testing.T) {
+	p := newTestPrefect()
+	p.apiKeyCache.Put("key0000001secret", &ApiKeyData{UserId: 1})
+	p.apiKeyCache.Put("key0000002secret", &ApiKeyData{UserId: 1})
+
+	p.apiKeyInvalidation("key0000001")
+	if _, found := p.apiKeyCache.Get("key0000001secret"); found {
+		t.Fatal("expected invalidated key to be removed")
+	}
+	if _, found := p.apiKeyCache.Get("key0000002secret"); !found {
+		t.Fatal("expected other keys to remain cached")
+	}
+}
+
+func TestPrefectUserPermissions(t *testing.T) {
+	p := newTestPrefect()
+	p.started.Store(true)
+	p.subscribed.Store(true)
+	ctx := context.Background()
+
+	p.userCache.Put(1, &UserData{Id: 1, Roles: []int64{10, 11, 20}})
+	p.groupCache.Put(10, &GroupPermissions{GroupId: 10, OrganizationId: 1, Permissions: []string{"users:read", "reports:read"}})
+	p.groupCache.Put(11, &GroupPermissions{GroupId: 11, OrganizationId: 1, Permissions: []string{"reports:read", "reports:export"}})
+	p.groupCache.Put(20, &GroupPermissions{GroupId: 20, OrganizationId: 2, Permissions: []string{"billing:admin"}})
+
+	permissions, err := p.UserPermissions(ctx, 1, 1)
+	if err != nil {
+		t.Fatalf("UserPermissions failed: %v", err)
+	}
+	if want := []string{"reports:export", "reports:read", "users:read"}; !slices.Equal(permissions, want) {
+		t.Fatalf("expected %v, got %v", want, permissions)
+	}
+
+	checks := []struct {
+		name string
+		fn   func(context.Context, int64, int64, ...string) (bool, error)
+		args []string
+		want bool
+	}{
+		{"any held", p.UserHasAnyPermission, []string{"billing:admin", "users:read"}, true},
+		{"any from other org", p.UserHasAnyPermission, []string{"billing:admin"}, false},
+		{"any of none", p.UserHasAnyPermission, nil, false},
+		{"all held", p.UserHasAllPermissions, []string{"reports:read", "users:read"}, true},
+		{"all missing one", p.UserHasAllPermissions, []string{"reports:read", "billing:admin"}, false},
+		{"all of none", p.UserHasAllPermissions, nil, true},
+	}
+	for _, c := range checks {
+		if got, err := c.fn(ctx, 1, 1, c.args...); err != nil || got != c.want {
+			t.Fatalf("%s: expected %v, got %v %v", c.name, c.want, got, err)
+		}
+	}
+
+	// The set is cached until the user or a role is invalidated.
+	p.groupCache.Put(10, &GroupPermissions{GroupId: 10, OrganizationId: 1, Permissions: []string{"users:write"}})
+	if ok, _ := p.UserHasPermission(ctx, 1, 1, "users:write"); ok {
+		t.Fatal("expected the cached permission set to be used")
+	}
+	_ = p.GroupInvalidation(ctx, 99)
+	if ok, _ := p.UserHasPermission(ctx, 1, 1, "users:write"); !ok {
+		t.Fatal("expected the permission set to be rebuilt after a role change")
+	}
+	p.userCache.Put(1, &UserData{Id: 1, Roles: []int64{11}})
+	_ = p.UserInvalidation(ctx, 2)
+	if ok, _ := p.UserHasPermission(ctx, 1, 1, "users:write"); !ok {
+		t.Fatal("expected other users' invalidation to keep the set")
+	}
+	p.permissionCache.Remove(userOrganization{userId: 1, organizationId: 1})
+	if ok, _ := p.UserHasPermission(ctx, 1, 1, "users:write"); ok {
+		t.Fatal("expected the permission set to follow the user's roles")
+	}
+
+	// Callers cannot change the cached set.
+	permissions, _ = p.UserPermissions(ctx, 1, 1)
+	permissions[0] = "tampered"
+	if ok, _ := p.UserHasPermission(ctx, 1, 1, "tampered"); ok {
+		t.Fatal("expected UserPermissions to return a copy")
+	}
+}
+
+func TestPrefectServiceAccountPermissions(t *testing.T) {
+	p := newTestPrefect()
+	p.started.Store(true)
+	p.subscribed.Store(true)
+	ctx := context.Background()
+
+	p.userCache.Put(1, &UserData{Id: 1, Roles: []int64{10, 20}, ServiceAccount: true, OwnerOrganizationId: 1})
+	p.groupCache.Put(10, &GroupPermissions{GroupId: 10, OrganizationId: 1, Permissions: []string{"jobs:run"}})
+	p.groupCache.Put(20, &GroupPermissions{GroupId: 20, OrganizationId: 2, Permissions: []string{"jobs:run"}})
+
+	if ok, _ := p.UserHasPermission(ctx, 1, 1, "jobs:run"); !ok {
+		t.Fatal("expected the service account to hold permissions in its organization")
+	}
+	if permissions, _ := p.UserPermissions(ctx, 1, 2); len(permissions) != 0 {
+		t.Fatalf("expected no permissions outside the owning organization, got %v", permissions)
+	}
+}
+
+func TestPrefectUserSessionValid(t *testing.T) {
+	p := newTestPrefect()
+	p.started.Store(true)
+	p.subscribed.Store(true)
+	ctx := context.Background()
+
+	p.userCache.Put(1, &UserData{Id: 1})
+	p.userCache.Put(2, &UserData{Id: 2, SessionsRevokedAt: 1000})
+	p.userCache.Put(3, &UserData{Id: 3, Disabled: true})
+
+	cases := []struct {
+		name     string
+		userId   int64
+		issuedAt int64
+		want     bool
+	}{
+		{"never revoked", 1, 500, true},
+		{"issued before revocation", 2, 999, false},
+		{"issued in the revocation second", 2, 1000, false},
+		{"issued after revocation", 2, 1001, true},
+		{"disabled", 3, 2000, false},
+	}
+	for _, c := range cases {
+		valid, err := p.UserSessionValid(ctx, c.userId, c.issuedAt)
+		if err != nil || valid != c.want {
+			t.Fatalf("%s: expected %v, got %v %v", c.name, c.want, valid, err)
+		}
+	}
+}
+
+func TestPrefectNotStarted(t *testing.T) {
+	p := newTestPrefect()
+	if _, err := p.UserHasPermission(context.Background(), 1, 1, "perm"); !errors.Is(err, errPrefectNotStarted) {
+		t.Fatalf("expected not started error, got %v", err)
+	}
+}
+
+func TestPrefectRestartsFailedSubscription(t *testing.T) {
+	p := newTestPrefect()
+	p.restartBackoff = 200 * time.Millisecond
+	p.maxRestartBackoff = time.Second
+
+	calls := make(chan evercore.StartFrom)
+	failures := make(chan error)
+	p.subscribe = func(ctx context.Context, start evercore.StartFrom, handler func(context.Context, []evercore.SerializedEvent) error) error {
+		calls <- start
+		if err := handler(ctx, []evercore.SerializedEvent{{EventID: 42, EventType: "Unrelated"}}); err != nil {
+			return err
+		}
+		select {
+		case err := <-failures:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	waitFor := func(what string, condition func() bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !condition() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	ctx := context.Background()
+
+	if err := p.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if start := <-calls; start.Kind != evercore.StartEnd {
+		t.Fatalf("expected the first run to start at the end, got %+v", start)
+	}
+	if health := p.Health(); !health.Healthy() || health.Outages != 0 {
+		t.Fatalf("expected a healthy service, got %+v", health)
+	}
+	p.userCache.Put(1, &UserData{Id: 1})
+	if valid, err := p.UserSessionValid(ctx, 1, 0); err != nil || !valid {
+		t.Fatalf("expected cached user to be used, got %v %v", valid, err)
+	}
+
+	// Checks fail closed while the subscription is down.
+	failures <- errors.New("connection lost")
+	waitFor("outage", func() bool { return p.Health().Outages == 1 })
+	if _, err := p.UserSessionValid(ctx, 1, 0); !errors.Is(err, errPrefectUnavailable) {
+		t.Fatalf("expected checks to fail during the outage, got %v", err)
+	}
+	if health := p.Health(); health.Healthy() || health.DownSince.IsZero() || health.LastError != "connection lost" {
+		t.Fatalf("unexpected health during outage %+v", health)
+	}
+
+	// The subscription resumes after the last processed event, so events
+	// published during the outage are not missed, and starts with empty
+	// caches.
+	if start := <-calls; start.Kind != evercore.StartEventID || start.EventID != 42 {
+		t.Fatalf("expected the restart to resume after event 42, got %+v", start)
+	}
+	waitFor("restart", func() bool { return p.Health().Healthy() })
+	if p.userCache.Len() != 0 {
+		t.Fatal("expected caches to be flushed on restart")
+	}
+	health := p.Health()
+	if health.Outages != 1 || !health.DownSince.IsZero() || health.Downtime < p.restartBackoff {
+		t.Fatalf("unexpected health after restart %+v", health)
+	}
+
+	if err := p.Stop(); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+	if health := p.Health(); health.Started || health.Subscribed {
+		t.Fatalf("expected a stopped service, got %+v", health)
+	}
+}
+
+func TestPrefectSkipsUndecodableEvents(t *testing.T) {
+	// The generated decoders cannot be imported here, so decode the one
+	// event type the test uses.
+	evercore.RegisterEventDecoder(func(e evercore.SerializedEvent) (evercore.EventState, error) {
+		if e.EventType != ev.UserAddedToRoleEventType {
+			return nil, nil
+		}
+		state := UserAddedToRoleEvent{}
+		err := evercore.DecodeEventStateTo(e, &state)
+		return state, err
+	})
+
+	p := newTestPrefect()
+	p.restartBackoff = 200 * time.Millisecond
+	p.maxRestartBackoff = time.Second
+
+	deliver := make(chan struct{})
+	handled := make(chan error)
+	p.subscribe = func(ctx context.Context, start evercore.StartFrom, handler func(context.Context, []evercore.SerializedEvent) error) error {
+		<-deliver
+		err := handler(ctx, []evercore.SerializedEvent{
+			{EventID: 41, EventType: ev.UserAddedToRoleEventType, State: "not json"},
+			{EventID: 42, EventType: ev.UserAddedToRoleEventType, State: `{"userId":2,"roleId":3}`},
+		})
+		handled <- err
+		if err != nil {
+			return err
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	if err := p.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer p.Stop()
+	p.userCache.Put(1, &UserData{Id: 1})
+	close(deliver)
+
+	if err := <-handled; err != nil {
+		t.Fatalf("expected the undecodable event to be skipped, got %v", err)
+	}
+	if last := p.lastEventId.Load(); last != 42 {
+		t.Fatalf("expected processing to continue past the event, got last event %d", last)
+	}
+	if p.userCache.Len() != 0 {
+		t.Fatal("expected caches to be flushed in place of the skipped invalidation")
+	}
+	if health := p.Health(); !health.Healthy() || health.Outages != 0 {
+		t.Fatalf("expected the subscription to keep running, got %+v", health)
+	}
+}
+
+// Run with -race to check the caches and started flag are safe for
+// concurrent use.
+func TestPrefectConcurrentAccess(t *testing.T) {
+	p := newTestPrefect()
+	p.started.Store(true)
+	p.subscribed.Store(true)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for worker := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 500 {
+				// Workers use their own ids, so nothing they look up is
+				// invalidated by another worker.
+				userId := int64(worker*100 + i%8)
+				p.userCache.Put(userId, &UserData{Id: userId, Roles: []int64{userId}})
+				p.groupCache.Put(userId, &GroupPermissions{GroupId: userId, OrganizationId: 1, Permissions: []string{"perm"}})
+				if ok, err := p.UserHasPermission(ctx, userId, 1, "perm"); err != nil || !ok {
+					t.Errorf("expected permission, got %v %v", ok, err)
+					return
+				}
+				_ = p.UserInvalidation(ctx, userId)
+				_ = p.GroupInvalidation(ctx, userId)
+				_ = p.CacheStats()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,250 @@
+package ubmanage
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	evercore "github.com/kernelplex/evercore/base"
+	events "github.com/kernelplex/ubase/internal/evercoregen/events"
+	"github.com/kernelplex/ubase/lib/ubdata"
+	"github.com/kernelplex/ubase/lib/ubvalidation"
+)
+
+// Relationship tuples answer questions about single resources, such as
+// whether user 5 may edit document 77. A tuple document:77#editor@user:5
+// grants the editor relation on document 77 to user 5. The subject may also
+// be a userset, such as team:eng#member, granting the relation to everyone
+// holding member on team eng. Roles are built in usersets: role:12#member
+// is every user in role 12.
+
+const (
+	RelationSubjectUser = "user"
+	RelationSubjectRole = "role"
+	RelationMember      = "member"
+
+	// MaxRelationDepth bounds how many usersets a check follows.
+	MaxRelationDepth = 8
+)
+
+// RelationSchema holds the userset rewrites of each object type: for each
+// relation, the relations which imply it. With
+//
+//	RelationSchema{"document": {"editor": {"owner"}, "viewer": {"editor"}}}
+//
+// owners of a document are also its editors and viewers, and editors are
+// also viewers. Relations of types missing from the schema are only held
+// directly.
+type RelationSchema map[string]map[string][]string
+
+// implying returns the relation and every relation which implies it,
+// directly or through other relations.
+func (s RelationSchema) implying(objectType string, relation string) []string {
+	relations := []string{relation}
+	for i := 0; i < len(relations); i++ {
+		for _, r := range s[objectType][relations[i]] {
+			if !slices.Contains(relations, r) {
+				relations = append(relations, r)
+			}
+		}
+	}
+	return relations
+}
+
+// implied returns the relation and every relation it implies.
+func (s RelationSchema) implied(objectType string, relation string) []string {
+	relations := []string{relation}
+	for i := 0; i < len(relations); i++ {
+		for r, implyingRelations := range s[objectType] {
+			if slices.Contains(implyingRelations, relations[i]) && !slices.Contains(relations, r) {
+				relations = append(relations, r)
+			}
+		}
+	}
+	return relations
+}
+
+// FormatRelationTuple formats a tuple as object_type:object_id#relation@subject.
+func FormatRelationTuple(t ubdata.RelationTuple) string {
+	subject := t.SubjectType + ":" + t.SubjectId
+	if t.SubjectRelation != "" {
+		subject += "#" + t.SubjectRelation
+	}
+	return fmt.Sprintf("%s:%s#%s@%s", t.ObjectType, t.ObjectId, t.Relation, subject)
+}
+
+// RelationGrant is a relation held by a subject on the aggregate's object.
+type RelationGrant struct {
+	Relation        string `json:"relation"`
+	SubjectType     string `json:"subjectType"`
+	SubjectId       string `json:"subjectId"`
+	SubjectRelation string `json:"subjectRelation,omitempty"`
+}
+
+type RelationsState struct {
+	ObjectType string          `json:"objectType"`
+	ObjectId   string          `json:"objectId"`
+	Grants     []RelationGrant `json:"grants,omitempty"`
+}
+
+// RelationsAggregate records the tuples of a single object. Its natural key
+// is object_type:object_id.
+//
+// evercore:aggregate
+type RelationsAggregate struct {
+	evercore.StateAggregate[RelationsState]
+}
+
+func relationsAggregateKey(objectType string, objectId string) string {
+	return objectType + ":" + objectId
+}
+
+func (t *RelationsAggregate) ApplyEventState(eventState evercore.EventState, eventTime time.Time, reference string) error {
+	switch ev := eventState.(type) {
+	case RelationTupleWrittenEvent:
+		t.State.ObjectType = ev.ObjectType
+		t.State.ObjectId = ev.ObjectId
+		if !slices.Contains(t.State.Grants, ev.grant()) {
+			t.State.Grants = append(t.State.Grants, ev.grant())
+		}
+		return nil
+	case RelationTupleDeletedEvent:
+		grant := ev.grant()
+		t.State.Grants = slices.DeleteFunc(t.State.Grants, func(g RelationGrant) bool {
+			return g == grant
+		})
+		return nil
+	}
+
+	return t.StateAggregate.ApplyEventState(eventState, eventTime, reference)
+}
+
+// Holds reports whether the object's tuples include the grant.
+func (t *RelationsAggregate) Holds(grant RelationGrant) bool {
+	return slices.Contains(t.State.Grants, grant)
+}
+
+// ============================================================================
+// Commands
+// ============================================================================
+
+// RelationTupleWriteCommand grants a relation on an object to a subject.
+type RelationTupleWriteCommand struct {
+	ObjectType      string `json:"objectType"`
+	ObjectId        string `json:"objectId"`
+	Relation        string `json:"relation"`
+	SubjectType     string `json:"subjectType"`
+	SubjectId       string `json:"subjectId"`
+	SubjectRelation string `json:"subjectRelation,omitempty"`
+}
+
+func (c RelationTupleWriteCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	return validateRelationTuple(c.tuple())
+}
+
+func (c RelationTupleWriteCommand) tuple() ubdata.RelationTuple {
+	return ubdata.RelationTuple(c)
+}
+
+// RelationTupleDeleteCommand revokes a relation on an object from a subject.
+type RelationTupleDeleteCommand struct {
+	ObjectType      string `json:"objectType"`
+	ObjectId        string `json:"objectId"`
+	Relation        string `json:"relation"`
+	SubjectType     string `json:"subjectType"`
+	SubjectId       string `json:"subjectId"`
+	SubjectRelation string `json:"subjectRelation,omitempty"`
+}
+
+func (c RelationTupleDeleteCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	return validateRelationTuple(c.tuple())
+}
+
+func (c RelationTupleDeleteCommand) tuple() ubdata.RelationTuple {
+	return ubdata.RelationTuple(c)
+}
+
+func validateRelationTuple(t ubdata.RelationTuple) (bool, []ubvalidation.ValidationIssue) {
+	validationTracker := ubvalidation.NewValidationTracker()
+
+	validateRelationName(validationTracker, "objectType", t.ObjectType, true)
+	validateRelationId(validationTracker, "objectId", t.ObjectId)
+	validateRelationName(validationTracker, "relation", t.Relation, true)
+	validateRelationName(validationTracker, "subjectType", t.SubjectType, true)
+	validateRelationId(validationTracker, "subjectId", t.SubjectId)
+	validateRelationName(validationTracker, "subjectRelation", t.SubjectRelation, false)
+
+	return validationTracker.Valid()
+}
+
+func validateRelationName(validationTracker *ubvalidation.ValidationTracker, fieldName string, value string, required bool) {
+	validationTracker.ValidateSystemName(fieldName, &value, required)
+	validationTracker.ValidateMaxLength(fieldName, value, 64)
+}
+
+func validateRelationId(validationTracker *ubvalidation.ValidationTracker, fieldName string, value string) {
+	validationTracker.ValidateField(fieldName, value, true, 0)
+	validationTracker.ValidateMaxLength(fieldName, value, 255)
+	if strings.ContainsAny(value, "#@ \t\r\n") {
+		validationTracker.AddIssue(fieldName, fmt.Sprintf("%s cannot contain '#', '@' or whitespace", strings.ToLower(fieldName)))
+	}
+}
+
+// ============================================================================
+// Events
+// ============================================================================
+
+// evercore:event
+type RelationTupleWrittenEvent struct {
+	ObjectType      string `json:"objectType"`
+	ObjectId        string `json:"objectId"`
+	Relation        string `json:"relation"`
+	SubjectType     string `json:"subjectType"`
+	SubjectId       string `json:"subjectId"`
+	SubjectRelation string `json:"subjectRelation,omitempty"`
+}
+
+func (a RelationTupleWrittenEvent) GetEventType() string {
+	return events.RelationTupleWrittenEventType
+}
+
+func (a RelationTupleWrittenEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
+
+func (a RelationTupleWrittenEvent) grant() RelationGrant {
+	return RelationGrant{
+		Relation:        a.Relation,
+		SubjectType:     a.SubjectType,
+		SubjectId:       a.SubjectId,
+		SubjectRelation: a.SubjectRelation,
+	}
+}
+
+// evercore:event
+type RelationTupleDeletedEvent struct {
+	ObjectType      string `json:"objectType"`
+	ObjectId        string `json:"objectId"`
+	Relation        string `json:"relation"`
+	SubjectType     string `json:"subjectType"`
+	SubjectId       string `json:"subjectId"`
+	SubjectRelation string `json:"subjectRelation,omitempty"`
+}
+
+func (a RelationTupleDeletedEvent) GetEventType() string {
+	return events.RelationTupleDeletedEventType
+}
+
+func (a RelationTupleDeletedEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
+
+func (a RelationTupleDeletedEvent) grant() RelationGrant {
+	return RelationGrant{
+		Relation:        a.Relation,
+		SubjectType:     a.SubjectType,
+		SubjectId:       a.SubjectId,
+		SubjectRelation: a.SubjectRelation,
+	}
+}
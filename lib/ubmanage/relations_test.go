@@ -0,0 +1,236 @@
+package ubmanage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubdata"
+)
+
+var testRelationSchema = RelationSchema{
+	"document": {"editor": {"owner"}, "viewer": {"editor"}},
+}
+
+func TestRelationSchemaRewrites(t *testing.T) {
+	implying := testRelationSchema.implying("document", "viewer")
+	slices.Sort(implying)
+	if want := []string{"editor", "owner", "viewer"}; !slices.Equal(implying, want) {
+		t.Fatalf("expected %v to imply viewer, got %v", want, implying)
+	}
+	implied := testRelationSchema.implied("document", "owner")
+	slices.Sort(implied)
+	if want := []string{"editor", "owner", "viewer"}; !slices.Equal(implied, want) {
+		t.Fatalf("expected owner to imply %v, got %v", want, implied)
+	}
+	if got := testRelationSchema.implying("unknown", "viewer"); !slices.Equal(got, []string{"viewer"}) {
+		t.Fatalf("expected relations of unknown types to be held directly, got %v", got)
+	}
+
+	// Cycles in the schema terminate.
+	cyclic := RelationSchema{"doc": {"a": {"b"}, "b": {"a"}}}
+	if got := cyclic.implying("doc", "a"); len(got) != 2 {
+		t.Fatalf("expected two relations, got %v", got)
+	}
+}
+
+func TestRelationTupleWriteCommandValidate(t *testing.T) {
+	valid := RelationTupleWriteCommand{ObjectType: "document", ObjectId: "77", Relation: "editor", SubjectType: "user", SubjectId: "5"}
+	tests := []struct {
+		name string
+		edit func(*RelationTupleWriteCommand)
+		ok   bool
+	}{
+		{"valid", func(c *RelationTupleWriteCommand) {}, true},
+		{"valid userset", func(c *RelationTupleWriteCommand) {
+			c.SubjectType, c.SubjectId, c.SubjectRelation = "team", "eng", "member"
+		}, true},
+		{"missing object type", func(c *RelationTupleWriteCommand) { c.ObjectType = "" }, false},
+		{"invalid relation", func(c *RelationTupleWriteCommand) { c.Relation = "can-edit" }, false},
+		{"missing subject id", func(c *RelationTupleWriteCommand) { c.SubjectId = "" }, false},
+		{"object id with separator", func(c *RelationTupleWriteCommand) { c.ObjectId = "77#owner" }, false},
+		{"invalid subject relation", func(c *RelationTupleWriteCommand) { c.SubjectRelation = "1member" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := valid
+			tt.edit(&cmd)
+			ok, _ := cmd.Validate()
+			if ok != tt.ok {
+				t.Fatalf("expected ok=%v, got %v", tt.ok, ok)
+			}
+		})
+	}
+}
+
+func TestRelationsAggregateApply(t *testing.T) {
+	agg := RelationsAggregate{}
+	written := RelationTupleWrittenEvent{ObjectType: "document", ObjectId: "77", Relation: "owner", SubjectType: "user", SubjectId: "5"}
+	for range 2 {
+		if err := agg.ApplyEventState(written, time.Now(), "test"); err != nil {
+			t.Fatalf("apply written failed: %v", err)
+		}
+	}
+	if len(agg.State.Grants) != 1 || !agg.Holds(written.grant()) {
+		t.Fatalf("expected a single grant, got %+v", agg.State.Grants)
+	}
+	if agg.State.ObjectType != "document" || agg.State.ObjectId != "77" {
+		t.Fatalf("expected object to be recorded, got %+v", agg.State)
+	}
+
+	if err := agg.ApplyEventState(RelationTupleDeletedEvent(written), time.Now(), "test"); err != nil {
+		t.Fatalf("apply deleted failed: %v", err)
+	}
+	if len(agg.State.Grants) != 0 {
+		t.Fatalf("expected the grant to be removed, got %+v", agg.State.Grants)
+	}
+}
+
+func TestFormatRelationTuple(t *testing.T) {
+	tuple := ubdata.RelationTuple{ObjectType: "document", ObjectId: "77", Relation: "viewer", SubjectType: "team", SubjectId: "eng", SubjectRelation: "member"}
+	if got := FormatRelationTuple(tuple); got != "document:77#viewer@team:eng#member" {
+		t.Fatalf("unexpected format %q", got)
+	}
+}
+
+// putRelationTuples caches tuples by object and by subject, as if loaded
+// from the management service.
+func putRelationTuples(p *PrefectServiceImpl, tuples ...ubdata.RelationTuple) {
+	for _, t := range tuples {
+		key := objectTuplesKey(t.ObjectType, t.ObjectId)
+		existing, _ := p.relationCache.Get(key)
+		p.relationCache.Put(key, append(slices.Clone(existing), t))
+
+		key = subjectTuplesKey(t.SubjectType, t.SubjectId, t.SubjectRelation)
+		existing, _ = p.relationCache.Get(key)
+		p.relationCache.Put(key, append(slices.Clone(existing), t))
+	}
+}
+
+func TestPrefectCheckAndListObjects(t *testing.T) {
+	p := newTestPrefect()
+	p.relationSchema = testRelationSchema
+	p.started.Store(true)
+	p.subscribed.Store(true)
+	ctx := context.Background()
+
+	p.userCache.Put(5, &UserData{Id: 5, Roles: []int64{12}})
+	p.userCache.Put(6, &UserData{Id: 6})
+	p.userCache.Put(7, &UserData{Id: 7})
+	putRelationTuples(p,
+		ubdata.RelationTuple{ObjectType: "document", ObjectId: "77", Relation: "owner", SubjectType: "user", SubjectId: "5"},
+		ubdata.RelationTuple{ObjectType: "document", ObjectId: "78", Relation: "viewer", SubjectType: "role", SubjectId: "12", SubjectRelation: "member"},
+		ubdata.RelationTuple{ObjectType: "document", ObjectId: "79", Relation: "editor", SubjectType: "team", SubjectId: "eng", SubjectRelation: "member"},
+		ubdata.RelationTuple{ObjectType: "team", ObjectId: "eng", Relation: "member", SubjectType: "user", SubjectId: "6"},
+		// Usersets referring to each other must not loop.
+		ubdata.RelationTuple{ObjectType: "team", ObjectId: "a", Relation: "member", SubjectType: "team", SubjectId: "b", SubjectRelation: "member"},
+		ubdata.RelationTuple{ObjectType: "team", ObjectId: "b", Relation: "member", SubjectType: "team", SubjectId: "a", SubjectRelation: "member"},
+		ubdata.RelationTuple{ObjectType: "document", ObjectId: "80", Relation: "viewer", SubjectType: "team", SubjectId: "a", SubjectRelation: "member"},
+	)
+	for _, key := range []relationTuplesKey{
+		objectTuplesKey("document", "81"),
+		subjectTuplesKey("user", "7", ""),
+		subjectTuplesKey("document", "79", "viewer"),
+		subjectTuplesKey("document", "79", "editor"),
+		subjectTuplesKey("document", "77", "owner"),
+		subjectTuplesKey("document", "77", "editor"),
+		subjectTuplesKey("document", "77", "viewer"),
+		subjectTuplesKey("document", "78", "viewer"),
+		subjectTuplesKey("team", "eng", "member"),
+	} {
+		if _, found := p.relationCache.Get(key); !found {
+			p.relationCache.Put(key, nil)
+		}
+	}
+
+	checks := []struct {
+		name     string
+		userId   int64
+		objectId string
+		relation string
+		want     bool
+	}{
+		{"owner holds owner", 5, "77", "owner", true},
+		{"owner implies editor", 5, "77", "editor", true},
+		{"owner implies viewer", 5, "77", "viewer", true},
+		{"other users hold nothing", 6, "77", "viewer", false},
+		{"role member views", 5, "78", "viewer", true},
+		{"viewer does not imply editor", 5, "78", "editor", false},
+		{"team member edits", 6, "79", "editor", true},
+		{"team editor views", 6, "79", "viewer", true},
+		{"cyclic usersets", 7, "80", "viewer", false},
+		{"no tuples", 5, "81", "viewer", false},
+	}
+	for _, c := range checks {
+		if got, err := p.Check(ctx, c.userId, "document", c.objectId, c.relation); err != nil || got != c.want {
+			t.Fatalf("%s: expected %v, got %v %v", c.name, c.want, got, err)
+		}
+	}
+
+	objects, err := p.ListObjects(ctx, 5, "document", "viewer")
+	if err != nil {
+		t.Fatalf("ListObjects failed: %v", err)
+	}
+	if want := []string{"77", "78"}; !slices.Equal(objects, want) {
+		t.Fatalf("expected %v, got %v", want, objects)
+	}
+	if objects, _ := p.ListObjects(ctx, 6, "document", "editor"); !slices.Equal(objects, []string{"79"}) {
+		t.Fatalf("expected user 6 to edit document 79, got %v", objects)
+	}
+	if objects, _ := p.ListObjects(ctx, 7, "document", "viewer"); len(objects) != 0 {
+		t.Fatalf("expected no objects, got %v", objects)
+	}
+}
+
+func TestPrefectCheckRevisitsShorterPaths(t *testing.T) {
+	p := newTestPrefect()
+	p.relationSchema = testRelationSchema
+	p.started.Store(true)
+	p.subscribed.Store(true)
+	p.userCache.Put(9, &UserData{Id: 9})
+
+	// The first tuple of the document leads to team x through a chain deep
+	// enough that x's own usersets are past the depth limit there. The second
+	// reaches x directly and must still find the user.
+	member := func(objectId string, subjectId string) ubdata.RelationTuple {
+		return ubdata.RelationTuple{ObjectType: "team", ObjectId: objectId, Relation: "member", SubjectType: "team", SubjectId: subjectId, SubjectRelation: "member"}
+	}
+	tuples := []ubdata.RelationTuple{
+		{ObjectType: "document", ObjectId: "90", Relation: "viewer", SubjectType: "team", SubjectId: "c0", SubjectRelation: "member"},
+		{ObjectType: "document", ObjectId: "90", Relation: "viewer", SubjectType: "team", SubjectId: "x", SubjectRelation: "member"},
+	}
+	chain := MaxRelationDepth - 1
+	for i := range chain - 1 {
+		tuples = append(tuples, member(fmt.Sprintf("c%d", i), fmt.Sprintf("c%d", i+1)))
+	}
+	tuples = append(tuples,
+		member(fmt.Sprintf("c%d", chain-1), "x"),
+		member("x", "y"),
+		ubdata.RelationTuple{ObjectType: "team", ObjectId: "y", Relation: "member", SubjectType: "user", SubjectId: "9"},
+	)
+	putRelationTuples(p, tuples...)
+
+	if held, err := p.Check(context.Background(), 9, "document", "90", "viewer"); err != nil || !held {
+		t.Fatalf("expected the shorter path to grant viewer, got %v %v", held, err)
+	}
+}
+
+func TestPrefectRelationInvalidation(t *testing.T) {
+	p := newTestPrefect()
+	tuple := ubdata.RelationTuple{ObjectType: "document", ObjectId: "77", Relation: "owner", SubjectType: "user", SubjectId: "5"}
+	putRelationTuples(p, tuple)
+	p.relationCache.Put(objectTuplesKey("document", "78"), nil)
+
+	p.relationInvalidation(tuple)
+	if _, found := p.relationCache.Get(objectTuplesKey("document", "77")); found {
+		t.Fatal("expected the object's tuples to be invalidated")
+	}
+	if _, found := p.relationCache.Get(subjectTuplesKey("user", "5", "")); found {
+		t.Fatal("expected the subject's tuples to be invalidated")
+	}
+	if _, found := p.relationCache.Get(objectTuplesKey("document", "78")); !found {
+		t.Fatal("expected other objects to remain cached")
+	}
+}
@@ -0,0 +1,96 @@
+package ubmanage
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubstatus"
+)
+
+const (
+	DefaultRoleExpiryInterval = time.Minute
+
+	roleExpiryAgent = "system:role-expiry"
+)
+
+// RoleExpiryScheduler periodically removes expired role memberships. The
+// prefect service ignores memberships outside their window as soon as they
+// end, so the scheduler only needs to run often enough to keep the role
+// listings and event history current. Running it on several instances is
+// harmless, as removing a membership twice is a no-op in the read model.
+type RoleExpiryScheduler struct {
+	management ManagementService
+	interval   time.Duration
+
+	lifecycleLock sync.Mutex
+	cancel        context.CancelFunc
+	done          chan struct{}
+}
+
+func NewRoleExpiryScheduler(management ManagementService, interval time.Duration) *RoleExpiryScheduler {
+	if interval <= 0 {
+		interval = DefaultRoleExpiryInterval
+	}
+	return &RoleExpiryScheduler{
+		management: management,
+		interval:   interval,
+	}
+}
+
+func (s *RoleExpiryScheduler) Start() error {
+	s.lifecycleLock.Lock()
+	defer s.lifecycleLock.Unlock()
+
+	if s.cancel != nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go s.main(ctx, s.done)
+	return nil
+}
+
+func (s *RoleExpiryScheduler) Stop() error {
+	s.lifecycleLock.Lock()
+	defer s.lifecycleLock.Unlock()
+
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+		s.cancel = nil
+		s.done = nil
+	}
+	return nil
+}
+
+func (s *RoleExpiryScheduler) main(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.Run(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run removes the memberships which expired at or before now and returns how
+// many were removed.
+func (s *RoleExpiryScheduler) Run(ctx context.Context, now time.Time) int {
+	resp, err := s.management.UserRolesExpire(ctx, now, roleExpiryAgent)
+	if err != nil || resp.Status != ubstatus.Success {
+		slog.Error("Error expiring role memberships", "error", err, "status", resp.Status)
+		return 0
+	}
+	if resp.Data > 0 {
+		slog.Info("Expired role memberships", "count", resp.Data)
+	}
+	return resp.Data
+}
@@ -0,0 +1,98 @@
+package ubmanage
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestUserDataActiveRoles(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	user := &UserData{
+		Roles: []int64{1, 2, 3, 4},
+		RoleWindows: map[int64]RoleWindow{
+			2: {ExpiresAt: now.Unix() + 60},
+			3: {ExpiresAt: now.Unix()},
+			4: {NotBefore: now.Unix() + 30, ExpiresAt: now.Unix() + 90},
+		},
+	}
+	if roles := user.activeRoles(now); !slices.Equal(roles, []int64{1, 2}) {
+		t.Fatalf("expected roles [1 2], got %v", roles)
+	}
+	if roles := user.activeRoles(now.Add(45 * time.Second)); !slices.Equal(roles, []int64{1, 2, 4}) {
+		t.Fatalf("expected roles [1 2 4], got %v", roles)
+	}
+	if next := user.nextRoleChange(now); next != now.Unix()+30 {
+		t.Fatalf("expected next change at +30s, got %d", next-now.Unix())
+	}
+	if next := user.nextRoleChange(now.Add(time.Hour)); next != 0 {
+		t.Fatalf("expected no further changes, got %d", next)
+	}
+}
+
+func TestPrefectIgnoresInactiveMemberships(t *testing.T) {
+	p := newTestPrefect()
+	p.started.Store(true)
+	p.subscribed.Store(true)
+	ctx := context.Background()
+
+	now := time.Now().Unix()
+	p.userCache.Put(1, &UserData{
+		Id:    1,
+		Roles: []int64{10, 11, 12},
+		RoleWindows: map[int64]RoleWindow{
+			10: {ExpiresAt: now + 3600},
+			11: {ExpiresAt: now - 1},
+			12: {NotBefore: now + 3600},
+		},
+	})
+	p.groupCache.Put(10, &GroupPermissions{GroupId: 10, OrganizationId: 1, Permissions: []string{"tickets:read"}})
+	p.groupCache.Put(11, &GroupPermissions{GroupId: 11, OrganizationId: 1, Permissions: []string{"refunds:create"}})
+	p.groupCache.Put(12, &GroupPermissions{GroupId: 12, OrganizationId: 1, Permissions: []string{"reports:read"}})
+
+	permissions, err := p.UserPermissions(ctx, 1, 1)
+	if err != nil {
+		t.Fatalf("UserPermissions failed: %v", err)
+	}
+	if !slices.Equal(permissions, []string{"tickets:read"}) {
+		t.Fatalf("expected only the active membership's permissions, got %v", permissions)
+	}
+	if inRole, _ := p.UserBelongsToRole(ctx, 1, 11); inRole {
+		t.Fatal("expected the expired membership not to count")
+	}
+
+	set, found := p.permissionCache.Get(userOrganization{userId: 1, organizationId: 1})
+	if !found || set.validUntil != now+3600 {
+		t.Fatalf("expected the cached set to be valid until the next window change, got %+v", set)
+	}
+
+	// A cached set is not trusted past the next window change.
+	set.validUntil = now - 1
+	p.userCache.Put(1, &UserData{Id: 1, Roles: []int64{12}})
+	permissions, _ = p.UserPermissions(ctx, 1, 1)
+	if !slices.Equal(permissions, []string{"reports:read"}) {
+		t.Fatalf("expected the stale set to be rebuilt, got %v", permissions)
+	}
+
+	explanation, _ := p.ExplainPermissions(ctx, 1, 1, "")
+	if len(explanation.Grants) != 1 || explanation.Grants[0].ExpiresAt != 0 {
+		t.Fatalf("unexpected grants %+v", explanation.Grants)
+	}
+}
+
+func TestUserAddToRoleCommandWindow(t *testing.T) {
+	now := time.Now()
+	command := UserAddToRoleCommand{UserId: 1, RoleId: 2, NotBefore: now.Add(time.Hour), ExpiresAt: now.Add(2 * time.Hour)}
+	if ok, issues := command.Validate(); !ok {
+		t.Fatalf("expected valid window, got %v", issues)
+	}
+	command.ExpiresAt = now.Add(-time.Minute)
+	if ok, _ := command.Validate(); ok {
+		t.Fatal("expected an expiry in the past to be invalid")
+	}
+	command.ExpiresAt = now.Add(30 * time.Minute)
+	if ok, _ := command.Validate(); ok {
+		t.Fatal("expected a window starting after it expires to be invalid")
+	}
+}
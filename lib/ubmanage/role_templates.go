@@ -0,0 +1,207 @@
+package ubmanage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/kernelplex/ubase/lib/ubvalidation"
+)
+
+// Role templates describe the roles every organization starts with. They are
+// defined in code or loaded from a JSON file, instantiated when an
+// organization is created and pushed to existing organizations by a sync.
+
+// RoleTemplateOrgPlaceholder is replaced with the organization's system name
+// in a template's system name. Role system names are unique across
+// organizations, so every template system name must contain it.
+const RoleTemplateOrgPlaceholder = "{org}"
+
+// Role template change actions.
+const (
+	RoleTemplateCreate = "create"
+	RoleTemplateRename = "rename"
+	RoleTemplateGrant  = "grant"
+	RoleTemplateRevoke = "revoke"
+)
+
+// RoleTemplate is a role created in every organization.
+type RoleTemplate struct {
+	Name string `json:"name"`
+	// SystemName is the pattern of the role's system name, such as
+	// "{org}_admin".
+	SystemName  string   `json:"system_name"`
+	Permissions []string `json:"permissions"`
+}
+
+// SystemNameFor returns the system name of the template's role in the
+// organization.
+func (t RoleTemplate) SystemNameFor(organizationSystemName string) string {
+	return strings.ReplaceAll(t.SystemName, RoleTemplateOrgPlaceholder, organizationSystemName)
+}
+
+// Validate checks the template is complete.
+func (t RoleTemplate) Validate() error {
+	if strings.TrimSpace(t.Name) == "" {
+		return errors.New("role template name is required")
+	}
+	if !strings.Contains(t.SystemName, RoleTemplateOrgPlaceholder) {
+		return fmt.Errorf("role template %q system name must contain %s", t.Name, RoleTemplateOrgPlaceholder)
+	}
+	systemName := t.SystemNameFor("org")
+	validationTracker := ubvalidation.NewValidationTracker()
+	validationTracker.ValidateSystemName("systemName", &systemName, true)
+	if ok, _ := validationTracker.Valid(); !ok {
+		return fmt.Errorf("role template %q system name %q is not a valid system name", t.Name, t.SystemName)
+	}
+	for _, permission := range t.Permissions {
+		if strings.TrimSpace(permission) == "" {
+			return fmt.Errorf("role template %q has an empty permission", t.Name)
+		}
+	}
+	return nil
+}
+
+// ValidateRoleTemplates checks every template and that no two share a system
+// name.
+func ValidateRoleTemplates(templates []RoleTemplate) error {
+	seen := map[string]bool{}
+	for _, template := range templates {
+		if err := template.Validate(); err != nil {
+			return err
+		}
+		if seen[template.SystemName] {
+			return fmt.Errorf("duplicate role template system name %q", template.SystemName)
+		}
+		seen[template.SystemName] = true
+	}
+	return nil
+}
+
+// LoadRoleTemplates reads a JSON array of role templates from the file.
+func LoadRoleTemplates(path string) ([]RoleTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read role templates: %w", err)
+	}
+	var templates []RoleTemplate
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("failed to parse role templates: %w", err)
+	}
+	if err := ValidateRoleTemplates(templates); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// RoleTemplateChange is one change a sync makes to bring an organization's
+// role in line with its template. Value is the new name of a rename and the
+// permission of a grant or revoke. RoleId is zero for roles not yet created.
+type RoleTemplateChange struct {
+	OrganizationId         int64  `json:"organizationId"`
+	OrganizationSystemName string `json:"organizationSystemName"`
+	RoleId                 int64  `json:"roleId"`
+	RoleSystemName         string `json:"roleSystemName"`
+	Action                 string `json:"action"`
+	Value                  string `json:"value"`
+}
+
+// String formats the change as a diff line.
+func (c RoleTemplateChange) String() string {
+	switch c.Action {
+	case RoleTemplateCreate:
+		return fmt.Sprintf("+ %s/%s (%s)", c.OrganizationSystemName, c.RoleSystemName, c.Value)
+	case RoleTemplateRename:
+		return fmt.Sprintf("~ %s/%s name -> %s", c.OrganizationSystemName, c.RoleSystemName, c.Value)
+	case RoleTemplateGrant:
+		return fmt.Sprintf("+ %s/%s %s", c.OrganizationSystemName, c.RoleSystemName, c.Value)
+	case RoleTemplateRevoke:
+		return fmt.Sprintf("- %s/%s %s", c.OrganizationSystemName, c.RoleSystemName, c.Value)
+	}
+	return fmt.Sprintf("? %s/%s %s %s", c.OrganizationSystemName, c.RoleSystemName, c.Action, c.Value)
+}
+
+// roleTemplateDiff lists the changes that bring the organization's roles in
+// line with the templates. Roles are keyed by system name. Deleted roles are
+// left alone, and permissions the template does not list are only revoked
+// when pruning.
+func roleTemplateDiff(templates []RoleTemplate,
+	organizationId int64,
+	organizationSystemName string,
+	roles map[string]*RoleAggregate,
+	prune bool) []RoleTemplateChange {
+
+	changes := []RoleTemplateChange{}
+	for _, template := range templates {
+		systemName := template.SystemNameFor(organizationSystemName)
+		change := RoleTemplateChange{
+			OrganizationId:         organizationId,
+			OrganizationSystemName: organizationSystemName,
+			RoleSystemName:         systemName,
+		}
+		role, found := roles[systemName]
+		var held []string
+		switch {
+		case !found:
+			change.Action = RoleTemplateCreate
+			change.Value = template.Name
+			changes = append(changes, change)
+		case role.State.Deleted:
+			continue
+		default:
+			change.RoleId = role.Id
+			held = slices.Clone(role.State.Permissions)
+			if role.State.Name != template.Name {
+				change.Action = RoleTemplateRename
+				change.Value = template.Name
+				changes = append(changes, change)
+			}
+		}
+
+		for _, permission := range template.Permissions {
+			if slices.Contains(held, permission) {
+				continue
+			}
+			held = append(held, permission)
+			change.Action = RoleTemplateGrant
+			change.Value = permission
+			changes = append(changes, change)
+		}
+		if !prune || !found {
+			continue
+		}
+		for _, permission := range role.State.Permissions {
+			if !slices.Contains(template.Permissions, permission) {
+				change.Action = RoleTemplateRevoke
+				change.Value = permission
+				changes = append(changes, change)
+			}
+		}
+	}
+	return changes
+}
+
+// RoleTemplatesSyncCommand pushes the role templates to existing
+// organizations.
+type RoleTemplatesSyncCommand struct {
+	// OrganizationIds limits the sync to these organizations. All
+	// organizations are synced when it is empty.
+	OrganizationIds []int64 `json:"organizationIds"`
+	// Prune revokes permissions the templates do not list.
+	Prune bool `json:"prune"`
+	// DryRun returns the changes without making them.
+	DryRun bool `json:"dryRun"`
+}
+
+func (c RoleTemplatesSyncCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	validationTracker := ubvalidation.NewValidationTracker()
+
+	for _, id := range c.OrganizationIds {
+		validationTracker.ValidateIntMinValue("organizationIds", id, 1)
+	}
+
+	return validationTracker.Valid()
+}
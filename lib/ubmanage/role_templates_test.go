@@ -0,0 +1,111 @@
+package ubmanage
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRoleTemplateValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template RoleTemplate
+		valid    bool
+	}{
+		{name: "valid", template: RoleTemplate{Name: "Admin", SystemName: "{org}_admin", Permissions: []string{"users.manage"}}, valid: true},
+		{name: "missing name", template: RoleTemplate{SystemName: "{org}_admin"}},
+		{name: "missing placeholder", template: RoleTemplate{Name: "Admin", SystemName: "admin"}},
+		{name: "invalid system name", template: RoleTemplate{Name: "Admin", SystemName: "{org} admin"}},
+		{name: "empty permission", template: RoleTemplate{Name: "Admin", SystemName: "{org}_admin", Permissions: []string{" "}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.template.Validate(); (err == nil) != tt.valid {
+				t.Fatalf("Validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+
+	duplicate := []RoleTemplate{
+		{Name: "Admin", SystemName: "{org}_admin"},
+		{Name: "Administrator", SystemName: "{org}_admin"},
+	}
+	if err := ValidateRoleTemplates(duplicate); err == nil {
+		t.Fatal("expected duplicate system names to be rejected")
+	}
+}
+
+func TestLoadRoleTemplates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "roles.json")
+	data := `[{"name": "Admin", "system_name": "{org}_admin", "permissions": ["users.manage", "roles.manage"]}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	templates, err := LoadRoleTemplates(path)
+	if err != nil {
+		t.Fatalf("LoadRoleTemplates failed: %v", err)
+	}
+	if len(templates) != 1 || templates[0].SystemNameFor("acme") != "acme_admin" || len(templates[0].Permissions) != 2 {
+		t.Fatalf("unexpected templates %+v", templates)
+	}
+
+	if err := os.WriteFile(path, []byte(`[{"name": "Admin", "system_name": "admin"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRoleTemplates(path); err == nil {
+		t.Fatal("expected an invalid template to be rejected")
+	}
+}
+
+func TestRoleTemplateDiff(t *testing.T) {
+	templates := []RoleTemplate{
+		{Name: "Admin", SystemName: "{org}_admin", Permissions: []string{"users.manage", "roles.manage"}},
+		{Name: "Viewer", SystemName: "{org}_viewer", Permissions: []string{"reports.view"}},
+		{Name: "Auditor", SystemName: "{org}_auditor", Permissions: []string{"audit.view"}},
+	}
+	role := func(id int64, name string, deleted bool, permissions ...string) *RoleAggregate {
+		aggregate := &RoleAggregate{}
+		aggregate.Id = id
+		aggregate.State = RoleState{Name: name, OrganizationId: 7, Deleted: deleted, Permissions: permissions}
+		return aggregate
+	}
+	roles := map[string]*RoleAggregate{
+		"acme_admin":   role(1, "Administrator", false, "users.manage", "billing.manage"),
+		"acme_auditor": role(3, "Auditor", true),
+	}
+
+	format := func(changes []RoleTemplateChange) []string {
+		lines := []string{}
+		for _, change := range changes {
+			lines = append(lines, change.String())
+		}
+		return lines
+	}
+
+	got := format(roleTemplateDiff(templates, 7, "acme", roles, false))
+	want := []string{
+		"~ acme/acme_admin name -> Admin",
+		"+ acme/acme_admin roles.manage",
+		"+ acme/acme_viewer (Viewer)",
+		"+ acme/acme_viewer reports.view",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("diff = %q, want %q", got, want)
+	}
+
+	got = format(roleTemplateDiff(templates, 7, "acme", roles, true))
+	want = slices.Insert(want, 2, "- acme/acme_admin billing.manage")
+	if !slices.Equal(got, want) {
+		t.Fatalf("pruned diff = %q, want %q", got, want)
+	}
+	if !slices.Equal(roles["acme_admin"].State.Permissions, []string{"users.manage", "billing.manage"}) {
+		t.Fatalf("diff modified the role's permissions: %v", roles["acme_admin"].State.Permissions)
+	}
+
+	// A new organization gets every template.
+	changes := roleTemplateDiff(templates, 8, "new", map[string]*RoleAggregate{}, false)
+	if len(changes) != 7 || changes[0].Action != RoleTemplateCreate || changes[0].OrganizationId != 8 || changes[0].RoleSystemName != "new_admin" {
+		t.Fatalf("unexpected changes for a new organization %+v", changes)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	evercore "github.com/kernelplex/evercore/base"
+	"github.com/kernelplex/ubase/lib/ubpolicy"
 	"github.com/kernelplex/ubase/lib/ubvalidation"
 )
 
@@ -32,6 +33,7 @@ func (t *RoleAggregate) ApplyEventState(eventState evercore.EventState, eventTim
 		if t.State.Permissions == nil {
 			return nil
 		}
+		delete(t.State.Policies, ev.Permission)
 		for i, p := range t.State.Permissions {
 			if p == ev.Permission {
 				t.State.Permissions = append(t.State.Permissions[:i], t.State.Permissions[i+1:]...)
@@ -39,6 +41,17 @@ func (t *RoleAggregate) ApplyEventState(eventState evercore.EventState, eventTim
 			}
 		}
 		return nil
+
+	case RolePermissionPolicySetEvent:
+		if ev.Policy == "" {
+			delete(t.State.Policies, ev.Permission)
+			return nil
+		}
+		if t.State.Policies == nil {
+			t.State.Policies = make(map[string]string)
+		}
+		t.State.Policies[ev.Permission] = ev.Policy
+		return nil
 	default:
 		return t.StateAggregate.ApplyEventState(eventState, eventTime, reference)
 	}
@@ -51,6 +64,9 @@ type RoleState struct {
 	SystemName     string `json:"systemName"`
 	Deleted        bool   `json:"deleted"`
 	Permissions    []string
+	// Policies holds the policy each conditional permission is granted
+	// under, by permission.
+	Policies map[string]string `json:"policies,omitempty"`
 }
 
 // ============================================================================
@@ -125,6 +141,54 @@ func (c RolePermissionRemoveCommand) Validate() (bool, []ubvalidation.Validation
 	return validationTracker.Valid()
 }
 
+// RolePermissionPolicySetCommand grants a permission of the role only when
+// the policy allows the request. An empty policy grants it unconditionally.
+type RolePermissionPolicySetCommand struct {
+	Id         int64  `json:"id"`
+	Permission string `json:"permission"`
+	Policy     string `json:"policy"`
+}
+
+func (c RolePermissionPolicySetCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	validationTracker := ubvalidation.NewValidationTracker()
+
+	validationTracker.ValidateIntMinValue("id", c.Id, 1)
+	validationTracker.ValidateField("permission", c.Permission, true, 1)
+	if c.Policy != "" {
+		if _, err := ubpolicy.Compile(c.Policy); err != nil {
+			validationTracker.AddIssue("policy", err.Error())
+		}
+	}
+
+	return validationTracker.Valid()
+}
+
+// RolePermissionChange grants or revokes a permission of a role.
+type RolePermissionChange struct {
+	RoleId     int64  `json:"role_id"`
+	Permission string `json:"permission"`
+	Grant      bool   `json:"grant"`
+}
+
+// RolePermissionsApplyCommand changes the permissions of several roles of an
+// organization at once.
+type RolePermissionsApplyCommand struct {
+	OrganizationId int64                  `json:"organization_id"`
+	Changes        []RolePermissionChange `json:"changes"`
+}
+
+func (c RolePermissionsApplyCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	validationTracker := ubvalidation.NewValidationTracker()
+
+	validationTracker.ValidateIntMinValue("organization_id", c.OrganizationId, 1)
+	for _, change := range c.Changes {
+		validationTracker.ValidateIntMinValue("role_id", change.RoleId, 1)
+		validationTracker.ValidateField("permission", change.Permission, true, 1)
+	}
+
+	return validationTracker.Valid()
+}
+
 // ============================================================================
 // Events
 // ============================================================================
@@ -193,3 +257,17 @@ func (a RolePermissionRemovedEvent) GetEventType() string {
 func (a RolePermissionRemovedEvent) Serialize() string {
 	return evercore.SerializeToJson(a)
 }
+
+// evercore:event
+type RolePermissionPolicySetEvent struct {
+	Permission string `json:"permission"`
+	Policy     string `json:"policy,omitempty"`
+}
+
+func (a RolePermissionPolicySetEvent) GetEventType() string {
+	return "RolePermissionPolicySetEvent"
+}
+
+func (a RolePermissionPolicySetEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
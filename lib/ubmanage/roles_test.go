@@ -81,3 +81,37 @@ func TestRoleCommandValidation(t *testing.T) {
     if ok, _ := rem.Validate(); ok { t.Fatal("expected invalid remove permission (id)") }
 }
 
+
+func TestRoleAggregatePermissionPolicies(t *testing.T) {
+    agg := &RoleAggregate{}
+    _ = agg.ApplyEventState(RolePermissionAddedEvent{Permission: "refunds:create"}, time.Now(), "tester")
+
+    if err := agg.ApplyEventState(RolePermissionPolicySetEvent{Permission: "refunds:create", Policy: "time.hour < 17"}, time.Now(), "tester"); err != nil {
+        t.Fatalf("set policy: %v", err)
+    }
+    if agg.State.Policies["refunds:create"] != "time.hour < 17" {
+        t.Fatalf("expected policy to be set, got %+v", agg.State.Policies)
+    }
+
+    // An empty policy makes the permission unconditional again.
+    _ = agg.ApplyEventState(RolePermissionPolicySetEvent{Permission: "refunds:create"}, time.Now(), "tester")
+    if _, found := agg.State.Policies["refunds:create"]; found {
+        t.Fatalf("expected policy to be cleared, got %+v", agg.State.Policies)
+    }
+
+    // Removing the permission removes its policy.
+    _ = agg.ApplyEventState(RolePermissionPolicySetEvent{Permission: "refunds:create", Policy: "true"}, time.Now(), "tester")
+    _ = agg.ApplyEventState(RolePermissionRemovedEvent{Permission: "refunds:create"}, time.Now(), "tester")
+    if len(agg.State.Policies) != 0 {
+        t.Fatalf("expected policies empty, got %+v", agg.State.Policies)
+    }
+
+    cmd := RolePermissionPolicySetCommand{Id: 1, Permission: "refunds:create", Policy: "time.hour <"}
+    if ok, issues := cmd.Validate(); ok || len(issues) != 1 || issues[0].Field != "policy" {
+        t.Fatalf("expected invalid policy to be rejected, got %v %+v", ok, issues)
+    }
+    cmd.Policy = ""
+    if ok, _ := cmd.Validate(); !ok {
+        t.Fatal("expected an empty policy to be valid")
+    }
+}
@@ -0,0 +1,242 @@
+package ubmanage
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	evercore "github.com/kernelplex/evercore/base"
+	"github.com/kernelplex/ubase/lib/ubsecurity"
+)
+
+// Personal data in user events is sealed with a per-user data key. The data
+// key is wrapped by the master encryption service and kept in the
+// user_data_keys table rather than the event store, whose events are never
+// deleted. Erasing a user deletes the row, after which no sealed value in
+// their event history can be opened, even with the master key.
+//
+// Users added before per-user keys existed have plaintext values in their
+// earliest events. Those values are passed through as-is when read, and a data
+// key is generated the next time the user is written. Erasure blanks their
+// projections but cannot remove the plaintext from the event store, so such
+// users are marked with UserState.PlaintextHistory and their erasure is
+// logged.
+
+const userDataKeyLength = 32
+const sealedPIIPrefix = "pii:v1:"
+
+var (
+	errUserErased = errors.New("user has been erased")
+)
+
+// userPII holds the decrypted personal fields of a user.
+type userPII struct {
+	Email       string
+	FirstName   string
+	LastName    string
+	DisplayName string
+}
+
+func isSealedPII(value string) bool {
+	return strings.HasPrefix(value, sealedPIIPrefix)
+}
+
+func sealPII(key []byte, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	encrypted, err := ubsecurity.Encrypt64(key, []byte(value))
+	if err != nil {
+		return "", fmt.Errorf("failed to seal value: %w", err)
+	}
+	return sealedPIIPrefix + encrypted, nil
+}
+
+func sealOptionalPII(key []byte, value *string) (*string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	sealed, err := sealPII(key, *value)
+	if err != nil {
+		return nil, err
+	}
+	return &sealed, nil
+}
+
+// openPII reverses sealPII. Plaintext values are returned unchanged. Sealed
+// values without a key (the key has been destroyed) open as empty strings.
+func openPII(key []byte, value string) (string, error) {
+	if !isSealedPII(value) {
+		return value, nil
+	}
+	if key == nil {
+		return "", nil
+	}
+	decrypted, err := ubsecurity.Decrypt64(key, strings.TrimPrefix(value, sealedPIIPrefix))
+	if err != nil {
+		return "", fmt.Errorf("failed to open sealed value: %w", err)
+	}
+	return string(decrypted), nil
+}
+
+// generateUserDataKey creates a new data key and returns it along with its
+// wrapped form for storage in the user_data_keys table.
+func (m *ManagementImpl) generateUserDataKey() ([]byte, string, error) {
+	key := ubsecurity.GenerateSecureRandom(userDataKeyLength)
+	wrapped, err := m.encryptionService.Encrypt64(base64.StdEncoding.EncodeToString(key))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to wrap user data key: %w", err)
+	}
+	return key, wrapped, nil
+}
+
+// unwrapUserDataKey reverses the wrapping of generateUserDataKey.
+func (m *ManagementImpl) unwrapUserDataKey(wrapped string) ([]byte, error) {
+	encoded, err := m.encryptionService.Decrypt64(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap user data key: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(string(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode user data key: %w", err)
+	}
+	return key, nil
+}
+
+// userDataKey returns the user's data key, or nil if the user does not have
+// one or has been erased.
+func (m *ManagementImpl) userDataKey(ctx context.Context, userId int64) ([]byte, error) {
+	wrapped, found, err := m.dbadapter.GetUserDataKey(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+	return m.unwrapUserDataKey(wrapped)
+}
+
+// ensureUserDataKey returns the user's data key, generating one if the user
+// predates per-user keys or is being added.
+func (m *ManagementImpl) ensureUserDataKey(ctx context.Context, aggregate *UserAggregate) ([]byte, error) {
+	if aggregate.State.Erased {
+		return nil, errUserErased
+	}
+
+	key, err := m.userDataKey(ctx, aggregate.Id)
+	if err != nil || key != nil {
+		return key, err
+	}
+
+	_, wrapped, err := m.generateUserDataKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.dbadapter.UserDataKeyAdd(ctx, aggregate.Id, wrapped); err != nil {
+		return nil, err
+	}
+	// A concurrent write may have stored its key first, in which case that
+	// key is kept and used here too.
+	key, err = m.userDataKey(ctx, aggregate.Id)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, fmt.Errorf("user data key for user %d was not stored", aggregate.Id)
+	}
+	return key, nil
+}
+
+// userPII opens the personal fields of the user without modifying their
+// state. The aggregate state must stay sealed while it is attached to a write
+// context, otherwise a snapshot could persist the plaintext.
+func (m *ManagementImpl) userPII(ctx context.Context, aggregate *UserAggregate) (userPII, error) {
+	key, err := m.userDataKey(ctx, aggregate.Id)
+	if err != nil {
+		return userPII{}, err
+	}
+	state := &aggregate.State
+
+	pii := userPII{}
+	fields := []struct {
+		sealed string
+		target *string
+	}{
+		{state.Email, &pii.Email},
+		{state.FirstName, &pii.FirstName},
+		{state.LastName, &pii.LastName},
+		{state.DisplayName, &pii.DisplayName},
+	}
+	for _, f := range fields {
+		value, err := openPII(key, f.sealed)
+		if err != nil {
+			return userPII{}, err
+		}
+		*f.target = value
+	}
+	return pii, nil
+}
+
+// openUserState replaces the sealed personal fields of a detached aggregate
+// with their plaintext values.
+func (m *ManagementImpl) openUserState(ctx context.Context, aggregate *UserAggregate) error {
+	pii, err := m.userPII(ctx, aggregate)
+	if err != nil {
+		return err
+	}
+	state := &aggregate.State
+	state.Email = pii.Email
+	state.FirstName = pii.FirstName
+	state.LastName = pii.LastName
+	state.DisplayName = pii.DisplayName
+	return nil
+}
+
+// loadActiveUserInto loads a user that is about to be modified. Erased users
+// are tombstones and refuse further changes.
+func loadActiveUserInto(etx evercore.EventStoreReadonlyContext, aggregate *UserAggregate, id int64) error {
+	if err := etx.LoadStateInto(aggregate, id); err != nil {
+		return err
+	}
+	if aggregate.State.Erased {
+		return errUserErased
+	}
+	return nil
+}
+
+func sealUserAddedEvent(key []byte, event UserAddedEvent) (UserAddedEvent, error) {
+	var err error
+	fields := []*string{&event.Email, &event.FirstName, &event.LastName, &event.DisplayName}
+	for _, f := range fields {
+		if *f, err = sealPII(key, *f); err != nil {
+			return UserAddedEvent{}, err
+		}
+	}
+	return event, nil
+}
+
+func sealUserUpdatedEvent(key []byte, event UserUpdatedEvent) (UserUpdatedEvent, error) {
+	var err error
+	fields := []**string{&event.Email, &event.FirstName, &event.LastName, &event.DisplayName}
+	for _, f := range fields {
+		if *f, err = sealOptionalPII(key, *f); err != nil {
+			return UserUpdatedEvent{}, err
+		}
+	}
+	return event, nil
+}
+
+// sealLoginClient seals the client details recorded on login events. IP
+// addresses and user agents identify a person as much as their email does.
+func sealLoginClient(key []byte, client LoginClient) (LoginClient, error) {
+	var err error
+	fields := []*string{&client.IpAddress, &client.UserAgent, &client.DeviceId}
+	for _, f := range fields {
+		if *f, err = sealPII(key, *f); err != nil {
+			return LoginClient{}, err
+		}
+	}
+	return client, nil
+}
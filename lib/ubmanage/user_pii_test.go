@@ -0,0 +1,146 @@
+package ubmanage
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kernelplex/ubase/lib/ubsecurity"
+)
+
+// dataKeyDB keeps user data keys in memory.
+type dataKeyDB struct {
+	fakeDB
+	keys map[int64]string
+}
+
+func (d *dataKeyDB) GetUserDataKey(ctx context.Context, userID int64) (string, bool, error) {
+	wrapped, found := d.keys[userID]
+	return wrapped, found, nil
+}
+
+func (d *dataKeyDB) UserDataKeyAdd(ctx context.Context, userID int64, wrappedKey string) error {
+	if _, found := d.keys[userID]; !found {
+		d.keys[userID] = wrappedKey
+	}
+	return nil
+}
+
+func (d *dataKeyDB) UserDataKeyDelete(ctx context.Context, userID int64) error {
+	delete(d.keys, userID)
+	return nil
+}
+
+func newPIITestManagement() *ManagementImpl {
+	return &ManagementImpl{
+		dbadapter:         &dataKeyDB{keys: map[int64]string{}},
+		encryptionService: ubsecurity.NewEncryptionService([]byte("0123456789abcdef0123456789abcdef")),
+	}
+}
+
+func TestSealAndOpenPII(t *testing.T) {
+	key := ubsecurity.GenerateSecureRandom(userDataKeyLength)
+
+	sealed, err := sealPII(key, "user@example.com")
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if !strings.HasPrefix(sealed, sealedPIIPrefix) || strings.Contains(sealed, "user@example.com") {
+		t.Fatalf("expected sealed value, got %q", sealed)
+	}
+
+	opened, err := openPII(key, sealed)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if opened != "user@example.com" {
+		t.Fatalf("expected round trip, got %q", opened)
+	}
+
+	// Legacy plaintext passes through.
+	if v, _ := openPII(key, "legacy@example.com"); v != "legacy@example.com" {
+		t.Fatalf("expected plaintext passthrough, got %q", v)
+	}
+
+	// A destroyed key leaves nothing readable.
+	if v, err := openPII(nil, sealed); err != nil || v != "" {
+		t.Fatalf("expected empty value without key, got %q (%v)", v, err)
+	}
+
+	// The wrong key is an error rather than garbage.
+	if _, err := openPII(ubsecurity.GenerateSecureRandom(userDataKeyLength), sealed); err == nil {
+		t.Fatal("expected error opening with the wrong key")
+	}
+}
+
+func TestUserPIIUsesStoredDataKey(t *testing.T) {
+	ctx := context.Background()
+	m := newPIITestManagement()
+	aggregate := &UserAggregate{}
+	aggregate.Id = 42
+
+	key, err := m.ensureUserDataKey(ctx, aggregate)
+	if err != nil {
+		t.Fatalf("ensure data key: %v", err)
+	}
+	if again, err := m.ensureUserDataKey(ctx, aggregate); err != nil || string(again) != string(key) {
+		t.Fatalf("expected the stored key to be reused, got %v", err)
+	}
+
+	added, err := sealUserAddedEvent(key, UserAddedEvent{
+		Email:       "user@example.com",
+		FirstName:   "First",
+		LastName:    "Last",
+		DisplayName: "First Last",
+	})
+	if err != nil {
+		t.Fatalf("seal event: %v", err)
+	}
+
+	aggregate.State = UserState{
+		Email:       added.Email,
+		FirstName:   added.FirstName,
+		LastName:    added.LastName,
+		DisplayName: added.DisplayName,
+	}
+	pii, err := m.userPII(ctx, aggregate)
+	if err != nil {
+		t.Fatalf("open pii: %v", err)
+	}
+	if pii.Email != "user@example.com" || pii.FirstName != "First" || pii.LastName != "Last" || pii.DisplayName != "First Last" {
+		t.Fatalf("unexpected pii: %+v", pii)
+	}
+	if !isSealedPII(aggregate.State.Email) {
+		t.Fatal("expected userPII to leave the state sealed")
+	}
+
+	// Once the stored key is deleted, as erasure does, the sealed history is
+	// unreadable.
+	if err := m.dbadapter.UserDataKeyDelete(ctx, aggregate.Id); err != nil {
+		t.Fatalf("delete data key: %v", err)
+	}
+	if err := m.openUserState(ctx, aggregate); err != nil {
+		t.Fatalf("open state: %v", err)
+	}
+	if aggregate.State.Email != "" || aggregate.State.DisplayName != "" {
+		t.Fatalf("expected unreadable state, got %+v", aggregate.State)
+	}
+}
+
+func TestSealLoginClient(t *testing.T) {
+	key := ubsecurity.GenerateSecureRandom(userDataKeyLength)
+	client := LoginClient{IpAddress: "203.0.113.7", UserAgent: "agent", DeviceId: "device"}
+
+	sealed, err := sealLoginClient(key, client)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	for _, v := range []string{sealed.IpAddress, sealed.UserAgent, sealed.DeviceId} {
+		if !isSealedPII(v) {
+			t.Fatalf("expected sealed value, got %q", v)
+		}
+	}
+	if ip, _ := openPII(key, sealed.IpAddress); ip != client.IpAddress {
+		t.Fatalf("expected ip round trip, got %q", ip)
+	}
+}
@@ -64,9 +64,15 @@ func (t *UserRolesAggregate) ApplySnapshot(snapshot *evercore.Snapshot) error {
 // Commands
 // ============================================================================
 
+// UserAddToRoleCommand adds a user to a role. Adding a user to a role they
+// already hold replaces the membership's validity window.
 type UserAddToRoleCommand struct {
 	UserId int64 `json:"userId"`
 	RoleId int64 `json:"roleId"`
+	// NotBefore and ExpiresAt optionally bound when the membership counts.
+	// Expired memberships are removed by the RoleExpiryScheduler.
+	NotBefore time.Time `json:"notBefore,omitzero"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
 }
 
 func (c UserAddToRoleCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
@@ -74,10 +80,24 @@ func (c UserAddToRoleCommand) Validate() (bool, []ubvalidation.ValidationIssue)
 
 	validationTracker.ValidateIntMinValue("userId", c.UserId, 1)
 	validationTracker.ValidateIntMinValue("roleId", c.RoleId, 1)
+	if !c.ExpiresAt.IsZero() {
+		validationTracker.ValidateTimeInFuture("expiresAt", c.ExpiresAt)
+		if !c.NotBefore.IsZero() && !c.NotBefore.Before(c.ExpiresAt) {
+			validationTracker.AddIssue("notBefore", "Membership must start before it expires")
+		}
+	}
 
 	return validationTracker.Valid()
 }
 
+// unixOrZero returns the unix time of t, or zero when t is the zero time.
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
 type UserRemoveFromRoleCommand struct {
 	UserId int64 `json:"userId"`
 	RoleId int64 `json:"roleId"`
@@ -100,6 +120,12 @@ func (c UserRemoveFromRoleCommand) Validate() (bool, []ubvalidation.ValidationIs
 type UserAddedToRoleEvent struct {
 	UserId int64 `json:"userId"`
 	RoleId int64 `json:"roleId"`
+	// NotBefore and ExpiresAt are unix seconds, zero for unbounded.
+	NotBefore int64 `json:"notBefore,omitempty"`
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+	// AccessRequestId is the access request whose approval granted the
+	// membership, or zero when it was granted directly.
+	AccessRequestId int64 `json:"accessRequestId,omitempty"`
 }
 
 func (a UserAddedToRoleEvent) GetEventType() string {
@@ -114,6 +140,8 @@ func (a UserAddedToRoleEvent) Serialize() string {
 type UserRemovedFromRoleEvent struct {
 	UserId int64 `json:"userId"`
 	RoleId int64 `json:"roleId"`
+	// Expired is set when the membership was removed because it expired.
+	Expired bool `json:"expired,omitempty"`
 }
 
 func (a UserRemovedFromRoleEvent) GetEventType() string {
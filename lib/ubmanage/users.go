@@ -14,8 +14,28 @@ type ApiKey struct {
 	SecretHash     string `json:"secretHash,omitempty"`
 	Name           string `json:"name,omitempty"`
 	ExpiresAt      int64  `json:"expiresAt,omitempty"`
+	// Scopes limit the key to a subset of its owner's permissions. Empty
+	// means the key carries all of them.
+	Scopes []string `json:"scopes,omitempty"`
+	// AllowedCidrs restrict the addresses the key may be used from. Empty
+	// means any address.
+	AllowedCidrs []string `json:"allowedCidrs,omitempty"`
+	// ReplacedBy is the id of the key issued when this one was rotated.
+	ReplacedBy string `json:"replacedBy,omitempty"`
 }
 
+// KnownDevice is a device the user has successfully logged in from. The
+// fingerprint is keyed with the user's data key so it cannot be linked to the
+// device cookie once the user is erased.
+type KnownDevice struct {
+	Fingerprint string `json:"fingerprint"`
+	FirstSeenAt int64  `json:"firstSeenAt,omitempty"`
+}
+
+// maxKnownDevices bounds the devices remembered per user; the oldest are
+// forgotten first.
+const maxKnownDevices = 20
+
 type UserState struct {
 	Email                     string            `json:"email"`
 	PasswordHash              string            `json:"passwordHash"`
@@ -38,6 +58,25 @@ type UserState struct {
 	EmailLoginCode            *string           `json:"emailLoginCode,omitempty"`
 	EmailLoginCodeGeneratedAt int64             `json:"emailLoginCodeGeneratedAt,omitempty"`
 	EmailLoginCodeExpiresAt   int64             `json:"emailLoginCodeExpiresAt,omitempty"`
+	EmailLoginLinkHash        string            `json:"emailLoginLinkHash,omitempty"`
+	// EmailLoginCodeFailures counts incorrect guesses of the pending code.
+	EmailLoginCodeFailures int64 `json:"emailLoginCodeFailures,omitempty"`
+	// PlaintextHistory marks users added before personal data was sealed.
+	// Their earliest events hold plaintext that erasure cannot destroy.
+	PlaintextHistory  bool          `json:"plaintextHistory,omitempty"`
+	Erased            bool          `json:"erased,omitempty"`
+	ErasedAt          int64         `json:"erasedAt,omitempty"`
+	KnownDevices      []KnownDevice `json:"knownDevices,omitempty"`
+	SessionsRevokedAt int64         `json:"sessionsRevokedAt,omitempty"`
+	// VerificationTokenExpiresAt is zero for tokens issued before tokens
+	// expired; those expire one TTL after VerificationTokenGeneratedAt.
+	VerificationTokenGeneratedAt int64 `json:"verificationTokenGeneratedAt,omitempty"`
+	VerificationTokenExpiresAt   int64 `json:"verificationTokenExpiresAt,omitempty"`
+	// Service accounts have no email, password or login; they hold API keys
+	// and roles for the organization that owns them.
+	ServiceAccount      bool   `json:"serviceAccount,omitempty"`
+	OwnerOrganizationId int64  `json:"ownerOrganizationId,omitempty"`
+	Description         string `json:"description,omitempty"`
 }
 
 // evercore:aggregate
@@ -80,11 +119,15 @@ func (t *UserAggregate) ApplyEventState(eventState evercore.EventState, eventTim
 		return nil
 	case UserVerificationTokenGeneratedEvent:
 		t.State.VerificationToken = &ev.Token
+		t.State.VerificationTokenGeneratedAt = eventTime.Unix()
+		t.State.VerificationTokenExpiresAt = ev.ExpiresAt
 		t.State.Verified = false
 		return nil
 	case UserVerificationTokenVerifiedEvent:
 		t.State.Verified = true
 		t.State.VerificationToken = nil
+		t.State.VerificationTokenGeneratedAt = 0
+		t.State.VerificationTokenExpiresAt = 0
 		return nil
 	case UserTwoFactorEnabledEvent:
 		t.State.TwoFactorSharedSecret = &ev.SharedSecret
@@ -107,8 +150,25 @@ func (t *UserAggregate) ApplyEventState(eventState evercore.EventState, eventTim
 			SecretHash:     ev.SecretHash,
 			Name:           ev.Name,
 			ExpiresAt:      ev.ExpiresAt,
+			Scopes:         ev.Scopes,
+			AllowedCidrs:   ev.AllowedCidrs,
 		})
 		return nil
+	case UserApiKeyRotatedEvent:
+		for i := range t.State.ApiKeys {
+			if t.State.ApiKeys[i].Id == ev.Id {
+				t.State.ApiKeys[i].ReplacedBy = ev.ReplacedBy
+				t.State.ApiKeys[i].ExpiresAt = ev.ExpiresAt
+			}
+		}
+		return nil
+	case UserApiKeyRehashedEvent:
+		for i := range t.State.ApiKeys {
+			if t.State.ApiKeys[i].Id == ev.Id {
+				t.State.ApiKeys[i].SecretHash = ev.SecretHash
+			}
+		}
+		return nil
 	case UserApiKeyDeletedEvent:
 		newApiKeys := make([]ApiKey, 0, len(t.State.ApiKeys))
 		for _, apiKey := range t.State.ApiKeys {
@@ -122,13 +182,65 @@ func (t *UserAggregate) ApplyEventState(eventState evercore.EventState, eventTim
 		t.State.EmailLoginCode = &ev.Code
 		t.State.EmailLoginCodeGeneratedAt = eventTime.Unix()
 		t.State.EmailLoginCodeExpiresAt = ev.ExpiresAt
+		t.State.EmailLoginLinkHash = ev.LinkHash
+		t.State.EmailLoginCodeFailures = 0
 		return nil
 	case UserEmailLoginCodeConsumedEvent:
 		t.State.EmailLoginCode = nil
 		t.State.EmailLoginCodeGeneratedAt = 0
 		t.State.EmailLoginCodeExpiresAt = 0
+		t.State.EmailLoginLinkHash = ""
+		t.State.EmailLoginCodeFailures = 0
 		t.State.Verified = true
 		return nil
+	case UserEmailLoginCodeFailedEvent:
+		t.State.EmailLoginCodeFailures++
+		return nil
+	case UserEmailLoginCodeInvalidatedEvent:
+		// The generation time is kept so the request cooldown still applies.
+		t.State.EmailLoginCode = nil
+		t.State.EmailLoginCodeExpiresAt = 0
+		t.State.EmailLoginLinkHash = ""
+		t.State.EmailLoginCodeFailures = 0
+		return nil
+	case UserDeviceRememberedEvent:
+		t.State.KnownDevices = append(t.State.KnownDevices, KnownDevice{
+			Fingerprint: ev.Fingerprint,
+			FirstSeenAt: eventTime.Unix(),
+		})
+		if len(t.State.KnownDevices) > maxKnownDevices {
+			t.State.KnownDevices = t.State.KnownDevices[len(t.State.KnownDevices)-maxKnownDevices:]
+		}
+		return nil
+	case UserSessionsRevokedEvent:
+		t.State.SessionsRevokedAt = eventTime.Unix()
+		return nil
+	case UserImpersonationStartedEvent:
+		return nil
+	case UserImpersonationStoppedEvent:
+		return nil
+	case ServiceAccountAddedEvent:
+		t.State.ServiceAccount = true
+		t.State.OwnerOrganizationId = ev.OrganizationId
+		t.State.DisplayName = ev.Name
+		t.State.Description = ev.Description
+		t.State.Verified = true
+		t.State.CreatedAt = eventTime.Unix()
+		t.State.UpdatedAt = eventTime.Unix()
+		return nil
+	case UserErasedEvent:
+		// Erasing deletes the user's data key, which renders every sealed
+		// value in the event history unreadable; the remaining fields are
+		// cleared so the tombstone carries no personal data into snapshots.
+		t.State = UserState{
+			Disabled:         true,
+			Erased:           true,
+			ErasedAt:         eventTime.Unix(),
+			CreatedAt:        t.State.CreatedAt,
+			UpdatedAt:        eventTime.Unix(),
+			PlaintextHistory: t.State.PlaintextHistory,
+		}
+		return nil
 	default:
 		err = t.StateAggregate.ApplyEventState(eventState, eventTime, reference)
 	}
@@ -143,6 +255,7 @@ func (t *UserAggregate) ApplyEventState(eventState evercore.EventState, eventTim
 		t.State.CreatedAt = eventTime.Unix()
 		t.State.UpdatedAt = eventTime.Unix()
 		t.State.ApiKeys = make([]ApiKey, len(t.State.ApiKeys))
+		t.State.PlaintextHistory = t.State.Email != "" && !isSealedPII(t.State.Email)
 	}
 
 	if eventState.GetEventType() == events.UserUpdatedEventType {
@@ -245,7 +358,11 @@ type UserGenerateVerificationTokenCommand struct {
 }
 
 type UserGenerateVerificationTokenResponse struct {
-	Token string `json:"token"`
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expiresAt"`
+	// LinkToken is the token of the verification link, which identifies the
+	// user as well as carrying the token.
+	LinkToken string `json:"linkToken"`
 }
 
 func (c UserGenerateVerificationTokenCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
@@ -261,6 +378,45 @@ type UserVerifyCommand struct {
 	Verification string `json:"verification"`
 }
 
+// UserVerifyLinkCommand verifies a user from the token of an emailed
+// verification link.
+type UserVerifyLinkCommand struct {
+	Token string `json:"token"`
+}
+
+func (c UserVerifyLinkCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	v := ubvalidation.NewValidationTracker()
+	v.ValidateField("token", c.Token, true, 0)
+	return v.Valid()
+}
+
+// UserResendVerificationCommand issues a new verification token and emails
+// it. The user is identified by Id, or by Email when Id is zero.
+type UserResendVerificationCommand struct {
+	Id    int64  `json:"id"`
+	Email string `json:"email"`
+}
+
+func (c UserResendVerificationCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	v := ubvalidation.NewValidationTracker()
+	if c.Id == 0 {
+		v.ValidateEmail("email", c.Email)
+	} else {
+		v.ValidateIntMinValue("id", c.Id, 1)
+	}
+	return v.Valid()
+}
+
+type UserResendVerificationResponse struct {
+	UserId    int64  `json:"userId"`
+	Email     string `json:"email"`
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expiresAt"`
+	LinkUrl   string `json:"linkUrl,omitempty"`
+	// Sent reports whether the link was emailed by the configured mailer.
+	Sent bool `json:"sent"`
+}
+
 type GenerateTwoFactorSharedSecretCommand struct {
 	Id           int64  `json:"id"`
 	SharedSecret string `json:"sharedSecret"`
@@ -270,9 +426,18 @@ type GenerateTwoFactorSharedSecretResponse struct {
 	SharedSecret string `json:"sharedSecret"`
 }
 
+// LoginClient describes where a login attempt came from. It is recorded on
+// login events and in the login history.
+type LoginClient struct {
+	IpAddress string `json:"ipAddress,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+	DeviceId  string `json:"deviceId,omitempty"`
+}
+
 type UserLoginCommand struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string      `json:"email"`
+	Password string      `json:"password"`
+	Client   LoginClient `json:"client"`
 }
 
 type UserSetTwoFactorSharedSecretCommand struct {
@@ -281,8 +446,9 @@ type UserSetTwoFactorSharedSecretCommand struct {
 }
 
 type UserVerifyTwoFactorLoginCommand struct {
-	UserId int64  `json:"id"`
-	Code   string `json:"code"`
+	UserId int64       `json:"id"`
+	Code   string      `json:"code"`
+	Client LoginClient `json:"client"`
 }
 
 type UserEmailLoginRequestCommand struct {
@@ -290,6 +456,15 @@ type UserEmailLoginRequestCommand struct {
 	FirstName   *string `json:"firstName,omitempty"`
 	LastName    *string `json:"lastName,omitempty"`
 	DisplayName *string `json:"displayName,omitempty"`
+
+	// ExistingOnly reports unknown emails as not found instead of creating
+	// a user.
+	ExistingOnly bool `json:"existingOnly,omitempty"`
+
+	// Binding is a secret held by the requesting browser, such as a cookie
+	// value. Magic links are only issued for bound requests and only work
+	// when presented with the same binding.
+	Binding string `json:"binding,omitempty"`
 }
 
 func (c UserEmailLoginRequestCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
@@ -306,11 +481,16 @@ type UserEmailLoginRequestResponse struct {
 	Email     string `json:"email"`
 	Code      string `json:"code"`
 	ExpiresAt int64  `json:"expiresAt"`
+	LinkToken string `json:"linkToken,omitempty"`
+	LinkUrl   string `json:"linkUrl,omitempty"`
+	// Sent reports whether the code was emailed by the configured mailer.
+	Sent bool `json:"sent"`
 }
 
 type UserVerifyEmailLoginCodeCommand struct {
-	Email string `json:"email"`
-	Code  string `json:"code"`
+	Email  string      `json:"email"`
+	Code   string      `json:"code"`
+	Client LoginClient `json:"client"`
 }
 
 func (c UserVerifyEmailLoginCodeCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
@@ -320,6 +500,19 @@ func (c UserVerifyEmailLoginCodeCommand) Validate() (bool, []ubvalidation.Valida
 	return v.Valid()
 }
 
+type UserVerifyEmailLoginLinkCommand struct {
+	Token   string      `json:"token"`
+	Binding string      `json:"binding"`
+	Client  LoginClient `json:"client"`
+}
+
+func (c UserVerifyEmailLoginLinkCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	v := ubvalidation.NewValidationTracker()
+	v.ValidateField("token", c.Token, true, 0)
+	v.ValidateField("binding", c.Binding, true, 0)
+	return v.Valid()
+}
+
 type UserDisableCommand struct {
 	Id int64 `json:"id"`
 }
@@ -333,6 +526,13 @@ type UserGenerateApiKeyCommand struct {
 	Name           string    `json:"name"`
 	OrganizationId int64     `json:"organizationId,omitempty"`
 	ExpiresAt      time.Time `json:"expiresAt"`
+	// Scopes are permissions or wildcard scopes such as "reports:*" the key is
+	// limited to. They must be held by the user in the organization. Empty
+	// means the key carries all of the user's permissions.
+	Scopes []string `json:"scopes,omitempty"`
+	// AllowedCidrs are CIDR ranges or single addresses the key may be used
+	// from. Empty means any address.
+	AllowedCidrs []string `json:"allowedCidrs,omitempty"`
 }
 
 func (c UserGenerateApiKeyCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
@@ -342,6 +542,28 @@ func (c UserGenerateApiKeyCommand) Validate() (bool, []ubvalidation.ValidationIs
 	validationTracker.ValidateField("name", c.Name, true, 0)
 	validationTracker.ValidateIntMinValue("organizationId", c.OrganizationId, 1)
 	validationTracker.ValidateTimeInFuture("expiresAt", c.ExpiresAt)
+	validateScopes(validationTracker, "scopes", c.Scopes)
+	validateAllowedCidrs(validationTracker, "allowedCidrs", c.AllowedCidrs)
+	return validationTracker.Valid()
+}
+
+// UserRotateApiKeyCommand issues a replacement for an API key. The old key
+// keeps working for the grace period, or until it expires if that is sooner.
+type UserRotateApiKeyCommand struct {
+	UserId      int64         `json:"userId"`
+	ApiKeyId    string        `json:"apiKeyId"`
+	GracePeriod time.Duration `json:"gracePeriod"`
+}
+
+func (c UserRotateApiKeyCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	validationTracker := ubvalidation.NewValidationTracker()
+
+	validationTracker.ValidateIntMinValue("userId", c.UserId, 1)
+	if len(c.ApiKeyId) != ApiKeyIdLength {
+		validationTracker.AddIssue("apiKeyId", "API key id is invalid")
+	}
+	validationTracker.ValidateIntMinValue("gracePeriod", int64(c.GracePeriod), 0)
+	validationTracker.ValidateIntMaxValue("gracePeriod", int64(c.GracePeriod), int64(MaxApiKeyRotationGracePeriod))
 	return validationTracker.Valid()
 }
 
@@ -350,6 +572,71 @@ type UserDeleteApiKeyCommand struct {
 	ApiKey string `json:"apiKey"`
 }
 
+type UserEraseCommand struct {
+	Id int64 `json:"id"`
+}
+
+func (c UserEraseCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	validationTracker := ubvalidation.NewValidationTracker()
+	validationTracker.ValidateIntMinValue("id", c.Id, 1)
+	return validationTracker.Valid()
+}
+
+// UserStartImpersonationCommand begins an impersonation session in which the
+// impersonator acts as the target user. OrganizationId is the organization of
+// the impersonator's session.
+type UserStartImpersonationCommand struct {
+	ImpersonatorId int64 `json:"impersonatorId"`
+	OrganizationId int64 `json:"organizationId"`
+	TargetId       int64 `json:"targetId"`
+}
+
+func (c UserStartImpersonationCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	validationTracker := ubvalidation.NewValidationTracker()
+	validationTracker.ValidateIntMinValue("impersonatorId", c.ImpersonatorId, 1)
+	validationTracker.ValidateIntMinValue("organizationId", c.OrganizationId, 1)
+	validationTracker.ValidateIntMinValue("targetId", c.TargetId, 1)
+	if c.ImpersonatorId == c.TargetId {
+		validationTracker.AddIssue("targetId", "cannot impersonate yourself")
+	}
+	return validationTracker.Valid()
+}
+
+type UserStopImpersonationCommand struct {
+	ImpersonatorId int64 `json:"impersonatorId"`
+	TargetId       int64 `json:"targetId"`
+}
+
+func (c UserStopImpersonationCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	validationTracker := ubvalidation.NewValidationTracker()
+	validationTracker.ValidateIntMinValue("impersonatorId", c.ImpersonatorId, 1)
+	validationTracker.ValidateIntMinValue("targetId", c.TargetId, 1)
+	return validationTracker.Valid()
+}
+
+// UserReportUnrecognizedLoginCommand is submitted from the link in a login
+// alert email when the user does not recognise the login.
+type UserReportUnrecognizedLoginCommand struct {
+	Token string `json:"token"`
+}
+
+func (c UserReportUnrecognizedLoginCommand) Validate() (bool, []ubvalidation.ValidationIssue) {
+	validationTracker := ubvalidation.NewValidationTracker()
+	validationTracker.ValidateField("token", c.Token, true, 1)
+	return validationTracker.Valid()
+}
+
+type UserImpersonationResponse struct {
+	ImpersonatorId    int64  `json:"impersonatorId"`
+	ImpersonatorEmail string `json:"impersonatorEmail"`
+	TargetId          int64  `json:"targetId"`
+	TargetEmail       string `json:"targetEmail"`
+	// TargetOrganizationId is the organization the impersonation session is
+	// in: the impersonator's when the target is a member of it, and otherwise
+	// one the target is a member of.
+	TargetOrganizationId int64 `json:"targetOrganizationId"`
+}
+
 // ============================================================================
 // Events
 // ============================================================================
@@ -377,6 +664,7 @@ type UserUpdatedEvent struct {
 
 // evercore:event
 type UserLoginSucceededEvent struct {
+	Client LoginClient `json:"client"`
 }
 
 func (a UserLoginSucceededEvent) GetEventType() string {
@@ -389,8 +677,9 @@ func (a UserLoginSucceededEvent) Serialize() string {
 
 // evercore:event
 type UserLoginPartiallySucceededEvent struct {
-	RequiresTwoFactor    bool `json:"requiresTwoFactor,omitempty"`
-	RequiresVerification bool `json:"requiresVerify,omitempty"`
+	RequiresTwoFactor    bool        `json:"requiresTwoFactor,omitempty"`
+	RequiresVerification bool        `json:"requiresVerify,omitempty"`
+	Client               LoginClient `json:"client"`
 }
 
 func (a UserLoginPartiallySucceededEvent) GetEventType() string {
@@ -403,7 +692,8 @@ func (a UserLoginPartiallySucceededEvent) Serialize() string {
 
 // evercore:event
 type UserLoginFailedEvent struct {
-	Reason string `json:"reason,omitempty"`
+	Reason string      `json:"reason,omitempty"`
+	Client LoginClient `json:"client"`
 }
 
 func (a UserLoginFailedEvent) GetEventType() string {
@@ -417,6 +707,7 @@ func (a UserLoginFailedEvent) Serialize() string {
 type UserVerificationTokenGeneratedEvent struct {
 	Token       string `json:"token"`
 	Regenerated bool   `json:"regenerated"`
+	ExpiresAt   int64  `json:"expiresAt,omitempty"`
 }
 
 func (a UserVerificationTokenGeneratedEvent) GetEventType() string {
@@ -502,12 +793,14 @@ func (a UserEnabledEvent) Serialize() string {
 
 // evercore:event
 type UserApiKeyAddedEvent struct {
-	Id             string `json:"id"`
-	OrganizationId int64  `json:"organizationId"`
-	SecretHash     string `json:"secretHash"`
-	Name           string `json:"name"`
-	CreatedAt      int64  `json:"createdAt"`
-	ExpiresAt      int64  `json:"expiresAt"`
+	Id             string   `json:"id"`
+	OrganizationId int64    `json:"organizationId"`
+	SecretHash     string   `json:"secretHash"`
+	Name           string   `json:"name"`
+	CreatedAt      int64    `json:"createdAt"`
+	ExpiresAt      int64    `json:"expiresAt"`
+	Scopes         []string `json:"scopes,omitempty"`
+	AllowedCidrs   []string `json:"allowedCidrs,omitempty"`
 }
 
 func (a UserApiKeyAddedEvent) GetEventType() string {
@@ -530,6 +823,34 @@ func (a UserApiKeyDeletedEvent) Serialize() string {
 	return evercore.SerializeToJson(a)
 }
 
+// evercore:event
+type UserApiKeyRotatedEvent struct {
+	Id         string `json:"id"`
+	ReplacedBy string `json:"replacedBy"`
+	// ExpiresAt is when the rotated key stops working.
+	ExpiresAt int64 `json:"expiresAt"`
+}
+
+func (a UserApiKeyRotatedEvent) GetEventType() string {
+	return events.UserApiKeyRotatedEventType
+}
+func (a UserApiKeyRotatedEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
+
+// evercore:event
+type UserApiKeyRehashedEvent struct {
+	Id         string `json:"id"`
+	SecretHash string `json:"secretHash"`
+}
+
+func (a UserApiKeyRehashedEvent) GetEventType() string {
+	return events.UserApiKeyRehashedEventType
+}
+func (a UserApiKeyRehashedEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
+
 // evercore:event
 type UserSettingsAddedEvent struct {
 	Settings map[string]string `json:"settings"`
@@ -553,6 +874,8 @@ func (a UserSettingsRemovedEvent) Serialize() string    { return evercore.Serial
 type UserEmailLoginCodeGeneratedEvent struct {
 	Code      string `json:"code"`
 	ExpiresAt int64  `json:"expiresAt"`
+	// LinkHash identifies the magic link issued with the code, if any.
+	LinkHash string `json:"linkHash,omitempty"`
 }
 
 func (a UserEmailLoginCodeGeneratedEvent) GetEventType() string {
@@ -574,3 +897,121 @@ func (a UserEmailLoginCodeConsumedEvent) GetEventType() string {
 func (a UserEmailLoginCodeConsumedEvent) Serialize() string {
 	return evercore.SerializeToJson(a)
 }
+
+// UserEmailLoginCodeFailedEvent records an incorrect guess of the pending
+// email login code.
+// evercore:event
+type UserEmailLoginCodeFailedEvent struct {
+}
+
+func (a UserEmailLoginCodeFailedEvent) GetEventType() string {
+	return events.UserEmailLoginCodeFailedEventType
+}
+
+func (a UserEmailLoginCodeFailedEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
+
+// UserEmailLoginCodeInvalidatedEvent discards the pending email login code
+// without logging the user in.
+// evercore:event
+type UserEmailLoginCodeInvalidatedEvent struct {
+	Reason string `json:"reason"`
+}
+
+func (a UserEmailLoginCodeInvalidatedEvent) GetEventType() string {
+	return events.UserEmailLoginCodeInvalidatedEventType
+}
+
+func (a UserEmailLoginCodeInvalidatedEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
+
+// evercore:event
+type UserErasedEvent struct {
+}
+
+func (a UserErasedEvent) GetEventType() string {
+	return events.UserErasedEventType
+}
+
+func (a UserErasedEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
+
+// evercore:event
+type ServiceAccountAddedEvent struct {
+	OrganizationId int64  `json:"organizationId"`
+	Name           string `json:"name"`
+	Description    string `json:"description,omitempty"`
+}
+
+func (a ServiceAccountAddedEvent) GetEventType() string {
+	return events.ServiceAccountAddedEventType
+}
+
+func (a ServiceAccountAddedEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
+
+// UserImpersonationStartedEvent is recorded on both the impersonator and the
+// target aggregates when an impersonation session begins.
+// evercore:event
+type UserImpersonationStartedEvent struct {
+	ImpersonatorId int64 `json:"impersonatorId"`
+	TargetId       int64 `json:"targetId"`
+}
+
+func (a UserImpersonationStartedEvent) GetEventType() string {
+	return events.UserImpersonationStartedEventType
+}
+
+func (a UserImpersonationStartedEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
+
+// UserImpersonationStoppedEvent is recorded on both the impersonator and the
+// target aggregates when an impersonation session ends.
+// evercore:event
+type UserImpersonationStoppedEvent struct {
+	ImpersonatorId int64 `json:"impersonatorId"`
+	TargetId       int64 `json:"targetId"`
+}
+
+func (a UserImpersonationStoppedEvent) GetEventType() string {
+	return events.UserImpersonationStoppedEventType
+}
+
+func (a UserImpersonationStoppedEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
+
+// UserDeviceRememberedEvent records a device the user has not logged in from
+// before.
+// evercore:event
+type UserDeviceRememberedEvent struct {
+	Fingerprint string `json:"fingerprint"`
+}
+
+func (a UserDeviceRememberedEvent) GetEventType() string {
+	return events.UserDeviceRememberedEventType
+}
+
+func (a UserDeviceRememberedEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
+
+// UserSessionsRevokedEvent invalidates every session issued to the user
+// before the event.
+// evercore:event
+type UserSessionsRevokedEvent struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+func (a UserSessionsRevokedEvent) GetEventType() string {
+	return events.UserSessionsRevokedEventType
+}
+
+func (a UserSessionsRevokedEvent) Serialize() string {
+	return evercore.SerializeToJson(a)
+}
@@ -1,6 +1,7 @@
 package ubmanage
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -111,13 +112,16 @@ func TestUserAggregateApplyEventState_TwoFactorAndApiKeys(t *testing.T) {
 	}
 
 	// API key add/delete
-	addKey := UserApiKeyAddedEvent{Id: "id123", OrganizationId: 1, SecretHash: "h", Name: "n", CreatedAt: now.Unix(), ExpiresAt: now.Add(24 * time.Hour).Unix()}
+	addKey := UserApiKeyAddedEvent{Id: "id123", OrganizationId: 1, SecretHash: "h", Name: "n", CreatedAt: now.Unix(), ExpiresAt: now.Add(24 * time.Hour).Unix(), Scopes: []string{"reports:*"}}
 	if err := agg.ApplyEventState(addKey, now.Add(3*time.Second), "tester"); err != nil {
 		t.Fatalf("apply api key added: %v", err)
 	}
 	if len(agg.State.ApiKeys) != 1 || agg.State.ApiKeys[0].Id != "id123" {
 		t.Fatalf("expected 1 api key with id id123, got %+v", agg.State.ApiKeys)
 	}
+	if len(agg.State.ApiKeys[0].Scopes) != 1 || agg.State.ApiKeys[0].Scopes[0] != "reports:*" {
+		t.Fatalf("expected api key scopes to be kept, got %+v", agg.State.ApiKeys[0].Scopes)
+	}
 	if err := agg.ApplyEventState(UserApiKeyDeletedEvent{Id: "id123"}, now.Add(4*time.Second), "tester"); err != nil {
 		t.Fatalf("apply api key deleted: %v", err)
 	}
@@ -126,6 +130,122 @@ func TestUserAggregateApplyEventState_TwoFactorAndApiKeys(t *testing.T) {
 	}
 }
 
+func TestUserAggregateApplyEventState_Erased(t *testing.T) {
+	agg := &UserAggregate{}
+	now := time.Now()
+	add := evercore.NewStateEvent(UserAddedEvent{
+		Email:        "pii:v1:sealed-email",
+		PasswordHash: "hash",
+		FirstName:    "pii:v1:sealed-first",
+		DisplayName:  "pii:v1:sealed-display",
+		Verified:     true,
+	})
+	if err := agg.ApplyEventState(add, now, "tester"); err != nil {
+		t.Fatalf("apply add: %v", err)
+	}
+	if agg.State.PlaintextHistory {
+		t.Fatal("expected a sealed user not to have plaintext history")
+	}
+	agg.ApplyEventState(UserSettingsAddedEvent{Settings: map[string]string{"k": "v"}}, now, "tester")
+
+	if err := agg.ApplyEventState(UserErasedEvent{}, now.Add(time.Second), "tester"); err != nil {
+		t.Fatalf("apply erased: %v", err)
+	}
+	st := agg.State
+	if !st.Erased || !st.Disabled || st.ErasedAt != now.Add(time.Second).Unix() {
+		t.Fatalf("expected erased tombstone, got %+v", st)
+	}
+	if st.Email != "" || st.FirstName != "" || st.DisplayName != "" || st.PasswordHash != "" || st.Settings != nil {
+		t.Fatalf("expected personal data cleared, got %+v", st)
+	}
+	if st.CreatedAt == 0 {
+		t.Fatal("expected created at to be kept")
+	}
+}
+
+func TestUserAggregateApplyEventState_PlaintextHistory(t *testing.T) {
+	agg := &UserAggregate{}
+	now := time.Now()
+	add := evercore.NewStateEvent(UserAddedEvent{Email: "legacy@example.com", PasswordHash: "hash"})
+	if err := agg.ApplyEventState(add, now, "tester"); err != nil {
+		t.Fatalf("apply add: %v", err)
+	}
+	if !agg.State.PlaintextHistory {
+		t.Fatal("expected a user added with plaintext to have plaintext history")
+	}
+	if err := agg.ApplyEventState(UserErasedEvent{}, now, "tester"); err != nil {
+		t.Fatalf("apply erased: %v", err)
+	}
+	if !agg.State.PlaintextHistory {
+		t.Fatal("expected plaintext history to survive erasure")
+	}
+}
+
+func TestUserAggregateApplyEventState_DevicesAndSessions(t *testing.T) {
+	agg := &UserAggregate{}
+	now := time.Now()
+	for i := 0; i < maxKnownDevices+2; i++ {
+		fingerprint := fmt.Sprintf("device-%d", i)
+		if err := agg.ApplyEventState(UserDeviceRememberedEvent{Fingerprint: fingerprint}, now, "tester"); err != nil {
+			t.Fatalf("apply device remembered: %v", err)
+		}
+	}
+	if len(agg.State.KnownDevices) != maxKnownDevices {
+		t.Fatalf("expected %d known devices, got %d", maxKnownDevices, len(agg.State.KnownDevices))
+	}
+	if agg.State.KnownDevices[0].Fingerprint != "device-2" || agg.State.KnownDevices[0].FirstSeenAt != now.Unix() {
+		t.Fatalf("expected oldest devices to be forgotten, got %+v", agg.State.KnownDevices[0])
+	}
+	if !agg.State.knowsDevice("device-5") || agg.State.knowsDevice("device-0") {
+		t.Fatal("unexpected known device lookup result")
+	}
+
+	if err := agg.ApplyEventState(UserSessionsRevokedEvent{}, now, "tester"); err != nil {
+		t.Fatalf("apply sessions revoked: %v", err)
+	}
+	if agg.State.SessionsRevokedAt != now.Unix() {
+		t.Fatalf("expected sessions revoked at %d, got %d", now.Unix(), agg.State.SessionsRevokedAt)
+	}
+}
+
+func TestUserAggregateApplyEventState_EmailLoginCodeFailures(t *testing.T) {
+	agg := &UserAggregate{}
+	generatedAt := time.Now()
+	if err := agg.ApplyEventState(UserEmailLoginCodeGeneratedEvent{Code: "sealed", ExpiresAt: generatedAt.Add(time.Minute).Unix(), LinkHash: "hash"}, generatedAt, "tester"); err != nil {
+		t.Fatalf("apply code generated: %v", err)
+	}
+	for range 2 {
+		if err := agg.ApplyEventState(UserEmailLoginCodeFailedEvent{}, generatedAt, "tester"); err != nil {
+			t.Fatalf("apply code failed: %v", err)
+		}
+	}
+	if agg.State.EmailLoginCodeFailures != 2 {
+		t.Fatalf("expected 2 failures, got %d", agg.State.EmailLoginCodeFailures)
+	}
+
+	if err := agg.ApplyEventState(UserEmailLoginCodeInvalidatedEvent{Reason: "test"}, generatedAt, "tester"); err != nil {
+		t.Fatalf("apply code invalidated: %v", err)
+	}
+	st := agg.State
+	if st.EmailLoginCode != nil || st.EmailLoginLinkHash != "" || st.EmailLoginCodeFailures != 0 || st.Verified {
+		t.Fatalf("expected code to be invalidated without logging in, got %+v", st)
+	}
+	if st.EmailLoginCodeGeneratedAt != generatedAt.Unix() {
+		t.Fatal("expected generation time to be kept for the cooldown")
+	}
+
+	m := &ManagementImpl{emailLoginOptions: EmailLoginOptions{RequestCooldown: time.Minute}}
+	if wait := m.emailLoginCooldown(&st, generatedAt.Add(10*time.Second)); wait <= 0 || wait > 50*time.Second {
+		t.Fatalf("expected cooldown of up to 50s, got %s", wait)
+	}
+	if wait := m.emailLoginCooldown(&st, generatedAt.Add(2*time.Minute)); wait != 0 {
+		t.Fatalf("expected cooldown to have passed, got %s", wait)
+	}
+	if wait := m.emailLoginCooldown(&UserState{}, generatedAt); wait != 0 {
+		t.Fatalf("expected no cooldown without a code, got %s", wait)
+	}
+}
+
 func TestUserCommandValidation(t *testing.T) {
 	// UserCreateCommand valid/invalid
 	valid := UserCreateCommand{Email: "a@b", Password: "Abcdef1!", FirstName: "A", LastName: "B", DisplayName: "AB", Verified: true}
@@ -177,6 +297,36 @@ func TestUserCommandValidation(t *testing.T) {
 		t.Fatal("expected invalid api key cmd userId")
 	}
 
+	// UserEraseCommand
+	if ok, _ := (UserEraseCommand{Id: 1}).Validate(); !ok {
+		t.Fatal("expected valid erase cmd")
+	}
+	if ok, _ := (UserEraseCommand{Id: 0}).Validate(); ok {
+		t.Fatal("expected invalid erase cmd")
+	}
+
+	// UserStartImpersonationCommand
+	if ok, _ := (UserStartImpersonationCommand{ImpersonatorId: 1, OrganizationId: 1, TargetId: 2}).Validate(); !ok {
+		t.Fatal("expected valid start impersonation cmd")
+	}
+	if ok, _ := (UserStartImpersonationCommand{ImpersonatorId: 1, OrganizationId: 1, TargetId: 1}).Validate(); ok {
+		t.Fatal("expected self impersonation to be invalid")
+	}
+	if ok, _ := (UserStartImpersonationCommand{ImpersonatorId: 1, TargetId: 2}).Validate(); ok {
+		t.Fatal("expected start impersonation without an organization to be invalid")
+	}
+	if ok, _ := (UserStopImpersonationCommand{ImpersonatorId: 1}).Validate(); ok {
+		t.Fatal("expected invalid stop impersonation cmd")
+	}
+
+	// UserReportUnrecognizedLoginCommand
+	if ok, _ := (UserReportUnrecognizedLoginCommand{Token: "token"}).Validate(); !ok {
+		t.Fatal("expected valid report login cmd")
+	}
+	if ok, _ := (UserReportUnrecognizedLoginCommand{}).Validate(); ok {
+		t.Fatal("expected invalid report login cmd")
+	}
+
 	// UserEmailLoginRequestCommand
 	emailReq := UserEmailLoginRequestCommand{Email: "login@example.com"}
 	if ok, _ := emailReq.Validate(); !ok {
@@ -0,0 +1,394 @@
+package ubpolicy
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+type node interface {
+	eval(attributes Attributes) (any, error)
+}
+
+type literalNode struct {
+	value any
+}
+
+func (n literalNode) eval(Attributes) (any, error) {
+	return n.value, nil
+}
+
+type attributeNode struct {
+	name string
+}
+
+func (n attributeNode) eval(attributes Attributes) (any, error) {
+	value, err := normalize(attributes[n.name])
+	if err != nil {
+		return nil, fmt.Errorf("attribute %s: %w", n.name, err)
+	}
+	return value, nil
+}
+
+type listNode struct {
+	items []node
+}
+
+func (n listNode) eval(attributes Attributes) (any, error) {
+	values := make([]any, len(n.items))
+	for i, item := range n.items {
+		value, err := item.eval(attributes)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n notNode) eval(attributes Attributes) (any, error) {
+	value, err := evalBool(n.operand, attributes, "!")
+	if err != nil {
+		return nil, err
+	}
+	return !value, nil
+}
+
+type logicalNode struct {
+	or          bool
+	left, right node
+}
+
+func (n logicalNode) eval(attributes Attributes) (any, error) {
+	op := "&&"
+	if n.or {
+		op = "||"
+	}
+	left, err := evalBool(n.left, attributes, op)
+	if err != nil {
+		return nil, err
+	}
+	if left == n.or {
+		return left, nil
+	}
+	return evalBool(n.right, attributes, op)
+}
+
+func evalBool(n node, attributes Attributes, op string) (bool, error) {
+	value, err := n.eval(attributes)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s expects booleans, got %s", op, typeName(value))
+	}
+	return b, nil
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n compareNode) eval(attributes Attributes) (any, error) {
+	left, err := n.left.eval(attributes)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		if right == nil {
+			return false, nil
+		}
+		list, ok := right.([]any)
+		if !ok {
+			return nil, fmt.Errorf("in expects a list, got %s", typeName(right))
+		}
+		for _, item := range list {
+			if equal(left, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	var order int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %s %s %s", typeName(left), n.op, typeName(right))
+		}
+		order = compareOrdered(l, r)
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %s %s %s", typeName(left), n.op, typeName(right))
+		}
+		order = compareOrdered(l, r)
+	default:
+		return nil, fmt.Errorf("cannot compare %s %s %s", typeName(left), n.op, typeName(right))
+	}
+	switch n.op {
+	case "<":
+		return order < 0, nil
+	case "<=":
+		return order <= 0, nil
+	case ">":
+		return order > 0, nil
+	default:
+		return order >= 0, nil
+	}
+}
+
+func compareOrdered[T float64 | string](a T, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func equal(a any, b any) bool {
+	la, aIsList := a.([]any)
+	lb, bIsList := b.([]any)
+	if aIsList || bIsList {
+		if !aIsList || !bIsList || len(la) != len(lb) {
+			return false
+		}
+		for i := range la {
+			if !equal(la[i], lb[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+type callNode struct {
+	name string
+	fn   function
+	args []node
+}
+
+func (n callNode) eval(attributes Attributes) (any, error) {
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(attributes)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	value, err := n.fn.call(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return value, nil
+}
+
+type function struct {
+	minArgs int
+	// maxArgs is -1 for functions taking any number of arguments.
+	maxArgs int
+	call    func(args []any) (any, error)
+}
+
+var functions = map[string]function{
+	"cidr":   {minArgs: 2, maxArgs: -1, call: cidrFunction},
+	"number": {minArgs: 1, maxArgs: 1, call: numberFunction},
+	"lower":  {minArgs: 1, maxArgs: 1, call: lowerFunction},
+	"split":  {minArgs: 2, maxArgs: 2, call: splitFunction},
+}
+
+// cidrFunction reports whether the address is within any of the ranges. A
+// missing address or range is not within anything.
+func cidrFunction(args []any) (any, error) {
+	if args[0] == nil {
+		return false, nil
+	}
+	address, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("expects a string address, got %s", typeName(args[0]))
+	}
+	ip, err := netip.ParseAddr(strings.TrimSpace(address))
+	if err != nil {
+		return false, nil
+	}
+	ip = ip.Unmap()
+
+	ranges := []string{}
+	for _, arg := range args[1:] {
+		items, isList := arg.([]any)
+		if !isList {
+			items = []any{arg}
+		}
+		for _, item := range items {
+			switch v := item.(type) {
+			case nil:
+			case string:
+				ranges = append(ranges, strings.Split(v, ",")...)
+			default:
+				return nil, fmt.Errorf("expects string ranges, got %s", typeName(item))
+			}
+		}
+	}
+	for _, r := range ranges {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		if !strings.Contains(r, "/") {
+			addr, err := netip.ParseAddr(r)
+			if err != nil {
+				return nil, fmt.Errorf("invalid range %q", r)
+			}
+			if addr.Unmap() == ip {
+				return true, nil
+			}
+			continue
+		}
+		prefix, err := netip.ParsePrefix(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q", r)
+		}
+		if prefix.Contains(ip) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func numberFunction(args []any) (any, error) {
+	switch v := args[0].(type) {
+	case nil, float64:
+		return v, nil
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", v)
+		}
+		return number, nil
+	}
+	return nil, fmt.Errorf("expects a string, got %s", typeName(args[0]))
+}
+
+func lowerFunction(args []any) (any, error) {
+	switch v := args[0].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return strings.ToLower(v), nil
+	}
+	return nil, fmt.Errorf("expects a string, got %s", typeName(args[0]))
+}
+
+func splitFunction(args []any) (any, error) {
+	separator, ok := args[1].(string)
+	if !ok || separator == "" {
+		return nil, fmt.Errorf("expects a non-empty string separator")
+	}
+	switch v := args[0].(type) {
+	case nil:
+		return []any{}, nil
+	case string:
+		items := []any{}
+		for _, item := range strings.Split(v, separator) {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("expects a string, got %s", typeName(args[0]))
+}
+
+// normalize converts an attribute to one of the evaluated types.
+func normalize(value any) (any, error) {
+	switch v := value.(type) {
+	case nil, string, bool, float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float32:
+		return float64(v), nil
+	case []string:
+		values := make([]any, len(v))
+		for i, s := range v {
+			values[i] = s
+		}
+		return values, nil
+	case []any:
+		values := make([]any, len(v))
+		for i, item := range v {
+			normalized, err := normalize(item)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = normalized
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", value)
+}
+
+func typeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case []any:
+		return "list"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func collectAttributes(n node, names *[]string) {
+	switch v := n.(type) {
+	case attributeNode:
+		*names = append(*names, v.name)
+	case listNode:
+		for _, item := range v.items {
+			collectAttributes(item, names)
+		}
+	case notNode:
+		collectAttributes(v.operand, names)
+	case logicalNode:
+		collectAttributes(v.left, names)
+		collectAttributes(v.right, names)
+	case compareNode:
+		collectAttributes(v.left, names)
+		collectAttributes(v.right, names)
+	case callNode:
+		for _, arg := range v.args {
+			collectAttributes(arg, names)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package ubpolicy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenLeftBracket
+	tokenRightBracket
+	tokenComma
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	offset int
+	// value holds the decoded string or number of a literal.
+	value any
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of policy"
+	case tokenString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// Operators longest first, so that <= is not read as <.
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!"}
+
+func lex(source string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case isIdentStart(c):
+			start := i
+			for i < len(source) && (isIdentStart(source[i]) || isDigit(source[i]) || source[i] == '.') {
+				i++
+			}
+			text := source[start:i]
+			if strings.HasSuffix(text, ".") || strings.Contains(text, "..") {
+				return nil, &SyntaxError{Offset: start, Message: fmt.Sprintf("invalid name %q", text)}
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: text, offset: start})
+		case isDigit(c) || (c == '-' && i+1 < len(source) && isDigit(source[i+1])):
+			start := i
+			i++
+			for i < len(source) && (isDigit(source[i]) || source[i] == '.') {
+				i++
+			}
+			number, err := strconv.ParseFloat(source[start:i], 64)
+			if err != nil {
+				return nil, &SyntaxError{Offset: start, Message: fmt.Sprintf("invalid number %q", source[start:i])}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[start:i], offset: start, value: number})
+		case c == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(source) {
+					return nil, &SyntaxError{Offset: start, Message: "unterminated string"}
+				}
+				if source[i] == '"' {
+					i++
+					break
+				}
+				if source[i] == '\\' {
+					if i+1 >= len(source) || (source[i+1] != '"' && source[i+1] != '\\') {
+						return nil, &SyntaxError{Offset: i, Message: `only \" and \\ may be escaped`}
+					}
+					i++
+				}
+				sb.WriteByte(source[i])
+				i++
+			}
+			text := sb.String()
+			if !utf8.ValidString(text) {
+				return nil, &SyntaxError{Offset: start, Message: "string is not valid UTF-8"}
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, offset: start, value: text})
+		default:
+			kind := tokenOperator
+			text := ""
+			switch c {
+			case '(':
+				kind, text = tokenLeftParen, "("
+			case ')':
+				kind, text = tokenRightParen, ")"
+			case '[':
+				kind, text = tokenLeftBracket, "["
+			case ']':
+				kind, text = tokenRightBracket, "]"
+			case ',':
+				kind, text = tokenComma, ","
+			default:
+				for _, op := range operators {
+					if strings.HasPrefix(source[i:], op) {
+						text = op
+						break
+					}
+				}
+			}
+			if text == "" {
+				return nil, &SyntaxError{Offset: i, Message: fmt.Sprintf("unexpected character %q", c)}
+			}
+			tokens = append(tokens, token{kind: kind, text: text, offset: i})
+			i += len(text)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, offset: len(source)}), nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
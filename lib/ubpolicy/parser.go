@@ -0,0 +1,186 @@
+package ubpolicy
+
+import (
+	"fmt"
+)
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	t := p.next()
+	if t.kind != kind {
+		return &SyntaxError{Offset: t.offset, Message: fmt.Sprintf("expected %q, found %s", text, t)}
+	}
+	return nil
+}
+
+func (p *parser) isOperator(text string) bool {
+	t := p.peek()
+	return t.kind == tokenOperator && t.text == text
+}
+
+func (p *parser) parseExpression(depth int) (node, error) {
+	if depth > maxDepth {
+		return nil, &SyntaxError{Offset: p.peek().offset, Message: "policy is nested too deeply"}
+	}
+	return p.parseOr(depth)
+}
+
+func (p *parser) parseOr(depth int) (node, error) {
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("||") {
+		p.next()
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{or: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd(depth int) (node, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("&&") {
+		p.next()
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary(depth int) (node, error) {
+	if p.isOperator("!") {
+		p.next()
+		if depth+1 > maxDepth {
+			return nil, &SyntaxError{Offset: p.peek().offset, Message: "policy is nested too deeply"}
+		}
+		operand, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+	return p.parseComparison(depth)
+}
+
+func (p *parser) parseComparison(depth int) (node, error) {
+	left, err := p.parseOperand(depth)
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	op := ""
+	switch {
+	case t.kind == tokenOperator && t.text != "&&" && t.text != "||" && t.text != "!":
+		op = t.text
+	case t.kind == tokenIdent && t.text == "in":
+		op = "in"
+	default:
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseOperand(depth)
+	if err != nil {
+		return nil, err
+	}
+	return compareNode{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parseOperand(depth int) (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString, tokenNumber:
+		return literalNode{value: t.value}, nil
+	case tokenLeftParen:
+		inner, err := p.parseExpression(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRightParen, ")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	case tokenLeftBracket:
+		items, err := p.parseList(depth+1, tokenRightBracket, "]")
+		if err != nil {
+			return nil, err
+		}
+		return listNode{items: items}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return literalNode{value: true}, nil
+		case "false":
+			return literalNode{value: false}, nil
+		case "null":
+			return literalNode{value: nil}, nil
+		case "in":
+			return nil, &SyntaxError{Offset: t.offset, Message: "unexpected \"in\""}
+		}
+		if p.peek().kind != tokenLeftParen {
+			return attributeNode{name: t.text}, nil
+		}
+		p.next()
+		fn, found := functions[t.text]
+		if !found {
+			return nil, &SyntaxError{Offset: t.offset, Message: fmt.Sprintf("unknown function %q", t.text)}
+		}
+		args, err := p.parseList(depth+1, tokenRightParen, ")")
+		if err != nil {
+			return nil, err
+		}
+		if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+			return nil, &SyntaxError{Offset: t.offset, Message: fmt.Sprintf("wrong number of arguments to %s", t.text)}
+		}
+		return callNode{name: t.text, fn: fn, args: args}, nil
+	}
+	return nil, &SyntaxError{Offset: t.offset, Message: fmt.Sprintf("unexpected %s", t)}
+}
+
+// parseList parses comma separated expressions up to the closing token.
+func (p *parser) parseList(depth int, closing tokenKind, closingText string) ([]node, error) {
+	items := []node{}
+	if p.peek().kind == closing {
+		p.next()
+		return items, nil
+	}
+	for {
+		item, err := p.parseExpression(depth)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		t := p.next()
+		if t.kind == closing {
+			return items, nil
+		}
+		if t.kind != tokenComma {
+			return nil, &SyntaxError{Offset: t.offset, Message: fmt.Sprintf("expected \",\" or %q, found %s", closingText, t)}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Package ubpolicy compiles and evaluates small boolean expressions over
+// request attributes, such as
+//
+//	time.hour >= 9 && time.hour < 17 && !(time.weekday in ["saturday", "sunday"])
+//	cidr(request.ip, org.settings.office_ips)
+//
+// Expressions are made of:
+//
+//   - literals: strings ("..." with \" and \\ escapes), numbers, true, false
+//     and null, and lists of literals or attributes in brackets
+//   - attributes: dotted names such as time.hour or org.settings.region.
+//     Attributes missing from the input are null
+//   - comparisons: == and != on any values, < <= > >= on numbers or on
+//     strings, and in, which tests membership of a list. Comparisons do not
+//     chain
+//   - the logical operators !, && and ||, which only accept booleans, and
+//     parentheses
+//   - the functions
+//     cidr(ip, ranges...), true when ip lies within one of the ranges, given
+//     as CIDR strings, comma separated CIDR strings or lists of them;
+//     number(s), which parses a string as a number;
+//     lower(s), which lower cases a string; and
+//     split(s, sep), which splits a string into a list of trimmed items
+//
+// A policy allows a request only when it evaluates to true. Type errors, such
+// as comparing a string with a number, fail the evaluation.
+package ubpolicy
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// MaxLength bounds the length of a policy's source.
+const MaxLength = 2048
+
+// maxDepth bounds the nesting of expressions.
+const maxDepth = 32
+
+// Attributes are the values a policy may refer to, by dotted name. Values are
+// strings, float64 numbers, bools, nil or []any lists of those. Ints are
+// accepted and converted to numbers.
+type Attributes map[string]any
+
+// SyntaxError reports where a policy failed to compile.
+type SyntaxError struct {
+	// Offset is the byte offset of the error in the source.
+	Offset  int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at offset %d: %s", e.Offset, e.Message)
+}
+
+// ErrNotBoolean is returned when a policy evaluates to something other than a
+// boolean.
+var ErrNotBoolean = errors.New("policy does not evaluate to a boolean")
+
+// Policy is a compiled policy. It is safe for concurrent use.
+type Policy struct {
+	source     string
+	root       node
+	attributes []string
+}
+
+// Compile parses a policy.
+func Compile(source string) (*Policy, error) {
+	if len(source) > MaxLength {
+		return nil, &SyntaxError{Offset: MaxLength, Message: fmt.Sprintf("policy is longer than %d characters", MaxLength)}
+	}
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, &SyntaxError{Offset: t.offset, Message: fmt.Sprintf("unexpected %s", t)}
+	}
+
+	attributes := []string{}
+	collectAttributes(root, &attributes)
+	slices.Sort(attributes)
+	return &Policy{
+		source:     source,
+		root:       root,
+		attributes: slices.Compact(attributes),
+	}, nil
+}
+
+// Source returns the policy as written.
+func (p *Policy) Source() string {
+	return p.source
+}
+
+// Attributes returns the sorted names of the attributes the policy refers to.
+func (p *Policy) Attributes() []string {
+	return slices.Clone(p.attributes)
+}
+
+// Evaluate reports whether the policy allows a request with the attributes.
+func (p *Policy) Evaluate(attributes Attributes) (bool, error) {
+	value, err := p.root.eval(attributes)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: got %s", ErrNotBoolean, typeName(value))
+	}
+	return result, nil
+}
@@ -0,0 +1,147 @@
+package ubpolicy
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	attributes := Attributes{
+		"time.hour":             10,
+		"time.weekday":          "monday",
+		"request.ip":            "10.1.2.3",
+		"request.amount":        int64(250),
+		"org.settings.offices":  "10.0.0.0/8, 192.168.1.0/24",
+		"org.settings.regions":  "eu, us",
+		"org.settings.max":      "500",
+		"user.settings.trusted": "true",
+		"user.groups":           []string{"finance"},
+	}
+	tests := []struct {
+		policy string
+		want   bool
+	}{
+		{`true`, true},
+		{`time.hour >= 9 && time.hour < 17`, true},
+		{`time.hour >= 11 || time.weekday == "monday"`, true},
+		{`!(time.weekday in ["saturday", "sunday"])`, true},
+		{`cidr(request.ip, org.settings.offices)`, true},
+		{`cidr(request.ip, "192.168.0.0/16", "172.16.0.0/12")`, false},
+		{`cidr(request.ip, ["10.1.2.3"])`, true},
+		{`cidr(request.missing, org.settings.offices)`, false},
+		{`request.amount <= number(org.settings.max)`, true},
+		{`"us" in split(org.settings.regions, ",")`, true},
+		{`lower("EU") in split(org.settings.regions, ",")`, true},
+		{`user.settings.trusted == "true"`, true},
+		{`"finance" in user.groups`, true},
+		{`request.missing == null`, true},
+		{`"x" in request.missing`, false},
+		{`"b" > "a" && -1 < 0`, true},
+		{`[1, "a"] == [1, "a"]`, true},
+		{`1 == "1"`, false},
+		{`false || false`, false},
+		// The right hand side is not evaluated once the result is known.
+		{`false && request.missing > 1`, false},
+		{`true || request.missing > 1`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			policy, err := Compile(tt.policy)
+			if err != nil {
+				t.Fatalf("compile failed: %v", err)
+			}
+			got, err := policy.Evaluate(attributes)
+			if err != nil {
+				t.Fatalf("evaluate failed: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	attributes := Attributes{"time.hour": 10, "name": "x", "bad": struct{}{}}
+	tests := []string{
+		`time.hour`,
+		`name > 1`,
+		`request.missing > 1`,
+		`name && true`,
+		`!name`,
+		`1 in name`,
+		`number(name)`,
+		`cidr("10.0.0.1", "not a range")`,
+		`bad == 1`,
+	}
+	for _, source := range tests {
+		t.Run(source, func(t *testing.T) {
+			policy, err := Compile(source)
+			if err != nil {
+				t.Fatalf("compile failed: %v", err)
+			}
+			if allowed, err := policy.Evaluate(attributes); err == nil || allowed {
+				t.Fatalf("expected an error, got %v %v", allowed, err)
+			}
+		})
+	}
+
+	policy, _ := Compile(`time.hour`)
+	if _, err := policy.Evaluate(attributes); !errors.Is(err, ErrNotBoolean) {
+		t.Fatalf("expected ErrNotBoolean, got %v", err)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		offset int
+	}{
+		{``, 0},
+		{`time.hour >=`, 12},
+		{`time.hour >= 9 &&`, 17},
+		{`(true`, 5},
+		{`a == b == c`, 7},
+		{`"unterminated`, 0},
+		{`a.`, 0},
+		{`a ~ b`, 2},
+		{`unknown(1)`, 0},
+		{`lower(1, 2)`, 0},
+		{`[1, 2`, 5},
+		{`1.2.3`, 0},
+		{`"\n"`, 1},
+		{strings.Repeat("(", 40) + "true" + strings.Repeat(")", 40), 33},
+		{strings.Repeat("!", 40) + "true", 33},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			_, err := Compile(tt.source)
+			var syntaxError *SyntaxError
+			if !errors.As(err, &syntaxError) {
+				t.Fatalf("expected a syntax error, got %v", err)
+			}
+			if syntaxError.Offset != tt.offset {
+				t.Fatalf("expected offset %d, got %d: %v", tt.offset, syntaxError.Offset, err)
+			}
+		})
+	}
+
+	if _, err := Compile(strings.Repeat(" ", MaxLength+1)); err == nil {
+		t.Fatal("expected long policies to be rejected")
+	}
+}
+
+func TestPolicyAttributes(t *testing.T) {
+	policy, err := Compile(`time.hour > 9 && cidr(request.ip, org.settings.offices) && time.hour < 17`)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	if want := []string{"org.settings.offices", "request.ip", "time.hour"}; !slices.Equal(policy.Attributes(), want) {
+		t.Fatalf("expected %v, got %v", want, policy.Attributes())
+	}
+	if policy.Source() == "" {
+		t.Fatal("expected the source to be kept")
+	}
+}
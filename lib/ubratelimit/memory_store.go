@@ -0,0 +1,62 @@
+package ubratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps limiter state in process memory. It is suitable for a
+// single instance; deployments with several instances should use SQLStore so
+// that limits are shared.
+type MemoryStore struct {
+	mu        sync.Mutex
+	states    map[string]State
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// Expired entries are removed at most this often, during an update.
+const memoryStoreSweepInterval = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		states: make(map[string]State),
+		now:    time.Now,
+	}
+}
+
+func (s *MemoryStore) Update(ctx context.Context, key string, fn func(state *State)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	state, ok := s.states[key]
+	if ok && state.ExpiresAt <= now.UnixMilli() {
+		state = State{}
+	}
+	fn(&state)
+	s.states[key] = state
+	return nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memoryStoreSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	nowMs := now.UnixMilli()
+	for key, state := range s.states {
+		if state.ExpiresAt <= nowMs {
+			delete(s.states, key)
+		}
+	}
+}
+
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.states)
+}
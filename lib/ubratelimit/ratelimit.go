@@ -0,0 +1,194 @@
+// Package ubratelimit limits how often an action may be performed per key,
+// for example login attempts per IP address or per account.
+package ubratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ensure"
+)
+
+type Algorithm string
+
+const (
+	// TokenBucket allows bursts of up to Limit requests and refills at
+	// Limit per Window.
+	TokenBucket Algorithm = "token_bucket"
+
+	// SlidingWindow allows Limit requests in any Window, approximated from
+	// the counts of the current and previous fixed windows.
+	SlidingWindow Algorithm = "sliding_window"
+)
+
+type Policy struct {
+	// Name namespaces the policy's keys in the store.
+	Name      string
+	Algorithm Algorithm
+	Limit     int
+	Window    time.Duration
+}
+
+type Decision struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// State is the stored state of a single key. Its meaning depends on the
+// algorithm; a zero UpdatedAt means the key has no state yet.
+type State struct {
+	Amount         float64
+	PreviousAmount float64
+	// UpdatedAt and ExpiresAt are unix milliseconds. Once expired, the state
+	// is equivalent to no state and may be discarded.
+	UpdatedAt int64
+	ExpiresAt int64
+}
+
+// Store persists limiter state. Update must apply fn atomically with respect
+// to other updates of the same key, and may call fn more than once.
+type Store interface {
+	Update(ctx context.Context, key string, fn func(state *State)) error
+}
+
+type Limiter struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+func NewLimiter(store Store, policy Policy) *Limiter {
+	ensure.That(store != nil, "store cannot be nil")
+	ensure.That(policy.Name != "", "policy name cannot be empty")
+	ensure.That(policy.Limit > 0, "policy limit must be greater than 0")
+	ensure.That(policy.Window > 0, "policy window must be greater than 0")
+	ensure.That(policy.Algorithm == TokenBucket || policy.Algorithm == SlidingWindow, "unknown rate limit algorithm")
+
+	return &Limiter{
+		store:  store,
+		policy: policy,
+		now:    time.Now,
+	}
+}
+
+func (l *Limiter) Policy() Policy {
+	return l.policy
+}
+
+// Allow records an attempt for key and reports whether it is within the
+// policy. Keys are hashed before they are stored, so they may contain
+// personal data such as email addresses.
+func (l *Limiter) Allow(ctx context.Context, key string) (Decision, error) {
+	now := l.now()
+	var decision Decision
+	err := l.store.Update(ctx, l.storeKey(key), func(state *State) {
+		switch l.policy.Algorithm {
+		case SlidingWindow:
+			decision = l.slidingWindow(state, now)
+		default:
+			decision = l.tokenBucket(state, now)
+		}
+	})
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to update rate limit: %w", err)
+	}
+	return decision, nil
+}
+
+func (l *Limiter) storeKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return l.policy.Name + ":" + hex.EncodeToString(sum[:16])
+}
+
+func (l *Limiter) tokenBucket(state *State, now time.Time) Decision {
+	limit := float64(l.policy.Limit)
+	// Tokens refilled per millisecond.
+	rate := limit / float64(l.policy.Window.Milliseconds())
+	nowMs := now.UnixMilli()
+
+	tokens := limit
+	if state.UpdatedAt > 0 {
+		elapsed := float64(max(nowMs-state.UpdatedAt, 0))
+		tokens = math.Min(limit, state.Amount+elapsed*rate)
+	}
+
+	decision := Decision{}
+	if tokens >= 1 {
+		tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = time.Duration(math.Ceil((1-tokens)/rate)) * time.Millisecond
+	}
+	decision.Remaining = int(math.Floor(tokens))
+
+	state.Amount = tokens
+	state.UpdatedAt = nowMs
+	state.ExpiresAt = nowMs + int64(math.Ceil((limit-tokens)/rate))
+	return decision
+}
+
+func (l *Limiter) slidingWindow(state *State, now time.Time) Decision {
+	limit := float64(l.policy.Limit)
+	window := l.policy.Window.Milliseconds()
+	nowMs := now.UnixMilli()
+	windowStart := nowMs - nowMs%window
+
+	var current, previous float64
+	switch state.UpdatedAt {
+	case windowStart:
+		current, previous = state.Amount, state.PreviousAmount
+	case windowStart - window:
+		previous = state.Amount
+	}
+
+	elapsed := float64(nowMs - windowStart)
+	weight := 1 - elapsed/float64(window)
+	estimate := previous*weight + current
+
+	decision := Decision{}
+	if estimate+1 <= limit {
+		current++
+		decision.Allowed = true
+		decision.Remaining = int(math.Floor(limit - (estimate + 1)))
+	} else {
+		decision.RetryAfter = slidingWindowRetryAfter(limit, current, previous, elapsed, float64(window))
+	}
+
+	state.Amount = current
+	state.PreviousAmount = previous
+	state.UpdatedAt = windowStart
+	state.ExpiresAt = windowStart + 2*window
+	return decision
+}
+
+// slidingWindowRetryAfter estimates when the weighted count drops enough for
+// one more request, assuming no other requests arrive in the meantime.
+func slidingWindowRetryAfter(limit, current, previous, elapsed, window float64) time.Duration {
+	var wait float64
+	if current+1 <= limit && previous > 0 {
+		// Within this window, as the previous window's weight decays.
+		wait = window*(1-(limit-1-current)/previous) - elapsed
+	} else {
+		// In the next window, as this window's count decays.
+		wait = window - elapsed
+		if current > 0 {
+			wait += math.Max(window*(1-(limit-1)/current), 0)
+		}
+	}
+	return time.Duration(math.Ceil(math.Max(wait, 1))) * time.Millisecond
+}
+
+// RetryAfterSeconds rounds a retry delay up to whole seconds, as used by the
+// Retry-After header.
+func RetryAfterSeconds(retryAfter time.Duration) int64 {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
@@ -0,0 +1,254 @@
+package ubratelimit
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubdata"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestLimiter(store Store, clock *fakeClock, policy Policy) *Limiter {
+	limiter := NewLimiter(store, policy)
+	limiter.now = clock.Now
+	return limiter
+}
+
+func allow(t *testing.T, limiter *Limiter, key string) Decision {
+	t.Helper()
+	decision, err := limiter.Allow(context.Background(), key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return decision
+}
+
+func TestTokenBucket(t *testing.T) {
+	clock := &fakeClock{now: time.UnixMilli(1_700_000_000_000)}
+	store := NewMemoryStore()
+	store.now = clock.Now
+	limiter := newTestLimiter(store, clock, Policy{Name: "test", Algorithm: TokenBucket, Limit: 3, Window: 3 * time.Second})
+
+	for i := range 3 {
+		decision := allow(t, limiter, "a")
+		if !decision.Allowed {
+			t.Fatalf("expected attempt %d to be allowed", i+1)
+		}
+		if decision.Remaining != 2-i {
+			t.Fatalf("expected %d remaining, got %d", 2-i, decision.Remaining)
+		}
+	}
+
+	decision := allow(t, limiter, "a")
+	if decision.Allowed {
+		t.Fatal("expected burst to be exhausted")
+	}
+	if decision.RetryAfter != time.Second {
+		t.Fatalf("expected retry after 1s, got %s", decision.RetryAfter)
+	}
+
+	// Other keys have their own bucket.
+	if !allow(t, limiter, "b").Allowed {
+		t.Fatal("expected other key to be allowed")
+	}
+
+	clock.Advance(time.Second)
+	if !allow(t, limiter, "a").Allowed {
+		t.Fatal("expected a token to be refilled")
+	}
+	if allow(t, limiter, "a").Allowed {
+		t.Fatal("expected only one token to be refilled")
+	}
+
+	clock.Advance(time.Hour)
+	decision = allow(t, limiter, "a")
+	if !decision.Allowed || decision.Remaining != 2 {
+		t.Fatalf("expected a full bucket, got %+v", decision)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	window := 10 * time.Second
+	// Start at the beginning of a window.
+	clock := &fakeClock{now: time.UnixMilli(1_700_000_000_000)}
+	store := NewMemoryStore()
+	store.now = clock.Now
+	limiter := newTestLimiter(store, clock, Policy{Name: "test", Algorithm: SlidingWindow, Limit: 4, Window: window})
+
+	for i := range 4 {
+		if !allow(t, limiter, "a").Allowed {
+			t.Fatalf("expected attempt %d to be allowed", i+1)
+		}
+	}
+	decision := allow(t, limiter, "a")
+	if decision.Allowed {
+		t.Fatal("expected window to be exhausted")
+	}
+	// All four attempts must age out of the next window by a quarter.
+	if decision.RetryAfter != window+window/4 {
+		t.Fatalf("expected retry after %s, got %s", window+window/4, decision.RetryAfter)
+	}
+
+	// Halfway into the next window, the previous window counts for half.
+	clock.Advance(window + window/2)
+	for i := range 2 {
+		if !allow(t, limiter, "a").Allowed {
+			t.Fatalf("expected attempt %d in the next window to be allowed", i+1)
+		}
+	}
+	decision = allow(t, limiter, "a")
+	if decision.Allowed {
+		t.Fatal("expected weighted count to reach the limit")
+	}
+	clock.Advance(decision.RetryAfter)
+	if !allow(t, limiter, "a").Allowed {
+		t.Fatal("expected attempt to be allowed after the retry delay")
+	}
+
+	clock.Advance(2 * window)
+	decision = allow(t, limiter, "a")
+	if !decision.Allowed || decision.Remaining != 3 {
+		t.Fatalf("expected an empty window, got %+v", decision)
+	}
+}
+
+func TestLimiterHashesKeys(t *testing.T) {
+	store := &recordingStore{}
+	limiter := NewLimiter(store, Policy{Name: "login", Algorithm: TokenBucket, Limit: 1, Window: time.Minute})
+
+	allow(t, limiter, "email:someone@example.com")
+	if !strings.HasPrefix(store.key, "login:") || strings.Contains(store.key, "example.com") {
+		t.Fatalf("expected hashed key with policy prefix, got %q", store.key)
+	}
+}
+
+func TestMemoryStoreSweepsExpiredState(t *testing.T) {
+	clock := &fakeClock{now: time.UnixMilli(1_700_000_000_000)}
+	store := NewMemoryStore()
+	store.now = clock.Now
+	limiter := newTestLimiter(store, clock, Policy{Name: "test", Algorithm: TokenBucket, Limit: 1, Window: time.Second})
+
+	allow(t, limiter, "a")
+	allow(t, limiter, "b")
+	if store.Len() != 2 {
+		t.Fatalf("expected 2 entries, got %d", store.Len())
+	}
+
+	clock.Advance(2 * memoryStoreSweepInterval)
+	allow(t, limiter, "c")
+	if store.Len() != 1 {
+		t.Fatalf("expected expired entries to be swept, got %d", store.Len())
+	}
+}
+
+func TestSQLStore(t *testing.T) {
+	clock := &fakeClock{now: time.UnixMilli(1_700_000_000_000)}
+	db := newFakeRateLimitDB()
+	store := NewSQLStore(db)
+	store.now = clock.Now
+	limiter := newTestLimiter(store, clock, Policy{Name: "test", Algorithm: TokenBucket, Limit: 2, Window: time.Minute})
+
+	if !allow(t, limiter, "a").Allowed || !allow(t, limiter, "a").Allowed {
+		t.Fatal("expected burst to be allowed")
+	}
+	if allow(t, limiter, "a").Allowed {
+		t.Fatal("expected state to be shared through the database")
+	}
+	if db.sweeps != 1 {
+		t.Fatalf("expected a single sweep, got %d", db.sweeps)
+	}
+
+	// A concurrent writer bumps the version between the read and the
+	// update; the store retries with fresh state.
+	clock.Advance(time.Hour)
+	db.conflicts = 1
+	if !allow(t, limiter, "a").Allowed {
+		t.Fatal("expected update to succeed after a retry")
+	}
+
+	db.conflicts = sqlStoreMaxAttempts
+	if _, err := limiter.Allow(context.Background(), "a"); err == nil {
+		t.Fatal("expected contention error")
+	}
+}
+
+type recordingStore struct {
+	key string
+}
+
+func (s *recordingStore) Update(ctx context.Context, key string, fn func(state *State)) error {
+	s.key = key
+	fn(&State{})
+	return nil
+}
+
+// fakeRateLimitDB implements the rate limit methods of ubdata.DataAdapter.
+type fakeRateLimitDB struct {
+	ubdata.DataAdapter
+
+	mu        sync.Mutex
+	rows      map[string]ubdata.RateLimit
+	conflicts int
+	sweeps    int
+}
+
+func newFakeRateLimitDB() *fakeRateLimitDB {
+	return &fakeRateLimitDB{rows: make(map[string]ubdata.RateLimit)}
+}
+
+func (f *fakeRateLimitDB) GetRateLimit(ctx context.Context, key string) (ubdata.RateLimit, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	row, ok := f.rows[key]
+	return row, ok, nil
+}
+
+func (f *fakeRateLimitDB) InsertRateLimit(ctx context.Context, limit ubdata.RateLimit) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.rows[limit.Key]; ok {
+		return false, nil
+	}
+	limit.Version = 1
+	f.rows[limit.Key] = limit
+	return true, nil
+}
+
+func (f *fakeRateLimitDB) UpdateRateLimit(ctx context.Context, limit ubdata.RateLimit) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	row, ok := f.rows[limit.Key]
+	if f.conflicts > 0 {
+		f.conflicts--
+		row.Version++
+		f.rows[limit.Key] = row
+	}
+	if !ok || row.Version != limit.Version {
+		return false, nil
+	}
+	limit.Version++
+	f.rows[limit.Key] = limit
+	return true, nil
+}
+
+func (f *fakeRateLimitDB) DeleteExpiredRateLimits(ctx context.Context, before int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sweeps++
+	for key, row := range f.rows {
+		if row.ExpiresAt <= before {
+			delete(f.rows, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package ubratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/ubdata"
+)
+
+// SQLStore keeps limiter state in the application database so that limits
+// are shared by every instance of the application. Concurrent updates of the
+// same key are resolved with optimistic concurrency and retried.
+type SQLStore struct {
+	db  ubdata.DataAdapter
+	now func() time.Time
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+const (
+	sqlStoreMaxAttempts   = 5
+	sqlStoreSweepInterval = 5 * time.Minute
+)
+
+var ErrContention = errors.New("rate limit bucket is under contention")
+
+func NewSQLStore(db ubdata.DataAdapter) *SQLStore {
+	return &SQLStore{
+		db:  db,
+		now: time.Now,
+	}
+}
+
+func (s *SQLStore) Update(ctx context.Context, key string, fn func(state *State)) error {
+	now := s.now()
+	s.sweep(ctx, now)
+
+	for range sqlStoreMaxAttempts {
+		stored, found, err := s.db.GetRateLimit(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		state := State{}
+		if found && stored.ExpiresAt > now.UnixMilli() {
+			state = State{
+				Amount:         stored.Amount,
+				PreviousAmount: stored.PreviousAmount,
+				UpdatedAt:      stored.UpdatedAt,
+				ExpiresAt:      stored.ExpiresAt,
+			}
+		}
+		fn(&state)
+
+		updated := ubdata.RateLimit{
+			Key:            key,
+			Amount:         state.Amount,
+			PreviousAmount: state.PreviousAmount,
+			UpdatedAt:      state.UpdatedAt,
+			ExpiresAt:      state.ExpiresAt,
+			Version:        stored.Version,
+		}
+
+		var ok bool
+		if found {
+			ok, err = s.db.UpdateRateLimit(ctx, updated)
+		} else {
+			ok, err = s.db.InsertRateLimit(ctx, updated)
+		}
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to update rate limit %s: %w", key, ErrContention)
+}
+
+// sweep deletes expired buckets, at most once per sweep interval.
+func (s *SQLStore) sweep(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	if now.Sub(s.lastSweep) < sqlStoreSweepInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastSweep = now
+	s.mu.Unlock()
+
+	if err := s.db.DeleteExpiredRateLimits(ctx, now.UnixMilli()); err != nil {
+		slog.Error("Failed to delete expired rate limits", "error", err)
+	}
+}
@@ -15,6 +15,9 @@ type Response[T any] struct {
 	Message          string                         `json:"message,omitempty"`
 	ValidationIssues []ubvalidation.ValidationIssue `json:"validationIssues,omitempty"`
 	Data             T                              `json:"data,omitempty"`
+	// RetryAfter is the number of seconds to wait before retrying a rate
+	// limited request.
+	RetryAfter int64 `json:"retryAfter,omitempty"`
 }
 
 func (r Response[T]) ToJSON() ([]byte, error) {
@@ -82,6 +85,14 @@ func StatusError[T any](status ubstatus.StatusCode, message string) Response[T]
 	}
 }
 
+func RateLimited[T any](message string, retryAfter int64) Response[T] {
+	return Response[T]{
+		Status:     ubstatus.RateLimited,
+		Message:    message,
+		RetryAfter: retryAfter,
+	}
+}
+
 func MapStatusToHttpStatus(status ubstatus.StatusCode) int {
 	var statusHeader = http.StatusOK
 	switch status {
@@ -93,6 +104,8 @@ func MapStatusToHttpStatus(status ubstatus.StatusCode) int {
 		statusHeader = http.StatusNotFound
 	case ubstatus.AlreadyExists:
 		statusHeader = http.StatusConflict
+	case ubstatus.RateLimited:
+		statusHeader = http.StatusTooManyRequests
 	default:
 		statusHeader = http.StatusInternalServerError
 	}
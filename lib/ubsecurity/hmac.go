@@ -0,0 +1,61 @@
+package ubsecurity
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// HmacSha256HashPrefix marks base64 hashes generated by HmacSha256HashGenerator
+// so they can be told apart from argon2id hashes.
+const HmacSha256HashPrefix = "hmac-sha256$"
+
+// Use to hash high-entropy secrets such as API keys with a keyed HMAC-SHA256.
+// Unlike argon2id this is cheap enough to run on every request, and is only
+// safe for secrets that are long random strings rather than passwords.
+type HmacSha256HashGenerator struct {
+	// Key for the HMAC. It must be kept secret and should be at least 32
+	// random bytes.
+	Pepper []byte
+}
+
+// Generates the HMAC of the specified string.
+func (h HmacSha256HashGenerator) GenerateHashBytes(target string) []byte {
+	mac := hmac.New(sha256.New, h.Pepper)
+	mac.Write([]byte(target))
+	return mac.Sum(nil)
+}
+
+// Generates the HMAC of a string and returns it base64 encoded with
+// HmacSha256HashPrefix.
+func (h HmacSha256HashGenerator) GenerateHashBase64(target string) (string, error) {
+	hashedBytes := h.GenerateHashBytes(target)
+	return HmacSha256HashPrefix + base64.StdEncoding.EncodeToString(hashedBytes), nil
+}
+
+// Verifies the specified target bytes against the HMAC in constant time.
+func (h HmacSha256HashGenerator) Verify(target []byte, hashed []byte) bool {
+	return hmac.Equal(h.GenerateHashBytes(string(target)), hashed)
+}
+
+// Verifies the specified target against a hash generated by
+// GenerateHashBase64.
+func (h HmacSha256HashGenerator) VerifyBase64(target string, base64Hash string) (bool, error) {
+	encoded, ok := strings.CutPrefix(base64Hash, HmacSha256HashPrefix)
+	if !ok {
+		return false, fmt.Errorf("hash is not an hmac-sha256 hash")
+	}
+	hash, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode base64 hash: %w", err)
+	}
+	return h.Verify([]byte(target), hash), nil
+}
+
+// IsHmacSha256Hash reports whether the base64 hash was generated by
+// HmacSha256HashGenerator.
+func IsHmacSha256Hash(base64Hash string) bool {
+	return strings.HasPrefix(base64Hash, HmacSha256HashPrefix)
+}
@@ -0,0 +1,97 @@
+package ubsecurity
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHmacSha256HashGenerator(t *testing.T) {
+	generator := HmacSha256HashGenerator{Pepper: []byte("testPepper")}
+	secret := GenerateSecureRandomString(30)
+
+	t.Run("Round trip", func(t *testing.T) {
+		hashBase64, err := generator.GenerateHashBase64(secret)
+		if err != nil {
+			t.Fatalf("GenerateHashBase64 failed: %v", err)
+		}
+		if !strings.HasPrefix(hashBase64, HmacSha256HashPrefix) || !IsHmacSha256Hash(hashBase64) {
+			t.Fatalf("expected hash to start with %q, got %q", HmacSha256HashPrefix, hashBase64)
+		}
+
+		valid, err := generator.VerifyBase64(secret, hashBase64)
+		if err != nil {
+			t.Fatalf("VerifyBase64 failed: %v", err)
+		}
+		if !valid {
+			t.Error("Failed to verify correct secret")
+		}
+
+		valid, err = generator.VerifyBase64(secret+"x", hashBase64)
+		if err != nil {
+			t.Fatalf("VerifyBase64 failed: %v", err)
+		}
+		if valid {
+			t.Error("Incorrectly verified wrong secret")
+		}
+	})
+
+	t.Run("Deterministic", func(t *testing.T) {
+		a, _ := generator.GenerateHashBase64(secret)
+		b, _ := generator.GenerateHashBase64(secret)
+		if a != b {
+			t.Error("Expected the same secret to hash to the same value")
+		}
+	})
+
+	t.Run("Pepper mismatch fails verification", func(t *testing.T) {
+		hashBase64, _ := generator.GenerateHashBase64(secret)
+		other := HmacSha256HashGenerator{Pepper: []byte("otherPepper")}
+		valid, err := other.VerifyBase64(secret, hashBase64)
+		if err != nil {
+			t.Fatalf("VerifyBase64 failed: %v", err)
+		}
+		if valid {
+			t.Error("Verified with the wrong pepper")
+		}
+	})
+
+	t.Run("Rejects argon2id hashes", func(t *testing.T) {
+		argonHash, _ := DefaultArgon2Id.GenerateHashBase64(secret)
+		if IsHmacSha256Hash(argonHash) {
+			t.Fatal("argon2id hash detected as hmac-sha256")
+		}
+		if _, err := generator.VerifyBase64(secret, argonHash); err == nil {
+			t.Error("Expected an error verifying an argon2id hash")
+		}
+	})
+}
+
+// The benchmarks compare verifying an API key secret under concurrent load.
+// Run with -cpu to vary the number of concurrent verifiers.
+
+func benchmarkVerifyParallel(b *testing.B, generator HashGenerator) {
+	secret := GenerateSecureRandomString(30)
+	hash, err := generator.GenerateHashBase64(secret)
+	if err != nil {
+		b.Fatalf("GenerateHashBase64 failed: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if ok, err := generator.VerifyBase64(secret, hash); err != nil || !ok {
+				b.Fatal("verification failed")
+			}
+		}
+	})
+}
+
+func BenchmarkVerifyArgon2IdParallel(b *testing.B) {
+	generator := DefaultArgon2Id
+	generator.Pepper = []byte("benchmarkPepper")
+	benchmarkVerifyParallel(b, generator)
+}
+
+func BenchmarkVerifyHmacSha256Parallel(b *testing.B) {
+	benchmarkVerifyParallel(b, HmacSha256HashGenerator{Pepper: []byte("benchmarkPepper")})
+}
@@ -10,4 +10,5 @@ const (
 	AlreadyExists   StatusCode = "already_exists"
 	ValidationError StatusCode = "validation_error"
 	UnexpectedError StatusCode = "unexpected_error"
+	RateLimited     StatusCode = "rate_limited"
 )
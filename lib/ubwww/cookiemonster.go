@@ -19,6 +19,17 @@ type CookieMonster struct {
 	secure            bool
 	cookieKey         contracts.CookieContextKey
 	identityKey       contracts.IdentityContextKey
+	sessionValidator  contracts.SessionValidator
+}
+
+type CookieMonsterOption func(*CookieMonster)
+
+// WithSessionValidator checks every unexpired token with the validator and
+// clears the cookie of sessions it rejects.
+func WithSessionValidator(validator contracts.SessionValidator) CookieMonsterOption {
+	return func(c *CookieMonster) {
+		c.sessionValidator = validator
+	}
 }
 
 func NewCookieMonster(
@@ -27,8 +38,9 @@ func NewCookieMonster(
 	secure bool,
 	tokenSoftExpiry int64,
 	cookieKey contracts.CookieContextKey,
-	identityKey contracts.IdentityContextKey) contracts.AuthTokenCookieManager {
-	return &CookieMonster{
+	identityKey contracts.IdentityContextKey,
+	opts ...CookieMonsterOption) contracts.AuthTokenCookieManager {
+	cookieMonster := &CookieMonster{
 		encryptionService: encryptionService,
 		cookieName:        cookieName,
 		secure:            secure,
@@ -36,6 +48,12 @@ func NewCookieMonster(
 		cookieKey:         cookieKey,
 		identityKey:       identityKey,
 	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(cookieMonster)
+		}
+	}
+	return cookieMonster
 }
 
 func (c *CookieMonster) ClearAuthTokenCookie(w http.ResponseWriter) {
@@ -132,6 +150,9 @@ func (c *CookieMonster) middlewareHandler(w http.ResponseWriter, r *http.Request
 		if token.IsExpired() {
 			slog.Debug("Auth token cookie is expired, clearing cookie")
 			c.ClearAuthTokenCookie(w)
+		} else if c.sessionValidator != nil && !c.sessionValidator.SessionValid(r.Context(), token) {
+			slog.Debug("Auth token session is no longer valid, clearing cookie")
+			c.ClearAuthTokenCookie(w)
 		} else {
 			updateTime := time.Now().Add(time.Duration(c.tokenSoftExpiry) * time.Second).Unix()
 			token.Touch(updateTime)
@@ -143,6 +164,9 @@ func (c *CookieMonster) middlewareHandler(w http.ResponseWriter, r *http.Request
 			ctx := r.Context()
 			ctx = context.WithValue(ctx, c.cookieKey, token)
 			ctx = context.WithValue(ctx, c.identityKey, token.ToUserIdentity())
+			if token.IsImpersonating() {
+				ctx = contracts.WithImpersonation(ctx, token.ToImpersonation())
+			}
 			r = r.WithContext(ctx)
 		}
 	}
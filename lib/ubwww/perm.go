@@ -1,6 +1,7 @@
 package ubwww
 
 import (
+	"net"
 	"net/http"
 	"strings"
 
@@ -38,18 +39,32 @@ func (pm *PermissionMiddleware) RequirePermission(permission string, next http.H
 			return
 		}
 
-		// Check if the user has the required permission
-		hasPermission, err := pm.prefectService.UserHasPermission(r.Context(), identity.UserID, identity.OrganizationID, permission)
+		// Load the permissions the user holds for this request once, so
+		// handlers and templates can check further permissions from the
+		// request context. Permissions granted under a policy are only
+		// included when the policy allows this request.
+		userPermissions, err := pm.prefectService.UserPermissionsFor(r.Context(), identity.UserID, identity.OrganizationID,
+			ubmanage.PolicyInput{IpAddress: RemoteIP(r)})
 		if err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
-		if !hasPermission {
+		permissions := contracts.Permissions(userPermissions)
+		if !permissions.Has(permission) {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
 
 		// Call the next handler if permission is granted
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(contracts.WithPermissions(r.Context(), permissions)))
 	}
 }
+
+// RemoteIP returns the IP address of the request's connection. Login records
+// and policy checks both use it, so they always see the same address.
+func RemoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,117 @@
+package ubwww
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kernelplex/ubase/lib/contracts"
+	"github.com/kernelplex/ubase/lib/ubratelimit"
+)
+
+type RateLimiter interface {
+	Allow(ctx context.Context, key string) (ubratelimit.Decision, error)
+}
+
+// RateLimitKeyFunc returns the key a request is limited by. An empty key
+// exempts the request.
+type RateLimitKeyFunc func(r *http.Request) string
+
+// RateLimitedHandler renders the response for a rejected request. The
+// Retry-After header is already set when it is called.
+type RateLimitedHandler func(w http.ResponseWriter, r *http.Request, retryAfter time.Duration)
+
+type RateLimitMiddleware struct {
+	limiter RateLimiter
+	keyFunc RateLimitKeyFunc
+	handler RateLimitedHandler
+}
+
+type RateLimitOption func(*RateLimitMiddleware)
+
+// WithRateLimitKeyFunc limits requests by a custom key instead of the client
+// IP address.
+func WithRateLimitKeyFunc(keyFunc RateLimitKeyFunc) RateLimitOption {
+	return func(m *RateLimitMiddleware) {
+		m.keyFunc = keyFunc
+	}
+}
+
+// WithRateLimitedHandler replaces the plain text 429 response.
+func WithRateLimitedHandler(handler RateLimitedHandler) RateLimitOption {
+	return func(m *RateLimitMiddleware) {
+		m.handler = handler
+	}
+}
+
+// NewRateLimitMiddleware limits unsafe requests (anything but GET, HEAD and
+// OPTIONS) per client IP address, so that forms can still be displayed while
+// their submissions are throttled.
+func NewRateLimitMiddleware(limiter RateLimiter, opts ...RateLimitOption) *RateLimitMiddleware {
+	middleware := &RateLimitMiddleware{
+		limiter: limiter,
+		keyFunc: RemoteIPKey,
+		handler: defaultRateLimitedHandler,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(middleware)
+		}
+	}
+	return middleware
+}
+
+// RemoteIPKey keys requests by the IP address of the connection. Behind a
+// reverse proxy, use a key function that reads the proxy's client header.
+func RemoteIPKey(r *http.Request) string {
+	return "ip:" + RemoteIP(r)
+}
+
+func defaultRateLimitedHandler(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+}
+
+func (m *RateLimitMiddleware) MiddlewareFunc(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := m.keyFunc(r)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		decision, err := m.limiter.Allow(r.Context(), key)
+		if err != nil {
+			// Fail open: per-account limits in the management service still
+			// apply, and a store outage should not lock everyone out.
+			slog.Error("Error checking rate limit", "path", r.URL.Path, "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !decision.Allowed {
+			slog.Warn("Request rate limited", "path", r.URL.Path, "retryAfter", decision.RetryAfter)
+			SetRetryAfter(w, decision.RetryAfter)
+			m.handler(w, r, decision.RetryAfter)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// Route wraps a route's handler with the middleware.
+func (m *RateLimitMiddleware) Route(route contracts.Route) contracts.Route {
+	route.Func = m.MiddlewareFunc(route.Func)
+	return route
+}
+
+// SetRetryAfter sets the Retry-After header in whole seconds.
+func SetRetryAfter(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.FormatInt(ubratelimit.RetryAfterSeconds(retryAfter), 10))
+}
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE user_logins (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    occurred_at BIGINT NOT NULL,
+    outcome VARCHAR(20) NOT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    ip_address VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    device_id VARCHAR(64) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX user_logins_user_id_idx ON user_logins (user_id, occurred_at);
+CREATE INDEX user_logins_ip_address_idx ON user_logins (ip_address);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX user_logins_ip_address_idx;
+DROP INDEX user_logins_user_id_idx;
+DROP TABLE user_logins;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE rate_limits (
+    bucket_key VARCHAR(255) PRIMARY KEY,
+    amount DOUBLE PRECISION NOT NULL,
+    previous_amount DOUBLE PRECISION NOT NULL DEFAULT 0,
+    updated_at BIGINT NOT NULL,
+    expires_at BIGINT NOT NULL,
+    version BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX rate_limits_expires_at_idx ON rate_limits (expires_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX rate_limits_expires_at_idx;
+DROP TABLE rate_limits;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE users ADD COLUMN service_account BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN owner_organization_id BIGINT;
+
+CREATE INDEX users_owner_organization_id_idx ON users (owner_organization_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX users_owner_organization_id_idx;
+ALTER TABLE users DROP COLUMN owner_organization_id;
+ALTER TABLE users DROP COLUMN service_account;
+-- +goose StatementEnd
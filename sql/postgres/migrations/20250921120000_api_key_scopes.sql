@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Space separated permissions and wildcard scopes. Empty means the key
+-- carries all of its owner's permissions in the organization.
+ALTER TABLE user_api_keys ADD COLUMN scopes TEXT NOT NULL DEFAULT '';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE user_api_keys DROP COLUMN scopes;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Last use is recorded at most every few minutes per key, so it is
+-- approximate.
+ALTER TABLE user_api_keys ADD COLUMN last_used_at TIMESTAMP;
+ALTER TABLE user_api_keys ADD COLUMN last_used_ip TEXT NOT NULL DEFAULT '';
+
+-- Space separated CIDR ranges the key may be used from. Empty means any
+-- address.
+ALTER TABLE user_api_keys ADD COLUMN allowed_cidrs TEXT NOT NULL DEFAULT '';
+
+-- Id of the key that replaced this one when it was rotated.
+ALTER TABLE user_api_keys ADD COLUMN replaced_by TEXT NOT NULL DEFAULT '';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE user_api_keys DROP COLUMN replaced_by;
+ALTER TABLE user_api_keys DROP COLUMN allowed_cidrs;
+ALTER TABLE user_api_keys DROP COLUMN last_used_ip;
+ALTER TABLE user_api_keys DROP COLUMN last_used_at;
+-- +goose StatementEnd
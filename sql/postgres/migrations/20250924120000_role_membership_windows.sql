@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Unix times a role membership is valid from and until. Zero means the
+-- membership is not bounded on that side.
+ALTER TABLE user_roles ADD COLUMN not_before BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE user_roles ADD COLUMN expires_at BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX user_roles_expires_at_idx ON user_roles (expires_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX user_roles_expires_at_idx;
+ALTER TABLE user_roles DROP COLUMN expires_at;
+ALTER TABLE user_roles DROP COLUMN not_before;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Per-user data keys, wrapped by the master encryption key. Personal data in
+-- user events is sealed with these keys, so deleting a user's row when they
+-- are erased leaves their event history unreadable. The keys are kept out of
+-- the event store because its events are never deleted.
+CREATE TABLE user_data_keys (
+    user_id BIGINT PRIMARY KEY,
+    wrapped_key TEXT NOT NULL
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE user_data_keys;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Unix time in nanoseconds the membership was last granted, so decisions about
+-- a membership can tell whether it was granted again since. Zero for
+-- memberships granted before it was recorded.
+ALTER TABLE user_roles ADD COLUMN granted_at BIGINT NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE user_roles DROP COLUMN granted_at;
+-- +goose StatementEnd
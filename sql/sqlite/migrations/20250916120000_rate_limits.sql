@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE rate_limits (
+    bucket_key VARCHAR(255) PRIMARY KEY,
+    amount REAL NOT NULL,
+    previous_amount REAL NOT NULL DEFAULT 0,
+    updated_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    version INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX rate_limits_expires_at_idx ON rate_limits (expires_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX rate_limits_expires_at_idx;
+DROP TABLE rate_limits;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Relationship tuples of the form object_type:object_id#relation@subject.
+-- A subject is either a single principal (subject_relation is empty) or
+-- everyone holding subject_relation on another object.
+CREATE TABLE relation_tuples (
+    object_type VARCHAR(64) NOT NULL,
+    object_id VARCHAR(255) NOT NULL,
+    relation VARCHAR(64) NOT NULL,
+    subject_type VARCHAR(64) NOT NULL,
+    subject_id VARCHAR(255) NOT NULL,
+    subject_relation VARCHAR(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (object_type, object_id, relation, subject_type, subject_id, subject_relation)
+);
+
+CREATE INDEX relation_tuples_subject_idx ON relation_tuples (subject_type, subject_id, subject_relation);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX relation_tuples_subject_idx;
+DROP TABLE relation_tuples;
+-- +goose StatementEnd
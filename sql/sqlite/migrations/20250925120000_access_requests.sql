@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Requests by users for a role, decided by the organization's approvers.
+-- Times are unix seconds; decided_by, decided_at and expires_at are zero
+-- until the request is decided.
+CREATE TABLE access_requests (
+    id INTEGER PRIMARY KEY,
+    organization_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    role_id INTEGER NOT NULL,
+    justification VARCHAR(1000) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    requested_at INTEGER NOT NULL,
+    decided_by INTEGER NOT NULL DEFAULT 0,
+    decided_at INTEGER NOT NULL DEFAULT 0,
+    comment VARCHAR(1000) NOT NULL DEFAULT '',
+    expires_at INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX access_requests_organization_id_idx ON access_requests (organization_id, status, requested_at);
+CREATE INDEX access_requests_user_id_idx ON access_requests (user_id, role_id, status);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX access_requests_user_id_idx;
+DROP INDEX access_requests_organization_id_idx;
+DROP TABLE access_requests;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Access review campaigns, in which reviewers certify that each role
+-- membership of an organization is still needed. The memberships and
+-- decisions are kept on the campaign's aggregate. Times are unix seconds;
+-- closed_at and revoked_count are zero until the campaign is closed.
+CREATE TABLE access_reviews (
+    id INTEGER PRIMARY KEY,
+    organization_id INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    started_at INTEGER NOT NULL,
+    closed_at INTEGER NOT NULL DEFAULT 0,
+    membership_count INTEGER NOT NULL,
+    revoked_count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX access_reviews_organization_id_idx ON access_reviews (organization_id, started_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX access_reviews_organization_id_idx;
+DROP TABLE access_reviews;
+-- +goose StatementEnd
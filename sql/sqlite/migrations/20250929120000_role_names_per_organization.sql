@@ -0,0 +1,47 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Role names only need to be unique within their organization, so role
+-- templates can give every organization the same role names. SQLite cannot
+-- drop a table constraint, so the table is rebuilt. user_roles and
+-- role_permissions reference roles, so when foreign keys are enforced their
+-- checks are deferred to the end of the migration's transaction: the roles
+-- are copied back into the rebuilt table, which satisfies them again before
+-- the commit. The pragma ends with the transaction, so connections keep
+-- their foreign key setting.
+PRAGMA defer_foreign_keys=ON;
+CREATE TEMPORARY TABLE roles_copy AS SELECT id, organization_id, name, system_name FROM roles;
+DROP TABLE roles;
+CREATE TABLE roles (
+	id INTEGER PRIMARY KEY,
+	organization_id INTEGER NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	system_name VARCHAR(255) NOT NULL,
+	FOREIGN KEY(organization_id) REFERENCES organizations(id),
+	unique(organization_id, name),
+	unique(system_name)
+);
+INSERT INTO roles (id, organization_id, name, system_name)
+SELECT id, organization_id, name, system_name FROM roles_copy;
+DROP TABLE roles_copy;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+PRAGMA defer_foreign_keys=ON;
+CREATE TEMPORARY TABLE roles_copy AS SELECT id, organization_id, name, system_name FROM roles;
+DROP TABLE roles;
+CREATE TABLE roles (
+	id INTEGER PRIMARY KEY,
+	organization_id INTEGER NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	system_name VARCHAR(255) NOT NULL,
+	FOREIGN KEY(organization_id) REFERENCES organizations(id),
+	unique(name),
+	unique(system_name)
+);
+INSERT INTO roles (id, organization_id, name, system_name)
+SELECT id, organization_id, name, system_name FROM roles_copy;
+DROP TABLE roles_copy;
+-- +goose StatementEnd
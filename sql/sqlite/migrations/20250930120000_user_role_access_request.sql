@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- The access request whose approval granted the membership, or zero when it
+-- was granted directly.
+ALTER TABLE user_roles ADD COLUMN access_request_id BIGINT NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE user_roles DROP COLUMN access_request_id;
+-- +goose StatementEnd
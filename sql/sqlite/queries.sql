@@ -60,8 +60,18 @@ SELECT r.id, r.name, r.system_name FROM roles r
 WHERE r.organization_id = sqlc.arg(organization_id);
 
 -- name: AddUserToRole :exec
-INSERT INTO user_roles (user_id, role_id) 
-VALUES (sqlc.arg(user_id), sqlc.arg(role_id));
+INSERT INTO user_roles (user_id, role_id, not_before, expires_at, granted_at, access_request_id)
+VALUES (sqlc.arg(user_id), sqlc.arg(role_id), sqlc.arg(not_before), sqlc.arg(expires_at), sqlc.arg(granted_at), sqlc.arg(access_request_id))
+ON CONFLICT (user_id, role_id) DO UPDATE SET not_before = excluded.not_before, expires_at = excluded.expires_at, granted_at = excluded.granted_at, access_request_id = excluded.access_request_id;
+
+-- name: ListExpiredUserRoles :many
+SELECT user_id, role_id, not_before, expires_at, granted_at, access_request_id FROM user_roles
+WHERE expires_at > 0 AND expires_at <= sqlc.arg(now)
+ORDER BY expires_at;
+
+-- name: GetUserRole :one
+SELECT user_id, role_id, not_before, expires_at, granted_at, access_request_id FROM user_roles
+WHERE user_id = sqlc.arg(user_id) AND role_id = sqlc.arg(role_id);
 
 -- name: RemoveUserFromRole :exec
 DELETE FROM user_roles WHERE user_id = sqlc.arg(user_id) AND role_id = sqlc.arg(role_id);
@@ -79,7 +89,8 @@ JOIN roles r ON r.id = ur.role_id
 WHERE ur.user_id = sqlc.arg(user_id) AND r.organization_id = sqlc.arg(organization_id);
 
 -- name: GetAllUserOrganizationRoles :many
-SELECT r.id, r.name, r.system_name, o.id as organization_id, o.name as organization_name, o.system_name as organization_system_name
+SELECT r.id, r.name, r.system_name, o.id as organization_id, o.name as organization_name, o.system_name as organization_system_name,
+	ur.not_before, ur.expires_at, ur.access_request_id
 FROM user_roles ur
 JOIN roles r ON r.id = ur.role_id
 JOIN organizations o ON o.id = r.organization_id
@@ -127,6 +138,9 @@ SELECT id, first_name, last_name, display_name, email, verified FROM users WHERE
 -- name: GetUserByEmail :one
 SELECT id, first_name, last_name, display_name, email, verified FROM users WHERE email = sqlc.arg(email);
 
+-- name: DeleteUser :exec
+DELETE FROM users WHERE id = sqlc.arg(id);
+
 -- name: UpdateUser :exec
 UPDATE users SET first_name = sqlc.arg(first_name), last_name = sqlc.arg(last_name), display_name = sqlc.arg(display_name), email = sqlc.arg(email), verified = sqlc.arg(verified), updated_at = sqlc.arg(updated_at) WHERE id = sqlc.arg(id);
 
@@ -134,14 +148,15 @@ UPDATE users SET first_name = sqlc.arg(first_name), last_name = sqlc.arg(last_na
 -- name: ListUserOrganizationRoles :many
 SELECT o.id as organization_id, o.name as organization, 
 	o.system_name as organization_system_name,
-	r.id as role_id, r.name as role_name, r.system_name as role_system_name 
+	r.id as role_id, r.name as role_name, r.system_name as role_system_name,
+	ur.not_before, ur.expires_at, ur.access_request_id
 FROM user_roles ur
 JOIN roles r ON r.id = ur.role_id
 JOIN organizations o ON o.id = r.organization_id
 WHERE ur.user_id = sqlc.arg(user_id);
 
 -- name: UsersCount :one
-SELECT COUNT(*) AS count FROM users;
+SELECT COUNT(*) AS count FROM users WHERE service_account = FALSE;
 
 -- name: OrganizationsCount :one
 SELECT COUNT(*) AS count FROM organizations;
@@ -154,6 +169,7 @@ WHERE id = sqlc.arg(id);
 
 -- name: ListRecentUserIds :many
 SELECT id FROM users
+WHERE service_account = FALSE
 ORDER BY last_login DESC
 LIMIT sqlc.arg(limit);
 
@@ -167,25 +183,211 @@ GROUP BY r.id;
 -- name: UserSearch :many
 SELECT id, first_name, last_name, display_name, email, verified
 FROM users
-WHERE email LIKE sqlc.arg(query) OR display_name LIKE sqlc.arg(query)
+WHERE service_account = FALSE AND (email LIKE sqlc.arg(query) OR display_name LIKE sqlc.arg(query))
 LIMIT sqlc.arg(count) OFFSET sqlc.arg(start);
 
+-- name: AddServiceAccount :exec
+INSERT INTO users (id, first_name, last_name, display_name, email, verified, created_at, updated_at, service_account, owner_organization_id)
+VALUES (sqlc.arg(id), '', '', sqlc.arg(display_name), sqlc.arg(email), TRUE, sqlc.arg(created_at), sqlc.arg(updated_at), TRUE, sqlc.arg(owner_organization_id));
+
+-- name: ListServiceAccounts :many
+SELECT u.id, u.display_name, u.owner_organization_id, o.name AS organization_name, u.created_at
+FROM users u
+JOIN organizations o ON o.id = u.owner_organization_id
+WHERE u.service_account = TRUE
+ORDER BY o.name, u.display_name;
+
+-- name: ListOrganizationServiceAccounts :many
+SELECT u.id, u.display_name, u.owner_organization_id, o.name AS organization_name, u.created_at
+FROM users u
+JOIN organizations o ON o.id = u.owner_organization_id
+WHERE u.service_account = TRUE AND u.owner_organization_id = sqlc.arg(owner_organization_id)
+ORDER BY u.display_name;
+
 -- name: UserAddApiKey :exec
-INSERT INTO user_api_keys (id, secret_hash, user_id, organization_id, name, created_at, expires_at)
-VALUES (sqlc.arg(id), sqlc.arg(secret_hash), sqlc.arg(user_id), sqlc.arg(organization_id), sqlc.arg(name), sqlc.arg(created_at), sqlc.arg(expires_at));
+INSERT INTO user_api_keys (id, secret_hash, user_id, organization_id, name, created_at, expires_at, scopes, allowed_cidrs)
+VALUES (sqlc.arg(id), sqlc.arg(secret_hash), sqlc.arg(user_id), sqlc.arg(organization_id), sqlc.arg(name), sqlc.arg(created_at), sqlc.arg(expires_at), sqlc.arg(scopes), sqlc.arg(allowed_cidrs));
 
 
 -- name: UserDeleteApiKey :exec
 DELETE FROM user_api_keys
 WHERE id = sqlc.arg(id) AND user_id = sqlc.arg(user_id);
 
+-- name: UserDeleteAllApiKeys :exec
+DELETE FROM user_api_keys
+WHERE user_id = sqlc.arg(user_id);
+
+-- name: UserDataKeyGet :one
+SELECT wrapped_key FROM user_data_keys WHERE user_id = sqlc.arg(user_id);
+
+-- name: UserDataKeyAdd :exec
+INSERT INTO user_data_keys (user_id, wrapped_key)
+VALUES (sqlc.arg(user_id), sqlc.arg(wrapped_key))
+ON CONFLICT (user_id) DO NOTHING;
+
+-- name: UserDataKeyDelete :exec
+DELETE FROM user_data_keys WHERE user_id = sqlc.arg(user_id);
+
 -- name: UserGetApiKey :one
-SELECT id, secret_hash, user_id, organization_id, name, created_at, expires_at
+SELECT id, secret_hash, user_id, organization_id, name, created_at, expires_at, scopes, allowed_cidrs, replaced_by, last_used_at, last_used_ip
 FROM user_api_keys
 WHERE id = sqlc.arg(api_key_hash);
 
 -- name: UserListApiKeys :many
-SELECT id, user_id, organization_id, name, created_at, expires_at
+SELECT id, user_id, organization_id, name, created_at, expires_at, scopes, allowed_cidrs, replaced_by, last_used_at, last_used_ip
 FROM user_api_keys
+WHERE user_id = sqlc.arg(user_id)
+ORDER BY created_at, id;
+
+-- name: UserRecordApiKeyUse :exec
+UPDATE user_api_keys
+SET last_used_at = sqlc.arg(last_used_at), last_used_ip = sqlc.arg(last_used_ip)
+WHERE id = sqlc.arg(id);
+
+-- name: UserReplaceApiKey :exec
+UPDATE user_api_keys
+SET expires_at = sqlc.arg(expires_at), replaced_by = sqlc.arg(replaced_by)
+WHERE id = sqlc.arg(id) AND user_id = sqlc.arg(user_id);
+
+-- name: UserUpdateApiKeyHash :exec
+UPDATE user_api_keys
+SET secret_hash = sqlc.arg(secret_hash)
+WHERE id = sqlc.arg(id) AND user_id = sqlc.arg(user_id);
+
+
+-- name: AddUserLogin :exec
+INSERT INTO user_logins (user_id, occurred_at, outcome, reason, ip_address, user_agent, device_id)
+VALUES (sqlc.arg(user_id), sqlc.arg(occurred_at), sqlc.arg(outcome), sqlc.arg(reason), sqlc.arg(ip_address), sqlc.arg(user_agent), sqlc.arg(device_id));
+
+-- name: ListUserLogins :many
+SELECT id, user_id, occurred_at, outcome, reason, ip_address, user_agent, device_id
+FROM user_logins
+WHERE user_id = sqlc.arg(user_id)
+ORDER BY occurred_at DESC, id DESC
+LIMIT sqlc.arg(count) OFFSET sqlc.arg(start);
+
+-- name: SearchUserLoginsByIp :many
+SELECT id, user_id, occurred_at, outcome, reason, ip_address, user_agent, device_id
+FROM user_logins
+WHERE ip_address LIKE sqlc.arg(query) ESCAPE '\'
+ORDER BY occurred_at DESC, id DESC
+LIMIT sqlc.arg(count) OFFSET sqlc.arg(start);
+
+-- name: DeleteUserLogins :exec
+DELETE FROM user_logins
 WHERE user_id = sqlc.arg(user_id);
 
+-- name: GetRateLimit :one
+SELECT bucket_key, amount, previous_amount, updated_at, expires_at, version
+FROM rate_limits
+WHERE bucket_key = sqlc.arg(bucket_key);
+
+-- name: InsertRateLimit :execrows
+INSERT INTO rate_limits (bucket_key, amount, previous_amount, updated_at, expires_at, version)
+VALUES (sqlc.arg(bucket_key), sqlc.arg(amount), sqlc.arg(previous_amount), sqlc.arg(updated_at), sqlc.arg(expires_at), 0)
+ON CONFLICT (bucket_key) DO NOTHING;
+
+-- name: UpdateRateLimit :execrows
+UPDATE rate_limits
+SET amount = sqlc.arg(amount), previous_amount = sqlc.arg(previous_amount), updated_at = sqlc.arg(updated_at), expires_at = sqlc.arg(expires_at), version = version + 1
+WHERE bucket_key = sqlc.arg(bucket_key) AND version = sqlc.arg(version);
+
+-- name: DeleteExpiredRateLimits :exec
+DELETE FROM rate_limits
+WHERE expires_at < sqlc.arg(before);
+
+-- name: AddRelationTuple :exec
+INSERT INTO relation_tuples (object_type, object_id, relation, subject_type, subject_id, subject_relation)
+VALUES (sqlc.arg(object_type), sqlc.arg(object_id), sqlc.arg(relation), sqlc.arg(subject_type), sqlc.arg(subject_id), sqlc.arg(subject_relation))
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteRelationTuple :exec
+DELETE FROM relation_tuples
+WHERE object_type = sqlc.arg(object_type) AND object_id = sqlc.arg(object_id) AND relation = sqlc.arg(relation)
+  AND subject_type = sqlc.arg(subject_type) AND subject_id = sqlc.arg(subject_id) AND subject_relation = sqlc.arg(subject_relation);
+
+-- name: ListRelationTuplesByObject :many
+SELECT object_type, object_id, relation, subject_type, subject_id, subject_relation
+FROM relation_tuples
+WHERE object_type = sqlc.arg(object_type) AND object_id = sqlc.arg(object_id)
+ORDER BY relation, subject_type, subject_id, subject_relation;
+
+-- name: ListRelationTuplesBySubject :many
+SELECT object_type, object_id, relation, subject_type, subject_id, subject_relation
+FROM relation_tuples
+WHERE subject_type = sqlc.arg(subject_type) AND subject_id = sqlc.arg(subject_id) AND subject_relation = sqlc.arg(subject_relation)
+ORDER BY object_type, object_id, relation;
+
+-- name: AddAccessRequest :exec
+INSERT INTO access_requests (id, organization_id, user_id, role_id, justification, status, requested_at)
+VALUES (sqlc.arg(id), sqlc.arg(organization_id), sqlc.arg(user_id), sqlc.arg(role_id), sqlc.arg(justification), sqlc.arg(status), sqlc.arg(requested_at));
+
+-- name: DecideAccessRequest :exec
+UPDATE access_requests
+SET status = sqlc.arg(status), decided_by = sqlc.arg(decided_by), decided_at = sqlc.arg(decided_at), comment = sqlc.arg(comment), expires_at = sqlc.arg(expires_at)
+WHERE id = sqlc.arg(id);
+
+-- name: CountUserRoleAccessRequests :one
+SELECT COUNT(*) AS count FROM access_requests
+WHERE user_id = sqlc.arg(user_id) AND role_id = sqlc.arg(role_id) AND status = sqlc.arg(status);
+
+-- name: GetAccessRequest :one
+SELECT ar.id, ar.organization_id, o.name AS organization_name, ar.user_id, u.display_name AS user_display_name, u.email AS user_email,
+    ar.role_id, r.name AS role_name, ar.justification, ar.status, ar.requested_at,
+    ar.decided_by, d.display_name AS decided_by_name, ar.decided_at, ar.comment, ar.expires_at
+FROM access_requests ar
+JOIN organizations o ON o.id = ar.organization_id
+JOIN users u ON u.id = ar.user_id
+JOIN roles r ON r.id = ar.role_id
+LEFT JOIN users d ON d.id = ar.decided_by
+WHERE ar.id = sqlc.arg(id);
+
+-- name: ListOrganizationAccessRequests :many
+SELECT ar.id, ar.organization_id, o.name AS organization_name, ar.user_id, u.display_name AS user_display_name, u.email AS user_email,
+    ar.role_id, r.name AS role_name, ar.justification, ar.status, ar.requested_at,
+    ar.decided_by, d.display_name AS decided_by_name, ar.decided_at, ar.comment, ar.expires_at
+FROM access_requests ar
+JOIN organizations o ON o.id = ar.organization_id
+JOIN users u ON u.id = ar.user_id
+JOIN roles r ON r.id = ar.role_id
+LEFT JOIN users d ON d.id = ar.decided_by
+WHERE ar.organization_id = sqlc.arg(organization_id) AND ar.status = sqlc.arg(status)
+ORDER BY ar.requested_at DESC, ar.id DESC;
+
+-- name: ListUserAccessRequests :many
+SELECT ar.id, ar.organization_id, o.name AS organization_name, ar.user_id, u.display_name AS user_display_name, u.email AS user_email,
+    ar.role_id, r.name AS role_name, ar.justification, ar.status, ar.requested_at,
+    ar.decided_by, d.display_name AS decided_by_name, ar.decided_at, ar.comment, ar.expires_at
+FROM access_requests ar
+JOIN organizations o ON o.id = ar.organization_id
+JOIN users u ON u.id = ar.user_id
+JOIN roles r ON r.id = ar.role_id
+LEFT JOIN users d ON d.id = ar.decided_by
+WHERE ar.user_id = sqlc.arg(user_id)
+ORDER BY ar.requested_at DESC, ar.id DESC;
+
+-- name: ListOrganizationUsersWithPermission :many
+SELECT DISTINCT u.id, u.email
+FROM users u
+JOIN user_roles ur ON ur.user_id = u.id
+JOIN roles r ON r.id = ur.role_id
+JOIN role_permissions rp ON rp.role_id = r.id
+WHERE r.organization_id = sqlc.arg(organization_id) AND rp.permission = sqlc.arg(permission)
+  AND u.service_account = FALSE
+  AND ur.not_before <= sqlc.arg(now) AND (ur.expires_at = 0 OR ur.expires_at > sqlc.arg(now))
+ORDER BY u.id;
+
+-- name: AddAccessReview :exec
+INSERT INTO access_reviews (id, organization_id, name, status, started_at, membership_count)
+VALUES (sqlc.arg(id), sqlc.arg(organization_id), sqlc.arg(name), sqlc.arg(status), sqlc.arg(started_at), sqlc.arg(membership_count));
+
+-- name: CloseAccessReview :exec
+UPDATE access_reviews
+SET status = sqlc.arg(status), closed_at = sqlc.arg(closed_at), revoked_count = sqlc.arg(revoked_count)
+WHERE id = sqlc.arg(id);
+
+-- name: ListOrganizationAccessReviews :many
+SELECT id, organization_id, name, status, started_at, closed_at, membership_count, revoked_count
+FROM access_reviews
+WHERE organization_id = sqlc.arg(organization_id)
+ORDER BY started_at DESC, id DESC;